@@ -16,6 +16,7 @@ import (
 	"mahresources/hash_worker"
 	"mahresources/models"
 	"mahresources/models/query_models"
+	"mahresources/storage"
 )
 
 // ---- helper functions ----
@@ -238,6 +239,7 @@ type ConfigSummary struct {
 	HasReadOnlyDB           bool     `json:"hasReadOnlyDB"`
 	FfmpegAvailable         bool     `json:"ffmpegAvailable"`
 	LibreOfficeAvailable    bool     `json:"libreOfficeAvailable"`
+	PdfRendererAvailable    bool     `json:"pdfRendererAvailable"`
 	HashWorkerCount         int      `json:"hashWorkerCount"`
 	HashBatchSize           int      `json:"hashBatchSize"`
 	HashPollInterval        string   `json:"hashPollInterval"`
@@ -258,6 +260,7 @@ type DataStats struct {
 	TotalVersionStorageBytes     int64                  `json:"totalVersionStorageBytes"`
 	TotalVersionStorageFormatted string                 `json:"totalVersionStorageFormatted"`
 	StorageLocations             []StorageLocationStats `json:"storageLocations"`
+	Quotas                       []StorageQuotaStatus   `json:"quotas"`
 	Growth                       GrowthStats            `json:"growth"`
 	Config                       ConfigSummary          `json:"config"`
 }
@@ -356,6 +359,10 @@ func (ctx *MahresourcesContext) getStorageLocationStats() ([]StorageLocationStat
 			location.UsageError = "storage is memory-backed"
 			continue
 		}
+		if storage.IsS3Location(location.Path) {
+			location.UsageError = "storage is an S3 bucket"
+			continue
+		}
 
 		total, free, used, usedPercent, usageErr := storageLocationDiskUsage(location.Path)
 		if usageErr != nil {
@@ -534,6 +541,12 @@ func (ctx *MahresourcesContext) GetDataStats() (*DataStats, error) {
 	}
 	stats.StorageLocations = storageLocations
 
+	quotas, err := ctx.ListStorageQuotas()
+	if err != nil {
+		return nil, err
+	}
+	stats.Quotas = quotas
+
 	altFSKeys := make([]string, 0, len(ctx.Config.AltFileSystems))
 	for k := range ctx.Config.AltFileSystems {
 		altFSKeys = append(altFSKeys, k)
@@ -553,6 +566,7 @@ func (ctx *MahresourcesContext) GetDataStats() (*DataStats, error) {
 		HasReadOnlyDB:           ctx.Config.DbReadOnlyDsn != "",
 		FfmpegAvailable:         ctx.Config.FfmpegPath != "",
 		LibreOfficeAvailable:    ctx.Config.LibreOfficePath != "",
+		PdfRendererAvailable:    ctx.findPdfRendererPath() != "",
 		HashWorkerCount:         ctx.Config.HashWorkerCount,
 		HashBatchSize:           ctx.Config.HashBatchSize,
 		HashPollInterval:        ctx.Config.HashPollInterval.String(),
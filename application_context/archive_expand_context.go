@@ -0,0 +1,565 @@
+package application_context
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"mahresources/download_queue"
+	"mahresources/models"
+	"mahresources/models/query_models"
+	"mahresources/models/types"
+)
+
+// Archive expansion.
+//
+// An upload marked for expansion is not stored as a resource. The archive is
+// staged under _expand/ on the main filesystem and a background job unpacks
+// it into a new group, owned by the group the upload names: each directory in
+// the archive becomes a subgroup of the group for the directory it is in, and
+// each file a resource owned by the group for its directory, with its path in
+// the archive as OriginalLocation.
+//
+// Every entry is read once before anything is created, so an archive over the
+// limits, or holding a path that would climb out of it, creates nothing.
+
+var (
+	// ErrNotAnArchive is an upload marked for expansion that is not a zip,
+	// tar or gzipped tar.
+	ErrNotAnArchive             = errors.New("not a zip or tar archive")
+	ErrArchiveExpansionNotFound = errors.New("archive expansion not found")
+	// ErrArchiveRefused is wrapped by the error of an archive over the limits
+	// or holding an unsafe path.
+	ErrArchiveRefused = errors.New("archive refused")
+)
+
+// DefaultArchiveExpandMaxEntries and DefaultArchiveExpandMaxSize are the
+// limits used when the config leaves them unset.
+const (
+	DefaultArchiveExpandMaxEntries       = 10000
+	DefaultArchiveExpandMaxSize    int64 = 10 << 30
+)
+
+// archiveExpandRoot holds the staged archives on the main filesystem, one per
+// expansion, named for its id.
+const archiveExpandRoot = "_expand"
+
+// archiveExpandIssueLimit caps the entries an expansion's report lists; the
+// expansion counts all of them.
+const archiveExpandIssueLimit = 100
+
+// archiveExpandSaveEvery is how many files are stored between saves of the
+// expansion's counts.
+const archiveExpandSaveEvery = 50
+
+func archiveExpansionPath(id uint) string {
+	return path.Join(archiveExpandRoot, fmt.Sprintf("%d", id))
+}
+
+type archiveFormat int
+
+const (
+	archiveZip archiveFormat = iota + 1
+	archiveTar
+	archiveTarGz
+)
+
+// ArchiveExpansionReport is stored in ArchiveExpansion.Report.
+type ArchiveExpansionReport struct {
+	Issues []ArchiveExpansionIssue `json:"issues"`
+}
+
+// ArchiveExpansionIssue is an entry that was skipped or could not be stored.
+type ArchiveExpansionIssue struct {
+	Path    string `json:"path"`
+	Skipped bool   `json:"skipped"`
+	// ResourceID is the resource that already holds a skipped file.
+	ResourceID uint   `json:"resourceId,omitempty"`
+	Reason     string `json:"reason"`
+}
+
+// ArchiveExpandMaxEntries is how many entries an expanded archive may hold.
+func (ctx *MahresourcesContext) ArchiveExpandMaxEntries() int {
+	if ctx.Config == nil || ctx.Config.ArchiveExpandMaxEntries <= 0 {
+		return DefaultArchiveExpandMaxEntries
+	}
+	return ctx.Config.ArchiveExpandMaxEntries
+}
+
+// ArchiveExpandMaxSize is how many bytes the files of an expanded archive may
+// hold between them.
+func (ctx *MahresourcesContext) ArchiveExpandMaxSize() int64 {
+	if ctx.Config == nil || ctx.Config.ArchiveExpandMaxSize <= 0 {
+		return DefaultArchiveExpandMaxSize
+	}
+	return ctx.Config.ArchiveExpandMaxSize
+}
+
+// StartArchiveExpansion stages the archive read from file and submits a job
+// that unpacks it into a new group. creator is what the upload was sent with:
+// its Name, falling back to the archive's name, and Description go to the new
+// group, which is created under OwnerId; its tags, groups, category and meta
+// go to every resource.
+func (ctx *MahresourcesContext) StartArchiveExpansion(file io.Reader, fileName string, creator *query_models.ResourceCreator) (*models.ArchiveExpansion, error) {
+	if creator == nil {
+		creator = &query_models.ResourceCreator{}
+	}
+	if creator.OwnerId != 0 {
+		var count int64
+		if err := ctx.db.Model(&models.Group{}).Where("id = ?", creator.OwnerId).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return nil, fmt.Errorf("owner group %d not found", creator.OwnerId)
+		}
+	} else if ctx.isScopedPrincipal() {
+		return nil, errors.New("a group-limited account must expand an archive into a group it can see")
+	}
+
+	if err := ctx.fs.MkdirAll(archiveExpandRoot, 0755); err != nil {
+		return nil, err
+	}
+	stagingPath := path.Join(archiveExpandRoot, fmt.Sprintf("staging-%d", time.Now().UnixNano()))
+	staged, err := ctx.fs.Create(stagingPath)
+	if err != nil {
+		return nil, err
+	}
+	_, copyErr := io.Copy(staged, file)
+	if closeErr := staged.Close(); copyErr == nil {
+		copyErr = closeErr
+	}
+	if copyErr != nil {
+		_ = ctx.fs.Remove(stagingPath)
+		return nil, copyErr
+	}
+	if _, err := ctx.detectArchiveFormat(stagingPath); err != nil {
+		_ = ctx.fs.Remove(stagingPath)
+		return nil, err
+	}
+
+	expansion := models.ArchiveExpansion{
+		StartedAt:     time.Now(),
+		OwnerUserID:   ctx.actingUserIDPtr(),
+		FileName:      fileName,
+		ParentGroupID: uintPtrOrNil(creator.OwnerId),
+	}
+	if err := ctx.db.Create(&expansion).Error; err != nil {
+		_ = ctx.fs.Remove(stagingPath)
+		return nil, err
+	}
+	// The archive is at its final path before the job is submitted, which may
+	// start it at once.
+	if err := ctx.fs.Rename(stagingPath, archiveExpansionPath(expansion.ID)); err != nil {
+		_ = ctx.fs.Remove(stagingPath)
+		ctx.db.Delete(&expansion)
+		return nil, err
+	}
+
+	// The job outlives the request, so it must not be cancelled with it.
+	jobCtx := *ctx
+	jobCtx.currentRequest = nil
+	resourceCreator := *creator
+	// URL is unused for generic jobs; it carries the archive's name for the
+	// jobs panel.
+	job, err := ctx.downloadManager.SubmitJobWithOptions(download_queue.JobOptions{
+		Source:       download_queue.JobSourceArchiveExpand,
+		InitialPhase: "queued",
+		URL:          fileName,
+		OwnerUserID:  expansion.OwnerUserID,
+	}, func(c context.Context, _ *download_queue.DownloadJob, p download_queue.ProgressSink) error {
+		return jobCtx.runArchiveExpansion(c, expansion.ID, resourceCreator, p)
+	})
+	if err != nil {
+		_ = ctx.fs.Remove(archiveExpansionPath(expansion.ID))
+		ctx.db.Delete(&expansion)
+		return nil, err
+	}
+	ctx.db.Model(&expansion).Update("job_id", job.ID)
+	expansion.JobID = job.ID
+	return &expansion, nil
+}
+
+// GetArchiveExpansion returns an expansion. ownerUserID/ownerRestricted are
+// the caller's visibility, as for the download history.
+func (ctx *MahresourcesContext) GetArchiveExpansion(id uint, ownerUserID *uint, ownerRestricted bool) (*models.ArchiveExpansion, error) {
+	var expansion models.ArchiveExpansion
+	q := ctx.db.Where("id = ?", id)
+	if ownerRestricted {
+		q = q.Where("owner_user_id = ?", ownerUserID)
+	}
+	if err := q.First(&expansion).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrArchiveExpansionNotFound
+		}
+		return nil, err
+	}
+	return &expansion, nil
+}
+
+func (ctx *MahresourcesContext) runArchiveExpansion(c context.Context, expansionID uint, creator query_models.ResourceCreator, p download_queue.ProgressSink) error {
+	var expansion models.ArchiveExpansion
+	if err := ctx.db.First(&expansion, expansionID).Error; err != nil {
+		return err
+	}
+	// The staged archive goes however the expansion ends: a failed one is
+	// uploaded again rather than retried, since what it already created would
+	// be created twice.
+	archivePath := archiveExpansionPath(expansion.ID)
+	defer func() { _ = ctx.fs.Remove(archivePath) }()
+
+	report := &ArchiveExpansionReport{Issues: []ArchiveExpansionIssue{}}
+	err := ctx.expandArchive(c, &expansion, archivePath, creator, report, p)
+
+	now := time.Now()
+	expansion.FinishedAt = &now
+	if err != nil {
+		expansion.Error = err.Error()
+	}
+	encoded, encodeErr := json.Marshal(report)
+	if encodeErr != nil {
+		return encodeErr
+	}
+	expansion.Report = types.JSON(encoded)
+	if saveErr := ctx.saveArchiveExpansion(&expansion); saveErr != nil && err == nil {
+		err = saveErr
+	}
+	if err != nil {
+		return err
+	}
+
+	ctx.Logger().Info(models.LogActionSystem, "archive_expansion", &expansion.ID, expansion.FileName, "Archive expanded", map[string]interface{}{
+		"group":   *expansion.GroupID,
+		"created": expansion.Created,
+		"skipped": expansion.Skipped,
+		"failed":  expansion.Failed,
+	})
+	p.SetPhase("completed")
+	return nil
+}
+
+// saveArchiveExpansion writes what a running expansion changes; the job id is
+// left alone, since the job can start before it is recorded.
+func (ctx *MahresourcesContext) saveArchiveExpansion(expansion *models.ArchiveExpansion) error {
+	return ctx.db.Model(expansion).
+		Select("finished_at", "group_id", "entries", "bytes", "created", "skipped", "failed", "error", "report").
+		Updates(expansion).Error
+}
+
+func (ctx *MahresourcesContext) expandArchive(c context.Context, expansion *models.ArchiveExpansion, archivePath string, creator query_models.ResourceCreator, report *ArchiveExpansionReport, p download_queue.ProgressSink) error {
+	format, err := ctx.detectArchiveFormat(archivePath)
+	if err != nil {
+		return err
+	}
+
+	p.SetPhase("checking")
+	if err := ctx.checkArchive(archivePath, format, expansion); err != nil {
+		return err
+	}
+	if err := ctx.saveArchiveExpansion(expansion); err != nil {
+		return err
+	}
+
+	p.SetPhase("expanding")
+	name := strings.TrimSpace(creator.Name)
+	if name == "" {
+		name = archiveBaseName(expansion.FileName)
+	}
+	root, err := ctx.CreateGroup(&query_models.GroupCreator{
+		Name:        name,
+		Description: creator.Description,
+		OwnerId:     creator.OwnerId,
+	})
+	if err != nil {
+		return err
+	}
+	expansion.GroupID = &root.ID
+
+	// groups maps each directory in the archive to its group; "." is the
+	// archive's root.
+	groups := map[string]uint{".": root.ID}
+	var groupFor func(dir string) (uint, error)
+	groupFor = func(dir string) (uint, error) {
+		if id, ok := groups[dir]; ok {
+			return id, nil
+		}
+		parent, err := groupFor(path.Dir(dir))
+		if err != nil {
+			return 0, err
+		}
+		group, err := ctx.CreateGroup(&query_models.GroupCreator{Name: path.Base(dir), OwnerId: parent})
+		if err != nil {
+			return 0, fmt.Errorf("creating the group for %s: %w", dir, err)
+		}
+		groups[dir] = group.ID
+		return group.ID, nil
+	}
+
+	addIssue := func(issue ArchiveExpansionIssue) {
+		if issue.Skipped {
+			expansion.Skipped++
+		} else {
+			expansion.Failed++
+		}
+		if len(report.Issues) < archiveExpandIssueLimit {
+			report.Issues = append(report.Issues, issue)
+		}
+	}
+
+	var files, done int64
+	return ctx.walkArchive(archivePath, format, func(entry archiveEntry) error {
+		if err := c.Err(); err != nil {
+			return err
+		}
+		if entry.path == "." {
+			return nil
+		}
+		if entry.mode.IsDir() {
+			if _, err := groupFor(entry.path); err != nil {
+				addIssue(ArchiveExpansionIssue{Path: entry.name, Reason: err.Error()})
+			}
+			return nil
+		}
+		if !entry.mode.IsRegular() {
+			addIssue(ArchiveExpansionIssue{Path: entry.name, Skipped: true, Reason: "not a regular file"})
+			return nil
+		}
+
+		files++
+		defer func() {
+			done += entry.size
+			p.UpdateProgress(done, expansion.Bytes)
+			p.SetPhaseProgress(files, expansion.Entries)
+			if files%archiveExpandSaveEvery == 0 {
+				_ = ctx.saveArchiveExpansion(expansion)
+			}
+		}()
+
+		owner, err := groupFor(path.Dir(entry.path))
+		if err != nil {
+			addIssue(ArchiveExpansionIssue{Path: entry.name, Reason: err.Error()})
+			return nil
+		}
+		content, err := entry.open()
+		if err != nil {
+			addIssue(ArchiveExpansionIssue{Path: entry.name, Reason: err.Error()})
+			return nil
+		}
+		defer content.Close()
+
+		base := path.Base(entry.path)
+		resourceCreator := creator
+		resourceCreator.Name = ""
+		resourceCreator.Description = ""
+		resourceCreator.OwnerId = owner
+		resourceCreator.OriginalName = base
+		resourceCreator.OriginalLocation = entry.path
+		_, err = ctx.AddResource(content, base, &resourceCreator)
+		var exists *ResourceExistsError
+		var exceeded *QuotaExceededError
+		switch {
+		case err == nil:
+			expansion.Created++
+		case errors.As(err, &exists):
+			addIssue(ArchiveExpansionIssue{Path: entry.name, Skipped: true, ResourceID: exists.ResourceID, Reason: err.Error()})
+		case errors.As(err, &exceeded):
+			// No later file would fit either.
+			return err
+		default:
+			addIssue(ArchiveExpansionIssue{Path: entry.name, Reason: err.Error()})
+		}
+		return nil
+	})
+}
+
+// checkArchive reads every entry of the archive, refusing it when it holds
+// more entries or bytes than the limits allow or a path that would climb out
+// of it, and counts its files into expansion.
+func (ctx *MahresourcesContext) checkArchive(archivePath string, format archiveFormat, expansion *models.ArchiveExpansion) error {
+	maxEntries, maxSize := ctx.ArchiveExpandMaxEntries(), ctx.ArchiveExpandMaxSize()
+	entries := 0
+	expansion.Entries, expansion.Bytes = 0, 0
+	return ctx.walkArchive(archivePath, format, func(entry archiveEntry) error {
+		entries++
+		if entries > maxEntries {
+			return fmt.Errorf("%w: it holds more than %d entries", ErrArchiveRefused, maxEntries)
+		}
+		if !entry.mode.IsRegular() {
+			return nil
+		}
+		expansion.Entries++
+		expansion.Bytes += entry.size
+		if expansion.Bytes > maxSize {
+			return fmt.Errorf("%w: its files hold more than %d bytes", ErrArchiveRefused, maxSize)
+		}
+		return nil
+	})
+}
+
+// archiveEntry is one entry of an archive. open reads a regular file's
+// content; for a tar, only until the walk moves past the entry.
+type archiveEntry struct {
+	// name is the entry's name as written in the archive, path the cleaned
+	// relative path it is stored under.
+	name string
+	path string
+	mode fs.FileMode
+	size int64
+	open func() (io.ReadCloser, error)
+}
+
+// walkArchive calls fn for each entry of the archive in order, stopping at the
+// first error, or at an entry whose path is not safe to unpack.
+func (ctx *MahresourcesContext) walkArchive(archivePath string, format archiveFormat, fn func(archiveEntry) error) error {
+	f, err := ctx.fs.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	visit := func(entry archiveEntry) error {
+		p, err := archiveEntryPath(entry.name)
+		if err != nil {
+			return err
+		}
+		entry.path = p
+		return fn(entry)
+	}
+
+	if format == archiveZip {
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		zr, err := zip.NewReader(f, info.Size())
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrNotAnArchive, err)
+		}
+		for _, zf := range zr.File {
+			if err := visit(archiveEntry{
+				name: zf.Name,
+				mode: zf.Mode(),
+				size: int64(zf.UncompressedSize64),
+				open: zf.Open,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var r io.Reader = f
+	if format == archiveTarGz {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		if err := visit(archiveEntry{
+			name: header.Name,
+			mode: header.FileInfo().Mode(),
+			size: header.Size,
+			open: func() (io.ReadCloser, error) { return io.NopCloser(tr), nil },
+		}); err != nil {
+			return err
+		}
+	}
+}
+
+// archiveEntryPath cleans an entry's name into a relative, slash-separated
+// path, "." for the archive's root. A name that is absolute or climbs out of
+// the archive is refused.
+func archiveEntryPath(name string) (string, error) {
+	p := strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(p, "/") || (len(p) >= 2 && p[1] == ':') {
+		return "", fmt.Errorf("%w: %q is an absolute path", ErrArchiveRefused, name)
+	}
+	for _, part := range strings.Split(p, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("%w: %q climbs out of the archive", ErrArchiveRefused, name)
+		}
+	}
+	return path.Clean(p), nil
+}
+
+// detectArchiveFormat tells a zip, tar or gzipped tar apart by its first
+// bytes, as archive.NewReader tells gzip from tar.
+func (ctx *MahresourcesContext) detectArchiveFormat(archivePath string) (archiveFormat, error) {
+	f, err := ctx.fs.Open(archivePath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	head = head[:n]
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return archiveZip, nil
+	case isTarHeader(head):
+		return archiveTar, nil
+	case len(head) >= 2 && head[0] == 0x1f && head[1] == 0x8b:
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return 0, err
+		}
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return 0, ErrNotAnArchive
+		}
+		defer gz.Close()
+		inner := make([]byte, 512)
+		n, _ := io.ReadFull(gz, inner)
+		if isTarHeader(inner[:n]) {
+			return archiveTarGz, nil
+		}
+	}
+	return 0, ErrNotAnArchive
+}
+
+// isTarHeader reports whether block starts with a ustar, pax or GNU tar
+// header.
+func isTarHeader(block []byte) bool {
+	return len(block) >= 262 && bytes.Equal(block[257:262], []byte("ustar"))
+}
+
+// archiveBaseName is the archive's file name without its directory or its
+// archive extension.
+func archiveBaseName(fileName string) string {
+	name := path.Base(strings.ReplaceAll(fileName, "\\", "/"))
+	lower := strings.ToLower(name)
+	for _, ext := range []string{".tar.gz", ".tgz", ".tar", ".zip"} {
+		if strings.HasSuffix(lower, ext) && len(name) > len(ext) {
+			return name[:len(name)-len(ext)]
+		}
+	}
+	if name == "." || name == "/" {
+		return "archive"
+	}
+	return name
+}
@@ -0,0 +1,241 @@
+package application_context
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/spf13/afero"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"mahresources/constants"
+	"mahresources/models"
+	"mahresources/models/query_models"
+)
+
+func createExpandTestContext(t *testing.T, cacheName string) *MahresourcesContext {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+cacheName+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(
+		&models.Resource{},
+		&models.Note{},
+		&models.Tag{},
+		&models.Group{},
+		&models.Category{},
+		&models.NoteType{},
+		&models.Preview{},
+		&models.ImageHash{},
+		&models.LogEntry{},
+		&models.ResourceCategory{},
+		&models.Series{},
+		&models.ArchiveExpansion{},
+	); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	ctx := NewMahresourcesContext(afero.NewMemMapFs(), db, sqlx.NewDb(sqlDB, "sqlite3"), &MahresourcesConfig{DbType: constants.DbTypeSqlite})
+	defaultRC := &models.ResourceCategory{Name: "Default"}
+	defaultRC.ID = 1
+	db.FirstOrCreate(defaultRC, 1)
+	return ctx
+}
+
+type tarEntry struct {
+	name     string
+	typeflag byte
+	body     string
+}
+
+func buildTar(t *testing.T, entries []tarEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		header := &tar.Header{Name: e.name, Typeflag: e.typeflag, Mode: 0644, Size: int64(len(e.body))}
+		if e.typeflag == tar.TypeDir {
+			header.Mode = 0755
+		}
+		if e.typeflag == tar.TypeSymlink {
+			header.Linkname = e.body
+			header.Size = 0
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatalf("tar header %s: %v", e.name, err)
+		}
+		if e.typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte(e.body)); err != nil {
+				t.Fatalf("tar body %s: %v", e.name, err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("close tar: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// waitForArchiveExpansion polls until the expansion's job has finished.
+func waitForArchiveExpansion(t *testing.T, ctx *MahresourcesContext, id uint) *models.ArchiveExpansion {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		expansion, err := ctx.GetArchiveExpansion(id, nil, false)
+		if err != nil {
+			t.Fatalf("GetArchiveExpansion: %v", err)
+		}
+		if expansion.FinishedAt != nil {
+			return expansion
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expansion %d did not finish", id)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestArchiveExpansion_UnpacksATarIntoAGroupTree(t *testing.T) {
+	ctx := createExpandTestContext(t, "archive_expand_tree_test")
+	parent := models.Group{Name: "Inbox"}
+	if err := ctx.db.Create(&parent).Error; err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+
+	archive := buildTar(t, []tarEntry{
+		{name: "photos/", typeflag: tar.TypeDir},
+		{name: "photos/2024/a.txt", typeflag: tar.TypeReg, body: "first"},
+		{name: "photos/b.txt", typeflag: tar.TypeReg, body: "second"},
+		{name: "readme.txt", typeflag: tar.TypeReg, body: "third"},
+		{name: "empty/", typeflag: tar.TypeDir},
+		{name: "latest", typeflag: tar.TypeSymlink, body: "readme.txt"},
+	})
+	started, err := ctx.StartArchiveExpansion(bytes.NewReader(archive), "bundle.tar", &query_models.ResourceCreator{
+		ResourceQueryBase: query_models.ResourceQueryBase{OwnerId: parent.ID},
+	})
+	if err != nil {
+		t.Fatalf("StartArchiveExpansion: %v", err)
+	}
+	expansion := waitForArchiveExpansion(t, ctx, started.ID)
+	if expansion.Error != "" {
+		t.Fatalf("expansion failed: %s", expansion.Error)
+	}
+	if expansion.Entries != 3 || expansion.Created != 3 || expansion.Skipped != 1 || expansion.Failed != 0 {
+		t.Errorf("%d files, %d created, %d skipped, %d failed; want 3, 3, 1 (the symlink), 0", expansion.Entries, expansion.Created, expansion.Skipped, expansion.Failed)
+	}
+
+	var root models.Group
+	if expansion.GroupID == nil || ctx.db.First(&root, *expansion.GroupID).Error != nil {
+		t.Fatalf("the expansion records no group")
+	}
+	if root.Name != "bundle" || root.OwnerId == nil || *root.OwnerId != parent.ID {
+		t.Errorf("root group is %q under %v, want \"bundle\" under %d", root.Name, root.OwnerId, parent.ID)
+	}
+	groupUnder := func(ownerID uint, name string) models.Group {
+		t.Helper()
+		var group models.Group
+		if err := ctx.db.Where("owner_id = ? AND name = ?", ownerID, name).First(&group).Error; err != nil {
+			t.Fatalf("no group %q under %d: %v", name, ownerID, err)
+		}
+		return group
+	}
+	photos := groupUnder(root.ID, "photos")
+	year := groupUnder(photos.ID, "2024")
+	groupUnder(root.ID, "empty")
+
+	for location, owner := range map[string]uint{"photos/2024/a.txt": year.ID, "photos/b.txt": photos.ID, "readme.txt": root.ID} {
+		var resource models.Resource
+		if err := ctx.db.Where("original_location = ?", location).First(&resource).Error; err != nil {
+			t.Errorf("no resource for %s: %v", location, err)
+			continue
+		}
+		if resource.OwnerId == nil || *resource.OwnerId != owner {
+			t.Errorf("%s is owned by %v, want %d", location, resource.OwnerId, owner)
+		}
+		if want := location[strings.LastIndex(location, "/")+1:]; resource.Name != want {
+			t.Errorf("%s is named %q, want %q", location, resource.Name, want)
+		}
+	}
+	if exists, _ := afero.Exists(ctx.fs, archiveExpansionPath(expansion.ID)); exists {
+		t.Error("the staged archive was left behind")
+	}
+}
+
+func TestArchiveExpansion_RefusesAnUnsafeArchiveBeforeCreatingAnything(t *testing.T) {
+	ctx := createExpandTestContext(t, "archive_expand_refused_test")
+
+	var climbing bytes.Buffer
+	zw := zip.NewWriter(&climbing)
+	for _, name := range []string{"fine.txt", "../escaped.txt"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("zip entry %s: %v", name, err)
+		}
+		_, _ = w.Write([]byte(name))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("close zip: %v", err)
+	}
+
+	ctx.Config.ArchiveExpandMaxEntries = 2
+	tooMany := buildTar(t, []tarEntry{
+		{name: "a.txt", typeflag: tar.TypeReg, body: "a"},
+		{name: "b.txt", typeflag: tar.TypeReg, body: "b"},
+		{name: "c.txt", typeflag: tar.TypeReg, body: "c"},
+	})
+
+	for _, tc := range []struct {
+		name    string
+		archive []byte
+		want    string
+	}{
+		{"climbing.zip", climbing.Bytes(), "climbs out of the archive"},
+		{"many.tar", tooMany, "more than 2 entries"},
+	} {
+		started, err := ctx.StartArchiveExpansion(bytes.NewReader(tc.archive), tc.name, nil)
+		if err != nil {
+			t.Fatalf("%s: StartArchiveExpansion: %v", tc.name, err)
+		}
+		expansion := waitForArchiveExpansion(t, ctx, started.ID)
+		if !strings.Contains(expansion.Error, tc.want) {
+			t.Errorf("%s finished with %q, want an error saying %q", tc.name, expansion.Error, tc.want)
+		}
+	}
+
+	var groups, resources int64
+	ctx.db.Model(&models.Group{}).Count(&groups)
+	ctx.db.Model(&models.Resource{}).Count(&resources)
+	if groups != 0 || resources != 0 {
+		t.Errorf("refused archives created %d groups and %d resources", groups, resources)
+	}
+
+	if _, err := ctx.StartArchiveExpansion(strings.NewReader("just some text"), "notes.txt", nil); !errors.Is(err, ErrNotAnArchive) {
+		t.Errorf("a text file: got %v, want ErrNotAnArchive", err)
+	}
+}
+
+func TestArchiveEntryPath(t *testing.T) {
+	for name, want := range map[string]string{
+		"a/b.txt":       "a/b.txt",
+		"./a//b.txt":    "a/b.txt",
+		"dir\\file.txt": "dir/file.txt",
+		"a/":            "a",
+		"./":            ".",
+	} {
+		if got, err := archiveEntryPath(name); err != nil || got != want {
+			t.Errorf("archiveEntryPath(%q) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+	for _, name := range []string{"/etc/passwd", "C:\\Windows\\x", "a/../../b", "..\\b"} {
+		if _, err := archiveEntryPath(name); !errors.Is(err, ErrArchiveRefused) {
+			t.Errorf("archiveEntryPath(%q): got %v, want ErrArchiveRefused", name, err)
+		}
+	}
+}
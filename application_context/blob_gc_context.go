@@ -0,0 +1,424 @@
+package application_context
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+	"gorm.io/gorm"
+
+	"mahresources/download_queue"
+	"mahresources/models"
+	"mahresources/models/types"
+)
+
+// ErrBlobGCInProgress is returned when a blob garbage collection is already running.
+var ErrBlobGCInProgress = errors.New("blob garbage collection already in progress")
+
+// DefaultBlobGCGracePeriod is long enough that no upload is still between
+// writing its file and committing its row.
+const DefaultBlobGCGracePeriod = 24 * time.Hour
+
+// blobGCRoot is the content-addressed tree the sweep walks; files elsewhere
+// (backups under /deleted/, imports by path) are never collected.
+const blobGCRoot = "/resources"
+
+// blobGCListLimit caps the orphan and dangling entries a report lists; the
+// counts and byte totals always cover everything.
+const blobGCListLimit = 1000
+
+// BlobGCOptions configures StartBlobGC.
+type BlobGCOptions struct {
+	// DryRun lists what would be deleted without deleting it.
+	DryRun bool
+	// GracePeriod skips files modified more recently than this.
+	GracePeriod time.Duration
+}
+
+// BlobGCStart describes a submitted garbage collection.
+type BlobGCStart struct {
+	JobID string `json:"jobId"`
+	RunID uint   `json:"runId"`
+}
+
+// BlobGCReport is stored in BlobGCRun.Report.
+type BlobGCReport struct {
+	Filesystems []BlobGCFilesystemReport `json:"filesystems"`
+	// Dangling lists rows whose file is gone. They are reported, not deleted:
+	// the blob scrub quarantines them and an operator decides what to restore.
+	Dangling      []BlobGCDanglingRow `json:"dangling"`
+	DanglingCount int64               `json:"danglingCount"`
+	// OrphanPreviews are preview rows whose resource no longer exists.
+	OrphanPreviews      int64 `json:"orphanPreviews"`
+	OrphanPreviewBytes  int64 `json:"orphanPreviewBytes"`
+	DeletedPreviewCount int64 `json:"deletedPreviewCount"`
+}
+
+// BlobGCFilesystemReport is the sweep of one filesystem. Key is the alt
+// filesystem key, empty for the main one.
+type BlobGCFilesystemReport struct {
+	Key          string `json:"key"`
+	ScannedFiles int64  `json:"scannedFiles"`
+	ScannedBytes int64  `json:"scannedBytes"`
+	OrphanFiles  int64  `json:"orphanFiles"`
+	OrphanBytes  int64  `json:"orphanBytes"`
+	// InGraceFiles are unreferenced files skipped for being too recent.
+	InGraceFiles   int64 `json:"inGraceFiles"`
+	DeletedFiles   int64 `json:"deletedFiles"`
+	ReclaimedBytes int64 `json:"reclaimedBytes"`
+	// Orphans lists the orphaned files, up to blobGCListLimit.
+	Orphans []string `json:"orphans"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+// BlobGCDanglingRow is a resource or version whose file does not exist.
+type BlobGCDanglingRow struct {
+	EntityType      string `json:"entityType"`
+	EntityID        uint   `json:"entityId"`
+	ResourceID      uint   `json:"resourceId"`
+	StorageLocation string `json:"storageLocation"`
+	Location        string `json:"location"`
+}
+
+// BlobGCStatus is a garbage collection run, whose Report is a BlobGCReport.
+type BlobGCStatus struct {
+	Running bool              `json:"running"`
+	Run     *models.BlobGCRun `json:"run"`
+}
+
+// StartBlobGC submits a background mark-and-sweep of the content-addressed
+// storage. Deletes, merges and version cleanup remove a file only when
+// CountHashReferences finds no other row using it, but a failure between the
+// row and the file, or an import abandoned halfway, leaves files nothing
+// references. The job marks every file a resource or version references,
+// walks /resources/ on the main and every alt filesystem, and deletes the
+// rest once they are older than the grace period. It also removes preview
+// rows whose resource is gone, and reports rows whose file is missing.
+func (ctx *MahresourcesContext) StartBlobGC(opts BlobGCOptions) (*BlobGCStart, error) {
+	if opts.GracePeriod < 0 {
+		return nil, errors.New("grace period must not be negative")
+	}
+	if ctx.blobGC.Load() {
+		return nil, ErrBlobGCInProgress
+	}
+
+	run := models.BlobGCRun{StartedAt: time.Now(), DryRun: opts.DryRun, GracePeriodSeconds: int64(opts.GracePeriod / time.Second)}
+	if err := ctx.db.Create(&run).Error; err != nil {
+		return nil, err
+	}
+
+	job, err := ctx.downloadManager.SubmitJob("blob-gc", "queued", func(c context.Context, _ *download_queue.DownloadJob, p download_queue.ProgressSink) error {
+		return ctx.runBlobGC(c, run.ID, opts, p)
+	})
+	if err != nil {
+		return nil, err
+	}
+	ctx.db.Model(&run).Update("job_id", job.ID)
+	return &BlobGCStart{JobID: job.ID, RunID: run.ID}, nil
+}
+
+// GetBlobGCStatus returns the run with the given ID, or the newest when id is 0.
+func (ctx *MahresourcesContext) GetBlobGCStatus(id uint) (*BlobGCStatus, error) {
+	var run models.BlobGCRun
+	q := ctx.db.Order("id DESC")
+	if id != 0 {
+		q = q.Where("id = ?", id)
+	}
+	if err := q.Limit(1).Find(&run).Error; err != nil {
+		return nil, err
+	}
+	status := &BlobGCStatus{Running: ctx.blobGC.Load()}
+	if run.ID != 0 {
+		status.Run = &run
+	} else if id != 0 {
+		return nil, fmt.Errorf("blob gc run %d not found", id)
+	}
+	return status, nil
+}
+
+// blobGCKey is a marked file: the storage key and its normalized location.
+type blobGCKey struct {
+	storage  string
+	location string
+}
+
+// blobGCRef is a row referencing a file, kept to report it as dangling.
+type blobGCRef struct {
+	entityType string
+	entityID   uint
+	resourceID uint
+}
+
+func (ctx *MahresourcesContext) runBlobGC(c context.Context, runID uint, opts BlobGCOptions, p download_queue.ProgressSink) error {
+	if !ctx.blobGC.CompareAndSwap(false, true) {
+		return ErrBlobGCInProgress
+	}
+	defer ctx.blobGC.Store(false)
+
+	report, err := ctx.collectBlobGarbage(c, opts, p)
+	update := map[string]any{"finished_at": time.Now()}
+	if err != nil {
+		update["error"] = err.Error()
+	}
+	if report != nil {
+		var reclaimed int64
+		for _, fs := range report.Filesystems {
+			reclaimed += fs.ReclaimedBytes
+		}
+		reclaimed += report.OrphanPreviewBytes
+		encoded, encodeErr := json.Marshal(report)
+		if encodeErr != nil {
+			return encodeErr
+		}
+		update["reclaimed_bytes"] = reclaimed
+		update["report"] = types.JSON(encoded)
+	}
+	if saveErr := ctx.db.Model(&models.BlobGCRun{}).Where("id = ?", runID).Updates(update).Error; saveErr != nil && err == nil {
+		err = saveErr
+	}
+	if err != nil {
+		return err
+	}
+
+	message := "Blob garbage collection finished"
+	if opts.DryRun {
+		message = "Blob garbage collection dry run finished"
+	}
+	ctx.Logger().Info(models.LogActionSystem, "blob_gc", &runID, "", message, map[string]interface{}{"reclaimedBytes": update["reclaimed_bytes"]})
+	p.SetPhase("completed")
+	return nil
+}
+
+func (ctx *MahresourcesContext) collectBlobGarbage(c context.Context, opts BlobGCOptions, p download_queue.ProgressSink) (*BlobGCReport, error) {
+	p.SetPhase("marking referenced files")
+	marked, err := ctx.markBlobReferences()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(ctx.altFileSystems)+1)
+	keys = append(keys, "")
+	for key := range ctx.altFileSystems {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys[1:])
+
+	report := &BlobGCReport{Filesystems: []BlobGCFilesystemReport{}, Dangling: []BlobGCDanglingRow{}}
+	cutoff := time.Now().Add(-opts.GracePeriod)
+	total := int64(len(keys) + 1)
+	for i, key := range keys {
+		if err := c.Err(); err != nil {
+			return report, err
+		}
+		name := key
+		if name == "" {
+			name = "main"
+		}
+		p.SetPhase("sweeping " + name)
+		p.UpdateProgress(int64(i), total)
+		fsReport, present := ctx.sweepBlobFilesystem(c, key, marked, cutoff, opts.DryRun)
+		report.Filesystems = append(report.Filesystems, fsReport)
+		ctx.reportDanglingBlobs(report, key, marked, present)
+	}
+	if err := c.Err(); err != nil {
+		return report, err
+	}
+
+	p.SetPhase("collecting previews")
+	p.UpdateProgress(total-1, total)
+	if err := ctx.collectOrphanPreviews(report, opts.DryRun); err != nil {
+		return report, err
+	}
+	p.UpdateProgress(total, total)
+	return report, nil
+}
+
+// markBlobReferences returns every file a resource or version references,
+// with the rows referencing it.
+func (ctx *MahresourcesContext) markBlobReferences() (map[blobGCKey][]blobGCRef, error) {
+	marked := map[blobGCKey][]blobGCRef{}
+
+	var resources []models.Resource
+	err := ctx.db.Select("id", "storage_location", "location").FindInBatches(&resources, blobScrubBatchSize, func(_ *gorm.DB, _ int) error {
+		for _, r := range resources {
+			key := blobGCKey{storageKey(r.StorageLocation), normalizeBlobLocation(r.Location)}
+			marked[key] = append(marked[key], blobGCRef{models.BlobEntityResource, r.ID, r.ID})
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []models.ResourceVersion
+	err = ctx.db.Select("id", "resource_id", "storage_location", "location").FindInBatches(&versions, blobScrubBatchSize, func(_ *gorm.DB, _ int) error {
+		for _, v := range versions {
+			key := blobGCKey{storageKey(v.StorageLocation), normalizeBlobLocation(v.Location)}
+			marked[key] = append(marked[key], blobGCRef{models.BlobEntityVersion, v.ID, v.ResourceID})
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	return marked, nil
+}
+
+// sweepBlobFilesystem walks /resources/ on one filesystem, deleting (or, in
+// a dry run, listing) unreferenced files older than cutoff. It returns the
+// report and the set of files it saw, for the dangling check.
+func (ctx *MahresourcesContext) sweepBlobFilesystem(c context.Context, key string, marked map[blobGCKey][]blobGCRef, cutoff time.Time, dryRun bool) (BlobGCFilesystemReport, map[string]bool) {
+	report := BlobGCFilesystemReport{Key: key, Orphans: []string{}}
+	present := map[string]bool{}
+
+	fs, err := ctx.GetFsForStorageLocation(storagePointer(key))
+	if err != nil {
+		report.Errors = append(report.Errors, err.Error())
+		return report, nil
+	}
+
+	walkErr := afero.Walk(fs, blobGCRoot, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && name == blobGCRoot {
+				return filepath.SkipDir
+			}
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", name, err))
+			return nil
+		}
+		if cErr := c.Err(); cErr != nil {
+			return cErr
+		}
+		if info.IsDir() {
+			return nil
+		}
+		location := normalizeBlobLocation(name)
+		present[location] = true
+		report.ScannedFiles++
+		report.ScannedBytes += info.Size()
+		if _, ok := marked[blobGCKey{key, location}]; ok {
+			return nil
+		}
+		if info.ModTime().After(cutoff) {
+			report.InGraceFiles++
+			return nil
+		}
+
+		report.OrphanFiles++
+		report.OrphanBytes += info.Size()
+		if len(report.Orphans) < blobGCListLimit {
+			report.Orphans = append(report.Orphans, location)
+		}
+		if dryRun {
+			report.ReclaimedBytes += info.Size()
+			return nil
+		}
+		// The mark is a snapshot: an upload deduplicated against this file
+		// since then references it now.
+		if ctx.blobReferencedNow(key, location) {
+			report.OrphanFiles--
+			report.OrphanBytes -= info.Size()
+			return nil
+		}
+		if err := fs.Remove(name); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", location, err))
+			return nil
+		}
+		report.DeletedFiles++
+		report.ReclaimedBytes += info.Size()
+		return nil
+	})
+	if walkErr != nil && !errors.Is(walkErr, filepath.SkipDir) {
+		report.Errors = append(report.Errors, walkErr.Error())
+	}
+	return report, present
+}
+
+// blobReferencedNow reports whether a row references the file, re-read from
+// the database at the moment of deletion.
+func (ctx *MahresourcesContext) blobReferencedNow(key, location string) bool {
+	variants := []string{location, strings.TrimPrefix(location, "/")}
+	for _, model := range []any{&models.Resource{}, &models.ResourceVersion{}} {
+		var n int64
+		err := ctx.db.Model(model).
+			Where("location IN ? AND COALESCE(storage_location, '') = ?", variants, key).
+			Count(&n).Error
+		if err != nil || n > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// reportDanglingBlobs adds the rows on filesystem key whose file is missing.
+// Files under /resources/ were seen by the sweep; others are looked up.
+func (ctx *MahresourcesContext) reportDanglingBlobs(report *BlobGCReport, key string, marked map[blobGCKey][]blobGCRef, present map[string]bool) {
+	if present == nil {
+		return // the filesystem is not attached; its sweep reported that
+	}
+	fs, err := ctx.GetFsForStorageLocation(storagePointer(key))
+	if err != nil {
+		return
+	}
+
+	var missing []blobGCKey
+	for file := range marked {
+		if file.storage != key || present[file.location] {
+			continue
+		}
+		if !strings.HasPrefix(file.location, blobGCRoot+"/") {
+			if _, err := fs.Stat(file.location); err == nil || !os.IsNotExist(err) {
+				continue
+			}
+		}
+		missing = append(missing, file)
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i].location < missing[j].location })
+
+	for _, file := range missing {
+		for _, ref := range marked[file] {
+			report.DanglingCount++
+			if len(report.Dangling) < blobGCListLimit {
+				report.Dangling = append(report.Dangling, BlobGCDanglingRow{
+					EntityType:      ref.entityType,
+					EntityID:        ref.entityID,
+					ResourceID:      ref.resourceID,
+					StorageLocation: file.storage,
+					Location:        file.location,
+				})
+			}
+		}
+	}
+}
+
+// collectOrphanPreviews removes preview rows whose resource is gone. The
+// foreign key cascades on deletes made with it enforced, but SQLite databases
+// that ran without foreign keys kept their previews.
+func (ctx *MahresourcesContext) collectOrphanPreviews(report *BlobGCReport, dryRun bool) error {
+	orphans := ctx.db.Model(&models.Preview{}).
+		Where("resource_id IS NULL OR NOT EXISTS (SELECT 1 FROM resources WHERE resources.id = previews.resource_id)")
+
+	var stats struct {
+		Count int64
+		Bytes int64
+	}
+	if err := orphans.Session(&gorm.Session{}).Select("COUNT(*) AS count, COALESCE(SUM(LENGTH(data)), 0) AS bytes").Scan(&stats).Error; err != nil {
+		return err
+	}
+	report.OrphanPreviews, report.OrphanPreviewBytes = stats.Count, stats.Bytes
+	if dryRun || stats.Count == 0 {
+		return nil
+	}
+	result := orphans.Session(&gorm.Session{}).Delete(&models.Preview{})
+	if result.Error != nil {
+		return result.Error
+	}
+	report.DeletedPreviewCount = result.RowsAffected
+	return nil
+}
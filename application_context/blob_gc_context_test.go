@@ -0,0 +1,169 @@
+package application_context
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"mahresources/models"
+)
+
+// runGC runs a garbage collection to completion and returns its report.
+func runGC(t *testing.T, ctx *MahresourcesContext, opts BlobGCOptions) (models.BlobGCRun, BlobGCReport) {
+	t.Helper()
+	run := models.BlobGCRun{StartedAt: time.Now(), DryRun: opts.DryRun}
+	if err := ctx.db.Create(&run).Error; err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	if err := ctx.runBlobGC(context.Background(), run.ID, opts, scrubSink{}); err != nil {
+		t.Fatalf("runBlobGC: %v", err)
+	}
+	ctx.db.First(&run, run.ID)
+	var report BlobGCReport
+	if err := json.Unmarshal(run.Report, &report); err != nil {
+		t.Fatalf("decode report: %v", err)
+	}
+	return run, report
+}
+
+// writeAged writes a file last modified age ago.
+func writeAged(t *testing.T, fs afero.Fs, name string, content string, age time.Duration) {
+	t.Helper()
+	if err := afero.WriteFile(fs, name, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-age)
+	if err := fs.Chtimes(name, old, old); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func gcFilesystem(t *testing.T, report BlobGCReport, key string) BlobGCFilesystemReport {
+	t.Helper()
+	for _, fs := range report.Filesystems {
+		if fs.Key == key {
+			return fs
+		}
+	}
+	t.Fatalf("no report for filesystem %q", key)
+	return BlobGCFilesystemReport{}
+}
+
+func TestBlobGC_DeletesOnlyUnreferencedFilesPastTheGracePeriod(t *testing.T) {
+	ctx, fs := createScrubTestContext(t, "blob_gc_sweep_test")
+	cold := afero.NewMemMapFs()
+	ctx.RegisterAltFs("cold", cold)
+
+	kept := storeScrubResource(t, ctx, fs, "/resources/aa/bb/cc/kept.png", []byte("kept"))
+	writeAged(t, fs, kept.Location, "kept", 48*time.Hour)
+	writeAged(t, fs, "/resources/dd/ee/ff/orphan.png", "orphan!", 48*time.Hour)
+	writeAged(t, fs, "/resources/11/22/33/uploading.png", "fresh", time.Minute)
+	writeAged(t, fs, "/deleted/backup.png", "backup", 48*time.Hour)
+	writeAged(t, cold, "/resources/44/55/66/cold-orphan.png", "cold orphan", 48*time.Hour)
+
+	version := models.ResourceVersion{ResourceID: kept.ID, VersionNumber: 1, Hash: "v", HashType: "SHA1", Location: "/resources/77/88/99/version.png"}
+	ctx.db.Create(&version)
+	writeAged(t, fs, version.Location, "version", 48*time.Hour)
+
+	run, report := runGC(t, ctx, BlobGCOptions{GracePeriod: time.Hour})
+
+	for name, want := range map[string]bool{
+		kept.Location:                       true,
+		version.Location:                    true,
+		"/resources/dd/ee/ff/orphan.png":    false,
+		"/resources/11/22/33/uploading.png": true,
+		"/deleted/backup.png":               true,
+	} {
+		if exists, _ := afero.Exists(fs, name); exists != want {
+			t.Errorf("%s exists = %v, want %v", name, exists, want)
+		}
+	}
+	if exists, _ := afero.Exists(cold, "/resources/44/55/66/cold-orphan.png"); exists {
+		t.Error("the orphan on the alt filesystem was not collected")
+	}
+
+	main := gcFilesystem(t, report, "")
+	if main.ScannedFiles != 4 || main.OrphanFiles != 1 || main.InGraceFiles != 1 || main.DeletedFiles != 1 || main.ReclaimedBytes != int64(len("orphan!")) {
+		t.Errorf("main report = %+v", main)
+	}
+	coldReport := gcFilesystem(t, report, "cold")
+	if coldReport.ReclaimedBytes != int64(len("cold orphan")) {
+		t.Errorf("cold reclaimed = %d, want %d", coldReport.ReclaimedBytes, len("cold orphan"))
+	}
+	if run.ReclaimedBytes != main.ReclaimedBytes+coldReport.ReclaimedBytes {
+		t.Errorf("run reclaimed = %d, want the filesystems' sum", run.ReclaimedBytes)
+	}
+	if run.FinishedAt == nil || run.Error != "" {
+		t.Errorf("run did not finish cleanly: %+v", run)
+	}
+}
+
+func TestBlobGC_DryRunListsWithoutDeleting(t *testing.T) {
+	ctx, fs := createScrubTestContext(t, "blob_gc_dry_run_test")
+	writeAged(t, fs, "/resources/dd/ee/ff/orphan.png", "orphan", 48*time.Hour)
+
+	_, report := runGC(t, ctx, BlobGCOptions{DryRun: true, GracePeriod: time.Hour})
+
+	if exists, _ := afero.Exists(fs, "/resources/dd/ee/ff/orphan.png"); !exists {
+		t.Fatal("a dry run deleted a file")
+	}
+	main := gcFilesystem(t, report, "")
+	if len(main.Orphans) != 1 || main.Orphans[0] != "/resources/dd/ee/ff/orphan.png" {
+		t.Errorf("orphans = %q", main.Orphans)
+	}
+	if main.DeletedFiles != 0 || main.ReclaimedBytes != int64(len("orphan")) {
+		t.Errorf("dry run report = %+v, want nothing deleted and the bytes it would reclaim", main)
+	}
+}
+
+func TestBlobGC_ReportsRowsWhoseFileIsGone(t *testing.T) {
+	ctx, fs := createScrubTestContext(t, "blob_gc_dangling_test")
+	gone := storeScrubResource(t, ctx, fs, "/resources/aa/bb/cc/gone.png", []byte("gone"))
+	outside := storeScrubResource(t, ctx, fs, "/imported/outside.png", []byte("outside"))
+	_ = fs.Remove(gone.Location)
+
+	_, report := runGC(t, ctx, BlobGCOptions{GracePeriod: time.Hour})
+
+	if report.DanglingCount != 1 || len(report.Dangling) != 1 {
+		t.Fatalf("dangling = %+v", report.Dangling)
+	}
+	if d := report.Dangling[0]; d.EntityType != models.BlobEntityResource || d.EntityID != gone.ID {
+		t.Errorf("dangling row = %+v, want resource %d", d, gone.ID)
+	}
+	var count int64
+	ctx.db.Model(&models.Resource{}).Where("id IN ?", []uint{gone.ID, outside.ID}).Count(&count)
+	if count != 2 {
+		t.Error("the collection deleted a row")
+	}
+}
+
+func TestBlobGC_RemovesPreviewsOfDeletedResources(t *testing.T) {
+	ctx, fs := createScrubTestContext(t, "blob_gc_preview_test")
+	resource := storeScrubResource(t, ctx, fs, "/resources/aa/bb/cc/r.png", []byte("r"))
+	deletedID := resource.ID + 100
+
+	kept := models.Preview{Data: []byte("kept"), ResourceId: &resource.ID}
+	orphan := models.Preview{Data: []byte("orphaned"), ResourceId: &deletedID}
+	ctx.db.Create(&kept)
+	ctx.db.Create(&orphan)
+
+	_, report := runGC(t, ctx, BlobGCOptions{})
+
+	if report.OrphanPreviews != 1 || report.DeletedPreviewCount != 1 || report.OrphanPreviewBytes != int64(len("orphaned")) {
+		t.Errorf("preview report = %+v", report)
+	}
+	var left []models.Preview
+	ctx.db.Find(&left)
+	if len(left) != 1 || left[0].ID != kept.ID {
+		t.Errorf("previews left = %d, want only the one whose resource exists", len(left))
+	}
+}
+
+func TestBlobGC_RefusesANegativeGracePeriod(t *testing.T) {
+	ctx, _ := createScrubTestContext(t, "blob_gc_negative_test")
+	if _, err := ctx.StartBlobGC(BlobGCOptions{GracePeriod: -time.Hour}); err == nil {
+		t.Error("a negative grace period was accepted")
+	}
+}
@@ -0,0 +1,733 @@
+package application_context
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"image"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"mahresources/download_queue"
+	"mahresources/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrBlobScrubInProgress is returned when a blob scrub is already running.
+var ErrBlobScrubInProgress = errors.New("blob scrub already in progress")
+
+// blobScrubBatchSize bounds the rows loaded per page and the work lost to a
+// crash: the checkpoint is saved after every batch. Previews carry their image
+// data, so they are paged smaller.
+const (
+	blobScrubBatchSize        = 200
+	blobScrubPreviewBatchSize = 50
+)
+
+// blobScrubPhases is the walk order; a run's Phase is one of them, then done.
+var blobScrubPhases = []string{models.BlobEntityResource, models.BlobEntityVersion, models.BlobEntityPreview}
+
+const blobScrubPhaseDone = "done"
+
+// blobScrubState is shared by every shallow copy of the context.
+type blobScrubState struct {
+	running atomic.Bool
+	// quarantined caches the number of quarantined issues, -1 when unknown,
+	// so serving a file costs no query while nothing is quarantined.
+	quarantined atomic.Int64
+}
+
+func newBlobScrubState() *blobScrubState {
+	s := &blobScrubState{}
+	s.quarantined.Store(-1)
+	return s
+}
+
+// BlobScrubOptions configures StartBlobScrub.
+type BlobScrubOptions struct {
+	// Repair restores damaged files from intact copies with the same hash.
+	Repair bool
+	// Restart abandons an unfinished run instead of resuming it.
+	Restart bool
+}
+
+// BlobScrubStart describes a submitted scrub.
+type BlobScrubStart struct {
+	JobID   string `json:"jobId"`
+	RunID   uint   `json:"runId"`
+	Resumed bool   `json:"resumed"`
+	Phase   string `json:"phase"`
+	LastID  uint   `json:"lastId"`
+}
+
+// BlobScrubStatus is the newest run and the issue counts by status.
+type BlobScrubStatus struct {
+	Running bool                 `json:"running"`
+	Run     *models.BlobScrubRun `json:"run"`
+	Issues  map[string]int64     `json:"issues"`
+}
+
+// StartBlobScrub submits a background job that re-reads every resource file,
+// version file and preview, re-hashes the files, and records what is missing,
+// truncated or corrupted in BlobIntegrityIssue rows. Damaged files are
+// quarantined; with Repair they are first restored from an intact copy with
+// the same hash when one exists. Damaged previews are deleted, since the next
+// request regenerates them.
+//
+// The newest unfinished run is resumed from its checkpoint unless Restart is
+// set. Like the similarity recompute, the check here only answers a request
+// made while a scrub runs with a 409; the guard itself is taken by the job.
+func (ctx *MahresourcesContext) StartBlobScrub(opts BlobScrubOptions) (*BlobScrubStart, error) {
+	if ctx.blobScrub.running.Load() {
+		return nil, ErrBlobScrubInProgress
+	}
+
+	var run models.BlobScrubRun
+	err := ctx.db.Where("finished_at IS NULL").Order("id DESC").Limit(1).Find(&run).Error
+	if err != nil {
+		return nil, err
+	}
+	resumed := run.ID != 0 && !opts.Restart
+	if run.ID != 0 && opts.Restart {
+		if err := ctx.db.Model(&models.BlobScrubRun{}).Where("finished_at IS NULL").Update("finished_at", time.Now()).Error; err != nil {
+			return nil, err
+		}
+	}
+	if !resumed {
+		run = models.BlobScrubRun{StartedAt: time.Now(), Phase: blobScrubPhases[0]}
+		if err := ctx.clearDeletedBlobIssues(); err != nil {
+			return nil, err
+		}
+	}
+	run.Repair = opts.Repair
+	if err := ctx.db.Save(&run).Error; err != nil {
+		return nil, err
+	}
+
+	job, err := ctx.downloadManager.SubmitJob("blob-scrub", "queued", func(c context.Context, j *download_queue.DownloadJob, p download_queue.ProgressSink) error {
+		return ctx.runBlobScrub(c, run.ID, p)
+	})
+	if err != nil {
+		return nil, err
+	}
+	ctx.db.Model(&run).Update("job_id", job.ID)
+
+	return &BlobScrubStart{JobID: job.ID, RunID: run.ID, Resumed: resumed, Phase: run.Phase, LastID: run.LastID}, nil
+}
+
+// GetBlobScrubStatus returns the newest scrub run and the issue counts.
+func (ctx *MahresourcesContext) GetBlobScrubStatus() (*BlobScrubStatus, error) {
+	status := &BlobScrubStatus{Running: ctx.blobScrub.running.Load(), Issues: map[string]int64{}}
+
+	var run models.BlobScrubRun
+	if err := ctx.db.Order("id DESC").Limit(1).Find(&run).Error; err != nil {
+		return nil, err
+	}
+	if run.ID != 0 {
+		status.Run = &run
+	}
+
+	var counts []struct {
+		Status string
+		Count  int64
+	}
+	if err := ctx.db.Model(&models.BlobIntegrityIssue{}).Select("status, COUNT(*) AS count").Group("status").Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	for _, c := range counts {
+		status.Issues[c.Status] = c.Count
+	}
+	return status, nil
+}
+
+// ListBlobIntegrityIssues returns the scrub report, newest check first,
+// optionally filtered by status and problem.
+func (ctx *MahresourcesContext) ListBlobIntegrityIssues(status, problem string, offset, limit int) ([]models.BlobIntegrityIssue, error) {
+	q := ctx.db.Model(&models.BlobIntegrityIssue{})
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	if problem != "" {
+		q = q.Where("problem = ?", problem)
+	}
+	var issues []models.BlobIntegrityIssue
+	err := q.Order("checked_at DESC, id DESC").Offset(offset).Limit(limit).Find(&issues).Error
+	return issues, err
+}
+
+// RecheckBlobIntegrityIssue checks an issue's file again, for instance after
+// an operator restored it by hand. An intact file clears the issue and lifts
+// its quarantine; a damaged one is repaired when repair is set and a copy
+// exists.
+func (ctx *MahresourcesContext) RecheckBlobIntegrityIssue(id uint, repair bool) (*models.BlobIntegrityIssue, error) {
+	var issue models.BlobIntegrityIssue
+	if err := ctx.db.First(&issue, id).Error; err != nil {
+		return nil, err
+	}
+
+	switch issue.EntityType {
+	case models.BlobEntityPreview:
+		// A damaged preview was deleted when it was found; nothing is left to check.
+		return &issue, nil
+	case models.BlobEntityResource:
+		var resource models.Resource
+		if err := ctx.db.Limit(1).Find(&resource, issue.EntityID).Error; err != nil {
+			return nil, err
+		}
+		if resource.ID == 0 {
+			return ctx.clearBlobIssue(&issue, "the resource was deleted")
+		}
+		ctx.scrubBlob(resourceBlobTarget(resource), repair)
+	case models.BlobEntityVersion:
+		var version models.ResourceVersion
+		if err := ctx.db.Limit(1).Find(&version, issue.EntityID).Error; err != nil {
+			return nil, err
+		}
+		if version.ID == 0 {
+			return ctx.clearBlobIssue(&issue, "the version was deleted")
+		}
+		ctx.scrubBlob(versionBlobTarget(version), repair)
+	}
+
+	if err := ctx.db.First(&issue, id).Error; err != nil {
+		return nil, err
+	}
+	return &issue, nil
+}
+
+func (ctx *MahresourcesContext) clearBlobIssue(issue *models.BlobIntegrityIssue, detail string) (*models.BlobIntegrityIssue, error) {
+	issue.Status, issue.Detail, issue.CheckedAt = models.BlobStatusCleared, detail, time.Now()
+	if err := ctx.db.Save(issue).Error; err != nil {
+		return nil, err
+	}
+	ctx.blobScrub.quarantined.Store(-1)
+	return issue, nil
+}
+
+// clearDeletedBlobIssues lifts the quarantine of issues whose entity is gone,
+// so a new file later written to the same location is served.
+func (ctx *MahresourcesContext) clearDeletedBlobIssues() error {
+	err := ctx.db.Model(&models.BlobIntegrityIssue{}).
+		Where("status = ?", models.BlobStatusQuarantined).
+		Where("(entity_type = ? AND NOT EXISTS (SELECT 1 FROM resources WHERE resources.id = blob_integrity_issues.entity_id)) OR "+
+			"(entity_type = ? AND NOT EXISTS (SELECT 1 FROM resource_versions WHERE resource_versions.id = blob_integrity_issues.entity_id))",
+			models.BlobEntityResource, models.BlobEntityVersion).
+		Updates(map[string]any{"status": models.BlobStatusCleared, "detail": "the entity was deleted", "checked_at": time.Now()}).Error
+	ctx.blobScrub.quarantined.Store(-1)
+	return err
+}
+
+// QuarantinedBlob returns the quarantine holding the file at location on the
+// given storage, or nil when it may be served. Issues of deleted entities do
+// not count, so a file re-uploaded to the same content-addressed location is
+// served again.
+func (ctx *MahresourcesContext) QuarantinedBlob(storageLocation *string, location string) *models.BlobIntegrityIssue {
+	n := ctx.blobScrub.quarantined.Load()
+	if n < 0 {
+		if err := ctx.db.Model(&models.BlobIntegrityIssue{}).Where("status = ?", models.BlobStatusQuarantined).Count(&n).Error; err != nil {
+			n = 1 // look the file up rather than risk serving a damaged one
+		} else {
+			ctx.blobScrub.quarantined.Store(n)
+		}
+	}
+	if n == 0 {
+		return nil
+	}
+
+	var issues []models.BlobIntegrityIssue
+	ctx.db.
+		Where("status = ? AND storage_location = ? AND location = ?", models.BlobStatusQuarantined, storageKey(storageLocation), normalizeBlobLocation(location)).
+		Where("(entity_type = ? AND EXISTS (SELECT 1 FROM resources WHERE resources.id = blob_integrity_issues.entity_id)) OR "+
+			"(entity_type = ? AND EXISTS (SELECT 1 FROM resource_versions WHERE resource_versions.id = blob_integrity_issues.entity_id))",
+			models.BlobEntityResource, models.BlobEntityVersion).
+		Limit(1).Find(&issues)
+	if len(issues) == 0 {
+		return nil
+	}
+	return &issues[0]
+}
+
+// QuarantineMessage is the error a route refusing a quarantined file returns.
+func QuarantineMessage(issue *models.BlobIntegrityIssue) string {
+	return fmt.Sprintf("file is quarantined: %s (blob integrity issue %d; see mr admin scrub report)", issue.Problem, issue.ID)
+}
+
+func storageKey(storageLocation *string) string {
+	if storageLocation == nil {
+		return ""
+	}
+	return *storageLocation
+}
+
+func storagePointer(key string) *string {
+	if key == "" {
+		return nil
+	}
+	return &key
+}
+
+func normalizeBlobLocation(location string) string {
+	return path.Clean("/" + strings.ReplaceAll(location, "\\", "/"))
+}
+
+// runBlobScrub walks a run from its checkpoint to the end.
+func (ctx *MahresourcesContext) runBlobScrub(c context.Context, runID uint, p download_queue.ProgressSink) error {
+	if !ctx.blobScrub.running.CompareAndSwap(false, true) {
+		return ErrBlobScrubInProgress
+	}
+	defer ctx.blobScrub.running.Store(false)
+
+	var run models.BlobScrubRun
+	if err := ctx.db.First(&run, runID).Error; err != nil {
+		return err
+	}
+
+	total, done := ctx.blobScrubProgress(&run)
+	p.UpdateProgress(done, total)
+
+	for phaseIndex, phase := range blobScrubPhases {
+		if run.Phase != phase {
+			continue
+		}
+		p.SetPhase("checking " + phase + "s")
+		for {
+			if err := c.Err(); err != nil {
+				return err
+			}
+			n, err := ctx.scrubBlobBatch(&run)
+			if err != nil {
+				return err
+			}
+			if err := ctx.db.Save(&run).Error; err != nil {
+				return err
+			}
+			if n == 0 {
+				break
+			}
+			done += int64(n)
+			p.UpdateProgress(done, total)
+		}
+		run.Phase, run.LastID = blobScrubPhaseDone, 0
+		if phaseIndex+1 < len(blobScrubPhases) {
+			run.Phase = blobScrubPhases[phaseIndex+1]
+		}
+		if err := ctx.db.Save(&run).Error; err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	run.FinishedAt = &now
+	if err := ctx.db.Save(&run).Error; err != nil {
+		return err
+	}
+	ctx.Logger().Info(models.LogActionSystem, "blob_scrub", &run.ID, "", "Blob scrub finished", map[string]interface{}{
+		"checked":     run.Checked,
+		"quarantined": run.Quarantined,
+		"repaired":    run.Repaired,
+	})
+	p.SetPhase("completed")
+	return nil
+}
+
+// blobScrubProgress counts everything a run walks and what its checkpoint
+// already covers.
+func (ctx *MahresourcesContext) blobScrubProgress(run *models.BlobScrubRun) (total, done int64) {
+	reached := false
+	for _, phase := range blobScrubPhases {
+		var all, checked int64
+		ctx.blobScrubQuery(phase).Count(&all)
+		switch {
+		case phase == run.Phase:
+			ctx.blobScrubQuery(phase).Where(blobScrubTable(phase)+".id <= ?", run.LastID).Count(&checked)
+			reached = true
+		case !reached:
+			checked = all
+		}
+		total += all
+		done += checked
+	}
+	if run.Phase == blobScrubPhaseDone {
+		done = total
+	}
+	return total, done
+}
+
+func blobScrubTable(phase string) string {
+	switch phase {
+	case models.BlobEntityVersion:
+		return "resource_versions"
+	case models.BlobEntityPreview:
+		return "previews"
+	}
+	return "resources"
+}
+
+// blobScrubQuery selects what a phase walks. A version stored in the same
+// file as its resource's current content is skipped: the resource phase
+// checks that file.
+func (ctx *MahresourcesContext) blobScrubQuery(phase string) *gorm.DB {
+	switch phase {
+	case models.BlobEntityVersion:
+		return ctx.db.Model(&models.ResourceVersion{}).
+			Joins("LEFT JOIN resources r ON r.id = resource_versions.resource_id").
+			Where("r.id IS NULL OR resource_versions.location <> r.location OR " +
+				"COALESCE(resource_versions.storage_location, '') <> COALESCE(r.storage_location, '')")
+	case models.BlobEntityPreview:
+		return ctx.db.Model(&models.Preview{})
+	}
+	return ctx.db.Model(&models.Resource{})
+}
+
+// scrubBlobBatch checks the next batch after the run's checkpoint and
+// advances it, returning how many entities were checked.
+func (ctx *MahresourcesContext) scrubBlobBatch(run *models.BlobScrubRun) (int, error) {
+	table := blobScrubTable(run.Phase)
+	q := ctx.blobScrubQuery(run.Phase).Where(table+".id > ?", run.LastID).Order(table + ".id")
+
+	var targets []blobTarget
+	switch run.Phase {
+	case models.BlobEntityResource:
+		var resources []models.Resource
+		if err := q.Limit(blobScrubBatchSize).Find(&resources).Error; err != nil {
+			return 0, err
+		}
+		for _, r := range resources {
+			targets = append(targets, resourceBlobTarget(r))
+		}
+	case models.BlobEntityVersion:
+		var versions []models.ResourceVersion
+		if err := q.Select("resource_versions.*").Limit(blobScrubBatchSize).Find(&versions).Error; err != nil {
+			return 0, err
+		}
+		for _, v := range versions {
+			targets = append(targets, versionBlobTarget(v))
+		}
+	case models.BlobEntityPreview:
+		var previews []models.Preview
+		if err := q.Limit(blobScrubPreviewBatchSize).Find(&previews).Error; err != nil {
+			return 0, err
+		}
+		for _, preview := range previews {
+			if ctx.scrubPreview(preview) {
+				run.Repaired++
+			}
+			run.Checked++
+			run.CheckedBytes += int64(len(preview.Data))
+			run.LastID = preview.ID
+		}
+		return len(previews), nil
+	}
+
+	for _, t := range targets {
+		result := ctx.scrubBlob(t, run.Repair)
+		run.Checked++
+		run.CheckedBytes += result.actualSize
+		switch result.status {
+		case models.BlobStatusQuarantined:
+			run.Quarantined++
+		case models.BlobStatusRepaired:
+			run.Repaired++
+		}
+		run.LastID = t.entityID
+	}
+	return len(targets), nil
+}
+
+// blobTarget is a stored file and what it should contain.
+type blobTarget struct {
+	entityType string
+	entityID   uint
+	resourceID uint
+	storage    string
+	location   string
+	hash       string
+	hashType   string
+	legacyHash string
+	size       int64
+}
+
+func resourceBlobTarget(r models.Resource) blobTarget {
+	return blobTarget{
+		entityType: models.BlobEntityResource, entityID: r.ID, resourceID: r.ID,
+		storage: storageKey(r.StorageLocation), location: r.Location,
+		hash: r.Hash, hashType: r.HashType, legacyHash: r.LegacyHash, size: r.FileSize,
+	}
+}
+
+func versionBlobTarget(v models.ResourceVersion) blobTarget {
+	return blobTarget{
+		entityType: models.BlobEntityVersion, entityID: v.ID, resourceID: v.ResourceID,
+		storage: storageKey(v.StorageLocation), location: v.Location,
+		hash: v.Hash, hashType: v.HashType, legacyHash: v.LegacyHash, size: v.FileSize,
+	}
+}
+
+func (t blobTarget) describe() string {
+	storage := t.storage
+	if storage == "" {
+		storage = "files"
+	}
+	return fmt.Sprintf("%s %d at %s:%s", t.entityType, t.entityID, storage, normalizeBlobLocation(t.location))
+}
+
+// blobCheck is the outcome of reading a file; problem is empty when intact.
+type blobCheck struct {
+	problem    string
+	detail     string
+	actualHash string
+	actualSize int64
+	status     string
+}
+
+// newBlobHash returns the hash a HashType names, or nil for one the scrubber
+// cannot compute, whose files are then only checked for size.
+func newBlobHash(hashType string) hash.Hash {
+	switch strings.ToUpper(hashType) {
+	case "", "SHA1":
+		return sha1.New()
+	case "SHA256":
+		return sha256.New()
+	case "MD5":
+		return md5.New()
+	}
+	return nil
+}
+
+func (ctx *MahresourcesContext) checkBlob(t blobTarget) blobCheck {
+	fs, err := ctx.GetFsForStorageLocation(storagePointer(t.storage))
+	if err != nil {
+		return blobCheck{problem: models.BlobProblemUnreadable, detail: err.Error()}
+	}
+	f, err := fs.Open(t.location)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return blobCheck{problem: models.BlobProblemMissing, detail: "the file does not exist"}
+		}
+		return blobCheck{problem: models.BlobProblemUnreadable, detail: err.Error()}
+	}
+	defer f.Close()
+
+	h := newBlobHash(t.hashType)
+	var sink io.Writer = io.Discard
+	if h != nil {
+		sink = h
+	}
+	n, err := io.Copy(sink, f)
+	check := blobCheck{actualSize: n}
+	if h != nil {
+		check.actualHash = hex.EncodeToString(h.Sum(nil))
+	}
+	switch {
+	case err != nil:
+		check.problem, check.detail = models.BlobProblemUnreadable, fmt.Sprintf("reading failed after %d bytes: %v", n, err)
+	case t.size > 0 && n < t.size:
+		check.problem, check.detail = models.BlobProblemTruncated, fmt.Sprintf("%d of %d bytes", n, t.size)
+	case h != nil && !strings.EqualFold(check.actualHash, t.hash):
+		check.problem, check.detail = models.BlobProblemCorrupted, "the content does not match its hash"
+	case t.size > 0 && n != t.size:
+		check.problem, check.detail = models.BlobProblemCorrupted, fmt.Sprintf("%d bytes where %d were recorded", n, t.size)
+	}
+	return check
+}
+
+// scrubBlob checks one file and records the outcome: a damaged file is
+// repaired when repair is set and an intact copy exists, and quarantined
+// otherwise; an intact one clears an earlier issue.
+func (ctx *MahresourcesContext) scrubBlob(t blobTarget, repair bool) blobCheck {
+	check := ctx.checkBlob(t)
+
+	var existing models.BlobIntegrityIssue
+	ctx.db.Where("entity_type = ? AND entity_id = ?", t.entityType, t.entityID).Limit(1).Find(&existing)
+
+	if check.problem == "" {
+		if existing.ID != 0 && existing.Status == models.BlobStatusQuarantined {
+			existing.Status, existing.Detail, existing.CheckedAt = models.BlobStatusCleared, "intact when checked again", time.Now()
+			ctx.db.Save(&existing)
+			ctx.blobScrub.quarantined.Store(-1)
+		}
+		return check
+	}
+
+	issue := existing
+	issue.EntityType, issue.EntityID, issue.ResourceID = t.entityType, t.entityID, t.resourceID
+	issue.StorageLocation, issue.Location = t.storage, normalizeBlobLocation(t.location)
+	issue.Problem, issue.Detail = check.problem, check.detail
+	issue.ExpectedHash, issue.ActualHash = t.hash, check.actualHash
+	issue.ExpectedSize, issue.ActualSize = t.size, check.actualSize
+	issue.Status, issue.RepairedFrom = models.BlobStatusQuarantined, ""
+	issue.CheckedAt = time.Now()
+
+	if repair {
+		from, err := ctx.repairBlob(t)
+		switch {
+		case err != nil:
+			issue.Detail += "; repair failed: " + err.Error()
+		case from == "":
+			issue.Detail += "; no intact copy to repair from"
+		default:
+			issue.Status, issue.RepairedFrom = models.BlobStatusRepaired, from
+		}
+	}
+	check.status = issue.Status
+
+	if err := ctx.db.Save(&issue).Error; err != nil {
+		ctx.Logger().Warning(models.LogActionSystem, "blob_scrub", &t.entityID, t.describe(), "Failed to record blob integrity issue", map[string]interface{}{"error": err.Error()})
+	}
+	ctx.blobScrub.quarantined.Store(-1)
+
+	message := "Quarantined damaged file"
+	if issue.Status == models.BlobStatusRepaired {
+		message = "Repaired damaged file"
+	}
+	ctx.Logger().Warning(models.LogActionSystem, t.entityType, &t.entityID, t.describe(), message, map[string]interface{}{
+		"problem":      issue.Problem,
+		"detail":       issue.Detail,
+		"repairedFrom": issue.RepairedFrom,
+	})
+	return check
+}
+
+// repairBlob restores t's file from another resource or version with the
+// same hash stored elsewhere, returning which one, or "" when no intact copy
+// exists. The copy is verified before and after it is written.
+func (ctx *MahresourcesContext) repairBlob(t blobTarget) (string, error) {
+	if t.hash == "" || newBlobHash(t.hashType) == nil {
+		return "", nil
+	}
+
+	var candidates []blobTarget
+	var resources []models.Resource
+	if err := ctx.db.Scopes(contentHashMatch(t.hash, t.legacyHash)).Where("id <> ?", entityIDUnless(t, models.BlobEntityResource)).Find(&resources).Error; err != nil {
+		return "", err
+	}
+	for _, r := range resources {
+		candidates = append(candidates, resourceBlobTarget(r))
+	}
+	var versions []models.ResourceVersion
+	if err := ctx.db.Scopes(contentHashMatch(t.hash, t.legacyHash)).Where("id <> ?", entityIDUnless(t, models.BlobEntityVersion)).Find(&versions).Error; err != nil {
+		return "", err
+	}
+	for _, v := range versions {
+		candidates = append(candidates, versionBlobTarget(v))
+	}
+
+	tried := map[string]bool{t.storage + ":" + normalizeBlobLocation(t.location): true}
+	for _, c := range candidates {
+		file := c.storage + ":" + normalizeBlobLocation(c.location)
+		// A candidate is checked against its own hash, which may be the other
+		// algorithm mid-migration; the copy is then checked against t's.
+		if tried[file] || newBlobHash(c.hashType) == nil {
+			continue
+		}
+		tried[file] = true
+		c.size = t.size
+		if ctx.checkBlob(c).problem != "" {
+			continue
+		}
+		if err := ctx.copyBlob(c, t); err != nil {
+			return "", fmt.Errorf("copying from %s: %w", c.describe(), err)
+		}
+		if after := ctx.checkBlob(t); after.problem != "" {
+			return "", fmt.Errorf("the copy from %s is %s", c.describe(), after.problem)
+		}
+		return c.describe(), nil
+	}
+	return "", nil
+}
+
+// entityIDUnless is t's ID when it is of kind entityType, else 0, which no
+// row has.
+func entityIDUnless(t blobTarget, entityType string) uint {
+	if t.entityType == entityType {
+		return t.entityID
+	}
+	return 0
+}
+
+// copyBlob writes src's file over dst's through a temporary file, so a
+// failed copy leaves the damaged file rather than a partial one.
+func (ctx *MahresourcesContext) copyBlob(src, dst blobTarget) error {
+	srcFs, err := ctx.GetFsForStorageLocation(storagePointer(src.storage))
+	if err != nil {
+		return err
+	}
+	dstFs, err := ctx.GetFsForStorageLocation(storagePointer(dst.storage))
+	if err != nil {
+		return err
+	}
+	in, err := srcFs.Open(src.location)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := dstFs.MkdirAll(path.Dir(normalizeBlobLocation(dst.location)), 0755); err != nil {
+		return err
+	}
+	tmp := dst.location + ".scrub-repair"
+	out, err := dstFs.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = dstFs.Remove(tmp)
+		return err
+	}
+	if err := dstFs.Remove(dst.location); err != nil && !os.IsNotExist(err) {
+		_ = dstFs.Remove(tmp)
+		return err
+	}
+	if err := dstFs.Rename(tmp, dst.location); err != nil {
+		_ = dstFs.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// scrubPreview checks a stored preview and deletes it when it is empty or
+// does not decode; the next request for it renders a new one. Formats the
+// server cannot decode are left alone. It reports whether it deleted one.
+func (ctx *MahresourcesContext) scrubPreview(preview models.Preview) bool {
+	problem, detail := "", ""
+	if len(preview.Data) == 0 {
+		problem, detail = models.BlobProblemMissing, "the preview has no data"
+	} else if _, _, err := image.Decode(bytes.NewReader(preview.Data)); err != nil && !errors.Is(err, image.ErrFormat) {
+		problem, detail = models.BlobProblemCorrupted, "the preview does not decode: "+err.Error()
+	}
+	if problem == "" {
+		return false
+	}
+
+	if err := ctx.db.Delete(&models.Preview{}, preview.ID).Error; err != nil {
+		ctx.Logger().Warning(models.LogActionSystem, "preview", &preview.ID, "", "Failed to delete damaged preview", map[string]interface{}{"error": err.Error()})
+		return false
+	}
+	var resourceID uint
+	if preview.ResourceId != nil {
+		resourceID = *preview.ResourceId
+	}
+	issue := models.BlobIntegrityIssue{}
+	ctx.db.Where("entity_type = ? AND entity_id = ?", models.BlobEntityPreview, preview.ID).Limit(1).Find(&issue)
+	issue.EntityType, issue.EntityID, issue.ResourceID = models.BlobEntityPreview, preview.ID, resourceID
+	issue.Problem, issue.Detail = problem, detail+"; deleted, the next request renders a new preview"
+	issue.ActualSize = int64(len(preview.Data))
+	issue.Status, issue.CheckedAt = models.BlobStatusRepaired, time.Now()
+	ctx.db.Save(&issue)
+	return true
+}
@@ -0,0 +1,336 @@
+package application_context
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"image"
+	"image/png"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/spf13/afero"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"mahresources/constants"
+	"mahresources/models"
+)
+
+type scrubSink struct{}
+
+func (scrubSink) SetPhase(string)               {}
+func (scrubSink) SetPhaseProgress(int64, int64) {}
+func (scrubSink) UpdateProgress(int64, int64)   {}
+func (scrubSink) AppendWarning(string)          {}
+func (scrubSink) SetResultPath(string)          {}
+
+func createScrubTestContext(t *testing.T, cacheName string) (*MahresourcesContext, afero.Fs) {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open("file:"+cacheName+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(
+		&models.Resource{},
+		&models.ResourceVersion{},
+		&models.ResourceCategory{},
+		&models.Preview{},
+		&models.LogEntry{},
+		&models.BlobIntegrityIssue{},
+		&models.BlobScrubRun{},
+		&models.BlobGCRun{},
+		&models.ContentHashMigrationRun{},
+		&models.EncryptionRotationRun{},
+		&models.ResourceView{},
+		&models.StorageTierPin{},
+		&models.StorageTierRun{},
+		&models.ResumableUpload{},
+		&models.StorageQuota{},
+		&models.StorageUsage{},
+		&models.StorageUsageBlob{},
+		&models.StorageCharge{},
+		&models.ArchiveExpansion{},
+		&models.WatchFolder{},
+		&models.WatchedFile{},
+		&models.ResourceText{},
+	); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	fs := afero.NewMemMapFs()
+	sqlDB, _ := db.DB()
+	ctx := NewMahresourcesContext(fs, db, sqlx.NewDb(sqlDB, "sqlite3"), &MahresourcesConfig{DbType: constants.DbTypeSqlite})
+	return ctx, fs
+}
+
+// storeScrubResource writes content to location and records a resource for it.
+func storeScrubResource(t *testing.T, ctx *MahresourcesContext, fs afero.Fs, location string, content []byte) models.Resource {
+	t.Helper()
+	sum := sha1.Sum(content)
+	if err := afero.WriteFile(fs, location, content, 0644); err != nil {
+		t.Fatalf("write %s: %v", location, err)
+	}
+	resource := models.Resource{
+		Name:     location,
+		Location: location,
+		Hash:     hex.EncodeToString(sum[:]),
+		HashType: "SHA1",
+		FileSize: int64(len(content)),
+	}
+	if err := ctx.db.Create(&resource).Error; err != nil {
+		t.Fatalf("create resource: %v", err)
+	}
+	return resource
+}
+
+func runScrub(t *testing.T, ctx *MahresourcesContext, repair bool) models.BlobScrubRun {
+	t.Helper()
+	run := models.BlobScrubRun{Phase: models.BlobEntityResource, Repair: repair}
+	if err := ctx.db.Create(&run).Error; err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	if err := ctx.runBlobScrub(context.Background(), run.ID, scrubSink{}); err != nil {
+		t.Fatalf("runBlobScrub: %v", err)
+	}
+	ctx.db.First(&run, run.ID)
+	return run
+}
+
+func scrubIssue(t *testing.T, ctx *MahresourcesContext, entityType string, id uint) *models.BlobIntegrityIssue {
+	t.Helper()
+	var issues []models.BlobIntegrityIssue
+	ctx.db.Where("entity_type = ? AND entity_id = ?", entityType, id).Find(&issues)
+	if len(issues) == 0 {
+		return nil
+	}
+	return &issues[0]
+}
+
+func TestBlobScrub_QuarantinesDamagedFiles(t *testing.T) {
+	ctx, fs := createScrubTestContext(t, "blob_scrub_damage_test")
+	content := []byte("the quick brown fox jumps over the lazy dog")
+
+	intact := storeScrubResource(t, ctx, fs, "/resources/intact", content)
+	missing := storeScrubResource(t, ctx, fs, "/resources/missing", []byte("missing "+string(content)))
+	truncated := storeScrubResource(t, ctx, fs, "/resources/truncated", []byte("truncated "+string(content)))
+	corrupted := storeScrubResource(t, ctx, fs, "/resources/corrupted", []byte("corrupted "+string(content)))
+
+	_ = fs.Remove(missing.Location)
+	_ = afero.WriteFile(fs, truncated.Location, []byte("trunc"), 0644)
+	_ = afero.WriteFile(fs, corrupted.Location, []byte("CORRUPTED "+string(content)), 0644)
+
+	if ctx.QuarantinedBlob(nil, corrupted.Location) != nil {
+		t.Fatal("a file is quarantined before any scrub")
+	}
+
+	run := runScrub(t, ctx, false)
+	if run.FinishedAt == nil || run.Phase != blobScrubPhaseDone {
+		t.Fatalf("run did not finish: phase %q", run.Phase)
+	}
+	if run.Checked != 4 || run.Quarantined != 3 {
+		t.Errorf("checked %d, quarantined %d; want 4 and 3", run.Checked, run.Quarantined)
+	}
+
+	for _, tc := range []struct {
+		resource models.Resource
+		problem  string
+	}{
+		{missing, models.BlobProblemMissing},
+		{truncated, models.BlobProblemTruncated},
+		{corrupted, models.BlobProblemCorrupted},
+	} {
+		issue := scrubIssue(t, ctx, models.BlobEntityResource, tc.resource.ID)
+		if issue == nil {
+			t.Errorf("%s: no issue recorded", tc.resource.Location)
+			continue
+		}
+		if issue.Problem != tc.problem || issue.Status != models.BlobStatusQuarantined {
+			t.Errorf("%s: got %s/%s, want %s/quarantined", tc.resource.Location, issue.Problem, issue.Status, tc.problem)
+		}
+		if ctx.QuarantinedBlob(nil, tc.resource.Location) == nil {
+			t.Errorf("%s is not quarantined", tc.resource.Location)
+		}
+	}
+	if scrubIssue(t, ctx, models.BlobEntityResource, intact.ID) != nil {
+		t.Error("the intact file has an issue")
+	}
+	if ctx.QuarantinedBlob(nil, intact.Location) != nil {
+		t.Error("the intact file is quarantined")
+	}
+	alt := "cold"
+	if ctx.QuarantinedBlob(&alt, corrupted.Location) != nil {
+		t.Error("the quarantine leaked to another filesystem")
+	}
+}
+
+func TestBlobScrub_RepairsFromADuplicate(t *testing.T) {
+	ctx, fs := createScrubTestContext(t, "blob_scrub_repair_test")
+	content := []byte("a file stored twice")
+
+	damaged := storeScrubResource(t, ctx, fs, "/resources/a", content)
+	twin := storeScrubResource(t, ctx, fs, "/resources/b", content)
+	_ = afero.WriteFile(fs, damaged.Location, []byte("a file stored tw1ce"), 0644)
+
+	run := runScrub(t, ctx, true)
+	if run.Repaired != 1 || run.Quarantined != 0 {
+		t.Errorf("repaired %d, quarantined %d; want 1 and 0", run.Repaired, run.Quarantined)
+	}
+	issue := scrubIssue(t, ctx, models.BlobEntityResource, damaged.ID)
+	if issue == nil || issue.Status != models.BlobStatusRepaired || issue.RepairedFrom == "" {
+		t.Fatalf("issue = %+v, want repaired with a source", issue)
+	}
+	got, _ := afero.ReadFile(fs, damaged.Location)
+	if !bytes.Equal(got, content) {
+		t.Errorf("repaired file = %q, want %q", got, content)
+	}
+	if ctx.QuarantinedBlob(nil, damaged.Location) != nil {
+		t.Error("the repaired file is still quarantined")
+	}
+	if scrubIssue(t, ctx, models.BlobEntityResource, twin.ID) != nil {
+		t.Error("the intact copy has an issue")
+	}
+}
+
+func TestBlobScrub_ResumesFromItsCheckpoint(t *testing.T) {
+	ctx, fs := createScrubTestContext(t, "blob_scrub_resume_test")
+
+	first := storeScrubResource(t, ctx, fs, "/resources/1", []byte("first"))
+	second := storeScrubResource(t, ctx, fs, "/resources/2", []byte("second"))
+	_ = fs.Remove(first.Location)
+	_ = fs.Remove(second.Location)
+
+	// A run interrupted after the first resource resumes with the second.
+	run := models.BlobScrubRun{Phase: models.BlobEntityResource, LastID: first.ID, Checked: 1}
+	ctx.db.Create(&run)
+	if err := ctx.runBlobScrub(context.Background(), run.ID, scrubSink{}); err != nil {
+		t.Fatalf("runBlobScrub: %v", err)
+	}
+	ctx.db.First(&run, run.ID)
+
+	if run.Checked != 2 {
+		t.Errorf("checked = %d, want 2", run.Checked)
+	}
+	if scrubIssue(t, ctx, models.BlobEntityResource, first.ID) != nil {
+		t.Error("the resumed run checked a resource before its checkpoint")
+	}
+	if scrubIssue(t, ctx, models.BlobEntityResource, second.ID) == nil {
+		t.Error("the resumed run skipped a resource after its checkpoint")
+	}
+}
+
+func TestBlobScrub_CancelledRunKeepsItsCheckpoint(t *testing.T) {
+	ctx, fs := createScrubTestContext(t, "blob_scrub_cancel_test")
+	storeScrubResource(t, ctx, fs, "/resources/1", []byte("first"))
+
+	run := models.BlobScrubRun{Phase: models.BlobEntityResource}
+	ctx.db.Create(&run)
+	c, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := ctx.runBlobScrub(c, run.ID, scrubSink{}); err == nil {
+		t.Fatal("a cancelled scrub reported success")
+	}
+	ctx.db.First(&run, run.ID)
+	if run.FinishedAt != nil {
+		t.Error("a cancelled run was marked finished, so it cannot be resumed")
+	}
+	if ctx.blobScrub.running.Load() {
+		t.Error("the running flag outlived the cancelled scrub")
+	}
+}
+
+func TestBlobScrub_SkipsVersionsSharingTheResourceFile(t *testing.T) {
+	ctx, fs := createScrubTestContext(t, "blob_scrub_versions_test")
+
+	resource := storeScrubResource(t, ctx, fs, "/resources/current", []byte("current"))
+	old := []byte("old content")
+	sum := sha1.Sum(old)
+	_ = afero.WriteFile(fs, "/resources/old", []byte("old c0ntent"), 0644)
+	versions := []models.ResourceVersion{
+		{ResourceID: resource.ID, VersionNumber: 1, Hash: hex.EncodeToString(sum[:]), HashType: "SHA1", FileSize: int64(len(old)), Location: "/resources/old"},
+		{ResourceID: resource.ID, VersionNumber: 2, Hash: resource.Hash, HashType: "SHA1", FileSize: resource.FileSize, Location: resource.Location},
+	}
+	ctx.db.Create(&versions)
+
+	run := runScrub(t, ctx, false)
+	if run.Checked != 2 {
+		t.Errorf("checked = %d, want the resource and the old version", run.Checked)
+	}
+	issue := scrubIssue(t, ctx, models.BlobEntityVersion, versions[0].ID)
+	if issue == nil || issue.Problem != models.BlobProblemCorrupted {
+		t.Fatalf("old version issue = %+v, want corrupted", issue)
+	}
+	if ctx.QuarantinedBlob(nil, "resources/old") == nil {
+		t.Error("the corrupted version file is not quarantined")
+	}
+}
+
+func TestBlobScrub_DeletesCorruptPreviews(t *testing.T) {
+	ctx, fs := createScrubTestContext(t, "blob_scrub_preview_test")
+	resource := storeScrubResource(t, ctx, fs, "/resources/image", []byte("image"))
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	good := models.Preview{Data: buf.Bytes(), Width: 4, Height: 4, ResourceId: &resource.ID}
+	bad := models.Preview{Data: buf.Bytes()[:buf.Len()/2], Width: 8, Height: 8, ResourceId: &resource.ID}
+	ctx.db.Create(&good)
+	ctx.db.Create(&bad)
+
+	run := runScrub(t, ctx, false)
+	if run.Repaired != 1 {
+		t.Errorf("repaired = %d, want 1", run.Repaired)
+	}
+	var left []models.Preview
+	ctx.db.Find(&left)
+	if len(left) != 1 || left[0].ID != good.ID {
+		t.Errorf("previews left = %d, want only the intact one", len(left))
+	}
+	issue := scrubIssue(t, ctx, models.BlobEntityPreview, bad.ID)
+	if issue == nil || issue.Status != models.BlobStatusRepaired || issue.Problem != models.BlobProblemCorrupted {
+		t.Errorf("preview issue = %+v, want corrupted and repaired", issue)
+	}
+}
+
+func TestRecheckBlobIntegrityIssue_ClearsARestoredFile(t *testing.T) {
+	ctx, fs := createScrubTestContext(t, "blob_scrub_recheck_test")
+	content := []byte("restored from backup")
+	resource := storeScrubResource(t, ctx, fs, "/resources/r", content)
+	_ = fs.Remove(resource.Location)
+
+	runScrub(t, ctx, false)
+	issue := scrubIssue(t, ctx, models.BlobEntityResource, resource.ID)
+	if issue == nil {
+		t.Fatal("no issue for the missing file")
+	}
+
+	_ = afero.WriteFile(fs, resource.Location, content, 0644)
+	rechecked, err := ctx.RecheckBlobIntegrityIssue(issue.ID, false)
+	if err != nil {
+		t.Fatalf("RecheckBlobIntegrityIssue: %v", err)
+	}
+	if rechecked.Status != models.BlobStatusCleared {
+		t.Errorf("status = %s, want cleared", rechecked.Status)
+	}
+	if ctx.QuarantinedBlob(nil, resource.Location) != nil {
+		t.Error("the restored file is still quarantined")
+	}
+}
+
+func TestQuarantinedBlob_IgnoresDeletedEntities(t *testing.T) {
+	ctx, fs := createScrubTestContext(t, "blob_scrub_deleted_test")
+	resource := storeScrubResource(t, ctx, fs, "/resources/gone", []byte("gone"))
+	_ = fs.Remove(resource.Location)
+
+	runScrub(t, ctx, false)
+	if ctx.QuarantinedBlob(nil, resource.Location) == nil {
+		t.Fatal("the missing file is not quarantined")
+	}
+
+	ctx.db.Delete(&models.Resource{}, resource.ID)
+	if ctx.QuarantinedBlob(nil, resource.Location) != nil {
+		t.Error("a deleted resource's quarantine still blocks its location")
+	}
+}
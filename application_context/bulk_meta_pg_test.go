@@ -0,0 +1,73 @@
+//go:build postgres
+
+package application_context
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/spf13/afero"
+
+	"mahresources/constants"
+	"mahresources/models"
+	"mahresources/models/query_models"
+	"mahresources/models/types"
+)
+
+// A null in a bulk meta patch clears the key. json_patch does that on SQLite
+// by definition; jsonb || on Postgres would store a JSON null instead, which
+// is what jsonbMetaPatchExpr exists to prevent.
+func TestBulkAddMetaPG_NullClearsKey(t *testing.T) {
+	db, dsn := pgContainer.CreateTestDBWithDSN(t)
+	if err := db.AutoMigrate(&models.Tag{}, &models.Category{}, &models.ResourceCategory{}, &models.NoteType{},
+		&models.Series{}, &models.Group{}, &models.Resource{}, &models.Note{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	readOnly, err := sqlx.Connect("pgx", dsn)
+	if err != nil {
+		t.Fatalf("open read-only handle: %v", err)
+	}
+	t.Cleanup(func() { readOnly.Close() })
+	ctx := NewMahresourcesContext(afero.NewMemMapFs(), db, readOnly, &MahresourcesConfig{DbType: constants.DbTypePosgres})
+
+	meta := types.JSON(`{"keep":1,"drop":2}`)
+	group := &models.Group{Name: "pg-meta-group", Meta: meta}
+	note := &models.Note{Name: "pg-meta-note", Meta: meta}
+	resource := &models.Resource{Name: "pg-meta-resource", Meta: meta, OwnMeta: meta}
+	for _, entity := range []any{group, note, resource} {
+		if err := db.Create(entity).Error; err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+
+	patch := `{"drop":null,"added":true}`
+	if err := ctx.BulkAddMetaToGroups(&query_models.BulkEditMetaQuery{BulkQuery: query_models.BulkQuery{ID: []uint{group.ID}}, Meta: patch}); err != nil {
+		t.Fatalf("groups: %v", err)
+	}
+	if err := ctx.BulkAddMetaToNotes(&query_models.BulkEditMetaQuery{BulkQuery: query_models.BulkQuery{ID: []uint{note.ID}}, Meta: patch}); err != nil {
+		t.Fatalf("notes: %v", err)
+	}
+	if err := ctx.BulkAddMetaToResources(&query_models.BulkEditMetaQuery{BulkQuery: query_models.BulkQuery{ID: []uint{resource.ID}}, Meta: patch}); err != nil {
+		t.Fatalf("resources: %v", err)
+	}
+
+	check := func(label, table, column string, id uint) {
+		t.Helper()
+		var raw string
+		if err := db.Raw("SELECT "+column+"::text FROM "+table+" WHERE id = ?", id).Scan(&raw).Error; err != nil {
+			t.Fatalf("%s: %v", label, err)
+		}
+		var got map[string]any
+		if err := json.Unmarshal([]byte(raw), &got); err != nil {
+			t.Fatalf("%s: %v", label, err)
+		}
+		if _, present := got["drop"]; present || got["keep"] != float64(1) || got["added"] != true {
+			t.Errorf("%s: expected drop removed and keep/added present, got %s", label, raw)
+		}
+	}
+	check("group meta", "groups", "meta", group.ID)
+	check("note meta", "notes", "meta", note.ID)
+	check("resource meta", "resources", "meta", resource.ID)
+	check("resource own_meta", "resources", "own_meta", resource.ID)
+}
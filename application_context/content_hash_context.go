@@ -0,0 +1,337 @@
+package application_context
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"time"
+
+	"gorm.io/gorm"
+
+	"mahresources/download_queue"
+	"mahresources/models"
+	"mahresources/models/database_scopes"
+)
+
+// ErrContentHashMigrationInProgress is returned when a content hash migration
+// is already running.
+var ErrContentHashMigrationInProgress = errors.New("content hash migration already in progress")
+
+// contentHashMigrationBatchSize bounds the rows loaded per page and the work
+// a crash loses: the checkpoint is saved after every batch.
+const contentHashMigrationBatchSize = 200
+
+// contentHashMigrationPhases is the walk order; a run's Phase is one of them,
+// then done.
+var contentHashMigrationPhases = []string{models.BlobEntityResource, models.BlobEntityVersion}
+
+const contentHashMigrationPhaseDone = "done"
+
+// contentHasher hashes a file with SHA-256 and, for the transition, SHA1.
+type contentHasher struct {
+	sum    hash.Hash
+	legacy hash.Hash
+}
+
+func newContentHasher() *contentHasher {
+	return &contentHasher{sum: sha256.New(), legacy: sha1.New()}
+}
+
+func (h *contentHasher) Write(p []byte) (int, error) {
+	h.sum.Write(p)
+	return h.legacy.Write(p)
+}
+
+// Sums returns the SHA-256, stored as Hash, and the SHA1, stored as LegacyHash.
+func (h *contentHasher) Sums() (string, string) {
+	return hex.EncodeToString(h.sum.Sum(nil)), hex.EncodeToString(h.legacy.Sum(nil))
+}
+
+// computeContentHash returns content's SHA-256 and SHA1; see contentHasher.
+func computeContentHash(content []byte) (string, string) {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), computeSHA1(content)
+}
+
+// ContentHashMigrationOptions configures StartContentHashMigration.
+type ContentHashMigrationOptions struct {
+	// Restart abandons an unfinished run instead of resuming it.
+	Restart bool
+}
+
+// ContentHashMigrationStart describes a submitted migration.
+type ContentHashMigrationStart struct {
+	JobID   string `json:"jobId"`
+	RunID   uint   `json:"runId"`
+	Resumed bool   `json:"resumed"`
+	Phase   string `json:"phase"`
+	LastID  uint   `json:"lastId"`
+}
+
+// ContentHashMigrationStatus is the newest run and how many resources and
+// versions are still hashed with SHA1.
+type ContentHashMigrationStatus struct {
+	Running   bool                            `json:"running"`
+	Run       *models.ContentHashMigrationRun `json:"run"`
+	Remaining map[string]int64                `json:"remaining"`
+}
+
+// StartContentHashMigration submits a background job that re-hashes every
+// resource and version still on SHA1 with SHA-256. Each file is read once and
+// checked against its recorded SHA1 first; a row whose file is missing or no
+// longer matches is skipped and stays on SHA1, which every lookup still
+// accepts. Files stay where they are.
+//
+// The newest unfinished run is resumed from its checkpoint unless Restart is
+// set. Like the blob scrub, the check here only answers a request made while
+// a migration runs with a 409; the guard itself is taken by the job.
+func (ctx *MahresourcesContext) StartContentHashMigration(opts ContentHashMigrationOptions) (*ContentHashMigrationStart, error) {
+	if ctx.hashMigration.Load() {
+		return nil, ErrContentHashMigrationInProgress
+	}
+
+	var run models.ContentHashMigrationRun
+	if err := ctx.db.Where("finished_at IS NULL").Order("id DESC").Limit(1).Find(&run).Error; err != nil {
+		return nil, err
+	}
+	resumed := run.ID != 0 && !opts.Restart
+	if run.ID != 0 && opts.Restart {
+		if err := ctx.db.Model(&models.ContentHashMigrationRun{}).Where("finished_at IS NULL").Update("finished_at", time.Now()).Error; err != nil {
+			return nil, err
+		}
+	}
+	if !resumed {
+		run = models.ContentHashMigrationRun{StartedAt: time.Now(), Phase: contentHashMigrationPhases[0]}
+		if err := ctx.db.Create(&run).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	job, err := ctx.downloadManager.SubmitJob("content-hash-migration", "queued", func(c context.Context, _ *download_queue.DownloadJob, p download_queue.ProgressSink) error {
+		return ctx.runContentHashMigration(c, run.ID, p)
+	})
+	if err != nil {
+		return nil, err
+	}
+	ctx.db.Model(&run).Update("job_id", job.ID)
+
+	return &ContentHashMigrationStart{JobID: job.ID, RunID: run.ID, Resumed: resumed, Phase: run.Phase, LastID: run.LastID}, nil
+}
+
+// GetContentHashMigrationStatus returns the newest migration run and the rows
+// left on SHA1.
+func (ctx *MahresourcesContext) GetContentHashMigrationStatus() (*ContentHashMigrationStatus, error) {
+	status := &ContentHashMigrationStatus{Running: ctx.hashMigration.Load(), Remaining: map[string]int64{}}
+
+	var run models.ContentHashMigrationRun
+	if err := ctx.db.Order("id DESC").Limit(1).Find(&run).Error; err != nil {
+		return nil, err
+	}
+	if run.ID != 0 {
+		status.Run = &run
+	}
+
+	for _, phase := range contentHashMigrationPhases {
+		var n int64
+		if err := ctx.contentHashMigrationQuery(phase).Count(&n).Error; err != nil {
+			return nil, err
+		}
+		status.Remaining[phase] = n
+	}
+	return status, nil
+}
+
+// contentHashMigrationQuery selects the rows of a phase still on SHA1.
+func (ctx *MahresourcesContext) contentHashMigrationQuery(phase string) *gorm.DB {
+	q := ctx.db.Model(&models.Resource{})
+	if phase == models.BlobEntityVersion {
+		q = ctx.db.Model(&models.ResourceVersion{})
+	}
+	return q.Where("hash <> '' AND COALESCE(hash_type, '') IN ?", []string{"", models.HashTypeSHA1})
+}
+
+// runContentHashMigration walks a run from its checkpoint to the end.
+func (ctx *MahresourcesContext) runContentHashMigration(c context.Context, runID uint, p download_queue.ProgressSink) error {
+	if !ctx.hashMigration.CompareAndSwap(false, true) {
+		return ErrContentHashMigrationInProgress
+	}
+	defer ctx.hashMigration.Store(false)
+
+	var run models.ContentHashMigrationRun
+	if err := ctx.db.First(&run, runID).Error; err != nil {
+		return err
+	}
+
+	// Migrated rows drop out of the query, so the total is what is left after
+	// the checkpoint.
+	var total, done int64
+	reached := false
+	for _, phase := range contentHashMigrationPhases {
+		q := ctx.contentHashMigrationQuery(phase)
+		if phase == run.Phase {
+			q = q.Where("id > ?", run.LastID)
+			reached = true
+		} else if !reached {
+			continue
+		}
+		var n int64
+		q.Count(&n)
+		total += n
+	}
+	p.UpdateProgress(done, total)
+
+	for phaseIndex, phase := range contentHashMigrationPhases {
+		if run.Phase != phase {
+			continue
+		}
+		p.SetPhase("re-hashing " + phase + "s")
+		for {
+			if err := c.Err(); err != nil {
+				return err
+			}
+			n, err := ctx.migrateContentHashBatch(&run, p)
+			if err != nil {
+				return err
+			}
+			if err := ctx.db.Save(&run).Error; err != nil {
+				return err
+			}
+			if n == 0 {
+				break
+			}
+			done += int64(n)
+			p.UpdateProgress(done, total)
+		}
+		run.Phase, run.LastID = contentHashMigrationPhaseDone, 0
+		if phaseIndex+1 < len(contentHashMigrationPhases) {
+			run.Phase = contentHashMigrationPhases[phaseIndex+1]
+		}
+		if err := ctx.db.Save(&run).Error; err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	run.FinishedAt = &now
+	if err := ctx.db.Save(&run).Error; err != nil {
+		return err
+	}
+	ctx.Logger().Info(models.LogActionSystem, "content_hash_migration", &run.ID, "", "Content hash migration finished", map[string]interface{}{
+		"migrated": run.Migrated,
+		"skipped":  run.Skipped,
+	})
+	p.SetPhase("completed")
+	return nil
+}
+
+// migrateContentHashBatch re-hashes the next batch after the run's checkpoint
+// and advances it, returning how many rows were handled.
+func (ctx *MahresourcesContext) migrateContentHashBatch(run *models.ContentHashMigrationRun, p download_queue.ProgressSink) (int, error) {
+	q := ctx.contentHashMigrationQuery(run.Phase).Where("id > ?", run.LastID).Order("id").Limit(contentHashMigrationBatchSize)
+
+	var targets []blobTarget
+	if run.Phase == models.BlobEntityVersion {
+		var versions []models.ResourceVersion
+		if err := q.Find(&versions).Error; err != nil {
+			return 0, err
+		}
+		for _, v := range versions {
+			targets = append(targets, versionBlobTarget(v))
+		}
+	} else {
+		var resources []models.Resource
+		if err := q.Find(&resources).Error; err != nil {
+			return 0, err
+		}
+		for _, r := range resources {
+			targets = append(targets, resourceBlobTarget(r))
+		}
+	}
+
+	for _, t := range targets {
+		run.LastID = t.entityID
+		sum, size, err := ctx.rehashBlob(t)
+		if err == nil {
+			err = ctx.storeContentHash(t, sum)
+		}
+		if err != nil {
+			run.Skipped++
+			p.AppendWarning(fmt.Sprintf("%s: %v", t.describe(), err))
+			ctx.Logger().Warning(models.LogActionSystem, t.entityType, &t.entityID, "", "Content hash migration skipped a file", map[string]interface{}{
+				"location": t.location,
+				"error":    err.Error(),
+			})
+			continue
+		}
+		run.Migrated++
+		run.ReadBytes += size
+	}
+	return len(targets), nil
+}
+
+// rehashBlob returns the SHA-256 of t's file. A row already migrated with the
+// same SHA1 holds the same content, so its SHA-256 is reused and a version
+// sharing its resource's file is not read twice.
+func (ctx *MahresourcesContext) rehashBlob(t blobTarget) (string, int64, error) {
+	for _, model := range []any{&models.Resource{}, &models.ResourceVersion{}} {
+		var sums []string
+		if err := ctx.db.Model(model).Where("legacy_hash = ? AND hash_type = ?", t.hash, models.HashTypeSHA256).Limit(1).Pluck("hash", &sums).Error; err != nil {
+			return "", 0, err
+		}
+		if len(sums) > 0 {
+			return sums[0], 0, nil
+		}
+	}
+
+	fs, err := ctx.GetFsForStorageLocation(storagePointer(t.storage))
+	if err != nil {
+		return "", 0, err
+	}
+	f, err := fs.Open(t.location)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := newContentHasher()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	sum, legacy := h.Sums()
+	if legacy != t.hash {
+		return "", 0, fmt.Errorf("the file's SHA1 is %s, not the recorded %s", legacy, t.hash)
+	}
+	return sum, size, nil
+}
+
+// storeContentHash records t's SHA-256, keeping its SHA1 as the legacy hash.
+// The old hash is part of the match, so a row whose content changed since it
+// was read is left for the next run. Columns are updated directly: the
+// content did not change, so neither does updated_at.
+func (ctx *MahresourcesContext) storeContentHash(t blobTarget, sum string) error {
+	var model any = &models.Resource{}
+	if t.entityType == models.BlobEntityVersion {
+		model = &models.ResourceVersion{}
+	}
+	result := ctx.db.Model(model).
+		Where("id = ? AND hash = ?", t.entityID, t.hash).
+		UpdateColumns(map[string]any{"hash": sum, "hash_type": models.HashTypeSHA256, "legacy_hash": t.hash})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("the row changed while it was re-hashed")
+	}
+	return nil
+}
+
+// contentHashMatch is database_scopes.ContentHashMatch on unqualified columns.
+func contentHashMatch(hashes ...string) func(db *gorm.DB) *gorm.DB {
+	return database_scopes.ContentHashMatch("", hashes...)
+}
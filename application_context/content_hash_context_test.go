@@ -0,0 +1,114 @@
+package application_context
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/spf13/afero"
+	"mahresources/models"
+)
+
+func runHashMigration(t *testing.T, ctx *MahresourcesContext, run models.ContentHashMigrationRun) models.ContentHashMigrationRun {
+	t.Helper()
+	if run.Phase == "" {
+		run.Phase = models.BlobEntityResource
+	}
+	if err := ctx.db.Create(&run).Error; err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	if err := ctx.runContentHashMigration(context.Background(), run.ID, scrubSink{}); err != nil {
+		t.Fatalf("runContentHashMigration: %v", err)
+	}
+	ctx.db.First(&run, run.ID)
+	return run
+}
+
+func sha256Hex(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestContentHashMigration_RehashesAndKeepsTheSHA1(t *testing.T) {
+	ctx, fs := createScrubTestContext(t, "content_hash_migration_test")
+	content := []byte("stored before sha-256")
+
+	resource := storeScrubResource(t, ctx, fs, "/resources/old", content)
+	// v1 shares the resource's file; the migration reuses the resource's hash.
+	shared := models.ResourceVersion{ResourceID: resource.ID, VersionNumber: 1, Hash: resource.Hash, HashType: "SHA1", FileSize: resource.FileSize, Location: resource.Location}
+	ctx.db.Create(&shared)
+	damaged := storeScrubResource(t, ctx, fs, "/resources/damaged", []byte("damaged"))
+	_ = afero.WriteFile(fs, damaged.Location, []byte("DAMAGED"), 0644)
+	var before models.Resource
+	ctx.db.First(&before, resource.ID)
+
+	run := runHashMigration(t, ctx, models.ContentHashMigrationRun{})
+	if run.FinishedAt == nil || run.Phase != contentHashMigrationPhaseDone {
+		t.Fatalf("run did not finish: phase %q", run.Phase)
+	}
+	if run.Migrated != 2 || run.Skipped != 1 {
+		t.Errorf("migrated %d, skipped %d; want 2 and 1", run.Migrated, run.Skipped)
+	}
+	if run.ReadBytes != int64(len(content)) {
+		t.Errorf("read %d bytes, want %d: the shared file was read twice", run.ReadBytes, len(content))
+	}
+
+	var got models.Resource
+	ctx.db.First(&got, resource.ID)
+	if got.Hash != sha256Hex(content) || got.HashType != models.HashTypeSHA256 || got.LegacyHash != resource.Hash {
+		t.Errorf("resource = %s %s legacy %s, want the SHA-256 with the SHA1 kept", got.HashType, got.Hash, got.LegacyHash)
+	}
+	if !got.UpdatedAt.Equal(before.UpdatedAt) {
+		t.Error("re-hashing changed updated_at")
+	}
+	var gotVersion models.ResourceVersion
+	ctx.db.First(&gotVersion, shared.ID)
+	if gotVersion.Hash != got.Hash || gotVersion.LegacyHash != resource.Hash {
+		t.Errorf("version = %s legacy %s, want the resource's hashes", gotVersion.Hash, gotVersion.LegacyHash)
+	}
+
+	var stale models.Resource
+	ctx.db.First(&stale, damaged.ID)
+	if stale.Hash != damaged.Hash || stale.HashType != models.HashTypeSHA1 {
+		t.Errorf("the damaged file was re-hashed: %s %s", stale.HashType, stale.Hash)
+	}
+
+	// Lookups by either hash find the migrated resource.
+	for _, h := range []string{got.Hash, resource.Hash} {
+		found, err := ctx.GetResourceByHash(h)
+		if err != nil || found.ID != resource.ID {
+			t.Errorf("GetResourceByHash(%s) = %v, %v", h, found, err)
+		}
+	}
+	if n, _ := ctx.CountHashReferences(resource.Hash); n != 2 {
+		t.Errorf("CountHashReferences by SHA1 = %d, want 2", n)
+	}
+
+	status, err := ctx.GetContentHashMigrationStatus()
+	if err != nil {
+		t.Fatalf("GetContentHashMigrationStatus: %v", err)
+	}
+	if status.Remaining[models.BlobEntityResource] != 1 || status.Remaining[models.BlobEntityVersion] != 0 {
+		t.Errorf("remaining = %v, want only the damaged resource", status.Remaining)
+	}
+}
+
+func TestContentHashMigration_ResumesFromItsCheckpoint(t *testing.T) {
+	ctx, fs := createScrubTestContext(t, "content_hash_migration_resume_test")
+	first := storeScrubResource(t, ctx, fs, "/resources/1", []byte("first"))
+	second := storeScrubResource(t, ctx, fs, "/resources/2", []byte("second"))
+
+	// A run interrupted after the first resource resumes with the second.
+	run := runHashMigration(t, ctx, models.ContentHashMigrationRun{LastID: first.ID, Migrated: 1})
+	if run.Migrated != 2 {
+		t.Errorf("migrated = %d, want 2", run.Migrated)
+	}
+
+	var got []models.Resource
+	ctx.db.Order("id").Find(&got)
+	if got[0].HashType != models.HashTypeSHA1 || got[1].Hash != sha256Hex([]byte("second")) {
+		t.Errorf("the resumed run re-hashed %v, want only resource %d", got, second.ID)
+	}
+
+}
@@ -12,6 +12,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -43,8 +44,10 @@ type MahresourcesConfig struct {
 	DbDsn            string
 	DbReadOnlyDsn    string
 	AltFileSystems   map[string]string
+	EncryptionKeys   *storage.KeyRing
 	FfmpegPath       string
 	LibreOfficePath  string
+	PdfRendererPath  string
 	BindAddress      string
 	SharePort        string
 	ShareBindAddress string
@@ -128,6 +131,28 @@ type MahresourcesConfig struct {
 	// PluginScheduleTick is how often the plugin scheduler looks for due work.
 	// It bounds the resolution of every schedule.
 	PluginScheduleTick time.Duration
+	// MRQLMaterializeTick is how often the background refresher looks for
+	// materialized saved MRQL queries that are due.
+	MRQLMaterializeTick time.Duration
+	// StorageTierRules move resources between filesystems, tried in order.
+	// See StartStorageTiering.
+	StorageTierRules []StorageTierRule
+	// StorageTierInterval is how often the rules are applied in the
+	// background; 0 applies them only on request.
+	StorageTierInterval time.Duration
+	// ResumableUploadExpiry is how long an unfinished resumable upload is kept
+	// after its last chunk before it and its staged chunks are deleted.
+	ResumableUploadExpiry time.Duration
+	// ArchiveExpandMaxEntries and ArchiveExpandMaxSize bound the entries in,
+	// and the unpacked size of, an archive expanded into a group; 0 selects
+	// the defaults. See StartArchiveExpansion.
+	ArchiveExpandMaxEntries int
+	ArchiveExpandMaxSize    int64
+	// WatchFolderInterval is how often the watch folders are polled; 0 scans
+	// them only on request. WatchFolderSettle is how long a file must go
+	// unmodified before it is ingested. See ScanWatchFolder.
+	WatchFolderInterval time.Duration
+	WatchFolderSettle   time.Duration
 	// MaxImportSize is the upper bound on import tar upload size in bytes
 	MaxImportSize int64
 	// MaxUploadSize is the upper bound on resource + version upload body size
@@ -211,6 +236,7 @@ type MahresourcesInputConfig struct {
 	BindAddress          string
 	FfmpegPath           string
 	LibreOfficePath      string
+	PdfRendererPath      string
 	SharePort            string
 	ShareBindAddress     string
 	// SharePublicURL is the externally-routable base URL for shared notes.
@@ -221,6 +247,9 @@ type MahresourcesInputConfig struct {
 	// DocsLinksDisabled hides contextual external documentation links when true.
 	DocsLinksDisabled bool
 	AltFileSystems    map[string]string
+	// EncryptionKeys encrypts the main and every alt filesystem; nil leaves
+	// files in the clear. See storage.EncryptedFs.
+	EncryptionKeys *storage.KeyRing
 	// MemoryDB uses an in-memory SQLite database (ephemeral, no persistence)
 	MemoryDB bool
 	// MemoryFS uses an in-memory filesystem (ephemeral, no persistence)
@@ -285,6 +314,28 @@ type MahresourcesInputConfig struct {
 	// PluginScheduleTick is how often the plugin scheduler looks for due work.
 	// It bounds the resolution of every schedule.
 	PluginScheduleTick time.Duration
+	// MRQLMaterializeTick is how often the background refresher looks for
+	// materialized saved MRQL queries that are due.
+	MRQLMaterializeTick time.Duration
+	// StorageTierRules move resources between filesystems, tried in order.
+	// See StartStorageTiering.
+	StorageTierRules []StorageTierRule
+	// StorageTierInterval is how often the rules are applied in the
+	// background; 0 applies them only on request.
+	StorageTierInterval time.Duration
+	// ResumableUploadExpiry is how long an unfinished resumable upload is kept
+	// after its last chunk before it and its staged chunks are deleted.
+	ResumableUploadExpiry time.Duration
+	// ArchiveExpandMaxEntries and ArchiveExpandMaxSize bound the entries in,
+	// and the unpacked size of, an archive expanded into a group; 0 selects
+	// the defaults. See StartArchiveExpansion.
+	ArchiveExpandMaxEntries int
+	ArchiveExpandMaxSize    int64
+	// WatchFolderInterval is how often the watch folders are polled; 0 scans
+	// them only on request. WatchFolderSettle is how long a file must go
+	// unmodified before it is ingested. See ScanWatchFolder.
+	WatchFolderInterval time.Duration
+	WatchFolderSettle   time.Duration
 	// MaxImportSize is the upper bound on import tar upload size in bytes
 	MaxImportSize int64
 	// MaxUploadSize is the upper bound on resource + version upload body size
@@ -343,8 +394,10 @@ type MahresourcesLocks struct {
 	ThumbnailGenerationLock      *idlock.Lock[uint]
 	VideoThumbnailGenerationLock *idlock.Lock[uint]
 	OfficeDocumentGenerationLock *idlock.Lock[uint]
+	PdfGenerationLock            *idlock.Lock[uint]
 	ResourceHashLock             *idlock.Lock[string]
 	VersionUploadLock            *idlock.Lock[uint]
+	ResumableUploadLock          *idlock.Lock[string]
 }
 
 type MahresourcesContext struct {
@@ -492,6 +545,26 @@ type MahresourcesContext struct {
 	// only caller of CreateServer, and the endpoint would happily mint tokens for
 	// a `/s/` route no process serves.
 	shareServerListening *atomic.Bool
+	// mrqlMaterialize tracks entity writes for the on_write refresh policy of
+	// materialized saved queries, and serializes their refreshes. A pointer so
+	// every shallow copy records into, and reads from, the same state.
+	mrqlMaterialize *mrqlMaterializeState
+	// blobScrub guards the blob integrity scrub and caches the quarantine
+	// count the file routes consult. A pointer for the same reason.
+	blobScrub *blobScrubState
+	// blobGC is set while a blob garbage collection runs.
+	blobGC *atomic.Bool
+	// hashMigration is set while the content hash migration runs.
+	hashMigration *atomic.Bool
+	// keyRotation is set while a master key rotation runs.
+	keyRotation *atomic.Bool
+	// storageTiering is set while resources are moved between filesystems.
+	storageTiering *atomic.Bool
+	// resourceViews holds when each resource's view was last recorded, so a
+	// file opened repeatedly is written to resource_views once an hour.
+	resourceViews *sync.Map
+	// watchScans holds the IDs of the watch folders being scanned.
+	watchScans *sync.Map
 }
 
 // MarkShareServerListening records that the share server bound its port and is
@@ -534,11 +607,12 @@ func (ctx *MahresourcesContext) DeferredSigningKey() []byte {
 	return ctx.deferredSigningKey
 }
 
-// RunStartupExportSweep cleans up orphaned export/import tars left over from a
-// previous run. Separated from NewMahresourcesContext so main.go can call it
-// AFTER SetSettings + DownloadManager.SetSettings, ensuring the first-pass
-// retention value reflects any persisted runtime override rather than the boot
-// flag. Safe to call on a nil or unconfigured context.
+// RunStartupExportSweep cleans up orphaned export/import tars, and expired
+// resumable uploads, left over from a previous run. Separated from
+// NewMahresourcesContext so main.go can call it AFTER SetSettings +
+// DownloadManager.SetSettings, ensuring the first-pass retention value
+// reflects any persisted runtime override rather than the boot flag. Safe to
+// call on a nil or unconfigured context.
 func (ctx *MahresourcesContext) RunStartupExportSweep() {
 	if ctx == nil || ctx.exportSweepFs == nil || ctx.downloadManager == nil {
 		return
@@ -554,6 +628,16 @@ func (ctx *MahresourcesContext) RunStartupExportSweep() {
 	} else if removed > 0 {
 		log.Printf("startup: removed %d orphaned import files", removed)
 	}
+	if removed, err := download_queue.SweepOrphanedExports(ctx.exportSweepFs, archiveExpandRoot, retention); err != nil {
+		log.Printf("warning: sweep %s failed: %v", archiveExpandRoot, err)
+	} else if removed > 0 {
+		log.Printf("startup: removed %d orphaned staged archives", removed)
+	}
+	if removed, err := ctx.SweepExpiredResumableUploads(); err != nil {
+		log.Printf("warning: sweep _uploads failed: %v", err)
+	} else if removed > 0 {
+		log.Printf("startup: removed %d expired resumable uploads", removed)
+	}
 }
 
 // deriveDeferredSigningKey returns the HMAC key for deferred-render tokens. When
@@ -579,7 +663,7 @@ func NewMahresourcesContext(filesystem afero.Fs, db *gorm.DB, readOnlyDB *sqlx.D
 	altFileSystems := make(map[string]afero.Fs, len(config.AltFileSystems))
 
 	for key, path := range config.AltFileSystems {
-		altFileSystems[key] = storage.CreateStorage(path)
+		altFileSystems[key] = storage.Encrypt(storage.CreateStorage(path), config.EncryptionKeys)
 	}
 
 	// Built here rather than taken pre-built from the config so that every
@@ -604,8 +688,10 @@ func NewMahresourcesContext(filesystem afero.Fs, db *gorm.DB, readOnlyDB *sqlx.D
 	}
 	videoThumbnailGenerationLock := idlock.New[uint](videoThumbConcurrency, nil)
 	officeDocumentGenerationLock := idlock.New[uint](uint(2), nil)
+	pdfGenerationLock := idlock.New[uint](uint(2), nil)
 	resourceHashLock := idlock.New[string](uint(0), nil)
 	versionUploadLock := idlock.New[uint](uint(0), nil)
+	resumableUploadLock := idlock.New[string](uint(0), nil)
 
 	// Initialize search cache with 60 second TTL and 1000 max entries
 	searchCache := search.NewSearchCache(60*time.Second, 1000)
@@ -635,8 +721,10 @@ func NewMahresourcesContext(filesystem afero.Fs, db *gorm.DB, readOnlyDB *sqlx.D
 			ThumbnailGenerationLock:      thumbnailGenerationLock,
 			VideoThumbnailGenerationLock: videoThumbnailGenerationLock,
 			OfficeDocumentGenerationLock: officeDocumentGenerationLock,
+			PdfGenerationLock:            pdfGenerationLock,
 			ResourceHashLock:             resourceHashLock,
 			VersionUploadLock:            versionUploadLock,
+			ResumableUploadLock:          resumableUploadLock,
 		},
 		search:                    search.NewService(searchCache, config.DbType),
 		icsCache:                  icsCache,
@@ -644,6 +732,14 @@ func NewMahresourcesContext(filesystem afero.Fs, db *gorm.DB, readOnlyDB *sqlx.D
 		rootAdmin:                 newRootAdminCache(),
 		deferredSigningKey:        deriveDeferredSigningKey(config.TemplateSigningKey),
 		shareServerListening:      &atomic.Bool{},
+		mrqlMaterialize:           newMRQLMaterializeState(),
+		blobScrub:                 newBlobScrubState(),
+		blobGC:                    &atomic.Bool{},
+		hashMigration:             &atomic.Bool{},
+		keyRotation:               &atomic.Bool{},
+		storageTiering:            &atomic.Bool{},
+		resourceViews:             &sync.Map{},
+		watchScans:                &sync.Map{},
 	}
 
 	// Install RBAC group-subtree scoping + CreatedByUserId stamping callbacks.
@@ -652,6 +748,7 @@ func NewMahresourcesContext(filesystem afero.Fs, db *gorm.DB, readOnlyDB *sqlx.D
 	// The scope callbacks are no-ops unless a query runs on a db whose context
 	// carries a scope filter/actor (see scoping.go).
 	registerScopeCallbacks(ctx)
+	registerMRQLWriteCallbacks(ctx)
 
 	// Initialize download manager. A static settings provider seeded from the
 	// boot config is used here; main.go swaps it for the live RuntimeSettings
@@ -705,6 +802,16 @@ func NewMahresourcesContext(filesystem afero.Fs, db *gorm.DB, readOnlyDB *sqlx.D
 		} else if n > 0 {
 			log.Printf("periodic sweep: removed %d expired export tars", n)
 		}
+		if n, err := download_queue.SweepOrphanedExports(exportFs, archiveExpandRoot, ctx.downloadManager.ExportRetention()); err != nil {
+			log.Printf("warning: periodic sweep of %s failed: %v", archiveExpandRoot, err)
+		} else if n > 0 {
+			log.Printf("periodic sweep: removed %d expired staged archives", n)
+		}
+		if n, err := ctx.SweepExpiredResumableUploads(); err != nil {
+			log.Printf("warning: periodic resumable upload sweep failed: %v", err)
+		} else if n > 0 {
+			log.Printf("periodic sweep: removed %d expired resumable uploads", n)
+		}
 	})
 
 	// Terminal downloads are persisted so a failure outlives the in-memory queue's
@@ -1041,12 +1148,18 @@ func (ctx *MahresourcesContext) QueueForThumbnailing(resourceID uint) bool {
 }
 
 // OnResourceFileChanged handles cleanup when a resource's file content changes.
-// This deletes the old hash (cascade removes similarity pairs) and re-queues for hashing.
+// This deletes the old hash (cascade removes similarity pairs) and what was read
+// from a PDF, re-queues for hashing and thumbnailing and recharges the
+// resource's storage usage for its new file.
 func (ctx *MahresourcesContext) OnResourceFileChanged(resourceID uint) {
 	// Delete old hash - cascade will remove associated similarity pairs
 	ctx.db.Where("resource_id = ?", resourceID).Delete(&models.ImageHash{})
-	// Re-queue for hashing
+	ctx.db.Where("resource_id = ?", resourceID).Delete(&models.ResourceText{})
+	ctx.db.Model(&models.Resource{}).Where("id = ?", resourceID).UpdateColumn("page_count", 0)
+	ctx.logStorageUsageError(resourceID, ctx.refreshStorageUsage(ctx.db, resourceID))
+	// Re-queue for hashing, and for a new PDF thumbnail, page count and text
 	ctx.QueueForHashing(resourceID)
+	ctx.QueueForThumbnailing(resourceID)
 }
 
 // EnsureForeignKeysActive ensures that sqlite connection somehow didn't manage to deactivate foreign keys
@@ -1306,6 +1419,10 @@ func CreateContextWithConfig(cfg *MahresourcesInputConfig) (*MahresourcesContext
 		}
 		mainFs = storage.CreateStorage(cfg.FileSavePath)
 	}
+	if cfg.EncryptionKeys != nil {
+		mainFs = storage.Encrypt(mainFs, cfg.EncryptionKeys)
+		log.Printf("Encrypting stored files with master key %s", cfg.EncryptionKeys.CurrentKeyID())
+	}
 
 	fmt.Printf("DB_TYPE %v FILE_SAVE_PATH %v\n", dbType, cfg.FileSavePath)
 
@@ -1376,8 +1493,10 @@ func CreateContextWithConfig(cfg *MahresourcesInputConfig) (*MahresourcesContext
 		DbDsn:                        dbDsn,
 		DbReadOnlyDsn:                readOnlyDsn,
 		AltFileSystems:               cfg.AltFileSystems,
+		EncryptionKeys:               cfg.EncryptionKeys,
 		FfmpegPath:                   cfg.FfmpegPath,
 		LibreOfficePath:              cfg.LibreOfficePath,
+		PdfRendererPath:              cfg.PdfRendererPath,
 		BindAddress:                  cfg.BindAddress,
 		SharePort:                    cfg.SharePort,
 		ShareBindAddress:             cfg.ShareBindAddress,
@@ -1412,6 +1531,14 @@ func CreateContextWithConfig(cfg *MahresourcesInputConfig) (*MahresourcesContext
 		DownloadHistoryRetention:     cfg.DownloadHistoryRetention,
 		DownloadCockpitLimit:         cfg.DownloadCockpitLimit,
 		PluginScheduleTick:           cfg.PluginScheduleTick,
+		MRQLMaterializeTick:          cfg.MRQLMaterializeTick,
+		StorageTierRules:             cfg.StorageTierRules,
+		StorageTierInterval:          cfg.StorageTierInterval,
+		ResumableUploadExpiry:        cfg.ResumableUploadExpiry,
+		ArchiveExpandMaxEntries:      cfg.ArchiveExpandMaxEntries,
+		ArchiveExpandMaxSize:         cfg.ArchiveExpandMaxSize,
+		WatchFolderInterval:          cfg.WatchFolderInterval,
+		WatchFolderSettle:            cfg.WatchFolderSettle,
 		MaxImportSize:                cfg.MaxImportSize,
 		MaxUploadSize:                cfg.MaxUploadSize,
 		MaxJSONBodySize:              cfg.MaxJSONBodySize,
@@ -0,0 +1,204 @@
+package application_context
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"mahresources/download_queue"
+	"mahresources/models"
+	"mahresources/storage"
+)
+
+// ErrKeyRotationInProgress is returned when a master key rotation is already
+// running.
+var ErrKeyRotationInProgress = errors.New("master key rotation already in progress")
+
+// ErrEncryptionDisabled is returned for a key rotation when no master key is
+// configured.
+var ErrEncryptionDisabled = errors.New("file encryption is not enabled: no master key is configured")
+
+// keyRotationSaveEvery is how many files pass between saves of a run's
+// counts, so that the status shows a rotation's progress.
+const keyRotationSaveEvery = 500
+
+// keyRotationWarningLimit caps the failures added to the job's warnings; the
+// run counts all of them.
+const keyRotationWarningLimit = 100
+
+// KeyRotationStart describes a submitted key rotation.
+type KeyRotationStart struct {
+	JobID string `json:"jobId"`
+	RunID uint   `json:"runId"`
+	KeyID string `json:"keyId"`
+}
+
+// KeyRotationStatus reports the configured master keys and the newest
+// rotation run.
+type KeyRotationStatus struct {
+	Enabled        bool                          `json:"enabled"`
+	CurrentKeyID   string                        `json:"currentKeyId,omitempty"`
+	PreviousKeyIDs []string                      `json:"previousKeyIds"`
+	Running        bool                          `json:"running"`
+	Run            *models.EncryptionRotationRun `json:"run"`
+}
+
+// StartKeyRotation submits a background job that brings every file on the
+// main and every alt filesystem onto the current master key. A file wrapped
+// with a previous key only gets a new header: its file key is re-wrapped and
+// its content is copied as it is. A file stored before encryption was
+// enabled is encrypted. Each file is rewritten beside the old one and renamed
+// over it, so a reader never sees half of one.
+//
+// Once a run finishes without failures, the previous keys can be removed
+// from the configuration.
+func (ctx *MahresourcesContext) StartKeyRotation() (*KeyRotationStart, error) {
+	keys := ctx.Config.EncryptionKeys
+	if keys == nil {
+		return nil, ErrEncryptionDisabled
+	}
+	if ctx.keyRotation.Load() {
+		return nil, ErrKeyRotationInProgress
+	}
+
+	run := models.EncryptionRotationRun{StartedAt: time.Now(), KeyID: keys.CurrentKeyID().String()}
+	if err := ctx.db.Create(&run).Error; err != nil {
+		return nil, err
+	}
+
+	job, err := ctx.downloadManager.SubmitJob("key-rotation", "queued", func(c context.Context, _ *download_queue.DownloadJob, p download_queue.ProgressSink) error {
+		return ctx.runKeyRotation(c, run.ID, p)
+	})
+	if err != nil {
+		return nil, err
+	}
+	ctx.db.Model(&run).Update("job_id", job.ID)
+	return &KeyRotationStart{JobID: job.ID, RunID: run.ID, KeyID: run.KeyID}, nil
+}
+
+// GetKeyRotationStatus returns the configured master keys by ID and the
+// newest rotation run.
+func (ctx *MahresourcesContext) GetKeyRotationStatus() (*KeyRotationStatus, error) {
+	status := &KeyRotationStatus{Running: ctx.keyRotation.Load(), PreviousKeyIDs: []string{}}
+	if keys := ctx.Config.EncryptionKeys; keys != nil {
+		status.Enabled = true
+		status.CurrentKeyID = keys.CurrentKeyID().String()
+		for _, id := range keys.KeyIDs()[1:] {
+			status.PreviousKeyIDs = append(status.PreviousKeyIDs, id.String())
+		}
+		sort.Strings(status.PreviousKeyIDs)
+	}
+
+	var run models.EncryptionRotationRun
+	if err := ctx.db.Order("id DESC").Limit(1).Find(&run).Error; err != nil {
+		return nil, err
+	}
+	if run.ID != 0 {
+		status.Run = &run
+	}
+	return status, nil
+}
+
+func (ctx *MahresourcesContext) runKeyRotation(c context.Context, runID uint, p download_queue.ProgressSink) error {
+	if !ctx.keyRotation.CompareAndSwap(false, true) {
+		return ErrKeyRotationInProgress
+	}
+	defer ctx.keyRotation.Store(false)
+
+	var run models.EncryptionRotationRun
+	if err := ctx.db.First(&run, runID).Error; err != nil {
+		return err
+	}
+
+	err := ctx.rotateFilesystems(c, &run, p)
+	now := time.Now()
+	run.FinishedAt = &now
+	if err != nil {
+		run.Error = err.Error()
+	}
+	if saveErr := ctx.db.Save(&run).Error; saveErr != nil && err == nil {
+		err = saveErr
+	}
+	if err != nil {
+		return err
+	}
+
+	ctx.Logger().Info(models.LogActionSystem, "key_rotation", &run.ID, "", "Master key rotation finished", map[string]interface{}{
+		"keyId":     run.KeyID,
+		"rewrapped": run.Rewrapped,
+		"encrypted": run.Encrypted,
+		"failed":    run.Failed,
+	})
+	p.SetPhase("completed")
+	return nil
+}
+
+// rotateFilesystems re-wraps the files of the main filesystem, then of each
+// alt filesystem in key order.
+func (ctx *MahresourcesContext) rotateFilesystems(c context.Context, run *models.EncryptionRotationRun, p download_queue.ProgressSink) error {
+	keys := make([]string, 0, len(ctx.altFileSystems)+1)
+	keys = append(keys, "")
+	for key := range ctx.altFileSystems {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys[1:])
+
+	for i, key := range keys {
+		if err := c.Err(); err != nil {
+			return err
+		}
+		name := key
+		if name == "" {
+			name = "main"
+		}
+		p.SetPhase("rotating " + name)
+		p.UpdateProgress(int64(i), int64(len(keys)))
+
+		fs, err := ctx.GetFsForStorageLocation(storagePointer(key))
+		if err != nil {
+			return err
+		}
+		encrypted, ok := fs.(*storage.EncryptedFs)
+		if !ok {
+			return fmt.Errorf("filesystem %s is not encrypted", name)
+		}
+
+		err = encrypted.RewrapAll("/", func(file string, outcome storage.RewrapOutcome, err error) error {
+			if cErr := c.Err(); cErr != nil {
+				return cErr
+			}
+			switch {
+			case os.IsNotExist(err):
+				// Deleted since the directory was listed.
+				return nil
+			case err != nil:
+				run.Failed++
+				if run.Failed <= keyRotationWarningLimit {
+					p.AppendWarning(fmt.Sprintf("%s %s: %v", name, file, err))
+				}
+				ctx.Logger().Warning(models.LogActionSystem, "key_rotation", &run.ID, "", "Master key rotation skipped a file", map[string]interface{}{
+					"filesystem": name,
+					"location":   file,
+					"error":      err.Error(),
+				})
+			case outcome == storage.RewrapRewrapped:
+				run.Rewrapped++
+			case outcome == storage.RewrapEncrypted:
+				run.Encrypted++
+			}
+			run.Scanned++
+			if run.Scanned%keyRotationSaveEvery == 0 {
+				return ctx.db.Save(run).Error
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	p.UpdateProgress(int64(len(keys)), int64(len(keys)))
+	return nil
+}
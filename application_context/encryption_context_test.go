@@ -0,0 +1,100 @@
+package application_context
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/spf13/afero"
+	"mahresources/constants"
+	"mahresources/models"
+	"mahresources/storage"
+)
+
+func testKeyRing(t *testing.T, keys ...byte) *storage.KeyRing {
+	t.Helper()
+	var raw [][]byte
+	for _, b := range keys {
+		raw = append(raw, bytes.Repeat([]byte{b}, storage.MasterKeySize))
+	}
+	ring, err := storage.NewKeyRing(raw[0], raw[1:]...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ring
+}
+
+func TestKeyRotation_RewrapsAndEncryptsEveryFilesystem(t *testing.T) {
+	base, _ := createScrubTestContext(t, "key_rotation_test")
+	altDir := t.TempDir()
+
+	// Files from before the rotation: one on the old key, and two stored
+	// before encryption was enabled, one of them on an alt filesystem.
+	mainBase := afero.NewMemMapFs()
+	if err := afero.WriteFile(storage.Encrypt(mainBase, testKeyRing(t, 1)), "/resources/old", []byte("on the old key"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_ = afero.WriteFile(mainBase, "/resources/clear", []byte("in the clear"), 0644)
+	if err := os.MkdirAll(filepath.Join(altDir, "resources"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	_ = os.WriteFile(filepath.Join(altDir, "resources", "archived"), []byte("archived in the clear"), 0644)
+
+	keys := testKeyRing(t, 2, 1)
+	sqlDB, _ := base.db.DB()
+	ctx := NewMahresourcesContext(storage.Encrypt(mainBase, keys), base.db, sqlx.NewDb(sqlDB, "sqlite3"), &MahresourcesConfig{
+		DbType:         constants.DbTypeSqlite,
+		AltFileSystems: map[string]string{"archive": altDir},
+		EncryptionKeys: keys,
+	})
+
+	run := models.EncryptionRotationRun{KeyID: keys.CurrentKeyID().String()}
+	ctx.db.Create(&run)
+	if err := ctx.runKeyRotation(context.Background(), run.ID, scrubSink{}); err != nil {
+		t.Fatalf("runKeyRotation: %v", err)
+	}
+	ctx.db.First(&run, run.ID)
+	if run.FinishedAt == nil || run.Scanned != 3 || run.Rewrapped != 1 || run.Encrypted != 2 || run.Failed != 0 {
+		t.Errorf("run = scanned %d, rewrapped %d, encrypted %d, failed %d", run.Scanned, run.Rewrapped, run.Encrypted, run.Failed)
+	}
+
+	// Only the new key is needed now.
+	current := testKeyRing(t, 2)
+	for location, want := range map[string]string{"/resources/old": "on the old key", "/resources/clear": "in the clear"} {
+		got, err := afero.ReadFile(storage.Encrypt(mainBase, current), location)
+		if err != nil || string(got) != want {
+			t.Errorf("%s = %q, %v", location, got, err)
+		}
+	}
+	stored, _ := os.ReadFile(filepath.Join(altDir, "resources", "archived"))
+	if bytes.Contains(stored, []byte("archived")) {
+		t.Error("the alt filesystem file is still in the clear")
+	}
+	altFs, _ := ctx.GetFsForStorageLocation(storagePointer("archive"))
+	if got, err := afero.ReadFile(altFs, "/resources/archived"); err != nil || string(got) != "archived in the clear" {
+		t.Errorf("alt file = %q, %v", got, err)
+	}
+
+	status, err := ctx.GetKeyRotationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Enabled || status.CurrentKeyID != keys.CurrentKeyID().String() || len(status.PreviousKeyIDs) != 1 || status.Run == nil {
+		t.Errorf("status = %+v", status)
+	}
+}
+
+func TestKeyRotation_RefusedWithoutEncryption(t *testing.T) {
+	ctx, _ := createScrubTestContext(t, "key_rotation_disabled_test")
+	if _, err := ctx.StartKeyRotation(); !errors.Is(err, ErrEncryptionDisabled) {
+		t.Errorf("StartKeyRotation = %v, want ErrEncryptionDisabled", err)
+	}
+	status, err := ctx.GetKeyRotationStatus()
+	if err != nil || status.Enabled || status.CurrentKeyID != "" {
+		t.Errorf("status = %+v, %v", status, err)
+	}
+}
@@ -155,9 +155,16 @@ func (ctx *MahresourcesContext) MergeGroups(winnerId uint, loserIds []uint) erro
 		if err := altCtx.db.Exec("UPDATE notes SET owner_id = ? WHERE owner_id IN ?", winnerId, loserIds).Error; err != nil {
 			return err
 		}
+		var movedResourceIDs []uint
+		if err := altCtx.db.Raw("SELECT id FROM resources WHERE owner_id IN ?", loserIds).Scan(&movedResourceIDs).Error; err != nil {
+			return err
+		}
 		if err := altCtx.db.Exec("UPDATE resources SET owner_id = ? WHERE owner_id IN ?", winnerId, loserIds).Error; err != nil {
 			return err
 		}
+		if err := altCtx.refreshStorageUsage(altCtx.db, movedResourceIDs...); err != nil {
+			return err
+		}
 
 		// Re-read the winner — its owner_id may have changed if it was owned by a loser
 		if err := altCtx.db.First(&winner, winnerId).Error; err != nil {
@@ -403,7 +410,7 @@ func (ctx *MahresourcesContext) BulkAddMetaToGroups(query *query_models.BulkEdit
 	var expr clause.Expr
 
 	if ctx.Config.DbType == constants.DbTypePosgres {
-		expr = gorm.Expr("meta || ?", query.Meta)
+		expr = jsonbMetaPatchExpr("meta", query.Meta)
 	} else {
 		expr = gorm.Expr("json_patch(meta, ?)", query.Meta)
 	}
@@ -414,6 +421,60 @@ func (ctx *MahresourcesContext) BulkAddMetaToGroups(query *query_models.BulkEdit
 		Update("Meta", expr).Error
 }
 
+// BulkSetOwnerOfGroups moves groups under another owner group. Like
+// UpdateGroup it walks the new owner's ancestry, so no moved group can end up
+// owning itself.
+func (ctx *MahresourcesContext) BulkSetOwnerOfGroups(query *query_models.BulkSetOwnerQuery) error {
+	if len(query.ID) == 0 {
+		return fmt.Errorf("at least one group ID is required")
+	}
+	if query.OwnerId == 0 {
+		return fmt.Errorf("an owner group is required")
+	}
+
+	uniqueGroupIds := deduplicateUints(query.ID)
+
+	err := ctx.db.Transaction(func(tx *gorm.DB) error {
+		// RBAC: verify all group IDs are visible (scope callback filters this Count).
+		var groupCount int64
+		if err := tx.Model(&models.Group{}).Where("id IN ?", uniqueGroupIds).Count(&groupCount).Error; err != nil {
+			return err
+		}
+		if int(groupCount) != len(uniqueGroupIds) {
+			return fmt.Errorf("one or more groups not found")
+		}
+
+		currentAncestor := query.OwnerId
+		for i := 0; i < 100; i++ { // depth limit to prevent infinite loops
+			if slices.Contains(uniqueGroupIds, currentAncestor) {
+				return errors.New("moving a group under itself or one of its descendants would create an ownership cycle")
+			}
+			var ancestor models.Group
+			if err := tx.Select("id", "owner_id").First(&ancestor, currentAncestor).Error; err != nil {
+				if i == 0 {
+					return errors.New("owner group not found")
+				}
+				break // further ancestor not found, no cycle
+			}
+			if ancestor.OwnerId == nil {
+				break // reached a root group, no cycle
+			}
+			currentAncestor = *ancestor.OwnerId
+		}
+
+		return tx.Model(&models.Group{}).Where("id IN ?", uniqueGroupIds).Update("owner_id", query.OwnerId).Error
+	})
+
+	if err == nil {
+		ctx.Logger().Info(models.LogActionUpdate, "group", nil, "", "Bulk moved groups", map[string]interface{}{
+			"groupIds": query.ID,
+			"ownerId":  query.OwnerId,
+		})
+	}
+
+	return err
+}
+
 func (ctx *MahresourcesContext) BulkDeleteGroups(query *query_models.BulkQuery) error {
 	groupIDs := deduplicateUints(query.ID)
 	sort.Slice(groupIDs, func(i, j int) bool { return groupIDs[i] < groupIDs[j] })
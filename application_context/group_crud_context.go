@@ -534,9 +534,19 @@ func (ctx *MahresourcesContext) deleteGroupInTransaction(groupID uint) (groupDel
 	if err := ctx.db.Model(&models.Note{}).Where("owner_id = ?", groupID).Update("owner_id", nil).Error; err != nil {
 		return groupDeleteEffect{}, err
 	}
+	var ownedResourceIDs []uint
+	if err := ctx.db.Model(&models.Resource{}).Where("owner_id = ?", groupID).Pluck("id", &ownedResourceIDs).Error; err != nil {
+		return groupDeleteEffect{}, err
+	}
 	if err := ctx.db.Model(&models.Resource{}).Where("owner_id = ?", groupID).Update("owner_id", nil).Error; err != nil {
 		return groupDeleteEffect{}, err
 	}
+	if err := ctx.refreshStorageUsage(ctx.db, ownedResourceIDs...); err != nil {
+		return groupDeleteEffect{}, err
+	}
+	if err := dropGroupStorageQuota(ctx.db, groupID); err != nil {
+		return groupDeleteEffect{}, err
+	}
 	if err := ctx.db.Exec("DELETE FROM group_related_groups WHERE related_group_id = ?", groupID).Error; err != nil {
 		return groupDeleteEffect{}, err
 	}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"io"
 
+	"gorm.io/gorm"
+
 	"mahresources/download_queue"
 	"mahresources/groupio"
 )
@@ -56,6 +58,18 @@ func (g groupioScope) VisibleGroupIDs(ids []uint) map[uint]bool {
 	return g.ctx.visibleGroupIDs(ids)
 }
 
+// groupioStorage adapts MahresourcesContext to groupio.StorageAccountant, for
+// the same reason groupioScope exists.
+type groupioStorage struct{ ctx *MahresourcesContext }
+
+func (g groupioStorage) CheckStorageQuota(db *gorm.DB, userID, ownerID *uint, blobs map[string]int64, newResources int64) error {
+	return g.ctx.checkStorageQuota(db, userID, ownerID, blobs, newResources)
+}
+
+func (g groupioStorage) RefreshStorageUsage(db *gorm.DB, resourceIDs ...uint) error {
+	return g.ctx.refreshStorageUsage(db, resourceIDs...)
+}
+
 // groupioDeps rebuilds the per-call dependencies every time, so it always
 // reflects THIS context's db — the transactional and/or subtree-scoped handle on
 // a derived copy. Never cache the result.
@@ -66,7 +80,7 @@ func (g groupioScope) VisibleGroupIDs(ids []uint) map[uint]bool {
 // Service that had captured db at construction would silently run outside the
 // transaction and outside the subtree. See groupio's package comment.
 func (ctx *MahresourcesContext) groupioDeps() groupio.Deps {
-	return groupio.Deps{DB: ctx.db, Scope: groupioScope{ctx: ctx}}
+	return groupio.Deps{DB: ctx.db, Scope: groupioScope{ctx: ctx}, Storage: groupioStorage{ctx: ctx}}
 }
 
 // EstimateExport walks the requested scope and returns counts without
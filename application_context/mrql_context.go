@@ -5,10 +5,8 @@ import (
 	"errors"
 	"fmt"
 	stdlog "log"
-	"math/rand/v2"
-	"sort"
+	"reflect"
 	"strings"
-	"sync"
 	"time"
 
 	"gorm.io/gorm"
@@ -207,21 +205,44 @@ type MRQLResult struct {
 	Resources  []models.Resource `json:"resources,omitempty"`
 	Notes      []models.Note     `json:"notes,omitempty"`
 	Groups     []models.Group    `json:"groups,omitempty"`
-	Warnings   []string          `json:"warnings,omitempty"`
+	// Items is the cross-entity result in its global order: one entry per row,
+	// in the order the shared ORDER BY produced, pointing into Resources, Notes,
+	// or Groups by entity type and ID. Those slices keep the same relative
+	// order but cannot show how the three types interleave. Empty for
+	// single-entity queries, whose one slice is already the ordered result.
+	Items    []MRQLItem `json:"items,omitempty"`
+	Warnings []string   `json:"warnings,omitempty"`
+	// NextCursor resumes the query after this page's last row (keyset
+	// pagination, see mrql.Cursor). Set only when the query runs in keyset
+	// mode and the page came back full; empty means there is nothing after it.
+	NextCursor string `json:"nextCursor,omitempty"`
 	// DefaultLimitApplied is true when the query had no explicit LIMIT clause
 	// and the server applied the configured default.
 	DefaultLimitApplied bool `json:"default_limit_applied"`
 	// AppliedLimit is the effective LIMIT that was applied — either the value
 	// parsed from the query or the configured default.
 	AppliedLimit int `json:"applied_limit,omitempty"`
+	// Materialized is set when the result was served from a materialized saved
+	// query's stored result rather than computed for this request.
+	Materialized *MRQLMaterializedInfo `json:"materialized,omitempty"`
+}
+
+// MRQLItem is one row of a cross-entity result: the fields every entity type
+// shares, enough to render a single mixed list.
+type MRQLItem struct {
+	EntityType string    `json:"entityType"` // "resource", "note", or "group"
+	ID         uint      `json:"id"`
+	Name       string    `json:"name"`
+	Created    time.Time `json:"created"`
+	Updated    time.Time `json:"updated"`
 }
 
 // MRQLGroupedResult holds the results of a GROUP BY MRQL query.
 type MRQLGroupedResult struct {
 	EntityType string `json:"entityType"`
-	Mode       string `json:"mode"` // "aggregated" or "bucketed"
-	// Columns is the aggregated result's column names in the order the query
-	// wrote them, and is empty for a bucketed result.
+	Mode       string `json:"mode"` // "aggregated", "projected" (SELECT) or "bucketed"
+	// Columns is the aggregated or projected result's column names in the
+	// order the query wrote them, and is empty for a bucketed result.
 	//
 	// Rows are JSON objects, and JavaScript does not promise a consumer the key
 	// order of an object — /mrql built its table header from
@@ -265,6 +286,9 @@ type MRQLGroupedResult struct {
 	// AppliedLimit is the effective LIMIT that was applied — either the value
 	// parsed from the query or the configured default.
 	AppliedLimit int `json:"applied_limit,omitempty"`
+	// Materialized is set when the result was served from a materialized saved
+	// query's stored result rather than computed for this request.
+	Materialized *MRQLMaterializedInfo `json:"materialized,omitempty"`
 }
 
 // MRQLBucket is a single group of entities in bucketed mode.
@@ -503,6 +527,10 @@ func (ctx *MahresourcesContext) executeSingleEntity(reqCtx context.Context, pars
 
 	result := &MRQLResult{EntityType: entityType.String()}
 
+	var (
+		rows int
+		last any
+	)
 	switch entityType {
 	case mrql.EntityResource:
 		var resources []models.Resource
@@ -510,23 +538,75 @@ func (ctx *MahresourcesContext) executeSingleEntity(reqCtx context.Context, pars
 			return nil, err
 		}
 		result.Resources = resources
+		if rows = len(resources); rows > 0 {
+			last = &resources[rows-1]
+		}
 	case mrql.EntityNote:
 		var notes []models.Note
 		if err := ctx.executeMRQLFind(db, &notes, parsed, "flat note select"); err != nil {
 			return nil, err
 		}
 		result.Notes = notes
+		if rows = len(notes); rows > 0 {
+			last = &notes[rows-1]
+		}
 	case mrql.EntityGroup:
 		var groups []models.Group
 		if err := ctx.executeMRQLFind(db, &groups, parsed, "flat group select"); err != nil {
 			return nil, err
 		}
 		result.Groups = groups
+		if rows = len(groups); rows > 0 {
+			last = &groups[rows-1]
+		}
 	}
 
+	if rows == parsed.Limit {
+		if err := ctx.setMRQLNextCursor(result, parsed, last); err != nil {
+			return nil, err
+		}
+	}
 	return result, nil
 }
 
+// setMRQLNextCursor fills result.NextCursor from last, the model behind a full
+// page's final row, when parsed runs in keyset mode. A page shorter than its
+// LIMIT is the end of the result, so callers only ask for a full one.
+// Cross-entity queries build theirs from the union row instead.
+func (ctx *MahresourcesContext) setMRQLNextCursor(result *MRQLResult, parsed *mrql.Query, last any) error {
+	if !parsed.Keyset || last == nil {
+		return nil
+	}
+	fields, err := mrql.KeysetFields(parsed)
+	if err != nil {
+		return err
+	}
+	stmt := &gorm.Statement{DB: ctx.db}
+	if err := stmt.Parse(last); err != nil {
+		return err
+	}
+	row := reflect.Indirect(reflect.ValueOf(last))
+	keys := make([]any, len(fields))
+	for i, fd := range fields {
+		field := stmt.Schema.LookUpField(fd.Column)
+		if field == nil {
+			return fmt.Errorf("cursor: no column %q on %s", fd.Column, stmt.Schema.Name)
+		}
+		keys[i], _ = field.ValueOf(context.Background(), row)
+	}
+	idField := stmt.Schema.LookUpField("id")
+	if idField == nil {
+		return fmt.Errorf("cursor: no id column on %s", stmt.Schema.Name)
+	}
+	id, _ := idField.ValueOf(context.Background(), row)
+	cursor, err := mrql.NewCursor(parsed, keys, "", id.(uint))
+	if err != nil {
+		return err
+	}
+	result.NextCursor = cursor.Encode()
+	return nil
+}
+
 // ExecuteMRQLGrouped executes a GROUP BY query under the interactive policy.
 func (ctx *MahresourcesContext) ExecuteMRQLGrouped(reqCtx context.Context, parsed *mrql.Query) (*MRQLGroupedResult, error) {
 	return ctx.executeMRQLGrouped(reqCtx, parsed, interactiveMRQLPolicy)
@@ -563,8 +643,8 @@ func (ctx *MahresourcesContext) executeMRQLGrouped(reqCtx context.Context, parse
 	}
 
 	var result *MRQLGroupedResult
-	if len(parsed.GroupBy.Aggregates) > 0 {
-		// Aggregated: Limit is standard row pagination — no clamping
+	if parsed.IsTabular() {
+		// Aggregated or projected: Limit is standard row pagination — no clamping
 		result, err = ctx.executeAggregatedQuery(queryCtx, parsed, opts)
 	} else {
 		// Bucketed: clamp per-bucket limit so no single bucket exceeds the item cap
@@ -581,14 +661,16 @@ func (ctx *MahresourcesContext) executeMRQLGrouped(reqCtx context.Context, parse
 	return result, nil
 }
 
+// executeAggregatedQuery runs a tabular query — an aggregated GROUP BY or a
+// SELECT projection — and returns its rows.
 func (ctx *MahresourcesContext) executeAggregatedQuery(reqCtx context.Context, parsed *mrql.Query, opts mrql.TranslateOptions) (*MRQLGroupedResult, error) {
 	db := ctx.db.WithContext(reqCtx)
-	built, err := mrql.BuildAggregatedGroupBy(parsed, db, opts)
+	built, mode, err := buildTabularMRQL(parsed, db, opts)
 	if err != nil {
 		return nil, err
 	}
 	var rows []map[string]any
-	if err := ctx.executeMRQLFind(built, &rows, parsed, "aggregated group select"); err != nil {
+	if err := ctx.executeMRQLFind(built, &rows, parsed, mode+" select"); err != nil {
 		return nil, err
 	}
 
@@ -599,12 +681,24 @@ func (ctx *MahresourcesContext) executeAggregatedQuery(reqCtx context.Context, p
 
 	return &MRQLGroupedResult{
 		EntityType: parsed.EntityType.String(),
-		Mode:       "aggregated",
+		Mode:       mode,
 		Columns:    mrql.AggregatedColumns(parsed),
 		Rows:       rows,
 	}, nil
 }
 
+// buildTabularMRQL composes a tabular query without executing it and returns
+// it with its result mode: "projected" for a SELECT, "aggregated" for an
+// aggregated GROUP BY.
+func buildTabularMRQL(parsed *mrql.Query, db *gorm.DB, opts mrql.TranslateOptions) (*gorm.DB, string, error) {
+	if parsed.Select != nil {
+		built, err := mrql.BuildProjection(parsed, db, opts)
+		return built, "projected", err
+	}
+	built, err := mrql.BuildAggregatedGroupBy(parsed, db, opts)
+	return built, "aggregated", err
+}
+
 func (ctx *MahresourcesContext) executeBucketedQuery(reqCtx context.Context, parsed *mrql.Query, opts mrql.TranslateOptions) (*MRQLGroupedResult, error) {
 	db := ctx.db.WithContext(reqCtx)
 
@@ -749,330 +843,148 @@ func (ctx *MahresourcesContext) executeBucketedQuery(reqCtx context.Context, par
 	}, nil
 }
 
-// crossEntityItem wraps any entity with its common sortable fields for global ordering.
-type crossEntityItem struct {
-	entityType string
-	name       string
-	created    time.Time
-	updated    time.Time
-	index      int // original index within its type slice
-	rand       int // random sort key for ORDER BY RANDOM() (unique via rand.Perm)
-}
-
-var crossEntityTypes = []mrql.EntityType{mrql.EntityResource, mrql.EntityNote, mrql.EntityGroup}
-
-func crossEntitySelectQuery(parsed *mrql.Query, entityType mrql.EntityType, perEntityCap int) mrql.Query {
-	branch := *parsed
-	branch.EntityType = entityType
-	branch.Limit = perEntityCap
-	branch.Offset = -1
-	return branch
-}
-
-// executeCrossEntity runs the query against resources, notes, and groups
-// concurrently, then globally sorts and paginates the merged result set.
-// Each entity query gets its own timeout so a slow table doesn't block the
-// others. If an entity times out, its results are omitted and a warning is
-// included in the response.
+// executeCrossEntity runs a query without a `type =` filter as one UNION ALL
+// statement over resources, notes, and groups (mrql.TranslateUnion), so the
+// shared ORDER BY and LIMIT/OFFSET are applied by the database across all three
+// tables. The union yields (entity type, ID) pairs; the typed models are then
+// loaded by ID and returned in the union's order, both in the per-type slices
+// and as the interleaved Items list.
 func (ctx *MahresourcesContext) executeCrossEntity(reqCtx context.Context, parsed *mrql.Query, opts mrql.TranslateOptions, policy mrqlExecutionPolicy) (*MRQLResult, error) {
-	// Up-front regex/dialect gate: this path swallows per-entity TranslateErrors
-	// (a non-resolvable entity is skipped), so a SQLite regex query without a
-	// `type =` filter would otherwise return silent empty results instead of a
-	// clear 400. Reject it here before fan-out. The per-comparison TranslateError
-	// in the translator remains as defense-in-depth for the determined-entity path.
+	// Up-front regex/dialect gate: the union leaves out branches that fail to
+	// translate, so a SQLite regex query without a `type =` filter would
+	// otherwise return silent empty results instead of a clear 400. The
+	// per-comparison TranslateError in the translator remains as
+	// defense-in-depth for the determined-entity path.
 	if err := ctx.rejectSQLiteRegex(parsed); err != nil {
 		return nil, err
 	}
 
-	result := &MRQLResult{EntityType: "all"}
-
-	globalLimit, globalOffset, perEntityCap, err := crossEntityWindow(parsed, ctx.defaultMRQLLimit(), policy)
+	limit, offset, err := crossEntityWindow(parsed, ctx.defaultMRQLLimit(), policy)
 	if err != nil {
 		return nil, err
 	}
+	window := *parsed
+	window.Limit = limit
+	window.Offset = offset
 
-	var (
-		allResources []models.Resource
-		allNotes     []models.Note
-		allGroups    []models.Group
-		mu           sync.Mutex
-		warnings     []string
-	)
-
-	var wg sync.WaitGroup
-	errs := make([]error, len(crossEntityTypes))
-
-	for i, et := range crossEntityTypes {
-		branch := crossEntitySelectQuery(parsed, et, perEntityCap)
-
-		// Each entity gets its own timeout derived from the request context.
-		entityCtx, cancel := context.WithTimeout(reqCtx, ctx.mrqlQueryTimeout())
+	queryCtx, cancel := context.WithTimeout(reqCtx, ctx.mrqlQueryTimeout())
+	defer cancel()
+	db := ctx.db.WithContext(queryCtx)
 
-		db, err := mrql.TranslateWithOptions(&branch, ctx.db.WithContext(entityCtx), opts)
+	union, warnings, err := mrql.TranslateUnion(&window, db, opts)
+	if err != nil {
+		return nil, err
+	}
+	var raw []map[string]any
+	if err := ctx.executeMRQLFind(union, &raw, &window, "cross-entity union select"); err != nil {
+		return nil, err
+	}
+	rows, err := mrql.UnionRowsFromMaps(&window, raw)
+	if err != nil {
+		return nil, err
+	}
+	result, err := ctx.loadCrossEntityRows(db, &window, rows)
+	if err != nil {
+		return nil, err
+	}
+	result.Warnings = append(result.Warnings, warnings...)
+	if window.Keyset && len(rows) == window.Limit && len(rows) > 0 {
+		// The cursor comes from the union's own last row: the model behind it
+		// may have been deleted before it was loaded, and its sort key is the
+		// value the union compared, not whatever the model holds now.
+		last := rows[len(rows)-1]
+		cursor, err := mrql.NewCursor(&window, last.Keys, last.EntityType, last.ID)
 		if err != nil {
-			cancel()
-			var translateErr *mrql.TranslateError
-			if errors.As(err, &translateErr) {
-				continue
-			}
 			return nil, err
 		}
-
-		wg.Add(1)
-		go func(idx int, et mrql.EntityType, cancel context.CancelFunc, db *gorm.DB, branch mrql.Query) {
-			defer wg.Done()
-			defer cancel()
-
-			switch et {
-			case mrql.EntityResource:
-				var resources []models.Resource
-				if err := ctx.executeMRQLFind(db, &resources, &branch, "cross-entity resource select"); err != nil {
-					errs[idx] = fmt.Errorf("resource query failed: %w", err)
-					return
-				}
-				mu.Lock()
-				allResources = resources
-				mu.Unlock()
-			case mrql.EntityNote:
-				var notes []models.Note
-				if err := ctx.executeMRQLFind(db, &notes, &branch, "cross-entity note select"); err != nil {
-					errs[idx] = fmt.Errorf("note query failed: %w", err)
-					return
-				}
-				mu.Lock()
-				allNotes = notes
-				mu.Unlock()
-			case mrql.EntityGroup:
-				var groups []models.Group
-				if err := ctx.executeMRQLFind(db, &groups, &branch, "cross-entity group select"); err != nil {
-					errs[idx] = fmt.Errorf("group query failed: %w", err)
-					return
-				}
-				mu.Lock()
-				allGroups = groups
-				mu.Unlock()
-			}
-		}(i, et, cancel, db, branch)
+		result.NextCursor = cursor.Encode()
 	}
+	return result, nil
+}
 
-	wg.Wait()
+// loadCrossEntityRows loads the models behind a cross-entity union result with
+// one query per entity type and assembles them in the union's order. A row
+// deleted between the two steps is dropped rather than reported as an error.
+// Under AS OF the models are loaded as they were then.
+func (ctx *MahresourcesContext) loadCrossEntityRows(db *gorm.DB, parsed *mrql.Query, rows []mrql.UnionRow) (*MRQLResult, error) {
+	db, err := mrql.ApplyAsOf(parsed, db)
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[string][]uint, len(mrql.UnionEntityTypes))
+	for _, row := range rows {
+		ids[row.EntityType] = append(ids[row.EntityType], row.ID)
+	}
 
-	// Collect timeout errors as warnings; return non-timeout errors as failures.
-	for _, err := range errs {
-		if err == nil {
-			continue
-		}
-		if errors.Is(err, context.DeadlineExceeded) {
-			warnings = append(warnings, err.Error())
-		} else {
+	var (
+		resources []models.Resource
+		notes     []models.Note
+		groups    []models.Group
+	)
+	if len(ids["resource"]) > 0 {
+		if err := ctx.executeMRQLFind(db.Where("id IN ?", ids["resource"]), &resources, parsed, "cross-entity resource load"); err != nil {
 			return nil, err
 		}
 	}
-	result.Warnings = warnings
-
-	// Build unified sortable items. When ORDER BY RANDOM() is the primary sort,
-	// select a population-proportional sample instead of merging every fetched
-	// row: the per-entity cap fetches at most globalOffset+globalLimit rows per
-	// type, so merging them all overrepresents rare entity types (99 notes + 1
-	// group would include the lone group ~91% of the time instead of ~1%). The
-	// downstream shuffle/offset/limit then run over the proportional sample.
-	// RANDOM() used only as a tiebreak (e.g. `ORDER BY created, RANDOM()`) keeps
-	// the plain merge — the leading field already fixes the global top-k.
-	var items []crossEntityItem
-	if len(parsed.OrderBy) > 0 && parsed.OrderBy[0].Random {
-		items = ctx.proportionalRandomItems(reqCtx, parsed, opts, allResources, allNotes, allGroups, perEntityCap, globalOffset+globalLimit)
-	} else {
-		items = make([]crossEntityItem, 0, len(allResources)+len(allNotes)+len(allGroups))
-		for i, r := range allResources {
-			items = append(items, crossEntityItem{entityType: "resource", name: r.Name, created: r.CreatedAt, updated: r.UpdatedAt, index: i})
-		}
-		for i, n := range allNotes {
-			items = append(items, crossEntityItem{entityType: "note", name: n.Name, created: n.CreatedAt, updated: n.UpdatedAt, index: i})
-		}
-		for i, g := range allGroups {
-			items = append(items, crossEntityItem{entityType: "group", name: g.Name, created: g.CreatedAt, updated: g.UpdatedAt, index: i})
+	if len(ids["note"]) > 0 {
+		if err := ctx.executeMRQLFind(db.Where("id IN ?", ids["note"]), &notes, parsed, "cross-entity note load"); err != nil {
+			return nil, err
 		}
 	}
-
-	// ORDER BY RANDOM() clauses (Field == nil) compare on a per-item random key.
-	// A permutation keeps the keys unique, so the comparator stays a strict
-	// order at the clause's position — `ORDER BY RANDOM()` is a global shuffle,
-	// `ORDER BY created, RANDOM()` a random tiebreak, matching SQL semantics.
-	for _, ob := range parsed.OrderBy {
-		if ob.Random {
-			for k, p := range rand.Perm(len(items)) {
-				items[k].rand = p
-			}
-			break
+	if len(ids["group"]) > 0 {
+		if err := ctx.executeMRQLFind(db.Where("id IN ?", ids["group"]), &groups, parsed, "cross-entity group load"); err != nil {
+			return nil, err
 		}
 	}
 
-	// Global sort if ORDER BY is specified
-	if len(parsed.OrderBy) > 0 {
-		sort.SliceStable(items, func(i, j int) bool {
-			for _, ob := range parsed.OrderBy {
-				if ob.Random {
-					// Unique keys: never a tie, no direction (parser enforces).
-					return items[i].rand < items[j].rand
-				}
-				fieldName := ob.Field.Name()
-				cmp := 0
-				switch fieldName {
-				case "name":
-					cmp = strings.Compare(strings.ToLower(items[i].name), strings.ToLower(items[j].name))
-				case "created":
-					if items[i].created.Before(items[j].created) {
-						cmp = -1
-					} else if items[i].created.After(items[j].created) {
-						cmp = 1
-					}
-				case "updated":
-					if items[i].updated.Before(items[j].updated) {
-						cmp = -1
-					} else if items[i].updated.After(items[j].updated) {
-						cmp = 1
-					}
-				default:
-					continue // unsortable field in cross-entity context
-				}
-				if cmp == 0 {
-					continue // tie, try next ORDER BY column
-				}
-				if !ob.Ascending {
-					cmp = -cmp
-				}
-				return cmp < 0
-			}
-			return false // all equal
-		})
+	resourceByID := make(map[uint]int, len(resources))
+	for i := range resources {
+		resourceByID[resources[i].ID] = i
 	}
-
-	// Apply global OFFSET
-	if globalOffset > 0 {
-		if globalOffset >= len(items) {
-			items = nil
-		} else {
-			items = items[globalOffset:]
-		}
+	noteByID := make(map[uint]int, len(notes))
+	for i := range notes {
+		noteByID[notes[i].ID] = i
 	}
-
-	// Apply global LIMIT
-	if len(items) > globalLimit {
-		items = items[:globalLimit]
+	groupByID := make(map[uint]int, len(groups))
+	for i := range groups {
+		groupByID[groups[i].ID] = i
 	}
 
-	// Split back into typed slices, preserving the global sort order
-	resourceIndices := make(map[int]bool)
-	noteIndices := make(map[int]bool)
-	groupIndices := make(map[int]bool)
-	for _, item := range items {
-		switch item.entityType {
-		case "resource":
-			resourceIndices[item.index] = true
-		case "note":
-			noteIndices[item.index] = true
-		case "group":
-			groupIndices[item.index] = true
-		}
+	result := &MRQLResult{
+		EntityType: "all",
+		Resources:  make([]models.Resource, 0, len(resources)),
+		Notes:      make([]models.Note, 0, len(notes)),
+		Groups:     make([]models.Group, 0, len(groups)),
+		Items:      make([]MRQLItem, 0, len(rows)),
 	}
-
-	// Rebuild slices preserving global order
-	result.Resources = make([]models.Resource, 0, len(resourceIndices))
-	result.Notes = make([]models.Note, 0, len(noteIndices))
-	result.Groups = make([]models.Group, 0, len(groupIndices))
-	for _, item := range items {
-		switch item.entityType {
+	for _, row := range rows {
+		switch row.EntityType {
 		case "resource":
-			result.Resources = append(result.Resources, allResources[item.index])
+			if i, ok := resourceByID[row.ID]; ok {
+				r := resources[i]
+				result.Resources = append(result.Resources, r)
+				result.Items = append(result.Items, MRQLItem{EntityType: row.EntityType, ID: r.ID, Name: r.Name, Created: r.CreatedAt, Updated: r.UpdatedAt})
+			}
 		case "note":
-			result.Notes = append(result.Notes, allNotes[item.index])
+			if i, ok := noteByID[row.ID]; ok {
+				n := notes[i]
+				result.Notes = append(result.Notes, n)
+				result.Items = append(result.Items, MRQLItem{EntityType: row.EntityType, ID: n.ID, Name: n.Name, Created: n.CreatedAt, Updated: n.UpdatedAt})
+			}
 		case "group":
-			result.Groups = append(result.Groups, allGroups[item.index])
-		}
-	}
-
-	return result, nil
-}
-
-// proportionalRandomItems selects up to k items across the three entity types
-// with probability proportional to each type's true (filtered) population, so a
-// cross-entity ORDER BY RANDOM() sample is not skewed toward small types by the
-// per-entity fetch cap. The returned items reference the first take[type] rows of
-// each slice (already DB-side randomized); the caller's shuffle/offset/limit run
-// over them. Selection is weighted-without-replacement over the populations,
-// capped by however many rows were actually fetched.
-func (ctx *MahresourcesContext) proportionalRandomItems(
-	reqCtx context.Context, parsed *mrql.Query, opts mrql.TranslateOptions,
-	resources []models.Resource, notes []models.Note, groups []models.Group,
-	perEntityCap, k int,
-) []crossEntityItem {
-	// A slice shorter than the cap means the whole (filtered) population was
-	// fetched, so its length is the true count. One at the cap may have more rows;
-	// count it so its weight reflects the real population.
-	trueCount := func(et mrql.EntityType, fetched int) int {
-		if fetched < perEntityCap {
-			return fetched
-		}
-		n, err := ctx.countCrossEntity(reqCtx, parsed, opts, et)
-		if err != nil || int(n) < fetched {
-			return fetched
-		}
-		return int(n)
-	}
-
-	order := []string{"resource", "note", "group"}
-	avail := map[string]int{"resource": len(resources), "note": len(notes), "group": len(groups)}
-	remaining := map[string]int{
-		"resource": trueCount(mrql.EntityResource, len(resources)),
-		"note":     trueCount(mrql.EntityNote, len(notes)),
-		"group":    trueCount(mrql.EntityGroup, len(groups)),
-	}
-	total := remaining["resource"] + remaining["note"] + remaining["group"]
-
-	take := map[string]int{}
-	for picks := 0; picks < k && total > 0; picks++ {
-		r := rand.IntN(total)
-		chosen := order[len(order)-1]
-		acc := 0
-		for _, e := range order {
-			acc += remaining[e]
-			if r < acc {
-				chosen = e
-				break
+			if i, ok := groupByID[row.ID]; ok {
+				g := groups[i]
+				result.Groups = append(result.Groups, g)
+				result.Items = append(result.Items, MRQLItem{EntityType: row.EntityType, ID: g.ID, Name: g.Name, Created: g.CreatedAt, Updated: g.UpdatedAt})
 			}
 		}
-		// Never draw more than we physically fetched for a type. If a capped type
-		// is exhausted, drop its remaining weight and redraw against the others.
-		if take[chosen] >= avail[chosen] {
-			total -= remaining[chosen]
-			remaining[chosen] = 0
-			picks--
-			continue
-		}
-		take[chosen]++
-		remaining[chosen]--
-		total--
-	}
-
-	items := make([]crossEntityItem, 0, take["resource"]+take["note"]+take["group"])
-	for i := 0; i < take["resource"]; i++ {
-		r := resources[i]
-		items = append(items, crossEntityItem{entityType: "resource", name: r.Name, created: r.CreatedAt, updated: r.UpdatedAt, index: i})
-	}
-	for i := 0; i < take["note"]; i++ {
-		n := notes[i]
-		items = append(items, crossEntityItem{entityType: "note", name: n.Name, created: n.CreatedAt, updated: n.UpdatedAt, index: i})
 	}
-	for i := 0; i < take["group"]; i++ {
-		g := groups[i]
-		items = append(items, crossEntityItem{entityType: "group", name: g.Name, created: g.CreatedAt, updated: g.UpdatedAt, index: i})
-	}
-	return items
+	return result, nil
 }
 
-// countCrossEntity counts the rows one entity type contributes to a cross-entity
-// query, applying the same WHERE/scope translation but no ORDER BY / LIMIT /
-// OFFSET, so proportionalRandomItems can weight by true population size.
+// countCrossEntity counts the rows one entity type contributes to a query,
+// applying the same WHERE/scope translation but no ORDER BY / LIMIT / OFFSET.
+// CountMRQLScoped sums it over the entity types for cross-entity totals.
 func (ctx *MahresourcesContext) countCrossEntity(reqCtx context.Context, parsed *mrql.Query, opts mrql.TranslateOptions, et mrql.EntityType) (int64, error) {
 	clone := *parsed
 	clone.EntityType = et
@@ -1148,20 +1060,6 @@ func explainDest(et mrql.EntityType) any {
 	return &[]map[string]any{}
 }
 
-// explainTableLabel returns the plural table label used for cross-entity
-// statement labels (resources/notes/groups).
-func explainTableLabel(et mrql.EntityType) string {
-	switch et {
-	case mrql.EntityResource:
-		return "resources"
-	case mrql.EntityNote:
-		return "notes"
-	case mrql.EntityGroup:
-		return "groups"
-	}
-	return et.String()
-}
-
 // ExplainMRQL builds generated SQL without contacting the database optimizer.
 func (ctx *MahresourcesContext) ExplainMRQL(reqCtx context.Context, parsed *mrql.Query) (*MRQLExplainResult, error) {
 	return ctx.ExplainMRQLWithOptions(reqCtx, parsed, MRQLExplainOptions{})
@@ -1216,18 +1114,24 @@ func (ctx *MahresourcesContext) ExplainMRQLWithOptions(reqCtx context.Context, p
 	db := workingCtx.db.WithContext(queryCtx)
 
 	switch {
-	case parsed.GroupBy != nil:
+	case parsed.IsGrouped():
 		if entityType == mrql.EntityUnspecified {
-			return nil, errors.New("GROUP BY requires an explicit entity type")
+			return nil, errors.New("GROUP BY and SELECT require an explicit entity type")
 		}
 		parsed.EntityType = entityType
-		if len(parsed.GroupBy.Aggregates) > 0 {
-			built, err := mrql.BuildAggregatedGroupBy(parsed, db, opts)
+		if parsed.IsTabular() {
+			built, mode, err := buildTabularMRQL(parsed, db, opts)
 			if err != nil {
 				return nil, err
 			}
-			result.Statements = append(result.Statements, mrql.ExplainDB(built, entityType.String(), &[]map[string]any{}))
-			result.ExecutionShape = fixedExecutionShape("aggregate", len(result.Statements))
+			statement := mrql.ExplainDB(built, entityType.String(), &[]map[string]any{})
+			strategy := "projection"
+			if mode == "aggregated" {
+				statement.Aggregates = mrql.ExplainAggregates(parsed, db)
+				strategy = "aggregate"
+			}
+			result.Statements = append(result.Statements, statement)
+			result.ExecutionShape = fixedExecutionShape(strategy, len(result.Statements))
 			break
 		}
 
@@ -1262,27 +1166,26 @@ func (ctx *MahresourcesContext) ExplainMRQLWithOptions(reqCtx context.Context, p
 		result.ExecutionShape = fixedExecutionShape("flat", len(result.Statements))
 
 	default:
-		_, _, perEntityCap, err := crossEntityWindow(parsed, ctx.defaultMRQLLimit(), interactiveMRQLPolicy)
+		limit, offset, err := crossEntityWindow(parsed, ctx.defaultMRQLLimit(), interactiveMRQLPolicy)
 		if err != nil {
 			return nil, err
 		}
-		for _, et := range crossEntityTypes {
-			branch := crossEntitySelectQuery(parsed, et, perEntityCap)
-			built, err := mrql.TranslateWithOptions(&branch, db, opts)
-			if err != nil {
-				var translateErr *mrql.TranslateError
-				if errors.As(err, &translateErr) {
-					continue
-				}
-				return nil, err
-			}
-			result.Statements = append(result.Statements, mrql.ExplainDB(built, explainTableLabel(et), explainDest(et)))
+		window := *parsed
+		window.Limit = limit
+		window.Offset = offset
+		built, warnings, err := mrql.TranslateUnion(&window, db, opts)
+		if err != nil {
+			return nil, err
 		}
-		result.ExecutionShape = fixedExecutionShape("cross_entity", len(result.Statements))
-		if len(parsed.OrderBy) > 0 && parsed.OrderBy[0].Random {
-			result.ExecutionShape.DataDependent = true
-			result.ExecutionShape.MaximumStatements += len(crossEntityTypes)
-			result.ExecutionShape.Description = "entity selects plus up to one population count per capped entity branch"
+		result.Warnings = append(result.Warnings, warnings...)
+		result.Statements = append(result.Statements, mrql.ExplainDB(built, "cross-entity union", &[]mrql.UnionRow{}))
+		result.ExecutionShape = MRQLExecutionShape{
+			Strategy:          "cross_entity",
+			PlannedStatements: 1,
+			MinimumStatements: 1,
+			MaximumStatements: 1 + len(mrql.UnionEntityTypes),
+			DataDependent:     true,
+			Description:       "one UNION ALL statement plus one model load per entity type present in the page",
 		}
 	}
 
@@ -1412,6 +1315,22 @@ func mrqlErrorPayload(err error) []map[string]any {
 	return []map[string]any{{"message": err.Error(), "pos": 0, "length": 0}}
 }
 
+// FormatMRQL returns queryStr — a query or a mutation statement — in the
+// canonical layout of mrql.Format, or the parse error with its position.
+func (ctx *MahresourcesContext) FormatMRQL(queryStr string) (string, []map[string]any) {
+	queryStr = strings.TrimSpace(queryStr)
+	if queryStr == "" {
+		return "", []map[string]any{
+			{"message": "query string must not be empty", "pos": 0, "length": 0},
+		}
+	}
+	formatted, err := mrql.Format(queryStr)
+	if err != nil {
+		return "", mrqlErrorPayload(err)
+	}
+	return formatted, nil
+}
+
 // CompleteMRQL returns autocompletion suggestions for the given MRQL query
 // string at the specified cursor position.
 func (ctx *MahresourcesContext) CompleteMRQL(queryStr string, cursor int) []mrql.Suggestion {
@@ -1558,6 +1477,12 @@ func (ctx *MahresourcesContext) UpdateSavedMRQLQuery(id uint, name, query, descr
 	if err := mrql.Validate(parsed); err != nil {
 		return nil, fmt.Errorf("invalid MRQL query: %w", err)
 	}
+	if saved.Materialized {
+		m := MRQLMaterializationSettings{Materialized: true, RefreshPolicy: saved.RefreshPolicy, RefreshIntervalSeconds: saved.RefreshIntervalSeconds}
+		if err := ValidateMRQLMaterialization(query, &m); err != nil {
+			return nil, err
+		}
+	}
 
 	saved.Name = name
 	saved.Query = query
@@ -1581,6 +1506,11 @@ func (ctx *MahresourcesContext) DeleteSavedMRQLQuery(id uint) error {
 	}
 
 	savedName := saved.Name
+	if saved.Materialized {
+		if err := ctx.db.Where("saved_query_id = ?", id).Delete(&models.MRQLMaterialization{}).Error; err != nil {
+			return err
+		}
+	}
 	err := ctx.db.Select(clause.Associations).Delete(&saved).Error
 	if err == nil {
 		ctx.Logger().Info(models.LogActionDelete, "mrql_query", &id, savedName, "Deleted saved MRQL query", nil)
@@ -1673,7 +1603,7 @@ func (ctx *MahresourcesContext) ExecuteMRQLGroupedWithScope(reqCtx context.Conte
 	}
 
 	var result *MRQLGroupedResult
-	if len(parsed.GroupBy.Aggregates) > 0 {
+	if parsed.IsTabular() {
 		result, err = ctx.executeAggregatedQueryScoped(queryCtx, parsed, scopeID)
 	} else {
 		if parsed.Limit > maxBucketedTotalItems {
@@ -1695,12 +1625,12 @@ func (ctx *MahresourcesContext) executeAggregatedQueryScoped(reqCtx context.Cont
 	db := ctx.db.WithContext(reqCtx)
 	opts := ctx.mrqlTranslateOptions()
 	opts.ScopeGroupID = scopeID
-	built, err := mrql.BuildAggregatedGroupBy(parsed, db, opts)
+	built, mode, err := buildTabularMRQL(parsed, db, opts)
 	if err != nil {
 		return nil, err
 	}
 	var rows []map[string]any
-	if err := ctx.executeMRQLFind(built, &rows, parsed, "scoped aggregated group select"); err != nil {
+	if err := ctx.executeMRQLFind(built, &rows, parsed, "scoped "+mode+" select"); err != nil {
 		return nil, err
 	}
 
@@ -1710,7 +1640,7 @@ func (ctx *MahresourcesContext) executeAggregatedQueryScoped(reqCtx context.Cont
 
 	return &MRQLGroupedResult{
 		EntityType: parsed.EntityType.String(),
-		Mode:       "aggregated",
+		Mode:       mode,
 		Columns:    mrql.AggregatedColumns(parsed),
 		Rows:       rows,
 	}, nil
@@ -0,0 +1,66 @@
+package application_context
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"mahresources/models"
+)
+
+// TestMRQLCrossEntityGlobalOrder pins the UNION ALL execution: one ORDER BY and
+// one LIMIT/OFFSET over all three tables, with Items recording the interleaving
+// that the per-type slices cannot.
+func TestMRQLCrossEntityGlobalOrder(t *testing.T) {
+	ctx := setupSharedCacheTestContext(t)
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	resource := &models.Resource{Name: "mix-resource", CreatedAt: base.Add(4 * time.Hour)}
+	note := &models.Note{Name: "mix-note", CreatedAt: base.Add(3 * time.Hour)}
+	group := &models.Group{Name: "mix-group", CreatedAt: base.Add(2 * time.Hour)}
+	older := &models.Note{Name: "mix-older-note", CreatedAt: base.Add(1 * time.Hour)}
+	for _, entity := range []any{resource, note, group, older} {
+		if err := ctx.db.Create(entity).Error; err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+
+	res, err := ctx.ExecuteMRQL(context.Background(), `name ~ "mix-" ORDER BY created DESC LIMIT 3 OFFSET 1`, 0, 0, nil)
+	if err != nil {
+		t.Fatalf("cross-entity query: %v", err)
+	}
+	if res.EntityType != "all" {
+		t.Fatalf("expected entityType all, got %q", res.EntityType)
+	}
+
+	var got []string
+	for _, item := range res.Items {
+		got = append(got, item.EntityType+":"+item.Name)
+	}
+	want := []string{"note:mix-note", "group:mix-group", "note:mix-older-note"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected items %v, got %v", want, got)
+	}
+	if len(res.Resources) != 0 || len(res.Notes) != 2 || len(res.Groups) != 1 {
+		t.Fatalf("expected 0 resources, 2 notes, 1 group; got %d/%d/%d", len(res.Resources), len(res.Notes), len(res.Groups))
+	}
+	if res.Notes[0].ID != note.ID || res.Notes[1].ID != older.ID {
+		t.Fatalf("per-type slice lost the global order: %+v", res.Notes)
+	}
+}
+
+// Single-entity results carry no Items: their one slice is the ordered result.
+func TestMRQLSingleEntityHasNoItems(t *testing.T) {
+	ctx := setupSharedCacheTestContext(t)
+	if err := ctx.db.Create(&models.Note{Name: "solo-note"}).Error; err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	res, err := ctx.ExecuteMRQL(context.Background(), `type = note AND name = "solo-note"`, 0, 0, nil)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(res.Notes) != 1 || len(res.Items) != 0 {
+		t.Fatalf("expected one note and no items, got %d notes, %d items", len(res.Notes), len(res.Items))
+	}
+}
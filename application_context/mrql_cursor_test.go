@@ -0,0 +1,146 @@
+package application_context
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"mahresources/models"
+	"mahresources/mrql"
+)
+
+// mrqlKeysetPages runs query page by page in keyset mode, following
+// NextCursor, and returns "type:name" per row. afterFirst runs once between
+// the first and second page.
+func mrqlKeysetPages(t *testing.T, ctx *MahresourcesContext, query string, limit int, afterFirst func()) []string {
+	t.Helper()
+	var (
+		got    []string
+		cursor string
+	)
+	for page := 0; page < 50; page++ {
+		parsed, err := mrql.Parse(query)
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		if err := mrql.Validate(parsed); err != nil {
+			t.Fatalf("validate: %v", err)
+		}
+		parsed.Keyset = true
+		if cursor != "" {
+			if parsed.After, err = mrql.DecodeCursor(cursor); err != nil {
+				t.Fatalf("decode cursor: %v", err)
+			}
+		}
+		res, err := ctx.ExecuteMRQLParsed(context.Background(), parsed, limit, 0)
+		if err != nil {
+			t.Fatalf("page %d: %v", page, err)
+		}
+		if len(res.Items) > 0 {
+			for _, item := range res.Items {
+				got = append(got, item.EntityType+":"+item.Name)
+			}
+		} else {
+			for _, n := range res.Notes {
+				got = append(got, "note:"+n.Name)
+			}
+		}
+		if page == 0 && afterFirst != nil {
+			afterFirst()
+		}
+		if res.NextCursor == "" {
+			return got
+		}
+		cursor = res.NextCursor
+	}
+	t.Fatalf("paging did not terminate: %v", got)
+	return nil
+}
+
+// Keyset pages cover every row exactly once even when rows are inserted ahead
+// of the cursor between pages, which would shift an OFFSET page by one.
+func TestMRQLKeysetPaginationSingleEntity(t *testing.T) {
+	ctx := setupSharedCacheTestContext(t)
+	base := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		// Two notes per timestamp, so pages split ties and need the ID.
+		note := &models.Note{Name: fmt.Sprintf("keyset-%d", i), CreatedAt: base.Add(time.Duration(i/2) * time.Hour)}
+		if err := ctx.db.Create(note).Error; err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+
+	got := mrqlKeysetPages(t, ctx, `type = note AND name ~ "keyset-" ORDER BY created DESC`, 2, func() {
+		if err := ctx.db.Create(&models.Note{Name: "keyset-new", CreatedAt: base.Add(24 * time.Hour)}).Error; err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+	})
+	want := []string{"note:keyset-4", "note:keyset-2", "note:keyset-3", "note:keyset-0", "note:keyset-1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestMRQLKeysetPaginationCrossEntity(t *testing.T) {
+	ctx := setupSharedCacheTestContext(t)
+	for _, entity := range []any{
+		&models.Resource{Name: "ks-b"},
+		&models.Note{Name: "ks-a"},
+		&models.Group{Name: "ks-c"},
+		&models.Note{Name: "ks-d"},
+		&models.Group{Name: "ks-b"},
+	} {
+		if err := ctx.db.Create(entity).Error; err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+
+	got := mrqlKeysetPages(t, ctx, `name ~ "ks-" ORDER BY name`, 2, nil)
+	want := []string{"note:ks-a", "group:ks-b", "resource:ks-b", "group:ks-c", "note:ks-d"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+// The cross-entity cursor carries the union's own sort values, including
+// datetimes SQLite returns as text through the UNION.
+func TestMRQLKeysetPaginationCrossEntityByCreated(t *testing.T) {
+	ctx := setupSharedCacheTestContext(t)
+	base := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	for _, entity := range []any{
+		&models.Note{Name: "ksc-1", CreatedAt: base},
+		&models.Group{Name: "ksc-2", CreatedAt: base.Add(time.Hour)},
+		&models.Resource{Name: "ksc-3", CreatedAt: base.Add(time.Hour)},
+		&models.Note{Name: "ksc-4", CreatedAt: base.Add(2 * time.Hour)},
+		&models.Group{Name: "ksc-5", CreatedAt: base.Add(3 * time.Hour)},
+	} {
+		if err := ctx.db.Create(entity).Error; err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+
+	got := mrqlKeysetPages(t, ctx, `name ~ "ksc-" ORDER BY created`, 2, nil)
+	want := []string{"note:ksc-1", "group:ksc-2", "resource:ksc-3", "note:ksc-4", "group:ksc-5"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+// Orders a cursor cannot resume from run as before and carry no cursor.
+func TestMRQLNoCursorForUnresumableOrder(t *testing.T) {
+	ctx := setupSharedCacheTestContext(t)
+	for i := 0; i < 3; i++ {
+		if err := ctx.db.Create(&models.Note{Name: fmt.Sprintf("rand-%d", i)}).Error; err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+	res, err := ctx.ExecuteMRQL(context.Background(), `type = note AND name ~ "rand-" ORDER BY RANDOM()`, 2, 0, nil)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(res.Notes) != 2 || res.NextCursor != "" {
+		t.Fatalf("expected two notes and no cursor, got %d notes, cursor %q", len(res.Notes), res.NextCursor)
+	}
+}
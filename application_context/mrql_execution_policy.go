@@ -48,23 +48,20 @@ func validateMRQLExecutionBounds(q *mrql.Query, policy mrqlExecutionPolicy) erro
 	return nil
 }
 
-// crossEntityWindow returns the global pagination window and the per-entity
-// fetch cap used before results are merged and globally paginated in Go.
-func crossEntityWindow(q *mrql.Query, defaultLimit int, policy mrqlExecutionPolicy) (globalLimit, globalOffset, perEntityCap int, err error) {
+// crossEntityWindow returns the LIMIT and OFFSET a cross-entity query applies
+// to its single UNION ALL statement.
+func crossEntityWindow(q *mrql.Query, defaultLimit int, policy mrqlExecutionPolicy) (limit, offset int, err error) {
 	if err = validateMRQLExecutionBounds(q, policy); err != nil {
-		return 0, 0, 0, err
+		return 0, 0, err
 	}
-	globalLimit = min(defaultLimit, policy.maxLimit)
+	limit = min(defaultLimit, policy.maxLimit)
 	if q.Limit >= 0 {
-		globalLimit = q.Limit
+		limit = q.Limit
 	}
 	if q.Offset >= 0 {
-		globalOffset = q.Offset
+		offset = q.Offset
 	}
-	if globalOffset > math.MaxInt-globalLimit {
-		return 0, 0, 0, &MRQLExecutionLimitError{Field: "offset + limit", Value: math.MaxInt, Max: policy.maxOffset + policy.maxLimit}
-	}
-	return globalLimit, globalOffset, globalOffset + globalLimit, nil
+	return limit, offset, nil
 }
 
 // ValidateMRQLFlatExportBounds validates export pagination without executing the
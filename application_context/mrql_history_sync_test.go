@@ -0,0 +1,27 @@
+package application_context
+
+import (
+	"slices"
+	"testing"
+
+	"mahresources/models"
+	"mahresources/mrql"
+)
+
+// The mrql package must not import models, so the tables AS OF reconstructs
+// are mirrored as mrql.HistoryTables. This test keeps the two lists in sync:
+// a table recorded but not shadowed reads current state under AS OF, and one
+// shadowed but not recorded has no history table to read.
+func TestHistoryTablesMatchModels(t *testing.T) {
+	if len(mrql.HistoryTables) != len(models.HistoryTables) {
+		t.Fatalf("mrql.HistoryTables has %d tables, models.HistoryTables %d; update the mrql list",
+			len(mrql.HistoryTables), len(models.HistoryTables))
+	}
+	for i, want := range models.HistoryTables {
+		got := mrql.HistoryTables[i]
+		if got.Name != want.Name || !slices.Equal(got.Key, want.Key) {
+			t.Errorf("mrql.HistoryTables[%d] = %s %v, models.HistoryTables[%d] = %s %v; update the mrql list",
+				i, got.Name, got.Key, i, want.Name, want.Key)
+		}
+	}
+}
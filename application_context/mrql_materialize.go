@@ -0,0 +1,613 @@
+package application_context
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"mahresources/models"
+	"mahresources/models/types"
+	"mahresources/mrql"
+)
+
+// Materialized saved queries.
+//
+// A saved query behind a dashboard or an [mrql saved="..."] shortcode used to
+// run on every render, and every run was charged to the page's query budget.
+// Marking it materialized stores its result in mrql_materializations and serves
+// that instead, recomputing it when its refresh policy says it is out of date:
+// after an interval, or after a write to an entity kind the query reads.
+//
+// The stored result is computed without a principal scope, so it is only ever
+// served to callers that would see the same rows: a group-limited principal
+// runs the query live, as before.
+
+// minMRQLRefreshInterval is the shortest interval policy accepted. A shorter one
+// would have the refresher recomputing the result more often than anyone reads it.
+const minMRQLRefreshInterval = 60
+
+// DefaultMRQLMaterializeTick is how often the background refresher looks for
+// materialized queries that are out of date.
+const DefaultMRQLMaterializeTick = time.Minute
+
+// ErrMRQLMaterializeScoped refuses a refresh to a group-limited principal. The
+// stored result is shared by every unscoped reader, so it must not be computed
+// under one principal's subtree.
+var ErrMRQLMaterializeScoped = errors.New("not available to a group-limited principal: materialized results are computed across all groups")
+
+// ErrMRQLNotMaterialized answers a refresh of a saved query that is not
+// materialized.
+var ErrMRQLNotMaterialized = errors.New("this saved MRQL query is not materialized")
+
+// MRQLMaterializationSettings is the materialization half of a saved query's
+// definition, as the create/update surfaces accept it.
+type MRQLMaterializationSettings struct {
+	Materialized bool
+	// RefreshPolicy is models.MRQLRefreshInterval or models.MRQLRefreshOnWrite;
+	// empty means on_write.
+	RefreshPolicy string
+	// RefreshIntervalSeconds is required by the interval policy and ignored by
+	// on_write.
+	RefreshIntervalSeconds int
+}
+
+// MRQLMaterializedInfo is the staleness metadata attached to a result served
+// from a materialization.
+type MRQLMaterializedInfo struct {
+	RefreshedAt            time.Time `json:"refreshedAt"`
+	AgeSeconds             int64     `json:"ageSeconds"`
+	RefreshPolicy          string    `json:"refreshPolicy"`
+	RefreshIntervalSeconds int       `json:"refreshIntervalSeconds,omitempty"`
+	// Stale is true when the policy called for a refresh and the refresh
+	// failed, so the previous result was served instead.
+	Stale bool `json:"stale"`
+	// DurationMs is how long the last refresh took to compute.
+	DurationMs int64 `json:"durationMs"`
+	// Total is the number of rows the flat query matched at refresh time,
+	// ignoring LIMIT. Absent for GROUP BY results.
+	Total *int64 `json:"total,omitempty"`
+}
+
+// mrqlMaterializedPayload is what MRQLMaterialization.Result holds.
+type mrqlMaterializedPayload struct {
+	Kind                string                `json:"kind"` // "flat" or "grouped"
+	EntityType          string                `json:"entityType,omitempty"`
+	Rows                []mrqlMaterializedRow `json:"rows,omitempty"`
+	Total               int64                 `json:"total"`
+	Warnings            []string              `json:"warnings,omitempty"`
+	DefaultLimitApplied bool                  `json:"defaultLimitApplied"`
+	AppliedLimit        int                   `json:"appliedLimit"`
+	Grouped             *MRQLGroupedResult    `json:"grouped,omitempty"`
+}
+
+// mrqlMaterializedRow is one row of a stored flat result.
+type mrqlMaterializedRow struct {
+	EntityType string `json:"entityType"`
+	ID         uint   `json:"id"`
+}
+
+// mrqlMaterializeState is shared by every copy of a context (a pointer, like
+// rootAdmin): when each entity kind was last written, and the lock that keeps
+// two readers from recomputing the same result at once.
+type mrqlMaterializeState struct {
+	mu      sync.Mutex
+	started time.Time
+	writes  map[string]time.Time
+
+	refreshMu sync.Mutex
+}
+
+func newMRQLMaterializeState() *mrqlMaterializeState {
+	return &mrqlMaterializeState{started: time.Now(), writes: map[string]time.Time{}}
+}
+
+func (s *mrqlMaterializeState) touch(kinds []string) {
+	now := time.Now()
+	s.mu.Lock()
+	for _, kind := range kinds {
+		s.writes[kind] = now
+	}
+	s.mu.Unlock()
+}
+
+// lastWrite returns the most recent write to any of kinds. Writes are only
+// seen by the process that made them, so before the first one it answers the
+// process start: a result refreshed by an earlier run is refreshed once more.
+func (s *mrqlMaterializeState) lastWrite(kinds []string) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	last := s.started
+	for _, kind := range kinds {
+		if t, ok := s.writes[kind]; ok && t.After(last) {
+			last = t
+		}
+	}
+	return last
+}
+
+// mrqlWriteKinds maps a written table to the entity kinds (mrql.Touched*) whose
+// query results the write can change. Junction tables change both sides.
+var mrqlWriteKinds = map[string][]string{
+	"resources":                {mrql.TouchedResource},
+	"resource_versions":        {mrql.TouchedResource},
+	"resource_categories":      {mrql.TouchedResource},
+	"series":                   {mrql.TouchedResource},
+	"image_hashes":             {mrql.TouchedResource},
+	"resource_similarities":    {mrql.TouchedResource},
+	"resource_tags":            {mrql.TouchedResource, mrql.TouchedTag},
+	"resource_notes":           {mrql.TouchedResource, mrql.TouchedNote},
+	"notes":                    {mrql.TouchedNote},
+	"note_blocks":              {mrql.TouchedNote},
+	"note_types":               {mrql.TouchedNote},
+	"note_tags":                {mrql.TouchedNote, mrql.TouchedTag},
+	"groups":                   {mrql.TouchedGroup},
+	"categories":               {mrql.TouchedGroup},
+	"group_relations":          {mrql.TouchedGroup},
+	"group_relation_types":     {mrql.TouchedGroup},
+	"group_related_groups":     {mrql.TouchedGroup},
+	"group_tags":               {mrql.TouchedGroup, mrql.TouchedTag},
+	"groups_related_notes":     {mrql.TouchedGroup, mrql.TouchedNote},
+	"groups_related_resources": {mrql.TouchedGroup, mrql.TouchedResource},
+	"tags":                     {mrql.TouchedTag},
+}
+
+// rawWriteTable finds the tables a raw statement writes to.
+var rawWriteTable = regexp.MustCompile(`(?i)\b(?:INSERT\s+(?:OR\s+\w+\s+)?INTO|UPDATE|DELETE\s+FROM)\s+["` + "`" + `]?(\w+)`)
+
+// registerMRQLWriteCallbacks records, per entity kind, when it was last
+// written, for the on_write refresh policy. Raw statements are matched by
+// their text, since they carry no schema.
+func registerMRQLWriteCallbacks(ctx *MahresourcesContext) {
+	state := ctx.mrqlMaterialize
+	record := func(db *gorm.DB) {
+		if db.Error != nil || db.RowsAffected == 0 {
+			return
+		}
+		state.touch(mrqlWriteKinds[statementTable(db)])
+	}
+	recordRaw := func(db *gorm.DB) {
+		if db.Error != nil || db.Statement == nil {
+			return
+		}
+		for _, m := range rawWriteTable.FindAllStringSubmatch(db.Statement.SQL.String(), -1) {
+			state.touch(mrqlWriteKinds[strings.ToLower(m[1])])
+		}
+	}
+	_ = ctx.db.Callback().Create().After("gorm:create").Register("mahresources:mrql_write_create", record)
+	_ = ctx.db.Callback().Update().After("gorm:update").Register("mahresources:mrql_write_update", record)
+	_ = ctx.db.Callback().Delete().After("gorm:delete").Register("mahresources:mrql_write_delete", record)
+	_ = ctx.db.Callback().Raw().After("gorm:raw").Register("mahresources:mrql_write_raw", recordRaw)
+}
+
+// ValidateMRQLMaterialization checks that query can be materialized under m,
+// normalising an empty policy to on_write. A query taking $parameters has no
+// single result to store, and a bucketed GROUP BY is paged by the caller.
+func ValidateMRQLMaterialization(query string, m *MRQLMaterializationSettings) error {
+	if !m.Materialized {
+		m.RefreshPolicy, m.RefreshIntervalSeconds = "", 0
+		return nil
+	}
+	switch m.RefreshPolicy {
+	case "", models.MRQLRefreshOnWrite:
+		m.RefreshPolicy, m.RefreshIntervalSeconds = models.MRQLRefreshOnWrite, 0
+	case models.MRQLRefreshInterval:
+		if m.RefreshIntervalSeconds < minMRQLRefreshInterval {
+			return fmt.Errorf("refresh interval must be at least %d seconds", minMRQLRefreshInterval)
+		}
+	default:
+		return fmt.Errorf("refresh policy must be %q or %q", models.MRQLRefreshInterval, models.MRQLRefreshOnWrite)
+	}
+
+	parsed, err := mrql.Parse(strings.TrimSpace(query))
+	if err != nil {
+		return fmt.Errorf("invalid MRQL syntax: %w", err)
+	}
+	if len(mrql.ListParams(parsed)) > 0 {
+		return errors.New("a query with $parameters cannot be materialized")
+	}
+	if parsed.GroupBy != nil && len(parsed.GroupBy.Aggregates) == 0 {
+		return errors.New("a bucketed GROUP BY cannot be materialized")
+	}
+	return nil
+}
+
+// SetSavedMRQLQueryMaterialization turns materialization on or off for a saved
+// query and sets its refresh policy. Turning it off drops the stored result.
+func (ctx *MahresourcesContext) SetSavedMRQLQueryMaterialization(id uint, m MRQLMaterializationSettings) (*models.SavedMRQLQuery, error) {
+	var saved models.SavedMRQLQuery
+	if err := ctx.db.First(&saved, id).Error; err != nil {
+		return nil, err
+	}
+	if err := ValidateMRQLMaterialization(saved.Query, &m); err != nil {
+		return nil, err
+	}
+
+	err := ctx.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&saved).Select("Materialized", "RefreshPolicy", "RefreshIntervalSeconds").Updates(models.SavedMRQLQuery{
+			Materialized:           m.Materialized,
+			RefreshPolicy:          m.RefreshPolicy,
+			RefreshIntervalSeconds: m.RefreshIntervalSeconds,
+		}).Error; err != nil {
+			return err
+		}
+		if !m.Materialized {
+			return tx.Where("saved_query_id = ?", id).Delete(&models.MRQLMaterialization{}).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	saved.Materialized, saved.RefreshPolicy, saved.RefreshIntervalSeconds = m.Materialized, m.RefreshPolicy, m.RefreshIntervalSeconds
+
+	ctx.Logger().Info(models.LogActionUpdate, "mrql_query", &saved.ID, saved.Name, "Updated saved MRQL query materialization", map[string]interface{}{
+		"materialized":  m.Materialized,
+		"refreshPolicy": m.RefreshPolicy,
+	})
+	return &saved, nil
+}
+
+// RefreshSavedMRQLQuery recomputes a materialized saved query's stored result
+// now, whatever its policy says.
+func (ctx *MahresourcesContext) RefreshSavedMRQLQuery(reqCtx context.Context, id uint) (*MRQLMaterializedInfo, error) {
+	if _, forced, deny := ctx.principalForcedScope(); forced || deny {
+		return nil, ErrMRQLMaterializeScoped
+	}
+	saved, err := ctx.GetSavedMRQLQuery(id)
+	if err != nil {
+		return nil, err
+	}
+	if !saved.Materialized {
+		return nil, ErrMRQLNotMaterialized
+	}
+	ctx.mrqlMaterialize.refreshMu.Lock()
+	defer ctx.mrqlMaterialize.refreshMu.Unlock()
+	row, err := ctx.refreshMRQLMaterialization(reqCtx, saved)
+	if err != nil {
+		return nil, err
+	}
+	return ctx.materializedInfo(saved, row, false), nil
+}
+
+// MaterializedMRQLResult serves a materialized saved query from its stored
+// result, refreshing it first when the refresh policy calls for it. Exactly one
+// of the two results is set when ok is true.
+//
+// limit trims the stored result (0 keeps all of it). ok is false — run the
+// query live — when the query is not materialized, the caller is
+// group-limited, or the stored result was cut off short of limit rows. A failed
+// refresh serves the previous result marked stale, or returns the error when
+// there is none.
+func (ctx *MahresourcesContext) MaterializedMRQLResult(reqCtx context.Context, saved *models.SavedMRQLQuery, limit int) (flat *MRQLResult, grouped *MRQLGroupedResult, ok bool, err error) {
+	if !saved.Materialized {
+		return nil, nil, false, nil
+	}
+	if _, forced, deny := ctx.principalForcedScope(); forced || deny {
+		return nil, nil, false, nil
+	}
+
+	row, err := ctx.currentMRQLMaterialization(reqCtx, saved)
+	stale := false
+	if err != nil {
+		if row == nil {
+			return nil, nil, false, err
+		}
+		log.Printf("warning: refreshing materialized MRQL query %q failed, serving the previous result: %v", saved.Name, err)
+		stale = true
+	}
+
+	var payload mrqlMaterializedPayload
+	dec := json.NewDecoder(bytes.NewReader(row.Result))
+	dec.UseNumber()
+	if err := dec.Decode(&payload); err != nil {
+		return nil, nil, false, fmt.Errorf("reading materialized result: %w", err)
+	}
+	info := ctx.materializedInfo(saved, row, stale)
+	var warning string
+	if stale {
+		warning = fmt.Sprintf("This result was computed %s ago; refreshing it failed: %v", time.Duration(info.AgeSeconds)*time.Second, err)
+	}
+
+	if payload.Kind == "grouped" {
+		grouped = payload.Grouped
+		if limit > 0 && limit < len(grouped.Rows) {
+			grouped.Rows = grouped.Rows[:limit]
+		} else if limit > grouped.AppliedLimit && len(grouped.Rows) == grouped.AppliedLimit {
+			return nil, nil, false, nil
+		}
+		grouped.Materialized = info
+		if warning != "" {
+			grouped.Warnings = append(grouped.Warnings, warning)
+		}
+		return nil, grouped, true, nil
+	}
+
+	rows := make([]mrql.UnionRow, len(payload.Rows))
+	for i, r := range payload.Rows {
+		rows[i] = mrql.UnionRow{EntityType: r.EntityType, ID: r.ID}
+	}
+	if limit > 0 && limit < len(rows) {
+		rows = rows[:limit]
+	} else if limit > payload.AppliedLimit && len(rows) == payload.AppliedLimit {
+		return nil, nil, false, nil
+	}
+	// The text the rows came from, which a stale row no longer shares with saved.
+	parsed, err := mrql.Parse(row.Query)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	queryCtx, cancel := context.WithTimeout(reqCtx, ctx.mrqlQueryTimeout())
+	defer cancel()
+	flat, err = ctx.loadCrossEntityRows(ctx.db.WithContext(queryCtx), parsed, rows)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if payload.EntityType != "all" {
+		flat.EntityType = payload.EntityType
+		flat.Items = nil
+	}
+	flat.Warnings = append(flat.Warnings, payload.Warnings...)
+	if warning != "" {
+		flat.Warnings = append(flat.Warnings, warning)
+	}
+	flat.DefaultLimitApplied = payload.DefaultLimitApplied
+	flat.AppliedLimit = payload.AppliedLimit
+	flat.Materialized = info
+	return flat, nil, true, nil
+}
+
+// currentMRQLMaterialization returns saved's stored result, refreshing it first
+// when it is missing or out of date. On a failed refresh it returns the error
+// together with the previous row, if there is one.
+func (ctx *MahresourcesContext) currentMRQLMaterialization(reqCtx context.Context, saved *models.SavedMRQLQuery) (*models.MRQLMaterialization, error) {
+	row, err := ctx.storedMRQLMaterialization(saved.ID)
+	if err != nil {
+		return nil, err
+	}
+	if row != nil && !ctx.mrqlMaterializationDue(saved, row, time.Now()) {
+		return row, nil
+	}
+
+	ctx.mrqlMaterialize.refreshMu.Lock()
+	defer ctx.mrqlMaterialize.refreshMu.Unlock()
+	// Another reader may have refreshed it while this one waited.
+	if row, err = ctx.storedMRQLMaterialization(saved.ID); err != nil {
+		return nil, err
+	}
+	if row != nil && !ctx.mrqlMaterializationDue(saved, row, time.Now()) {
+		return row, nil
+	}
+	fresh, err := ctx.refreshMRQLMaterialization(reqCtx, saved)
+	if err != nil {
+		return row, err
+	}
+	return fresh, nil
+}
+
+func (ctx *MahresourcesContext) storedMRQLMaterialization(savedID uint) (*models.MRQLMaterialization, error) {
+	var rows []models.MRQLMaterialization
+	if err := ctx.db.Where("saved_query_id = ?", savedID).Limit(1).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &rows[0], nil
+}
+
+// mrqlMaterializationDue reports whether saved's refresh policy calls for
+// recomputing row at now.
+func (ctx *MahresourcesContext) mrqlMaterializationDue(saved *models.SavedMRQLQuery, row *models.MRQLMaterialization, now time.Time) bool {
+	if row.Query != saved.Query {
+		return true
+	}
+	switch saved.RefreshPolicy {
+	case models.MRQLRefreshInterval:
+		return now.Sub(row.RefreshedAt) >= time.Duration(saved.RefreshIntervalSeconds)*time.Second
+	default:
+		parsed, err := mrql.Parse(saved.Query)
+		if err != nil {
+			return true
+		}
+		if err := mrql.Validate(parsed); err != nil {
+			return true
+		}
+		return ctx.mrqlMaterialize.lastWrite(mrql.TouchedEntities(parsed)).After(row.RefreshedAt)
+	}
+}
+
+// refreshMRQLMaterialization runs saved's query and stores the result. The
+// caller holds refreshMu. RefreshedAt is taken before the query runs, so a
+// write that lands while it runs leaves the result due again.
+func (ctx *MahresourcesContext) refreshMRQLMaterialization(reqCtx context.Context, saved *models.SavedMRQLQuery) (*models.MRQLMaterialization, error) {
+	started := time.Now()
+	parsed, err := mrql.Parse(saved.Query)
+	if err != nil {
+		return nil, fmt.Errorf("saved query is no longer valid: %w", err)
+	}
+	if err := mrql.Validate(parsed); err != nil {
+		return nil, fmt.Errorf("saved query is no longer valid: %w", err)
+	}
+
+	var payload mrqlMaterializedPayload
+	if parsed.IsGrouped() {
+		if !parsed.IsTabular() {
+			return nil, errors.New("a bucketed GROUP BY cannot be materialized")
+		}
+		parsed.EntityType = mrql.ExtractEntityType(parsed)
+		grouped, err := ctx.ExecuteMRQLGrouped(reqCtx, parsed)
+		if err != nil {
+			return nil, err
+		}
+		payload = mrqlMaterializedPayload{Kind: "grouped", Grouped: grouped}
+	} else {
+		result, err := ctx.ExecuteMRQLParsed(reqCtx, parsed, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		var scopeID uint
+		if parsed.Scope != nil {
+			if scopeID, err = ctx.ResolveMRQLScope(parsed); err != nil {
+				return nil, err
+			}
+		}
+		total, err := ctx.CountMRQLScoped(reqCtx, parsed, scopeID)
+		if err != nil {
+			return nil, err
+		}
+		payload = mrqlMaterializedPayload{
+			Kind:                "flat",
+			EntityType:          result.EntityType,
+			Rows:                mrqlResultRows(result),
+			Total:               total,
+			Warnings:            result.Warnings,
+			DefaultLimitApplied: result.DefaultLimitApplied,
+			AppliedLimit:        result.AppliedLimit,
+		}
+	}
+
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	row := models.MRQLMaterialization{
+		SavedQueryID: saved.ID,
+		Query:        saved.Query,
+		Result:       types.JSON(encoded),
+		RefreshedAt:  started,
+		DurationMs:   time.Since(started).Milliseconds(),
+	}
+	if err := ctx.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "saved_query_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"query", "result", "refreshed_at", "duration_ms"}),
+	}).Create(&row).Error; err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+// mrqlResultRows lists a flat result's rows as (entity type, ID) pairs in the
+// result's order.
+func mrqlResultRows(result *MRQLResult) []mrqlMaterializedRow {
+	if len(result.Items) > 0 {
+		rows := make([]mrqlMaterializedRow, len(result.Items))
+		for i, item := range result.Items {
+			rows[i] = mrqlMaterializedRow{EntityType: item.EntityType, ID: item.ID}
+		}
+		return rows
+	}
+	rows := make([]mrqlMaterializedRow, 0, len(result.Resources)+len(result.Notes)+len(result.Groups))
+	for _, r := range result.Resources {
+		rows = append(rows, mrqlMaterializedRow{EntityType: "resource", ID: r.ID})
+	}
+	for _, n := range result.Notes {
+		rows = append(rows, mrqlMaterializedRow{EntityType: "note", ID: n.ID})
+	}
+	for _, g := range result.Groups {
+		rows = append(rows, mrqlMaterializedRow{EntityType: "group", ID: g.ID})
+	}
+	return rows
+}
+
+func (ctx *MahresourcesContext) materializedInfo(saved *models.SavedMRQLQuery, row *models.MRQLMaterialization, stale bool) *MRQLMaterializedInfo {
+	info := &MRQLMaterializedInfo{
+		RefreshedAt:            row.RefreshedAt,
+		AgeSeconds:             int64(time.Since(row.RefreshedAt) / time.Second),
+		RefreshPolicy:          saved.RefreshPolicy,
+		RefreshIntervalSeconds: saved.RefreshIntervalSeconds,
+		Stale:                  stale,
+		DurationMs:             row.DurationMs,
+	}
+	var payload struct {
+		Kind  string `json:"kind"`
+		Total int64  `json:"total"`
+	}
+	if json.Unmarshal(row.Result, &payload) == nil && payload.Kind == "flat" {
+		info.Total = &payload.Total
+	}
+	return info
+}
+
+// MRQLMaterializer recomputes out-of-date materialized queries in the
+// background, so a reader rarely has to wait for one. Readers still refresh a
+// due result themselves; this only makes that the exception.
+type MRQLMaterializer struct {
+	ctx      *MahresourcesContext
+	interval time.Duration
+	done     chan struct{}
+	stopOnce sync.Once
+	running  sync.WaitGroup
+}
+
+func NewMRQLMaterializer(ctx *MahresourcesContext, interval time.Duration) *MRQLMaterializer {
+	if interval <= 0 {
+		interval = DefaultMRQLMaterializeTick
+	}
+	return &MRQLMaterializer{ctx: ctx, interval: interval, done: make(chan struct{})}
+}
+
+// Start begins ticking. It returns immediately.
+func (m *MRQLMaterializer) Start() {
+	m.running.Add(1)
+	go func() {
+		defer m.running.Done()
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.Tick(time.Now())
+			case <-m.done:
+				return
+			}
+		}
+	}()
+}
+
+// Stop halts the ticker and waits for a tick in progress to finish.
+func (m *MRQLMaterializer) Stop() {
+	m.stopOnce.Do(func() { close(m.done) })
+	m.running.Wait()
+}
+
+// Tick refreshes every materialized query that is due at now. Exported so a
+// test can drive it without waiting on a wall clock.
+func (m *MRQLMaterializer) Tick(now time.Time) {
+	var saved []models.SavedMRQLQuery
+	if err := m.ctx.db.Where("materialized = ?", true).Order("id").Find(&saved).Error; err != nil {
+		log.Printf("warning: MRQL materializer could not list materialized queries: %v", err)
+		return
+	}
+	for i := range saved {
+		select {
+		case <-m.done:
+			return
+		default:
+		}
+		q := &saved[i]
+		row, err := m.ctx.storedMRQLMaterialization(q.ID)
+		if err != nil {
+			log.Printf("warning: MRQL materializer could not read %q: %v", q.Name, err)
+			continue
+		}
+		if row != nil && !m.ctx.mrqlMaterializationDue(q, row, now) {
+			continue
+		}
+		m.ctx.mrqlMaterialize.refreshMu.Lock()
+		_, err = m.ctx.refreshMRQLMaterialization(context.Background(), q)
+		m.ctx.mrqlMaterialize.refreshMu.Unlock()
+		if err != nil {
+			log.Printf("warning: MRQL materializer could not refresh %q: %v", q.Name, err)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package application_context
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"mahresources/auth"
+	"mahresources/models"
+)
+
+func setupMaterializeTestContext(t *testing.T) *MahresourcesContext {
+	t.Helper()
+	ctx := setupSharedCacheTestContext(t)
+	if err := ctx.db.AutoMigrate(&models.SavedMRQLQuery{}, &models.MRQLMaterialization{}); err != nil {
+		t.Fatalf("Failed to migrate saved queries: %v", err)
+	}
+	return ctx
+}
+
+func materializedQuery(t *testing.T, ctx *MahresourcesContext, name, query string, m MRQLMaterializationSettings) *models.SavedMRQLQuery {
+	t.Helper()
+	saved, err := ctx.CreateSavedMRQLQuery(name, query, "")
+	if err != nil {
+		t.Fatalf("save query: %v", err)
+	}
+	if saved, err = ctx.SetSavedMRQLQueryMaterialization(saved.ID, m); err != nil {
+		t.Fatalf("materialize query: %v", err)
+	}
+	return saved
+}
+
+func seedMaterializeNotes(t *testing.T, ctx *MahresourcesContext, prefix string, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := ctx.db.Create(&models.Note{Name: fmt.Sprintf("%s-%d", prefix, i)}).Error; err != nil {
+			t.Fatalf("seed note: %v", err)
+		}
+	}
+}
+
+func servedMaterialized(t *testing.T, ctx *MahresourcesContext, saved *models.SavedMRQLQuery) *MRQLResult {
+	t.Helper()
+	flat, _, ok, err := ctx.MaterializedMRQLResult(context.Background(), saved, 0)
+	if err != nil {
+		t.Fatalf("materialized result: %v", err)
+	}
+	if !ok || flat == nil || flat.Materialized == nil {
+		t.Fatalf("expected a materialized flat result, got ok=%v flat=%v", ok, flat)
+	}
+	return flat
+}
+
+// An on_write result is served as stored until something it reads is written:
+// a group write leaves a note query alone, a note write makes it due.
+func TestMaterializedMRQL_OnWriteRefreshesAfterRelevantWrite(t *testing.T) {
+	ctx := setupMaterializeTestContext(t)
+	seedMaterializeNotes(t, ctx, "onwrite-note", 2)
+	saved := materializedQuery(t, ctx, "onwrite", `type = note AND name ~ "onwrite-note"`, MRQLMaterializationSettings{Materialized: true})
+	if saved.RefreshPolicy != models.MRQLRefreshOnWrite {
+		t.Fatalf("empty policy should default to on_write, got %q", saved.RefreshPolicy)
+	}
+
+	first := servedMaterialized(t, ctx, saved)
+	if len(first.Notes) != 2 || first.EntityType != "note" {
+		t.Fatalf("expected 2 notes, got %d (%s)", len(first.Notes), first.EntityType)
+	}
+	if first.Materialized.Total == nil || *first.Materialized.Total != 2 {
+		t.Fatalf("expected a stored total of 2, got %v", first.Materialized.Total)
+	}
+
+	if err := ctx.db.Create(&models.Group{Name: "onwrite-unrelated"}).Error; err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	second := servedMaterialized(t, ctx, saved)
+	if !second.Materialized.RefreshedAt.Equal(first.Materialized.RefreshedAt) {
+		t.Errorf("a group write refreshed a note-only query")
+	}
+
+	seedMaterializeNotes(t, ctx, "onwrite-note-late", 1)
+	third := servedMaterialized(t, ctx, saved)
+	if !third.Materialized.RefreshedAt.After(first.Materialized.RefreshedAt) {
+		t.Errorf("a note write did not refresh the note query")
+	}
+	if len(third.Notes) != 3 {
+		t.Errorf("expected 3 notes after the refresh, got %d", len(third.Notes))
+	}
+}
+
+// An interval result ignores writes until its interval passes; the background
+// tick then recomputes it.
+func TestMaterializedMRQL_IntervalRefreshesOnTick(t *testing.T) {
+	ctx := setupMaterializeTestContext(t)
+	seedMaterializeNotes(t, ctx, "interval-note", 1)
+	saved := materializedQuery(t, ctx, "interval", `type = note AND name ~ "interval-note"`, MRQLMaterializationSettings{
+		Materialized:           true,
+		RefreshPolicy:          models.MRQLRefreshInterval,
+		RefreshIntervalSeconds: 60,
+	})
+
+	first := servedMaterialized(t, ctx, saved)
+	seedMaterializeNotes(t, ctx, "interval-note-late", 1)
+	if got := servedMaterialized(t, ctx, saved); len(got.Notes) != 1 {
+		t.Fatalf("interval result refreshed early: %d notes", len(got.Notes))
+	}
+
+	materializer := NewMRQLMaterializer(ctx, time.Minute)
+	materializer.Tick(time.Now())
+	if got := servedMaterialized(t, ctx, saved); len(got.Notes) != 1 {
+		t.Fatalf("tick refreshed a result that was not due: %d notes", len(got.Notes))
+	}
+	materializer.Tick(first.Materialized.RefreshedAt.Add(61 * time.Second))
+	row, err := ctx.storedMRQLMaterialization(saved.ID)
+	if err != nil || row == nil {
+		t.Fatalf("stored row: %v", err)
+	}
+	if !row.RefreshedAt.After(first.Materialized.RefreshedAt) {
+		t.Errorf("tick did not refresh a due interval result")
+	}
+}
+
+// A refresh that fails serves the previous result marked stale.
+func TestMaterializedMRQL_FailedRefreshServesStale(t *testing.T) {
+	ctx := setupMaterializeTestContext(t)
+	seedMaterializeNotes(t, ctx, "stale-note", 1)
+	saved := materializedQuery(t, ctx, "stale", `type = note AND name ~ "stale-note"`, MRQLMaterializationSettings{Materialized: true})
+	servedMaterialized(t, ctx, saved)
+
+	// Changing the text outside UpdateSavedMRQLQuery skips its validation, so
+	// the refresh the changed text calls for cannot succeed.
+	saved.Query = `type = note AND name ~`
+	if err := ctx.db.Model(saved).Update("query", saved.Query).Error; err != nil {
+		t.Fatalf("break query: %v", err)
+	}
+	got := servedMaterialized(t, ctx, saved)
+	if !got.Materialized.Stale {
+		t.Errorf("expected the previous result to be marked stale")
+	}
+	if len(got.Notes) != 1 || len(got.Warnings) == 0 {
+		t.Errorf("expected the previous note and a warning, got %d notes, warnings %v", len(got.Notes), got.Warnings)
+	}
+}
+
+// A group-limited principal never sees the shared stored result and cannot
+// recompute it.
+func TestMaterializedMRQL_ScopedPrincipalRunsLive(t *testing.T) {
+	ctx := setupMaterializeTestContext(t)
+	saved := materializedQuery(t, ctx, "scoped", `type = group`, MRQLMaterializationSettings{Materialized: true})
+	scope := &models.Group{Name: "scoped-root"}
+	if err := ctx.db.Create(scope).Error; err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	scoped := ctx.WithPrincipal(&auth.Principal{UserID: 1, Role: models.RoleEditor, ScopeGroupID: &scope.ID})
+
+	if _, _, ok, err := scoped.MaterializedMRQLResult(context.Background(), saved, 0); ok || err != nil {
+		t.Errorf("scoped principal was served the stored result (ok=%v, err=%v)", ok, err)
+	}
+	if _, err := scoped.RefreshSavedMRQLQuery(context.Background(), saved.ID); !errors.Is(err, ErrMRQLMaterializeScoped) {
+		t.Errorf("expected ErrMRQLMaterializeScoped, got %v", err)
+	}
+}
+
+func TestMaterializedMRQL_RefreshRequiresMaterialized(t *testing.T) {
+	ctx := setupMaterializeTestContext(t)
+	saved, err := ctx.CreateSavedMRQLQuery("plain", `type = note`, "")
+	if err != nil {
+		t.Fatalf("save query: %v", err)
+	}
+	if _, err := ctx.RefreshSavedMRQLQuery(context.Background(), saved.ID); !errors.Is(err, ErrMRQLNotMaterialized) {
+		t.Errorf("expected ErrMRQLNotMaterialized, got %v", err)
+	}
+
+	saved = materializedQuery(t, ctx, "turned-off", `type = note`, MRQLMaterializationSettings{Materialized: true})
+	if _, err := ctx.RefreshSavedMRQLQuery(context.Background(), saved.ID); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if _, err := ctx.SetSavedMRQLQueryMaterialization(saved.ID, MRQLMaterializationSettings{}); err != nil {
+		t.Fatalf("turn off: %v", err)
+	}
+	if row, err := ctx.storedMRQLMaterialization(saved.ID); err != nil || row != nil {
+		t.Errorf("turning materialization off kept the stored result (row=%v, err=%v)", row, err)
+	}
+}
+
+func TestValidateMRQLMaterialization(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		query   string
+		m       MRQLMaterializationSettings
+		wantErr bool
+	}{
+		{"on_write", `type = note`, MRQLMaterializationSettings{Materialized: true}, false},
+		{"aggregated", `type = resource GROUP BY contentType COUNT()`, MRQLMaterializationSettings{Materialized: true}, false},
+		{"interval", `type = note`, MRQLMaterializationSettings{Materialized: true, RefreshPolicy: "interval", RefreshIntervalSeconds: 60}, false},
+		{"interval too short", `type = note`, MRQLMaterializationSettings{Materialized: true, RefreshPolicy: "interval", RefreshIntervalSeconds: 59}, true},
+		{"unknown policy", `type = note`, MRQLMaterializationSettings{Materialized: true, RefreshPolicy: "hourly"}, true},
+		{"params", `type = note AND name = $name`, MRQLMaterializationSettings{Materialized: true}, true},
+		{"bucketed", `type = resource GROUP BY contentType`, MRQLMaterializationSettings{Materialized: true}, true},
+		{"off ignores query", `type = note AND name = $name`, MRQLMaterializationSettings{}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m := tc.m
+			err := ValidateMRQLMaterialization(tc.query, &m)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("ValidateMRQLMaterialization(%q) error = %v, wantErr %v", tc.query, err, tc.wantErr)
+			}
+		})
+	}
+}
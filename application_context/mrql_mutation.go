@@ -0,0 +1,260 @@
+package application_context
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm/clause"
+	"mahresources/models"
+	"mahresources/models/query_models"
+	"mahresources/mrql"
+)
+
+// MaxMRQLMutationTargets caps how many entities one MRQL mutation may touch.
+// A mutation has no LIMIT of its own, so the cap is what stops a mistyped
+// filter from rewriting the whole library; a larger edit is split by
+// narrowing the filter.
+const MaxMRQLMutationTargets = 10000
+
+// mrqlMutationSampleSize is how many affected entities a plan lists by name.
+const mrqlMutationSampleSize = 20
+
+// mrqlMutationBatchSize bounds the ID list handed to each bulk edit, keeping
+// the IN clauses well under every backend's bind-variable limit.
+const mrqlMutationBatchSize = 500
+
+// MRQLMutationPlan is the resolved form of an MRQL mutation: the entities the
+// filter matched under the caller's scope, and the tag, meta, and owner edits
+// to apply to them. A dry run returns it as-is; an applied mutation runs it.
+type MRQLMutationPlan struct {
+	EntityType   string          `json:"entityType"`
+	Affected     int             `json:"affected"`
+	Sample       []MRQLItem      `json:"sample"`
+	AddTagIds    []uint          `json:"addTagIds,omitempty"`
+	RemoveTagIds []uint          `json:"removeTagIds,omitempty"`
+	Meta         json.RawMessage `json:"meta,omitempty"`
+	MoveToId     *uint           `json:"moveToId,omitempty"`
+
+	entityType mrql.EntityType
+	ids        []uint
+}
+
+// PlanMRQLMutation resolves an already-parsed, bound, and validated mutation
+// (see mrql.ParseMutation) without writing anything. Tag and group references
+// must resolve, and the filter must match no more than MaxMRQLMutationTargets
+// entities; otherwise the whole mutation is refused before any edit is made.
+func (ctx *MahresourcesContext) PlanMRQLMutation(reqCtx context.Context, parsed *mrql.Query) (*MRQLMutationPlan, error) {
+	if parsed.Mutation == nil {
+		return nil, errors.New("query has no mutation clauses")
+	}
+	if err := ctx.requireWriteRole("MRQL mutation"); err != nil {
+		return nil, err
+	}
+	if err := ctx.rejectSQLiteRegex(parsed); err != nil {
+		return nil, err
+	}
+
+	entityType := mrql.ExtractEntityType(parsed)
+	plan := &MRQLMutationPlan{EntityType: entityType.String(), Sample: []MRQLItem{}, entityType: entityType}
+
+	var err error
+	m := parsed.Mutation
+	if plan.AddTagIds, err = ctx.resolveMutationTags(m.AddTags); err != nil {
+		return nil, err
+	}
+	if plan.RemoveTagIds, err = ctx.resolveMutationTags(m.RemoveTags); err != nil {
+		return nil, err
+	}
+	if patch := m.MetaPatch(); patch != "" {
+		plan.Meta = json.RawMessage(patch)
+	}
+	if m.MoveTo != nil {
+		groupID, err := ctx.resolveMutationGroup(m.MoveTo)
+		if err != nil {
+			return nil, err
+		}
+		plan.MoveToId = &groupID
+	}
+
+	opts, deny, err := ctx.mrqlQueryTranslateOptions(parsed)
+	if err != nil {
+		return nil, err
+	}
+	if deny {
+		return plan, nil
+	}
+
+	clone := *parsed
+	clone.EntityType = entityType
+	clone.OrderBy = nil
+	clone.Limit = -1
+	clone.Offset = -1
+
+	queryCtx, cancel := context.WithTimeout(reqCtx, ctx.mrqlQueryTimeout())
+	defer cancel()
+
+	db, err := mrql.TranslateWithOptions(&clone, ctx.db.WithContext(queryCtx), opts)
+	if err != nil {
+		return nil, err
+	}
+	table := mutationTable(entityType)
+	if err := db.Order(table+".id").Limit(MaxMRQLMutationTargets+1).Pluck(table+".id", &plan.ids).Error; err != nil {
+		return nil, err
+	}
+	if len(plan.ids) > MaxMRQLMutationTargets {
+		return nil, fmt.Errorf("mutation matches more than %d %ss; narrow the filter", MaxMRQLMutationTargets, plan.EntityType)
+	}
+	plan.Affected = len(plan.ids)
+
+	if sample := plan.ids[:min(len(plan.ids), mrqlMutationSampleSize)]; len(sample) > 0 {
+		if err := ctx.db.WithContext(queryCtx).Table(table).
+			Select("id, name, created_at AS created, updated_at AS updated").
+			Where("id IN ?", sample).
+			Order("id").
+			Scan(&plan.Sample).Error; err != nil {
+			return nil, err
+		}
+		for i := range plan.Sample {
+			plan.Sample[i].EntityType = plan.EntityType
+		}
+	}
+	return plan, nil
+}
+
+// ApplyMRQLMutation runs a plan's edits through the same bulk editors the
+// list pages use, in batches of mrqlMutationBatchSize, so scope checks, meta
+// merging, and ownership-cycle rules are exactly theirs. progress is called
+// after each batch with the number of entities done so far. A failure stops
+// the run; batches already applied stay applied.
+func (ctx *MahresourcesContext) ApplyMRQLMutation(jobCtx context.Context, plan *MRQLMutationPlan, progress func(done, total int)) error {
+	total := len(plan.ids)
+	for start := 0; start < total; start += mrqlMutationBatchSize {
+		if err := jobCtx.Err(); err != nil {
+			return err
+		}
+		batch := plan.ids[start:min(start+mrqlMutationBatchSize, total)]
+		if err := ctx.applyMRQLMutationBatch(plan, batch); err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(start+len(batch), total)
+		}
+	}
+	return nil
+}
+
+func (ctx *MahresourcesContext) applyMRQLMutationBatch(plan *MRQLMutationPlan, ids []uint) error {
+	bulk := query_models.BulkQuery{ID: ids}
+	var addTags, removeTags func(*query_models.BulkEditQuery) error
+	var addMeta func(*query_models.BulkEditMetaQuery) error
+	var setOwner func(*query_models.BulkSetOwnerQuery) error
+	switch plan.entityType {
+	case mrql.EntityResource:
+		addTags, removeTags = ctx.BulkAddTagsToResources, ctx.BulkRemoveTagsFromResources
+		addMeta, setOwner = ctx.BulkAddMetaToResources, ctx.BulkSetOwnerOfResources
+	case mrql.EntityNote:
+		addTags, removeTags = ctx.BulkAddTagsToNotes, ctx.BulkRemoveTagsFromNotes
+		addMeta, setOwner = ctx.BulkAddMetaToNotes, ctx.BulkSetOwnerOfNotes
+	case mrql.EntityGroup:
+		addTags, removeTags = ctx.BulkAddTagsToGroups, ctx.BulkRemoveTagsFromGroups
+		addMeta, setOwner = ctx.BulkAddMetaToGroups, ctx.BulkSetOwnerOfGroups
+	default:
+		return fmt.Errorf("mutation has no entity type")
+	}
+
+	if len(plan.AddTagIds) > 0 {
+		if err := addTags(&query_models.BulkEditQuery{BulkQuery: bulk, EditedId: plan.AddTagIds}); err != nil {
+			return err
+		}
+	}
+	if len(plan.RemoveTagIds) > 0 {
+		if err := removeTags(&query_models.BulkEditQuery{BulkQuery: bulk, EditedId: plan.RemoveTagIds}); err != nil {
+			return err
+		}
+	}
+	if len(plan.Meta) > 0 {
+		if err := addMeta(&query_models.BulkEditMetaQuery{BulkQuery: bulk, Meta: string(plan.Meta)}); err != nil {
+			return err
+		}
+	}
+	if plan.MoveToId != nil {
+		if err := setOwner(&query_models.BulkSetOwnerQuery{BulkQuery: bulk, OwnerId: *plan.MoveToId}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveMutationTags turns ADD TAGS / REMOVE TAGS references into tag IDs.
+// Names compare case-insensitively, as tags = "..." does when reading, so
+// ADD TAGS "Photo" reuses an existing "photo". Should names differing only in
+// case both exist, the exact spelling wins.
+func (ctx *MahresourcesContext) resolveMutationTags(refs []mrql.Node) ([]uint, error) {
+	var ids []uint
+	for _, ref := range refs {
+		var found []uint
+		switch r := ref.(type) {
+		case *mrql.StringLiteral:
+			if err := ctx.db.Model(&models.Tag{}).Where("LOWER(name) = LOWER(?)", r.Value).
+				Order(clause.OrderBy{Expression: clause.Expr{SQL: "CASE WHEN name = ? THEN 0 ELSE 1 END, id", Vars: []any{r.Value}}}).
+				Limit(1).Pluck("id", &found).Error; err != nil {
+				return nil, err
+			}
+			if len(found) == 0 {
+				return nil, fmt.Errorf("tag %q not found", r.Value)
+			}
+		case *mrql.NumberLiteral:
+			if err := ctx.db.Model(&models.Tag{}).Where("id = ?", uint(r.Value)).Pluck("id", &found).Error; err != nil {
+				return nil, err
+			}
+			if len(found) == 0 {
+				return nil, fmt.Errorf("tag %d not found", uint(r.Value))
+			}
+		}
+		ids = append(ids, found...)
+	}
+	return deduplicateUints(ids), nil
+}
+
+// resolveMutationGroup turns a MOVE TO reference into a group ID the caller
+// can see. Group names are not unique, so a name matching several groups is
+// refused rather than guessed at.
+func (ctx *MahresourcesContext) resolveMutationGroup(ref mrql.Node) (uint, error) {
+	var found []uint
+	switch r := ref.(type) {
+	case *mrql.StringLiteral:
+		if err := ctx.db.Model(&models.Group{}).Where("name = ?", r.Value).Limit(2).Pluck("id", &found).Error; err != nil {
+			return 0, err
+		}
+		switch len(found) {
+		case 0:
+			return 0, fmt.Errorf("group %q not found", r.Value)
+		case 1:
+			return found[0], nil
+		default:
+			return 0, fmt.Errorf("group name %q matches more than one group; use its ID", r.Value)
+		}
+	case *mrql.NumberLiteral:
+		if err := ctx.db.Model(&models.Group{}).Where("id = ?", uint(r.Value)).Pluck("id", &found).Error; err != nil {
+			return 0, err
+		}
+		if len(found) == 0 {
+			return 0, fmt.Errorf("group %d not found", uint(r.Value))
+		}
+		return found[0], nil
+	}
+	return 0, errors.New("MOVE TO expects a group name or ID")
+}
+
+func mutationTable(entityType mrql.EntityType) string {
+	switch entityType {
+	case mrql.EntityNote:
+		return "notes"
+	case mrql.EntityGroup:
+		return "groups"
+	default:
+		return "resources"
+	}
+}
@@ -0,0 +1,200 @@
+package application_context
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"mahresources/auth"
+	"mahresources/models"
+	"mahresources/models/types"
+	"mahresources/mrql"
+)
+
+func parseMRQLMutation(t *testing.T, input string) *mrql.Query {
+	t.Helper()
+	parsed, err := mrql.ParseMutation(input)
+	if err != nil {
+		t.Fatalf("parse %q: %v", input, err)
+	}
+	if err := mrql.Validate(parsed); err != nil {
+		t.Fatalf("validate %q: %v", input, err)
+	}
+	return parsed
+}
+
+func TestMRQLMutationPlanAndApply(t *testing.T) {
+	ctx := createTestContextWithPlugins(t, t.TempDir())
+
+	inbox := &models.Tag{Name: "mut-inbox"}
+	triaged := &models.Tag{Name: "mut-triaged"}
+	archive := &models.Group{Name: "mut-archive"}
+	for _, entity := range []any{inbox, triaged, archive} {
+		if err := ctx.db.Create(entity).Error; err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+	var tagged []*models.Resource
+	for _, name := range []string{"mut-a", "mut-b"} {
+		r := &models.Resource{Name: name, Meta: types.JSON(`{}`), Tags: []*models.Tag{inbox}}
+		if err := ctx.db.Create(r).Error; err != nil {
+			t.Fatalf("seed resource: %v", err)
+		}
+		tagged = append(tagged, r)
+	}
+	untouched := &models.Resource{Name: "mut-c", Meta: types.JSON(`{}`)}
+	if err := ctx.db.Create(untouched).Error; err != nil {
+		t.Fatalf("seed resource: %v", err)
+	}
+
+	parsed := parseMRQLMutation(t, `type = resource AND tags = "mut-inbox" ADD TAGS "mut-triaged" REMOVE TAGS "mut-inbox" SET meta.reviewed = true MOVE TO "mut-archive"`)
+	plan, err := ctx.PlanMRQLMutation(context.Background(), parsed)
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	if plan.Affected != 2 || len(plan.Sample) != 2 || plan.Sample[0].Name != "mut-a" || plan.Sample[0].EntityType != "resource" {
+		t.Fatalf("unexpected plan %+v", plan)
+	}
+	if len(plan.AddTagIds) != 1 || plan.AddTagIds[0] != triaged.ID || plan.MoveToId == nil || *plan.MoveToId != archive.ID {
+		t.Fatalf("references resolved wrongly: %+v", plan)
+	}
+
+	var done int
+	if err := ctx.ApplyMRQLMutation(context.Background(), plan, func(d, total int) { done = d }); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if done != 2 {
+		t.Errorf("expected progress to reach 2, got %d", done)
+	}
+
+	for _, r := range tagged {
+		var got models.Resource
+		if err := ctx.db.Preload("Tags").First(&got, r.ID).Error; err != nil {
+			t.Fatalf("reload: %v", err)
+		}
+		if len(got.Tags) != 1 || got.Tags[0].ID != triaged.ID {
+			t.Errorf("%s: expected only the triaged tag, got %+v", got.Name, got.Tags)
+		}
+		if got.OwnerId == nil || *got.OwnerId != archive.ID {
+			t.Errorf("%s: expected owner %d, got %v", got.Name, archive.ID, got.OwnerId)
+		}
+		if !strings.Contains(string(got.Meta), `"reviewed":true`) {
+			t.Errorf("%s: expected meta.reviewed, got %s", got.Name, got.Meta)
+		}
+	}
+	var other models.Resource
+	if err := ctx.db.First(&other, untouched.ID).Error; err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if other.OwnerId != nil {
+		t.Errorf("a resource outside the filter was moved")
+	}
+}
+
+func TestMRQLMutationMatchesTagNamesCaseInsensitively(t *testing.T) {
+	ctx := createTestContextWithPlugins(t, t.TempDir())
+
+	photo := &models.Tag{Name: "mut-photo"}
+	if err := ctx.db.Create(photo).Error; err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+
+	plan, err := ctx.PlanMRQLMutation(context.Background(), parseMRQLMutation(t, `type = resource ADD TAGS "MUT-Photo"`))
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	if len(plan.AddTagIds) != 1 || plan.AddTagIds[0] != photo.ID {
+		t.Fatalf("expected ADD TAGS to resolve to tag %d, got %v", photo.ID, plan.AddTagIds)
+	}
+}
+
+func TestMRQLMutationRefusesUnresolvedReferences(t *testing.T) {
+	ctx := createTestContextWithPlugins(t, t.TempDir())
+	for _, name := range []string{"mut-twin", "mut-twin"} {
+		if err := ctx.db.Create(&models.Group{Name: name}).Error; err != nil {
+			t.Fatalf("seed group: %v", err)
+		}
+	}
+
+	cases := []struct {
+		input      string
+		wantSubstr string
+	}{
+		{`type = note ADD TAGS "mut-missing"`, `tag "mut-missing" not found`},
+		{`type = note REMOVE TAGS 999999`, "tag 999999 not found"},
+		{`type = note MOVE TO "mut-twin"`, "matches more than one group"},
+		{`type = note MOVE TO 999999`, "group 999999 not found"},
+	}
+	for _, tc := range cases {
+		_, err := ctx.PlanMRQLMutation(context.Background(), parseMRQLMutation(t, tc.input))
+		if err == nil || !strings.Contains(err.Error(), tc.wantSubstr) {
+			t.Errorf("%s: expected %q, got %v", tc.input, tc.wantSubstr, err)
+		}
+	}
+}
+
+// A group-limited principal's mutation matches only its own subtree, and
+// cannot name a group outside it as the MOVE TO target.
+func TestMRQLMutationRespectsPrincipalScope(t *testing.T) {
+	ctx := createTestContextWithPlugins(t, t.TempDir())
+
+	root := &models.Group{Name: "mut-scope-root"}
+	outside := &models.Group{Name: "mut-scope-outside"}
+	for _, g := range []*models.Group{root, outside} {
+		if err := ctx.db.Create(g).Error; err != nil {
+			t.Fatalf("seed group: %v", err)
+		}
+	}
+	for _, n := range []*models.Note{
+		{Name: "mut-scope-in", OwnerId: &root.ID},
+		{Name: "mut-scope-out", OwnerId: &outside.ID},
+	} {
+		if err := ctx.db.Create(n).Error; err != nil {
+			t.Fatalf("seed note: %v", err)
+		}
+	}
+
+	scoped := ctx.WithPrincipal(&auth.Principal{UserID: 1, Role: models.RoleUser, ScopeGroupID: &root.ID})
+
+	plan, err := scoped.PlanMRQLMutation(context.Background(), parseMRQLMutation(t, `type = note AND name ~ "mut-scope-" SET meta.seen = 1`))
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	if plan.Affected != 1 || plan.Sample[0].Name != "mut-scope-in" {
+		t.Fatalf("expected only the in-scope note, got %+v", plan)
+	}
+
+	_, err = scoped.PlanMRQLMutation(context.Background(), parseMRQLMutation(t, `type = note MOVE TO "mut-scope-outside"`))
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("expected an out-of-scope MOVE TO target to be refused, got %v", err)
+	}
+
+	guest := ctx.WithPrincipal(&auth.Principal{UserID: 2, Role: models.RoleGuest})
+	_, err = guest.PlanMRQLMutation(context.Background(), parseMRQLMutation(t, `type = note SET meta.seen = 1`))
+	if !errors.Is(err, ErrRoleCapability) {
+		t.Fatalf("expected a guest to be refused, got %v", err)
+	}
+}
+
+func TestMRQLMutationRefusesOwnershipCycle(t *testing.T) {
+	ctx := createTestContextWithPlugins(t, t.TempDir())
+
+	parent := &models.Group{Name: "mut-cycle-parent"}
+	if err := ctx.db.Create(parent).Error; err != nil {
+		t.Fatalf("seed group: %v", err)
+	}
+	child := &models.Group{Name: "mut-cycle-child", OwnerId: &parent.ID}
+	if err := ctx.db.Create(child).Error; err != nil {
+		t.Fatalf("seed group: %v", err)
+	}
+
+	plan, err := ctx.PlanMRQLMutation(context.Background(), parseMRQLMutation(t, `type = group AND name = "mut-cycle-parent" MOVE TO "mut-cycle-child"`))
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	err = ctx.ApplyMRQLMutation(context.Background(), plan, nil)
+	if err == nil || !strings.Contains(err.Error(), "ownership cycle") {
+		t.Fatalf("expected an ownership cycle error, got %v", err)
+	}
+}
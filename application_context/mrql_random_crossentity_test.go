@@ -15,8 +15,8 @@ import (
 )
 
 // setupSharedCacheTestContext mirrors setupTestContext but uses a shared-cache
-// in-memory database. executeCrossEntity queries the three entity tables on
-// concurrent pool connections, and with cache=private each extra connection
+// in-memory database. Cross-entity execution may run its union and model loads
+// on different pool connections, and with cache=private each extra connection
 // would see its own empty database.
 func setupSharedCacheTestContext(t *testing.T) *MahresourcesContext {
 	t.Helper()
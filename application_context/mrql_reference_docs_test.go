@@ -33,6 +33,7 @@ func TestReferenceExecutionLimitsMatchPolicy(t *testing.T) {
 		{"Interactive `OFFSET`", MaxMRQLInteractiveOffset},
 		{"Export `LIMIT`", MaxMRQLExportLimit},
 		{"Export `OFFSET`", MaxMRQLExportOffset},
+		{"Mutation targets", MaxMRQLMutationTargets},
 	}
 
 	for _, tc := range cases {
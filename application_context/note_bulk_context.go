@@ -121,6 +121,48 @@ func (ctx *MahresourcesContext) BulkAddGroupsToNotes(query *query_models.BulkEdi
 	})
 }
 
+// BulkSetOwnerOfNotes moves notes under another owner group.
+func (ctx *MahresourcesContext) BulkSetOwnerOfNotes(query *query_models.BulkSetOwnerQuery) error {
+	if len(query.ID) == 0 {
+		return fmt.Errorf("at least one note ID is required")
+	}
+	if query.OwnerId == 0 {
+		return fmt.Errorf("an owner group is required")
+	}
+
+	uniqueNoteIds := deduplicateUints(query.ID)
+
+	err := ctx.db.Transaction(func(tx *gorm.DB) error {
+		// RBAC: verify target notes are visible (scope callback filters this Count).
+		var noteCount int64
+		if err := tx.Model(&models.Note{}).Where("id IN ?", uniqueNoteIds).Count(&noteCount).Error; err != nil {
+			return err
+		}
+		if int(noteCount) != len(uniqueNoteIds) {
+			return fmt.Errorf("one or more notes not found")
+		}
+
+		var ownerCount int64
+		if err := tx.Model(&models.Group{}).Where("id = ?", query.OwnerId).Count(&ownerCount).Error; err != nil {
+			return err
+		}
+		if ownerCount == 0 {
+			return fmt.Errorf("owner group not found")
+		}
+
+		return tx.Model(&models.Note{}).Where("id IN ?", uniqueNoteIds).Update("owner_id", query.OwnerId).Error
+	})
+
+	if err == nil {
+		ctx.Logger().Info(models.LogActionUpdate, "note", nil, "", "Bulk moved notes", map[string]interface{}{
+			"noteIds": query.ID,
+			"ownerId": query.OwnerId,
+		})
+	}
+
+	return err
+}
+
 func (ctx *MahresourcesContext) BulkAddMetaToNotes(query *query_models.BulkEditMetaQuery) error {
 	if len(query.ID) == 0 {
 		return fmt.Errorf("at least one note ID is required")
@@ -147,7 +189,7 @@ func (ctx *MahresourcesContext) BulkAddMetaToNotes(query *query_models.BulkEditM
 	var expr clause.Expr
 
 	if ctx.Config.DbType == constants.DbTypePosgres {
-		expr = gorm.Expr("meta || ?", query.Meta)
+		expr = jsonbMetaPatchExpr("meta", query.Meta)
 	} else {
 		expr = gorm.Expr("json_patch(meta, ?)", query.Meta)
 	}
@@ -79,7 +79,7 @@ func (a *pluginMRQLAdapter) ExecuteMRQL(reqCtx context.Context, query string, op
 
 	// GROUP BY path. ExecuteMRQLGroupedWithScope applies the principal's forced
 	// scope itself, so it needs no clamp here.
-	if parsed.GroupBy != nil {
+	if parsed.IsGrouped() {
 		if opts.Buckets > 0 {
 			parsed.BucketLimit = opts.Buckets
 		}
@@ -129,8 +129,9 @@ func (a *pluginMRQLAdapter) convertGrouped(result *MRQLGroupedResult) *plugin_sy
 	pr := &plugin_system.MRQLResult{
 		EntityType: result.EntityType,
 	}
-	if result.Mode == "aggregated" {
-		pr.Mode = "aggregated"
+	if result.Mode == "aggregated" || result.Mode == "projected" {
+		pr.Mode = result.Mode
+		pr.Columns = result.Columns
 		pr.Rows = result.Rows
 		return pr
 	}
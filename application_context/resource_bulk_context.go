@@ -13,6 +13,7 @@ import (
 	"mahresources/models/types"
 	"mahresources/mrql"
 	"path"
+	"sort"
 	"strings"
 
 	"github.com/spf13/afero"
@@ -106,6 +107,10 @@ func (ctx *MahresourcesContext) DeleteResource(resourceId uint) error {
 			return err
 		}
 
+		if err := txCtx.refreshStorageUsage(txCtx.db, resourceId); err != nil {
+			return err
+		}
+
 		// Auto-delete empty series if this resource was in one
 		if resource.SeriesID != nil {
 			seriesID := *resource.SeriesID
@@ -119,7 +124,7 @@ func (ctx *MahresourcesContext) DeleteResource(resourceId uint) error {
 
 		// Check if any other resources or versions reference this hash
 		var countErr error
-		refCount, countErr = txCtx.CountHashReferences(resource.Hash)
+		refCount, countErr = txCtx.CountHashReferences(resource.Hash, resource.LegacyHash)
 		if countErr != nil {
 			txCtx.Logger().Warning(models.LogActionDelete, "resource", &resourceId, "Failed to count hash references", countErr.Error(), nil)
 			refCount = 1 // Assume referenced to be safe
@@ -269,8 +274,8 @@ func (ctx *MahresourcesContext) BulkAddMetaToResources(query *query_models.BulkE
 	var metaExpr, ownMetaExpr clause.Expr
 
 	if ctx.Config.DbType == constants.DbTypePosgres {
-		metaExpr = gorm.Expr("meta || ?", query.Meta)
-		ownMetaExpr = gorm.Expr("COALESCE(own_meta, '{}'::jsonb) || ?", query.Meta)
+		metaExpr = jsonbMetaPatchExpr("meta", query.Meta)
+		ownMetaExpr = jsonbMetaPatchExpr("COALESCE(own_meta, '{}'::jsonb)", query.Meta)
 	} else {
 		metaExpr = gorm.Expr("json_patch(meta, ?)", query.Meta)
 		ownMetaExpr = gorm.Expr("json_patch(COALESCE(own_meta, '{}'), ?)", query.Meta)
@@ -288,7 +293,7 @@ func (ctx *MahresourcesContext) BulkAddMetaToResources(query *query_models.BulkE
 		return err
 	}
 
-	// For resources in a series, json_patch (SQLite) / jsonb || (Postgres) removes
+	// For resources in a series, json_patch (SQLite) / jsonbMetaPatchExpr (Postgres) removes
 	// null-valued keys from OwnMeta instead of storing them. We need explicit null
 	// entries in OwnMeta so that mergeMeta knows to suppress series-inherited keys.
 	var patchMap map[string]interface{}
@@ -395,6 +400,76 @@ func (ctx *MahresourcesContext) BulkAddTagsToResources(query *query_models.BulkE
 	return err
 }
 
+// jsonbMetaPatchExpr is the Postgres counterpart of json_patch(column, patch)
+// for a flat meta patch. jsonb || stores a null-valued key as JSON null, where
+// json_patch removes it, so each null key is subtracted from the merge: a null
+// clears the key on both dialects.
+func jsonbMetaPatchExpr(column, patch string) clause.Expr {
+	var patchMap map[string]any
+	_ = json.Unmarshal([]byte(patch), &patchMap)
+	var nullKeys []string
+	for k, v := range patchMap {
+		if v == nil {
+			nullKeys = append(nullKeys, k)
+		}
+	}
+	sort.Strings(nullKeys)
+
+	sql, args := "("+column+" || ?)", []any{patch}
+	for _, k := range nullKeys {
+		sql += " - ?::text"
+		args = append(args, k)
+	}
+	return gorm.Expr(sql, args...)
+}
+
+// BulkSetOwnerOfResources moves resources under another owner group.
+func (ctx *MahresourcesContext) BulkSetOwnerOfResources(query *query_models.BulkSetOwnerQuery) error {
+	if len(query.ID) == 0 {
+		return fmt.Errorf("at least one resource ID is required")
+	}
+	if query.OwnerId == 0 {
+		return fmt.Errorf("an owner group is required")
+	}
+
+	uniqueResourceIds := deduplicateUints(query.ID)
+
+	err := ctx.db.Transaction(func(tx *gorm.DB) error {
+		// RBAC: verify target resources are visible (scope callback filters this Count).
+		var resourceCount int64
+		if err := tx.Model(&models.Resource{}).Where("id IN ?", uniqueResourceIds).Count(&resourceCount).Error; err != nil {
+			return err
+		}
+		if int(resourceCount) != len(uniqueResourceIds) {
+			return fmt.Errorf("one or more resources not found")
+		}
+
+		// The owner is checked on the same scoped handle, so a group-limited
+		// principal cannot move resources out of its subtree.
+		var ownerCount int64
+		if err := tx.Model(&models.Group{}).Where("id = ?", query.OwnerId).Count(&ownerCount).Error; err != nil {
+			return err
+		}
+		if ownerCount == 0 {
+			return fmt.Errorf("owner group not found")
+		}
+
+		if err := tx.Model(&models.Resource{}).Where("id IN ?", uniqueResourceIds).Update("owner_id", query.OwnerId).Error; err != nil {
+			return err
+		}
+		return ctx.refreshStorageUsage(tx, uniqueResourceIds...)
+	})
+
+	if err == nil {
+		ctx.Logger().Info(models.LogActionUpdate, "resource", nil, "", "Bulk moved resources", map[string]interface{}{
+			"resourceIds": query.ID,
+			"ownerId":     query.OwnerId,
+		})
+	}
+
+	return err
+}
+
 func (ctx *MahresourcesContext) BulkAddGroupsToResources(query *query_models.BulkEditQuery) error {
 	if len(query.ID) == 0 {
 		return fmt.Errorf("at least one resource ID is required")
@@ -543,6 +618,10 @@ func (ctx *MahresourcesContext) deleteResourceDBOnly(resourceId uint) (*FileClea
 		return nil, effect, err
 	}
 
+	if err := ctx.refreshStorageUsage(ctx.db, resourceId); err != nil {
+		return nil, effect, err
+	}
+
 	// Auto-delete empty series
 	if resource.SeriesID != nil {
 		seriesID := *resource.SeriesID
@@ -553,7 +632,7 @@ func (ctx *MahresourcesContext) deleteResourceDBOnly(resourceId uint) (*FileClea
 	}
 
 	// Check hash references for file deletion decision
-	refCount, countErr := ctx.CountHashReferences(resource.Hash)
+	refCount, countErr := ctx.CountHashReferences(resource.Hash, resource.LegacyHash)
 	if countErr != nil {
 		ctx.Logger().Warning(models.LogActionDelete, "resource", &resourceId, "Failed to count hash references", countErr.Error(), nil)
 		refCount = 1 // Assume referenced to be safe
@@ -737,6 +816,7 @@ func (ctx *MahresourcesContext) MergeResources(winnerId uint, loserIds []uint, k
 					VersionNumber:   currentMax + created + 1,
 					Hash:            loser.Hash,
 					HashType:        loser.HashType,
+					LegacyHash:      loser.LegacyHash,
 					FileSize:        loser.FileSize,
 					ContentType:     loser.ContentType,
 					Width:           loser.Width,
@@ -830,6 +910,11 @@ func (ctx *MahresourcesContext) MergeResources(winnerId uint, loserIds []uint, k
 			return err
 		}
 
+		// The winner now holds the losers' files as versions.
+		if err := transactionCtx.refreshStorageUsage(tx, winnerId); err != nil {
+			return err
+		}
+
 		// Save backups to winner's meta
 		backupObj := make(map[string]any)
 		backupObj["backups"] = deletedResBackups
@@ -118,7 +118,7 @@ func TestCropResource_JPEG_CreatesNewVersion(t *testing.T) {
 	assert.Equal(t, uint(40), v2.Width)
 	assert.Equal(t, uint(30), v2.Height)
 	assert.Equal(t, "image/jpeg", v2.ContentType)
-	assert.Equal(t, "SHA1", v2.HashType)
+	assert.Equal(t, models.HashTypeSHA256, v2.HashType)
 	assert.Contains(t, v2.Comment, "Cropped to 40×30")
 
 	var updated models.Resource
@@ -126,7 +126,7 @@ func TestCropResource_JPEG_CreatesNewVersion(t *testing.T) {
 	assert.Equal(t, uint(40), updated.Width)
 	assert.Equal(t, uint(30), updated.Height)
 	assert.Equal(t, "image/jpeg", updated.ContentType)
-	assert.Equal(t, "SHA1", updated.HashType, "resource hash_type must match the new version (fixes the Rotate bug)")
+	assert.Equal(t, models.HashTypeSHA256, updated.HashType, "resource hash_type must match the new version (fixes the Rotate bug)")
 	require.NotNil(t, updated.CurrentVersionID)
 	assert.Equal(t, v2.ID, *updated.CurrentVersionID)
 }
@@ -433,6 +433,11 @@ func (ctx *MahresourcesContext) EditResource(resourceQuery *query_models.Resourc
 			return err
 		}
 
+		// A new owner takes over the resource's storage usage.
+		if err := altCtx.refreshStorageUsage(tx, resource.ID); err != nil {
+			return err
+		}
+
 		// Explicitly persist OwnMeta to ensure it's saved even if GORM's
 		// Save doesn't detect the change on the JSON field
 		if resource.SeriesID != nil || seriesChanged {
@@ -483,12 +488,12 @@ func (ctx *MahresourcesContext) GetSeriesSiblings(resourceID uint, seriesID uint
 		Find(&resources).Error
 }
 
-// GetResourceByHash retrieves a resource by its content hash.
+// GetResourceByHash retrieves a resource by its content hash, SHA-256 or SHA1.
 // This is useful for serving resources in contexts where only the hash is known,
 // such as shared note resource serving.
 func (ctx *MahresourcesContext) GetResourceByHash(hash string) (*models.Resource, error) {
 	var resource models.Resource
-	if err := ctx.db.Where("hash = ?", hash).First(&resource).Error; err != nil {
+	if err := ctx.db.Scopes(contentHashMatch(hash)).First(&resource).Error; err != nil {
 		return nil, err
 	}
 	return &resource, nil
@@ -510,6 +515,11 @@ func (ctx *MahresourcesContext) ServeResourceByHash(w http.ResponseWriter, r *ht
 		return
 	}
 
+	if issue := ctx.QuarantinedBlob(resource.StorageLocation, resource.Location); issue != nil {
+		http.Error(w, QuarantineMessage(issue), http.StatusConflict)
+		return
+	}
+
 	file, err := fs.Open(resource.GetCleanLocation())
 	if err != nil {
 		http.Error(w, "File not found", http.StatusNotFound)
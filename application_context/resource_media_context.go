@@ -210,6 +210,29 @@ func (ctx *MahresourcesContext) LoadOrCreateThumbnailForResource(
 			}
 		}
 
+	case isPDF(resource.ContentType):
+		// PDFs: same canonical-source pattern as video; rendering the null
+		// thumbnail also stores the page count and text.
+		nullThumbnail, _, nerr := ctx.getOrCreateNullThumbnail(resource, fs, httpContext)
+		if nerr != nil {
+			return nil, fmt.Errorf("error handling null thumbnail: %w", nerr)
+		}
+		if nullThumbnail.ID != 0 {
+			fileBytes, err = ctx.generateImageThumbnail(nullThumbnail.Data, targetW, targetH)
+			if err != nil {
+				return nil, fmt.Errorf("error generating image thumbnail from null thumbnail: %w", err)
+			}
+		} else {
+			fileBytes, err = ctx.generatePdfThumbnail(resource, fs, targetW, targetH, httpContext)
+			if err != nil {
+				return nil, fmt.Errorf("error generating PDF thumbnail: %w", err)
+			}
+			if fileBytes == nil {
+				// No PDF renderer available, skip thumbnail generation
+				return nil, nil
+			}
+		}
+
 	default:
 		// Unsupported content type; no thumbnail to generate
 		return nil, nil
@@ -218,7 +241,7 @@ func (ctx *MahresourcesContext) LoadOrCreateThumbnailForResource(
 	// Determine the dimensions to persist. Image/SVG thumbnails record the
 	// actual decoded pixel dimensions of the JPEG output so that future
 	// lookups by computed target dims hit the cache (and so legacy polluted
-	// rows with zero width remain unreachable). Video/office paths preserve
+	// rows with zero width remain unreachable). Video/office/PDF paths preserve
 	// the legacy behavior of saving the requested dims.
 	saveW, saveH := targetW, targetH
 	if isImage || isSVG {
@@ -1415,7 +1438,7 @@ func (ctx *MahresourcesContext) RotateResource(httpContext context.Context, reso
 	// Create a new version with the rotated content instead of overwriting in place.
 	// This preserves the original, updates the hash, and respects the versioning system.
 	rotatedBytes := encoded.Data
-	hash := computeSHA1(rotatedBytes)
+	hash, legacyHash := computeContentHash(rotatedBytes)
 	contentType := detectContentType(rotatedBytes)
 	width, height := getDimensionsFromContent(rotatedBytes, contentType)
 	// Take the extension from the format we just encoded, never from the
@@ -1451,6 +1474,7 @@ func (ctx *MahresourcesContext) RotateResource(httpContext context.Context, reso
 			VersionNumber:   1,
 			Hash:            resource.Hash,
 			HashType:        resource.HashType,
+			LegacyHash:      resource.LegacyHash,
 			FileSize:        resource.FileSize,
 			ContentType:     resource.ContentType,
 			Width:           resource.Width,
@@ -1476,7 +1500,8 @@ func (ctx *MahresourcesContext) RotateResource(httpContext context.Context, reso
 		ResourceID:    resourceId,
 		VersionNumber: maxVersion + 1,
 		Hash:          hash,
-		HashType:      "SHA1",
+		HashType:      models.HashTypeSHA256,
+		LegacyHash:    legacyHash,
 		FileSize:      int64(len(rotatedBytes)),
 		ContentType:   contentType,
 		Width:         width,
@@ -1494,6 +1519,7 @@ func (ctx *MahresourcesContext) RotateResource(httpContext context.Context, reso
 		"current_version_id": version.ID,
 		"hash":               version.Hash,
 		"hash_type":          version.HashType,
+		"legacy_hash":        version.LegacyHash,
 		"location":           version.Location,
 		"storage_location":   version.StorageLocation,
 		"content_type":       version.ContentType,
@@ -1654,7 +1680,7 @@ func (ctx *MahresourcesContext) CropResource(
 	formatNote := crop.note
 
 	croppedBytes := crop.data
-	hash := computeSHA1(croppedBytes)
+	hash, legacyHash := computeContentHash(croppedBytes)
 	contentType := detectContentType(croppedBytes)
 	outW, outH := getDimensionsFromContent(croppedBytes, contentType)
 	location := buildVersionResourcePath(hash, outExt)
@@ -1687,6 +1713,7 @@ func (ctx *MahresourcesContext) CropResource(
 			VersionNumber:   1,
 			Hash:            resource.Hash,
 			HashType:        resource.HashType,
+			LegacyHash:      resource.LegacyHash,
 			FileSize:        resource.FileSize,
 			ContentType:     resource.ContentType,
 			Width:           resource.Width,
@@ -1717,7 +1744,8 @@ func (ctx *MahresourcesContext) CropResource(
 		ResourceID:    resourceId,
 		VersionNumber: maxVersion + 1,
 		Hash:          hash,
-		HashType:      "SHA1",
+		HashType:      models.HashTypeSHA256,
+		LegacyHash:    legacyHash,
 		FileSize:      int64(len(croppedBytes)),
 		ContentType:   contentType,
 		Width:         outW,
@@ -1735,6 +1763,7 @@ func (ctx *MahresourcesContext) CropResource(
 		"current_version_id": version.ID,
 		"hash":               version.Hash,
 		"hash_type":          version.HashType,
+		"legacy_hash":        version.LegacyHash,
 		"location":           version.Location,
 		"storage_location":   version.StorageLocation,
 		"content_type":       version.ContentType,
@@ -1844,9 +1873,8 @@ func (ctx *MahresourcesContext) CropResourceToNewResource(
 	// would mean holding the same per-hash lock AddResource takes, which is not
 	// re-entrant. The check is also principal-scoped, so a scoped caller does not
 	// see — and will not be refused by — a match outside its subtree.
-	hash := computeSHA1(crop.data)
 	var existing models.Resource
-	switch err := ctx.db.Select("id").Where("hash = ?", hash).First(&existing).Error; {
+	switch err := ctx.db.Select("id").Scopes(contentHashMatch(computeContentHash(crop.data))).First(&existing).Error; {
 	case err == nil:
 		return nil, &ResourceExistsError{ResourceID: existing.ID, Reason: ReasonSameParent}
 	case !errors.Is(err, gorm.ErrRecordNotFound):
@@ -1955,7 +1983,7 @@ func (ctx *MahresourcesContext) TrimVideo(
 	ext := ".mp4"
 	contentType := "video/mp4"
 
-	hash := computeSHA1(trimmedBytes)
+	hash, legacyHash := computeContentHash(trimmedBytes)
 	location := buildVersionResourcePath(hash, ext)
 
 	if exists, _ := afero.Exists(ctx.fs, location); !exists {
@@ -1985,6 +2013,7 @@ func (ctx *MahresourcesContext) TrimVideo(
 			VersionNumber:   1,
 			Hash:            resource.Hash,
 			HashType:        resource.HashType,
+			LegacyHash:      resource.LegacyHash,
 			FileSize:        resource.FileSize,
 			ContentType:     resource.ContentType,
 			Width:           resource.Width,
@@ -2015,7 +2044,8 @@ func (ctx *MahresourcesContext) TrimVideo(
 		ResourceID:    resourceId,
 		VersionNumber: maxVersion + 1,
 		Hash:          hash,
-		HashType:      "SHA1",
+		HashType:      models.HashTypeSHA256,
+		LegacyHash:    legacyHash,
 		FileSize:      int64(len(trimmedBytes)),
 		ContentType:   contentType,
 		Width:         resource.Width,
@@ -2033,6 +2063,7 @@ func (ctx *MahresourcesContext) TrimVideo(
 		"current_version_id": version.ID,
 		"hash":               version.Hash,
 		"hash_type":          version.HashType,
+		"legacy_hash":        version.LegacyHash,
 		"location":           version.Location,
 		"storage_location":   version.StorageLocation,
 		"content_type":       version.ContentType,
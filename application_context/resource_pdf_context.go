@@ -0,0 +1,329 @@
+package application_context
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"mahresources/models"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/disintegration/imaging"
+	"github.com/spf13/afero"
+	"gorm.io/gorm"
+)
+
+// PDFs get their thumbnail from a local renderer the way office documents get
+// theirs from LibreOffice: poppler's pdftoppm or MuPDF's mutool. The run that
+// renders the first page also reads the page count, kept on the resource, and
+// the text layer, kept in resource_texts.
+
+const pdfContentType = "application/pdf"
+
+// pdfRenderSize bounds the render of the first page, which is kept as the null
+// thumbnail every requested size is resized from.
+const pdfRenderSize = 1200
+
+// pdfTextMaxBytes caps the text kept for one PDF.
+const pdfTextMaxBytes = 4 << 20
+
+// pdfPagesPattern finds the page count in the output of both pdfinfo and
+// mutool info.
+var pdfPagesPattern = regexp.MustCompile(`(?m)^Pages:\s*(\d+)`)
+
+// isPDF checks if the content type is a PDF.
+func isPDF(contentType string) bool {
+	return contentType == pdfContentType
+}
+
+// findPdfRendererPath returns the path to the PDF renderer.
+// It first checks the configured path, then looks for 'pdftoppm' or 'mutool' in PATH.
+func (ctx *MahresourcesContext) findPdfRendererPath() string {
+	if ctx.Config.PdfRendererPath != "" {
+		return ctx.Config.PdfRendererPath
+	}
+
+	for _, name := range []string{"pdftoppm", "mutool"} {
+		if path, err := exec.LookPath(name); err == nil {
+			return path
+		}
+	}
+
+	return ""
+}
+
+// pdfTools runs the renderer found by findPdfRendererPath. Poppler ships the
+// page count and the text as pdfinfo and pdftotext beside pdftoppm; MuPDF has
+// all three as mutool subcommands.
+type pdfTools struct {
+	renderer string
+	mutool   bool
+}
+
+func newPdfTools(renderer string) pdfTools {
+	return pdfTools{renderer: renderer, mutool: strings.HasPrefix(filepath.Base(renderer), "mutool")}
+}
+
+// poppler returns the path to one of poppler's tools, looked for beside the
+// renderer first and then in PATH.
+func (t pdfTools) poppler(name string) (string, error) {
+	sibling := filepath.Join(filepath.Dir(t.renderer), name)
+	if info, err := os.Stat(sibling); err == nil && !info.IsDir() {
+		return sibling, nil
+	}
+	if path, err := exec.LookPath(name); err == nil {
+		return path, nil
+	}
+	return "", fmt.Errorf("%s not found beside %s or in PATH", name, t.renderer)
+}
+
+// renderFirstPage renders the first page of input to a PNG in dir and returns
+// the PNG's path.
+func (t pdfTools) renderFirstPage(runCtx context.Context, input, dir string) (string, error) {
+	size := strconv.Itoa(pdfRenderSize)
+	output := filepath.Join(dir, "page")
+	var cmd *exec.Cmd
+	if t.mutool {
+		output += ".png"
+		cmd = exec.CommandContext(runCtx, t.renderer, "draw", "-F", "png", "-w", size, "-h", size, "-o", output, input, "1")
+	} else {
+		// pdftoppm takes an output prefix and adds the extension itself.
+		cmd = exec.CommandContext(runCtx, t.renderer, "-png", "-f", "1", "-l", "1", "-singlefile", "-scale-to", size, input, output)
+		output += ".png"
+	}
+	if _, err := runPdfTool(runCtx, cmd); err != nil {
+		return "", err
+	}
+	return output, nil
+}
+
+// pageCount returns the number of pages of input.
+func (t pdfTools) pageCount(runCtx context.Context, input string) (uint, error) {
+	var cmd *exec.Cmd
+	if t.mutool {
+		cmd = exec.CommandContext(runCtx, t.renderer, "info", input)
+	} else {
+		pdfinfo, err := t.poppler("pdfinfo")
+		if err != nil {
+			return 0, err
+		}
+		cmd = exec.CommandContext(runCtx, pdfinfo, input)
+	}
+	stdout, err := runPdfTool(runCtx, cmd)
+	if err != nil {
+		return 0, err
+	}
+	match := pdfPagesPattern.FindSubmatch(stdout)
+	if match == nil {
+		return 0, fmt.Errorf("%s printed no page count", filepath.Base(cmd.Path))
+	}
+	pages, err := strconv.ParseUint(string(match[1]), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("bad page count %q: %w", match[1], err)
+	}
+	return uint(pages), nil
+}
+
+// text returns the text layer of input, at most pdfTextMaxBytes of it.
+func (t pdfTools) text(runCtx context.Context, input, dir string) (string, error) {
+	output := filepath.Join(dir, "text.txt")
+	var cmd *exec.Cmd
+	if t.mutool {
+		cmd = exec.CommandContext(runCtx, t.renderer, "draw", "-F", "txt", "-o", output, input)
+	} else {
+		pdftotext, err := t.poppler("pdftotext")
+		if err != nil {
+			return "", err
+		}
+		cmd = exec.CommandContext(runCtx, pdftotext, "-enc", "UTF-8", input, output)
+	}
+	if _, err := runPdfTool(runCtx, cmd); err != nil {
+		return "", err
+	}
+
+	file, err := os.Open(output)
+	if err != nil {
+		return "", fmt.Errorf("failed to open extracted text: %w", err)
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, pdfTextMaxBytes))
+	if err != nil {
+		return "", fmt.Errorf("failed to read extracted text: %w", err)
+	}
+	// The cap can split a rune, and PostgreSQL refuses NUL in text columns.
+	return strings.ReplaceAll(strings.ToValidUTF8(string(data), ""), "\x00", ""), nil
+}
+
+// runPdfTool runs cmd and returns its stdout.
+func runPdfTool(runCtx context.Context, cmd *exec.Cmd) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if runCtx.Err() != nil {
+			return nil, runCtx.Err()
+		}
+		return nil, fmt.Errorf("%s failed: %w (stderr: %s)", filepath.Base(cmd.Path), err, truncateStderr(stderr.String(), 200))
+	}
+	return stdout.Bytes(), nil
+}
+
+// generatePdfThumbnail renders the first page of a PDF, stores it as the null
+// thumbnail and returns it resized to the requested dimensions. Along the way
+// it stores the PDF's page count and text; failing to read those is logged and
+// does not fail the thumbnail.
+// Returns nil, nil if no renderer is available.
+func (ctx *MahresourcesContext) generatePdfThumbnail(
+	resource models.Resource,
+	fs afero.Fs,
+	width, height uint,
+	httpContext context.Context,
+) ([]byte, error) {
+	rendererPath := ctx.findPdfRendererPath()
+	if rendererPath == "" {
+		// No renderer available, skip silently
+		return nil, nil
+	}
+	tools := newPdfTools(rendererPath)
+
+	// Determine runTimeout based on context's deadline
+	runTimeout := 30 * time.Second // default timeout for PDFs
+
+	if deadline, ok := httpContext.Deadline(); ok {
+		remaining := time.Until(deadline)
+		if remaining < runTimeout {
+			runTimeout = remaining
+		}
+	}
+
+	var fileBytes []byte
+
+	lockAcquired, err := ctx.locks.PdfGenerationLock.RunWithLockTimeout(
+		resource.ID,
+		30*time.Second, // lockTimeout
+		runTimeout,     // runTimeout
+		func() error {
+			file, openErr := fs.Open(resource.GetCleanLocation())
+			if openErr != nil {
+				return fmt.Errorf("failed to open PDF: %w", openErr)
+			}
+			defer file.Close()
+
+			// The tools need a file path, and the resource may be on an
+			// encrypted or non-local filesystem.
+			tempDir, err := os.MkdirTemp("", "pdf-thumb-*")
+			if err != nil {
+				return fmt.Errorf("failed to create temp directory: %w", err)
+			}
+			defer os.RemoveAll(tempDir)
+
+			input := filepath.Join(tempDir, "input.pdf")
+			dst, err := os.Create(input)
+			if err != nil {
+				return fmt.Errorf("failed to create temp file: %w", err)
+			}
+			if _, err := io.Copy(dst, file); err != nil {
+				dst.Close()
+				return fmt.Errorf("failed to copy to temp file: %w", err)
+			}
+			dst.Close()
+
+			pngPath, err := tools.renderFirstPage(httpContext, input, tempDir)
+			if err != nil {
+				return err
+			}
+			pngData, err := os.ReadFile(pngPath)
+			if err != nil {
+				return fmt.Errorf("failed to read rendered page: %w", err)
+			}
+			img, _, err := image.Decode(bytes.NewReader(pngData))
+			if err != nil {
+				return fmt.Errorf("failed to decode rendered page: %w", err)
+			}
+
+			// Store the full render as the null thumbnail, as for videos, so
+			// later sizes are resized from it without running the renderer.
+			var nullBuf bytes.Buffer
+			if err := imaging.Encode(&nullBuf, img, imaging.JPEG, imaging.JPEGQuality(85)); err != nil {
+				return fmt.Errorf("failed to encode rendered page: %w", err)
+			}
+			nullPreview := &models.Preview{
+				Data:        nullBuf.Bytes(),
+				Width:       0,
+				Height:      0,
+				ContentType: "image/jpeg",
+				ResourceId:  &resource.ID,
+			}
+			if err := ctx.db.WithContext(httpContext).Save(nullPreview).Error; err != nil {
+				log.Printf("Warning: failed to save null thumbnail for resource %d: %v", resource.ID, err)
+			}
+
+			ctx.savePdfDetails(httpContext, resource.ID, tools, input, tempDir)
+
+			newImage := resizeForThumbnail(img, width, height)
+			quality := getJPEGQuality(width, height)
+			var buf bytes.Buffer
+			if err := imaging.Encode(&buf, newImage, imaging.JPEG, imaging.JPEGQuality(quality)); err != nil {
+				return fmt.Errorf("failed to encode resized image: %w", err)
+			}
+
+			fileBytes = buf.Bytes()
+			return nil
+		},
+	)
+
+	if !lockAcquired {
+		return nil, errors.New("failed to acquire PDF generation lock")
+	}
+
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, errors.New("PDF thumbnail generation timed out")
+		}
+		return nil, fmt.Errorf("PDF thumbnail generation error: %w", err)
+	}
+
+	return fileBytes, nil
+}
+
+// savePdfDetails reads the page count and text of the PDF at input and stores
+// them for the resource. Best effort: failures are logged.
+func (ctx *MahresourcesContext) savePdfDetails(httpContext context.Context, resourceID uint, tools pdfTools, input, tempDir string) {
+	if pages, err := tools.pageCount(httpContext, input); err != nil {
+		log.Printf("Warning: could not read the page count of resource %d: %v", resourceID, err)
+	} else if err := ctx.db.WithContext(httpContext).Model(&models.Resource{}).
+		Where("id = ?", resourceID).UpdateColumn("page_count", pages).Error; err != nil {
+		log.Printf("Warning: failed to save the page count of resource %d: %v", resourceID, err)
+	}
+
+	text, err := tools.text(httpContext, input, tempDir)
+	if err != nil {
+		log.Printf("Warning: could not extract the text of resource %d: %v", resourceID, err)
+		return
+	}
+	if err := ctx.db.WithContext(httpContext).Save(&models.ResourceText{ResourceID: resourceID, Text: text}).Error; err != nil {
+		log.Printf("Warning: failed to save the text of resource %d: %v", resourceID, err)
+	}
+}
+
+// GetResourceText returns the text extracted from a resource's file.
+// gorm.ErrRecordNotFound when none has been, or the resource is not visible.
+func (ctx *MahresourcesContext) GetResourceText(resourceId uint) (*models.ResourceText, error) {
+	if !ctx.ResourceVisible(resourceId) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	var text models.ResourceText
+	if err := ctx.db.First(&text, resourceId).Error; err != nil {
+		return nil, err
+	}
+	return &text, nil
+}
@@ -0,0 +1,129 @@
+package application_context
+
+import (
+	"context"
+	"errors"
+	"image/color"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"github.com/spf13/afero"
+	"gorm.io/gorm"
+
+	"mahresources/models"
+)
+
+// fakePoppler writes stand-ins for pdftoppm, pdfinfo and pdftotext into a
+// temporary directory and returns the pdftoppm path. The renderer copies a
+// 300x400 PNG to the requested output prefix.
+func fakePoppler(t *testing.T) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake PDF tools are shell scripts")
+	}
+	dir := t.TempDir()
+	page := filepath.Join(dir, "page.png")
+	if err := imaging.Save(imaging.New(300, 400, color.White), page); err != nil {
+		t.Fatalf("save page: %v", err)
+	}
+	scripts := map[string]string{
+		// pdftoppm ... <input> <output-prefix>
+		"pdftoppm": "for last; do :; done\ncp '" + page + "' \"$last.png\"\n",
+		"pdfinfo":  "echo 'Title: Report'\necho 'Pages:          3'\n",
+		// pdftotext -enc UTF-8 <input> <output>
+		"pdftotext": "for last; do :; done\nprintf 'Quarterly report\\000\\fPage two\\n' > \"$last\"\n",
+	}
+	for name, body := range scripts {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+body), 0755); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	return filepath.Join(dir, "pdftoppm")
+}
+
+func addPdfResource(t *testing.T, ctx *MahresourcesContext) *models.Resource {
+	t.Helper()
+	resource := &models.Resource{Name: "report.pdf", Location: "/resources/report.pdf", ContentType: pdfContentType}
+	if err := afero.WriteFile(ctx.fs, resource.Location, []byte("%PDF-1.4 not really"), 0644); err != nil {
+		t.Fatalf("write pdf: %v", err)
+	}
+	if err := ctx.db.Create(resource).Error; err != nil {
+		t.Fatalf("create resource: %v", err)
+	}
+	return resource
+}
+
+func TestPdfThumbnail_StoresThePageCountAndText(t *testing.T) {
+	ctx := newThumbnailTestContext(t, "pdf_thumbnail_details_test")
+	if err := ctx.db.AutoMigrate(&models.ResourceText{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	ctx.Config.PdfRendererPath = fakePoppler(t)
+	resource := addPdfResource(t, ctx)
+
+	preview, err := ctx.LoadOrCreateThumbnailForResource(resource.ID, 150, 0, context.Background())
+	if err != nil {
+		t.Fatalf("LoadOrCreateThumbnailForResource: %v", err)
+	}
+	if preview == nil {
+		t.Fatal("no thumbnail for a PDF")
+	}
+	if w, h := decodeJPEGOrFail(t, preview.Data); w != 150 || h != 200 {
+		t.Errorf("thumbnail is %dx%d, want 150x200", w, h)
+	}
+	var nullPreviews int64
+	ctx.db.Model(&models.Preview{}).Where("resource_id = ? AND width = 0 AND height = 0", resource.ID).Count(&nullPreviews)
+	if nullPreviews != 1 {
+		t.Errorf("%d null thumbnails, want the rendered page kept as one", nullPreviews)
+	}
+
+	var stored models.Resource
+	ctx.db.First(&stored, resource.ID)
+	if stored.PageCount != 3 {
+		t.Errorf("page count %d, want 3", stored.PageCount)
+	}
+	text, err := ctx.GetResourceText(resource.ID)
+	if err != nil {
+		t.Fatalf("GetResourceText: %v", err)
+	}
+	if text.Text != "Quarterly report\fPage two\n" {
+		t.Errorf("text %q, want the pdftotext output without the NUL", text.Text)
+	}
+
+	// A new file drops what was read from the old one.
+	ctx.OnResourceFileChanged(resource.ID)
+	ctx.db.First(&stored, resource.ID)
+	if stored.PageCount != 0 {
+		t.Errorf("page count %d after the file changed, want 0", stored.PageCount)
+	}
+	if _, err := ctx.GetResourceText(resource.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("text after the file changed: got %v, want gorm.ErrRecordNotFound", err)
+	}
+}
+
+func TestPdfThumbnail_SkipsWithoutARenderer(t *testing.T) {
+	ctx := newThumbnailTestContext(t, "pdf_thumbnail_no_renderer_test")
+	ctx.Config.PdfRendererPath = ""
+	t.Setenv("PATH", t.TempDir())
+	resource := addPdfResource(t, ctx)
+
+	preview, err := ctx.LoadOrCreateThumbnailForResource(resource.ID, 150, 0, context.Background())
+	if err != nil || preview != nil {
+		t.Errorf("got %v, %v; want no thumbnail and no error", preview, err)
+	}
+}
+
+func TestNewPdfTools(t *testing.T) {
+	for path, mutool := range map[string]bool{
+		"/usr/bin/pdftoppm":         false,
+		"/opt/mupdf/bin/mutool":     true,
+		"/usr/local/bin/pdftoppm-2": false,
+	} {
+		if got := newPdfTools(path).mutool; got != mutool {
+			t.Errorf("newPdfTools(%q).mutool = %v, want %v", path, got, mutool)
+		}
+	}
+}
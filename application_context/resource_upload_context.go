@@ -3,8 +3,6 @@ package application_context
 import (
 	"bytes"
 	"context"
-	"crypto/sha1"
-	"encoding/hex"
 	"errors"
 	"fmt"
 	"image"
@@ -15,6 +13,7 @@ import (
 	"mahresources/models"
 	"mahresources/models/query_models"
 	"mahresources/plugin_system"
+	"mahresources/thumbnail_worker"
 	"net"
 	"net/http"
 	"os"
@@ -449,9 +448,7 @@ func (ctx *MahresourcesContext) AddLocalResource(fileName string, resourceQuery
 		return nil, err
 	}
 
-	h := sha1.New()
-	h.Write(fileBytes)
-	hash := hex.EncodeToString(h.Sum(nil))
+	hash, legacyHash := computeContentHash(fileBytes)
 
 	// Decode image dimensions for auto-detect rules (same as AddResource)
 	var width, height int
@@ -514,7 +511,8 @@ func (ctx *MahresourcesContext) AddLocalResource(fileName string, resourceQuery
 	res := &models.Resource{
 		Name:               fileName,
 		Hash:               hash,
-		HashType:           "SHA1",
+		HashType:           models.HashTypeSHA256,
+		LegacyHash:         legacyHash,
 		Location:           resourceQuery.LocalPath,
 		Meta:               []byte(resourceQuery.Meta),
 		OwnMeta:            []byte("{}"),
@@ -539,6 +537,12 @@ func (ctx *MahresourcesContext) AddLocalResource(fileName string, resourceQuery
 		}
 	}()
 
+	if err := ctx.checkStorageQuota(tx, ctx.actingUserIDPtr(), res.OwnerId,
+		map[string]int64{models.QuotaBlobKey(hash, res.HashType, legacyHash): res.FileSize}, 1); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
 	if err := tx.Save(res).Error; err != nil {
 		tx.Rollback()
 		return nil, err
@@ -608,6 +612,7 @@ func (ctx *MahresourcesContext) AddLocalResource(fileName string, resourceQuery
 		VersionNumber:   1,
 		Hash:            res.Hash,
 		HashType:        res.HashType,
+		LegacyHash:      res.LegacyHash,
 		FileSize:        res.FileSize,
 		ContentType:     res.ContentType,
 		Width:           res.Width,
@@ -628,6 +633,11 @@ func (ctx *MahresourcesContext) AddLocalResource(fileName string, resourceQuery
 		return nil, err
 	}
 
+	if err := ctx.refreshStorageUsage(tx, res.ID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
 	if err := tx.Commit().Error; err != nil {
 		return nil, err
 	}
@@ -697,8 +707,10 @@ func (ctx *MahresourcesContext) AddResource(file contracts.File, fileName string
 		return nil, err
 	}
 
-	// Calculate the SHA1 hash of the uploaded file
-	h := sha1.New()
+	// Hash the uploaded file: the SHA-256 names it, and the SHA1 lets it
+	// deduplicate against resources the content hash migration has not
+	// re-hashed yet.
+	h := newContentHasher()
 	if _, err = io.Copy(h, tempFile); err != nil {
 		return nil, err
 	}
@@ -707,7 +719,7 @@ func (ctx *MahresourcesContext) AddResource(file contracts.File, fileName string
 		return nil, err
 	}
 
-	hash := hex.EncodeToString(h.Sum(nil))
+	hash, legacyHash := h.Sums()
 
 	// Pre-compute image dimensions and file size before acquiring lock/transaction,
 	// so that resolveResourceCategory can query the DB without conflicting with
@@ -781,7 +793,7 @@ func (ctx *MahresourcesContext) AddResource(file contracts.File, fileName string
 
 	var existingResource models.Resource
 
-	if existingNotFoundErr := tx.Where("hash = ?", hash).Preload("Groups").First(&existingResource).Error; existingNotFoundErr == nil {
+	if existingNotFoundErr := tx.Scopes(contentHashMatch(hash, legacyHash)).Preload("Groups").First(&existingResource).Error; existingNotFoundErr == nil {
 		if existingResource.OwnerId != nil && resourceQuery.OwnerId == *existingResource.OwnerId {
 			needsCommit := false
 			if len(resourceQuery.Groups) > 0 {
@@ -854,6 +866,12 @@ func (ctx *MahresourcesContext) AddResource(file contracts.File, fileName string
 		return &existingResource, tx.Commit().Error
 	}
 
+	if err := ctx.checkStorageQuota(tx, ctx.actingUserIDPtr(), uintPtrOrNil(resourceQuery.OwnerId),
+		map[string]int64{models.QuotaBlobKey(hash, models.HashTypeSHA256, legacyHash): preFileSize}, 1); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
 	// BH-023: select target filesystem based on PathName (alt-fs key).
 	targetFs := ctx.fs
 	if resourceQuery.PathName != "" {
@@ -895,10 +913,15 @@ func (ctx *MahresourcesContext) AddResource(file contracts.File, fileName string
 		return nil, err
 	}
 
-	defer func(savedFile afero.File) { _ = savedFile.Close() }(savedFile)
-
-	if !fileExists {
+	if fileExists {
+		_ = savedFile.Close()
+	} else {
 		_, err = io.Copy(savedFile, tempFile)
+		// Close is checked, not deferred: an S3 filesystem only stores the
+		// object when the file is closed, so a failed upload surfaces there.
+		if closeErr := savedFile.Close(); err == nil {
+			err = closeErr
+		}
 		if err != nil {
 			tx.Rollback()
 			return nil, err
@@ -938,7 +961,8 @@ func (ctx *MahresourcesContext) AddResource(file contracts.File, fileName string
 	res := &models.Resource{
 		Name:               name,
 		Hash:               hash,
-		HashType:           "SHA1",
+		HashType:           models.HashTypeSHA256,
+		LegacyHash:         legacyHash,
 		Location:           filePath,
 		Meta:               []byte(resourceQuery.Meta),
 		OwnMeta:            []byte("{}"),
@@ -1033,6 +1057,7 @@ func (ctx *MahresourcesContext) AddResource(file contracts.File, fileName string
 		VersionNumber:   1,
 		Hash:            res.Hash,
 		HashType:        res.HashType,
+		LegacyHash:      res.LegacyHash,
 		FileSize:        res.FileSize,
 		ContentType:     res.ContentType,
 		Width:           res.Width,
@@ -1053,6 +1078,11 @@ func (ctx *MahresourcesContext) AddResource(file contracts.File, fileName string
 		return nil, err
 	}
 
+	if err := ctx.refreshStorageUsage(tx, res.ID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
 	if err := tx.Commit().Error; err != nil {
 		return nil, err
 	}
@@ -1075,8 +1105,8 @@ func (ctx *MahresourcesContext) AddResource(file contracts.File, fileName string
 		ctx.QueueForHashing(res.ID)
 	}
 
-	// Queue for async thumbnail pre-generation if it's a video
-	if strings.HasPrefix(res.ContentType, "video/") {
+	// Queue for async thumbnail pre-generation if it's a video or a PDF
+	if thumbnail_worker.IsThumbnailable(res.ContentType) {
 		ctx.QueueForThumbnailing(res.ID)
 	}
 
@@ -25,16 +25,18 @@ import (
 	"mahresources/models/query_models"
 )
 
-// CountHashReferences counts how many resources and versions reference a given hash
-func (ctx *MahresourcesContext) CountHashReferences(hash string) (int64, error) {
+// CountHashReferences counts how many resources and versions reference the
+// content with the given hashes. Callers pass a row's Hash and LegacyHash, so
+// rows the content hash migration has and has not re-hashed are both counted.
+func (ctx *MahresourcesContext) CountHashReferences(hashes ...string) (int64, error) {
 	var versionCount int64
 	var resourceCount int64
 
-	if err := ctx.db.Model(&models.ResourceVersion{}).Where("hash = ?", hash).Count(&versionCount).Error; err != nil {
+	if err := ctx.db.Model(&models.ResourceVersion{}).Scopes(contentHashMatch(hashes...)).Count(&versionCount).Error; err != nil {
 		return 0, err
 	}
 
-	if err := ctx.db.Model(&models.Resource{}).Where("hash = ?", hash).Count(&resourceCount).Error; err != nil {
+	if err := ctx.db.Model(&models.Resource{}).Scopes(contentHashMatch(hashes...)).Count(&resourceCount).Error; err != nil {
 		return 0, err
 	}
 
@@ -65,6 +67,7 @@ func (ctx *MahresourcesContext) GetVersions(resourceID uint) ([]models.ResourceV
 			VersionNumber:   1,
 			Hash:            resource.Hash,
 			HashType:        resource.HashType,
+			LegacyHash:      resource.LegacyHash,
 			FileSize:        resource.FileSize,
 			ContentType:     resource.ContentType,
 			Width:           resource.Width,
@@ -130,6 +133,7 @@ func (ctx *MahresourcesContext) UploadNewVersion(resourceID uint, file multipart
 			VersionNumber:   1,
 			Hash:            resource.Hash,
 			HashType:        resource.HashType,
+			LegacyHash:      resource.LegacyHash,
 			FileSize:        resource.FileSize,
 			ContentType:     resource.ContentType,
 			Width:           resource.Width,
@@ -149,17 +153,22 @@ func (ctx *MahresourcesContext) UploadNewVersion(resourceID uint, file multipart
 	nextVersion := maxVersion + 1
 
 	// Process the file
-	hash, location, fileSize, contentType, width, height, storageLocation, err := ctx.processFileForVersion(file, header)
+	hash, legacyHash, location, fileSize, contentType, width, height, storageLocation, err := ctx.processFileForVersion(file, header)
 	if err != nil {
 		return nil, fmt.Errorf("failed to process file: %w", err)
 	}
 
+	if err := ctx.checkVersionQuota(resource, models.QuotaBlobKey(hash, models.HashTypeSHA256, legacyHash), fileSize); err != nil {
+		return nil, err
+	}
+
 	// Create the version record
 	version := models.ResourceVersion{
 		ResourceID:      resourceID,
 		VersionNumber:   nextVersion,
 		Hash:            hash,
-		HashType:        "SHA1",
+		HashType:        models.HashTypeSHA256,
+		LegacyHash:      legacyHash,
 		FileSize:        fileSize,
 		ContentType:     contentType,
 		Width:           width,
@@ -188,6 +197,7 @@ func (ctx *MahresourcesContext) UploadNewVersion(resourceID uint, file multipart
 		"current_version_id": version.ID,
 		"hash":               version.Hash,
 		"hash_type":          version.HashType,
+		"legacy_hash":        version.LegacyHash,
 		"location":           version.Location,
 		"storage_location":   version.StorageLocation,
 		"content_type":       version.ContentType,
@@ -219,13 +229,13 @@ func (ctx *MahresourcesContext) UploadNewVersion(resourceID uint, file multipart
 }
 
 // processFileForVersion handles file storage and returns metadata
-func (ctx *MahresourcesContext) processFileForVersion(file multipart.File, header *multipart.FileHeader) (string, string, int64, string, uint, uint, *string, error) {
+func (ctx *MahresourcesContext) processFileForVersion(file multipart.File, header *multipart.FileHeader) (string, string, string, int64, string, uint, uint, *string, error) {
 	content, err := io.ReadAll(file)
 	if err != nil {
-		return "", "", 0, "", 0, 0, nil, err
+		return "", "", "", 0, "", 0, 0, nil, err
 	}
 
-	hash := computeSHA1(content)
+	hash, legacyHash := computeContentHash(content)
 	fileSize := int64(len(content))
 	contentType := detectContentType(content)
 	width, height := getDimensionsFromContent(content, contentType)
@@ -235,11 +245,11 @@ func (ctx *MahresourcesContext) processFileForVersion(file multipart.File, heade
 	// Deduplication: only store if file doesn't exist
 	if exists, _ := afero.Exists(ctx.fs, location); !exists {
 		if err := ctx.storeVersionFile(location, content); err != nil {
-			return "", "", 0, "", 0, 0, nil, err
+			return "", "", "", 0, "", 0, 0, nil, err
 		}
 	}
 
-	return hash, location, fileSize, contentType, width, height, nil, nil
+	return hash, legacyHash, location, fileSize, contentType, width, height, nil, nil
 }
 
 func (ctx *MahresourcesContext) storeVersionFile(location string, content []byte) error {
@@ -252,9 +262,11 @@ func (ctx *MahresourcesContext) storeVersionFile(location string, content []byte
 	if err != nil {
 		return err
 	}
-	defer f.Close()
 
 	_, err = f.Write(content)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
 	return err
 }
 
@@ -333,6 +345,7 @@ func (ctx *MahresourcesContext) RestoreVersion(resourceID, versionID uint, comme
 		VersionNumber:   nextVersion,
 		Hash:            sourceVersion.Hash,
 		HashType:        sourceVersion.HashType,
+		LegacyHash:      sourceVersion.LegacyHash,
 		FileSize:        sourceVersion.FileSize,
 		ContentType:     sourceVersion.ContentType,
 		Width:           sourceVersion.Width,
@@ -361,6 +374,7 @@ func (ctx *MahresourcesContext) RestoreVersion(resourceID, versionID uint, comme
 		"current_version_id": version.ID,
 		"hash":               version.Hash,
 		"hash_type":          version.HashType,
+		"legacy_hash":        version.LegacyHash,
 		"location":           version.Location,
 		"storage_location":   version.StorageLocation,
 		"content_type":       version.ContentType,
@@ -417,7 +431,7 @@ func (ctx *MahresourcesContext) DeleteVersion(resourceID, versionID uint) error
 		return errors.New("cannot delete last version - delete the resource instead")
 	}
 
-	hash := version.Hash
+	hash, legacyHash := version.Hash, version.LegacyHash
 	location := version.Location
 	storageLocation := version.StorageLocation
 
@@ -425,7 +439,7 @@ func (ctx *MahresourcesContext) DeleteVersion(resourceID, versionID uint) error
 		return fmt.Errorf("failed to delete version: %w", err)
 	}
 
-	refCount, err := ctx.CountHashReferences(hash)
+	refCount, err := ctx.CountHashReferences(hash, legacyHash)
 	if err != nil {
 		ctx.Logger().Warning(models.LogActionDelete, "resource_version", &versionID, "Failed to count hash references", err.Error(), nil)
 	} else if refCount == 0 {
@@ -435,6 +449,8 @@ func (ctx *MahresourcesContext) DeleteVersion(resourceID, versionID uint) error
 		}
 	}
 
+	ctx.logStorageUsageError(resourceID, ctx.refreshStorageUsage(ctx.db, resourceID))
+
 	ctx.Logger().Info(models.LogActionDelete, "resource_version", &versionID, fmt.Sprintf("v%d of resource %d", version.VersionNumber, resourceID), "", nil)
 
 	return nil
@@ -789,6 +805,7 @@ func (ctx *MahresourcesContext) MigrateResourceVersions() error {
 				VersionNumber:   1,
 				Hash:            resource.Hash,
 				HashType:        resource.HashType,
+				LegacyHash:      resource.LegacyHash,
 				FileSize:        resource.FileSize,
 				ContentType:     resource.ContentType,
 				Width:           resource.Width,
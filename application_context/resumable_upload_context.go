@@ -0,0 +1,403 @@
+package application_context
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/spf13/afero"
+	"gorm.io/gorm"
+
+	"mahresources/models"
+	"mahresources/models/query_models"
+	"mahresources/models/types"
+)
+
+var (
+	ErrResumableUploadNotFound = errors.New("upload not found")
+	// ErrResumableUploadOffset is a chunk that does not start where the upload
+	// stands; the client should ask for the offset and resume from there.
+	ErrResumableUploadOffset = errors.New("Upload-Offset does not match the upload's offset")
+	// ErrResumableUploadBusy is a chunk sent while another request is still
+	// writing to the same upload.
+	ErrResumableUploadBusy     = errors.New("another request is writing to this upload")
+	ErrResumableUploadTooLarge = errors.New("the chunk runs past the upload's length")
+)
+
+// DefaultResumableUploadExpiry is how long an unfinished upload is kept after
+// its last chunk when the config leaves ResumableUploadExpiry unset.
+const DefaultResumableUploadExpiry = 24 * time.Hour
+
+// resumableUploadRoot holds one directory of chunks per upload on the main
+// filesystem. Each chunk is its own file, named for the offset it starts at:
+// the encrypted and S3 filesystems cannot append to a file, so a chunk is
+// never added to one that already exists.
+const resumableUploadRoot = "_uploads"
+
+// resumableUploadAssembled is the file the chunks are joined into once all of
+// them have arrived, inside the upload's directory.
+const resumableUploadAssembled = "assembled"
+
+func resumableUploadDir(id string) string {
+	return path.Join(resumableUploadRoot, id)
+}
+
+func resumableUploadChunk(id string, offset int64) string {
+	return path.Join(resumableUploadDir(id), fmt.Sprintf("%020d", offset))
+}
+
+// ResumableUploadExpiry is how long an unfinished upload is kept after its
+// last chunk.
+func (ctx *MahresourcesContext) ResumableUploadExpiry() time.Duration {
+	if ctx.Config == nil || ctx.Config.ResumableUploadExpiry <= 0 {
+		return DefaultResumableUploadExpiry
+	}
+	return ctx.Config.ResumableUploadExpiry
+}
+
+// CreateResumableUpload starts an upload of length bytes. metadata carries the
+// file name and the fields the resource or version is created with once the
+// last chunk arrives; the caller has already checked them.
+func (ctx *MahresourcesContext) CreateResumableUpload(kind string, length int64, metadata map[string]string, ownerUserID *uint) (*models.ResumableUpload, error) {
+	if kind != models.ResumableUploadResource && kind != models.ResumableUploadVersion {
+		return nil, fmt.Errorf("unknown upload kind %q", kind)
+	}
+	if length < 0 {
+		return nil, errors.New("Upload-Length must not be negative")
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("reading random bytes for an upload id: %w", err)
+	}
+	meta, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, err
+	}
+	upload := &models.ResumableUpload{
+		ID:          hex.EncodeToString(b),
+		ExpiresAt:   time.Now().Add(ctx.ResumableUploadExpiry()),
+		OwnerUserID: ownerUserID,
+		Kind:        kind,
+		Length:      length,
+		Metadata:    types.JSON(meta),
+	}
+	if err := ctx.fs.MkdirAll(resumableUploadDir(upload.ID), 0755); err != nil {
+		return nil, err
+	}
+	if err := ctx.db.Create(upload).Error; err != nil {
+		_ = ctx.fs.RemoveAll(resumableUploadDir(upload.ID))
+		return nil, err
+	}
+	return upload, nil
+}
+
+// GetResumableUpload loads an upload the caller may see. An upload that has
+// expired, or that belongs to another user when ownerRestricted is set, is
+// reported as not found.
+func (ctx *MahresourcesContext) GetResumableUpload(id string, ownerUserID *uint, ownerRestricted bool) (*models.ResumableUpload, error) {
+	var upload models.ResumableUpload
+	q := ctx.db.Where("id = ? AND expires_at > ?", id, time.Now())
+	if ownerRestricted {
+		q = q.Where("owner_user_id = ?", ownerUserID)
+	}
+	if err := q.First(&upload).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrResumableUploadNotFound
+		}
+		return nil, err
+	}
+	return &upload, nil
+}
+
+// ResumableUploadMetadata decodes the metadata the upload was created with.
+func ResumableUploadMetadata(upload *models.ResumableUpload) map[string]string {
+	meta := map[string]string{}
+	if len(upload.Metadata) > 0 {
+		_ = json.Unmarshal(upload.Metadata, &meta)
+	}
+	return meta
+}
+
+// WriteResumableUpload stores the chunk read from body, which must start at
+// offset, and returns the upload as it stands afterwards.
+//
+// A body cut short, by a dropped connection for instance, keeps the bytes that
+// did arrive: the upload's offset moves past them and the copy error is
+// returned with the upload, so the client resumes from there. A body longer
+// than the bytes the upload still expects is discarded whole.
+func (ctx *MahresourcesContext) WriteResumableUpload(id string, ownerUserID *uint, ownerRestricted bool, offset int64, body io.Reader) (*models.ResumableUpload, error) {
+	if !ctx.locks.ResumableUploadLock.AcquireWithTimeout(id, 0) {
+		return nil, ErrResumableUploadBusy
+	}
+	defer ctx.locks.ResumableUploadLock.Release(id)
+
+	upload, err := ctx.GetResumableUpload(id, ownerUserID, ownerRestricted)
+	if err != nil {
+		return nil, err
+	}
+	if offset != upload.Offset {
+		return upload, ErrResumableUploadOffset
+	}
+	remaining := upload.Length - upload.Offset
+	if remaining == 0 || upload.FinishedAt != nil {
+		return upload, nil
+	}
+
+	chunkPath := resumableUploadChunk(id, offset)
+	f, err := ctx.fs.Create(chunkPath)
+	if err != nil {
+		return nil, err
+	}
+	n, copyErr := io.Copy(f, io.LimitReader(body, remaining+1))
+	if closeErr := f.Close(); closeErr != nil {
+		// Nothing in a chunk that could not be closed can be trusted to be
+		// on disk, so none of it counts.
+		_ = ctx.fs.Remove(chunkPath)
+		return nil, closeErr
+	}
+	if n > remaining {
+		_ = ctx.fs.Remove(chunkPath)
+		return upload, ErrResumableUploadTooLarge
+	}
+	if n == 0 {
+		_ = ctx.fs.Remove(chunkPath)
+		return upload, copyErr
+	}
+
+	upload.Offset += n
+	upload.ExpiresAt = time.Now().Add(ctx.ResumableUploadExpiry())
+	if err := ctx.db.Model(upload).UpdateColumns(map[string]any{
+		"offset":     upload.Offset,
+		"expires_at": upload.ExpiresAt,
+		"updated_at": time.Now(),
+	}).Error; err != nil {
+		return nil, err
+	}
+	return upload, copyErr
+}
+
+// CompleteResumableUpload creates the resource, or the new version, from an
+// upload whose last chunk has arrived. creator carries the resource's fields
+// and is unused for a version. Completing an upload twice returns what the
+// first completion created. An upload whose metadata sets "expand" starts an
+// archive expansion of the file instead of creating a resource.
+//
+// A failed completion keeps the chunks, so it can be retried until the upload
+// expires.
+func (ctx *MahresourcesContext) CompleteResumableUpload(id string, creator *query_models.ResourceCreator) (*models.ResumableUpload, error) {
+	if !ctx.locks.ResumableUploadLock.AcquireWithTimeout(id, 0) {
+		return nil, ErrResumableUploadBusy
+	}
+	defer ctx.locks.ResumableUploadLock.Release(id)
+
+	upload, err := ctx.GetResumableUpload(id, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	if upload.FinishedAt != nil {
+		return upload, nil
+	}
+	file, err := ctx.assembleResumableUpload(upload)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	meta := ResumableUploadMetadata(upload)
+	expand, _ := strconv.ParseBool(meta["expand"])
+	var resourceID, versionID, expansionID *uint
+	switch {
+	case upload.Kind == models.ResumableUploadVersion:
+		rid, err := strconv.ParseUint(meta["resourceId"], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("upload %s names no resource: %w", id, err)
+		}
+		header := &multipart.FileHeader{Filename: meta["filename"], Size: upload.Length}
+		version, err := ctx.UploadNewVersion(uint(rid), file, header, meta["comment"])
+		if err != nil {
+			return nil, err
+		}
+		resourceID, versionID = &version.ResourceID, &version.ID
+	case expand:
+		expansion, err := ctx.StartArchiveExpansion(file, meta["filename"], creator)
+		if err != nil {
+			return nil, err
+		}
+		expansionID = &expansion.ID
+	default:
+		if creator == nil {
+			creator = &query_models.ResourceCreator{}
+		}
+		resource, err := ctx.AddResource(file, meta["filename"], creator)
+		if err != nil {
+			return nil, err
+		}
+		resourceID = &resource.ID
+	}
+
+	// The file is closed before its directory is removed.
+	_ = file.Close()
+	now := time.Now()
+	upload.FinishedAt = &now
+	upload.ResourceID = resourceID
+	upload.VersionID = versionID
+	upload.ExpansionID = expansionID
+	if err := ctx.db.Model(upload).UpdateColumns(map[string]any{
+		"finished_at":  upload.FinishedAt,
+		"resource_id":  upload.ResourceID,
+		"version_id":   upload.VersionID,
+		"expansion_id": upload.ExpansionID,
+		"updated_at":   now,
+	}).Error; err != nil {
+		return nil, err
+	}
+	// The row is kept until it expires, so a client that lost the final
+	// response can still ask what came of the upload; the chunks are not.
+	if err := ctx.fs.RemoveAll(resumableUploadDir(id)); err != nil {
+		log.Printf("warning: removing the chunks of upload %s: %v", id, err)
+	}
+	return upload, nil
+}
+
+// assembleResumableUpload joins the chunks of a complete upload into one file
+// and opens it.
+func (ctx *MahresourcesContext) assembleResumableUpload(upload *models.ResumableUpload) (afero.File, error) {
+	if upload.Offset != upload.Length {
+		return nil, fmt.Errorf("upload %s has %d of %d bytes", upload.ID, upload.Offset, upload.Length)
+	}
+	dir := resumableUploadDir(upload.ID)
+	entries, err := afero.ReadDir(ctx.fs, dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var offsets []int64
+	for _, entry := range entries {
+		if start, err := strconv.ParseInt(entry.Name(), 10, 64); err == nil {
+			offsets = append(offsets, start)
+		}
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+
+	assembledPath := path.Join(dir, resumableUploadAssembled)
+	if err := ctx.fs.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	out, err := ctx.fs.Create(assembledPath)
+	if err != nil {
+		return nil, err
+	}
+	var written int64
+	for _, start := range offsets {
+		if start >= upload.Length {
+			break
+		}
+		if start != written {
+			_ = out.Close()
+			return nil, fmt.Errorf("upload %s is missing bytes %d to %d", upload.ID, written, start)
+		}
+		n, err := ctx.copyResumableChunk(out, resumableUploadChunk(upload.ID, start))
+		written += n
+		if err != nil {
+			_ = out.Close()
+			return nil, err
+		}
+	}
+	if err := out.Close(); err != nil {
+		return nil, err
+	}
+	if written != upload.Length {
+		return nil, fmt.Errorf("upload %s has %d staged bytes, want %d", upload.ID, written, upload.Length)
+	}
+	return ctx.fs.Open(assembledPath)
+}
+
+func (ctx *MahresourcesContext) copyResumableChunk(dst io.Writer, chunkPath string) (int64, error) {
+	f, err := ctx.fs.Open(chunkPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return io.Copy(dst, f)
+}
+
+// DeleteResumableUpload abandons an upload and deletes its staged chunks. A
+// resource or version it already created is left alone.
+func (ctx *MahresourcesContext) DeleteResumableUpload(id string, ownerUserID *uint, ownerRestricted bool) error {
+	if !ctx.locks.ResumableUploadLock.AcquireWithTimeout(id, 0) {
+		return ErrResumableUploadBusy
+	}
+	defer ctx.locks.ResumableUploadLock.Release(id)
+
+	upload, err := ctx.GetResumableUpload(id, ownerUserID, ownerRestricted)
+	if err != nil {
+		return err
+	}
+	if err := ctx.db.Delete(upload).Error; err != nil {
+		return err
+	}
+	return ctx.fs.RemoveAll(resumableUploadDir(id))
+}
+
+// SweepExpiredResumableUploads deletes uploads past their expiry, and any
+// staging directory no upload refers to, and returns how many uploads went.
+func (ctx *MahresourcesContext) SweepExpiredResumableUploads() (int, error) {
+	if ctx == nil || ctx.db == nil || ctx.fs == nil {
+		return 0, nil
+	}
+	var expired []string
+	if err := ctx.db.Model(&models.ResumableUpload{}).
+		Where("expires_at <= ?", time.Now()).
+		Pluck("id", &expired).Error; err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, id := range expired {
+		if !ctx.locks.ResumableUploadLock.AcquireWithTimeout(id, 0) {
+			// A chunk is being written right now, which will move the
+			// expiry forward.
+			continue
+		}
+		err := ctx.db.Where("id = ? AND expires_at <= ?", id, time.Now()).Delete(&models.ResumableUpload{}).Error
+		if err == nil {
+			err = ctx.fs.RemoveAll(resumableUploadDir(id))
+		}
+		ctx.locks.ResumableUploadLock.Release(id)
+		if err != nil {
+			return removed, err
+		}
+		removed++
+	}
+
+	// A directory without a row is left from an upload whose row went but
+	// whose chunks could not be removed at the time.
+	entries, err := afero.ReadDir(ctx.fs, resumableUploadRoot)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return removed, nil
+		}
+		return removed, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || time.Since(entry.ModTime()) < ctx.ResumableUploadExpiry() {
+			continue
+		}
+		var count int64
+		if err := ctx.db.Model(&models.ResumableUpload{}).Where("id = ?", entry.Name()).Count(&count).Error; err != nil {
+			return removed, err
+		}
+		if count == 0 {
+			_ = ctx.fs.RemoveAll(resumableUploadDir(entry.Name()))
+		}
+	}
+	return removed, nil
+}
@@ -0,0 +1,107 @@
+package application_context
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+
+	"mahresources/models"
+	"mahresources/models/query_models"
+)
+
+// failingReader yields its data and then fails, as a request body does when
+// the connection drops mid-chunk.
+type failingReader struct{ data []byte }
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestResumableUpload_KeepsWhatArrivedBeforeADroppedConnection(t *testing.T) {
+	ctx, fs := createScrubTestContext(t, "resumable_upload_test")
+	content := []byte("a file sent over a flaky link, in three pieces")
+
+	upload, err := ctx.CreateResumableUpload(models.ResumableUploadResource, int64(len(content)), map[string]string{"filename": "flaky.txt"}, nil)
+	if err != nil {
+		t.Fatalf("CreateResumableUpload: %v", err)
+	}
+
+	got, err := ctx.WriteResumableUpload(upload.ID, nil, false, 0, &failingReader{data: content[:10]})
+	if !errors.Is(err, io.ErrUnexpectedEOF) || got == nil || got.Offset != 10 {
+		t.Fatalf("a dropped chunk left offset %v, %v; want the 10 bytes that arrived", got, err)
+	}
+	if _, err := ctx.WriteResumableUpload(upload.ID, nil, false, 0, bytes.NewReader(content)); !errors.Is(err, ErrResumableUploadOffset) {
+		t.Fatalf("a chunk at a stale offset: %v, want ErrResumableUploadOffset", err)
+	}
+	owner := uint(5)
+	if _, err := ctx.WriteResumableUpload(upload.ID, &owner, true, 10, bytes.NewReader(content[10:])); !errors.Is(err, ErrResumableUploadNotFound) {
+		t.Fatalf("another user's chunk: %v, want ErrResumableUploadNotFound", err)
+	}
+	if _, err := ctx.WriteResumableUpload(upload.ID, nil, false, 10, bytes.NewReader(content[10:30])); err != nil {
+		t.Fatalf("second chunk: %v", err)
+	}
+	got, err = ctx.WriteResumableUpload(upload.ID, nil, false, 30, bytes.NewReader(content[30:]))
+	if err != nil || got.Offset != int64(len(content)) {
+		t.Fatalf("last chunk: offset %d, %v", got.Offset, err)
+	}
+
+	done, err := ctx.CompleteResumableUpload(upload.ID, &query_models.ResourceCreator{})
+	if err != nil {
+		t.Fatalf("CompleteResumableUpload: %v", err)
+	}
+	if done.ResourceID == nil || done.FinishedAt == nil {
+		t.Fatal("the completed upload does not name its resource")
+	}
+	var resource models.Resource
+	if err := ctx.db.First(&resource, *done.ResourceID).Error; err != nil {
+		t.Fatalf("load resource: %v", err)
+	}
+	if stored, _ := afero.ReadFile(fs, resource.Location); !bytes.Equal(stored, content) {
+		t.Errorf("the resource's file = %q", stored)
+	}
+	if resource.Name != "flaky.txt" {
+		t.Errorf("Name = %q, want the file name", resource.Name)
+	}
+	if exists, _ := afero.DirExists(fs, resumableUploadDir(upload.ID)); exists {
+		t.Error("the chunks were left behind")
+	}
+
+	again, err := ctx.CompleteResumableUpload(upload.ID, &query_models.ResourceCreator{})
+	if err != nil || *again.ResourceID != *done.ResourceID {
+		t.Errorf("completing twice created another resource: %v", err)
+	}
+}
+
+func TestResumableUpload_SweepDeletesExpiredUploads(t *testing.T) {
+	ctx, fs := createScrubTestContext(t, "resumable_upload_sweep_test")
+
+	stale, _ := ctx.CreateResumableUpload(models.ResumableUploadResource, 100, nil, nil)
+	fresh, _ := ctx.CreateResumableUpload(models.ResumableUploadResource, 100, nil, nil)
+	if _, err := ctx.WriteResumableUpload(stale.ID, nil, false, 0, bytes.NewReader(make([]byte, 40))); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	ctx.db.Model(&models.ResumableUpload{}).Where("id = ?", stale.ID).Update("expires_at", time.Now().Add(-time.Minute))
+
+	if _, err := ctx.WriteResumableUpload(stale.ID, nil, false, 40, bytes.NewReader(make([]byte, 10))); !errors.Is(err, ErrResumableUploadNotFound) {
+		t.Errorf("an expired upload took a chunk: %v", err)
+	}
+	removed, err := ctx.SweepExpiredResumableUploads()
+	if err != nil || removed != 1 {
+		t.Fatalf("swept %d, %v; want 1", removed, err)
+	}
+	if exists, _ := afero.DirExists(fs, resumableUploadDir(stale.ID)); exists {
+		t.Error("the expired upload's chunks were left behind")
+	}
+	if _, err := ctx.GetResumableUpload(fresh.ID, nil, false); err != nil {
+		t.Errorf("the fresh upload was swept: %v", err)
+	}
+}
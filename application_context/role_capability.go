@@ -40,6 +40,14 @@ func (ctx *MahresourcesContext) requireEditorRole(op string) error {
 	return ctx.requireRole(op, func() bool { return ctx.Principal().CanEditorWrite() })
 }
 
+// requireWriteRole refuses op unless the acting principal may write at all.
+// Most writes need no such check because server/authz_policy.go refuses a
+// guest's POST by path; MRQL mutations are the exception that reaches bulk
+// edits from a query, so the plan step checks before resolving anything.
+func (ctx *MahresourcesContext) requireWriteRole(op string) error {
+	return ctx.requireRole(op, func() bool { return ctx.Principal().CanWrite() })
+}
+
 // requireRole is the shared body, and the one place the fail-open rule is
 // stated.
 //
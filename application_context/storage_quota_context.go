@@ -0,0 +1,659 @@
+package application_context
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"mahresources/models"
+)
+
+// Storage quotas.
+//
+// Usage is kept incrementally. Each resource records in storage_charges the
+// files it is charged for: its own file and its versions', once each, charged
+// to the user who created it and the group that owns it. Whenever a resource
+// is created, changes files, changes owner or is deleted, refreshStorageUsage
+// takes back its old charges and makes its new ones.
+//
+// A file shared between resources, which is what deduplication produces,
+// counts once per user and once per group however many of their resources hold
+// it: storage_usage_blobs counts the holders, and the file's size is added to
+// the subject's usage only with the first and removed only with the last.
+//
+// A group quota covers the group's whole subtree. Each group's usage covers
+// only the resources it owns directly, and a subtree's is summed over its
+// groups when it is checked, so moving groups around needs no accounting.
+
+// ErrStorageQuotaNotFound is returned for a quota that is not set.
+var ErrStorageQuotaNotFound = errors.New("storage quota not found")
+
+// QuotaExceededError is returned when storing a file would take a user, or a
+// group's subtree, past its quota. Callers map it to HTTP 507.
+type QuotaExceededError struct {
+	SubjectType string
+	SubjectID   uint
+	SubjectName string
+	// Resources is set when the resource count is what is over, rather than
+	// the bytes.
+	Resources bool
+	Limit     int64
+	Used      int64
+	Adding    int64
+}
+
+func (e *QuotaExceededError) Error() string {
+	who := fmt.Sprintf("user %q", e.SubjectName)
+	if e.SubjectType == models.QuotaSubjectGroup {
+		who = fmt.Sprintf("group %q and its subgroups", e.SubjectName)
+	}
+	if e.Resources {
+		return fmt.Sprintf("storage quota exceeded: limit of %d resources reached for %s (%d held)", e.Limit, who, e.Used)
+	}
+	return fmt.Sprintf("storage quota exceeded: limit of %s for %s (%s used, %s more needed)", formatBytes(e.Limit), who, formatBytes(e.Used), formatBytes(e.Adding))
+}
+
+// StorageQuotaStatus is a quota with its subject's current usage.
+type StorageQuotaStatus struct {
+	models.StorageQuota
+	SubjectName   string `json:"subjectName"`
+	MaxBytesFmt   string `json:"maxBytesFmt"`
+	UsedBytes     int64  `json:"usedBytes"`
+	UsedBytesFmt  string `json:"usedBytesFmt"`
+	UsedResources int64  `json:"usedResources"`
+	// Exceeded is set when usage is at or past either limit, so the next
+	// upload would be refused.
+	Exceeded bool `json:"exceeded"`
+}
+
+// storageQuotaSubtreeCTE resolves a group's subtree for the usage queries.
+// UNION keeps a cycle in the group tree from recursing forever, as in
+// collectSubtreeGroupIDs.
+const storageQuotaSubtreeCTE = `WITH RECURSIVE quota_tree AS (
+	SELECT id FROM groups WHERE id = ?
+	UNION
+	SELECT g.id FROM groups g JOIN quota_tree ON g.owner_id = quota_tree.id
+) `
+
+// quotaSubject returns the SQL prefix, the WHERE clause over storage_usages or
+// storage_usage_blobs and its arguments that select what q covers.
+func quotaSubject(q models.StorageQuota) (string, string, []any) {
+	if q.SubjectType == models.QuotaSubjectGroup {
+		return storageQuotaSubtreeCTE, "subject_type = ? AND subject_id IN (SELECT id FROM quota_tree)", []any{q.SubjectID, q.SubjectType}
+	}
+	return "", "subject_type = ? AND subject_id = ?", []any{q.SubjectType, q.SubjectID}
+}
+
+// quotaUsage returns the bytes and resources q's subject holds.
+func quotaUsage(db *gorm.DB, q models.StorageQuota) (bytes, resources int64, err error) {
+	prefix, where, args := quotaSubject(q)
+	if q.SubjectType == models.QuotaSubjectUser {
+		var usage models.StorageUsage
+		err = db.Where(where, args...).Limit(1).Find(&usage).Error
+		return usage.Bytes, usage.Resources, err
+	}
+	// Files shared between groups of the subtree count once.
+	if err = db.Raw(prefix+`SELECT COALESCE(SUM(file_size), 0) FROM (
+		SELECT blob_key, MAX(file_size) AS file_size FROM storage_usage_blobs WHERE `+where+` GROUP BY blob_key
+	) AS subtree_blobs`, args...).Scan(&bytes).Error; err != nil {
+		return 0, 0, err
+	}
+	err = db.Raw(prefix+`SELECT COALESCE(SUM(resources), 0) FROM storage_usages WHERE `+where, args...).Scan(&resources).Error
+	return bytes, resources, err
+}
+
+// quotaNewBytes returns how many of blobs' bytes q's subject does not hold
+// yet. A blob with an empty key is not known yet and always counts.
+func quotaNewBytes(db *gorm.DB, q models.StorageQuota, blobs map[string]int64) (int64, error) {
+	keys := make([]string, 0, len(blobs))
+	for key := range blobs {
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	held := map[string]bool{}
+	if len(keys) > 0 {
+		prefix, where, args := quotaSubject(q)
+		var heldKeys []string
+		if err := db.Raw(prefix+`SELECT DISTINCT blob_key FROM storage_usage_blobs WHERE `+where+` AND blob_key IN ?`, append(args, keys)...).Scan(&heldKeys).Error; err != nil {
+			return 0, err
+		}
+		for _, key := range heldKeys {
+			held[key] = true
+		}
+	}
+	var added int64
+	for key, size := range blobs {
+		if key == "" || !held[key] {
+			added += size
+		}
+	}
+	return added, nil
+}
+
+// checkStorageQuota refuses storing blobs (quota blob key → size) and
+// newResources more resources when that would take the user, or the subtree of
+// any group on the owner's path to the root, past a quota. Storing nothing a
+// subject does not already hold is never refused, even past its quota.
+func (ctx *MahresourcesContext) checkStorageQuota(db *gorm.DB, userID, ownerID *uint, blobs map[string]int64, newResources int64) error {
+	if !hasStorageQuotaTables(db) {
+		return nil
+	}
+	// The quota applies wherever the caller may see: a scoped principal's
+	// handle would hide the groups above its scope group.
+	db = db.WithContext(context.Background())
+
+	var quotas []models.StorageQuota
+	if userID != nil {
+		if err := db.Where("subject_type = ? AND subject_id = ?", models.QuotaSubjectUser, *userID).Find(&quotas).Error; err != nil {
+			return err
+		}
+	}
+	if ownerID != nil {
+		var groupQuotas []models.StorageQuota
+		if err := db.Raw(`WITH RECURSIVE quota_path AS (
+			SELECT id, owner_id FROM groups WHERE id = ?
+			UNION
+			SELECT g.id, g.owner_id FROM groups g JOIN quota_path ON g.id = quota_path.owner_id
+		)
+		SELECT q.* FROM storage_quotas q JOIN quota_path ON q.subject_id = quota_path.id
+		WHERE q.subject_type = ?`, *ownerID, models.QuotaSubjectGroup).Scan(&groupQuotas).Error; err != nil {
+			return err
+		}
+		quotas = append(quotas, groupQuotas...)
+	}
+
+	for _, q := range quotas {
+		if q.MaxBytes <= 0 && q.MaxResources <= 0 {
+			continue
+		}
+		usedBytes, usedResources, err := quotaUsage(db, q)
+		if err != nil {
+			return err
+		}
+		if q.MaxResources > 0 && newResources > 0 && usedResources+newResources > q.MaxResources {
+			return ctx.quotaExceeded(db, q, true, usedResources, newResources)
+		}
+		if q.MaxBytes <= 0 {
+			continue
+		}
+		added, err := quotaNewBytes(db, q, blobs)
+		if err != nil {
+			return err
+		}
+		if added > 0 && usedBytes+added > q.MaxBytes {
+			return ctx.quotaExceeded(db, q, false, usedBytes, added)
+		}
+	}
+	return nil
+}
+
+func (ctx *MahresourcesContext) quotaExceeded(db *gorm.DB, q models.StorageQuota, resources bool, used, adding int64) error {
+	limit := q.MaxBytes
+	if resources {
+		limit = q.MaxResources
+	}
+	return &QuotaExceededError{
+		SubjectType: q.SubjectType,
+		SubjectID:   q.SubjectID,
+		SubjectName: quotaSubjectName(db, q),
+		Resources:   resources,
+		Limit:       limit,
+		Used:        used,
+		Adding:      adding,
+	}
+}
+
+// quotaSubjectName returns the user's name or the group's, or its id when it
+// no longer exists.
+func quotaSubjectName(db *gorm.DB, q models.StorageQuota) string {
+	var names []string
+	if q.SubjectType == models.QuotaSubjectUser {
+		db.Model(&models.User{}).Where("id = ?", q.SubjectID).Limit(1).Pluck("username", &names)
+	} else {
+		db.Model(&models.Group{}).Where("id = ?", q.SubjectID).Limit(1).Pluck("name", &names)
+	}
+	if len(names) == 0 {
+		return fmt.Sprintf("#%d", q.SubjectID)
+	}
+	return names[0]
+}
+
+// CheckUploadQuota refuses ahead of time an upload of size bytes that could not
+// be stored: a new resource under ownerID, or with resourceID set a new
+// version of that resource. The file's content is not known yet, so all of it
+// counts as new.
+func (ctx *MahresourcesContext) CheckUploadQuota(resourceID, ownerID uint, size int64) error {
+	blobs := map[string]int64{"": size}
+	if resourceID == 0 {
+		return ctx.checkStorageQuota(ctx.db, ctx.actingUserIDPtr(), uintPtrOrNil(ownerID), blobs, 1)
+	}
+	var resource models.Resource
+	if err := ctx.db.Select("id", "owner_id", "created_by_user_id").First(&resource, resourceID).Error; err != nil {
+		return err
+	}
+	return ctx.checkStorageQuota(ctx.db, resource.CreatedByUserId, resource.OwnerId, blobs, 0)
+}
+
+// checkVersionQuota refuses a new version of resource holding the file key
+// when that would exceed a quota. A resource's versions are charged to the
+// user who created it, whoever uploads them.
+func (ctx *MahresourcesContext) checkVersionQuota(resource *models.Resource, key string, size int64) error {
+	return ctx.checkStorageQuota(ctx.db, resource.CreatedByUserId, resource.OwnerId, map[string]int64{key: size}, 0)
+}
+
+// refreshStorageUsage brings the charges of the given resources in line with
+// their current files, owner and creator, and a deleted resource's to nothing.
+// Run it on the handle that made the change, inside its transaction when there
+// is one.
+func (ctx *MahresourcesContext) refreshStorageUsage(db *gorm.DB, resourceIDs ...uint) error {
+	// Charges follow the resource wherever it is, including out of the
+	// subtree a scoped caller can see.
+	db = db.WithContext(context.Background())
+	if len(resourceIDs) == 0 || !hasStorageQuotaTables(db) {
+		return nil
+	}
+	for _, id := range resourceIDs {
+		if err := refreshResourceCharges(db, id); err != nil {
+			return fmt.Errorf("storage usage of resource %d: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// logStorageUsageError records a failed refresh after a change that has
+// already committed. The resource's charges are corrected by its next change
+// or by a recount.
+func (ctx *MahresourcesContext) logStorageUsageError(resourceID uint, err error) {
+	if err != nil {
+		ctx.Logger().Warning(models.LogActionSystem, "resource", &resourceID, "Failed to update storage usage", err.Error(), nil)
+	}
+}
+
+func refreshResourceCharges(db *gorm.DB, resourceID uint) error {
+	var old []models.StorageCharge
+	if err := db.Where("resource_id = ?", resourceID).Find(&old).Error; err != nil {
+		return err
+	}
+
+	var resource models.Resource
+	if err := db.Select("id", "hash", "hash_type", "legacy_hash", "file_size", "owner_id", "created_by_user_id").
+		Where("id = ?", resourceID).Limit(1).Find(&resource).Error; err != nil {
+		return err
+	}
+	var want []models.StorageCharge
+	if resource.ID != 0 {
+		var versions []models.ResourceVersion
+		if err := db.Select("hash", "hash_type", "legacy_hash", "file_size").
+			Where("resource_id = ?", resourceID).Find(&versions).Error; err != nil {
+			return err
+		}
+		want = resourceCharges(resource, versions)
+	}
+	if sameCharges(old, want) {
+		return nil
+	}
+
+	for _, c := range old {
+		if err := adjustCharge(db, c, -1); err != nil {
+			return err
+		}
+	}
+	if len(old) > 0 {
+		if err := adjustResourceCount(db, old[0].UserID, old[0].GroupID, -1); err != nil {
+			return err
+		}
+		if err := db.Where("resource_id = ?", resourceID).Delete(&models.StorageCharge{}).Error; err != nil {
+			return err
+		}
+	}
+	for _, c := range want {
+		if err := adjustCharge(db, c, 1); err != nil {
+			return err
+		}
+	}
+	if len(want) > 0 {
+		if err := adjustResourceCount(db, resource.CreatedByUserId, resource.OwnerId, 1); err != nil {
+			return err
+		}
+		if err := db.Create(&want).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resourceCharges lists the files a resource is charged for: its own and its
+// versions', once each. There is always at least one, which is what charges
+// the resource itself.
+func resourceCharges(resource models.Resource, versions []models.ResourceVersion) []models.StorageCharge {
+	sizes := map[string]int64{}
+	add := func(hash, hashType, legacyHash string, size int64) {
+		key := models.QuotaBlobKey(hash, hashType, legacyHash)
+		if key == "" {
+			// A file not hashed yet is shared with nothing, as far as is
+			// known; it still counts, and so does its resource.
+			key = fmt.Sprintf("resource-%d", resource.ID)
+		}
+		if held, ok := sizes[key]; !ok || size > held {
+			sizes[key] = size
+		}
+	}
+	add(resource.Hash, resource.HashType, resource.LegacyHash, resource.FileSize)
+	for _, v := range versions {
+		add(v.Hash, v.HashType, v.LegacyHash, v.FileSize)
+	}
+	charges := make([]models.StorageCharge, 0, len(sizes))
+	for key, size := range sizes {
+		charges = append(charges, models.StorageCharge{
+			ResourceID: resource.ID,
+			BlobKey:    key,
+			FileSize:   size,
+			UserID:     resource.CreatedByUserId,
+			GroupID:    resource.OwnerId,
+		})
+	}
+	return charges
+}
+
+func sameCharges(old, want []models.StorageCharge) bool {
+	if len(old) != len(want) {
+		return false
+	}
+	byKey := make(map[string]models.StorageCharge, len(old))
+	for _, c := range old {
+		byKey[c.BlobKey] = c
+	}
+	for _, c := range want {
+		o, ok := byKey[c.BlobKey]
+		if !ok || o.FileSize != c.FileSize || !sameUintPtr(o.UserID, c.UserID) || !sameUintPtr(o.GroupID, c.GroupID) {
+			return false
+		}
+	}
+	return true
+}
+
+func sameUintPtr(a, b *uint) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
+
+// adjustCharge adds (delta 1) or takes back (delta -1) one resource's hold on
+// a file, for its user and its group.
+func adjustCharge(db *gorm.DB, c models.StorageCharge, delta int64) error {
+	for _, subject := range []struct {
+		kind string
+		id   *uint
+	}{{models.QuotaSubjectUser, c.UserID}, {models.QuotaSubjectGroup, c.GroupID}} {
+		if subject.id == nil {
+			continue
+		}
+		var err error
+		if delta > 0 {
+			err = holdBlob(db, subject.kind, *subject.id, c.BlobKey, c.FileSize)
+		} else {
+			err = releaseBlob(db, subject.kind, *subject.id, c.BlobKey)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// holdBlob counts one more holder of a file; the first adds its size to the
+// subject's usage.
+func holdBlob(db *gorm.DB, kind string, id uint, key string, size int64) error {
+	subject := "subject_type = ? AND subject_id = ? AND blob_key = ?"
+	// The insert is a no-op when a concurrent transaction inserted the row
+	// first; the second pass then counts this holder on it.
+	for attempt := 0; attempt < 2; attempt++ {
+		result := db.Model(&models.StorageUsageBlob{}).Where(subject, kind, id, key).
+			UpdateColumn("refs", gorm.Expr("refs + 1"))
+		if result.Error != nil || result.RowsAffected > 0 {
+			return result.Error
+		}
+		result = db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.StorageUsageBlob{
+			SubjectType: kind, SubjectID: id, BlobKey: key, FileSize: size, Refs: 1,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			return addStorageUsage(db, kind, id, size, 0)
+		}
+	}
+	return fmt.Errorf("could not count the file %s for %s %d", key, kind, id)
+}
+
+// releaseBlob counts one holder of a file fewer; the last takes its size off
+// the subject's usage.
+func releaseBlob(db *gorm.DB, kind string, id uint, key string) error {
+	subject := "subject_type = ? AND subject_id = ? AND blob_key = ?"
+	if err := db.Model(&models.StorageUsageBlob{}).Where(subject, kind, id, key).
+		UpdateColumn("refs", gorm.Expr("refs - 1")).Error; err != nil {
+		return err
+	}
+	var blob models.StorageUsageBlob
+	if err := db.Where(subject+" AND refs <= 0", kind, id, key).Limit(1).Find(&blob).Error; err != nil || blob.BlobKey == "" {
+		return err
+	}
+	result := db.Where(subject+" AND refs <= 0", kind, id, key).Delete(&models.StorageUsageBlob{})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+	return addStorageUsage(db, kind, id, -blob.FileSize, 0)
+}
+
+func adjustResourceCount(db *gorm.DB, userID, groupID *uint, delta int64) error {
+	if userID != nil {
+		if err := addStorageUsage(db, models.QuotaSubjectUser, *userID, 0, delta); err != nil {
+			return err
+		}
+	}
+	if groupID != nil {
+		return addStorageUsage(db, models.QuotaSubjectGroup, *groupID, 0, delta)
+	}
+	return nil
+}
+
+func addStorageUsage(db *gorm.DB, kind string, id uint, bytes, resources int64) error {
+	return db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "subject_type"}, {Name: "subject_id"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"bytes":     gorm.Expr("storage_usages.bytes + ?", bytes),
+			"resources": gorm.Expr("storage_usages.resources + ?", resources),
+		}),
+	}).Create(&models.StorageUsage{SubjectType: kind, SubjectID: id, Bytes: bytes, Resources: resources}).Error
+}
+
+// dropUserStorageUsage forgets a deleted user's quota and usage. Its resources
+// stay, with no creator, so their charges stay too but without the user.
+func dropUserStorageUsage(tx *gorm.DB, userID uint) error {
+	if !hasStorageQuotaTables(tx) {
+		return nil
+	}
+	subject := "subject_type = ? AND subject_id = ?"
+	for _, model := range []any{&models.StorageQuota{}, &models.StorageUsage{}, &models.StorageUsageBlob{}} {
+		if err := tx.Where(subject, models.QuotaSubjectUser, userID).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Model(&models.StorageCharge{}).Where("user_id = ?", userID).Update("user_id", nil).Error
+}
+
+// dropGroupStorageQuota forgets a deleted group's quota. Its usage went with
+// the resources it owned, which the caller has already moved out.
+func dropGroupStorageQuota(tx *gorm.DB, groupID uint) error {
+	if !hasStorageQuotaTables(tx) {
+		return nil
+	}
+	return tx.Where("subject_type = ? AND subject_id = ?", models.QuotaSubjectGroup, groupID).Delete(&models.StorageQuota{}).Error
+}
+
+// hasStorageQuotaTables reports whether the quota tables exist. Some focused
+// test contexts intentionally predate them; with no tables there is nothing to
+// charge or enforce.
+func hasStorageQuotaTables(db *gorm.DB) bool {
+	return db.Migrator().HasTable(&models.StorageCharge{})
+}
+
+// BackfillStorageUsage charges every resource that has no charges yet: all of
+// them the first time the server runs with quotas. Refreshing a resource is
+// idempotent, so this is safe alongside uploads.
+func (ctx *MahresourcesContext) BackfillStorageUsage() (int, error) {
+	done := 0
+	for {
+		var ids []uint
+		if err := ctx.db.Model(&models.Resource{}).
+			Where("NOT EXISTS (SELECT 1 FROM storage_charges c WHERE c.resource_id = resources.id)").
+			Order("id").Limit(storageTierBatchSize).Pluck("id", &ids).Error; err != nil {
+			return done, err
+		}
+		if len(ids) == 0 {
+			return done, nil
+		}
+		if err := ctx.db.Transaction(func(tx *gorm.DB) error {
+			return ctx.refreshStorageUsage(tx, ids...)
+		}); err != nil {
+			return done, err
+		}
+		done += len(ids)
+	}
+}
+
+// RecountStorageUsage rebuilds every user's and group's usage from the
+// resources, repairing any drift. It runs in one transaction, so uploads wait
+// for it.
+func (ctx *MahresourcesContext) RecountStorageUsage() (int64, error) {
+	var count int64
+	err := ctx.db.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []any{&models.StorageCharge{}, &models.StorageUsageBlob{}, &models.StorageUsage{}} {
+			if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		var lastID uint
+		for {
+			var ids []uint
+			if err := tx.Model(&models.Resource{}).Where("id > ?", lastID).Order("id").
+				Limit(storageTierBatchSize).Pluck("id", &ids).Error; err != nil {
+				return err
+			}
+			if len(ids) == 0 {
+				return nil
+			}
+			if err := ctx.refreshStorageUsage(tx, ids...); err != nil {
+				return err
+			}
+			count += int64(len(ids))
+			lastID = ids[len(ids)-1]
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	ctx.Logger().Info(models.LogActionSystem, "storage_quota", nil, "", "Recounted storage usage", map[string]interface{}{"resources": count})
+	return count, nil
+}
+
+// ListStorageQuotas returns every quota with its subject's usage, users first.
+func (ctx *MahresourcesContext) ListStorageQuotas() ([]StorageQuotaStatus, error) {
+	if !hasStorageQuotaTables(ctx.db) {
+		return []StorageQuotaStatus{}, nil
+	}
+	var quotas []models.StorageQuota
+	if err := ctx.db.Order("subject_type DESC, subject_id").Find(&quotas).Error; err != nil {
+		return nil, err
+	}
+	statuses := make([]StorageQuotaStatus, 0, len(quotas))
+	for _, q := range quotas {
+		status, err := ctx.storageQuotaStatus(q)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, *status)
+	}
+	return statuses, nil
+}
+
+func (ctx *MahresourcesContext) storageQuotaStatus(q models.StorageQuota) (*StorageQuotaStatus, error) {
+	usedBytes, usedResources, err := quotaUsage(ctx.db, q)
+	if err != nil {
+		return nil, err
+	}
+	status := &StorageQuotaStatus{
+		StorageQuota:  q,
+		SubjectName:   quotaSubjectName(ctx.db, q),
+		UsedBytes:     usedBytes,
+		UsedBytesFmt:  formatBytes(usedBytes),
+		UsedResources: usedResources,
+		Exceeded: (q.MaxBytes > 0 && usedBytes >= q.MaxBytes) ||
+			(q.MaxResources > 0 && usedResources >= q.MaxResources),
+	}
+	if q.MaxBytes > 0 {
+		status.MaxBytesFmt = formatBytes(q.MaxBytes)
+	}
+	return status, nil
+}
+
+// SetStorageQuota sets the quota of a user (subjectType "user") or of a
+// group's subtree ("group"). A zero limit is no limit.
+func (ctx *MahresourcesContext) SetStorageQuota(subjectType string, subjectID uint, maxBytes, maxResources int64) (*StorageQuotaStatus, error) {
+	if maxBytes < 0 || maxResources < 0 {
+		return nil, errors.New("quota limits cannot be negative")
+	}
+	var model any
+	switch subjectType {
+	case models.QuotaSubjectUser:
+		model = &models.User{}
+	case models.QuotaSubjectGroup:
+		model = &models.Group{}
+	default:
+		return nil, fmt.Errorf("quota subject must be %q or %q", models.QuotaSubjectUser, models.QuotaSubjectGroup)
+	}
+	var count int64
+	if err := ctx.db.Model(model).Where("id = ?", subjectID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("%s %d not found", subjectType, subjectID)
+	}
+
+	q := models.StorageQuota{SubjectType: subjectType, SubjectID: subjectID, MaxBytes: maxBytes, MaxResources: maxResources}
+	if err := ctx.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "subject_type"}, {Name: "subject_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"max_bytes", "max_resources", "updated_at"}),
+	}).Create(&q).Error; err != nil {
+		return nil, err
+	}
+	if err := ctx.db.Where("subject_type = ? AND subject_id = ?", subjectType, subjectID).First(&q).Error; err != nil {
+		return nil, err
+	}
+	ctx.Logger().Info(models.LogActionUpdate, "storage_quota", &q.ID, quotaSubjectName(ctx.db, q), "Set storage quota", map[string]interface{}{
+		"subjectType":  subjectType,
+		"subjectId":    subjectID,
+		"maxBytes":     maxBytes,
+		"maxResources": maxResources,
+	})
+	return ctx.storageQuotaStatus(q)
+}
+
+// DeleteStorageQuota removes a user's or a group's quota. Its usage is still
+// kept.
+func (ctx *MahresourcesContext) DeleteStorageQuota(subjectType string, subjectID uint) error {
+	result := ctx.db.Where("subject_type = ? AND subject_id = ?", subjectType, subjectID).Delete(&models.StorageQuota{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrStorageQuotaNotFound
+	}
+	ctx.Logger().Info(models.LogActionDelete, "storage_quota", nil, "", "Removed storage quota", map[string]interface{}{
+		"subjectType": subjectType,
+		"subjectId":   subjectID,
+	})
+	return nil
+}
@@ -0,0 +1,156 @@
+package application_context
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/spf13/afero"
+
+	"mahresources/models"
+)
+
+func createQuotaTestContext(t *testing.T, cacheName string) (*MahresourcesContext, afero.Fs) {
+	t.Helper()
+	ctx, fs := createScrubTestContext(t, cacheName)
+	if err := ctx.db.AutoMigrate(&models.Category{}, &models.Group{}, &models.User{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	return ctx, fs
+}
+
+// storeQuotaResource stores content as a resource owned by ownerID and
+// created by userID, and charges it.
+func storeQuotaResource(t *testing.T, ctx *MahresourcesContext, fs afero.Fs, location string, content []byte, userID, ownerID uint) models.Resource {
+	t.Helper()
+	resource := storeScrubResource(t, ctx, fs, location, content)
+	if err := ctx.db.Model(&resource).Updates(map[string]any{
+		"created_by_user_id": uintPtrOrNil(userID),
+		"owner_id":           uintPtrOrNil(ownerID),
+	}).Error; err != nil {
+		t.Fatalf("set owner: %v", err)
+	}
+	if err := ctx.refreshStorageUsage(ctx.db, resource.ID); err != nil {
+		t.Fatalf("refreshStorageUsage: %v", err)
+	}
+	return resource
+}
+
+func storageUsageOf(t *testing.T, ctx *MahresourcesContext, kind string, id uint) models.StorageUsage {
+	t.Helper()
+	var usage models.StorageUsage
+	ctx.db.Where("subject_type = ? AND subject_id = ?", kind, id).Limit(1).Find(&usage)
+	return usage
+}
+
+func createQuotaGroup(t *testing.T, ctx *MahresourcesContext, name string, ownerID uint) models.Group {
+	t.Helper()
+	group := models.Group{Name: name, OwnerId: uintPtrOrNil(ownerID)}
+	if err := ctx.db.Create(&group).Error; err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	return group
+}
+
+func TestStorageQuota_ADeduplicatedFileCountsOnce(t *testing.T) {
+	ctx, fs := createQuotaTestContext(t, "storage_quota_dedup_test")
+	group := createQuotaGroup(t, ctx, "Photos", 0)
+	content := []byte("one file, stored once")
+
+	first := storeQuotaResource(t, ctx, fs, "/resources/a", content, 7, group.ID)
+	second := storeQuotaResource(t, ctx, fs, "/resources/b", content, 7, group.ID)
+
+	for _, subject := range []struct {
+		kind string
+		id   uint
+	}{{models.QuotaSubjectUser, 7}, {models.QuotaSubjectGroup, group.ID}} {
+		usage := storageUsageOf(t, ctx, subject.kind, subject.id)
+		if usage.Bytes != int64(len(content)) || usage.Resources != 2 {
+			t.Errorf("%s usage is %d bytes in %d resources, want %d in 2", subject.kind, usage.Bytes, usage.Resources, len(content))
+		}
+	}
+
+	ctx.db.Delete(&first)
+	if err := ctx.refreshStorageUsage(ctx.db, first.ID); err != nil {
+		t.Fatalf("refreshStorageUsage: %v", err)
+	}
+	if usage := storageUsageOf(t, ctx, models.QuotaSubjectUser, 7); usage.Bytes != int64(len(content)) || usage.Resources != 1 {
+		t.Errorf("after deleting one holder the user holds %d bytes in %d resources, want %d in 1", usage.Bytes, usage.Resources, len(content))
+	}
+
+	ctx.db.Delete(&second)
+	if err := ctx.refreshStorageUsage(ctx.db, second.ID); err != nil {
+		t.Fatalf("refreshStorageUsage: %v", err)
+	}
+	if usage := storageUsageOf(t, ctx, models.QuotaSubjectUser, 7); usage.Bytes != 0 || usage.Resources != 0 {
+		t.Errorf("after deleting both holders the user holds %d bytes in %d resources, want none", usage.Bytes, usage.Resources)
+	}
+	var charges int64
+	ctx.db.Model(&models.StorageCharge{}).Count(&charges)
+	if charges != 0 {
+		t.Errorf("%d charges are left after every resource was deleted", charges)
+	}
+}
+
+func TestStorageQuota_AGroupQuotaCoversItsSubtree(t *testing.T) {
+	ctx, fs := createQuotaTestContext(t, "storage_quota_subtree_test")
+	parent := createQuotaGroup(t, ctx, "Archive", 0)
+	child := createQuotaGroup(t, ctx, "Scans", parent.ID)
+	held := storeQuotaResource(t, ctx, fs, "/resources/scan", make([]byte, 80), 0, child.ID)
+
+	if _, err := ctx.SetStorageQuota(models.QuotaSubjectGroup, parent.ID, 100, 0); err != nil {
+		t.Fatalf("SetStorageQuota: %v", err)
+	}
+
+	err := ctx.checkStorageQuota(ctx.db, nil, &child.ID, map[string]int64{"new": 30}, 1)
+	var exceeded *QuotaExceededError
+	if !errors.As(err, &exceeded) {
+		t.Fatalf("30 more bytes under a full subtree: got %v, want a QuotaExceededError", err)
+	}
+	if exceeded.SubjectID != parent.ID || exceeded.SubjectName != "Archive" || exceeded.Used != 80 || exceeded.Adding != 30 {
+		t.Errorf("refused by %s #%d (%d used, %d adding), want Archive with 80 used, 30 adding", exceeded.SubjectName, exceeded.SubjectID, exceeded.Used, exceeded.Adding)
+	}
+
+	key := models.QuotaBlobKey(held.Hash, held.HashType, held.LegacyHash)
+	if err := ctx.checkStorageQuota(ctx.db, nil, &child.ID, map[string]int64{key: 80}, 1); err != nil {
+		t.Errorf("a copy of a file the subtree already holds was refused: %v", err)
+	}
+	if err := ctx.checkStorageQuota(ctx.db, nil, &parent.ID, map[string]int64{"small": 20}, 1); err != nil {
+		t.Errorf("20 bytes up to the limit were refused: %v", err)
+	}
+
+	quotas, err := ctx.ListStorageQuotas()
+	if err != nil || len(quotas) != 1 {
+		t.Fatalf("ListStorageQuotas() = %v, %v; want one quota", quotas, err)
+	}
+	if quotas[0].UsedBytes != 80 || quotas[0].UsedResources != 1 || quotas[0].Exceeded {
+		t.Errorf("status is %d bytes in %d resources (exceeded %v), want 80 in 1, not exceeded", quotas[0].UsedBytes, quotas[0].UsedResources, quotas[0].Exceeded)
+	}
+}
+
+func TestStorageQuota_AUserResourceLimitRefusesAnotherResource(t *testing.T) {
+	ctx, fs := createQuotaTestContext(t, "storage_quota_user_test")
+	user := models.User{Username: "ada"}
+	if err := ctx.db.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	storeQuotaResource(t, ctx, fs, "/resources/first", []byte("the only one allowed"), user.ID, 0)
+
+	if _, err := ctx.SetStorageQuota(models.QuotaSubjectUser, user.ID, 0, 1); err != nil {
+		t.Fatalf("SetStorageQuota: %v", err)
+	}
+	err := ctx.checkStorageQuota(ctx.db, &user.ID, nil, map[string]int64{"other": 1}, 1)
+	var exceeded *QuotaExceededError
+	if !errors.As(err, &exceeded) || !exceeded.Resources {
+		t.Fatalf("a second resource: got %v, want a resource-count QuotaExceededError", err)
+	}
+	if err := ctx.checkStorageQuota(ctx.db, &user.ID, nil, map[string]int64{"version": 1}, 0); err != nil {
+		t.Errorf("a new version, which adds no resource, was refused: %v", err)
+	}
+
+	if err := ctx.DeleteStorageQuota(models.QuotaSubjectUser, user.ID); err != nil {
+		t.Fatalf("DeleteStorageQuota: %v", err)
+	}
+	if err := ctx.DeleteStorageQuota(models.QuotaSubjectUser, user.ID); !errors.Is(err, ErrStorageQuotaNotFound) {
+		t.Errorf("removing a quota twice: got %v, want ErrStorageQuotaNotFound", err)
+	}
+}
@@ -0,0 +1,550 @@
+package application_context
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"mahresources/download_queue"
+	"mahresources/models"
+	"mahresources/models/types"
+	"mahresources/mrql"
+)
+
+// ErrStorageTieringInProgress is returned when resources are already being
+// moved between filesystems.
+var ErrStorageTieringInProgress = errors.New("storage tiering already in progress")
+
+// ErrNoStorageTierRules is returned for a tiering run when no rules are
+// configured.
+var ErrNoStorageTierRules = errors.New("no storage tiering rules are configured")
+
+// DefaultStorageTierInterval is how often the tiering rules are applied when
+// -tier-interval is not set.
+const DefaultStorageTierInterval = 24 * time.Hour
+
+// resourceViewResolution is how often a view of the same resource is written
+// to resource_views; lastViewed is accurate to it.
+const resourceViewResolution = time.Hour
+
+// storageTierBatchSize is how many resources a run loads at a time.
+const storageTierBatchSize = 200
+
+// storageTierFailureLimit caps the failures a run's report lists; the run
+// counts all of them.
+const storageTierFailureLimit = 100
+
+// StorageTierRule moves the resources Query matches, an MRQL filter on
+// resources, to the alt filesystem Target. A resource goes where the first
+// rule it matches says, so a resource already on that rule's target is not
+// moved by a later one.
+type StorageTierRule struct {
+	Target string `json:"target"`
+	Query  string `json:"query"`
+}
+
+// ParseStorageTierRule reads a rule written as target:query.
+func ParseStorageTierRule(value string) (StorageTierRule, error) {
+	target, query, ok := strings.Cut(value, ":")
+	target, query = strings.TrimSpace(target), strings.TrimSpace(query)
+	if !ok || target == "" || query == "" {
+		return StorageTierRule{}, fmt.Errorf("tiering rule %q: expected target:query", value)
+	}
+	return StorageTierRule{Target: target, Query: query}, nil
+}
+
+// StorageTierOptions configures StartStorageTiering.
+type StorageTierOptions struct {
+	// DryRun counts what the rules would move without moving it.
+	DryRun bool
+}
+
+// StorageTierStart describes a submitted tiering run.
+type StorageTierStart struct {
+	JobID string `json:"jobId"`
+	RunID uint   `json:"runId"`
+}
+
+// StorageTierReport is stored in StorageTierRun.Report.
+type StorageTierReport struct {
+	// Rules has one entry per rule; a run moving given resources has one for
+	// its target, with an empty query.
+	Rules    []StorageTierRuleReport `json:"rules"`
+	Failures []StorageTierFailure    `json:"failures"`
+}
+
+// StorageTierRuleReport counts the resources one rule matched that were not
+// on its target yet, and those it moved.
+type StorageTierRuleReport struct {
+	StorageTierRule
+	Matched    int64 `json:"matched"`
+	Moved      int64 `json:"moved"`
+	MovedBytes int64 `json:"movedBytes"`
+}
+
+// StorageTierFailure is a resource a run could not move. It stays where it
+// was.
+type StorageTierFailure struct {
+	ResourceID uint   `json:"resourceId"`
+	Error      string `json:"error"`
+}
+
+// StorageTierStatus reports the configured rules, the pinned resources and
+// the newest run, whose Report is a StorageTierReport.
+type StorageTierStatus struct {
+	Rules           []StorageTierRule      `json:"rules"`
+	IntervalSeconds int64                  `json:"intervalSeconds"`
+	Pinned          int64                  `json:"pinned"`
+	Running         bool                   `json:"running"`
+	Run             *models.StorageTierRun `json:"run"`
+}
+
+// ValidateStorageTierRules checks that every rule targets an attached alt
+// filesystem and has a valid MRQL filter, so a bad rule fails startup rather
+// than every run.
+func (ctx *MahresourcesContext) ValidateStorageTierRules() error {
+	for i, rule := range ctx.Config.StorageTierRules {
+		if _, ok := ctx.altFileSystems[rule.Target]; !ok {
+			return fmt.Errorf("tiering rule %d: alt fs '%s' is not attached", i+1, rule.Target)
+		}
+		if err := ctx.CheckMRQLFilter(mrql.EntityResource, rule.Query); err != nil {
+			return fmt.Errorf("tiering rule %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// StartStorageTiering submits a background job that applies the tiering
+// rules: each resource a rule matches, unless it is pinned, moves to the
+// rule's target along with its versions.
+//
+// A file is copied to the target, read back and checked against its hash,
+// and only then is the row switched over, in one transaction with its
+// versions' rows. The old file is deleted once no row references it. A
+// resource whose file is damaged or missing is not moved; the run counts it
+// as failed.
+func (ctx *MahresourcesContext) StartStorageTiering(opts StorageTierOptions) (*StorageTierStart, error) {
+	if len(ctx.Config.StorageTierRules) == 0 {
+		return nil, ErrNoStorageTierRules
+	}
+	return ctx.startStorageTierRun(models.StorageTierRun{DryRun: opts.DryRun, ApplyRules: true}, nil)
+}
+
+// StartStorageTierMove submits a background job that moves the given
+// resources, and their versions, to target: an alt filesystem key, or "" for
+// the main filesystem. Promoting resources back from an archive tier is a
+// move to "". With pin set they are pinned first, so that the rules leave
+// them where they are moved to.
+func (ctx *MahresourcesContext) StartStorageTierMove(ids []uint, target string, pin bool) (*StorageTierStart, error) {
+	if len(ids) == 0 {
+		return nil, errors.New("no resources to move")
+	}
+	if _, err := ctx.GetFsForStorageLocation(storagePointer(target)); err != nil {
+		return nil, err
+	}
+	if pin {
+		if err := ctx.PinResources(ids); err != nil {
+			return nil, err
+		}
+	}
+	return ctx.startStorageTierRun(models.StorageTierRun{Target: target}, ids)
+}
+
+func (ctx *MahresourcesContext) startStorageTierRun(run models.StorageTierRun, ids []uint) (*StorageTierStart, error) {
+	if ctx.storageTiering.Load() {
+		return nil, ErrStorageTieringInProgress
+	}
+	run.StartedAt = time.Now()
+	if err := ctx.db.Create(&run).Error; err != nil {
+		return nil, err
+	}
+
+	job, err := ctx.downloadManager.SubmitJob("storage-tiering", "queued", func(c context.Context, _ *download_queue.DownloadJob, p download_queue.ProgressSink) error {
+		return ctx.runStorageTiering(c, run.ID, ids, p)
+	})
+	if err != nil {
+		return nil, err
+	}
+	ctx.db.Model(&run).Update("job_id", job.ID)
+	return &StorageTierStart{JobID: job.ID, RunID: run.ID}, nil
+}
+
+// PinResources keeps resources on the filesystem they are on: the tiering
+// rules skip pinned resources. Pinning one already pinned is not an error.
+func (ctx *MahresourcesContext) PinResources(ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	var existing []uint
+	if err := ctx.db.Model(&models.Resource{}).Where("id IN ?", ids).Pluck("id", &existing).Error; err != nil {
+		return err
+	}
+	if len(existing) != len(uniqueIDs(ids)) {
+		return errors.New("one or more resources not found")
+	}
+	pins := make([]models.StorageTierPin, len(existing))
+	for i, id := range existing {
+		pins[i] = models.StorageTierPin{ResourceID: id}
+	}
+	return ctx.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&pins).Error
+}
+
+// UnpinResources lets the tiering rules move resources again.
+func (ctx *MahresourcesContext) UnpinResources(ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return ctx.db.Where("resource_id IN ?", ids).Delete(&models.StorageTierPin{}).Error
+}
+
+func uniqueIDs(ids []uint) map[uint]bool {
+	seen := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		seen[id] = true
+	}
+	return seen
+}
+
+// RecordResourceView notes that a resource's file was opened, for MRQL's
+// lastViewed. Views of the same resource within resourceViewResolution of the
+// recorded one are not written.
+func (ctx *MahresourcesContext) RecordResourceView(id uint) {
+	now := time.Now()
+	if last, ok := ctx.resourceViews.Load(id); ok && now.Sub(last.(time.Time)) < resourceViewResolution {
+		return
+	}
+	ctx.resourceViews.Store(id, now)
+	err := ctx.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "resource_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"viewed_at"}),
+	}).Create(&models.ResourceView{ResourceID: id, ViewedAt: now}).Error
+	if err != nil {
+		ctx.resourceViews.Delete(id)
+		log.Printf("warning: could not record a view of resource %d: %v", id, err)
+	}
+}
+
+// GetStorageTierStatus returns the run with the given ID, or the newest when
+// id is 0, with the configured rules.
+func (ctx *MahresourcesContext) GetStorageTierStatus(id uint) (*StorageTierStatus, error) {
+	var run models.StorageTierRun
+	q := ctx.db.Order("id DESC")
+	if id != 0 {
+		q = q.Where("id = ?", id)
+	}
+	if err := q.Limit(1).Find(&run).Error; err != nil {
+		return nil, err
+	}
+	status := &StorageTierStatus{
+		Rules:           ctx.Config.StorageTierRules,
+		IntervalSeconds: int64(ctx.Config.StorageTierInterval / time.Second),
+		Running:         ctx.storageTiering.Load(),
+	}
+	if status.Rules == nil {
+		status.Rules = []StorageTierRule{}
+	}
+	if err := ctx.db.Model(&models.StorageTierPin{}).Count(&status.Pinned).Error; err != nil {
+		return nil, err
+	}
+	if run.ID != 0 {
+		status.Run = &run
+	} else if id != 0 {
+		return nil, fmt.Errorf("storage tiering run %d not found", id)
+	}
+	return status, nil
+}
+
+func (ctx *MahresourcesContext) runStorageTiering(c context.Context, runID uint, ids []uint, p download_queue.ProgressSink) error {
+	if !ctx.storageTiering.CompareAndSwap(false, true) {
+		return ErrStorageTieringInProgress
+	}
+	defer ctx.storageTiering.Store(false)
+
+	var run models.StorageTierRun
+	if err := ctx.db.First(&run, runID).Error; err != nil {
+		return err
+	}
+
+	report := &StorageTierReport{Rules: []StorageTierRuleReport{}, Failures: []StorageTierFailure{}}
+	var err error
+	if run.ApplyRules {
+		err = ctx.applyStorageTierRules(c, &run, report, p)
+	} else {
+		err = ctx.moveStorageTierResources(c, &run, ids, report, p)
+	}
+
+	now := time.Now()
+	run.FinishedAt = &now
+	if err != nil {
+		run.Error = err.Error()
+	}
+	encoded, encodeErr := json.Marshal(report)
+	if encodeErr != nil {
+		return encodeErr
+	}
+	run.Report = types.JSON(encoded)
+	if saveErr := ctx.db.Save(&run).Error; saveErr != nil && err == nil {
+		err = saveErr
+	}
+	if err != nil {
+		return err
+	}
+
+	message := "Storage tiering finished"
+	if run.DryRun {
+		message = "Storage tiering dry run finished"
+	}
+	ctx.Logger().Info(models.LogActionSystem, "storage_tiering", &run.ID, "", message, map[string]interface{}{
+		"matched":    run.Matched,
+		"moved":      run.Moved,
+		"movedBytes": run.MovedBytes,
+		"failed":     run.Failed,
+	})
+	p.SetPhase("completed")
+	return nil
+}
+
+// applyStorageTierRules moves the resources each rule matches that are not
+// on its target, are not pinned, and match no earlier rule.
+func (ctx *MahresourcesContext) applyStorageTierRules(c context.Context, run *models.StorageTierRun, report *StorageTierReport, p download_queue.ProgressSink) error {
+	rules := ctx.Config.StorageTierRules
+	for i, rule := range rules {
+		p.SetPhase("applying rule " + fmt.Sprint(i+1) + " to " + rule.Target)
+		p.UpdateProgress(int64(i), int64(len(rules)))
+
+		query, err := ctx.applyMRQLFilter(ctx.db.Model(&models.Resource{}), mrql.EntityResource, rule.Query)
+		if err != nil {
+			return fmt.Errorf("tiering rule %d: %w", i+1, err)
+		}
+		query = query.
+			Where("COALESCE(resources.storage_location, '') <> ?", rule.Target).
+			Where("NOT EXISTS (SELECT 1 FROM storage_tier_pins stp WHERE stp.resource_id = resources.id)")
+		for _, earlier := range rules[:i] {
+			claimed, err := ctx.applyMRQLFilter(ctx.db.Model(&models.Resource{}).Select("resources.id"), mrql.EntityResource, earlier.Query)
+			if err != nil {
+				return err
+			}
+			query = query.Where("resources.id NOT IN (?)", claimed)
+		}
+
+		ruleReport := StorageTierRuleReport{StorageTierRule: rule}
+		err = ctx.moveStorageTierBatches(c, query, rule.Target, run, &ruleReport, report)
+		report.Rules = append(report.Rules, ruleReport)
+		if err != nil {
+			return err
+		}
+	}
+	p.UpdateProgress(int64(len(rules)), int64(len(rules)))
+	return nil
+}
+
+// moveStorageTierResources moves the given resources to the run's target.
+func (ctx *MahresourcesContext) moveStorageTierResources(c context.Context, run *models.StorageTierRun, ids []uint, report *StorageTierReport, p download_queue.ProgressSink) error {
+	p.SetPhase("moving resources")
+	query := ctx.db.Model(&models.Resource{}).
+		Where("resources.id IN ?", ids).
+		Where("COALESCE(resources.storage_location, '') <> ?", run.Target)
+	ruleReport := StorageTierRuleReport{StorageTierRule: StorageTierRule{Target: run.Target}}
+	err := ctx.moveStorageTierBatches(c, query, run.Target, run, &ruleReport, report)
+	report.Rules = append(report.Rules, ruleReport)
+	return err
+}
+
+// moveStorageTierBatches moves the resources query selects, a batch at a time
+// in ID order, counting them into the run and ruleReport.
+func (ctx *MahresourcesContext) moveStorageTierBatches(c context.Context, query *gorm.DB, target string, run *models.StorageTierRun, ruleReport *StorageTierRuleReport, report *StorageTierReport) error {
+	var lastID uint
+	for {
+		if err := c.Err(); err != nil {
+			return err
+		}
+		var batch []models.Resource
+		if err := query.Session(&gorm.Session{}).Where("resources.id > ?", lastID).Order("resources.id").Limit(storageTierBatchSize).Find(&batch).Error; err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+
+		for _, r := range batch {
+			lastID = r.ID
+			if err := c.Err(); err != nil {
+				return err
+			}
+			run.Matched++
+			ruleReport.Matched++
+			if run.DryRun {
+				ruleReport.MovedBytes += r.FileSize
+				run.MovedBytes += r.FileSize
+				continue
+			}
+			moved, err := ctx.moveResourceToTier(r, target, ruleReport.Query)
+			if err != nil {
+				run.Failed++
+				if len(report.Failures) < storageTierFailureLimit {
+					report.Failures = append(report.Failures, StorageTierFailure{ResourceID: r.ID, Error: err.Error()})
+				}
+				ctx.Logger().Warning(models.LogActionSystem, "resource", &r.ID, r.Name, "Storage tiering could not move a resource", map[string]interface{}{
+					"to":    target,
+					"error": err.Error(),
+				})
+				continue
+			}
+			run.Moved++
+			run.MovedBytes += moved
+			ruleReport.Moved++
+			ruleReport.MovedBytes += moved
+		}
+		if err := ctx.db.Save(run).Error; err != nil {
+			return err
+		}
+	}
+}
+
+// moveResourceToTier copies a resource's file and its versions' files to
+// target, verifies the copies, and switches the rows over in one transaction.
+// Files nothing references afterwards are deleted from where they were. It
+// returns the bytes copied.
+func (ctx *MahresourcesContext) moveResourceToTier(r models.Resource, target, rule string) (int64, error) {
+	var versions []models.ResourceVersion
+	if err := ctx.db.Where("resource_id = ?", r.ID).Find(&versions).Error; err != nil {
+		return 0, err
+	}
+	blobs := []blobTarget{resourceBlobTarget(r)}
+	for _, v := range versions {
+		if storageKey(v.StorageLocation) != target {
+			blobs = append(blobs, versionBlobTarget(v))
+		}
+	}
+
+	var moved int64
+	copied := map[string]bool{}
+	for _, src := range blobs {
+		file := src.storage + ":" + normalizeBlobLocation(src.location)
+		if copied[file] {
+			continue
+		}
+		copied[file] = true
+		if check := ctx.checkBlob(src); check.problem != "" {
+			return 0, fmt.Errorf("%s is %s: %s", src.describe(), check.problem, check.detail)
+		}
+		dst := src
+		dst.storage = target
+		// The target may already hold the same content for another resource.
+		if ctx.checkBlob(dst).problem == "" {
+			continue
+		}
+		if err := ctx.copyBlob(src, dst); err != nil {
+			return 0, fmt.Errorf("copying %s: %w", src.describe(), err)
+		}
+		if check := ctx.checkBlob(dst); check.problem != "" {
+			return 0, fmt.Errorf("the copy of %s is %s", src.describe(), check.problem)
+		}
+		moved += src.size
+	}
+
+	err := ctx.db.Transaction(func(tx *gorm.DB) error {
+		for _, b := range blobs {
+			model := any(&models.ResourceVersion{})
+			if b.entityType == models.BlobEntityResource {
+				model = &models.Resource{}
+			}
+			result := tx.Model(model).
+				Where("id = ? AND COALESCE(storage_location, '') = ? AND location = ?", b.entityID, b.storage, b.location).
+				UpdateColumn("storage_location", storagePointer(target))
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected != 1 {
+				return fmt.Errorf("%s changed while it was being moved", b.describe())
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for file := range copied {
+		key, location, _ := strings.Cut(file, ":")
+		if ctx.blobReferencedNow(key, location) {
+			continue
+		}
+		if fs, err := ctx.GetFsForStorageLocation(storagePointer(key)); err == nil {
+			_ = fs.Remove(location)
+		}
+	}
+
+	from := blobs[0].storage
+	if from == "" {
+		from = "main"
+	}
+	to := target
+	if to == "" {
+		to = "main"
+	}
+	ctx.Logger().Info(models.LogActionUpdate, "resource", &r.ID, r.Name, "Moved to another storage tier", map[string]interface{}{
+		"from":     from,
+		"to":       to,
+		"versions": len(blobs) - 1,
+		"bytes":    moved,
+		"rule":     rule,
+	})
+	return moved, nil
+}
+
+// StorageTierScheduler applies the tiering rules in the background every
+// interval.
+type StorageTierScheduler struct {
+	ctx      *MahresourcesContext
+	interval time.Duration
+	done     chan struct{}
+	stopOnce sync.Once
+	running  sync.WaitGroup
+}
+
+func NewStorageTierScheduler(ctx *MahresourcesContext, interval time.Duration) *StorageTierScheduler {
+	if interval <= 0 {
+		interval = DefaultStorageTierInterval
+	}
+	return &StorageTierScheduler{ctx: ctx, interval: interval, done: make(chan struct{})}
+}
+
+// Start begins ticking. It returns immediately.
+func (s *StorageTierScheduler) Start() {
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.Tick()
+			case <-s.done:
+				return
+			}
+		}
+	}()
+}
+
+// Stop halts the ticker.
+func (s *StorageTierScheduler) Stop() {
+	s.stopOnce.Do(func() { close(s.done) })
+	s.running.Wait()
+}
+
+// Tick submits a tiering run unless one is already in progress.
+func (s *StorageTierScheduler) Tick() {
+	if _, err := s.ctx.StartStorageTiering(StorageTierOptions{}); err != nil && !errors.Is(err, ErrStorageTieringInProgress) {
+		log.Printf("warning: scheduled storage tiering did not start: %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package application_context
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+
+	"mahresources/models"
+)
+
+func createTierTestContext(t *testing.T, cacheName string, rules ...StorageTierRule) (*MahresourcesContext, afero.Fs, afero.Fs) {
+	t.Helper()
+	ctx, fs := createScrubTestContext(t, cacheName)
+	archive := afero.NewMemMapFs()
+	ctx.altFileSystems["archive"] = archive
+	ctx.Config.StorageTierRules = rules
+	return ctx, fs, archive
+}
+
+func runStorageTier(t *testing.T, ctx *MahresourcesContext, run models.StorageTierRun, ids []uint) models.StorageTierRun {
+	t.Helper()
+	if err := ctx.db.Create(&run).Error; err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	if err := ctx.runStorageTiering(context.Background(), run.ID, ids, scrubSink{}); err != nil {
+		t.Fatalf("runStorageTiering: %v", err)
+	}
+	ctx.db.First(&run, run.ID)
+	return run
+}
+
+func tierOf(t *testing.T, ctx *MahresourcesContext, id uint) string {
+	t.Helper()
+	var r models.Resource
+	if err := ctx.db.First(&r, id).Error; err != nil {
+		t.Fatalf("load resource %d: %v", id, err)
+	}
+	return storageKey(r.StorageLocation)
+}
+
+func TestStorageTiering_MovesColdResourcesWithTheirVersions(t *testing.T) {
+	ctx, fs, archive := createTierTestContext(t, "storage_tier_rules_test",
+		StorageTierRule{Target: "archive", Query: "lastViewed < -180d OR lastViewed IS NULL"})
+
+	cold := storeScrubResource(t, ctx, fs, "/resources/cold", []byte("never opened"))
+	stale := storeScrubResource(t, ctx, fs, "/resources/stale", []byte("opened long ago"))
+	warm := storeScrubResource(t, ctx, fs, "/resources/warm", []byte("opened today"))
+	pinned := storeScrubResource(t, ctx, fs, "/resources/pinned", []byte("never opened, pinned"))
+
+	old := storeScrubResource(t, ctx, fs, "/resources/cold-v1", []byte("the first version"))
+	ctx.db.Delete(&old)
+	version := models.ResourceVersion{ResourceID: cold.ID, VersionNumber: 1, Location: old.Location, Hash: old.Hash, HashType: old.HashType, FileSize: old.FileSize}
+	ctx.db.Create(&version)
+
+	ctx.RecordResourceView(warm.ID)
+	ctx.db.Create(&models.ResourceView{ResourceID: stale.ID, ViewedAt: time.Now().AddDate(0, 0, -200)})
+	if err := ctx.PinResources([]uint{pinned.ID}); err != nil {
+		t.Fatalf("PinResources: %v", err)
+	}
+
+	dry := runStorageTier(t, ctx, models.StorageTierRun{ApplyRules: true, DryRun: true}, nil)
+	if dry.Matched != 2 || dry.Moved != 0 || tierOf(t, ctx, cold.ID) != "" {
+		t.Fatalf("dry run matched %d and moved %d; want 2 and 0, nothing moved", dry.Matched, dry.Moved)
+	}
+
+	run := runStorageTier(t, ctx, models.StorageTierRun{ApplyRules: true}, nil)
+	if run.Matched != 2 || run.Moved != 2 || run.Failed != 0 {
+		t.Errorf("matched %d, moved %d, failed %d; want 2, 2, 0", run.Matched, run.Moved, run.Failed)
+	}
+	for _, r := range []models.Resource{cold, stale} {
+		if tierOf(t, ctx, r.ID) != "archive" {
+			t.Errorf("%s was not moved to the archive", r.Location)
+		}
+		if got, _ := afero.ReadFile(archive, r.Location); len(got) == 0 {
+			t.Errorf("%s is not on the archive", r.Location)
+		}
+		if exists, _ := afero.Exists(fs, r.Location); exists {
+			t.Errorf("%s was left on the main filesystem", r.Location)
+		}
+	}
+	for _, r := range []models.Resource{warm, pinned} {
+		if tierOf(t, ctx, r.ID) != "" {
+			t.Errorf("%s was moved", r.Location)
+		}
+	}
+
+	ctx.db.First(&version, version.ID)
+	if storageKey(version.StorageLocation) != "archive" {
+		t.Error("the version was not moved with its resource")
+	}
+	if got, _ := afero.ReadFile(archive, version.Location); !bytes.Equal(got, []byte("the first version")) {
+		t.Errorf("the version on the archive = %q", got)
+	}
+
+	var logged int64
+	ctx.db.Model(&models.LogEntry{}).Where("entity_id = ? AND message = ?", cold.ID, "Moved to another storage tier").Count(&logged)
+	if logged != 1 {
+		t.Errorf("logged %d moves of the cold resource, want 1", logged)
+	}
+}
+
+func TestStorageTiering_LeavesADamagedFileWhereItIs(t *testing.T) {
+	ctx, fs, archive := createTierTestContext(t, "storage_tier_damaged_test",
+		StorageTierRule{Target: "archive", Query: "lastViewed IS NULL"})
+
+	damaged := storeScrubResource(t, ctx, fs, "/resources/damaged", []byte("the original content"))
+	_ = afero.WriteFile(fs, damaged.Location, []byte("the 0riginal content"), 0644)
+
+	run := runStorageTier(t, ctx, models.StorageTierRun{ApplyRules: true}, nil)
+	if run.Moved != 0 || run.Failed != 1 {
+		t.Errorf("moved %d, failed %d; want 0 and 1", run.Moved, run.Failed)
+	}
+	if tierOf(t, ctx, damaged.ID) != "" {
+		t.Error("the damaged resource was switched to the archive")
+	}
+	if exists, _ := afero.Exists(archive, damaged.Location); exists {
+		t.Error("the damaged file was copied to the archive")
+	}
+	if exists, _ := afero.Exists(fs, damaged.Location); !exists {
+		t.Error("the damaged file was deleted")
+	}
+}
+
+func TestStorageTiering_PromotedResourcesStayPinned(t *testing.T) {
+	ctx, fs, archive := createTierTestContext(t, "storage_tier_promote_test",
+		StorageTierRule{Target: "archive", Query: "lastViewed IS NULL"})
+
+	r := storeScrubResource(t, ctx, fs, "/resources/promoted", []byte("wanted back"))
+	runStorageTier(t, ctx, models.StorageTierRun{ApplyRules: true}, nil)
+	if tierOf(t, ctx, r.ID) != "archive" {
+		t.Fatal("the resource was not archived")
+	}
+
+	if err := ctx.PinResources([]uint{r.ID}); err != nil {
+		t.Fatalf("PinResources: %v", err)
+	}
+	promote := runStorageTier(t, ctx, models.StorageTierRun{}, []uint{r.ID})
+	if promote.Moved != 1 || tierOf(t, ctx, r.ID) != "" {
+		t.Fatalf("moved %d; the resource is on %q, want the main filesystem", promote.Moved, tierOf(t, ctx, r.ID))
+	}
+	if got, _ := afero.ReadFile(fs, r.Location); !bytes.Equal(got, []byte("wanted back")) {
+		t.Errorf("the promoted file = %q", got)
+	}
+	if exists, _ := afero.Exists(archive, r.Location); exists {
+		t.Error("the file was left on the archive")
+	}
+
+	again := runStorageTier(t, ctx, models.StorageTierRun{ApplyRules: true}, nil)
+	if again.Matched != 0 || tierOf(t, ctx, r.ID) != "" {
+		t.Error("the rules moved a pinned resource")
+	}
+
+	if err := ctx.UnpinResources([]uint{r.ID}); err != nil {
+		t.Fatalf("UnpinResources: %v", err)
+	}
+	runStorageTier(t, ctx, models.StorageTierRun{ApplyRules: true}, nil)
+	if tierOf(t, ctx, r.ID) != "archive" {
+		t.Error("the rules did not move the unpinned resource")
+	}
+}
+
+func TestParseStorageTierRule(t *testing.T) {
+	rule, err := ParseStorageTierRule(`archive: lastViewed < -180d AND name ~ "a:b"`)
+	if err != nil || rule.Target != "archive" || rule.Query != `lastViewed < -180d AND name ~ "a:b"` {
+		t.Errorf("got %+v, %v", rule, err)
+	}
+	for _, bad := range []string{"archive", ":name = 1", "archive: "} {
+		if _, err := ParseStorageTierRule(bad); err == nil {
+			t.Errorf("%q parsed", bad)
+		}
+	}
+}
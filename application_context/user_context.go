@@ -208,6 +208,9 @@ func (ctx *MahresourcesContext) DeleteUser(id uint) error {
 		if cErr := nullCreatorReferences(tx, id); cErr != nil {
 			return cErr
 		}
+		if qErr := dropUserStorageUsage(tx, id); qErr != nil {
+			return qErr
+		}
 		if sErr := tx.Where("user_id = ?", id).Delete(&models.Session{}).Error; sErr != nil {
 			return sErr
 		}
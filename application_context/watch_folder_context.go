@@ -0,0 +1,879 @@
+package application_context
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/afero"
+	"gorm.io/gorm"
+
+	"mahresources/constants"
+	"mahresources/download_queue"
+	"mahresources/models"
+	"mahresources/models/query_models"
+	"mahresources/models/types"
+)
+
+// Watch folders.
+//
+// A watch folder is a folder on an alt filesystem that is polled, rather than
+// watched for events, so that it works on network mounts. Each scan compares
+// what is in the folder with what the last one recorded in watched_files:
+//
+//   - a new file becomes a resource, copied into storage like an upload;
+//   - a changed file becomes a new version of its resource;
+//   - a new file with the content of one that is gone is taken to have moved,
+//     and its resource follows it;
+//   - a file that is gone keeps or deletes its resource, as OnDelete says.
+//
+// A file modified within the settle time is left for a later scan, since it
+// may still be being written. While any new file is left that way, removed
+// files are left too, in case it is one of them being moved.
+
+var (
+	ErrWatchFolderNotFound = errors.New("watch folder not found")
+	// ErrWatchScanInProgress is returned for a scan of a folder that is
+	// already being scanned.
+	ErrWatchScanInProgress = errors.New("watch folder is already being scanned")
+)
+
+// DefaultWatchFolderInterval and DefaultWatchFolderSettle are used when
+// -watch-interval and -watch-settle are not set.
+const (
+	DefaultWatchFolderInterval = time.Minute
+	DefaultWatchFolderSettle   = 30 * time.Second
+)
+
+// WatchOnDeleteKeep and WatchOnDeleteDelete are the values of
+// WatchFolder.OnDelete.
+const (
+	WatchOnDeleteKeep   = "keep"
+	WatchOnDeleteDelete = "delete"
+)
+
+// watchScanFailureLimit caps the failures a scan's report lists; the scan
+// counts all of them.
+const watchScanFailureLimit = 100
+
+// WatchFolderStatus is a watch folder with how many files it has ingested.
+type WatchFolderStatus struct {
+	models.WatchFolder
+	Files    int64 `json:"files"`
+	Scanning bool  `json:"scanning"`
+}
+
+// WatchScanStart describes a submitted scan.
+type WatchScanStart struct {
+	JobID    string `json:"jobId"`
+	FolderID uint   `json:"folderId"`
+}
+
+// WatchScanReport is stored in WatchFolder.LastReport.
+type WatchScanReport struct {
+	// Added counts new files stored as resources, and Linked new files whose
+	// content a resource in their group already held, which they were tied
+	// to instead.
+	Added     int64 `json:"added"`
+	Linked    int64 `json:"linked"`
+	Versioned int64 `json:"versioned"`
+	Moved     int64 `json:"moved"`
+	Removed   int64 `json:"removed"`
+	// Pending counts files left for a later scan because they were modified
+	// within the settle time.
+	Pending  int64              `json:"pending"`
+	Failed   int64              `json:"failed"`
+	Failures []WatchScanFailure `json:"failures"`
+}
+
+// WatchScanFailure is a file a scan could not ingest. It is tried again by
+// the next scan.
+type WatchScanFailure struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// ListWatchFolders returns every watch folder, by name.
+func (ctx *MahresourcesContext) ListWatchFolders() ([]WatchFolderStatus, error) {
+	var folders []models.WatchFolder
+	if err := ctx.db.Order("name").Find(&folders).Error; err != nil {
+		return nil, err
+	}
+	statuses := make([]WatchFolderStatus, 0, len(folders))
+	for _, folder := range folders {
+		status, err := ctx.watchFolderStatus(folder)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, *status)
+	}
+	return statuses, nil
+}
+
+func (ctx *MahresourcesContext) watchFolderStatus(folder models.WatchFolder) (*WatchFolderStatus, error) {
+	status := &WatchFolderStatus{WatchFolder: folder}
+	_, status.Scanning = ctx.watchScans.Load(folder.ID)
+	if err := ctx.db.Model(&models.WatchedFile{}).Where("watch_folder_id = ?", folder.ID).Count(&status.Files).Error; err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// SetWatchFolder creates a watch folder, or updates the one editor names by
+// ID. Files already ingested stay as they are; the mapping applies to what
+// the folder's scans store or move from then on.
+func (ctx *MahresourcesContext) SetWatchFolder(editor *query_models.WatchFolderEditor) (*WatchFolderStatus, error) {
+	folder := models.WatchFolder{}
+	if editor.ID != 0 {
+		if err := ctx.db.First(&folder, editor.ID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrWatchFolderNotFound
+			}
+			return nil, err
+		}
+	}
+
+	name := strings.TrimSpace(editor.Name)
+	if name == "" {
+		return nil, errors.New("a watch folder needs a name")
+	}
+	var taken int64
+	if err := ctx.db.Model(&models.WatchFolder{}).Where("name = ? AND id <> ?", name, editor.ID).Count(&taken).Error; err != nil {
+		return nil, err
+	}
+	if taken > 0 {
+		return nil, fmt.Errorf("a watch folder named %q already exists", name)
+	}
+
+	fsys, ok := ctx.altFileSystems[editor.FileSystem]
+	if !ok {
+		return nil, fmt.Errorf("alt fs '%s' is not attached", editor.FileSystem)
+	}
+	folderPath := path.Clean("/" + filepath.ToSlash(editor.Path))
+	// Its watched files are recorded by their path in the folder, so another
+	// folder would see them all as removed.
+	if folder.ID != 0 && (folder.FileSystem != editor.FileSystem || folder.Path != folderPath) {
+		return nil, errors.New("a watch folder cannot be moved; remove it and add the new folder")
+	}
+	if info, err := fsys.Stat(folderPath); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a folder on alt fs '%s'", folderPath, editor.FileSystem)
+	}
+
+	onDelete := editor.OnDelete
+	if onDelete == "" {
+		onDelete = WatchOnDeleteKeep
+	}
+	if onDelete != WatchOnDeleteKeep && onDelete != WatchOnDeleteDelete {
+		return nil, fmt.Errorf("onDelete must be %q or %q", WatchOnDeleteKeep, WatchOnDeleteDelete)
+	}
+
+	if editor.OwnerGroupId == 0 {
+		return nil, errors.New("a watch folder needs an owner group")
+	}
+	groupIDs := []uint{editor.OwnerGroupId}
+	var tagIDs []uint
+	for i, rule := range editor.Rules {
+		if strings.TrimSpace(rule.Pattern) == "" {
+			return nil, fmt.Errorf("rule %d has no pattern", i+1)
+		}
+		if _, err := path.Match(strings.TrimSuffix(rule.Pattern, "/**"), ""); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		if rule.GroupID != 0 {
+			groupIDs = append(groupIDs, rule.GroupID)
+		}
+		tagIDs = append(tagIDs, rule.Tags...)
+	}
+	groupIDs = deduplicateUints(groupIDs)
+	var count int64
+	if err := ctx.db.Model(&models.Group{}).Where("id IN ?", groupIDs).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if int(count) != len(groupIDs) {
+		return nil, errors.New("one or more groups not found")
+	}
+	if tagIDs = deduplicateUints(tagIDs); len(tagIDs) > 0 {
+		if err := ctx.db.Model(&models.Tag{}).Where("id IN ?", tagIDs).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if int(count) != len(tagIDs) {
+			return nil, errors.New("one or more tags not found")
+		}
+	}
+
+	rules := editor.Rules
+	if rules == nil {
+		rules = []query_models.WatchFolderRule{}
+	}
+	encoded, err := json.Marshal(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	folder.Name = name
+	folder.FileSystem = editor.FileSystem
+	folder.Path = folderPath
+	folder.OwnerGroupID = editor.OwnerGroupId
+	folder.Subfolders = editor.Subfolders
+	folder.Rules = types.JSON(encoded)
+	folder.OnDelete = onDelete
+	folder.Paused = editor.Paused
+	if err := ctx.db.Save(&folder).Error; err != nil {
+		return nil, err
+	}
+	ctx.Logger().Info(models.LogActionSystem, "watch_folder", &folder.ID, folder.Name, "Watch folder set", map[string]interface{}{
+		"fileSystem": folder.FileSystem,
+		"path":       folder.Path,
+		"owner":      folder.OwnerGroupID,
+	})
+	return ctx.watchFolderStatus(folder)
+}
+
+// DeleteWatchFolder stops watching a folder. The resources it ingested stay.
+func (ctx *MahresourcesContext) DeleteWatchFolder(id uint) error {
+	var folder models.WatchFolder
+	if err := ctx.db.First(&folder, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrWatchFolderNotFound
+		}
+		return err
+	}
+	err := ctx.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("watch_folder_id = ?", id).Delete(&models.WatchedFile{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&folder).Error
+	})
+	if err != nil {
+		return err
+	}
+	ctx.Logger().Info(models.LogActionSystem, "watch_folder", &folder.ID, folder.Name, "Watch folder removed", nil)
+	return nil
+}
+
+// StartWatchScan submits a background job that scans a watch folder, whether
+// or not it is paused.
+func (ctx *MahresourcesContext) StartWatchScan(id uint) (*WatchScanStart, error) {
+	var folder models.WatchFolder
+	if err := ctx.db.First(&folder, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWatchFolderNotFound
+		}
+		return nil, err
+	}
+	if _, busy := ctx.watchScans.Load(id); busy {
+		return nil, ErrWatchScanInProgress
+	}
+
+	jobCtx := *ctx
+	jobCtx.currentRequest = nil
+	// URL is unused for generic jobs; it carries the folder's name for the
+	// jobs panel.
+	job, err := ctx.downloadManager.SubmitJobWithOptions(download_queue.JobOptions{
+		Source:       download_queue.JobSourceWatchScan,
+		InitialPhase: "queued",
+		URL:          folder.Name,
+		OwnerUserID:  ctx.actingUserIDPtr(),
+	}, func(c context.Context, _ *download_queue.DownloadJob, p download_queue.ProgressSink) error {
+		return jobCtx.runWatchScan(c, id, p)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &WatchScanStart{JobID: job.ID, FolderID: id}, nil
+}
+
+// PollWatchFolders submits a scan of each watch folder that is not paused and
+// has a change a scan would act on now. A folder that cannot be read has the
+// error recorded on it instead.
+func (ctx *MahresourcesContext) PollWatchFolders() error {
+	var folders []models.WatchFolder
+	if err := ctx.db.Where("paused = ?", false).Find(&folders).Error; err != nil {
+		return err
+	}
+	for i := range folders {
+		folder := &folders[i]
+		if _, busy := ctx.watchScans.Load(folder.ID); busy {
+			continue
+		}
+		diff, _, err := ctx.diffWatchFolder(folder)
+		if err != nil {
+			if folder.LastError != err.Error() {
+				log.Printf("warning: watch folder %s cannot be read: %v", folder.Name, err)
+				ctx.db.Model(folder).Update("last_error", err.Error())
+			}
+			continue
+		}
+		if diff.empty() {
+			continue
+		}
+		if _, err := ctx.StartWatchScan(folder.ID); err != nil && !errors.Is(err, ErrWatchScanInProgress) {
+			log.Printf("warning: scan of watch folder %s did not start: %v", folder.Name, err)
+		}
+	}
+	return nil
+}
+
+func (ctx *MahresourcesContext) runWatchScan(c context.Context, folderID uint, p download_queue.ProgressSink) error {
+	if _, busy := ctx.watchScans.LoadOrStore(folderID, true); busy {
+		return ErrWatchScanInProgress
+	}
+	defer ctx.watchScans.Delete(folderID)
+
+	var folder models.WatchFolder
+	if err := ctx.db.First(&folder, folderID).Error; err != nil {
+		return err
+	}
+
+	report := &WatchScanReport{Failures: []WatchScanFailure{}}
+	err := ctx.scanWatchFolder(c, &folder, report, p)
+
+	now := time.Now()
+	folder.LastScanAt = &now
+	folder.LastError = ""
+	if err != nil {
+		folder.LastError = err.Error()
+	}
+	encoded, encodeErr := json.Marshal(report)
+	if encodeErr != nil {
+		return encodeErr
+	}
+	folder.LastReport = types.JSON(encoded)
+	saveErr := ctx.db.Model(&folder).Select("last_scan_at", "last_error", "last_report").Updates(&folder).Error
+	if saveErr != nil && err == nil {
+		err = saveErr
+	}
+	if err != nil {
+		return err
+	}
+
+	ctx.Logger().Info(models.LogActionSystem, "watch_folder", &folder.ID, folder.Name, "Watch folder scanned", map[string]interface{}{
+		"added":     report.Added,
+		"linked":    report.Linked,
+		"versioned": report.Versioned,
+		"moved":     report.Moved,
+		"removed":   report.Removed,
+		"pending":   report.Pending,
+		"failed":    report.Failed,
+	})
+	p.SetPhase("completed")
+	return nil
+}
+
+// watchFolderDiff is what a scan would do to a folder now.
+type watchFolderDiff struct {
+	// listing holds every file in the folder by its path in it.
+	listing map[string]os.FileInfo
+	added   []string
+	changed []*models.WatchedFile
+	missing []*models.WatchedFile
+	// held are missing files whose removal waits for the pending new files,
+	// any of which may be one of them, moved. A new file with the content of
+	// one is still taken as its move.
+	held    []*models.WatchedFile
+	pending int64
+}
+
+func (d *watchFolderDiff) empty() bool {
+	return len(d.added) == 0 && len(d.changed) == 0 && len(d.missing) == 0
+}
+
+// diffWatchFolder lists the folder and compares it with its watched files by
+// size and modification time. Hidden files and folders, and thumbnails, are
+// not listed.
+func (ctx *MahresourcesContext) diffWatchFolder(folder *models.WatchFolder) (*watchFolderDiff, afero.Fs, error) {
+	fsys, ok := ctx.altFileSystems[folder.FileSystem]
+	if !ok {
+		return nil, nil, fmt.Errorf("alt fs '%s' is not attached", folder.FileSystem)
+	}
+
+	diff := &watchFolderDiff{listing: map[string]os.FileInfo{}}
+	err := afero.Walk(fsys, folder.Path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(folder.Path, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			return nil
+		}
+		if strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Mode().IsRegular() && !strings.HasSuffix(rel, constants.ThumbFileSuffix) {
+			diff.listing[rel] = info
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var known []models.WatchedFile
+	if err := ctx.db.Where("watch_folder_id = ?", folder.ID).Find(&known).Error; err != nil {
+		return nil, nil, err
+	}
+	settled := time.Now().Add(-ctx.Config.WatchFolderSettle)
+	seen := make(map[string]bool, len(known))
+	for i := range known {
+		f := &known[i]
+		seen[f.Path] = true
+		info, ok := diff.listing[f.Path]
+		switch {
+		case !ok:
+			diff.missing = append(diff.missing, f)
+		case info.Size() == f.Size && watchModTime(info.ModTime()).Equal(watchModTime(f.ModTime)):
+		case info.ModTime().After(settled):
+			diff.pending++
+		default:
+			diff.changed = append(diff.changed, f)
+		}
+	}
+	var pendingNew bool
+	for rel, info := range diff.listing {
+		if seen[rel] {
+			continue
+		}
+		if info.ModTime().After(settled) {
+			diff.pending++
+			pendingNew = true
+			continue
+		}
+		diff.added = append(diff.added, rel)
+	}
+	if pendingNew {
+		diff.held, diff.missing = diff.missing, nil
+	}
+	sort.Strings(diff.added)
+	sort.Slice(diff.changed, func(i, j int) bool { return diff.changed[i].Path < diff.changed[j].Path })
+	return diff, fsys, nil
+}
+
+// watchModTime is a modification time as it survives a round trip through
+// the database.
+func watchModTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Microsecond)
+}
+
+func (ctx *MahresourcesContext) scanWatchFolder(c context.Context, folder *models.WatchFolder, report *WatchScanReport, p download_queue.ProgressSink) error {
+	p.SetPhase("listing")
+	diff, fsys, err := ctx.diffWatchFolder(folder)
+	if err != nil {
+		return err
+	}
+	report.Pending = diff.pending
+
+	var rules []query_models.WatchFolderRule
+	if len(folder.Rules) > 0 {
+		if err := json.Unmarshal(folder.Rules, &rules); err != nil {
+			return fmt.Errorf("watch folder rules: %w", err)
+		}
+	}
+	w := &watchFolderIngest{
+		ctx:    ctx,
+		fsys:   fsys,
+		folder: folder,
+		rules:  rules,
+		groups: map[string]uint{".": folder.OwnerGroupID},
+	}
+
+	total := int64(len(diff.added) + len(diff.changed) + len(diff.missing))
+	var done int64
+	// failed records a file that could not be ingested. A full quota stops
+	// the scan, since no later file would fit either.
+	failed := func(rel string, err error) error {
+		var exceeded *QuotaExceededError
+		if errors.As(err, &exceeded) {
+			return err
+		}
+		report.Failed++
+		if len(report.Failures) < watchScanFailureLimit {
+			report.Failures = append(report.Failures, WatchScanFailure{Path: rel, Error: err.Error()})
+		}
+		return nil
+	}
+
+	p.SetPhase("ingesting")
+	for _, f := range diff.changed {
+		if err := c.Err(); err != nil {
+			return err
+		}
+		done++
+		p.SetPhaseProgress(done, total)
+		versioned, err := w.update(f, diff.listing[f.Path])
+		if err != nil {
+			if err := failed(f.Path, err); err != nil {
+				return err
+			}
+			continue
+		}
+		if versioned {
+			report.Versioned++
+		}
+	}
+
+	// A new file with the content of a missing one is that file, moved.
+	missing := map[string][]*models.WatchedFile{}
+	for _, f := range append(diff.missing, diff.held...) {
+		missing[f.Hash] = append(missing[f.Hash], f)
+	}
+	moved := map[uint]bool{}
+	for _, rel := range diff.added {
+		if err := c.Err(); err != nil {
+			return err
+		}
+		done++
+		p.SetPhaseProgress(done, total)
+		info := diff.listing[rel]
+		hash, err := w.hash(rel)
+		if err != nil {
+			if err := failed(rel, err); err != nil {
+				return err
+			}
+			continue
+		}
+		if candidates := missing[hash]; len(candidates) > 0 {
+			missing[hash] = candidates[1:]
+			moved[candidates[0].ID] = true
+			if err := w.move(candidates[0], rel, info); err != nil {
+				if err := failed(rel, err); err != nil {
+					return err
+				}
+				continue
+			}
+			report.Moved++
+			continue
+		}
+		linked, err := w.add(&models.WatchedFile{WatchFolderID: folder.ID}, rel, info, hash)
+		if err != nil {
+			if err := failed(rel, err); err != nil {
+				return err
+			}
+			continue
+		}
+		if linked {
+			report.Linked++
+		} else {
+			report.Added++
+		}
+	}
+
+	for _, f := range diff.missing {
+		if moved[f.ID] {
+			continue
+		}
+		if err := c.Err(); err != nil {
+			return err
+		}
+		done++
+		p.SetPhaseProgress(done, total)
+		if err := w.remove(f); err != nil {
+			if err := failed(f.Path, err); err != nil {
+				return err
+			}
+			continue
+		}
+		report.Removed++
+	}
+	p.SetPhaseProgress(total, total)
+	return nil
+}
+
+// watchFolderIngest applies one scan's changes to a folder's resources.
+type watchFolderIngest struct {
+	ctx    *MahresourcesContext
+	fsys   afero.Fs
+	folder *models.WatchFolder
+	rules  []query_models.WatchFolderRule
+	// groups maps each subfolder to its group when the folder mirrors its
+	// subfolders; "." is the folder itself.
+	groups map[string]uint
+}
+
+// location is a file's path on its filesystem, stored as the resource's
+// OriginalLocation.
+func (w *watchFolderIngest) location(rel string) string {
+	return path.Join(w.folder.Path, rel)
+}
+
+func (w *watchFolderIngest) hash(rel string) (string, error) {
+	file, err := w.fsys.Open(w.location(rel))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// target is the group a file's resource belongs in and the tags the rules
+// give it.
+func (w *watchFolderIngest) target(rel string) (uint, []uint, error) {
+	var owner uint
+	var tags []uint
+	for _, rule := range w.rules {
+		if !watchRuleMatches(rule.Pattern, rel) {
+			continue
+		}
+		tags = append(tags, rule.Tags...)
+		if owner == 0 {
+			owner = rule.GroupID
+		}
+	}
+	tags = deduplicateUints(tags)
+	if owner != 0 {
+		return owner, tags, nil
+	}
+	if !w.folder.Subfolders {
+		return w.folder.OwnerGroupID, tags, nil
+	}
+	owner, err := w.groupFor(path.Dir(rel))
+	return owner, tags, err
+}
+
+// groupFor finds or creates the group for a subfolder, under the group for
+// the folder it is in.
+func (w *watchFolderIngest) groupFor(dir string) (uint, error) {
+	if id, ok := w.groups[dir]; ok {
+		return id, nil
+	}
+	parent, err := w.groupFor(path.Dir(dir))
+	if err != nil {
+		return 0, err
+	}
+	var group models.Group
+	err = w.ctx.db.Where("owner_id = ? AND name = ?", parent, path.Base(dir)).Order("id").First(&group).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		created, createErr := w.ctx.CreateGroup(&query_models.GroupCreator{Name: path.Base(dir), OwnerId: parent})
+		if createErr != nil {
+			return 0, fmt.Errorf("creating the group for %s: %w", dir, createErr)
+		}
+		group = *created
+	} else if err != nil {
+		return 0, err
+	}
+	w.groups[dir] = group.ID
+	return group.ID, nil
+}
+
+// watchRuleMatches reports whether a rule's pattern matches a file's path in
+// its folder. See query_models.WatchFolderRule.
+func watchRuleMatches(pattern, rel string) bool {
+	if dir, ok := strings.CutSuffix(pattern, "/**"); ok {
+		want := strings.Split(dir, "/")
+		parts := strings.Split(rel, "/")
+		if len(parts) <= len(want) {
+			return false
+		}
+		matched, _ := path.Match(dir, strings.Join(parts[:len(want)], "/"))
+		return matched
+	}
+	if !strings.Contains(pattern, "/") {
+		rel = path.Base(rel)
+	}
+	matched, _ := path.Match(pattern, rel)
+	return matched
+}
+
+// add stores a file as a new resource and records it in f. A file whose
+// content is already stored is tied to the resource that holds it, as an
+// upload would be; it is reported as linked when that resource is already in
+// the file's group.
+func (w *watchFolderIngest) add(f *models.WatchedFile, rel string, info os.FileInfo, hash string) (bool, error) {
+	owner, tags, err := w.target(rel)
+	if err != nil {
+		return false, err
+	}
+	file, err := w.fsys.Open(w.location(rel))
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	base := path.Base(rel)
+	resource, err := w.ctx.AddResource(file, base, &query_models.ResourceCreator{
+		ResourceQueryBase: query_models.ResourceQueryBase{
+			OwnerId:          owner,
+			Tags:             tags,
+			OriginalName:     base,
+			OriginalLocation: w.location(rel),
+		},
+	})
+	var exists *ResourceExistsError
+	var linked bool
+	switch {
+	case err == nil:
+		f.ResourceID = resource.ID
+	case errors.As(err, &exists):
+		f.ResourceID = exists.ResourceID
+		linked = true
+	default:
+		return false, err
+	}
+	return linked, w.record(f, rel, info, hash)
+}
+
+// update makes a changed file a new version of its resource, or a new
+// resource when its resource was deleted. It reports whether anything was
+// stored: a file touched without its content changing only has its record
+// updated.
+func (w *watchFolderIngest) update(f *models.WatchedFile, info os.FileInfo) (bool, error) {
+	hash, err := w.hash(f.Path)
+	if err != nil {
+		return false, err
+	}
+	if hash == f.Hash {
+		return false, w.record(f, f.Path, info, hash)
+	}
+	if !w.resourceExists(f.ResourceID) {
+		_, err := w.add(f, f.Path, info, hash)
+		return err == nil, err
+	}
+
+	file, err := w.fsys.Open(w.location(f.Path))
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	header := &multipart.FileHeader{Filename: path.Base(f.Path), Size: info.Size()}
+	if _, err := w.ctx.UploadNewVersion(f.ResourceID, file, header, "Changed in watch folder "+w.folder.Name); err != nil {
+		return false, err
+	}
+	return true, w.record(f, f.Path, info, hash)
+}
+
+// move points a moved file's resource at its new location, moves it to the
+// group that location maps to, and adds the tags the rules give it there.
+func (w *watchFolderIngest) move(f *models.WatchedFile, rel string, info os.FileInfo) error {
+	var resource models.Resource
+	if err := w.ctx.db.First(&resource, f.ResourceID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			_, err = w.add(f, rel, info, f.Hash)
+		}
+		return err
+	}
+	owner, tags, err := w.target(rel)
+	if err != nil {
+		return err
+	}
+	updates := map[string]interface{}{"original_location": w.location(rel)}
+	ownerChanged := resource.OwnerId == nil || *resource.OwnerId != owner
+	if ownerChanged {
+		updates["owner_id"] = owner
+	}
+	if err := w.ctx.db.Model(&resource).Updates(updates).Error; err != nil {
+		return err
+	}
+	if ownerChanged {
+		w.ctx.logStorageUsageError(resource.ID, w.ctx.refreshStorageUsage(w.ctx.db, resource.ID))
+	}
+	if len(tags) > 0 {
+		if err := w.ctx.BulkAddTagsToResources(&query_models.BulkEditQuery{
+			BulkQuery: query_models.BulkQuery{ID: []uint{resource.ID}},
+			EditedId:  tags,
+		}); err != nil {
+			return err
+		}
+	}
+	w.ctx.Logger().Info(models.LogActionUpdate, "resource", &resource.ID, resource.Name, "Moved in watch folder "+w.folder.Name, map[string]interface{}{
+		"from": w.location(f.Path),
+		"to":   w.location(rel),
+	})
+	return w.record(f, rel, info, f.Hash)
+}
+
+// remove forgets a file that is gone, deleting its resource when the folder
+// says to.
+func (w *watchFolderIngest) remove(f *models.WatchedFile) error {
+	if w.folder.OnDelete == WatchOnDeleteDelete && w.resourceExists(f.ResourceID) {
+		if err := w.ctx.DeleteResource(f.ResourceID); err != nil {
+			return err
+		}
+	}
+	return w.ctx.db.Delete(f).Error
+}
+
+func (w *watchFolderIngest) resourceExists(id uint) bool {
+	var count int64
+	w.ctx.db.Model(&models.Resource{}).Where("id = ?", id).Count(&count)
+	return count > 0
+}
+
+// record saves what a file looked like when it was read.
+func (w *watchFolderIngest) record(f *models.WatchedFile, rel string, info os.FileInfo, hash string) error {
+	f.WatchFolderID = w.folder.ID
+	f.Path = rel
+	f.Size = info.Size()
+	f.ModTime = watchModTime(info.ModTime())
+	f.Hash = hash
+	return w.ctx.db.Save(f).Error
+}
+
+// WatchFolderScheduler polls the watch folders every interval.
+type WatchFolderScheduler struct {
+	ctx      *MahresourcesContext
+	interval time.Duration
+	done     chan struct{}
+	stopOnce sync.Once
+	running  sync.WaitGroup
+}
+
+func NewWatchFolderScheduler(ctx *MahresourcesContext, interval time.Duration) *WatchFolderScheduler {
+	if interval <= 0 {
+		interval = DefaultWatchFolderInterval
+	}
+	return &WatchFolderScheduler{ctx: ctx, interval: interval, done: make(chan struct{})}
+}
+
+// Start begins ticking. It returns immediately.
+func (s *WatchFolderScheduler) Start() {
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.Tick()
+			case <-s.done:
+				return
+			}
+		}
+	}()
+}
+
+// Stop halts the ticker.
+func (s *WatchFolderScheduler) Stop() {
+	s.stopOnce.Do(func() { close(s.done) })
+	s.running.Wait()
+}
+
+// Tick polls the watch folders once.
+func (s *WatchFolderScheduler) Tick() {
+	if err := s.ctx.PollWatchFolders(); err != nil {
+		log.Printf("warning: watch folders could not be polled: %v", err)
+	}
+}
@@ -0,0 +1,336 @@
+package application_context
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/spf13/afero"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"mahresources/constants"
+	"mahresources/models"
+	"mahresources/models/query_models"
+)
+
+func createWatchTestContext(t *testing.T, cacheName string) (*MahresourcesContext, afero.Fs) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+cacheName+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(
+		&models.Resource{},
+		&models.ResourceVersion{},
+		&models.Note{},
+		&models.Tag{},
+		&models.Group{},
+		&models.Category{},
+		&models.NoteType{},
+		&models.Preview{},
+		&models.ImageHash{},
+		&models.ResourceSimilarity{},
+		&models.LogEntry{},
+		&models.ResourceCategory{},
+		&models.Series{},
+		&models.NoteBlock{},
+		&models.WatchFolder{},
+		&models.WatchedFile{},
+	); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	ctx := NewMahresourcesContext(afero.NewMemMapFs(), db, sqlx.NewDb(sqlDB, "sqlite3"), &MahresourcesConfig{DbType: constants.DbTypeSqlite})
+	defaultRC := &models.ResourceCategory{Name: "Default"}
+	defaultRC.ID = 1
+	db.FirstOrCreate(defaultRC, 1)
+
+	nas := afero.NewMemMapFs()
+	if err := nas.MkdirAll("/inbox", 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	ctx.altFileSystems["nas"] = nas
+	return ctx, nas
+}
+
+// writeSettled writes a file whose modification time is already past the
+// settle time.
+func writeSettled(t *testing.T, fs afero.Fs, name, body string) {
+	t.Helper()
+	if err := afero.WriteFile(fs, name, []byte(body), 0644); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := fs.Chtimes(name, old, old); err != nil {
+		t.Fatalf("chtimes %s: %v", name, err)
+	}
+}
+
+// scanWatchFolderAndWait runs a scan of the folder and returns its report.
+func scanWatchFolderAndWait(t *testing.T, ctx *MahresourcesContext, id uint) (*models.WatchFolder, *WatchScanReport) {
+	t.Helper()
+	if _, err := ctx.StartWatchScan(id); err != nil {
+		t.Fatalf("StartWatchScan: %v", err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if _, busy := ctx.watchScans.Load(id); !busy {
+			var folder models.WatchFolder
+			if err := ctx.db.First(&folder, id).Error; err != nil {
+				t.Fatalf("load folder: %v", err)
+			}
+			if folder.LastScanAt != nil && time.Since(*folder.LastScanAt) < 10*time.Second {
+				if folder.LastError != "" {
+					t.Fatalf("scan failed: %s", folder.LastError)
+				}
+				var report WatchScanReport
+				if err := json.Unmarshal(folder.LastReport, &report); err != nil {
+					t.Fatalf("scan report: %v", err)
+				}
+				// Mark the scan as read, so the next wait sees the next one.
+				ctx.db.Model(&folder).Update("last_scan_at", time.Now().Add(-time.Hour))
+				return &folder, &report
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("scan of watch folder %d did not finish", id)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestWatchFolder_IngestsVersionsMovesAndRemovesFiles(t *testing.T) {
+	ctx, nas := createWatchTestContext(t, "watch_folder_lifecycle_test")
+	owner := models.Group{Name: "Inbox"}
+	invoices := models.Group{Name: "Invoices"}
+	pdf := models.Tag{Name: "pdf"}
+	for _, entity := range []any{&owner, &invoices, &pdf} {
+		if err := ctx.db.Create(entity).Error; err != nil {
+			t.Fatalf("create: %v", err)
+		}
+	}
+
+	writeSettled(t, nas, "/inbox/scans/2024/a.txt", "first")
+	writeSettled(t, nas, "/inbox/invoices/march.pdf", "invoice")
+	writeSettled(t, nas, "/inbox/.partial", "hidden")
+
+	folder, err := ctx.SetWatchFolder(&query_models.WatchFolderEditor{
+		Name:         "inbox",
+		FileSystem:   "nas",
+		Path:         "inbox",
+		OwnerGroupId: owner.ID,
+		Subfolders:   true,
+		Rules: []query_models.WatchFolderRule{
+			{Pattern: "*.pdf", Tags: []uint{pdf.ID}},
+			{Pattern: "invoices/**", GroupID: invoices.ID},
+		},
+		OnDelete: WatchOnDeleteDelete,
+	})
+	if err != nil {
+		t.Fatalf("SetWatchFolder: %v", err)
+	}
+	if folder.Path != "/inbox" {
+		t.Errorf("path stored as %q, want /inbox", folder.Path)
+	}
+
+	_, report := scanWatchFolderAndWait(t, ctx, folder.ID)
+	if report.Added != 2 || report.Failed != 0 {
+		t.Fatalf("first scan: %+v, want 2 added", report)
+	}
+
+	var scans, year models.Group
+	if err := ctx.db.Where("owner_id = ? AND name = ?", owner.ID, "scans").First(&scans).Error; err != nil {
+		t.Fatalf("no group for scans/: %v", err)
+	}
+	if err := ctx.db.Where("owner_id = ? AND name = ?", scans.ID, "2024").First(&year).Error; err != nil {
+		t.Fatalf("no group for scans/2024/: %v", err)
+	}
+	var first, invoice models.Resource
+	if err := ctx.db.Where("original_location = ?", "/inbox/scans/2024/a.txt").First(&first).Error; err != nil {
+		t.Fatalf("no resource for a.txt: %v", err)
+	}
+	if first.OwnerId == nil || *first.OwnerId != year.ID {
+		t.Errorf("a.txt is owned by %v, want the 2024 group %d", first.OwnerId, year.ID)
+	}
+	if err := ctx.db.Preload("Tags").Where("original_location = ?", "/inbox/invoices/march.pdf").First(&invoice).Error; err != nil {
+		t.Fatalf("no resource for march.pdf: %v", err)
+	}
+	if invoice.OwnerId == nil || *invoice.OwnerId != invoices.ID {
+		t.Errorf("march.pdf is owned by %v, want the rule's group %d", invoice.OwnerId, invoices.ID)
+	}
+	if len(invoice.Tags) != 1 || invoice.Tags[0].ID != pdf.ID {
+		t.Errorf("march.pdf has tags %v, want the rule's tag", invoice.Tags)
+	}
+
+	// Nothing changed: a poll submits nothing and a scan does nothing.
+	diff, _, err := ctx.diffWatchFolder(&folder.WatchFolder)
+	if err != nil || !diff.empty() {
+		t.Fatalf("an unchanged folder differs: %+v, %v", diff, err)
+	}
+
+	// A changed file becomes a version; a moved one keeps its resource.
+	writeSettled(t, nas, "/inbox/scans/2024/a.txt", "first, edited")
+	if err := nas.Rename("/inbox/invoices/march.pdf", "/inbox/scans/march.pdf"); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	_, report = scanWatchFolderAndWait(t, ctx, folder.ID)
+	if report.Versioned != 1 || report.Moved != 1 || report.Added != 0 || report.Removed != 0 {
+		t.Fatalf("second scan: %+v, want 1 versioned and 1 moved", report)
+	}
+	var versions int64
+	ctx.db.Model(&models.ResourceVersion{}).Where("resource_id = ?", first.ID).Count(&versions)
+	if versions != 2 {
+		t.Errorf("a.txt has %d versions, want 2", versions)
+	}
+	var moved models.Resource
+	if err := ctx.db.First(&moved, invoice.ID).Error; err != nil {
+		t.Fatalf("the moved file's resource is gone: %v", err)
+	}
+	if moved.OriginalLocation != "/inbox/scans/march.pdf" || moved.OwnerId == nil || *moved.OwnerId != scans.ID {
+		t.Errorf("moved resource is at %q under %v, want /inbox/scans/march.pdf under %d", moved.OriginalLocation, moved.OwnerId, scans.ID)
+	}
+
+	// A removed file deletes its resource, as the folder says.
+	if err := nas.Remove("/inbox/scans/2024/a.txt"); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	_, report = scanWatchFolderAndWait(t, ctx, folder.ID)
+	if report.Removed != 1 {
+		t.Fatalf("third scan: %+v, want 1 removed", report)
+	}
+	var count int64
+	ctx.db.Model(&models.Resource{}).Where("id = ?", first.ID).Count(&count)
+	if count != 0 {
+		t.Error("the removed file's resource was kept")
+	}
+	ctx.db.Model(&models.Resource{}).Where("original_location = ?", "/inbox/.partial").Count(&count)
+	if count != 0 {
+		t.Error("a hidden file was ingested")
+	}
+}
+
+func TestWatchFolder_LeavesUnsettledFilesForALaterScan(t *testing.T) {
+	ctx, nas := createWatchTestContext(t, "watch_folder_settle_test")
+	ctx.Config.WatchFolderSettle = time.Hour
+	owner := models.Group{Name: "Inbox"}
+	if err := ctx.db.Create(&owner).Error; err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	writeSettled(t, nas, "/inbox/old.txt", "old")
+	folder, err := ctx.SetWatchFolder(&query_models.WatchFolderEditor{Name: "inbox", FileSystem: "nas", Path: "/inbox", OwnerGroupId: owner.ID})
+	if err != nil {
+		t.Fatalf("SetWatchFolder: %v", err)
+	}
+	_, report := scanWatchFolderAndWait(t, ctx, folder.ID)
+	if report.Added != 1 {
+		t.Fatalf("first scan: %+v, want 1 added", report)
+	}
+
+	// old.txt is moved and another file is still being copied in, which
+	// could be a moved file too: removals wait, but the move is recognized.
+	if err := nas.Rename("/inbox/old.txt", "/inbox/renamed.txt"); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	writeSettled(t, nas, "/inbox/gone.txt", "gone")
+	if err := afero.WriteFile(nas, "/inbox/copying.txt", []byte("half"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	_, report = scanWatchFolderAndWait(t, ctx, folder.ID)
+	if report.Added != 1 || report.Moved != 1 || report.Pending != 1 {
+		t.Fatalf("second scan: %+v, want gone.txt added, old.txt moved and copying.txt pending", report)
+	}
+	if err := ctx.db.Model(&folder.WatchFolder).Update("on_delete", WatchOnDeleteDelete).Error; err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := nas.Remove("/inbox/gone.txt"); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	diff, _, err := ctx.diffWatchFolder(&folder.WatchFolder)
+	if err != nil {
+		t.Fatalf("diffWatchFolder: %v", err)
+	}
+	if diff.pending != 1 || len(diff.missing) != 0 || len(diff.held) != 1 {
+		t.Errorf("pending %d, missing %d, held %d; want the removal held while copying.txt settles", diff.pending, len(diff.missing), len(diff.held))
+	}
+
+	if err := ctx.PollWatchFolders(); err != nil {
+		t.Fatalf("PollWatchFolders: %v", err)
+	}
+	if _, busy := ctx.watchScans.Load(folder.ID); busy {
+		t.Error("a poll submitted a scan for a folder with nothing settled")
+	}
+}
+
+func TestSetWatchFolder_RejectsBadFolders(t *testing.T) {
+	ctx, nas := createWatchTestContext(t, "watch_folder_reject_test")
+	owner := models.Group{Name: "Inbox"}
+	if err := ctx.db.Create(&owner).Error; err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	writeSettled(t, nas, "/inbox/file.txt", "x")
+	valid := query_models.WatchFolderEditor{Name: "inbox", FileSystem: "nas", Path: "/inbox", OwnerGroupId: owner.ID}
+
+	for name, edit := range map[string]func(e *query_models.WatchFolderEditor){
+		"unattached fs":  func(e *query_models.WatchFolderEditor) { e.FileSystem = "usb" },
+		"missing folder": func(e *query_models.WatchFolderEditor) { e.Path = "/outbox" },
+		"a file":         func(e *query_models.WatchFolderEditor) { e.Path = "/inbox/file.txt" },
+		"no owner":       func(e *query_models.WatchFolderEditor) { e.OwnerGroupId = 0 },
+		"unknown tag": func(e *query_models.WatchFolderEditor) {
+			e.Rules = []query_models.WatchFolderRule{{Pattern: "*", Tags: []uint{999}}}
+		},
+		"bad pattern": func(e *query_models.WatchFolderEditor) {
+			e.Rules = []query_models.WatchFolderRule{{Pattern: "[", GroupID: owner.ID}}
+		},
+		"bad onDelete": func(e *query_models.WatchFolderEditor) { e.OnDelete = "archive" },
+	} {
+		editor := valid
+		edit(&editor)
+		if _, err := ctx.SetWatchFolder(&editor); err == nil {
+			t.Errorf("%s: SetWatchFolder accepted it", name)
+		}
+	}
+
+	folder, err := ctx.SetWatchFolder(&valid)
+	if err != nil {
+		t.Fatalf("SetWatchFolder: %v", err)
+	}
+	if _, err := ctx.SetWatchFolder(&valid); err == nil {
+		t.Error("a second folder with the same name was accepted")
+	}
+	if err := nas.MkdirAll("/elsewhere", 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	moved := valid
+	moved.ID = folder.ID
+	moved.Path = "/elsewhere"
+	if _, err := ctx.SetWatchFolder(&moved); err == nil {
+		t.Error("a watch folder was moved to another path")
+	}
+	if err := ctx.DeleteWatchFolder(9999); !errors.Is(err, ErrWatchFolderNotFound) {
+		t.Errorf("deleting an unknown folder: got %v, want ErrWatchFolderNotFound", err)
+	}
+}
+
+func TestWatchRuleMatches(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"*.pdf", "a.pdf", true},
+		{"*.pdf", "deep/down/a.pdf", true},
+		{"*.pdf", "a.txt", false},
+		{"invoices/*.pdf", "invoices/a.pdf", true},
+		{"invoices/*.pdf", "invoices/2024/a.pdf", false},
+		{"invoices/**", "invoices/2024/a.pdf", true},
+		{"invoices/**", "invoices", false},
+		{"invoices/**", "other/invoices/a.pdf", false},
+		{"*/raw/**", "cam1/raw/x.dng", true},
+	} {
+		if got := watchRuleMatches(tc.pattern, tc.path); got != tc.want {
+			t.Errorf("watchRuleMatches(%q, %q) = %v, want %v", tc.pattern, tc.path, got, tc.want)
+		}
+	}
+}
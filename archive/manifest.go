@@ -224,6 +224,7 @@ type ResourcePayload struct {
 	OriginalLocation     string                   `json:"original_location"`
 	Hash                 string                   `json:"hash"`
 	HashType             string                   `json:"hash_type"`
+	LegacyHash           string                   `json:"legacy_hash,omitempty"` // the SHA1 when hash_type is SHA256
 	FileSize             int64                    `json:"file_size"`
 	ContentType          string                   `json:"content_type"`
 	ContentCategory      string                   `json:"content_category"`
@@ -255,6 +256,7 @@ type ResourceVersionPayload struct {
 	VersionNumber   int       `json:"version_number"`
 	Hash            string    `json:"hash"`
 	HashType        string    `json:"hash_type"`
+	LegacyHash      string    `json:"legacy_hash,omitempty"`
 	FileSize        int64     `json:"file_size"`
 	ContentType     string    `json:"content_type"`
 	Width           uint      `json:"width"`
@@ -35,6 +35,15 @@ func New(baseURL string) *Client {
 	}
 }
 
+// WithTimeout returns a copy of c whose requests give up after d. Commands
+// leave requests unbounded; a caller that must stay responsive, like the
+// language server answering an editor, uses this instead.
+func (c *Client) WithTimeout(d time.Duration) *Client {
+	hc := *c.httpClient
+	hc.Timeout = d
+	return &Client{BaseURL: c.BaseURL, httpClient: &hc}
+}
+
 // authTransport injects an Authorization: Bearer header on every request.
 type authTransport struct {
 	token string
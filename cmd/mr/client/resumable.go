@@ -0,0 +1,361 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultChunkSize is how much of a file one request of a resumable upload
+// carries.
+const DefaultChunkSize int64 = 16 << 20
+
+const tusVersion = "1.0.0"
+
+// resumableAttempts bounds how many requests in a row may fail before an
+// upload gives up. It is reset whenever the upload moves forward.
+const resumableAttempts = 5
+
+// resumableRetryDelay is the wait before the first retry; it doubles with each
+// one after. A variable so tests need not wait.
+var resumableRetryDelay = time.Second
+
+// ResumableResult is what a finished resumable upload created. VersionID is
+// zero unless the upload was a new version; an upload sent with "expand"
+// creates no resource, and ExpansionID names the archive expansion it started.
+type ResumableResult struct {
+	ResourceID  uint
+	VersionID   uint
+	ExpansionID uint
+}
+
+// errUploadGone is an upload the server no longer has: it expired, or was
+// abandoned.
+var errUploadGone = errors.New("the server no longer has this upload")
+
+// UploadResumable sends filePath through the server's tus endpoint,
+// /v1/uploads, in chunks of chunkSize bytes. metadata is the upload's
+// Upload-Metadata: "filename", and the resource's fields or, for a new version,
+// "resourceId" and "comment". "expand" unpacks an archive into a new group.
+//
+// A chunk that fails is retried from wherever the server says the upload
+// stands. An upload that still fails is remembered, keyed by the server, the
+// file's path, size and modification time, and the metadata, so running the
+// same command again picks it up where it stopped.
+func (c *Client) UploadResumable(filePath string, metadata map[string]string, chunkSize int64) (*ResumableResult, error) {
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	length := info.Size()
+	key := c.uploadFingerprint(filePath, info, metadata)
+
+	var offset int64
+	location := readUploadState()[key]
+	if location != "" {
+		var result *ResumableResult
+		offset, result, err = c.uploadOffset(location)
+		switch {
+		case result != nil:
+			forgetUpload(key)
+			return result, nil
+		case errors.Is(err, errUploadGone):
+			location = ""
+		case err != nil:
+			return nil, err
+		}
+	}
+	if location == "" {
+		var result *ResumableResult
+		location, result, err = c.createUpload(length, metadata)
+		if err != nil {
+			return nil, err
+		}
+		if result != nil {
+			return result, nil
+		}
+		offset = 0
+		rememberUpload(key, location)
+	}
+
+	failures := 0
+	for {
+		next, result, retry, err := c.patchUpload(location, file, offset, min(chunkSize, length-offset))
+		if result != nil {
+			forgetUpload(key)
+			return result, nil
+		}
+		if err == nil {
+			if next <= offset {
+				return nil, fmt.Errorf("the server accepted no bytes at offset %d of %d", offset, length)
+			}
+			offset, failures = next, 0
+			continue
+		}
+		if !retry {
+			// The upload cannot succeed as it is; let the server drop it now
+			// rather than when it expires.
+			c.abandonUpload(location)
+			forgetUpload(key)
+			return nil, err
+		}
+		failures++
+		if failures >= resumableAttempts {
+			return nil, fmt.Errorf("%w (run the command again to resume the upload)", err)
+		}
+		time.Sleep(resumableRetryDelay << (failures - 1))
+		if next, result, headErr := c.uploadOffset(location); result != nil {
+			forgetUpload(key)
+			return result, nil
+		} else if headErr == nil {
+			offset = next
+		} else if errors.Is(headErr, errUploadGone) {
+			forgetUpload(key)
+			return nil, headErr
+		}
+	}
+}
+
+func (c *Client) newTusRequest(method, target string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Tus-Resumable", tusVersion)
+	req.Header.Set("Accept", "application/json")
+	return req, nil
+}
+
+// createUpload starts an upload and returns its URL. An empty file is
+// complete as soon as it exists, so its result comes back instead.
+func (c *Client) createUpload(length int64, metadata map[string]string) (string, *ResumableResult, error) {
+	req, err := c.newTusRequest(http.MethodPost, c.buildURL("/v1/uploads", nil), nil)
+	if err != nil {
+		return "", nil, err
+	}
+	req.Header.Set("Upload-Length", strconv.FormatInt(length, 10))
+	req.Header.Set("Upload-Metadata", encodeUploadMetadata(metadata))
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return "", nil, decodeError(resp)
+	}
+	if result := uploadResult(resp); result != nil {
+		return "", result, nil
+	}
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return "", nil, errors.New("the server did not say where the upload is")
+	}
+	if strings.HasPrefix(location, "/") {
+		location = c.BaseURL + location
+	}
+	return location, nil, nil
+}
+
+// uploadOffset asks how much of an upload the server has, or what it created
+// once it has all of it.
+func (c *Client) uploadOffset(location string) (int64, *ResumableResult, error) {
+	req, err := c.newTusRequest(http.MethodHead, location, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return 0, nil, errUploadGone
+	case resp.StatusCode != http.StatusOK:
+		return 0, nil, fmt.Errorf("HTTP %d asking for the upload's offset", resp.StatusCode)
+	}
+	if result := uploadResult(resp); result != nil {
+		return 0, result, nil
+	}
+	offset, err := parseUploadOffset(resp)
+	return offset, nil, err
+}
+
+// patchUpload sends n bytes of file from offset. retry reports whether a
+// failure may succeed when tried again.
+func (c *Client) patchUpload(location string, file *os.File, offset, n int64) (next int64, result *ResumableResult, retry bool, err error) {
+	req, err := c.newTusRequest(http.MethodPatch, location, io.NewSectionReader(file, offset, n))
+	if err != nil {
+		return 0, nil, false, err
+	}
+	req.ContentLength = n
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+	req.Header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, true, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNoContent:
+		if result := uploadResult(resp); result != nil {
+			return 0, result, false, nil
+		}
+		next, err := parseUploadOffset(resp)
+		return next, nil, false, err
+	case resp.StatusCode == http.StatusConflict && resp.Header.Get("Upload-Offset") != strconv.FormatInt(offset, 10):
+		// The server has a different offset than this chunk assumed: a
+		// retry asks for it first.
+		return 0, nil, true, decodeError(resp)
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return 0, nil, false, errUploadGone
+	case resp.StatusCode == http.StatusInsufficientStorage:
+		// Over a storage quota: retrying will not change that.
+		return 0, nil, false, decodeError(resp)
+	case resp.StatusCode == http.StatusLocked || resp.StatusCode >= 500:
+		return 0, nil, true, decodeError(resp)
+	default:
+		return 0, nil, false, decodeError(resp)
+	}
+}
+
+func (c *Client) abandonUpload(location string) {
+	req, err := c.newTusRequest(http.MethodDelete, location, nil)
+	if err != nil {
+		return
+	}
+	if resp, err := c.httpClient.Do(req); err == nil {
+		resp.Body.Close()
+	}
+}
+
+func parseUploadOffset(resp *http.Response) (int64, error) {
+	offset, err := strconv.ParseInt(resp.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("the server sent no valid Upload-Offset: %w", err)
+	}
+	return offset, nil
+}
+
+// uploadResult reads what a finished upload created from its response headers,
+// or returns nil while it is unfinished.
+func uploadResult(resp *http.Response) *ResumableResult {
+	if expansionID, err := strconv.ParseUint(resp.Header.Get("X-Expansion-Id"), 10, 64); err == nil {
+		return &ResumableResult{ExpansionID: uint(expansionID)}
+	}
+	resourceID, err := strconv.ParseUint(resp.Header.Get("X-Resource-Id"), 10, 64)
+	if err != nil {
+		return nil
+	}
+	versionID, _ := strconv.ParseUint(resp.Header.Get("X-Version-Id"), 10, 64)
+	return &ResumableResult{ResourceID: uint(resourceID), VersionID: uint(versionID)}
+}
+
+func encodeUploadMetadata(metadata map[string]string) string {
+	keys := make([]string, 0, len(metadata))
+	for k := range metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+" "+base64.StdEncoding.EncodeToString([]byte(metadata[k])))
+	}
+	return strings.Join(pairs, ",")
+}
+
+// uploadFingerprint identifies an upload across runs: the same file, unchanged,
+// sent to the same server with the same fields.
+func (c *Client) uploadFingerprint(filePath string, info os.FileInfo, metadata map[string]string) string {
+	abs, err := filepath.Abs(filePath)
+	if err != nil {
+		abs = filePath
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%d\n%d\n%s", normalizeOrigin(c.BaseURL), abs, info.Size(), info.ModTime().UnixNano(), encodeUploadMetadata(metadata))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// uploadStatePath returns the file unfinished uploads are remembered in.
+// Honors MR_UPLOAD_STATE_FILE, then the user cache directory
+// (XDG_CACHE_HOME, ~/.cache/mahresources/uploads.json on Linux).
+func uploadStatePath() string {
+	if p := os.Getenv("MR_UPLOAD_STATE_FILE"); p != "" {
+		return p
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "mahresources", "uploads.json")
+}
+
+// readUploadState loads the fingerprint→upload URL map.
+func readUploadState() map[string]string {
+	m := map[string]string{}
+	path := uploadStatePath()
+	if path == "" {
+		return m
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return m
+	}
+	_ = json.Unmarshal(b, &m)
+	return m
+}
+
+// writeUploadState persists the map (0600, like the token file). Failing to
+// remember an upload only costs resuming it, so errors are dropped.
+func writeUploadState(m map[string]string) {
+	path := uploadStatePath()
+	if path == "" {
+		return
+	}
+	if len(m) == 0 {
+		_ = os.Remove(path)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return
+	}
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return
+	}
+	_ = os.WriteFile(path, append(b, '\n'), 0600)
+}
+
+func rememberUpload(key, location string) {
+	m := readUploadState()
+	m[key] = location
+	writeUploadState(m)
+}
+
+func forgetUpload(key string) {
+	m := readUploadState()
+	if _, ok := m[key]; ok {
+		delete(m, key)
+		writeUploadState(m)
+	}
+}
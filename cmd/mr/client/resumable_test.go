@@ -0,0 +1,109 @@
+package client
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeTusServer keeps one upload in memory. failFrom makes every PATCH that
+// starts at or past it store half its body and then answer 503, the way a
+// connection dropping mid-chunk leaves the server.
+type fakeTusServer struct {
+	mu       sync.Mutex
+	data     []byte
+	length   int64
+	created  int
+	failFrom int64
+}
+
+func (s *fakeTusServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Set("Tus-Resumable", tusVersion)
+	switch r.Method {
+	case http.MethodPost:
+		s.created++
+		s.length, _ = strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+		s.data = nil
+		w.Header().Set("Location", "/v1/uploads/abc")
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodHead:
+		w.Header().Set("Upload-Offset", strconv.Itoa(len(s.data)))
+		w.WriteHeader(http.StatusOK)
+	case http.MethodPatch:
+		offset, _ := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+		if offset != int64(len(s.data)) {
+			w.Header().Set("Upload-Offset", strconv.Itoa(len(s.data)))
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if s.failFrom >= 0 && offset >= s.failFrom {
+			s.data = append(s.data, body[:len(body)/2]...)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		s.data = append(s.data, body...)
+		if int64(len(s.data)) == s.length {
+			w.Header().Set("X-Resource-Id", "7")
+		}
+		w.Header().Set("Upload-Offset", strconv.Itoa(len(s.data)))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestUploadResumable_ResumesAfterAFailedRun(t *testing.T) {
+	defer func(d time.Duration) { resumableRetryDelay = d }(resumableRetryDelay)
+	resumableRetryDelay = 0
+	t.Setenv("MR_TOKEN", "")
+	statePath := filepath.Join(t.TempDir(), "uploads.json")
+	t.Setenv("MR_UPLOAD_STATE_FILE", statePath)
+
+	content := bytes.Repeat([]byte("0123456789"), 100)
+	path := filepath.Join(t.TempDir(), "video.mkv")
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := &fakeTusServer{failFrom: 300}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	c := New(srv.URL)
+	meta := map[string]string{"filename": "video.mkv"}
+
+	if _, err := c.UploadResumable(path, meta, 100); err == nil {
+		t.Fatal("the upload succeeded against a failing server")
+	}
+	if _, err := os.Stat(statePath); err != nil {
+		t.Fatalf("the unfinished upload was not remembered: %v", err)
+	}
+	if len(fake.data) <= 300 {
+		t.Fatalf("the failed chunks were not retried from the server's offset: %d bytes stored", len(fake.data))
+	}
+
+	fake.failFrom = -1
+	result, err := c.UploadResumable(path, meta, 100)
+	if err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	if result.ResourceID != 7 {
+		t.Errorf("ResourceID = %d, want 7", result.ResourceID)
+	}
+	if fake.created != 1 {
+		t.Errorf("the second run started %d new uploads, want to resume the first", fake.created-1)
+	}
+	if !bytes.Equal(fake.data, content) {
+		t.Error("the server assembled different bytes than the file")
+	}
+	if _, err := os.Stat(statePath); !os.IsNotExist(err) {
+		t.Error("the finished upload is still remembered")
+	}
+}
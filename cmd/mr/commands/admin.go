@@ -4,7 +4,9 @@ import (
 	"embed"
 	"encoding/json"
 	"fmt"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"mahresources/cmd/mr/client"
@@ -87,6 +89,7 @@ type adminConfigSummaryResponse struct {
 	HasReadOnlyDB           bool     `json:"hasReadOnlyDB"`
 	FfmpegAvailable         bool     `json:"ffmpegAvailable"`
 	LibreOfficeAvailable    bool     `json:"libreOfficeAvailable"`
+	PdfRendererAvailable    bool     `json:"pdfRendererAvailable"`
 	HashWorkerCount         int      `json:"hashWorkerCount"`
 	HashBatchSize           int      `json:"hashBatchSize"`
 	HashPollInterval        string   `json:"hashPollInterval"`
@@ -106,10 +109,25 @@ type adminDataStatsResponse struct {
 	StorageTotalFmt              string                     `json:"storageTotalFmt"`
 	TotalVersionStorageBytes     int64                      `json:"totalVersionStorageBytes"`
 	TotalVersionStorageFormatted string                     `json:"totalVersionStorageFormatted"`
+	Quotas                       []adminStorageQuota        `json:"quotas"`
 	Growth                       adminGrowthStatsResponse   `json:"growth"`
 	Config                       adminConfigSummaryResponse `json:"config"`
 }
 
+// adminStorageQuota matches the StorageQuotaStatus JSON shape.
+type adminStorageQuota struct {
+	SubjectType   string `json:"subjectType"`
+	SubjectID     uint   `json:"subjectId"`
+	SubjectName   string `json:"subjectName"`
+	MaxBytes      int64  `json:"maxBytes"`
+	MaxBytesFmt   string `json:"maxBytesFmt"`
+	MaxResources  int64  `json:"maxResources"`
+	UsedBytes     int64  `json:"usedBytes"`
+	UsedBytesFmt  string `json:"usedBytesFmt"`
+	UsedResources int64  `json:"usedResources"`
+	Exceeded      bool   `json:"exceeded"`
+}
+
 // adminContentTypeStorageResponse matches the ContentTypeStorage JSON shape.
 type adminContentTypeStorageResponse struct {
 	ContentType string `json:"contentType"`
@@ -169,9 +187,40 @@ type adminSettingView struct {
 	Reason      string      `json:"reason,omitempty"`
 }
 
+// adminBlobScrubRun matches the BlobScrubRun JSON shape from blob_integrity_model.go.
+type adminBlobScrubRun struct {
+	ID           uint       `json:"id"`
+	StartedAt    time.Time  `json:"startedAt"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+	FinishedAt   *time.Time `json:"finishedAt"`
+	Repair       bool       `json:"repair"`
+	Phase        string     `json:"phase"`
+	LastID       uint       `json:"lastId"`
+	Checked      int64      `json:"checked"`
+	CheckedBytes int64      `json:"checkedBytes"`
+	Quarantined  int64      `json:"quarantined"`
+	Repaired     int64      `json:"repaired"`
+	JobID        string     `json:"jobId"`
+}
+
+// adminBlobIntegrityIssue matches the BlobIntegrityIssue JSON shape.
+type adminBlobIntegrityIssue struct {
+	ID              uint      `json:"id"`
+	EntityType      string    `json:"entityType"`
+	EntityID        uint      `json:"entityId"`
+	ResourceID      uint      `json:"resourceId"`
+	StorageLocation string    `json:"storageLocation"`
+	Location        string    `json:"location"`
+	Problem         string    `json:"problem"`
+	Detail          string    `json:"detail"`
+	Status          string    `json:"status"`
+	RepairedFrom    string    `json:"repairedFrom"`
+	CheckedAt       time.Time `json:"checkedAt"`
+}
+
 // NewAdminCmd returns the "admin" command group. Bare `mr admin` delegates to
 // `mr admin stats` for backward compatibility.
-func NewAdminCmd(c *client.Client, opts *output.Options) *cobra.Command {
+func NewAdminCmd(c *client.Client, opts *output.Options, page *int) *cobra.Command {
 	help := helptext.Load(adminHelpFS, "admin_help/admin.md")
 	cmd := &cobra.Command{
 		Use:         "admin",
@@ -189,7 +238,225 @@ func NewAdminCmd(c *client.Client, opts *output.Options) *cobra.Command {
 	cmd.AddCommand(statsCmd)
 	cmd.AddCommand(NewAdminSettingsCmd(c, opts))
 	cmd.AddCommand(NewAdminSimilarityCmd(c, opts))
+	cmd.AddCommand(NewAdminScrubCmd(c, opts, page))
+	cmd.AddCommand(NewAdminGCCmd(c, opts))
+	cmd.AddCommand(NewAdminRehashCmd(c, opts))
+	cmd.AddCommand(NewAdminRekeyCmd(c, opts))
+	cmd.AddCommand(NewAdminTierCmd(c, opts))
+	cmd.AddCommand(NewAdminQuotaCmd(c, opts))
+	cmd.AddCommand(NewAdminWatchCmd(c, opts))
+
+	return cmd
+}
+
+// NewAdminScrubCmd starts the blob integrity scrub; its subcommands show the
+// progress and the report.
+func NewAdminScrubCmd(c *client.Client, opts *output.Options, page *int) *cobra.Command {
+	var repair, restart bool
+	help := helptext.Load(adminHelpFS, "admin_help/admin_scrub.md")
+	cmd := &cobra.Command{
+		Use:         "scrub",
+		Short:       "Re-hash stored files and quarantine damaged ones",
+		Long:        help.Long,
+		Example:     help.Example,
+		Annotations: help.Annotations,
+		Args:        cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			q := url.Values{}
+			if repair {
+				q.Set("repair", "true")
+			}
+			if restart {
+				q.Set("restart", "true")
+			}
+			var raw json.RawMessage
+			if err := c.Post("/v1/admin/scrub", q, struct{}{}, &raw); err != nil {
+				return err
+			}
+			if opts.JSON {
+				output.PrintRawJSON(raw)
+				return nil
+			}
+			var resp struct {
+				JobID   string `json:"jobId"`
+				RunID   uint   `json:"runId"`
+				Resumed bool   `json:"resumed"`
+				Phase   string `json:"phase"`
+				LastID  uint   `json:"lastId"`
+			}
+			if err := json.Unmarshal(raw, &resp); err != nil {
+				return fmt.Errorf("parsing response: %w", err)
+			}
+			if resp.Resumed {
+				fmt.Printf("Scrub run %d resumed at %s %d: job %s\n", resp.RunID, resp.Phase, resp.LastID, resp.JobID)
+			} else {
+				fmt.Printf("Scrub run %d started: job %s\n", resp.RunID, resp.JobID)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&repair, "repair", false, "Restore damaged files from intact copies with the same hash")
+	cmd.Flags().BoolVar(&restart, "restart", false, "Abandon the unfinished run instead of resuming it")
+
+	cmd.AddCommand(NewAdminScrubStatusCmd(c, opts))
+	cmd.AddCommand(NewAdminScrubReportCmd(c, opts, page))
+	cmd.AddCommand(NewAdminScrubRecheckCmd(c, opts))
+	return cmd
+}
+
+// NewAdminScrubStatusCmd shows the newest scrub run and the issue counts.
+func NewAdminScrubStatusCmd(c *client.Client, opts *output.Options) *cobra.Command {
+	help := helptext.Load(adminHelpFS, "admin_help/admin_scrub_status.md")
+	return &cobra.Command{
+		Use:         "status",
+		Short:       "Show scrub progress and issue counts",
+		Long:        help.Long,
+		Example:     help.Example,
+		Annotations: help.Annotations,
+		Args:        cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var raw json.RawMessage
+			if err := c.Get("/v1/admin/scrub", nil, &raw); err != nil {
+				return err
+			}
+			if opts.JSON {
+				output.PrintRawJSON(raw)
+				return nil
+			}
+			var resp struct {
+				Running bool               `json:"running"`
+				Run     *adminBlobScrubRun `json:"run"`
+				Issues  map[string]int64   `json:"issues"`
+			}
+			if err := json.Unmarshal(raw, &resp); err != nil {
+				return fmt.Errorf("parsing response: %w", err)
+			}
+			kvs := []output.KeyValue{{Key: "Running", Value: strconv.FormatBool(resp.Running)}}
+			if resp.Run != nil {
+				finished := "-"
+				if resp.Run.FinishedAt != nil {
+					finished = resp.Run.FinishedAt.Format(time.RFC3339)
+				}
+				kvs = append(kvs,
+					output.KeyValue{Key: "Run", Value: strconv.FormatUint(uint64(resp.Run.ID), 10)},
+					output.KeyValue{Key: "Started At", Value: resp.Run.StartedAt.Format(time.RFC3339)},
+					output.KeyValue{Key: "Finished At", Value: finished},
+					output.KeyValue{Key: "Repair", Value: strconv.FormatBool(resp.Run.Repair)},
+					output.KeyValue{Key: "Checkpoint", Value: fmt.Sprintf("%s %d", resp.Run.Phase, resp.Run.LastID)},
+					output.KeyValue{Key: "Checked", Value: strconv.FormatInt(resp.Run.Checked, 10)},
+					output.KeyValue{Key: "Checked Bytes", Value: strconv.FormatInt(resp.Run.CheckedBytes, 10)},
+					output.KeyValue{Key: "Quarantined", Value: strconv.FormatInt(resp.Run.Quarantined, 10)},
+					output.KeyValue{Key: "Repaired", Value: strconv.FormatInt(resp.Run.Repaired, 10)},
+				)
+			}
+			for _, status := range []string{"quarantined", "repaired", "cleared"} {
+				kvs = append(kvs, output.KeyValue{Key: "Issues " + status, Value: strconv.FormatInt(resp.Issues[status], 10)})
+			}
+			output.PrintSingle(*opts, kvs, nil)
+			return nil
+		},
+	}
+}
+
+// NewAdminScrubReportCmd lists the damaged files the scrub found.
+func NewAdminScrubReportCmd(c *client.Client, opts *output.Options, page *int) *cobra.Command {
+	var status, problem string
+	help := helptext.Load(adminHelpFS, "admin_help/admin_scrub_report.md")
+	cmd := &cobra.Command{
+		Use:         "report",
+		Short:       "List damaged files found by the scrub",
+		Long:        help.Long,
+		Example:     help.Example,
+		Annotations: help.Annotations,
+		Args:        cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			q := url.Values{}
+			q.Set("page", strconv.Itoa(*page))
+			if status != "" {
+				q.Set("status", status)
+			}
+			if problem != "" {
+				q.Set("problem", problem)
+			}
+			var raw json.RawMessage
+			if err := c.Get("/v1/admin/scrub/issues", q, &raw); err != nil {
+				return err
+			}
+			if opts.JSON {
+				output.PrintRawJSON(raw)
+				return nil
+			}
+			var issues []adminBlobIntegrityIssue
+			if err := json.Unmarshal(raw, &issues); err != nil {
+				return fmt.Errorf("parsing response: %w", err)
+			}
+			columns := []string{"ID", "ENTITY", "FILE", "PROBLEM", "STATUS", "DETAIL"}
+			var rows [][]string
+			for _, issue := range issues {
+				file := issue.Location
+				if issue.StorageLocation != "" {
+					file = issue.StorageLocation + ":" + file
+				}
+				detail := issue.Detail
+				if issue.RepairedFrom != "" {
+					detail = "from " + issue.RepairedFrom
+				}
+				rows = append(rows, []string{
+					strconv.FormatUint(uint64(issue.ID), 10),
+					fmt.Sprintf("%s %d", issue.EntityType, issue.EntityID),
+					file,
+					issue.Problem,
+					issue.Status,
+					detail,
+				})
+			}
+			output.Print(*opts, columns, rows, nil)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&status, "status", "", "Filter by status (quarantined/repaired/cleared)")
+	cmd.Flags().StringVar(&problem, "problem", "", "Filter by problem (missing/truncated/corrupted/unreadable)")
+	return cmd
+}
 
+// NewAdminScrubRecheckCmd checks one issue's file again.
+func NewAdminScrubRecheckCmd(c *client.Client, opts *output.Options) *cobra.Command {
+	var repair bool
+	help := helptext.Load(adminHelpFS, "admin_help/admin_scrub_recheck.md")
+	cmd := &cobra.Command{
+		Use:         "recheck <issue-id>",
+		Short:       "Check a quarantined file again",
+		Long:        help.Long,
+		Example:     help.Example,
+		Annotations: help.Annotations,
+		Args:        cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid issue ID: %w", err)
+			}
+			q := url.Values{}
+			q.Set("id", strconv.FormatUint(id, 10))
+			if repair {
+				q.Set("repair", "true")
+			}
+			var raw json.RawMessage
+			if err := c.Post("/v1/admin/scrub/recheck", q, struct{}{}, &raw); err != nil {
+				return err
+			}
+			if opts.JSON {
+				output.PrintRawJSON(raw)
+				return nil
+			}
+			var issue adminBlobIntegrityIssue
+			if err := json.Unmarshal(raw, &issue); err != nil {
+				return fmt.Errorf("parsing response: %w", err)
+			}
+			fmt.Printf("Issue %d is %s: %s\n", issue.ID, issue.Status, issue.Detail)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&repair, "repair", false, "Restore the file from an intact copy if it is still damaged")
 	return cmd
 }
 
@@ -411,11 +678,17 @@ func NewAdminStatsCmd(c *client.Client, opts *output.Options) *cobra.Command {
 					{Key: "Has Read-Only DB", Value: strconv.FormatBool(d.Config.HasReadOnlyDB)},
 					{Key: "FFmpeg Available", Value: strconv.FormatBool(d.Config.FfmpegAvailable)},
 					{Key: "LibreOffice Available", Value: strconv.FormatBool(d.Config.LibreOfficeAvailable)},
+					{Key: "PDF Renderer Available", Value: strconv.FormatBool(d.Config.PdfRendererAvailable)},
 					{Key: "Max DB Connections", Value: strconv.Itoa(d.Config.MaxDBConnections)},
 					{Key: "Remote Connect Timeout", Value: d.Config.RemoteConnectTimeout},
 					{Key: "Remote Idle Timeout", Value: d.Config.RemoteIdleTimeout},
 					{Key: "Remote Overall Timeout", Value: d.Config.RemoteOverallTimeout},
 				}, nil)
+
+				if len(d.Quotas) > 0 {
+					fmt.Println("\n=== Storage Quotas ===")
+					printStorageQuotas(*opts, d.Quotas)
+				}
 			}
 
 			if fetchExpensive {
@@ -710,3 +983,1189 @@ func printSettingView(opts output.Options, v adminSettingView) {
 		{Key: "Reason", Value: v.Reason},
 	}, nil)
 }
+
+// adminBlobGCStatus matches the BlobGCStatus JSON shape from blob_gc_context.go.
+type adminBlobGCStatus struct {
+	Running bool `json:"running"`
+	Run     *struct {
+		ID                 uint       `json:"id"`
+		StartedAt          time.Time  `json:"startedAt"`
+		FinishedAt         *time.Time `json:"finishedAt"`
+		DryRun             bool       `json:"dryRun"`
+		GracePeriodSeconds int64      `json:"gracePeriodSeconds"`
+		ReclaimedBytes     int64      `json:"reclaimedBytes"`
+		Error              string     `json:"error"`
+		Report             *struct {
+			Filesystems []struct {
+				Key            string   `json:"key"`
+				ScannedFiles   int64    `json:"scannedFiles"`
+				ScannedBytes   int64    `json:"scannedBytes"`
+				OrphanFiles    int64    `json:"orphanFiles"`
+				OrphanBytes    int64    `json:"orphanBytes"`
+				InGraceFiles   int64    `json:"inGraceFiles"`
+				DeletedFiles   int64    `json:"deletedFiles"`
+				ReclaimedBytes int64    `json:"reclaimedBytes"`
+				Orphans        []string `json:"orphans"`
+				Errors         []string `json:"errors"`
+			} `json:"filesystems"`
+			Dangling []struct {
+				EntityType      string `json:"entityType"`
+				EntityID        uint   `json:"entityId"`
+				StorageLocation string `json:"storageLocation"`
+				Location        string `json:"location"`
+			} `json:"dangling"`
+			DanglingCount       int64 `json:"danglingCount"`
+			OrphanPreviews      int64 `json:"orphanPreviews"`
+			OrphanPreviewBytes  int64 `json:"orphanPreviewBytes"`
+			DeletedPreviewCount int64 `json:"deletedPreviewCount"`
+		} `json:"report"`
+	} `json:"run"`
+}
+
+// NewAdminGCCmd starts the orphaned blob garbage collection.
+func NewAdminGCCmd(c *client.Client, opts *output.Options) *cobra.Command {
+	var dryRun bool
+	var grace time.Duration
+	help := helptext.Load(adminHelpFS, "admin_help/admin_gc.md")
+	cmd := &cobra.Command{
+		Use:         "gc",
+		Short:       "Delete stored files no resource or version references",
+		Long:        help.Long,
+		Example:     help.Example,
+		Annotations: help.Annotations,
+		Args:        cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			q := url.Values{}
+			if dryRun {
+				q.Set("dryRun", "true")
+			}
+			if cmd.Flags().Changed("grace") {
+				q.Set("grace", grace.String())
+			}
+			var raw json.RawMessage
+			if err := c.Post("/v1/admin/gc", q, struct{}{}, &raw); err != nil {
+				return err
+			}
+			if opts.JSON {
+				output.PrintRawJSON(raw)
+				return nil
+			}
+			var resp struct {
+				JobID string `json:"jobId"`
+				RunID uint   `json:"runId"`
+			}
+			if err := json.Unmarshal(raw, &resp); err != nil {
+				return fmt.Errorf("parsing response: %w", err)
+			}
+			fmt.Printf("Garbage collection run %d started: job %s\n", resp.RunID, resp.JobID)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "List what would be deleted without deleting it")
+	cmd.Flags().DurationVar(&grace, "grace", 24*time.Hour, "Skip files modified within this duration")
+
+	cmd.AddCommand(NewAdminGCReportCmd(c, opts))
+	return cmd
+}
+
+// NewAdminGCReportCmd prints a garbage collection run's report.
+func NewAdminGCReportCmd(c *client.Client, opts *output.Options) *cobra.Command {
+	var id uint
+	var files bool
+	help := helptext.Load(adminHelpFS, "admin_help/admin_gc_report.md")
+	cmd := &cobra.Command{
+		Use:         "report",
+		Short:       "Show what a garbage collection run reclaimed",
+		Long:        help.Long,
+		Example:     help.Example,
+		Annotations: help.Annotations,
+		Args:        cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			q := url.Values{}
+			if id != 0 {
+				q.Set("id", strconv.FormatUint(uint64(id), 10))
+			}
+			var raw json.RawMessage
+			if err := c.Get("/v1/admin/gc", q, &raw); err != nil {
+				return err
+			}
+			if opts.JSON {
+				output.PrintRawJSON(raw)
+				return nil
+			}
+			var status adminBlobGCStatus
+			if err := json.Unmarshal(raw, &status); err != nil {
+				return fmt.Errorf("parsing response: %w", err)
+			}
+			if status.Run == nil {
+				fmt.Println("No garbage collection has run.")
+				return nil
+			}
+			run := status.Run
+			state := "running"
+			if run.FinishedAt != nil {
+				state = "finished " + run.FinishedAt.Format(time.RFC3339)
+			}
+			if run.Error != "" {
+				state += " with error: " + run.Error
+			}
+			output.PrintSingle(*opts, []output.KeyValue{
+				{Key: "Run", Value: strconv.FormatUint(uint64(run.ID), 10)},
+				{Key: "State", Value: state},
+				{Key: "Dry Run", Value: strconv.FormatBool(run.DryRun)},
+				{Key: "Grace Period", Value: (time.Duration(run.GracePeriodSeconds) * time.Second).String()},
+				{Key: "Reclaimed Bytes", Value: strconv.FormatInt(run.ReclaimedBytes, 10)},
+			}, nil)
+			if run.Report == nil {
+				return nil
+			}
+
+			fmt.Println("\n=== Filesystems ===")
+			columns := []string{"FILESYSTEM", "SCANNED", "ORPHANS", "IN_GRACE", "DELETED", "RECLAIMED_BYTES", "ERRORS"}
+			var rows [][]string
+			for _, fs := range run.Report.Filesystems {
+				name := fs.Key
+				if name == "" {
+					name = "(main)"
+				}
+				rows = append(rows, []string{
+					name,
+					strconv.FormatInt(fs.ScannedFiles, 10),
+					strconv.FormatInt(fs.OrphanFiles, 10),
+					strconv.FormatInt(fs.InGraceFiles, 10),
+					strconv.FormatInt(fs.DeletedFiles, 10),
+					strconv.FormatInt(fs.ReclaimedBytes, 10),
+					strconv.Itoa(len(fs.Errors)),
+				})
+			}
+			output.Print(*opts, columns, rows, nil)
+
+			fmt.Println("\n=== Database ===")
+			output.PrintSingle(*opts, []output.KeyValue{
+				{Key: "Orphaned Previews", Value: strconv.FormatInt(run.Report.OrphanPreviews, 10)},
+				{Key: "Orphaned Preview Bytes", Value: strconv.FormatInt(run.Report.OrphanPreviewBytes, 10)},
+				{Key: "Deleted Previews", Value: strconv.FormatInt(run.Report.DeletedPreviewCount, 10)},
+				{Key: "Rows Missing Their File", Value: strconv.FormatInt(run.Report.DanglingCount, 10)},
+			}, nil)
+
+			if files {
+				fmt.Println("\n=== Orphaned Files ===")
+				for _, fs := range run.Report.Filesystems {
+					for _, orphan := range fs.Orphans {
+						if fs.Key != "" {
+							orphan = fs.Key + ":" + orphan
+						}
+						fmt.Println(orphan)
+					}
+					for _, e := range fs.Errors {
+						fmt.Println("error: " + e)
+					}
+				}
+				fmt.Println("\n=== Rows Missing Their File ===")
+				for _, d := range run.Report.Dangling {
+					location := d.Location
+					if d.StorageLocation != "" {
+						location = d.StorageLocation + ":" + location
+					}
+					fmt.Printf("%s %d: %s\n", d.EntityType, d.EntityID, location)
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().UintVar(&id, "id", 0, "Run ID (default: the newest run)")
+	cmd.Flags().BoolVar(&files, "files", false, "List the orphaned files and the rows missing their file")
+	return cmd
+}
+
+// adminContentHashMigrationRun matches the ContentHashMigrationRun JSON shape
+// from content_hash_migration_model.go.
+type adminContentHashMigrationRun struct {
+	ID         uint       `json:"id"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt"`
+	Phase      string     `json:"phase"`
+	LastID     uint       `json:"lastId"`
+	Migrated   int64      `json:"migrated"`
+	ReadBytes  int64      `json:"readBytes"`
+	Skipped    int64      `json:"skipped"`
+	JobID      string     `json:"jobId"`
+}
+
+// NewAdminRehashCmd starts the SHA1 to SHA-256 content hash migration.
+func NewAdminRehashCmd(c *client.Client, opts *output.Options) *cobra.Command {
+	var restart bool
+	help := helptext.Load(adminHelpFS, "admin_help/admin_rehash.md")
+	cmd := &cobra.Command{
+		Use:         "rehash",
+		Short:       "Re-hash SHA1 resources and versions with SHA-256",
+		Long:        help.Long,
+		Example:     help.Example,
+		Annotations: help.Annotations,
+		Args:        cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			q := url.Values{}
+			if restart {
+				q.Set("restart", "true")
+			}
+			var raw json.RawMessage
+			if err := c.Post("/v1/admin/rehash", q, struct{}{}, &raw); err != nil {
+				return err
+			}
+			if opts.JSON {
+				output.PrintRawJSON(raw)
+				return nil
+			}
+			var resp struct {
+				JobID   string `json:"jobId"`
+				RunID   uint   `json:"runId"`
+				Resumed bool   `json:"resumed"`
+				Phase   string `json:"phase"`
+				LastID  uint   `json:"lastId"`
+			}
+			if err := json.Unmarshal(raw, &resp); err != nil {
+				return fmt.Errorf("parsing response: %w", err)
+			}
+			if resp.Resumed {
+				fmt.Printf("Hash migration run %d resumed at %s %d: job %s\n", resp.RunID, resp.Phase, resp.LastID, resp.JobID)
+			} else {
+				fmt.Printf("Hash migration run %d started: job %s\n", resp.RunID, resp.JobID)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&restart, "restart", false, "Abandon the unfinished run instead of resuming it")
+
+	cmd.AddCommand(NewAdminRehashStatusCmd(c, opts))
+	return cmd
+}
+
+// NewAdminRehashStatusCmd shows the newest migration run and the rows left.
+func NewAdminRehashStatusCmd(c *client.Client, opts *output.Options) *cobra.Command {
+	help := helptext.Load(adminHelpFS, "admin_help/admin_rehash_status.md")
+	return &cobra.Command{
+		Use:         "status",
+		Short:       "Show hash migration progress and rows left",
+		Long:        help.Long,
+		Example:     help.Example,
+		Annotations: help.Annotations,
+		Args:        cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var raw json.RawMessage
+			if err := c.Get("/v1/admin/rehash", nil, &raw); err != nil {
+				return err
+			}
+			if opts.JSON {
+				output.PrintRawJSON(raw)
+				return nil
+			}
+			var resp struct {
+				Running   bool                          `json:"running"`
+				Run       *adminContentHashMigrationRun `json:"run"`
+				Remaining map[string]int64              `json:"remaining"`
+			}
+			if err := json.Unmarshal(raw, &resp); err != nil {
+				return fmt.Errorf("parsing response: %w", err)
+			}
+			kvs := []output.KeyValue{{Key: "Running", Value: strconv.FormatBool(resp.Running)}}
+			if resp.Run != nil {
+				finished := "-"
+				if resp.Run.FinishedAt != nil {
+					finished = resp.Run.FinishedAt.Format(time.RFC3339)
+				}
+				kvs = append(kvs,
+					output.KeyValue{Key: "Run", Value: strconv.FormatUint(uint64(resp.Run.ID), 10)},
+					output.KeyValue{Key: "Started At", Value: resp.Run.StartedAt.Format(time.RFC3339)},
+					output.KeyValue{Key: "Finished At", Value: finished},
+					output.KeyValue{Key: "Checkpoint", Value: fmt.Sprintf("%s %d", resp.Run.Phase, resp.Run.LastID)},
+					output.KeyValue{Key: "Migrated", Value: strconv.FormatInt(resp.Run.Migrated, 10)},
+					output.KeyValue{Key: "Read Bytes", Value: strconv.FormatInt(resp.Run.ReadBytes, 10)},
+					output.KeyValue{Key: "Skipped", Value: strconv.FormatInt(resp.Run.Skipped, 10)},
+				)
+			}
+			kvs = append(kvs,
+				output.KeyValue{Key: "SHA1 Resources", Value: strconv.FormatInt(resp.Remaining["resource"], 10)},
+				output.KeyValue{Key: "SHA1 Versions", Value: strconv.FormatInt(resp.Remaining["version"], 10)},
+			)
+			output.PrintSingle(*opts, kvs, nil)
+			return nil
+		},
+	}
+}
+
+// adminEncryptionRotationRun matches the EncryptionRotationRun JSON shape
+// from encryption_rotation_model.go.
+type adminEncryptionRotationRun struct {
+	ID         uint       `json:"id"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt"`
+	KeyID      string     `json:"keyId"`
+	Scanned    int64      `json:"scanned"`
+	Rewrapped  int64      `json:"rewrapped"`
+	Encrypted  int64      `json:"encrypted"`
+	Failed     int64      `json:"failed"`
+	Error      string     `json:"error"`
+	JobID      string     `json:"jobId"`
+}
+
+// NewAdminRekeyCmd starts a master key rotation of encrypted storage.
+func NewAdminRekeyCmd(c *client.Client, opts *output.Options) *cobra.Command {
+	help := helptext.Load(adminHelpFS, "admin_help/admin_rekey.md")
+	cmd := &cobra.Command{
+		Use:         "rekey",
+		Short:       "Move stored files onto the current master key",
+		Long:        help.Long,
+		Example:     help.Example,
+		Annotations: help.Annotations,
+		Args:        cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var raw json.RawMessage
+			if err := c.Post("/v1/admin/rekey", nil, struct{}{}, &raw); err != nil {
+				return err
+			}
+			if opts.JSON {
+				output.PrintRawJSON(raw)
+				return nil
+			}
+			var resp struct {
+				JobID string `json:"jobId"`
+				RunID uint   `json:"runId"`
+				KeyID string `json:"keyId"`
+			}
+			if err := json.Unmarshal(raw, &resp); err != nil {
+				return fmt.Errorf("parsing response: %w", err)
+			}
+			fmt.Printf("Key rotation run %d to key %s started: job %s\n", resp.RunID, resp.KeyID, resp.JobID)
+			return nil
+		},
+	}
+
+	cmd.AddCommand(NewAdminRekeyStatusCmd(c, opts))
+	return cmd
+}
+
+// NewAdminRekeyStatusCmd shows the master keys and the newest rotation run.
+func NewAdminRekeyStatusCmd(c *client.Client, opts *output.Options) *cobra.Command {
+	help := helptext.Load(adminHelpFS, "admin_help/admin_rekey_status.md")
+	return &cobra.Command{
+		Use:         "status",
+		Short:       "Show master keys and key rotation progress",
+		Long:        help.Long,
+		Example:     help.Example,
+		Annotations: help.Annotations,
+		Args:        cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var raw json.RawMessage
+			if err := c.Get("/v1/admin/rekey", nil, &raw); err != nil {
+				return err
+			}
+			if opts.JSON {
+				output.PrintRawJSON(raw)
+				return nil
+			}
+			var resp struct {
+				Enabled        bool                        `json:"enabled"`
+				CurrentKeyID   string                      `json:"currentKeyId"`
+				PreviousKeyIDs []string                    `json:"previousKeyIds"`
+				Running        bool                        `json:"running"`
+				Run            *adminEncryptionRotationRun `json:"run"`
+			}
+			if err := json.Unmarshal(raw, &resp); err != nil {
+				return fmt.Errorf("parsing response: %w", err)
+			}
+			previous := "-"
+			if len(resp.PreviousKeyIDs) > 0 {
+				previous = strings.Join(resp.PreviousKeyIDs, ", ")
+			}
+			kvs := []output.KeyValue{
+				{Key: "Encryption", Value: strconv.FormatBool(resp.Enabled)},
+				{Key: "Current Key", Value: resp.CurrentKeyID},
+				{Key: "Previous Keys", Value: previous},
+				{Key: "Running", Value: strconv.FormatBool(resp.Running)},
+			}
+			if resp.Run != nil {
+				finished := "-"
+				if resp.Run.FinishedAt != nil {
+					finished = resp.Run.FinishedAt.Format(time.RFC3339)
+				}
+				kvs = append(kvs,
+					output.KeyValue{Key: "Run", Value: strconv.FormatUint(uint64(resp.Run.ID), 10)},
+					output.KeyValue{Key: "Run Key", Value: resp.Run.KeyID},
+					output.KeyValue{Key: "Started At", Value: resp.Run.StartedAt.Format(time.RFC3339)},
+					output.KeyValue{Key: "Finished At", Value: finished},
+					output.KeyValue{Key: "Scanned", Value: strconv.FormatInt(resp.Run.Scanned, 10)},
+					output.KeyValue{Key: "Rewrapped", Value: strconv.FormatInt(resp.Run.Rewrapped, 10)},
+					output.KeyValue{Key: "Encrypted", Value: strconv.FormatInt(resp.Run.Encrypted, 10)},
+					output.KeyValue{Key: "Failed", Value: strconv.FormatInt(resp.Run.Failed, 10)},
+				)
+				if resp.Run.Error != "" {
+					kvs = append(kvs, output.KeyValue{Key: "Error", Value: resp.Run.Error})
+				}
+			}
+			output.PrintSingle(*opts, kvs, nil)
+			return nil
+		},
+	}
+}
+
+// adminStorageTierRun matches the StorageTierRun JSON shape from
+// storage_tier_model.go, with its report decoded.
+type adminStorageTierRun struct {
+	ID         uint       `json:"id"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt"`
+	DryRun     bool       `json:"dryRun"`
+	Target     string     `json:"target"`
+	ApplyRules bool       `json:"applyRules"`
+	Matched    int64      `json:"matched"`
+	Moved      int64      `json:"moved"`
+	MovedBytes int64      `json:"movedBytes"`
+	Failed     int64      `json:"failed"`
+	Error      string     `json:"error"`
+	JobID      string     `json:"jobId"`
+	Report     *struct {
+		Rules []struct {
+			Target     string `json:"target"`
+			Query      string `json:"query"`
+			Matched    int64  `json:"matched"`
+			Moved      int64  `json:"moved"`
+			MovedBytes int64  `json:"movedBytes"`
+		} `json:"rules"`
+		Failures []struct {
+			ResourceID uint   `json:"resourceId"`
+			Error      string `json:"error"`
+		} `json:"failures"`
+	} `json:"report"`
+}
+
+// tierName spells the main filesystem's empty storage key for output.
+func tierName(key string) string {
+	if key == "" {
+		return "(main)"
+	}
+	return key
+}
+
+// printStorageTierStart prints a submitted tiering run.
+func printStorageTierStart(raw json.RawMessage, opts *output.Options, what string) error {
+	if opts.JSON {
+		output.PrintRawJSON(raw)
+		return nil
+	}
+	var resp struct {
+		JobID string `json:"jobId"`
+		RunID uint   `json:"runId"`
+	}
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return fmt.Errorf("parsing response: %w", err)
+	}
+	fmt.Printf("%s run %d started: job %s\n", what, resp.RunID, resp.JobID)
+	return nil
+}
+
+// NewAdminTierCmd applies the storage tiering rules.
+func NewAdminTierCmd(c *client.Client, opts *output.Options) *cobra.Command {
+	var dryRun bool
+	help := helptext.Load(adminHelpFS, "admin_help/admin_tier.md")
+	cmd := &cobra.Command{
+		Use:         "tier",
+		Short:       "Move resources between filesystems by the tiering rules",
+		Long:        help.Long,
+		Example:     help.Example,
+		Annotations: help.Annotations,
+		Args:        cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			q := url.Values{}
+			if dryRun {
+				q.Set("dryRun", "true")
+			}
+			var raw json.RawMessage
+			if err := c.Post("/v1/admin/tiering", q, struct{}{}, &raw); err != nil {
+				return err
+			}
+			return printStorageTierStart(raw, opts, "Storage tiering")
+		},
+	}
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Count what the rules would move without moving it")
+
+	cmd.AddCommand(NewAdminTierStatusCmd(c, opts))
+	cmd.AddCommand(NewAdminTierPromoteCmd(c, opts))
+	cmd.AddCommand(NewAdminTierPinCmd(c, opts, true))
+	cmd.AddCommand(NewAdminTierPinCmd(c, opts, false))
+	return cmd
+}
+
+// NewAdminTierStatusCmd shows the tiering rules and a run's report.
+func NewAdminTierStatusCmd(c *client.Client, opts *output.Options) *cobra.Command {
+	var id uint
+	help := helptext.Load(adminHelpFS, "admin_help/admin_tier_status.md")
+	cmd := &cobra.Command{
+		Use:         "status",
+		Short:       "Show the tiering rules and what a run moved",
+		Long:        help.Long,
+		Example:     help.Example,
+		Annotations: help.Annotations,
+		Args:        cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			q := url.Values{}
+			if id != 0 {
+				q.Set("id", strconv.FormatUint(uint64(id), 10))
+			}
+			var raw json.RawMessage
+			if err := c.Get("/v1/admin/tiering", q, &raw); err != nil {
+				return err
+			}
+			if opts.JSON {
+				output.PrintRawJSON(raw)
+				return nil
+			}
+			var resp struct {
+				Rules []struct {
+					Target string `json:"target"`
+					Query  string `json:"query"`
+				} `json:"rules"`
+				IntervalSeconds int64                `json:"intervalSeconds"`
+				Pinned          int64                `json:"pinned"`
+				Running         bool                 `json:"running"`
+				Run             *adminStorageTierRun `json:"run"`
+			}
+			if err := json.Unmarshal(raw, &resp); err != nil {
+				return fmt.Errorf("parsing response: %w", err)
+			}
+			interval := "on request only"
+			if resp.IntervalSeconds > 0 {
+				interval = (time.Duration(resp.IntervalSeconds) * time.Second).String()
+			}
+			kvs := []output.KeyValue{
+				{Key: "Rules", Value: strconv.Itoa(len(resp.Rules))},
+				{Key: "Interval", Value: interval},
+				{Key: "Pinned", Value: strconv.FormatInt(resp.Pinned, 10)},
+				{Key: "Running", Value: strconv.FormatBool(resp.Running)},
+			}
+			if run := resp.Run; run != nil {
+				state := "running"
+				if run.FinishedAt != nil {
+					state = "finished " + run.FinishedAt.Format(time.RFC3339)
+				}
+				if run.Error != "" {
+					state += " with error: " + run.Error
+				}
+				kvs = append(kvs,
+					output.KeyValue{Key: "Run", Value: strconv.FormatUint(uint64(run.ID), 10)},
+					output.KeyValue{Key: "State", Value: state},
+					output.KeyValue{Key: "Dry Run", Value: strconv.FormatBool(run.DryRun)},
+					output.KeyValue{Key: "Matched", Value: strconv.FormatInt(run.Matched, 10)},
+					output.KeyValue{Key: "Moved", Value: strconv.FormatInt(run.Moved, 10)},
+					output.KeyValue{Key: "Moved Bytes", Value: strconv.FormatInt(run.MovedBytes, 10)},
+					output.KeyValue{Key: "Failed", Value: strconv.FormatInt(run.Failed, 10)},
+				)
+			}
+			output.PrintSingle(*opts, kvs, nil)
+
+			if len(resp.Rules) > 0 {
+				fmt.Println("\n=== Rules ===")
+				var rows [][]string
+				for i, rule := range resp.Rules {
+					rows = append(rows, []string{strconv.Itoa(i + 1), rule.Target, rule.Query})
+				}
+				output.Print(*opts, []string{"#", "TARGET", "QUERY"}, rows, nil)
+			}
+			if resp.Run != nil && resp.Run.Report != nil {
+				fmt.Println("\n=== Run ===")
+				var rows [][]string
+				for _, rule := range resp.Run.Report.Rules {
+					rows = append(rows, []string{
+						tierName(rule.Target),
+						rule.Query,
+						strconv.FormatInt(rule.Matched, 10),
+						strconv.FormatInt(rule.Moved, 10),
+						strconv.FormatInt(rule.MovedBytes, 10),
+					})
+				}
+				output.Print(*opts, []string{"TARGET", "QUERY", "MATCHED", "MOVED", "MOVED_BYTES"}, rows, nil)
+				for _, f := range resp.Run.Report.Failures {
+					fmt.Printf("resource %d: %s\n", f.ResourceID, f.Error)
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().UintVar(&id, "id", 0, "Run ID (default: the newest run)")
+	return cmd
+}
+
+// NewAdminTierPromoteCmd moves resources to a filesystem outside the rules.
+func NewAdminTierPromoteCmd(c *client.Client, opts *output.Options) *cobra.Command {
+	var idsStr, target string
+	var noPin bool
+	help := helptext.Load(adminHelpFS, "admin_help/admin_tier_promote.md")
+	cmd := &cobra.Command{
+		Use:         "promote",
+		Short:       "Move resources back to the main filesystem or another tier",
+		Long:        help.Long,
+		Example:     help.Example,
+		Annotations: help.Annotations,
+		Args:        cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ids, err := parseUintList(idsStr)
+			if err != nil {
+				return fmt.Errorf("parsing --ids: %w", err)
+			}
+			q := url.Values{}
+			q.Set("target", target)
+			q.Set("pin", strconv.FormatBool(!noPin))
+			var raw json.RawMessage
+			if err := c.Post("/v1/admin/tiering/move", q, map[string]any{"ID": ids}, &raw); err != nil {
+				return err
+			}
+			return printStorageTierStart(raw, opts, "Storage tier move")
+		},
+	}
+	cmd.Flags().StringVar(&idsStr, "ids", "", "Comma-separated resource IDs (required)")
+	cmd.MarkFlagRequired("ids")
+	cmd.Flags().StringVar(&target, "to", "", "Alt filesystem key to move to (default: the main filesystem)")
+	cmd.Flags().BoolVar(&noPin, "no-pin", false, "Leave the resources unpinned, so the rules may move them again")
+	return cmd
+}
+
+// NewAdminTierPinCmd pins resources to their filesystem, or unpins them.
+func NewAdminTierPinCmd(c *client.Client, opts *output.Options, pin bool) *cobra.Command {
+	var idsStr string
+	use, short, path := "pin", "Keep resources where they are, whatever the rules say", "/v1/admin/tiering/pin"
+	if !pin {
+		use, short, path = "unpin", "Let the tiering rules move resources again", "/v1/admin/tiering/unpin"
+	}
+	help := helptext.Load(adminHelpFS, "admin_help/admin_tier_"+use+".md")
+	cmd := &cobra.Command{
+		Use:         use,
+		Short:       short,
+		Long:        help.Long,
+		Example:     help.Example,
+		Annotations: help.Annotations,
+		Args:        cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ids, err := parseUintList(idsStr)
+			if err != nil {
+				return fmt.Errorf("parsing --ids: %w", err)
+			}
+			var raw json.RawMessage
+			if err := c.Post(path, nil, map[string]any{"ID": ids}, &raw); err != nil {
+				return err
+			}
+			if opts.JSON {
+				output.PrintRawJSON(raw)
+				return nil
+			}
+			if pin {
+				output.PrintMessage(fmt.Sprintf("Pinned %d resources.", len(ids)))
+			} else {
+				output.PrintMessage(fmt.Sprintf("Unpinned %d resources.", len(ids)))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&idsStr, "ids", "", "Comma-separated resource IDs (required)")
+	cmd.MarkFlagRequired("ids")
+	return cmd
+}
+
+// printStorageQuotas prints quotas with what their subjects store.
+func printStorageQuotas(opts output.Options, quotas []adminStorageQuota) {
+	columns := []string{"SUBJECT", "ID", "NAME", "BYTES", "RESOURCES", "FULL"}
+	rows := make([][]string, 0, len(quotas))
+	for _, q := range quotas {
+		bytes := q.UsedBytesFmt + " (no limit)"
+		if q.MaxBytes > 0 {
+			bytes = q.UsedBytesFmt + " of " + q.MaxBytesFmt
+		}
+		resources := strconv.FormatInt(q.UsedResources, 10) + " (no limit)"
+		if q.MaxResources > 0 {
+			resources = fmt.Sprintf("%d of %d", q.UsedResources, q.MaxResources)
+		}
+		full := "-"
+		if q.Exceeded {
+			full = "yes"
+		}
+		rows = append(rows, []string{q.SubjectType, strconv.FormatUint(uint64(q.SubjectID), 10), q.SubjectName, bytes, resources, full})
+	}
+	output.Print(opts, columns, rows, nil)
+}
+
+// quotaSubjectFlags resolves --user and --group, exactly one of which must be
+// set, to the quota subject.
+func quotaSubjectFlags(user, group uint) (string, uint, error) {
+	switch {
+	case user != 0 && group != 0:
+		return "", 0, fmt.Errorf("pass either --user or --group, not both")
+	case user != 0:
+		return "user", user, nil
+	case group != 0:
+		return "group", group, nil
+	default:
+		return "", 0, fmt.Errorf("pass --user or --group")
+	}
+}
+
+// NewAdminQuotaCmd returns the "admin quota" subcommand group.
+func NewAdminQuotaCmd(c *client.Client, opts *output.Options) *cobra.Command {
+	help := helptext.Load(adminHelpFS, "admin_help/admin_quota.md")
+	cmd := &cobra.Command{
+		Use:         "quota",
+		Short:       "Manage per-user and per-group storage quotas",
+		Long:        help.Long,
+		Example:     help.Example,
+		Annotations: help.Annotations,
+	}
+
+	cmd.AddCommand(NewAdminQuotaListCmd(c, opts))
+	cmd.AddCommand(NewAdminQuotaSetCmd(c, opts))
+	cmd.AddCommand(NewAdminQuotaRemoveCmd(c, opts))
+	cmd.AddCommand(NewAdminQuotaRecountCmd(c, opts))
+	return cmd
+}
+
+// NewAdminQuotaListCmd lists the quotas with their usage.
+func NewAdminQuotaListCmd(c *client.Client, opts *output.Options) *cobra.Command {
+	help := helptext.Load(adminHelpFS, "admin_help/admin_quota_list.md")
+	return &cobra.Command{
+		Use:         "list",
+		Short:       "List storage quotas and what each subject stores",
+		Long:        help.Long,
+		Example:     help.Example,
+		Annotations: help.Annotations,
+		Args:        cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var raw json.RawMessage
+			if err := c.Get("/v1/admin/quotas", nil, &raw); err != nil {
+				return err
+			}
+			if opts.JSON {
+				output.PrintRawJSON(raw)
+				return nil
+			}
+			var quotas []adminStorageQuota
+			if err := json.Unmarshal(raw, &quotas); err != nil {
+				return fmt.Errorf("parsing quotas: %w", err)
+			}
+			printStorageQuotas(*opts, quotas)
+			return nil
+		},
+	}
+}
+
+// NewAdminQuotaSetCmd sets the quota of a user or a group subtree.
+func NewAdminQuotaSetCmd(c *client.Client, opts *output.Options) *cobra.Command {
+	var user, group uint
+	var maxBytes, maxResources int64
+	help := helptext.Load(adminHelpFS, "admin_help/admin_quota_set.md")
+	cmd := &cobra.Command{
+		Use:         "set",
+		Short:       "Set the storage quota of a user or a group",
+		Long:        help.Long,
+		Example:     help.Example,
+		Annotations: help.Annotations,
+		Args:        cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			subjectType, subjectID, err := quotaSubjectFlags(user, group)
+			if err != nil {
+				return err
+			}
+			body := map[string]any{
+				"subjectType":  subjectType,
+				"subjectId":    subjectID,
+				"maxBytes":     maxBytes,
+				"maxResources": maxResources,
+			}
+			var raw json.RawMessage
+			if err := c.Post("/v1/admin/quotas", nil, body, &raw); err != nil {
+				return err
+			}
+			if opts.JSON {
+				output.PrintRawJSON(raw)
+				return nil
+			}
+			var q adminStorageQuota
+			if err := json.Unmarshal(raw, &q); err != nil {
+				return fmt.Errorf("parsing quota: %w", err)
+			}
+			printStorageQuotas(*opts, []adminStorageQuota{q})
+			return nil
+		},
+	}
+	cmd.Flags().UintVar(&user, "user", 0, "User ID the quota limits")
+	cmd.Flags().UintVar(&group, "group", 0, "Group ID whose subtree the quota limits")
+	cmd.Flags().Int64Var(&maxBytes, "max-bytes", 0, "Byte limit (0: no limit)")
+	cmd.Flags().Int64Var(&maxResources, "max-resources", 0, "Resource count limit (0: no limit)")
+	return cmd
+}
+
+// NewAdminQuotaRemoveCmd removes the quota of a user or a group.
+func NewAdminQuotaRemoveCmd(c *client.Client, opts *output.Options) *cobra.Command {
+	var user, group uint
+	help := helptext.Load(adminHelpFS, "admin_help/admin_quota_remove.md")
+	cmd := &cobra.Command{
+		Use:         "remove",
+		Short:       "Remove the storage quota of a user or a group",
+		Long:        help.Long,
+		Example:     help.Example,
+		Annotations: help.Annotations,
+		Args:        cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			subjectType, subjectID, err := quotaSubjectFlags(user, group)
+			if err != nil {
+				return err
+			}
+			body := map[string]any{"subjectType": subjectType, "subjectId": subjectID}
+			var raw json.RawMessage
+			if err := c.Post("/v1/admin/quotas/delete", nil, body, &raw); err != nil {
+				return err
+			}
+			if opts.JSON {
+				output.PrintRawJSON(raw)
+				return nil
+			}
+			output.PrintMessage(fmt.Sprintf("Removed the quota of %s %d.", subjectType, subjectID))
+			return nil
+		},
+	}
+	cmd.Flags().UintVar(&user, "user", 0, "User ID")
+	cmd.Flags().UintVar(&group, "group", 0, "Group ID")
+	return cmd
+}
+
+// NewAdminQuotaRecountCmd rebuilds storage usage from the resources.
+func NewAdminQuotaRecountCmd(c *client.Client, opts *output.Options) *cobra.Command {
+	help := helptext.Load(adminHelpFS, "admin_help/admin_quota_recount.md")
+	return &cobra.Command{
+		Use:         "recount",
+		Short:       "Rebuild storage usage from the resources",
+		Long:        help.Long,
+		Example:     help.Example,
+		Annotations: help.Annotations,
+		Args:        cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var raw json.RawMessage
+			if err := c.Post("/v1/admin/quotas/recount", nil, struct{}{}, &raw); err != nil {
+				return err
+			}
+			if opts.JSON {
+				output.PrintRawJSON(raw)
+				return nil
+			}
+			var resp struct {
+				Resources int64 `json:"resources"`
+			}
+			if err := json.Unmarshal(raw, &resp); err != nil {
+				return fmt.Errorf("parsing response: %w", err)
+			}
+			output.PrintMessage(fmt.Sprintf("Recounted the storage usage of %d resources.", resp.Resources))
+			return nil
+		},
+	}
+}
+
+// adminWatchRule matches the WatchFolderRule JSON shape.
+type adminWatchRule struct {
+	Pattern string `json:"pattern"`
+	GroupID uint   `json:"groupId,omitempty"`
+	Tags    []uint `json:"tags,omitempty"`
+}
+
+// adminWatchFolder matches the WatchFolderStatus JSON shape.
+type adminWatchFolder struct {
+	ID           uint             `json:"id"`
+	Name         string           `json:"name"`
+	FileSystem   string           `json:"fileSystem"`
+	Path         string           `json:"path"`
+	OwnerGroupID uint             `json:"ownerGroupId"`
+	Subfolders   bool             `json:"subfolders"`
+	Rules        []adminWatchRule `json:"rules"`
+	OnDelete     string           `json:"onDelete"`
+	Paused       bool             `json:"paused"`
+	LastScanAt   *time.Time       `json:"lastScanAt"`
+	LastError    string           `json:"lastError"`
+	Files        int64            `json:"files"`
+	Scanning     bool             `json:"scanning"`
+}
+
+// printWatchFolders prints watch folders with their last scan.
+func printWatchFolders(opts output.Options, folders []adminWatchFolder) {
+	columns := []string{"ID", "NAME", "FOLDER", "OWNER", "RULES", "ON DELETE", "FILES", "LAST SCAN"}
+	rows := make([][]string, 0, len(folders))
+	for _, f := range folders {
+		lastScan := "never"
+		if f.Scanning {
+			lastScan = "scanning"
+		} else if f.LastScanAt != nil {
+			lastScan = f.LastScanAt.Format(time.RFC3339)
+		}
+		if f.LastError != "" {
+			lastScan += " (error: " + f.LastError + ")"
+		}
+		onDelete := f.OnDelete
+		if f.Paused {
+			onDelete += ", paused"
+		}
+		rows = append(rows, []string{
+			strconv.FormatUint(uint64(f.ID), 10),
+			f.Name,
+			f.FileSystem + ":" + f.Path,
+			strconv.FormatUint(uint64(f.OwnerGroupID), 10),
+			strconv.Itoa(len(f.Rules)),
+			onDelete,
+			strconv.FormatInt(f.Files, 10),
+			lastScan,
+		})
+	}
+	output.Print(opts, columns, rows, nil)
+}
+
+// parseWatchRule reads a rule written as pattern[:group=ID][:tags=ID,ID].
+func parseWatchRule(value string) (adminWatchRule, error) {
+	parts := strings.Split(value, ":")
+	rule := adminWatchRule{Pattern: strings.TrimSpace(parts[0])}
+	if rule.Pattern == "" {
+		return rule, fmt.Errorf("rule %q has no pattern", value)
+	}
+	for _, part := range parts[1:] {
+		key, val, _ := strings.Cut(part, "=")
+		switch strings.TrimSpace(key) {
+		case "group":
+			id, err := strconv.ParseUint(strings.TrimSpace(val), 10, 64)
+			if err != nil {
+				return rule, fmt.Errorf("rule %q: invalid group %q", value, val)
+			}
+			rule.GroupID = uint(id)
+		case "tags":
+			ids, err := parseUintList(val)
+			if err != nil {
+				return rule, fmt.Errorf("rule %q: %w", value, err)
+			}
+			rule.Tags = ids
+		default:
+			return rule, fmt.Errorf("rule %q: expected group=ID or tags=ID,ID, got %q", value, part)
+		}
+	}
+	return rule, nil
+}
+
+// NewAdminWatchCmd returns the "admin watch" subcommand group.
+func NewAdminWatchCmd(c *client.Client, opts *output.Options) *cobra.Command {
+	help := helptext.Load(adminHelpFS, "admin_help/admin_watch.md")
+	cmd := &cobra.Command{
+		Use:         "watch",
+		Short:       "Manage watch folders that ingest files as resources",
+		Long:        help.Long,
+		Example:     help.Example,
+		Annotations: help.Annotations,
+	}
+
+	cmd.AddCommand(NewAdminWatchListCmd(c, opts))
+	cmd.AddCommand(NewAdminWatchSetCmd(c, opts))
+	cmd.AddCommand(NewAdminWatchRemoveCmd(c, opts))
+	cmd.AddCommand(NewAdminWatchScanCmd(c, opts))
+	return cmd
+}
+
+// NewAdminWatchListCmd lists the watch folders.
+func NewAdminWatchListCmd(c *client.Client, opts *output.Options) *cobra.Command {
+	help := helptext.Load(adminHelpFS, "admin_help/admin_watch_list.md")
+	return &cobra.Command{
+		Use:         "list",
+		Short:       "List watch folders and their last scan",
+		Long:        help.Long,
+		Example:     help.Example,
+		Annotations: help.Annotations,
+		Args:        cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var raw json.RawMessage
+			if err := c.Get("/v1/admin/watch-folders", nil, &raw); err != nil {
+				return err
+			}
+			if opts.JSON {
+				output.PrintRawJSON(raw)
+				return nil
+			}
+			var folders []adminWatchFolder
+			if err := json.Unmarshal(raw, &folders); err != nil {
+				return fmt.Errorf("parsing watch folders: %w", err)
+			}
+			printWatchFolders(*opts, folders)
+			return nil
+		},
+	}
+}
+
+// NewAdminWatchSetCmd creates a watch folder, or changes one.
+func NewAdminWatchSetCmd(c *client.Client, opts *output.Options) *cobra.Command {
+	var id, owner uint
+	var name, fileSystem, folderPath, onDelete string
+	var subfolders, paused, clearRules bool
+	var rules []string
+	help := helptext.Load(adminHelpFS, "admin_help/admin_watch_set.md")
+	cmd := &cobra.Command{
+		Use:         "set",
+		Short:       "Create or change a watch folder",
+		Long:        help.Long,
+		Example:     help.Example,
+		Annotations: help.Annotations,
+		Args:        cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// A change starts from the folder as it is, so that only the
+			// flags given change it.
+			folder := adminWatchFolder{OnDelete: "keep"}
+			if id != 0 {
+				var folders []adminWatchFolder
+				if err := c.Get("/v1/admin/watch-folders", nil, &folders); err != nil {
+					return err
+				}
+				found := false
+				for _, f := range folders {
+					if f.ID == id {
+						folder, found = f, true
+						break
+					}
+				}
+				if !found {
+					return fmt.Errorf("watch folder %d not found", id)
+				}
+			}
+			flags := cmd.Flags()
+			if flags.Changed("name") {
+				folder.Name = name
+			}
+			if flags.Changed("fs") {
+				folder.FileSystem = fileSystem
+			}
+			if flags.Changed("path") {
+				folder.Path = folderPath
+			}
+			if flags.Changed("owner") {
+				folder.OwnerGroupID = owner
+			}
+			if flags.Changed("subfolders") {
+				folder.Subfolders = subfolders
+			}
+			if flags.Changed("on-delete") {
+				folder.OnDelete = onDelete
+			}
+			if flags.Changed("paused") {
+				folder.Paused = paused
+			}
+			if clearRules || flags.Changed("rule") {
+				folder.Rules = nil
+			}
+			for _, value := range rules {
+				rule, err := parseWatchRule(value)
+				if err != nil {
+					return err
+				}
+				folder.Rules = append(folder.Rules, rule)
+			}
+			if folder.Rules == nil {
+				folder.Rules = []adminWatchRule{}
+			}
+
+			body := map[string]any{
+				"id":           folder.ID,
+				"name":         folder.Name,
+				"fileSystem":   folder.FileSystem,
+				"path":         folder.Path,
+				"ownerGroupId": folder.OwnerGroupID,
+				"subfolders":   folder.Subfolders,
+				"rules":        folder.Rules,
+				"onDelete":     folder.OnDelete,
+				"paused":       folder.Paused,
+			}
+			var raw json.RawMessage
+			if err := c.Post("/v1/admin/watch-folders", nil, body, &raw); err != nil {
+				return err
+			}
+			if opts.JSON {
+				output.PrintRawJSON(raw)
+				return nil
+			}
+			var saved adminWatchFolder
+			if err := json.Unmarshal(raw, &saved); err != nil {
+				return fmt.Errorf("parsing watch folder: %w", err)
+			}
+			printWatchFolders(*opts, []adminWatchFolder{saved})
+			return nil
+		},
+	}
+	cmd.Flags().UintVar(&id, "id", 0, "Watch folder ID to change; omit to create one")
+	cmd.Flags().StringVar(&name, "name", "", "Name of the watch folder")
+	cmd.Flags().StringVar(&fileSystem, "fs", "", "Key of the alt file system the folder is on")
+	cmd.Flags().StringVar(&folderPath, "path", "", "Folder on the alt file system")
+	cmd.Flags().UintVar(&owner, "owner", 0, "Group ID the folder's resources go to")
+	cmd.Flags().BoolVar(&subfolders, "subfolders", false, "Mirror subfolders as groups under the owner group")
+	cmd.Flags().StringArrayVar(&rules, "rule", nil, "Mapping rule pattern[:group=ID][:tags=ID,ID] (repeatable; replaces the folder's rules)")
+	cmd.Flags().BoolVar(&clearRules, "clear-rules", false, "Remove the folder's mapping rules")
+	cmd.Flags().StringVar(&onDelete, "on-delete", "keep", "What a removed file does to its resource: keep or delete")
+	cmd.Flags().BoolVar(&paused, "paused", false, "Stop polling the folder; it can still be scanned with scan")
+	return cmd
+}
+
+// NewAdminWatchRemoveCmd stops watching a folder.
+func NewAdminWatchRemoveCmd(c *client.Client, opts *output.Options) *cobra.Command {
+	help := helptext.Load(adminHelpFS, "admin_help/admin_watch_remove.md")
+	return &cobra.Command{
+		Use:         "remove <id>",
+		Short:       "Stop watching a folder",
+		Long:        help.Long,
+		Example:     help.Example,
+		Annotations: help.Annotations,
+		Args:        cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid watch folder ID: %w", err)
+			}
+			var raw json.RawMessage
+			if err := c.Post("/v1/admin/watch-folders/delete", nil, map[string]any{"id": id}, &raw); err != nil {
+				return err
+			}
+			if opts.JSON {
+				output.PrintRawJSON(raw)
+				return nil
+			}
+			output.PrintMessage(fmt.Sprintf("Removed watch folder %d.", id))
+			return nil
+		},
+	}
+}
+
+// NewAdminWatchScanCmd scans a watch folder now.
+func NewAdminWatchScanCmd(c *client.Client, opts *output.Options) *cobra.Command {
+	help := helptext.Load(adminHelpFS, "admin_help/admin_watch_scan.md")
+	return &cobra.Command{
+		Use:         "scan <id>",
+		Short:       "Scan a watch folder now",
+		Long:        help.Long,
+		Example:     help.Example,
+		Annotations: help.Annotations,
+		Args:        cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid watch folder ID: %w", err)
+			}
+			var raw json.RawMessage
+			if err := c.Post("/v1/admin/watch-folders/scan", nil, map[string]any{"id": id}, &raw); err != nil {
+				return err
+			}
+			if opts.JSON {
+				output.PrintRawJSON(raw)
+				return nil
+			}
+			var resp struct {
+				JobID string `json:"jobId"`
+			}
+			if err := json.Unmarshal(raw, &resp); err != nil {
+				return fmt.Errorf("parsing response: %w", err)
+			}
+			fmt.Printf("Scan of watch folder %d started: job %s\n", id, resp.JobID)
+			return nil
+		},
+	}
+}
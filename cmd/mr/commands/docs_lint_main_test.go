@@ -79,7 +79,7 @@ func buildProductionRoot(t *testing.T) *cobra.Command {
 	rootCmd.AddCommand(commands.NewJobsCmd(c, opts))
 	rootCmd.AddCommand(commands.NewPluginCmd(c, opts))
 	rootCmd.AddCommand(commands.NewPluginsCmd(c, opts))
-	rootCmd.AddCommand(commands.NewAdminCmd(c, opts))
+	rootCmd.AddCommand(commands.NewAdminCmd(c, opts, &page))
 	rootCmd.AddCommand(commands.NewDocsCmd())
 	commands.ApplyHelpCustomizations(rootCmd)
 	return rootCmd
@@ -14,7 +14,9 @@ import (
 
 	"mahresources/cmd/mr/client"
 	"mahresources/cmd/mr/helptext"
+	"mahresources/cmd/mr/lsp"
 	"mahresources/cmd/mr/output"
+	"mahresources/mrql"
 
 	"github.com/spf13/cobra"
 )
@@ -35,6 +37,31 @@ type mrqlResponse struct {
 	Resources  []mrqlEntity `json:"resources,omitempty"`
 	Notes      []mrqlEntity `json:"notes,omitempty"`
 	Groups     []mrqlEntity `json:"groups,omitempty"`
+	Items      []mrqlItem   `json:"items,omitempty"`
+	Warnings   []string     `json:"warnings,omitempty"`
+	NextCursor string       `json:"nextCursor,omitempty"`
+}
+
+// mrqlPage is one page of a non-grouped response with its rows kept raw, so
+// --all can concatenate pages without dropping fields the table does not show.
+type mrqlPage struct {
+	EntityType   string            `json:"entityType"`
+	Mode         string            `json:"mode,omitempty"`
+	Resources    []json.RawMessage `json:"resources,omitempty"`
+	Notes        []json.RawMessage `json:"notes,omitempty"`
+	Groups       []json.RawMessage `json:"groups,omitempty"`
+	Items        []json.RawMessage `json:"items,omitempty"`
+	Warnings     []string          `json:"warnings,omitempty"`
+	NextCursor   string            `json:"nextCursor,omitempty"`
+	AppliedLimit int               `json:"applied_limit,omitempty"`
+}
+
+// mrqlItem is one row of a cross-entity response, in the server's global order.
+type mrqlItem struct {
+	EntityType string    `json:"entityType"`
+	ID         uint      `json:"id"`
+	Name       string    `json:"name"`
+	Created    time.Time `json:"created"`
 }
 
 // mrqlSavedQuery represents a saved MRQL query.
@@ -45,16 +72,30 @@ type mrqlSavedQuery struct {
 	Description string    `json:"description"`
 	CreatedAt   time.Time `json:"createdAt"`
 	UpdatedAt   time.Time `json:"updatedAt"`
+	// Materialized and the refresh fields are absent on an older server,
+	// which reads as "not materialized".
+	Materialized           bool   `json:"materialized"`
+	RefreshPolicy          string `json:"refreshPolicy,omitempty"`
+	RefreshIntervalSeconds int    `json:"refreshIntervalSeconds,omitempty"`
+}
+
+// mrqlMaterializedInfo mirrors the staleness metadata of a materialized result.
+type mrqlMaterializedInfo struct {
+	RefreshedAt   time.Time `json:"refreshedAt"`
+	AgeSeconds    int64     `json:"ageSeconds"`
+	RefreshPolicy string    `json:"refreshPolicy"`
+	Stale         bool      `json:"stale"`
+	DurationMs    int64     `json:"durationMs"`
 }
 
 // mrqlGroupedResponse matches the MRQLGroupedResult struct.
 type mrqlGroupedResponse struct {
 	EntityType string `json:"entityType"`
 	Mode       string `json:"mode"`
-	// Columns is the aggregated result's column names in the order the query
-	// wrote them. The server did not always send it; when it is absent the
-	// table falls back to sorting the first row's keys, which is what this
-	// command used to do unconditionally.
+	// Columns is the aggregated or projected result's column names in the
+	// order the query wrote them. The server did not always send it; when it
+	// is absent the table falls back to sorting the first row's keys, which is
+	// what this command used to do unconditionally.
 	Columns []string         `json:"columns,omitempty"`
 	Rows    []map[string]any `json:"rows,omitempty"`
 	// KeyColumns is the bucketed result's group-by key names in the order the
@@ -81,6 +122,8 @@ func NewMRQLCmd(c *client.Client, opts *output.Options, page *int) *cobra.Comman
 		limit    int
 		buckets  int
 		offset   int
+		cursor   string
+		all      bool
 		render   bool
 		params   []string
 	)
@@ -129,8 +172,14 @@ func NewMRQLCmd(c *client.Client, opts *output.Options, page *int) *cobra.Comman
 				body["offset"] = offset
 			}
 			if cmd.Flags().Changed("page") {
+				if all {
+					return fmt.Errorf("--all follows cursors and cannot be combined with --page")
+				}
 				body["page"] = *page
 			}
+			if cursor != "" {
+				body["cursor"] = cursor
+			}
 
 			q := url.Values{}
 			if err := addParamFlags(q, params); err != nil {
@@ -141,7 +190,18 @@ func NewMRQLCmd(c *client.Client, opts *output.Options, page *int) *cobra.Comman
 			}
 
 			var raw json.RawMessage
-			if err := c.Post("/v1/mrql", q, body, &raw); err != nil {
+			if all {
+				var err error
+				raw, err = fetchAllMRQLPages(cursor, func(next string, page *mrqlPage) error {
+					if next != "" {
+						body["cursor"] = next
+					}
+					return c.Post("/v1/mrql", q, body, page)
+				})
+				if err != nil {
+					return err
+				}
+			} else if err := c.Post("/v1/mrql", q, body, &raw); err != nil {
 				return err
 			}
 
@@ -154,6 +214,8 @@ func NewMRQLCmd(c *client.Client, opts *output.Options, page *int) *cobra.Comman
 	mrqlCmd.Flags().IntVar(&limit, "limit", 0, "Items per bucket for GROUP BY, or total items for regular queries")
 	mrqlCmd.Flags().IntVar(&buckets, "buckets", 0, "Groups per page for bucketed GROUP BY queries")
 	mrqlCmd.Flags().IntVar(&offset, "offset", 0, "Bucket offset for cursor-based GROUP BY pagination")
+	mrqlCmd.Flags().StringVar(&cursor, "cursor", "", "Resume after a previous page's nextCursor (non-grouped queries)")
+	mrqlCmd.Flags().BoolVar(&all, "all", false, "Follow nextCursor and print every page of a non-grouped query")
 	mrqlCmd.Flags().BoolVar(&render, "render", false, "Request server-side template rendering via CustomMRQLResult")
 	mrqlCmd.Flags().StringArrayVar(&params, "param", nil, "Bind a query parameter placeholder, repeatable: --param name=value")
 
@@ -162,7 +224,10 @@ func NewMRQLCmd(c *client.Client, opts *output.Options, page *int) *cobra.Comman
 	mrqlCmd.AddCommand(newMRQLRunCmd(c, opts, page))
 	mrqlCmd.AddCommand(newMRQLExplainCmd(c, opts))
 	mrqlCmd.AddCommand(newMRQLExportCmd(c, opts, page))
+	mrqlCmd.AddCommand(newMRQLRefreshCmd(c, opts))
 	mrqlCmd.AddCommand(newMRQLDeleteCmd(c, opts))
+	mrqlCmd.AddCommand(newMRQLFmtCmd())
+	mrqlCmd.AddCommand(newMRQLLSPCmd(c))
 
 	return mrqlCmd
 }
@@ -181,7 +246,12 @@ func addParamFlags(q url.Values, params []string) error {
 }
 
 func newMRQLSaveCmd(c *client.Client, opts *output.Options) *cobra.Command {
-	var description string
+	var (
+		description     string
+		materialize     bool
+		refreshPolicy   string
+		refreshInterval int
+	)
 
 	help := helptext.Load(mrqlHelpFS, "mrql_help/mrql_save.md")
 	cmd := &cobra.Command{
@@ -192,13 +262,25 @@ func newMRQLSaveCmd(c *client.Client, opts *output.Options) *cobra.Command {
 		Annotations: help.Annotations,
 		Args:        cobra.ExactArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			body := map[string]string{
+			body := map[string]any{
 				"name":  args[0],
 				"query": args[1],
 			}
 			if description != "" {
 				body["description"] = description
 			}
+			if !materialize && (cmd.Flags().Changed("refresh-policy") || cmd.Flags().Changed("refresh-interval")) {
+				return fmt.Errorf("--refresh-policy and --refresh-interval require --materialize")
+			}
+			if materialize {
+				body["materialized"] = true
+				if refreshPolicy != "" {
+					body["refreshPolicy"] = refreshPolicy
+				}
+				if refreshInterval > 0 {
+					body["refreshIntervalSeconds"] = refreshInterval
+				}
+			}
 
 			var raw json.RawMessage
 			if err := c.Post("/v1/mrql/saved", nil, body, &raw); err != nil {
@@ -220,6 +302,9 @@ func newMRQLSaveCmd(c *client.Client, opts *output.Options) *cobra.Command {
 	}
 
 	cmd.Flags().StringVar(&description, "description", "", "Description for the saved query")
+	cmd.Flags().BoolVar(&materialize, "materialize", false, "Store the query's result and serve runs from it")
+	cmd.Flags().StringVar(&refreshPolicy, "refresh-policy", "", "When a materialized result is recomputed: on_write (default) or interval")
+	cmd.Flags().IntVar(&refreshInterval, "refresh-interval", 0, "Seconds between refreshes for --refresh-policy interval (minimum 60)")
 
 	return cmd
 }
@@ -248,13 +333,21 @@ func newMRQLListCmd(c *client.Client, opts *output.Options, page *int) *cobra.Co
 				return nil
 			}
 
-			columns := []string{"ID", "NAME", "DESCRIPTION", "CREATED"}
+			columns := []string{"ID", "NAME", "DESCRIPTION", "MATERIALIZED", "CREATED"}
 			var rows [][]string
 			for _, sq := range queries {
+				materialized := ""
+				if sq.Materialized {
+					materialized = sq.RefreshPolicy
+					if sq.RefreshPolicy == "interval" {
+						materialized = fmt.Sprintf("every %ds", sq.RefreshIntervalSeconds)
+					}
+				}
 				rows = append(rows, []string{
 					strconv.FormatUint(uint64(sq.ID), 10),
 					output.Truncate(sq.Name, 40),
 					output.Truncate(sq.Description, 50),
+					materialized,
 					sq.CreatedAt.Format(time.RFC3339),
 				})
 			}
@@ -272,6 +365,8 @@ func newMRQLRunCmd(c *client.Client, opts *output.Options, page *int) *cobra.Com
 		limit   int
 		buckets int
 		offset  int
+		cursor  string
+		all     bool
 		render  bool
 		params  []string
 	)
@@ -301,8 +396,14 @@ func newMRQLRunCmd(c *client.Client, opts *output.Options, page *int) *cobra.Com
 				q.Set("offset", strconv.Itoa(offset))
 			}
 			if cmd.Flags().Changed("page") {
+				if all {
+					return fmt.Errorf("--all follows cursors and cannot be combined with --page")
+				}
 				q.Set("page", strconv.Itoa(*page))
 			}
+			if cursor != "" {
+				q.Set("cursor", cursor)
+			}
 			if err := addParamFlags(q, params); err != nil {
 				return err
 			}
@@ -311,7 +412,18 @@ func newMRQLRunCmd(c *client.Client, opts *output.Options, page *int) *cobra.Com
 			}
 
 			var raw json.RawMessage
-			if err := c.Post("/v1/mrql/saved/run", q, nil, &raw); err != nil {
+			if all {
+				var err error
+				raw, err = fetchAllMRQLPages(cursor, func(next string, page *mrqlPage) error {
+					if next != "" {
+						q.Set("cursor", next)
+					}
+					return c.Post("/v1/mrql/saved/run", q, nil, page)
+				})
+				if err != nil {
+					return err
+				}
+			} else if err := c.Post("/v1/mrql/saved/run", q, nil, &raw); err != nil {
 				return err
 			}
 
@@ -323,6 +435,8 @@ func newMRQLRunCmd(c *client.Client, opts *output.Options, page *int) *cobra.Com
 	cmd.Flags().IntVar(&limit, "limit", 0, "Items per bucket for GROUP BY, or total items for regular queries")
 	cmd.Flags().IntVar(&buckets, "buckets", 0, "Groups per page for bucketed GROUP BY queries")
 	cmd.Flags().IntVar(&offset, "offset", 0, "Bucket offset for cursor-based GROUP BY pagination")
+	cmd.Flags().StringVar(&cursor, "cursor", "", "Resume after a previous page's nextCursor (non-grouped queries)")
+	cmd.Flags().BoolVar(&all, "all", false, "Follow nextCursor and print every page of a non-grouped query")
 	cmd.Flags().BoolVar(&render, "render", false, "Request server-side template rendering via CustomMRQLResult")
 	cmd.Flags().StringArrayVar(&params, "param", nil, "Bind a query parameter placeholder, repeatable: --param name=value")
 
@@ -331,10 +445,20 @@ func newMRQLRunCmd(c *client.Client, opts *output.Options, page *int) *cobra.Com
 
 // mrqlExplainStatement mirrors one statement in the /v1/mrql/explain response.
 type mrqlExplainStatement struct {
-	Label        string `json:"label"`
-	SQL          string `json:"sql"`
-	Vars         []any  `json:"vars"`
-	Interpolated string `json:"interpolated"`
+	Label        string                 `json:"label"`
+	SQL          string                 `json:"sql"`
+	Vars         []any                  `json:"vars"`
+	Interpolated string                 `json:"interpolated"`
+	Aggregates   []mrqlExplainAggregate `json:"aggregates,omitempty"`
+}
+
+// mrqlExplainAggregate mirrors one aggregate description of an explain statement.
+type mrqlExplainAggregate struct {
+	Key      string `json:"key"`
+	Function string `json:"function"`
+	Method   string `json:"method"`
+	SQL      string `json:"sql"`
+	Note     string `json:"note"`
 }
 
 type mrqlExplainResponse struct {
@@ -413,7 +537,8 @@ func newMRQLExplainCmd(c *client.Client, opts *output.Options) *cobra.Command {
 	return cmd
 }
 
-// printExplain renders the explain response as label headers plus interpolated SQL.
+// printExplain renders the explain response as label headers plus interpolated
+// SQL, followed by how each aggregate column is computed.
 func printExplain(resp mrqlExplainResponse) {
 	for _, w := range resp.Warnings {
 		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
@@ -427,6 +552,9 @@ func printExplain(resp mrqlExplainResponse) {
 		}
 		fmt.Printf("-- %s --\n", st.Label)
 		fmt.Println(st.Interpolated)
+		for _, agg := range st.Aggregates {
+			fmt.Printf("-- %s AS %s [%s]: %s\n--   %s\n", agg.Function, agg.Key, agg.Method, agg.Note, agg.SQL)
+		}
 	}
 }
 
@@ -441,6 +569,7 @@ func newMRQLExportCmd(c *client.Client, opts *output.Options, page *int) *cobra.
 		limit    int
 		buckets  int
 		offset   int
+		cursor   string
 	)
 
 	help := helptext.Load(mrqlHelpFS, "mrql_help/mrql_export.md")
@@ -485,6 +614,9 @@ func newMRQLExportCmd(c *client.Client, opts *output.Options, page *int) *cobra.
 			if cmd.Flags().Changed("page") {
 				q.Set("page", strconv.Itoa(*page))
 			}
+			if cursor != "" {
+				q.Set("cursor", cursor)
+			}
 
 			resp, err := c.GetRaw("/v1/mrql/export", q)
 			if err != nil {
@@ -512,6 +644,9 @@ func newMRQLExportCmd(c *client.Client, opts *output.Options, page *int) *cobra.
 			if outFile != "" && !opts.Quiet {
 				fmt.Fprintf(os.Stderr, "Wrote %s\n", outFile)
 			}
+			if next := resp.Header.Get("X-MRQL-Next-Cursor"); next != "" && !opts.Quiet {
+				fmt.Fprintf(os.Stderr, "More results available. Use --cursor %s for the next page.\n", next)
+			}
 			return nil
 		},
 	}
@@ -524,10 +659,47 @@ func newMRQLExportCmd(c *client.Client, opts *output.Options, page *int) *cobra.
 	cmd.Flags().IntVar(&limit, "limit", 0, "Items per bucket for GROUP BY, or total items for regular queries")
 	cmd.Flags().IntVar(&buckets, "buckets", 0, "Groups per page for bucketed GROUP BY queries")
 	cmd.Flags().IntVar(&offset, "offset", 0, "Bucket offset for cursor-based GROUP BY pagination")
+	cmd.Flags().StringVar(&cursor, "cursor", "", "Resume after a previous export's X-MRQL-Next-Cursor (non-grouped queries)")
 
 	return cmd
 }
 
+// fetchAllMRQLPages drives --all: it requests pages through fetch, starting
+// from cursor ("" for the first page) and passing each page's nextCursor to the
+// next call, and returns the pages concatenated as one response. Keyset cursors
+// resume after the last row seen, so rows inserted while the loop runs never
+// repeat or shift a row out of the result.
+func fetchAllMRQLPages(cursor string, fetch func(cursor string, page *mrqlPage) error) (json.RawMessage, error) {
+	var all mrqlPage
+	for {
+		var page mrqlPage
+		if err := fetch(cursor, &page); err != nil {
+			return nil, err
+		}
+		if page.Mode != "" {
+			return nil, fmt.Errorf("--all does not page GROUP BY queries; use --offset")
+		}
+		all.EntityType = page.EntityType
+		all.Resources = append(all.Resources, page.Resources...)
+		all.Notes = append(all.Notes, page.Notes...)
+		all.Groups = append(all.Groups, page.Groups...)
+		all.Items = append(all.Items, page.Items...)
+		all.Warnings = append(all.Warnings, page.Warnings...)
+		if page.NextCursor == "" {
+			rows := len(page.Resources) + len(page.Notes) + len(page.Groups)
+			if page.AppliedLimit > 0 && rows == page.AppliedLimit {
+				all.Warnings = append(all.Warnings, "the query's ORDER BY cannot be resumed by cursor, so only the first page was fetched; order by plain fields such as name, created or id")
+			}
+			break
+		}
+		if page.NextCursor == cursor {
+			return nil, fmt.Errorf("server returned the cursor it was sent; stopping")
+		}
+		cursor = page.NextCursor
+	}
+	return json.Marshal(all)
+}
+
 // readQueryText resolves query text from a positional arg, a file, or stdin ('-').
 func readQueryText(args []string, fileFlag string) (string, error) {
 	if len(args) == 1 && args[0] == "-" {
@@ -559,7 +731,7 @@ func printMRQLResponse(opts output.Options, raw json.RawMessage) {
 		for _, w := range grouped.Warnings {
 			fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
 		}
-		if grouped.Mode == "aggregated" {
+		if grouped.Mode == "aggregated" || grouped.Mode == "projected" {
 			columns, rows := aggregatedToTable(grouped.Columns, grouped.Rows)
 			if len(rows) == 0 && !opts.JSON && !opts.Quiet {
 				output.PrintMessage("No results found.")
@@ -587,14 +759,34 @@ func printMRQLResponse(opts output.Options, raw json.RawMessage) {
 		return
 	}
 
+	for _, w := range resp.Warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+	}
+
 	columns := []string{"ID", "TYPE", "NAME", "CREATED"}
 	rows := mrqlResponseToRows(resp)
 	output.Print(opts, columns, rows, raw)
+	if resp.NextCursor != "" && !opts.JSON && !opts.Quiet {
+		fmt.Fprintf(os.Stderr, "More results available. Use --cursor %s for the next page, or --all for every page.\n", resp.NextCursor)
+	}
 }
 
 // mrqlResponseToRows converts the API response into unified table rows.
+// Cross-entity responses list their items in the query's global order; older
+// servers without items fall back to resources, then notes, then groups.
 func mrqlResponseToRows(resp mrqlResponse) [][]string {
 	var rows [][]string
+	if len(resp.Items) > 0 {
+		for _, item := range resp.Items {
+			rows = append(rows, []string{
+				strconv.FormatUint(uint64(item.ID), 10),
+				item.EntityType,
+				output.Truncate(item.Name, 40),
+				item.Created.Format(time.RFC3339),
+			})
+		}
+		return rows
+	}
 	for _, r := range resp.Resources {
 		rows = append(rows, []string{
 			strconv.FormatUint(uint64(r.ID), 10),
@@ -622,10 +814,11 @@ func mrqlResponseToRows(resp mrqlResponse) [][]string {
 	return rows
 }
 
-// aggregatedToTable converts aggregated rows to table columns/rows.
+// aggregatedToTable converts aggregated or projected rows to table
+// columns/rows.
 //
-// `order` is the server's column list, which is the order the GROUP BY was
-// written in. This used to sort the first row's keys instead, so
+// `order` is the server's column list, which is the order the GROUP BY or
+// SELECT was written in. This used to sort the first row's keys instead, so
 // `GROUP BY width, height, contentType COUNT()` printed
 // CONTENTTYPE COUNT HEIGHT WIDTH — while `mr mrql export --format csv` of the
 // same query printed width,height,contentType,count. The sort survives as the
@@ -733,6 +926,42 @@ func printBucketedOutput(opts output.Options, grouped mrqlGroupedResponse, raw j
 	}
 }
 
+// newMRQLRefreshCmd returns the "mrql refresh" subcommand.
+func newMRQLRefreshCmd(c *client.Client, opts *output.Options) *cobra.Command {
+	help := helptext.Load(mrqlHelpFS, "mrql_help/mrql_refresh.md")
+	return &cobra.Command{
+		Use:         "refresh <name-or-id>",
+		Short:       "Recompute a materialized saved MRQL query",
+		Long:        help.Long,
+		Example:     help.Example,
+		Annotations: help.Annotations,
+		Args:        cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			q := url.Values{}
+			// Both, for the same reason as mrql run.
+			q.Set("id", args[0])
+			q.Set("name", args[0])
+
+			var raw json.RawMessage
+			if err := c.Post("/v1/mrql/saved/refresh", q, nil, &raw); err != nil {
+				return err
+			}
+
+			if opts.JSON {
+				output.PrintSingle(*opts, nil, raw)
+				return nil
+			}
+			var info mrqlMaterializedInfo
+			if err := json.Unmarshal(raw, &info); err != nil || info.RefreshedAt.IsZero() {
+				output.PrintMessage("MRQL query refreshed.")
+				return nil
+			}
+			output.PrintMessage(fmt.Sprintf("Refreshed %s at %s in %dms.", args[0], info.RefreshedAt.Format(time.RFC3339), info.DurationMs))
+			return nil
+		},
+	}
+}
+
 func newMRQLDeleteCmd(c *client.Client, opts *output.Options) *cobra.Command {
 	help := helptext.Load(mrqlHelpFS, "mrql_help/mrql_delete.md")
 	return &cobra.Command{
@@ -760,3 +989,109 @@ func newMRQLDeleteCmd(c *client.Client, opts *output.Options) *cobra.Command {
 		},
 	}
 }
+
+// newMRQLFmtCmd returns the "mrql fmt" subcommand. It formats locally with
+// mrql.Format, the same code behind /v1/mrql/format, so CI needs no server.
+func newMRQLFmtCmd() *cobra.Command {
+	var (
+		fileFlag string
+		check    bool
+		write    bool
+	)
+
+	help := helptext.Load(mrqlHelpFS, "mrql_help/mrql_fmt.md")
+	cmd := &cobra.Command{
+		Use:         "fmt [query]",
+		Short:       "Rewrite an MRQL query in canonical layout",
+		Long:        help.Long,
+		Example:     help.Example,
+		Annotations: help.Annotations,
+		Args:        cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if check && write {
+				return fmt.Errorf("--check and --write cannot be combined")
+			}
+			if write && fileFlag == "" {
+				return fmt.Errorf("--write needs a file: -f <file>")
+			}
+			if len(args) == 0 && fileFlag == "" {
+				return fmt.Errorf("provide a query as an argument, use -f <file>, or pipe to stdin with '-'")
+			}
+			text, err := readQueryText(args, fileFlag)
+			if err != nil {
+				return err
+			}
+			formatted, err := mrql.Format(strings.TrimSpace(text))
+			if err != nil {
+				return err
+			}
+			// A trailing newline is kept, so formatted files stay POSIX text
+			// files and `echo query | mr mrql fmt --check -` passes.
+			if strings.HasSuffix(text, "\n") || write {
+				formatted += "\n"
+			}
+
+			switch {
+			case check:
+				if formatted != text {
+					return fmt.Errorf("%s is not formatted; run mr mrql fmt", mrqlFmtSource(args, fileFlag))
+				}
+				return nil
+			case write:
+				if formatted == text {
+					return nil
+				}
+				return os.WriteFile(fileFlag, []byte(formatted), 0o644)
+			}
+			fmt.Print(strings.TrimSuffix(formatted, "\n") + "\n")
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&fileFlag, "file", "f", "", "Read query from file")
+	cmd.Flags().BoolVar(&check, "check", false, "Print nothing; exit 1 when the query is not already formatted")
+	cmd.Flags().BoolVarP(&write, "write", "w", false, "Rewrite the -f file in place instead of printing")
+
+	return cmd
+}
+
+// mrqlFmtSource names the input of mrql fmt in its --check error.
+func mrqlFmtSource(args []string, fileFlag string) string {
+	switch {
+	case len(args) == 1 && args[0] == "-":
+		return "stdin"
+	case fileFlag != "":
+		return fileFlag
+	}
+	return "query"
+}
+
+// mrqlLSPTimeout bounds each request the language server makes, so a slow
+// server delays completion by at most this long.
+const mrqlLSPTimeout = 2 * time.Second
+
+// newMRQLLSPCmd returns the "mrql lsp" subcommand.
+func newMRQLLSPCmd(c *client.Client) *cobra.Command {
+	var offline bool
+
+	help := helptext.Load(mrqlHelpFS, "mrql_help/mrql_lsp.md")
+	cmd := &cobra.Command{
+		Use:         "lsp",
+		Short:       "Run an MRQL language server on stdio for editors",
+		Long:        help.Long,
+		Example:     help.Example,
+		Annotations: help.Annotations,
+		Args:        cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var backend lsp.Backend
+			if !offline {
+				backend = lsp.NewClientBackend(c.WithTimeout(mrqlLSPTimeout))
+			}
+			return lsp.Serve(os.Stdin, os.Stdout, backend)
+		},
+	}
+
+	cmd.Flags().BoolVar(&offline, "offline", false, "Do not contact the server: local diagnostics, completion, hover and formatting only")
+
+	return cmd
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -30,6 +31,7 @@ type resourceResponse struct {
 	FileSize           int64     `json:"FileSize"`
 	Width              uint      `json:"Width"`
 	Height             uint      `json:"Height"`
+	PageCount          uint      `json:"pageCount"`
 	Hash               string    `json:"Hash"`
 	OwnerId            *uint     `json:"OwnerId"`
 	ResourceCategoryId uint      `json:"ResourceCategoryId"`
@@ -95,8 +97,10 @@ func NewResourceCmd(c *client.Client, opts *output.Options) *cobra.Command {
 	cmd.AddCommand(newResourceEditDescriptionCmd(c, opts))
 	cmd.AddCommand(newResourceEditMetaCmd(c, opts))
 	cmd.AddCommand(newResourceUploadCmd(c, opts))
+	cmd.AddCommand(newResourceExpansionCmd(c, opts))
 	cmd.AddCommand(newResourceDownloadCmd(c, opts))
 	cmd.AddCommand(newResourcePreviewCmd(c, opts))
+	cmd.AddCommand(newResourceTextCmd(c, opts))
 	cmd.AddCommand(newResourceFromURLCmd(c, opts))
 	cmd.AddCommand(newResourceFromLocalCmd(c, opts))
 	cmd.AddCommand(newResourceRotateCmd(c, opts))
@@ -143,6 +147,7 @@ func newResourceGetCmd(c *client.Client, opts *output.Options) *cobra.Command {
 				{Key: "ContentType", Value: res.ContentType},
 				{Key: "FileSize", Value: formatFileSize(res.FileSize)},
 				{Key: "Dimensions", Value: formatDimensions(res.Width, res.Height)},
+				{Key: "Pages", Value: strconv.FormatUint(uint64(res.PageCount), 10)},
 				{Key: "Hash", Value: res.Hash},
 				{Key: "Owner", Value: ptrUintStr(res.OwnerId)},
 				{Key: "Created", Value: res.CreatedAt.Format(time.RFC3339)},
@@ -395,9 +400,11 @@ func newResourceEditMetaCmd(c *client.Client, opts *output.Options) *cobra.Comma
 func newResourceUploadCmd(c *client.Client, opts *output.Options) *cobra.Command {
 	help := helptext.Load(resourcesHelpFS, "resources_help/resource_upload.md")
 	var (
-		name, description, meta, category       string
-		contentCategory, originalName            string
-		ownerID, resourceCategoryID              uint
+		name, description, meta, category string
+		contentCategory, originalName     string
+		ownerID, resourceCategoryID       uint
+		chunkSize                         int64
+		expand                            bool
 	)
 
 	cmd := &cobra.Command{
@@ -409,7 +416,7 @@ func newResourceUploadCmd(c *client.Client, opts *output.Options) *cobra.Command
 		Args:        cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			filePath := args[0]
-			extra := map[string]string{}
+			extra := map[string]string{"filename": filepath.Base(filePath)}
 
 			if cmd.Flags().Changed("name") {
 				extra["Name"] = name
@@ -435,16 +442,27 @@ func newResourceUploadCmd(c *client.Client, opts *output.Options) *cobra.Command
 			if cmd.Flags().Changed("original-name") {
 				extra["OriginalName"] = originalName
 			}
+			if expand {
+				extra["expand"] = "true"
+			}
 
-			var raw json.RawMessage
-			if err := c.UploadFile("/v1/resource", nil, "resource", filePath, extra, &raw); err != nil {
+			result, err := c.UploadResumable(filePath, extra, chunkSize<<20)
+			if err != nil {
 				return err
 			}
+			if result.ExpansionID != 0 {
+				return printArchiveExpansion(c, opts, result.ExpansionID)
+			}
+			var resource json.RawMessage
+			if err := c.Get("/v1/resource", url.Values{"id": {strconv.FormatUint(uint64(result.ResourceID), 10)}}, &resource); err != nil {
+				return err
+			}
+			// Printed as the multipart upload API returns it: an array of resources.
+			raw := json.RawMessage("[" + string(resource) + "]")
 
 			if opts.JSON {
 				output.PrintSingle(*opts, nil, raw)
 			} else {
-				// The upload API returns an array of resources (supports multi-file upload).
 				var resources []resourceResponse
 				if err := json.Unmarshal(raw, &resources); err == nil && len(resources) > 0 {
 					output.PrintMessage(fmt.Sprintf("Created resource %d: %s", resources[0].ID, resources[0].Name))
@@ -464,10 +482,115 @@ func newResourceUploadCmd(c *client.Client, opts *output.Options) *cobra.Command
 	cmd.Flags().StringVar(&contentCategory, "content-category", "", "Content category")
 	cmd.Flags().UintVar(&resourceCategoryID, "resource-category-id", 0, "Resource category ID")
 	cmd.Flags().StringVar(&originalName, "original-name", "", "Original file name")
+	cmd.Flags().Int64Var(&chunkSize, "chunk-size", client.DefaultChunkSize>>20, "Upload chunk size in MiB")
+	cmd.Flags().BoolVar(&expand, "expand", false, "Unpack a zip or tar into a new group instead of storing it")
 
 	return cmd
 }
 
+func newResourceExpansionCmd(c *client.Client, opts *output.Options) *cobra.Command {
+	help := helptext.Load(resourcesHelpFS, "resources_help/resource_expansion.md")
+	return &cobra.Command{
+		Use:         "expansion <id>",
+		Short:       "Show an archive expansion started by upload",
+		Long:        help.Long,
+		Example:     help.Example,
+		Annotations: help.Annotations,
+		Args:        cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid expansion id %q", args[0])
+			}
+			return printArchiveExpansion(c, opts, uint(id))
+		},
+	}
+}
+
+type archiveExpansionResponse struct {
+	ID         uint       `json:"id"`
+	FileName   string     `json:"fileName"`
+	GroupID    *uint      `json:"groupId"`
+	Entries    int64      `json:"entries"`
+	Bytes      int64      `json:"bytes"`
+	Created    int64      `json:"created"`
+	Skipped    int64      `json:"skipped"`
+	Failed     int64      `json:"failed"`
+	Error      string     `json:"error"`
+	JobID      string     `json:"jobId"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt"`
+}
+
+func printArchiveExpansion(c *client.Client, opts *output.Options, id uint) error {
+	var raw json.RawMessage
+	if err := c.Get("/v1/resource/expansion", url.Values{"id": {strconv.FormatUint(uint64(id), 10)}}, &raw); err != nil {
+		return err
+	}
+	var expansion archiveExpansionResponse
+	if err := json.Unmarshal(raw, &expansion); err != nil {
+		return fmt.Errorf("parsing response: %w", err)
+	}
+
+	finished := "running"
+	if expansion.FinishedAt != nil {
+		finished = expansion.FinishedAt.Format(time.RFC3339)
+	}
+	fields := []output.KeyValue{
+		{Key: "ID", Value: strconv.FormatUint(uint64(expansion.ID), 10)},
+		{Key: "File", Value: expansion.FileName},
+		{Key: "Group", Value: ptrUintStr(expansion.GroupID)},
+		{Key: "Files", Value: strconv.FormatInt(expansion.Entries, 10)},
+		{Key: "Size", Value: formatFileSize(expansion.Bytes)},
+		{Key: "Created", Value: strconv.FormatInt(expansion.Created, 10)},
+		{Key: "Skipped", Value: strconv.FormatInt(expansion.Skipped, 10)},
+		{Key: "Failed", Value: strconv.FormatInt(expansion.Failed, 10)},
+		{Key: "Job", Value: expansion.JobID},
+		{Key: "Started", Value: expansion.StartedAt.Format(time.RFC3339)},
+		{Key: "Finished", Value: finished},
+	}
+	if expansion.Error != "" {
+		fields = append(fields, output.KeyValue{Key: "Error", Value: expansion.Error})
+	}
+	output.PrintSingle(*opts, fields, raw)
+	return nil
+}
+
+func newResourceTextCmd(c *client.Client, opts *output.Options) *cobra.Command {
+	help := helptext.Load(resourcesHelpFS, "resources_help/resource_text.md")
+	return &cobra.Command{
+		Use:         "text <id>",
+		Short:       "Print the text extracted from a resource's file",
+		Long:        help.Long,
+		Example:     help.Example,
+		Annotations: help.Annotations,
+		Args:        cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			q := url.Values{}
+			q.Set("id", args[0])
+
+			var raw json.RawMessage
+			if err := c.Get("/v1/resource/text", q, &raw); err != nil {
+				return err
+			}
+
+			var text struct {
+				Text string `json:"text"`
+			}
+			if err := json.Unmarshal(raw, &text); err != nil {
+				return fmt.Errorf("parsing response: %w", err)
+			}
+
+			if opts.JSON {
+				output.PrintSingle(*opts, nil, raw)
+			} else {
+				output.PrintMessage(text.Text)
+			}
+			return nil
+		},
+	}
+}
+
 func newResourceDownloadCmd(c *client.Client, _ *output.Options) *cobra.Command {
 	help := helptext.Load(resourcesHelpFS, "resources_help/resource_download.md")
 	var outFile string
@@ -868,7 +991,10 @@ func newResourceVersionCmd(c *client.Client, opts *output.Options) *cobra.Comman
 
 func newResourceVersionUploadCmd(c *client.Client, opts *output.Options) *cobra.Command {
 	help := helptext.Load(resourcesHelpFS, "resources_help/resource_version_upload.md")
-	var comment string
+	var (
+		comment   string
+		chunkSize int64
+	)
 
 	cmd := &cobra.Command{
 		Use:         "version-upload <resource-id> <file>",
@@ -878,16 +1004,20 @@ func newResourceVersionUploadCmd(c *client.Client, opts *output.Options) *cobra.
 		Annotations: help.Annotations,
 		Args:        cobra.ExactArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			q := url.Values{}
-			q.Set("resourceId", args[0])
-
-			extra := map[string]string{}
+			if _, err := strconv.ParseUint(args[0], 10, 64); err != nil {
+				return fmt.Errorf("invalid resource ID %q", args[0])
+			}
+			extra := map[string]string{"filename": filepath.Base(args[1]), "resourceId": args[0]}
 			if cmd.Flags().Changed("comment") {
 				extra["comment"] = comment
 			}
 
+			result, err := c.UploadResumable(args[1], extra, chunkSize<<20)
+			if err != nil {
+				return err
+			}
 			var raw json.RawMessage
-			if err := c.UploadFile("/v1/resource/versions", q, "file", args[1], extra, &raw); err != nil {
+			if err := c.Get("/v1/resource/version", url.Values{"id": {strconv.FormatUint(uint64(result.VersionID), 10)}}, &raw); err != nil {
 				return err
 			}
 
@@ -901,6 +1031,7 @@ func newResourceVersionUploadCmd(c *client.Client, opts *output.Options) *cobra.
 	}
 
 	cmd.Flags().StringVar(&comment, "comment", "", "Version comment")
+	cmd.Flags().Int64Var(&chunkSize, "chunk-size", client.DefaultChunkSize>>20, "Upload chunk size in MiB")
 
 	return cmd
 }
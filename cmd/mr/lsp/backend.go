@@ -0,0 +1,113 @@
+package lsp
+
+import (
+	"fmt"
+	"net/url"
+
+	"mahresources/cmd/mr/client"
+	"mahresources/mrql"
+)
+
+// Backend is the mahresources server the language server asks for what it
+// cannot know from the query text alone: the tag, group and category names a
+// value can take, the meta keys in use, and the server-side warnings EXPLAIN
+// reports. A nil Backend runs the server offline, on local checks only.
+type Backend interface {
+	// Named returns up to a page of entities of the given kind whose name
+	// matches prefix.
+	Named(kind nameKind, prefix string) ([]namedEntity, error)
+	// MetaKeys returns the meta keys in use on the entity type.
+	MetaKeys(entityType mrql.EntityType) ([]string, error)
+	// Explain returns the warnings the server reports for query. An error
+	// means the server rejected the query.
+	Explain(query string) ([]string, error)
+}
+
+// nameKind is the kind of named entity a value completion offers.
+type nameKind string
+
+const (
+	nameTag              nameKind = "tag"
+	nameGroup            nameKind = "group"
+	nameCategory         nameKind = "category"
+	nameResourceCategory nameKind = "resourceCategory"
+	nameNoteType         nameKind = "noteType"
+)
+
+// namedEntity is an entity a value completion can refer to, by name or,
+// for the numeric-only fields, by ID.
+type namedEntity struct {
+	ID   uint   `json:"ID"`
+	Name string `json:"Name"`
+}
+
+// nameListPaths are the list endpoints behind each name kind. Each returns a
+// JSON array of objects carrying an ID and a Name.
+var nameListPaths = map[nameKind]string{
+	nameTag:              "/v1/tags",
+	nameGroup:            "/v1/groups",
+	nameCategory:         "/v1/categories",
+	nameResourceCategory: "/v1/resourceCategories",
+	nameNoteType:         "/v1/note/noteTypes",
+}
+
+// metaKeyPaths are the meta key endpoints of each entity type.
+var metaKeyPaths = map[mrql.EntityType]string{
+	mrql.EntityResource: "/v1/resources/meta/keys",
+	mrql.EntityNote:     "/v1/notes/meta/keys",
+	mrql.EntityGroup:    "/v1/groups/meta/keys",
+}
+
+// clientBackend is the Backend over the mr API client.
+type clientBackend struct {
+	c *client.Client
+}
+
+// NewClientBackend returns a Backend that asks the server c talks to.
+func NewClientBackend(c *client.Client) Backend {
+	return &clientBackend{c: c}
+}
+
+func (b *clientBackend) Named(kind nameKind, prefix string) ([]namedEntity, error) {
+	path, ok := nameListPaths[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown name kind %q", kind)
+	}
+	q := url.Values{}
+	if prefix != "" {
+		q.Set("name", prefix)
+	}
+	var items []namedEntity
+	if err := b.c.Get(path, q, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (b *clientBackend) MetaKeys(entityType mrql.EntityType) ([]string, error) {
+	path, ok := metaKeyPaths[entityType]
+	if !ok {
+		return nil, nil
+	}
+	var items []struct {
+		Key string `json:"key"`
+	}
+	if err := b.c.Get(path, nil, &items); err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(items))
+	for _, item := range items {
+		keys = append(keys, item.Key)
+	}
+	return keys, nil
+}
+
+func (b *clientBackend) Explain(query string) ([]string, error) {
+	var resp struct {
+		Warnings []string `json:"warnings"`
+	}
+	if err := b.c.Post("/v1/mrql/explain", nil, map[string]any{"query": query}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Warnings, nil
+}
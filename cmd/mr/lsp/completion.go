@@ -0,0 +1,225 @@
+package lsp
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"mahresources/mrql"
+)
+
+// valueCacheTTL is how long live values are reused. Completion fires on every
+// keystroke, so a short cache keeps the server from being asked the same
+// question repeatedly while still picking up new tags within a pause.
+const valueCacheTTL = 30 * time.Second
+
+// completionKinds maps mrql.Suggestion types to LSP completion item kinds.
+var completionKinds = map[string]int{
+	"field":       kindField,
+	"operator":    kindOperator,
+	"keyword":     kindKeyword,
+	"entity_type": kindEnumMember,
+	"value":       kindValue,
+	"function":    kindFunction,
+	"rel_date":    kindValue,
+}
+
+// groupValuedFields are the fields whose value is a group, matched by name.
+var groupValuedFields = map[string]bool{
+	"owner": true, "parent": true, "children": true, "groups": true, "group": true,
+	"ancestors": true, "descendants": true,
+}
+
+// metaKeyPattern is what can follow "meta." without quoting.
+var metaKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// completion answers textDocument/completion: mrql.Complete's suggestions,
+// plus live tag, group, category and meta key values from the Backend.
+func (s *Server) completion(params textDocumentPositionParams) completionList {
+	list := completionList{Items: []completionItem{}}
+	doc, ok := s.docs[params.TextDocument.URI]
+	if !ok {
+		return list
+	}
+	cursor := offsetAt(doc.text, params.Position)
+	target := mrql.CompletionTargetAt(doc.text, cursor)
+	replace := textRange{Start: positionAt(doc.text, target.Start), End: params.Position}
+
+	for _, sugg := range mrql.Complete(doc.text, cursor) {
+		insert := sugg.Value
+		// meta.<key> shows the shape of the field; insert up to the
+		// placeholder so the meta key completion takes over.
+		if i := strings.Index(insert, "<"); i > 0 && sugg.Type != "operator" {
+			insert = insert[:i]
+		}
+		list.Items = append(list.Items, completionItem{
+			Label:    sugg.Value,
+			Kind:     completionKinds[sugg.Type],
+			Detail:   sugg.Label,
+			TextEdit: &textEdit{Range: replace, NewText: insert},
+		})
+	}
+
+	if s.backend == nil {
+		return list
+	}
+	live := s.liveValues(target)
+	for _, item := range live {
+		item.TextEdit = &textEdit{Range: replace, NewText: item.insert}
+		list.Items = append(list.Items, item.completionItem)
+	}
+	// The values came from a prefix-filtered list, so the client must ask
+	// again as the prefix grows rather than filter this list itself.
+	list.IsIncomplete = len(live) > 0
+	return list
+}
+
+// liveItem is a completion item whose inserted text may differ from its label.
+type liveItem struct {
+	completionItem
+	insert string
+}
+
+// liveValues returns the Backend values that fit target. Lookup failures are
+// dropped: a down server should cost the editor its live values, nothing more.
+func (s *Server) liveValues(target mrql.CompletionTarget) []liveItem {
+	if target.MetaKey {
+		keys, err := s.values.metaKeys(s.backend, target.EntityType)
+		if err != nil {
+			return nil
+		}
+		var items []liveItem
+		for _, key := range keys {
+			if metaKeyPattern.MatchString(key) && strings.HasPrefix(key, target.Prefix) {
+				items = append(items, liveItem{
+					completionItem: completionItem{Label: key, Kind: kindField, Detail: "meta key"},
+					insert:         key,
+				})
+			}
+		}
+		return items
+	}
+
+	kind, byID := valueKind(target)
+	if kind == "" {
+		return nil
+	}
+	prefix := target.Prefix
+	if _, err := strconv.Atoi(prefix); byID && err == nil {
+		// A half-typed ID is not a name to filter on.
+		prefix = ""
+	}
+	entities, err := s.values.named(s.backend, kind, prefix)
+	if err != nil {
+		return nil
+	}
+	items := make([]liveItem, 0, len(entities))
+	for _, e := range entities {
+		item := liveItem{completionItem: completionItem{Label: e.Name, Kind: kindValue, Detail: string(kind)}}
+		if byID {
+			// category and noteType compare by ID only; offer the name but
+			// insert the number.
+			item.insert = strconv.FormatUint(uint64(e.ID), 10)
+			item.Detail = string(kind) + " " + item.insert
+		} else {
+			item.insert = quote(e.Name)
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// valueKind returns what kind of entity names target's field, and whether the
+// field compares by ID rather than name.
+func valueKind(target mrql.CompletionTarget) (nameKind, bool) {
+	field := target.Field
+	if field == "" {
+		return "", false
+	}
+	last := field[strings.LastIndex(field, ".")+1:]
+	root := strings.SplitN(field, ".", 2)[0]
+	switch {
+	case last == "tags":
+		return nameTag, false
+	case field == "category" && target.EntityType == mrql.EntityResource:
+		return nameResourceCategory, true
+	case last == "category" && (field == "category" || groupValuedFields[root]):
+		// A group's category, directly or through a traversal.
+		return nameCategory, true
+	case field == "noteType":
+		return nameNoteType, true
+	case groupValuedFields[field], groupValuedFields[root] && last == "name" && strings.Count(field, ".") == 1:
+		return nameGroup, false
+	}
+	return "", false
+}
+
+// quote renders s as an MRQL string literal.
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// valueCache holds recent Backend answers, keyed by what was asked. The
+// server handles one message at a time, so it needs no locking.
+type valueCache struct {
+	now     func() time.Time
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	at    time.Time
+	named []namedEntity
+	keys  []string
+}
+
+func newValueCache() *valueCache {
+	return &valueCache{now: time.Now, entries: map[string]cacheEntry{}}
+}
+
+func (c *valueCache) named(b Backend, kind nameKind, prefix string) ([]namedEntity, error) {
+	key := "named\x00" + string(kind) + "\x00" + prefix
+	if e, ok := c.get(key); ok {
+		return e.named, nil
+	}
+	named, err := b.Named(kind, prefix)
+	if err != nil {
+		return nil, err
+	}
+	c.put(key, cacheEntry{named: named})
+	return named, nil
+}
+
+func (c *valueCache) metaKeys(b Backend, entityType mrql.EntityType) ([]string, error) {
+	key := "meta\x00" + entityType.String()
+	if e, ok := c.get(key); ok {
+		return e.keys, nil
+	}
+	keys, err := b.MetaKeys(entityType)
+	if err != nil {
+		return nil, err
+	}
+	c.put(key, cacheEntry{keys: keys})
+	return keys, nil
+}
+
+func (c *valueCache) get(key string) (cacheEntry, bool) {
+	e, ok := c.entries[key]
+	if !ok || c.now().Sub(e.at) > valueCacheTTL {
+		return cacheEntry{}, false
+	}
+	return e, true
+}
+
+// put stores e under key, dropping expired entries so a long session typing
+// many prefixes does not accumulate them.
+func (c *valueCache) put(key string, e cacheEntry) {
+	e.at = c.now()
+	for k, old := range c.entries {
+		if e.at.Sub(old.at) > valueCacheTTL {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = e
+}
@@ -0,0 +1,270 @@
+package lsp
+
+import (
+	"fmt"
+	"strings"
+
+	"mahresources/mrql"
+)
+
+// keywordSections are the reference sections for tokens whose meaning does
+// not depend on where they appear.
+var keywordSections = map[mrql.TokenType]string{
+	mrql.TokenScope:        sectionScope,
+	mrql.TokenGroupBy:      sectionAggregated,
+	mrql.TokenHaving:       sectionHaving,
+	mrql.TokenOrderBy:      sectionOrdering,
+	mrql.TokenAsc:          sectionOrdering,
+	mrql.TokenDesc:         sectionOrdering,
+	mrql.TokenLimit:        sectionGuardrails,
+	mrql.TokenOffset:       sectionCursor,
+	mrql.TokenSimilarTo:    sectionSimilarity,
+	mrql.TokenCount:        sectionAggregated,
+	mrql.TokenSum:          sectionAggregated,
+	mrql.TokenAvg:          sectionAggregated,
+	mrql.TokenMin:          sectionAggregated,
+	mrql.TokenMax:          sectionAggregated,
+	mrql.TokenMedian:       sectionStatistics,
+	mrql.TokenPercentile:   sectionStatistics,
+	mrql.TokenRunningSum:   sectionStatistics,
+	mrql.TokenRunningCount: sectionStatistics,
+	mrql.TokenText:         sectionFields,
+	mrql.TokenKwType:       sectionQueryShape,
+	mrql.TokenAddTags:      sectionMutations,
+	mrql.TokenRemoveTags:   sectionMutations,
+	mrql.TokenMoveTo:       sectionMutations,
+	mrql.TokenAnd:          sectionOperators,
+	mrql.TokenOr:           sectionOperators,
+	mrql.TokenNot:          sectionOperators,
+	mrql.TokenIs:           sectionOperators,
+	mrql.TokenEmpty:        sectionOperators,
+	mrql.TokenNull:         sectionOperators,
+	mrql.TokenEq:           sectionOperators,
+	mrql.TokenNeq:          sectionOperators,
+	mrql.TokenGt:           sectionOperators,
+	mrql.TokenGte:          sectionOperators,
+	mrql.TokenLt:           sectionOperators,
+	mrql.TokenLte:          sectionOperators,
+	mrql.TokenLike:         sectionOperators,
+	mrql.TokenNotLike:      sectionOperators,
+	mrql.TokenRegex:        sectionOperators,
+	mrql.TokenNotRegex:     sectionOperators,
+	mrql.TokenRelDate:      sectionRelDates,
+	mrql.TokenFunc:         sectionRelDates,
+	mrql.TokenScalarFunc:   sectionFunctions,
+	mrql.TokenParam:        sectionParameters,
+	mrql.TokenPlus:         sectionProjection,
+	mrql.TokenMinus:        sectionProjection,
+	mrql.TokenStar:         sectionProjection,
+	mrql.TokenSlash:        sectionProjection,
+}
+
+// rootSections are the reference sections for field roots with a section of
+// their own.
+var rootSections = map[string]string{
+	"meta":           sectionMeta,
+	"ancestors":      sectionRecursive,
+	"descendants":    sectionRecursive,
+	"series":         sectionRelated,
+	"versions":       sectionRelated,
+	"currentVersion": sectionRelated,
+	"relations":      sectionRelated,
+	"backRelations":  sectionRelated,
+	"blocks":         sectionBlocks,
+	"todos":          sectionCounts,
+}
+
+// orderingWords are the ORDER BY keys and clause words that are not lexer
+// keywords, matched in any case.
+var orderingWords = map[string]string{
+	"random":   sectionOrdering,
+	"rank":     sectionOrdering,
+	"distance": sectionSimilarity,
+	"select":   sectionProjection,
+	"as":       sectionProjection,
+}
+
+// hover answers textDocument/hover with the reference section for the token
+// under the cursor, and for a field, its type and the entities that have it.
+func (s *Server) hover(params textDocumentPositionParams) *hoverResult {
+	doc, ok := s.docs[params.TextDocument.URI]
+	if !ok || len(doc.text) > mrql.MaxQueryBytes {
+		return nil
+	}
+	tokens := lexDocument(doc.text)
+	offset := offsetAt(doc.text, params.Position)
+	idx := -1
+	for i, tok := range tokens {
+		if tok.Pos <= offset && offset < tok.Pos+tok.Length {
+			idx = i
+			break
+		}
+		// The cursor just past a word still hovers it.
+		if tok.Pos+tok.Length == offset {
+			idx = i
+		}
+	}
+	if idx < 0 {
+		return nil
+	}
+
+	summary, section := describeToken(tokens, idx)
+	body, ok := referenceSections[section]
+	if summary == "" && !ok {
+		return nil
+	}
+	var b strings.Builder
+	if summary != "" {
+		b.WriteString(summary)
+	}
+	if ok {
+		if b.Len() > 0 {
+			b.WriteString("\n\n")
+		}
+		fmt.Fprintf(&b, "### %s\n\n%s", section, body)
+	}
+	tok := tokens[idx]
+	r := rangeOf(doc.text, tok.Pos, tok.Length)
+	return &hoverResult{
+		Contents: markupContent{Kind: "markdown", Value: b.String()},
+		Range:    &r,
+	}
+}
+
+// lexDocument returns the tokens of text, without the final EOF.
+func lexDocument(text string) []mrql.Token {
+	var tokens []mrql.Token
+	lexer := mrql.NewLexer(text)
+	for {
+		tok := lexer.Next()
+		if tok.Type == mrql.TokenEOF {
+			return tokens
+		}
+		tokens = append(tokens, tok)
+	}
+}
+
+// describeToken returns a one-line summary of tokens[i], if it has one, and
+// the reference section that documents it.
+func describeToken(tokens []mrql.Token, i int) (string, string) {
+	tok := tokens[i]
+	switch tok.Type {
+	case mrql.TokenIn:
+		// IN followed by a query rather than a list is a sub-query.
+		if i+2 < len(tokens) && tokens[i+1].Type == mrql.TokenLParen && tokens[i+2].Type == mrql.TokenKwType {
+			return "", sectionSubQueries
+		}
+		return "", sectionOperators
+	case mrql.TokenNumber:
+		if last := tok.Value[len(tok.Value)-1]; last < '0' || last > '9' {
+			return "", sectionFileSizes
+		}
+		return "", ""
+	case mrql.TokenIdentifier:
+		return describeField(tokens, i)
+	}
+	if i > 0 && tokens[i-1].Type == mrql.TokenDot {
+		// A keyword after a dot is a field or meta key, whatever it spells.
+		return describeField(tokens, i)
+	}
+	return "", keywordSections[tok.Type]
+}
+
+// describeField describes a word in field position: a root field, or a step
+// of a dotted path after one.
+func describeField(tokens []mrql.Token, i int) (string, string) {
+	start := i
+	for start >= 2 && tokens[start-1].Type == mrql.TokenDot {
+		start -= 2
+	}
+	root := tokens[start].Value
+	name := tokens[i].Value
+
+	if start < i {
+		switch {
+		case root == "meta":
+			return fmt.Sprintf("`meta.%s`: a metadata key", name), sectionMeta
+		case name == "count":
+			return "", sectionCounts
+		case (root == "created" || root == "updated") && i == start+2:
+			return "", sectionDateBuckets
+		}
+		if section, ok := rootSections[root]; ok {
+			return "", section
+		}
+		return "", sectionTraversal
+	}
+
+	if section, ok := rootSections[name]; ok {
+		return "", section
+	}
+	if isAsOfWord(tokens, i) {
+		return "", sectionAsOf
+	}
+	if section, ok := orderingWords[strings.ToLower(name)]; ok {
+		return "", section
+	}
+	summary := fieldSummary(name, detectEntity(tokens))
+	if summary == "" {
+		return "", ""
+	}
+	if i+1 < len(tokens) && tokens[i+1].Type == mrql.TokenDot {
+		return summary, sectionTraversal
+	}
+	return summary, ""
+}
+
+// isAsOfWord reports whether tokens[i] is the AS or the OF of an AS OF
+// clause, as opposed to a SELECT alias's AS.
+func isAsOfWord(tokens []mrql.Token, i int) bool {
+	is := func(j int, word string) bool {
+		return j >= 0 && j < len(tokens) && tokens[j].Type == mrql.TokenIdentifier && strings.EqualFold(tokens[j].Value, word)
+	}
+	return (is(i, "as") && is(i+1, "of")) || (is(i, "of") && is(i-1, "as"))
+}
+
+// fieldSummary describes field name: its type and the entity types that have
+// it, narrowed to entityType when the query names one.
+func fieldSummary(name string, entityType mrql.EntityType) string {
+	entityTypes := []mrql.EntityType{mrql.EntityResource, mrql.EntityNote, mrql.EntityGroup}
+	if entityType != mrql.EntityUnspecified {
+		entityTypes = []mrql.EntityType{entityType}
+	}
+	var (
+		fieldType string
+		on        []string
+	)
+	for _, et := range entityTypes {
+		def, ok := mrql.LookupField(et, name)
+		if !ok {
+			continue
+		}
+		fieldType = fieldTypeNames[def.Type]
+		on = append(on, et.String())
+	}
+	if len(on) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("`%s`: %s field on %s", name, fieldType, strings.Join(on, ", "))
+}
+
+var fieldTypeNames = map[mrql.FieldType]string{
+	mrql.FieldString:   "string",
+	mrql.FieldNumber:   "number",
+	mrql.FieldDateTime: "date-time",
+	mrql.FieldRelation: "relation",
+	mrql.FieldMeta:     "metadata",
+}
+
+// detectEntity returns the entity type a `type = x` comparison names, or
+// EntityUnspecified.
+func detectEntity(tokens []mrql.Token) mrql.EntityType {
+	for i := 0; i+2 < len(tokens); i++ {
+		if tokens[i].Type == mrql.TokenKwType && tokens[i+1].Type == mrql.TokenEq {
+			if et, ok := mrql.ValidEntityTypes[strings.ToLower(tokens[i+2].Value)]; ok {
+				return et
+			}
+		}
+	}
+	return mrql.EntityUnspecified
+}
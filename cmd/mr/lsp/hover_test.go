@@ -0,0 +1,81 @@
+package lsp
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// Every section hover can point at must exist in the embedded reference, or
+// a heading rename there silently turns hovers off.
+func TestHoverSectionsExist(t *testing.T) {
+	sections := []string{sectionTraversal, sectionMeta, sectionCounts, sectionDateBuckets,
+		sectionSubQueries, sectionOperators, sectionFileSizes, sectionFields, sectionAsOf}
+	for _, s := range keywordSections {
+		sections = append(sections, s)
+	}
+	for _, s := range rootSections {
+		sections = append(sections, s)
+	}
+	for _, s := range orderingWords {
+		sections = append(sections, s)
+	}
+	for _, s := range sections {
+		if body := referenceSections[s]; body == "" {
+			t.Errorf("reference.md has no section %q", s)
+		}
+	}
+}
+
+func TestHover(t *testing.T) {
+	const uri = "file:///q.mrql"
+	text := "type = resource AND fileSize > 10mb AND owner.name = \"x\"\nAND meta.rating > 3 AND EXT(originalName) = \"jpg\" AND tags IN (type = group)\nAS OF -30d ORDER BY created DESC"
+
+	tests := []struct {
+		word    string
+		summary string
+		section string
+	}{
+		{"fileSize", "`fileSize`: number field on resource", ""},
+		{"10mb", "", sectionFileSizes},
+		{"owner", "`owner`: relation field on resource", sectionTraversal},
+		{"rating", "`meta.rating`: a metadata key", sectionMeta},
+		{"EXT", "", sectionFunctions},
+		{"IN", "", sectionSubQueries},
+		{"OF", "", sectionAsOf},
+		{"ORDER BY", "", sectionOrdering},
+		{"created", "`created`: date-time field on resource", ""},
+	}
+	msgs := []map[string]any{open(uri, text)}
+	for i, tt := range tests {
+		p := positionAt(text, strings.Index(text, tt.word)+1)
+		msgs = append(msgs, at(i+1, "textDocument/hover", uri, p.Line, p.Character))
+	}
+	// A string literal has nothing to document.
+	p := positionAt(text, strings.Index(text, `"x"`)+1)
+	msgs = append(msgs, at(len(tests)+1, "textDocument/hover", uri, p.Line, p.Character))
+
+	got, err := session(t, nil, msgs...)
+	if err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+	for i, tt := range tests {
+		var h hoverResult
+		if err := json.Unmarshal(reply(t, got, i+1).Result, &h); err != nil {
+			t.Fatalf("%s: decode hover: %v", tt.word, err)
+		}
+		value := h.Contents.Value
+		if tt.summary != "" && !strings.HasPrefix(value, tt.summary) {
+			t.Errorf("%s: expected summary %q, got %q", tt.word, tt.summary, value)
+		}
+		if tt.section != "" && !strings.Contains(value, "### "+tt.section+"\n") {
+			t.Errorf("%s: expected section %q, got %q", tt.word, tt.section, value)
+		}
+		if h.Range == nil {
+			t.Errorf("%s: expected a range", tt.word)
+		}
+	}
+	if r := reply(t, got, len(tests)+1).Result; string(r) != "null" {
+		t.Errorf("string literal: expected no hover, got %s", r)
+	}
+}
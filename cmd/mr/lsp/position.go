@@ -0,0 +1,74 @@
+package lsp
+
+import "unicode/utf8"
+
+// LSP positions count UTF-16 code units within a line; MRQL positions are byte
+// offsets. These convert between the two over a document's text.
+
+// positionAt returns the LSP position of byte offset in text.
+func positionAt(text string, offset int) position {
+	if offset > len(text) {
+		offset = len(text)
+	}
+	var pos position
+	for i, r := range text {
+		if i >= offset {
+			break
+		}
+		if r == '\n' {
+			pos.Line++
+			pos.Character = 0
+			continue
+		}
+		pos.Character += utf16Len(r)
+	}
+	return pos
+}
+
+// offsetAt returns the byte offset of an LSP position in text. A position past
+// the end of its line clamps to the line end, and one past the last line to the
+// end of the text, as the protocol asks.
+func offsetAt(text string, pos position) int {
+	line, col := 0, 0
+	for i, r := range text {
+		if line == pos.Line && (col >= pos.Character || r == '\n') {
+			return i
+		}
+		if r == '\n' {
+			if line == pos.Line {
+				return i
+			}
+			line++
+			col = 0
+			continue
+		}
+		if line == pos.Line {
+			col += utf16Len(r)
+		}
+	}
+	return len(text)
+}
+
+// rangeOf returns the LSP range of the length bytes starting at offset. An
+// empty span widens to one character so an editor has something to underline.
+func rangeOf(text string, offset, length int) textRange {
+	if offset > len(text) {
+		offset = len(text)
+	}
+	end := offset + length
+	if length <= 0 && offset < len(text) {
+		_, size := utf8.DecodeRuneInString(text[offset:])
+		end = offset + size
+	}
+	if end > len(text) {
+		end = len(text)
+	}
+	return textRange{Start: positionAt(text, offset), End: positionAt(text, end)}
+}
+
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
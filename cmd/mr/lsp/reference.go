@@ -0,0 +1,75 @@
+package lsp
+
+import (
+	_ "embed"
+	"strings"
+)
+
+// referenceDoc is the MRQL reference page, copied here by skills-gen because
+// go:embed cannot reach docs-site/.
+//
+//go:embed reference.md
+var referenceDoc string
+
+// Reference sections hover docs point at, by heading text.
+const (
+	sectionQueryShape  = "Query Shape"
+	sectionGuardrails  = "Guardrails"
+	sectionOperators   = "Operators"
+	sectionFields      = "Fields (by entity type)"
+	sectionMeta        = "Metadata Fields"
+	sectionCounts      = "Relation Counts"
+	sectionRelDates    = "Relative Dates"
+	sectionFileSizes   = "File Size Units"
+	sectionFunctions   = "Scalar Functions"
+	sectionScope       = "SCOPE — Filter to Group Subtree"
+	sectionAsOf        = "AS OF — Past States"
+	sectionProjection  = "SELECT — Projections"
+	sectionAggregated  = "GROUP BY — Aggregated Mode"
+	sectionStatistics  = "Distinct Counts, Percentiles, and Running Totals"
+	sectionHaving      = "HAVING — Filter Aggregated Buckets"
+	sectionDateBuckets = "Date Buckets"
+	sectionTraversal   = "Traversal"
+	sectionSubQueries  = "Sub-Queries — `IN (type = ...)`"
+	sectionRecursive   = "Recursive Traversal — `ancestors.` / `descendants.`"
+	sectionRelated     = "Series, Versions, Group Relations"
+	sectionBlocks      = "Note Blocks"
+	sectionSimilarity  = "Similarity Search — `SIMILAR TO`"
+	sectionOrdering    = "Ordering Keys"
+	sectionCursor      = "Cursor Pagination"
+	sectionParameters  = "Parameters — `$name`"
+	sectionMutations   = "Mutations"
+)
+
+// referenceSections maps each heading of referenceDoc to the text under it,
+// up to the next heading of any level.
+var referenceSections = parseSections(referenceDoc)
+
+func parseSections(doc string) map[string]string {
+	sections := map[string]string{}
+	var (
+		heading string
+		body    strings.Builder
+		inFence bool
+	)
+	flush := func() {
+		if heading != "" {
+			sections[heading] = strings.TrimSpace(body.String())
+		}
+		body.Reset()
+	}
+	for _, line := range strings.Split(doc, "\n") {
+		if strings.HasPrefix(line, "```") {
+			inFence = !inFence
+		}
+		if !inFence && strings.HasPrefix(line, "#") {
+			flush()
+			heading = strings.TrimSpace(strings.TrimLeft(line, "#"))
+			continue
+		}
+		body.WriteString(line)
+		body.WriteByte('\n')
+	}
+	flush()
+	return sections
+}
@@ -0,0 +1,294 @@
+// Package lsp implements `mr mrql lsp`, a Language Server Protocol server for
+// MRQL over stdio. Each open document is one MRQL query. The server offers
+// completion from mrql.Complete, diagnostics from the parser and validator
+// (plus the server's EXPLAIN warnings when a Backend is configured), hover
+// docs from the MRQL reference, and formatting through mrql.Format.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"mahresources/mrql"
+)
+
+// Server is one language server session.
+type Server struct {
+	out     io.Writer
+	backend Backend
+	values  *valueCache
+
+	docs     map[string]*document
+	shutdown bool
+}
+
+type document struct {
+	text    string
+	version int
+}
+
+// errExitWithoutShutdown is returned when the client sends exit without first
+// asking for shutdown, which the protocol treats as an abnormal end.
+var errExitWithoutShutdown = errors.New("exit received before shutdown")
+
+// Serve runs a session reading requests from in and writing responses to out
+// until the client exits or in closes. backend may be nil.
+func Serve(in io.Reader, out io.Writer, backend Backend) error {
+	s := &Server{
+		out:     out,
+		backend: backend,
+		values:  newValueCache(),
+		docs:    map[string]*document{},
+	}
+	r := bufio.NewReader(in)
+	for {
+		body, err := readMessage(r)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			if err := s.replyError(nil, codeParseError, err.Error()); err != nil {
+				return err
+			}
+			continue
+		}
+		if req.Method == "exit" {
+			if !s.shutdown {
+				return errExitWithoutShutdown
+			}
+			return nil
+		}
+		if err := s.handle(req); err != nil {
+			return err
+		}
+	}
+}
+
+// handle dispatches one message. Only a failure to write to the client is
+// returned; everything else is answered on the wire.
+func (s *Server) handle(req request) error {
+	if req.ID == nil {
+		s.notify(req)
+		return nil
+	}
+
+	var (
+		result any
+		err    error
+	)
+	switch req.Method {
+	case "initialize":
+		result = s.initialize()
+	case "shutdown":
+		s.shutdown = true
+	case "textDocument/completion":
+		var params textDocumentPositionParams
+		if err = json.Unmarshal(req.Params, &params); err == nil {
+			result = s.completion(params)
+		}
+	case "textDocument/hover":
+		var params textDocumentPositionParams
+		if err = json.Unmarshal(req.Params, &params); err == nil {
+			result = s.hover(params)
+		}
+	case "textDocument/formatting":
+		var params documentParams
+		if err = json.Unmarshal(req.Params, &params); err == nil {
+			result, err = s.formatting(params)
+			if err != nil {
+				return s.replyError(req.ID, codeRequestFailed, err.Error())
+			}
+		}
+	default:
+		return s.replyError(req.ID, codeMethodNotFound, "method not found: "+req.Method)
+	}
+	if err != nil {
+		return s.replyError(req.ID, codeInvalidParams, err.Error())
+	}
+	return writeMessage(s.out, response{JSONRPC: "2.0", ID: req.ID, Result: result})
+}
+
+// notify handles a notification. Unknown ones are ignored, as the protocol
+// asks; so are malformed ones, since there is no one to answer.
+func (s *Server) notify(req request) {
+	switch req.Method {
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if json.Unmarshal(req.Params, &params) == nil {
+			td := params.TextDocument
+			s.docs[td.URI] = &document{text: td.Text, version: td.Version}
+			s.publishDiagnostics(td.URI, true)
+		}
+	case "textDocument/didChange":
+		var params didChangeParams
+		if json.Unmarshal(req.Params, &params) == nil && len(params.ContentChanges) > 0 {
+			td := params.TextDocument
+			// Sync is full-document, so the last change holds the whole text.
+			text := params.ContentChanges[len(params.ContentChanges)-1].Text
+			s.docs[td.URI] = &document{text: text, version: td.Version}
+			s.publishDiagnostics(td.URI, false)
+		}
+	case "textDocument/didSave":
+		var params documentParams
+		if json.Unmarshal(req.Params, &params) == nil {
+			s.publishDiagnostics(params.TextDocument.URI, true)
+		}
+	case "textDocument/didClose":
+		var params documentParams
+		if json.Unmarshal(req.Params, &params) == nil {
+			delete(s.docs, params.TextDocument.URI)
+			s.send("textDocument/publishDiagnostics", publishDiagnosticsParams{
+				URI:         params.TextDocument.URI,
+				Diagnostics: []diagnostic{},
+			})
+		}
+	}
+}
+
+func (s *Server) initialize() any {
+	return map[string]any{
+		"capabilities": map[string]any{
+			"textDocumentSync": map[string]any{
+				"openClose": true,
+				"change":    textDocumentSyncFull,
+				"save":      map[string]any{"includeText": false},
+			},
+			"completionProvider": map[string]any{
+				"triggerCharacters": []string{".", `"`, "("},
+			},
+			"hoverProvider":              true,
+			"documentFormattingProvider": true,
+		},
+		"serverInfo": map[string]any{"name": "mr mrql lsp"},
+	}
+}
+
+// publishDiagnostics checks a document and sends the result. Parse and
+// validation errors are found locally on every change; the server's EXPLAIN
+// is only consulted when askServer is set (open and save), since it costs a
+// round trip.
+func (s *Server) publishDiagnostics(uri string, askServer bool) {
+	doc, ok := s.docs[uri]
+	if !ok {
+		return
+	}
+	version := doc.version
+	s.send("textDocument/publishDiagnostics", publishDiagnosticsParams{
+		URI:         uri,
+		Version:     &version,
+		Diagnostics: s.diagnose(doc.text, askServer),
+	})
+}
+
+func (s *Server) diagnose(text string, askServer bool) []diagnostic {
+	diags := []diagnostic{}
+	if strings.TrimSpace(text) == "" {
+		return diags
+	}
+
+	q, err := parseDocument(text)
+	if err == nil {
+		err = mrql.Validate(q)
+	}
+	if err != nil {
+		pos, length := 0, 0
+		var parseErr *mrql.ParseError
+		var validationErr *mrql.ValidationError
+		switch {
+		case errors.As(err, &parseErr):
+			pos, length = parseErr.Pos, parseErr.Length
+			err = errors.New(parseErr.Message)
+		case errors.As(err, &validationErr):
+			pos, length = validationErr.Pos, validationErr.Length
+			err = errors.New(validationErr.Message)
+		}
+		return append(diags, diagnostic{
+			Range:    rangeOf(text, pos, length),
+			Severity: severityError,
+			Source:   "mrql",
+			Message:  err.Error(),
+		})
+	}
+
+	// EXPLAIN cannot bind parameters and does not run mutations, so those
+	// documents get local checks only.
+	if !askServer || s.backend == nil || q.Mutation != nil || len(mrql.ListParams(q)) > 0 {
+		return diags
+	}
+	warnings, err := s.backend.Explain(text)
+	if err != nil {
+		return append(diags, diagnostic{
+			Range:    rangeOf(text, 0, 0),
+			Severity: severityError,
+			Source:   "mrql",
+			Message:  err.Error(),
+		})
+	}
+	for _, w := range warnings {
+		diags = append(diags, diagnostic{
+			Range:    rangeOf(text, 0, 0),
+			Severity: severityWarning,
+			Source:   "mrql",
+			Message:  w,
+		})
+	}
+	return diags
+}
+
+// parseDocument parses text as a query, or as a mutation when that is what it
+// is; Parse alone rejects the mutation clauses.
+func parseDocument(text string) (*mrql.Query, error) {
+	q, err := mrql.Parse(text)
+	if err != nil {
+		if mq, mutationErr := mrql.ParseMutation(text); mutationErr == nil {
+			return mq, nil
+		}
+	}
+	return q, err
+}
+
+// formatting returns the edit that replaces the document with its formatted
+// text, or no edits when it is already formatted.
+func (s *Server) formatting(params documentParams) ([]textEdit, error) {
+	doc, ok := s.docs[params.TextDocument.URI]
+	if !ok {
+		return nil, fmt.Errorf("unknown document %s", params.TextDocument.URI)
+	}
+	body := strings.TrimRight(doc.text, " \t\r\n")
+	if body == "" {
+		return []textEdit{}, nil
+	}
+	formatted, err := mrql.Format(body)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(doc.text, "\n") {
+		formatted += "\n"
+	}
+	if formatted == doc.text {
+		return []textEdit{}, nil
+	}
+	return []textEdit{{Range: rangeOf(doc.text, 0, len(doc.text)), NewText: formatted}}, nil
+}
+
+// send writes a notification to the client. A write failure surfaces on the
+// next response, which Serve returns.
+func (s *Server) send(method string, params any) {
+	_ = writeMessage(s.out, notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (s *Server) replyError(id *json.RawMessage, code int, message string) error {
+	return writeMessage(s.out, errorResponse{
+		JSONRPC: "2.0",
+		ID:      id,
+		Error:   responseError{Code: code, Message: message},
+	})
+}
@@ -0,0 +1,430 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"mahresources/mrql"
+)
+
+// fakeBackend answers from fixed data and records what it was asked.
+type fakeBackend struct {
+	named      map[nameKind][]namedEntity
+	metaKeys   []string
+	warnings   []string
+	explainErr error
+	explained  []string
+	lookups    int
+}
+
+func (b *fakeBackend) Named(kind nameKind, prefix string) ([]namedEntity, error) {
+	b.lookups++
+	var out []namedEntity
+	for _, e := range b.named[kind] {
+		if strings.HasPrefix(strings.ToLower(e.Name), strings.ToLower(prefix)) {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func (b *fakeBackend) MetaKeys(mrql.EntityType) ([]string, error) {
+	b.lookups++
+	return b.metaKeys, nil
+}
+
+func (b *fakeBackend) Explain(query string) ([]string, error) {
+	b.explained = append(b.explained, query)
+	return b.warnings, b.explainErr
+}
+
+// message is any message the server wrote, request or notification.
+type message struct {
+	ID     *int            `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *responseError  `json:"error"`
+}
+
+// session frames msgs as a client would, runs Serve over them and returns
+// everything the server wrote, with the error Serve returned.
+func session(t *testing.T, backend Backend, msgs ...map[string]any) ([]message, error) {
+	t.Helper()
+	var in bytes.Buffer
+	for _, m := range msgs {
+		m["jsonrpc"] = "2.0"
+		if err := writeMessage(&in, m); err != nil {
+			t.Fatalf("frame message: %v", err)
+		}
+	}
+	var out bytes.Buffer
+	serveErr := Serve(&in, &out, backend)
+
+	var got []message
+	r := bufio.NewReader(&out)
+	for {
+		body, err := readMessage(r)
+		if err != nil {
+			break
+		}
+		var m message
+		if err := json.Unmarshal(body, &m); err != nil {
+			t.Fatalf("decode server message %s: %v", body, err)
+		}
+		got = append(got, m)
+	}
+	return got, serveErr
+}
+
+func call(id int, method string, params any) map[string]any {
+	return map[string]any{"id": id, "method": method, "params": params}
+}
+
+func notice(method string, params any) map[string]any {
+	return map[string]any{"method": method, "params": params}
+}
+
+func open(uri, text string) map[string]any {
+	return notice("textDocument/didOpen", map[string]any{
+		"textDocument": map[string]any{"uri": uri, "languageId": "mrql", "version": 1, "text": text},
+	})
+}
+
+func at(id int, method, uri string, line, character int) map[string]any {
+	return call(id, method, map[string]any{
+		"textDocument": map[string]any{"uri": uri},
+		"position":     map[string]any{"line": line, "character": character},
+	})
+}
+
+// reply returns the response to request id.
+func reply(t *testing.T, msgs []message, id int) message {
+	t.Helper()
+	for _, m := range msgs {
+		if m.ID != nil && *m.ID == id && m.Method == "" {
+			return m
+		}
+	}
+	t.Fatalf("no reply to request %d in %d messages", id, len(msgs))
+	return message{}
+}
+
+// diagnostics returns the diagnostics of each publishDiagnostics notification,
+// in order.
+func diagnostics(t *testing.T, msgs []message) [][]diagnostic {
+	t.Helper()
+	var out [][]diagnostic
+	for _, m := range msgs {
+		if m.Method != "textDocument/publishDiagnostics" {
+			continue
+		}
+		var p publishDiagnosticsParams
+		if err := json.Unmarshal(m.Params, &p); err != nil {
+			t.Fatalf("decode diagnostics: %v", err)
+		}
+		out = append(out, p.Diagnostics)
+	}
+	return out
+}
+
+func TestServeLifecycle(t *testing.T) {
+	msgs, err := session(t, nil,
+		call(1, "initialize", map[string]any{"capabilities": map[string]any{}}),
+		notice("initialized", map[string]any{}),
+		call(2, "workspace/symbol", map[string]any{}),
+		notice("$/cancelRequest", map[string]any{"id": 2}),
+		call(3, "shutdown", nil),
+		notice("exit", nil),
+	)
+	if err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+
+	var init struct {
+		Capabilities struct {
+			HoverProvider              bool `json:"hoverProvider"`
+			DocumentFormattingProvider bool `json:"documentFormattingProvider"`
+			TextDocumentSync           struct {
+				Change int `json:"change"`
+			} `json:"textDocumentSync"`
+			CompletionProvider struct {
+				TriggerCharacters []string `json:"triggerCharacters"`
+			} `json:"completionProvider"`
+		} `json:"capabilities"`
+	}
+	if err := json.Unmarshal(reply(t, msgs, 1).Result, &init); err != nil {
+		t.Fatalf("decode initialize result: %v", err)
+	}
+	caps := init.Capabilities
+	if !caps.HoverProvider || !caps.DocumentFormattingProvider || caps.TextDocumentSync.Change != textDocumentSyncFull {
+		t.Errorf("unexpected capabilities: %+v", caps)
+	}
+	if len(caps.CompletionProvider.TriggerCharacters) == 0 {
+		t.Errorf("expected completion trigger characters")
+	}
+
+	if e := reply(t, msgs, 2).Error; e == nil || e.Code != codeMethodNotFound {
+		t.Errorf("unknown method: expected error %d, got %+v", codeMethodNotFound, e)
+	}
+	if m := reply(t, msgs, 3); m.Error != nil || string(m.Result) != "null" {
+		t.Errorf("shutdown: expected a null result, got %s (error %+v)", m.Result, m.Error)
+	}
+	if len(msgs) != 3 {
+		t.Errorf("notifications must not be answered; got %d messages", len(msgs))
+	}
+}
+
+func TestServeExitWithoutShutdown(t *testing.T) {
+	if _, err := session(t, nil, notice("exit", nil)); !errors.Is(err, errExitWithoutShutdown) {
+		t.Errorf("expected errExitWithoutShutdown, got %v", err)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	const uri = "file:///q.mrql"
+	backend := &fakeBackend{warnings: []string{"no default LIMIT"}}
+	msgs, err := session(t, backend,
+		open(uri, "type = note AND\n  nme = \"x\""),
+		notice("textDocument/didChange", map[string]any{
+			"textDocument":   map[string]any{"uri": uri, "version": 2},
+			"contentChanges": []map[string]any{{"text": `type = note AND name = "x"`}},
+		}),
+		notice("textDocument/didSave", map[string]any{"textDocument": map[string]any{"uri": uri}}),
+		notice("textDocument/didChange", map[string]any{
+			"textDocument":   map[string]any{"uri": uri, "version": 3},
+			"contentChanges": []map[string]any{{"text": `type = note AND name = $name`}},
+		}),
+		notice("textDocument/didSave", map[string]any{"textDocument": map[string]any{"uri": uri}}),
+		notice("textDocument/didClose", map[string]any{"textDocument": map[string]any{"uri": uri}}),
+	)
+	if err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+	published := diagnostics(t, msgs)
+	if len(published) != 6 {
+		t.Fatalf("expected 6 diagnostic publications, got %d", len(published))
+	}
+
+	// The unknown field is reported where it is, on the second line.
+	if len(published[0]) != 1 {
+		t.Fatalf("expected one diagnostic for the unknown field, got %+v", published[0])
+	}
+	d := published[0][0]
+	want := textRange{Start: position{Line: 1, Character: 2}, End: position{Line: 1, Character: 5}}
+	if d.Range != want || d.Severity != severityError || d.Source != "mrql" {
+		t.Errorf("unexpected diagnostic %+v, want range %+v", d, want)
+	}
+
+	if len(published[1]) != 0 {
+		t.Errorf("a valid change should clear the diagnostics, got %+v", published[1])
+	}
+	if len(published[2]) != 1 || published[2][0].Severity != severityWarning || published[2][0].Message != "no default LIMIT" {
+		t.Errorf("expected the server's warning on save, got %+v", published[2])
+	}
+	if len(published[4]) != 0 {
+		t.Errorf("a parameterised query should get local checks only, got %+v", published[4])
+	}
+	if len(published[5]) != 0 {
+		t.Errorf("closing should clear the diagnostics, got %+v", published[5])
+	}
+	// Explain runs on save of a valid query only: not for the invalid open
+	// nor for the parameterised save.
+	if len(backend.explained) != 1 {
+		t.Errorf("expected one explain call, got %q", backend.explained)
+	}
+}
+
+func TestDiagnosticsReportServerRejection(t *testing.T) {
+	backend := &fakeBackend{explainErr: errors.New("HTTP 400: scope group not found")}
+	msgs, err := session(t, backend, open("file:///q.mrql", `type = note SCOPE "Missing"`))
+	if err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+	published := diagnostics(t, msgs)
+	if len(published) != 1 || len(published[0]) != 1 || !strings.Contains(published[0][0].Message, "scope group not found") {
+		t.Errorf("expected the server's rejection as a diagnostic, got %+v", published)
+	}
+}
+
+// completionItems runs one completion request at the end of text.
+func completionItems(t *testing.T, backend Backend, text string) completionList {
+	t.Helper()
+	const uri = "file:///q.mrql"
+	end := positionAt(text, len(text))
+	msgs, err := session(t, backend, open(uri, text), at(1, "textDocument/completion", uri, end.Line, end.Character))
+	if err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+	var list completionList
+	if err := json.Unmarshal(reply(t, msgs, 1).Result, &list); err != nil {
+		t.Fatalf("decode completion: %v", err)
+	}
+	return list
+}
+
+func findItem(list completionList, label string) *completionItem {
+	for i := range list.Items {
+		if list.Items[i].Label == label {
+			return &list.Items[i]
+		}
+	}
+	return nil
+}
+
+func TestCompletion(t *testing.T) {
+	backend := &fakeBackend{
+		named: map[nameKind][]namedEntity{
+			nameTag:              {{ID: 1, Name: "photo"}, {ID: 2, Name: `say "hi"`}, {ID: 3, Name: "travel"}},
+			nameResourceCategory: {{ID: 7, Name: "Scans"}},
+			nameGroup:            {{ID: 4, Name: "Projects"}},
+		},
+		metaKeys: []string{"priority", "has space", "project"},
+	}
+
+	t.Run("static suggestions", func(t *testing.T) {
+		list := completionItems(t, nil, "type = resource AND fi")
+		item := findItem(list, "fileSize")
+		if item == nil {
+			t.Fatalf("expected fileSize among %d items", len(list.Items))
+		}
+		if item.Kind != kindField || item.TextEdit == nil || item.TextEdit.Range.Start.Character != 20 || item.TextEdit.NewText != "fileSize" {
+			t.Errorf("unexpected fileSize item %+v", item)
+		}
+		if list.IsIncomplete {
+			t.Errorf("offline completion should be complete")
+		}
+	})
+
+	t.Run("tag names replace the half-typed string", func(t *testing.T) {
+		list := completionItems(t, backend, `type = resource AND tags = "p`)
+		item := findItem(list, "photo")
+		if item == nil {
+			t.Fatalf("expected the photo tag, got %+v", list.Items)
+		}
+		if item.TextEdit.NewText != `"photo"` || item.TextEdit.Range.Start.Character != 27 {
+			t.Errorf("unexpected tag item %+v", item.TextEdit)
+		}
+		if findItem(list, "travel") != nil {
+			t.Errorf("tags not matching the prefix should be left out")
+		}
+		if !list.IsIncomplete {
+			t.Errorf("live values should mark the list incomplete")
+		}
+	})
+
+	t.Run("names are escaped", func(t *testing.T) {
+		item := findItem(completionItems(t, backend, `type = note AND tags IN ("photo", `), `say "hi"`)
+		if item == nil || item.TextEdit.NewText != `"say \"hi\""` {
+			t.Errorf("expected an escaped name, got %+v", item)
+		}
+	})
+
+	t.Run("category inserts the ID", func(t *testing.T) {
+		item := findItem(completionItems(t, backend, `type = resource AND category = `), "Scans")
+		if item == nil || item.TextEdit.NewText != "7" {
+			t.Errorf("expected the category ID, got %+v", item)
+		}
+	})
+
+	t.Run("group names", func(t *testing.T) {
+		if findItem(completionItems(t, backend, `type = note AND owner.name = "Pro`), "Projects") == nil {
+			t.Errorf("expected the Projects group")
+		}
+	})
+
+	t.Run("meta keys", func(t *testing.T) {
+		list := completionItems(t, backend, `type = note AND meta.pr`)
+		if findItem(list, "priority") == nil || findItem(list, "project") == nil {
+			t.Errorf("expected the matching meta keys, got %+v", list.Items)
+		}
+		if findItem(list, "has space") != nil {
+			t.Errorf("a key that cannot follow meta. unquoted should be left out")
+		}
+	})
+}
+
+func TestValueCache(t *testing.T) {
+	backend := &fakeBackend{named: map[nameKind][]namedEntity{nameTag: {{ID: 1, Name: "photo"}}}}
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := newValueCache()
+	c.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.named(backend, nameTag, "p"); err != nil {
+			t.Fatalf("named: %v", err)
+		}
+	}
+	if backend.lookups != 1 {
+		t.Errorf("expected the second lookup to be cached, got %d lookups", backend.lookups)
+	}
+	now = now.Add(valueCacheTTL + time.Second)
+	if _, err := c.named(backend, nameTag, "p"); err != nil {
+		t.Fatalf("named: %v", err)
+	}
+	if backend.lookups != 2 {
+		t.Errorf("expected an expired entry to be fetched again, got %d lookups", backend.lookups)
+	}
+}
+
+func TestFormatting(t *testing.T) {
+	const uri = "file:///q.mrql"
+	format := call(1, "textDocument/formatting", map[string]any{
+		"textDocument": map[string]any{"uri": uri},
+		"options":      map[string]any{"tabSize": 2, "insertSpaces": true},
+	})
+
+	msgs, err := session(t, nil, open(uri, "type = note and name ~ \"x\" order by created\n"), format)
+	if err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+	var edits []textEdit
+	if err := json.Unmarshal(reply(t, msgs, 1).Result, &edits); err != nil {
+		t.Fatalf("decode edits: %v", err)
+	}
+	if len(edits) != 1 || edits[0].NewText != "type = note AND name ~ \"x\"\nORDER BY created\n" {
+		t.Fatalf("unexpected edits %+v", edits)
+	}
+	if want := (textRange{End: position{Line: 1}}); edits[0].Range != want {
+		t.Errorf("expected the edit to span the document, got %+v", edits[0].Range)
+	}
+
+	msgs, err = session(t, nil, open(uri, "type = note\n"), format)
+	if err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+	if got := string(reply(t, msgs, 1).Result); got != "[]" {
+		t.Errorf("a formatted document should need no edits, got %s", got)
+	}
+
+	msgs, err = session(t, nil, open(uri, `name = "unterminated`), format)
+	if err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+	if e := reply(t, msgs, 1).Error; e == nil || e.Code != codeRequestFailed {
+		t.Errorf("expected a request-failed error, got %+v", e)
+	}
+}
+
+func TestPositions(t *testing.T) {
+	text := "name = \"😀\"\nAND x"
+	// The emoji is 4 bytes but 2 UTF-16 units.
+	xOffset := strings.Index(text, "x")
+	if got := positionAt(text, xOffset); got != (position{Line: 1, Character: 4}) {
+		t.Errorf("positionAt = %+v", got)
+	}
+	if got, want := offsetAt(text, position{Line: 0, Character: 10}), strings.Index(text, "😀")+4; got != want {
+		t.Errorf("offsetAt after the emoji = %d, want %d", got, want)
+	}
+	if got := offsetAt(text, position{Line: 0, Character: 99}); got != strings.Index(text, "\n") {
+		t.Errorf("a position past the line end should clamp to it, got %d", got)
+	}
+	if got := offsetAt(text, position{Line: 5}); got != len(text) {
+		t.Errorf("a position past the last line should clamp to the end, got %d", got)
+	}
+}
@@ -82,7 +82,7 @@ func main() {
 	rootCmd.AddCommand(commands.NewJobsCmd(c, opts))
 	rootCmd.AddCommand(commands.NewPluginCmd(c, opts))
 	rootCmd.AddCommand(commands.NewPluginsCmd(c, opts))
-	rootCmd.AddCommand(commands.NewAdminCmd(c, opts))
+	rootCmd.AddCommand(commands.NewAdminCmd(c, opts, &page))
 	rootCmd.AddCommand(commands.NewDocsCmd())
 
 	commands.ApplyHelpCustomizations(rootCmd)
@@ -8,6 +8,9 @@
 // CLI section built from the live Cobra tree (via `mr docs dump --format json`),
 // so a flag added to `mr mrql` shows up in the skill without anyone retyping it.
 //
+// The same transformed page, without the CLI section, is also written to
+// cmd/mr/lsp/reference.md, where `mr mrql lsp` embeds it for hover docs.
+//
 // CI regenerates and diffs, exactly like the docs-site CLI pages.
 //
 //	go run ./cmd/skills-gen
@@ -31,6 +34,7 @@ import (
 const (
 	defaultReference = "docs-site/docs/features/mrql-reference.md"
 	defaultOutput    = "skills/mahresources-mrql/references/language.md"
+	defaultLSPOutput = "cmd/mr/lsp/reference.md"
 	defaultMrBinary  = "./mr"
 	// docsBaseURL matches the -docs-site-base-url default. Relative Docusaurus
 	// links must become absolute: the skill is installed outside this repo, so
@@ -44,9 +48,11 @@ var cliCommandPaths = []string{
 	"mrql save",
 	"mrql list",
 	"mrql run",
+	"mrql refresh",
 	"mrql explain",
 	"mrql export",
 	"mrql delete",
+	"mrql fmt",
 	"search",
 }
 
@@ -77,23 +83,30 @@ func main() {
 	var (
 		reference = flag.String("reference", defaultReference, "path to the canonical MRQL reference page")
 		output    = flag.String("o", defaultOutput, "path to the generated skill reference")
+		lspOutput = flag.String("lsp-o", defaultLSPOutput, "path to the reference copy embedded by the MRQL language server")
 		mrBinary  = flag.String("mr", defaultMrBinary, "path to the built mr binary used for `docs dump`")
 		cliJSON   = flag.String("cli-json", "", "read the CLI tree from this file instead of invoking -mr")
 	)
 	flag.Parse()
 
-	if err := run(*reference, *output, *mrBinary, *cliJSON); err != nil {
+	if err := run(*reference, *output, *lspOutput, *mrBinary, *cliJSON); err != nil {
 		fmt.Fprintln(os.Stderr, "skills-gen:", err)
 		os.Exit(1)
 	}
 }
 
-func run(reference, output, mrBinary, cliJSON string) error {
+func run(reference, output, lspOutput, mrBinary, cliJSON string) error {
 	page, err := os.ReadFile(reference)
 	if err != nil {
 		return fmt.Errorf("reading reference: %w", err)
 	}
 
+	if lspOutput != "" {
+		if err := writeFileAtomic(lspOutput, []byte(lspHeader(reference)+transformReference(string(page)))); err != nil {
+			return err
+		}
+	}
+
 	tree, err := loadCLITree(mrBinary, cliJSON)
 	if err != nil {
 		return err
@@ -146,6 +159,18 @@ Regenerate with:  npm run skills-gen
 `, reference)
 }
 
+func lspHeader(reference string) string {
+	return fmt.Sprintf(`<!--
+GENERATED FILE. DO NOT EDIT.
+
+Copied from %s for the MRQL language server's hover docs.
+
+Regenerate with:  npm run skills-gen
+-->
+
+`, reference)
+}
+
 var (
 	frontmatterRE = regexp.MustCompile(`(?s)\A---\r?\n.*?\r?\n---\r?\n`)
 	// mdLinkRE matches an inline Markdown link whose target is a relative path,
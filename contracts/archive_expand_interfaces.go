@@ -0,0 +1,18 @@
+package contracts
+
+import (
+	"io"
+
+	"mahresources/models"
+	"mahresources/models/query_models"
+)
+
+// ArchiveExpander unpacks an uploaded zip or tar into a new group in the
+// background, instead of storing it as one resource.
+//
+// ownerUserID/ownerRestricted are the caller's visibility, as for the download
+// history: admins may see any expansion, every other principal only its own.
+type ArchiveExpander interface {
+	StartArchiveExpansion(file io.Reader, fileName string, creator *query_models.ResourceCreator) (*models.ArchiveExpansion, error)
+	GetArchiveExpansion(id uint, ownerUserID *uint, ownerRestricted bool) (*models.ArchiveExpansion, error)
+}
@@ -71,6 +71,12 @@ type ResourceMediaProcessor interface {
 	SetResourceDimensions(resourceId uint, width, height uint) error
 }
 
+// ResourceTextReader returns the text extracted from a resource's file, such
+// as a PDF's text layer.
+type ResourceTextReader interface {
+	GetResourceText(resourceId uint) (*models.ResourceText, error)
+}
+
 // --- Composite Interface (backward compatibility) ---
 
 // ResourceWriter combines all resource write operations
@@ -90,6 +96,12 @@ type ResourceReader interface {
 	GetResources(offset int, maxResults int, h *query_models.ResourceSearchQuery) ([]models.Resource, error)
 }
 
+// ResourceContentReader serves a resource's file and notes that it was viewed.
+type ResourceContentReader interface {
+	ResourceReader
+	RecordResourceView(id uint)
+}
+
 // SuggestedTag is a single context-aware tag suggestion for a resource. Score
 // and Sources are advisory (tooltips/telemetry); the frontend applies a chip
 // using only ID and Name. The DTO lives here (not in application_context) so
@@ -0,0 +1,28 @@
+package contracts
+
+import (
+	"io"
+
+	"mahresources/models"
+	"mahresources/models/query_models"
+)
+
+// ResumableUploader serves tus uploads: a file sent in as many requests as the
+// client needs, then created as a resource or as a new version of one.
+//
+// ownerUserID/ownerRestricted are the caller's visibility, as for the download
+// history: admins may continue any upload, every other principal only its own.
+type ResumableUploader interface {
+	// CheckUploadQuota refuses an upload of length bytes that a storage quota
+	// could not take: a new resource under ownerID, or a new version of
+	// resourceID when it is set.
+	CheckUploadQuota(resourceID, ownerID uint, length int64) error
+	CreateResumableUpload(kind string, length int64, metadata map[string]string, ownerUserID *uint) (*models.ResumableUpload, error)
+	GetResumableUpload(id string, ownerUserID *uint, ownerRestricted bool) (*models.ResumableUpload, error)
+	WriteResumableUpload(id string, ownerUserID *uint, ownerRestricted bool, offset int64, body io.Reader) (*models.ResumableUpload, error)
+	// CompleteResumableUpload creates the resource or version once every byte
+	// has arrived. creator is unused for a version.
+	CompleteResumableUpload(id string, creator *query_models.ResourceCreator) (*models.ResumableUpload, error)
+	DeleteResumableUpload(id string, ownerUserID *uint, ownerRestricted bool) error
+	GetResource(id uint) (*models.Resource, error)
+}
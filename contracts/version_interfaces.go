@@ -40,4 +40,7 @@ type VersionComparer interface {
 type VersionFileServer interface {
 	VersionReader
 	GetFsForStorageLocation(storageLocation *string) (afero.Fs, error)
+	// QuarantinedBlob returns the blob integrity issue quarantining a file,
+	// or nil when it may be served.
+	QuarantinedBlob(storageLocation *string, location string) *models.BlobIntegrityIssue
 }
@@ -59,6 +59,15 @@ const sidebars: SidebarsConfig = {
         'features/export-import',
         'features/versioning',
         'features/image-similarity',
+        'features/blob-integrity',
+        'features/blob-garbage-collection',
+        'features/content-hash-migration',
+        'features/encryption-at-rest',
+        'features/storage-tiering',
+        'features/resumable-uploads',
+        'features/storage-quotas',
+        'features/archive-expansion',
+        'features/watch-folders',
         'features/saved-queries',
         'features/custom-templates',
         'features/meta-schemas',
@@ -26,6 +26,9 @@ const (
 	JobSourceGroupExport      = "group-export"
 	JobSourceGroupImportParse = "group-import-parse"
 	JobSourceGroupImportApply = "group-import-apply"
+	JobSourceMRQLMutation     = "mrql-mutation"
+	JobSourceArchiveExpand    = "archive-expand"
+	JobSourceWatchScan        = "watch-scan"
 )
 
 // DownloadJob represents a single remote URL download task
@@ -41,7 +44,7 @@ type DownloadJob struct {
 	CreatedAt       time.Time  `json:"createdAt"`
 	StartedAt       *time.Time `json:"startedAt,omitempty"`
 	CompletedAt     *time.Time `json:"completedAt,omitempty"`
-	Source          string     `json:"source"` // "download", "plugin", or "group-export"
+	Source          string     `json:"source"` // one of the JobSource* constants
 
 	Phase      string   `json:"phase,omitempty"`
 	PhaseCount int64    `json:"phaseCount,omitempty"`
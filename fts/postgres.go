@@ -27,6 +27,13 @@ func (p *PostgresFTS) Setup(db *gorm.DB) error {
 			return fmt.Errorf("failed to setup FTS for %s: %w", entityType, err)
 		}
 	}
+
+	// Trigram index behind MRQL's blocks.text ~ "..." (an ILIKE substring match).
+	if err := db.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_note_blocks_search_text_trgm
+		ON note_blocks USING GIN(search_text gin_trgm_ops)`).Error; err != nil {
+		return fmt.Errorf("failed to create trigram index on note_blocks: %w", err)
+	}
 	return nil
 }
 
@@ -22,6 +22,45 @@ func (s *SQLiteFTS) Setup(db *gorm.DB) error {
 			return fmt.Errorf("failed to setup FTS for %s: %w", entityType, err)
 		}
 	}
+	if err := s.setupNoteBlockText(db); err != nil {
+		return fmt.Errorf("failed to setup FTS for note blocks: %w", err)
+	}
+	return nil
+}
+
+// setupNoteBlockText creates a trigram FTS5 table over
+// note_blocks.search_text, which lets MRQL's blocks.text ~ "..." substring
+// match use an index. It stores its own copy of the text: search_text is
+// itself written by a trigger after the insert (see
+// models.EnsureNoteBlockSearch), so an external-content table would be fed
+// the pre-trigger value. Keyed by block id.
+func (s *SQLiteFTS) setupNoteBlockText(db *gorm.DB) error {
+	var count int
+	db.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='note_blocks_fts'").Scan(&count)
+
+	if count == 0 {
+		if err := db.Exec("CREATE VIRTUAL TABLE note_blocks_fts USING fts5(search_text, tokenize='trigram')").Error; err != nil {
+			return fmt.Errorf("failed to create FTS table note_blocks_fts: %w", err)
+		}
+		if err := db.Exec("INSERT INTO note_blocks_fts(rowid, search_text) SELECT id, search_text FROM note_blocks WHERE search_text <> ''").Error; err != nil {
+			return fmt.Errorf("failed to populate FTS table note_blocks_fts: %w", err)
+		}
+	}
+
+	triggers := []string{
+		`CREATE TRIGGER IF NOT EXISTS note_blocks_fts_au AFTER UPDATE OF search_text ON note_blocks BEGIN
+			DELETE FROM note_blocks_fts WHERE rowid = old.id;
+			INSERT INTO note_blocks_fts(rowid, search_text) SELECT new.id, new.search_text WHERE new.search_text <> '';
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS note_blocks_fts_ad AFTER DELETE ON note_blocks BEGIN
+			DELETE FROM note_blocks_fts WHERE rowid = old.id;
+		END`,
+	}
+	for _, trigger := range triggers {
+		if err := db.Exec(trigger).Error; err != nil {
+			return fmt.Errorf("failed to create trigger for note_blocks_fts: %w", err)
+		}
+	}
 	return nil
 }
 
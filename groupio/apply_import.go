@@ -17,6 +17,7 @@ import (
 	"mahresources/archive"
 	"mahresources/download_queue"
 	"mahresources/models"
+	"mahresources/models/database_scopes"
 	"mahresources/models/types"
 )
 
@@ -280,10 +281,13 @@ func (v *collectBlobVisitor) OnBlob(hash string, body io.Reader, size int64) err
 		return fmt.Errorf("create blob %s: %w", hash, err)
 	}
 	_, copyErr := io.Copy(f, body)
-	f.Close()
+	closeErr := f.Close()
 	if copyErr != nil {
 		return fmt.Errorf("write blob %s: %w", hash, copyErr)
 	}
+	if closeErr != nil {
+		return fmt.Errorf("close blob %s: %w", hash, closeErr)
+	}
 	return nil
 }
 
@@ -1333,7 +1337,7 @@ func (s *applyState) applyOneResource(tx *gorm.DB, exportID string, rp *archive.
 	// (a) Skip-on-hash collision
 	if rp.Hash != "" {
 		var existing models.Resource
-		if err := tx.Where("hash = ?", rp.Hash).First(&existing).Error; err == nil {
+		if err := tx.Scopes(database_scopes.ContentHashMatch("", rp.Hash, rp.LegacyHash)).First(&existing).Error; err == nil {
 			if s.decisions.ResourceCollisionPolicy == "skip" {
 				s.idMap[exportID] = existing.ID
 				s.skippedM2M[exportID] = true
@@ -1348,7 +1352,7 @@ func (s *applyState) applyOneResource(tx *gorm.DB, exportID string, rp *archive.
 	if rp.BlobMissing || (rp.BlobRef == "" && rp.Hash != "") {
 		// Check if hash exists on destination
 		var existing models.Resource
-		if err := tx.Where("hash = ?", rp.Hash).First(&existing).Error; err == nil {
+		if err := tx.Scopes(database_scopes.ContentHashMatch("", rp.Hash, rp.LegacyHash)).First(&existing).Error; err == nil {
 			// Reuse existing
 			s.idMap[exportID] = existing.ID
 			s.skippedM2M[exportID] = true
@@ -1375,6 +1379,7 @@ func (s *applyState) applyOneResource(tx *gorm.DB, exportID string, rp *archive.
 		OriginalLocation: rp.OriginalLocation,
 		Hash:             rp.Hash,
 		HashType:         rp.HashType,
+		LegacyHash:       rp.LegacyHash,
 		Location:         loc,
 		Description:      rp.Description,
 		Width:            rp.Width,
@@ -1435,6 +1440,12 @@ func (s *applyState) applyOneResource(tx *gorm.DB, exportID string, rp *archive.
 		return fmt.Errorf("create resource: %w", err)
 	}
 
+	// Checked once the row exists, so the quota is the creator's the row
+	// was stamped with; a refusal rolls the batch back.
+	if err := s.ctx.checkStorageQuota(tx, r.CreatedByUserId, r.OwnerId, payloadBlobs(rp), 1); err != nil {
+		return err
+	}
+
 	s.idMap[exportID] = r.ID
 	s.createdResourceIDs[exportID] = true
 	batch.createdResources++
@@ -1452,6 +1463,7 @@ func (s *applyState) applyOneResource(tx *gorm.DB, exportID string, rp *archive.
 			VersionNumber: vp.VersionNumber,
 			Hash:          vp.Hash,
 			HashType:      vp.HashType,
+			LegacyHash:    vp.LegacyHash,
 			FileSize:      vp.FileSize,
 			ContentType:   vp.ContentType,
 			Width:         vp.Width,
@@ -1476,6 +1488,10 @@ func (s *applyState) applyOneResource(tx *gorm.DB, exportID string, rp *archive.
 		}
 	}
 
+	if err := s.ctx.refreshStorageUsage(tx, r.ID); err != nil {
+		return err
+	}
+
 	// (f) Previews
 	for _, pp := range rp.Previews {
 		data, ok := s.previewData[pp.PreviewExportID]
@@ -1500,6 +1516,16 @@ func (s *applyState) applyOneResource(tx *gorm.DB, exportID string, rp *archive.
 	return nil
 }
 
+// payloadBlobs lists the files a resource payload stores, by quota blob key.
+func payloadBlobs(rp *archive.ResourcePayload) map[string]int64 {
+	blobs := map[string]int64{models.QuotaBlobKey(rp.Hash, rp.HashType, rp.LegacyHash): rp.FileSize}
+	for _, vp := range rp.Versions {
+		key := models.QuotaBlobKey(vp.Hash, vp.HashType, vp.LegacyHash)
+		blobs[key] = max(blobs[key], vp.FileSize)
+	}
+	return blobs
+}
+
 // resolveResourceCategoryID resolves the resource category for a resource payload.
 // Tries ResourceCategoryRef -> idMap, then ResourceCategoryName -> DecisionKeyFor -> idMap,
 // fallback to 1.
@@ -1575,7 +1601,7 @@ func (s *applyState) mergeResource(tx *gorm.DB, existing *models.Resource, rp *a
 	// NOT updated — stays in sync with kept blob.
 
 	// Blob-coupled fields (Hash, Location, etc.): NOT updated.
-	if rp.Hash != "" && rp.Hash != existing.Hash {
+	if rp.Hash != "" && !existing.HasContentHash(rp.Hash) && !existing.HasContentHash(rp.LegacyHash) {
 		s.result.Warnings = append(s.result.Warnings,
 			fmt.Sprintf("Resource %q: GUID merge kept existing blob (hash %s), incoming has different hash %s", rp.Name, existing.Hash, rp.Hash))
 	}
@@ -1583,6 +1609,9 @@ func (s *applyState) mergeResource(tx *gorm.DB, existing *models.Resource, rp *a
 	if err := tx.Model(existing).Updates(updates).Error; err != nil {
 		return err
 	}
+	if err := s.ctx.refreshStorageUsage(tx, existing.ID); err != nil {
+		return err
+	}
 
 	// M2M: union tags
 	for _, tr := range rp.Tags {
@@ -1647,9 +1676,18 @@ func (s *applyState) replaceResource(tx *gorm.DB, existing *models.Resource, rp
 	}
 
 	if hasBlobInArchive {
+		ownerID := existing.OwnerId
+		if id, ok := updates["owner_id"].(uint); ok {
+			ownerID = &id
+		}
+		if err := s.ctx.checkStorageQuota(tx, existing.CreatedByUserId, ownerID, payloadBlobs(rp), 0); err != nil {
+			return err
+		}
+
 		// Full replace: blob-derived metadata + blob-coupled fields
 		updates["hash"] = rp.Hash
 		updates["hash_type"] = rp.HashType
+		updates["legacy_hash"] = rp.LegacyHash
 		updates["file_size"] = rp.FileSize
 		updates["content_type"] = rp.ContentType
 		updates["content_category"] = rp.ContentCategory
@@ -1688,6 +1726,7 @@ func (s *applyState) replaceResource(tx *gorm.DB, existing *models.Resource, rp
 				VersionNumber: vp.VersionNumber,
 				Hash:          vp.Hash,
 				HashType:      vp.HashType,
+				LegacyHash:    vp.LegacyHash,
 				FileSize:      vp.FileSize,
 				ContentType:   vp.ContentType,
 				Width:         vp.Width,
@@ -1740,6 +1779,9 @@ func (s *applyState) replaceResource(tx *gorm.DB, existing *models.Resource, rp
 	if err := tx.Model(existing).Updates(updates).Error; err != nil {
 		return err
 	}
+	if err := s.ctx.refreshStorageUsage(tx, existing.ID); err != nil {
+		return err
+	}
 
 	// M2M: clear existing, set incoming
 	tx.Exec("DELETE FROM resource_tags WHERE resource_id = ?", existing.ID)
@@ -1651,6 +1651,7 @@ func (ctx *opCtx) loadResourcePayload(
 		OriginalLocation: r.OriginalLocation,
 		Hash:             r.Hash,
 		HashType:         r.HashType,
+		LegacyHash:       r.LegacyHash,
 		FileSize:         r.FileSize,
 		ContentType:      r.ContentType,
 		ContentCategory:  r.ContentCategory,
@@ -1745,6 +1746,7 @@ func (ctx *opCtx) loadResourcePayload(
 				VersionNumber:   v.VersionNumber,
 				Hash:            v.Hash,
 				HashType:        v.HashType,
+				LegacyHash:      v.LegacyHash,
 				FileSize:        v.FileSize,
 				ContentType:     v.ContentType,
 				Width:           v.Width,
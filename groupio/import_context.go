@@ -12,6 +12,7 @@ import (
 	"gorm.io/gorm"
 	"mahresources/archive"
 	"mahresources/models"
+	"mahresources/models/database_scopes"
 )
 
 // ParseImport reads the tar at tarPath, walks its entries to collect groups,
@@ -753,7 +754,7 @@ func (ctx *opCtx) countHashConflicts(resources map[string]*archive.ResourcePaylo
 			continue
 		}
 		var existing int64
-		ctx.db.Model(&models.Resource{}).Where("hash = ?", rp.Hash).Count(&existing)
+		ctx.db.Model(&models.Resource{}).Scopes(database_scopes.ContentHashMatch("", rp.Hash, rp.LegacyHash)).Count(&existing)
 		if existing > 0 {
 			count++
 		}
@@ -60,12 +60,27 @@ type ScopeResolver interface {
 	VisibleGroupIDs(ids []uint) map[uint]bool
 }
 
+// StorageAccountant keeps storage quotas: it refuses what would take a user or
+// a group subtree past its quota, and charges what an import stored. Like
+// ScopeResolver it reads the caller's context, but it works on whichever
+// handle it is given, so charges land in the import's transaction.
+type StorageAccountant interface {
+	// CheckStorageQuota refuses storing blobs (quota blob key → size) and
+	// newResources more resources for the user and under the owner group.
+	CheckStorageQuota(db *gorm.DB, userID, ownerID *uint, blobs map[string]int64, newResources int64) error
+	// RefreshStorageUsage recharges resources for their current files and owner.
+	RefreshStorageUsage(db *gorm.DB, resourceIDs ...uint) error
+}
+
 // Deps is the per-call input. Rebuild it for every call — never cache one — so
 // that a transactional or principal-derived handle is picked up rather than the
 // handle that happened to be current when the Service was built.
 type Deps struct {
 	DB    *gorm.DB      // carries transaction membership, subtree scope, and actor
 	Scope ScopeResolver // the principal-derived bits the handle cannot carry
+	// Storage keeps storage quotas on import. Nil skips quota checks and
+	// usage accounting.
+	Storage StorageAccountant
 }
 
 // opCtx binds the immutable Service to one call's Deps. It exists for exactly
@@ -73,14 +88,33 @@ type Deps struct {
 // impossible: there is nowhere durable to capture it to.
 type opCtx struct {
 	*Service
-	db    *gorm.DB
-	scope ScopeResolver
+	db      *gorm.DB
+	scope   ScopeResolver
+	storage StorageAccountant
 }
 
 // op builds the per-call binding. Scope must be non-nil; the export planner and
 // the import applier both consult it.
 func (s *Service) op(d Deps) *opCtx {
-	return &opCtx{Service: s, db: d.DB, scope: d.Scope}
+	return &opCtx{Service: s, db: d.DB, scope: d.Scope, storage: d.Storage}
+}
+
+// checkStorageQuota is StorageAccountant.CheckStorageQuota, or nothing when
+// the caller keeps no quotas.
+func (ctx *opCtx) checkStorageQuota(db *gorm.DB, userID, ownerID *uint, blobs map[string]int64, newResources int64) error {
+	if ctx.storage == nil {
+		return nil
+	}
+	return ctx.storage.CheckStorageQuota(db, userID, ownerID, blobs, newResources)
+}
+
+// refreshStorageUsage is StorageAccountant.RefreshStorageUsage, or nothing
+// when the caller keeps no quotas.
+func (ctx *opCtx) refreshStorageUsage(db *gorm.DB, resourceIDs ...uint) error {
+	if ctx.storage == nil {
+		return nil
+	}
+	return ctx.storage.RefreshStorageUsage(db, resourceIDs...)
 }
 
 // --- Public entry points ---
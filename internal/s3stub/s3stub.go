@@ -0,0 +1,353 @@
+// Package s3stub is an in-memory stand-in for the part of the S3 API that
+// storage.S3Fs uses, for tests. It serves path-style requests for any bucket
+// and does not check signatures.
+package s3stub
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Request is one request the server received.
+type Request struct {
+	Method string
+	Bucket string
+	Key    string
+	Query  url.Values
+	Range  string
+}
+
+type object struct {
+	data    []byte
+	modTime time.Time
+}
+
+type upload struct {
+	bucket, key string
+	parts       map[int][]byte
+}
+
+// Server is a running stand-in. Close it when done.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	objects  map[string]object // by bucket + "/" + key
+	uploads  map[string]*upload
+	requests []Request
+	nextID   int
+}
+
+// New starts a stand-in with no objects.
+func New() *Server {
+	s := &Server{objects: map[string]object{}, uploads: map[string]*upload{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Location is the storage location of prefix in bucket on this server.
+func (s *Server) Location(bucket, prefix string) string {
+	return fmt.Sprintf("s3://%s/%s?endpoint=%s&path-style=true", bucket, prefix, url.QueryEscape(s.URL))
+}
+
+// Requests returns the requests received so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// Object returns the stored bytes of key in bucket.
+func (s *Server) Object(bucket, key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, ok := s.objects[bucket+"/"+key]
+	return obj.data, ok
+}
+
+// Keys lists the keys stored in bucket, sorted.
+func (s *Server) Keys(bucket string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	for k := range s.objects {
+		if key, ok := strings.CutPrefix(k, bucket+"/"); ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Uploads counts the multipart uploads started but not completed or aborted.
+func (s *Server) Uploads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.uploads)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	query := r.URL.Query()
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, Request{Method: r.Method, Bucket: bucket, Key: key, Query: query, Range: r.Header.Get("Range")})
+
+	switch {
+	case key == "" && r.Method == http.MethodGet:
+		s.list(w, bucket, query)
+	case r.Method == http.MethodHead:
+		obj, ok := s.objects[bucket+"/"+key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeObjectHeaders(w, obj)
+		w.Header().Set("Content-Length", strconv.Itoa(len(obj.data)))
+	case r.Method == http.MethodGet:
+		s.get(w, r, bucket+"/"+key)
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		u, ok := s.uploads[query.Get("uploadId")]
+		number, err := strconv.Atoi(query.Get("partNumber"))
+		if !ok || err != nil || number < 1 {
+			writeError(w, http.StatusNotFound, "NoSuchUpload", "unknown upload or part")
+			return
+		}
+		u.parts[number] = body
+		w.Header().Set("ETag", etag(body))
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		source, _ := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+		obj, ok := s.objects[strings.TrimPrefix(source, "/")]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchKey", "copy source does not exist")
+			return
+		}
+		s.objects[bucket+"/"+key] = object{data: obj.data, modTime: time.Now()}
+		writeXML(w, struct {
+			XMLName xml.Name `xml:"CopyObjectResult"`
+			ETag    string
+		}{ETag: etag(obj.data)})
+	case r.Method == http.MethodPut:
+		s.objects[bucket+"/"+key] = object{data: body, modTime: time.Now()}
+		w.Header().Set("ETag", etag(body))
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		s.nextID++
+		id := strconv.Itoa(s.nextID)
+		s.uploads[id] = &upload{bucket: bucket, key: key, parts: map[int][]byte{}}
+		writeXML(w, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			Bucket   string
+			Key      string
+			UploadId string
+		}{Bucket: bucket, Key: key, UploadId: id})
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		s.complete(w, query.Get("uploadId"), body)
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(s.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodDelete:
+		delete(s.objects, bucket+"/"+key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusNotImplemented, "NotImplemented", r.Method+" is not supported by the stand-in")
+	}
+}
+
+func (s *Server) get(w http.ResponseWriter, r *http.Request, id string) {
+	obj, ok := s.objects[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+		return
+	}
+	writeObjectHeaders(w, obj)
+	spec := r.Header.Get("Range")
+	if spec == "" {
+		_, _ = w.Write(obj.data)
+		return
+	}
+	size := int64(len(obj.data))
+	first, last, ok := strings.Cut(strings.TrimPrefix(spec, "bytes="), "-")
+	start, err := strconv.ParseInt(first, 10, 64)
+	end := size - 1
+	if ok && last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+	}
+	if err != nil || !ok || start >= size || end < start {
+		writeError(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "The requested range is not satisfiable")
+		return
+	}
+	end = min(end, size-1)
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+	w.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+	w.WriteHeader(http.StatusPartialContent)
+	_, _ = w.Write(obj.data[start : end+1])
+}
+
+func (s *Server) complete(w http.ResponseWriter, id string, body []byte) {
+	u, ok := s.uploads[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchUpload", "unknown upload")
+		return
+	}
+	var request struct {
+		Parts []struct {
+			PartNumber int
+			ETag       string
+		} `xml:"Part"`
+	}
+	if err := xml.Unmarshal(body, &request); err != nil || len(request.Parts) == 0 {
+		writeError(w, http.StatusBadRequest, "MalformedXML", "no parts to complete")
+		return
+	}
+	var data []byte
+	for i, part := range request.Parts {
+		stored, ok := u.parts[part.PartNumber]
+		if !ok || part.PartNumber != i+1 || part.ETag != etag(stored) {
+			// S3 reports this in a 200 response, which clients must check for.
+			writeXML(w, struct {
+				XMLName xml.Name `xml:"Error"`
+				Code    string
+				Message string
+			}{Code: "InvalidPart", Message: fmt.Sprintf("part %d was not uploaded as listed", part.PartNumber)})
+			return
+		}
+		data = append(data, stored...)
+	}
+	s.objects[u.bucket+"/"+u.key] = object{data: data, modTime: time.Now()}
+	delete(s.uploads, id)
+	writeXML(w, struct {
+		XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		Key     string
+	}{Key: u.key})
+}
+
+// list answers ListObjectsV2. Keys and rolled-up prefixes are paged together
+// in key order; the continuation token is the last entry returned.
+func (s *Server) list(w http.ResponseWriter, bucket string, query url.Values) {
+	prefix, delimiter, after := query.Get("prefix"), query.Get("delimiter"), query.Get("continuation-token")
+	maxKeys := 1000
+	if v := query.Get("max-keys"); v != "" {
+		maxKeys, _ = strconv.Atoi(v)
+	}
+
+	type entry struct {
+		name     string
+		isPrefix bool
+	}
+	var entries []entry
+	seen := map[string]bool{}
+	for id := range s.objects {
+		key, ok := strings.CutPrefix(id, bucket+"/")
+		if !ok || !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				common := key[:len(prefix)+i+len(delimiter)]
+				if !seen[common] {
+					seen[common] = true
+					entries = append(entries, entry{common, true})
+				}
+				continue
+			}
+		}
+		entries = append(entries, entry{key, false})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+
+	type content struct {
+		Key          string
+		LastModified string
+		Size         int
+		ETag         string
+	}
+	type commonPrefix struct {
+		Prefix string
+	}
+	result := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Name                  string
+		Prefix                string
+		KeyCount              int
+		MaxKeys               int
+		IsTruncated           bool
+		NextContinuationToken string `xml:",omitempty"`
+		Contents              []content
+		CommonPrefixes        []commonPrefix
+	}{Name: bucket, Prefix: prefix, MaxKeys: maxKeys}
+	for _, e := range entries {
+		if after != "" && e.name <= after {
+			continue
+		}
+		if result.KeyCount == maxKeys {
+			result.IsTruncated = true
+			break
+		}
+		result.KeyCount++
+		result.NextContinuationToken = e.name
+		if e.isPrefix {
+			result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{e.name})
+			continue
+		}
+		obj := s.objects[bucket+"/"+e.name]
+		result.Contents = append(result.Contents, content{
+			Key:          e.name,
+			LastModified: obj.modTime.UTC().Format("2006-01-02T15:04:05.000Z"),
+			Size:         len(obj.data),
+			ETag:         etag(obj.data),
+		})
+	}
+	if !result.IsTruncated {
+		result.NextContinuationToken = ""
+	}
+	writeXML(w, result)
+}
+
+func etag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func writeObjectHeaders(w http.ResponseWriter, obj object) {
+	w.Header().Set("ETag", etag(obj.data))
+	w.Header().Set("Last-Modified", obj.modTime.UTC().Format(http.TimeFormat))
+	w.Header().Set("Accept-Ranges", "bytes")
+}
+
+func writeXML(w http.ResponseWriter, v any) {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	_, _ = w.Write(append([]byte(xml.Header), data...))
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	data, _ := xml.Marshal(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}{Code: code, Message: message})
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = w.Write(append([]byte(xml.Header), data...))
+}
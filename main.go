@@ -132,7 +132,9 @@ func main() {
 	_ = godotenv.Load(".env")
 
 	// Define flags with environment variables as defaults
-	fileSavePath := flag.String("file-save-path", os.Getenv("FILE_SAVE_PATH"), "Main file storage directory (env: FILE_SAVE_PATH)")
+	fileSavePath := flag.String("file-save-path", os.Getenv("FILE_SAVE_PATH"), "Main file storage directory, or an S3 bucket as s3://bucket/prefix (env: FILE_SAVE_PATH)")
+	encryptionKeyFile := flag.String("encryption-key-file", os.Getenv("ENCRYPTION_KEY_FILE"), "File holding the master key (32 bytes as hex or base64) that encrypts stored files; ENCRYPTION_KEY may hold the key itself instead. Unset leaves files in the clear (env: ENCRYPTION_KEY_FILE)")
+	encryptionPreviousKeyFiles := flag.String("encryption-previous-key-files", os.Getenv("ENCRYPTION_PREVIOUS_KEY_FILES"), "Comma-separated files holding earlier master keys, still accepted for reading until a key rotation re-wraps their files; ENCRYPTION_PREVIOUS_KEYS may hold the keys themselves (env: ENCRYPTION_PREVIOUS_KEY_FILES)")
 	dbType := flag.String("db-type", os.Getenv("DB_TYPE"), "Database type: SQLITE or POSTGRES (env: DB_TYPE)")
 	dbDsn := flag.String("db-dsn", os.Getenv("DB_DSN"), "Database connection string (env: DB_DSN)")
 	dbReadOnlyDsn := flag.String("db-readonly-dsn", os.Getenv("DB_READONLY_DSN"), "Read-only database connection string (env: DB_READONLY_DSN)")
@@ -141,6 +143,7 @@ func main() {
 	bindAddress := flag.String("bind-address", os.Getenv("BIND_ADDRESS"), "Server bind address:port (env: BIND_ADDRESS)")
 	ffmpegPath := flag.String("ffmpeg-path", os.Getenv("FFMPEG_PATH"), "Path to ffmpeg binary for video thumbnails (env: FFMPEG_PATH)")
 	libreOfficePath := flag.String("libreoffice-path", os.Getenv("LIBREOFFICE_PATH"), "Path to LibreOffice binary for office document thumbnails (env: LIBREOFFICE_PATH)")
+	pdfRendererPath := flag.String("pdf-renderer", os.Getenv("PDF_RENDERER"), "Path to pdftoppm or mutool for PDF thumbnails, page counts and text; empty looks for either in PATH (env: PDF_RENDERER)")
 	skipFTS := flag.Bool("skip-fts", os.Getenv("SKIP_FTS") == "1", "Skip Full-Text Search initialization (env: SKIP_FTS=1)")
 	skipVersionMigration := flag.Bool("skip-version-migration", os.Getenv("SKIP_VERSION_MIGRATION") == "1", "Skip resource version migration at startup (env: SKIP_VERSION_MIGRATION=1)")
 	skipBlockRefCleanup := flag.Bool("skip-block-ref-cleanup", os.Getenv("SKIP_BLOCK_REF_CLEANUP") == "1", "Skip one-shot cleanup of dangling references in note_blocks (env: SKIP_BLOCK_REF_CLEANUP=1)")
@@ -182,13 +185,23 @@ func main() {
 	// Thumbnail worker options
 	thumbWorkerCount := flag.Int("thumb-worker-count", parseIntEnv("THUMB_WORKER_COUNT", 2), "Number of concurrent thumbnail generation workers (env: THUMB_WORKER_COUNT)")
 	thumbWorkerDisabled := flag.Bool("thumb-worker-disabled", os.Getenv("THUMB_WORKER_DISABLED") == "1", "Disable thumbnail worker (env: THUMB_WORKER_DISABLED=1)")
-	thumbBatchSize := flag.Int("thumb-batch-size", parseIntEnv("THUMB_BATCH_SIZE", 10), "Videos to process per backfill cycle (env: THUMB_BATCH_SIZE)")
+	thumbBatchSize := flag.Int("thumb-batch-size", parseIntEnv("THUMB_BATCH_SIZE", 10), "Videos and PDFs to process per backfill cycle (env: THUMB_BATCH_SIZE)")
 	thumbPollInterval := flag.Duration("thumb-poll-interval", parseDurationEnv("THUMB_POLL_INTERVAL", time.Minute), "Time between backfill processing cycles (env: THUMB_POLL_INTERVAL)")
-	thumbBackfill := flag.Bool("thumb-backfill", os.Getenv("THUMB_BACKFILL") == "1", "Enable backfilling thumbnails for existing videos (env: THUMB_BACKFILL=1)")
+	thumbBackfill := flag.Bool("thumb-backfill", os.Getenv("THUMB_BACKFILL") == "1", "Enable backfilling thumbnails for existing videos and PDFs (env: THUMB_BACKFILL=1)")
 
 	// Alternative file systems: can be specified multiple times as -alt-fs=key:path
 	var altFSFlags altFS
-	flag.Var(&altFSFlags, "alt-fs", "Alternative file system in format key:path (can be specified multiple times)")
+	flag.Var(&altFSFlags, "alt-fs", "Alternative file system in format key:path, where path may be s3://bucket/prefix (can be specified multiple times)")
+
+	// Storage tiering: rules can be specified multiple times as -tier-rule=target:query
+	var tierRuleFlags altFS
+	flag.Var(&tierRuleFlags, "tier-rule", "Storage tiering rule in format target:query, moving the resources the MRQL filter matches to the alt file system target; rules are tried in order (can be specified multiple times)")
+	tierInterval := flag.Duration("tier-interval", parseDurationEnv("TIER_INTERVAL", application_context.DefaultStorageTierInterval), "How often the storage tiering rules are applied; 0 applies them only when asked (env: TIER_INTERVAL)")
+	resumableUploadExpiry := flag.Duration("resumable-upload-expiry", parseDurationEnv("RESUMABLE_UPLOAD_EXPIRY", application_context.DefaultResumableUploadExpiry), "How long an unfinished resumable upload is kept after its last chunk (env: RESUMABLE_UPLOAD_EXPIRY)")
+	expandMaxEntries := flag.Int("expand-max-entries", parseIntEnv("EXPAND_MAX_ENTRIES", application_context.DefaultArchiveExpandMaxEntries), "Maximum entries in an archive expanded into a group on upload (env: EXPAND_MAX_ENTRIES)")
+	expandMaxSize := flag.Int64("expand-max-size", parseInt64Env("EXPAND_MAX_SIZE", application_context.DefaultArchiveExpandMaxSize), "Maximum unpacked size in bytes of an archive expanded into a group on upload (default: 10 GB, env: EXPAND_MAX_SIZE)")
+	watchInterval := flag.Duration("watch-interval", parseDurationEnv("WATCH_INTERVAL", application_context.DefaultWatchFolderInterval), "How often the watch folders are polled for new, changed and removed files; 0 scans them only when asked (env: WATCH_INTERVAL)")
+	watchSettle := flag.Duration("watch-settle", parseDurationEnv("WATCH_SETTLE", application_context.DefaultWatchFolderSettle), "How long a file in a watch folder must go unmodified before it is ingested (env: WATCH_SETTLE)")
 
 	// Remote resource timeout options
 	remoteConnectTimeout := flag.Duration("remote-connect-timeout", parseDurationEnv("REMOTE_CONNECT_TIMEOUT", 30*time.Second), "Timeout for connecting to remote URLs (env: REMOTE_CONNECT_TIMEOUT)")
@@ -208,6 +221,7 @@ func main() {
 	// MRQL options
 	mrqlTimeout := flag.Duration("mrql-query-timeout", parseDurationEnv("MRQL_QUERY_TIMEOUT", 10*time.Second), "Maximum execution time for MRQL queries (env: MRQL_QUERY_TIMEOUT)")
 	mrqlDefaultLimit := flag.Int("mrql-default-limit", parseIntEnv("MRQL_DEFAULT_LIMIT", 500), "Default LIMIT applied to MRQL queries without an explicit LIMIT clause (env: MRQL_DEFAULT_LIMIT)")
+	mrqlMaterializeTick := flag.Duration("mrql-materialize-tick", parseDurationEnv("MRQL_MATERIALIZE_TICK", application_context.DefaultMRQLMaterializeTick), "How often materialized saved MRQL queries are checked for a due refresh (env: MRQL_MATERIALIZE_TICK)")
 	mrqlPageQueryBudget := flag.Int("mrql-page-query-budget", parseIntEnv("MRQL_PAGE_QUERY_BUDGET", 200), "Maximum distinct MRQL queries a single page render may execute via inline [mrql] shortcodes; 0 disables (env: MRQL_PAGE_QUERY_BUDGET)")
 
 	// Plugin options
@@ -277,6 +291,46 @@ func main() {
 	useMemoryDB := *memoryDB || *ephemeral
 	useMemoryFS := *memoryFS || *ephemeral
 
+	// An S3 location that does not parse would fail every file operation;
+	// refuse it here instead.
+	if err := storage.ValidateLocation(*fileSavePath); err != nil {
+		log.Fatalf("invalid -file-save-path: %v", err)
+	}
+	for key, path := range altFileSystems {
+		if err := storage.ValidateLocation(path); err != nil {
+			log.Fatalf("invalid -alt-fs %s: %v", key, err)
+		}
+	}
+
+	// Tiering rules from flags or, like alt file systems, from env vars
+	var tierRules []application_context.StorageTierRule
+	if len(tierRuleFlags) == 0 {
+		if count, err := strconv.Atoi(os.Getenv("TIER_RULE_COUNT")); err == nil {
+			for i := 1; i <= count; i++ {
+				target := os.Getenv(fmt.Sprintf("TIER_RULE_TARGET_%d", i))
+				query := os.Getenv(fmt.Sprintf("TIER_RULE_QUERY_%d", i))
+				if target != "" || query != "" {
+					tierRuleFlags = append(tierRuleFlags, target+":"+query)
+				}
+			}
+		}
+	}
+	for _, value := range tierRuleFlags {
+		rule, err := application_context.ParseStorageTierRule(value)
+		if err != nil {
+			log.Fatalf("Invalid -tier-rule: %v", err)
+		}
+		tierRules = append(tierRules, rule)
+	}
+
+	// Keys themselves are only read from the environment, like S3 credentials,
+	// so that they do not show up in the process list.
+	encryptionKeys, err := storage.LoadKeyRing(*encryptionKeyFile, os.Getenv("ENCRYPTION_KEY"),
+		splitCommaList(*encryptionPreviousKeyFiles), splitCommaList(os.Getenv("ENCRYPTION_PREVIOUS_KEYS")))
+	if err != nil {
+		log.Fatalf("invalid encryption key: %v", err)
+	}
+
 	// Parsed here to fail startup on a bad entry, rather than at first fetch on
 	// a background worker where the operator would learn about it from a failed
 	// download. The context builds the policy again from these strings — this
@@ -302,7 +356,9 @@ func main() {
 		DocsLinksDisabled:            *docsLinksDisabled,
 		FfmpegPath:                   *ffmpegPath,
 		LibreOfficePath:              *libreOfficePath,
+		PdfRendererPath:              *pdfRendererPath,
 		AltFileSystems:               altFileSystems,
+		EncryptionKeys:               encryptionKeys,
 		MemoryDB:                     useMemoryDB,
 		MemoryFS:                     useMemoryFS,
 		SeedDB:                       *seedDB,
@@ -332,6 +388,14 @@ func main() {
 		DownloadHistoryRetention:     *downloadHistoryRetention,
 		DownloadCockpitLimit:         *downloadCockpitLimit,
 		PluginScheduleTick:           *pluginScheduleTick,
+		MRQLMaterializeTick:          *mrqlMaterializeTick,
+		StorageTierRules:             tierRules,
+		StorageTierInterval:          *tierInterval,
+		ResumableUploadExpiry:        *resumableUploadExpiry,
+		ArchiveExpandMaxEntries:      *expandMaxEntries,
+		ArchiveExpandMaxSize:         *expandMaxSize,
+		WatchFolderInterval:          *watchInterval,
+		WatchFolderSettle:            *watchSettle,
 		MaxImportSize:                *maxImportSize,
 		MaxUploadSize:                *maxUploadSize,
 		MaxJSONBodySize:              *maxJSONBody,
@@ -443,15 +507,34 @@ func main() {
 		&models.PluginKV{},
 		&models.RuntimeSetting{},
 		&models.SavedMRQLQuery{},
+		&models.MRQLMaterialization{},
 		&models.TemplatePartial{},
 		&models.DownloadHistoryEntry{},
 		// No FK association either; plugin_name/schedule_id is its own key and
 		// created_by_user_id is a scalar.
 		&models.PluginSchedule{}, // no FK association; created_by_user_id is a scalar
+		// The scrubber's entity IDs are scalars too, so a deleted entity leaves
+		// its issue behind for the report.
+		&models.BlobIntegrityIssue{},
+		&models.BlobScrubRun{},
+		&models.BlobGCRun{},
+		&models.ContentHashMigrationRun{},
+		&models.EncryptionRotationRun{},
+		&models.StorageTierRun{},
+		&models.ResumableUpload{},
+		&models.StorageQuota{},
+		&models.StorageUsage{},
+		&models.StorageUsageBlob{},
+		&models.StorageCharge{},
+		&models.ArchiveExpansion{},
 		// Tables with FK to independent tables
 		&models.Group{},             // FK to Category (self-referencing Owner is handled by GORM)
 		&models.GroupRelationType{}, // FK to Category
 		&models.Resource{},          // FK to ResourceCategory, Series, Group
+		&models.ResourceView{},      // FK to Resource
+		&models.StorageTierPin{},    // FK to Resource
+		&models.WatchFolder{},       // FK to Group
+		&models.WatchedFile{},       // FK to WatchFolder
 		&models.User{},              // FK to Group (ScopeGroupId)
 		&models.UserSetting{},       // per-user KV prefs; no FK association (like PluginKV)
 		// Tables with FK to Resource/Group/Note
@@ -462,6 +545,7 @@ func main() {
 		&models.GroupRelation{},      // FK to Group, GroupRelationType
 		&models.ImageHash{},          // FK to Resource
 		&models.ResourceSimilarity{}, // FK to Resource
+		&models.ResourceText{},       // FK to Resource
 		&models.Session{},            // FK to User
 		&models.ApiToken{},           // FK to User
 	); err != nil {
@@ -576,6 +660,12 @@ func main() {
 	if err := models.EnsureSupplementalIndexes(db); err != nil {
 		log.Fatalf("Error when creating supplemental indexes: %v", err)
 	}
+	if err := models.EnsureNoteBlockSearch(db); err != nil {
+		log.Fatalf("Error when creating note block search triggers: %v", err)
+	}
+	if err := models.EnsureEntityHistory(db); err != nil {
+		log.Fatalf("Error when creating entity history triggers: %v", err)
+	}
 
 	// Migrate existing resources to versioning system in background (skip with -skip-version-migration flag)
 	if !*skipVersionMigration {
@@ -594,6 +684,16 @@ func main() {
 		log.Println("Version migration skipped (-skip-version-migration flag or SKIP_VERSION_MIGRATION=1)")
 	}
 
+	// Charge every resource that predates storage quotas. Resources charge
+	// themselves from here on, so this only does work once.
+	go func() {
+		if count, err := context.BackfillStorageUsage(); err != nil {
+			log.Printf("Warning: failed to count storage usage: %v", err)
+		} else if count > 0 {
+			log.Printf("Counted the storage usage of %d resources", count)
+		}
+	}()
+
 	// One-shot cleanup of dangling block references (BH-020 — skip with -skip-block-ref-cleanup flag)
 	if !*skipBlockRefCleanup {
 		go func() {
@@ -639,7 +739,7 @@ func main() {
 	// Build alt filesystems map for hash worker
 	altFsMap := make(map[string]afero.Fs)
 	for name, path := range context.Config.AltFileSystems {
-		altFsMap[name] = storage.CreateStorage(path)
+		altFsMap[name] = storage.Encrypt(storage.CreateStorage(path), context.Config.EncryptionKeys)
 	}
 
 	hw := hash_worker.New(db, mainFs, altFsMap, hashWorkerConfig, context.Logger())
@@ -648,7 +748,7 @@ func main() {
 	defer hw.Stop()
 	defer context.DownloadManager().Shutdown()
 
-	// Start thumbnail worker for background video thumbnail pre-generation
+	// Start thumbnail worker for background video and PDF thumbnail pre-generation
 	thumbWorkerConfig := thumbnail_worker.Config{
 		WorkerCount:  *thumbWorkerCount,
 		BatchSize:    *thumbBatchSize,
@@ -683,6 +783,34 @@ func main() {
 	// construction; it is the same shape as the two worker queues above.
 	context.SetPluginScheduler(scheduler)
 
+	// Refreshes materialized saved MRQL queries in the background, so a reader
+	// usually finds a current result instead of paying for the refresh itself.
+	// A reader that does find a stale one still refreshes it on the spot.
+	materializer := application_context.NewMRQLMaterializer(context, cfg.MRQLMaterializeTick)
+	materializer.Start()
+	defer materializer.Stop()
+
+	// Moves cold resources to the filesystems the tiering rules name. A rule
+	// that cannot run, for a filesystem that is not attached or a filter that
+	// does not parse, stops startup instead of failing every run.
+	if err := context.ValidateStorageTierRules(); err != nil {
+		log.Fatalf("invalid storage tiering rules: %v", err)
+	}
+	if len(cfg.StorageTierRules) > 0 && cfg.StorageTierInterval > 0 {
+		tierScheduler := application_context.NewStorageTierScheduler(context, cfg.StorageTierInterval)
+		tierScheduler.Start()
+		defer tierScheduler.Stop()
+	}
+
+	// Polls the watch folders for new, changed and removed files. A scan is
+	// submitted only for a folder with something to ingest, so an idle folder
+	// does not fill the jobs panel.
+	if cfg.WatchFolderInterval > 0 {
+		watchScheduler := application_context.NewWatchFolderScheduler(context, cfg.WatchFolderInterval)
+		watchScheduler.Start()
+		defer watchScheduler.Stop()
+	}
+
 	// Terminal job events for mah.on. Started here rather than in the context
 	// for the same reason the scheduler is: it owns a goroutine, so the place
 	// that can defer its Stop is the place that starts it. Stop is bounded, so a
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"mahresources/models/types"
+)
+
+// ArchiveExpansion is one zip or tar upload being unpacked into a new group:
+// a subgroup for each directory in it and a resource for each file.
+type ArchiveExpansion struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	StartedAt time.Time `json:"startedAt"`
+	// FinishedAt stays nil while the archive is being unpacked, and for one
+	// the server stopped during.
+	FinishedAt *time.Time `json:"finishedAt"`
+	// OwnerUserID is the user who uploaded the archive, nil with auth
+	// disabled. Only they, or an admin, may see the expansion.
+	OwnerUserID *uint  `gorm:"index" json:"ownerUserId,omitempty"`
+	FileName    string `json:"fileName"`
+	// ParentGroupID is the group the new group is created under, nil for a
+	// top-level group.
+	ParentGroupID *uint `json:"parentGroupId,omitempty"`
+	// GroupID is the new group, set once it is created.
+	GroupID *uint `json:"groupId,omitempty"`
+	// Entries and Bytes count the files in the archive and their size.
+	Entries int64  `json:"entries"`
+	Bytes   int64  `json:"bytes"`
+	Created int64  `json:"created"`
+	Skipped int64  `json:"skipped"`
+	Failed  int64  `json:"failed"`
+	Error   string `json:"error,omitempty"`
+	JobID   string `json:"jobId"`
+	// Report is the JSON-encoded list of entries that were skipped or
+	// failed; its shape is owned by application_context.
+	Report types.JSON `gorm:"type:json" json:"report"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"mahresources/models/types"
+)
+
+// BlobGCRun is one mark-and-sweep of the content-addressed storage: files
+// under /resources/ that no resource or version references are deleted, once
+// they are older than the grace period, and preview rows whose resource is
+// gone are removed. A dry run only lists what would go.
+type BlobGCRun struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	StartedAt time.Time `json:"startedAt"`
+	// FinishedAt stays nil while the run is in progress, and for a run the
+	// server stopped during.
+	FinishedAt *time.Time `json:"finishedAt"`
+	DryRun     bool       `json:"dryRun"`
+	// GracePeriodSeconds protects files younger than it, such as an upload
+	// written to disk whose row is not committed yet.
+	GracePeriodSeconds int64 `json:"gracePeriodSeconds"`
+	// ReclaimedBytes totals files and previews deleted, or that a dry run
+	// would delete, across every filesystem.
+	ReclaimedBytes int64  `json:"reclaimedBytes"`
+	Error          string `json:"error,omitempty"`
+	JobID          string `json:"jobId"`
+	// Report is the JSON-encoded per-filesystem report; its shape is owned by
+	// application_context.
+	Report types.JSON `gorm:"type:json" json:"report"`
+}
@@ -0,0 +1,87 @@
+package models
+
+import "time"
+
+// Problems the blob scrubber records in BlobIntegrityIssue.Problem.
+const (
+	// BlobProblemMissing: the file does not exist, or a preview has no data.
+	BlobProblemMissing = "missing"
+	// BlobProblemTruncated: the file is shorter than the recorded size.
+	BlobProblemTruncated = "truncated"
+	// BlobProblemCorrupted: the file's hash differs from the recorded one, or a
+	// preview does not decode.
+	BlobProblemCorrupted = "corrupted"
+	// BlobProblemUnreadable: opening or reading the file failed for another reason.
+	BlobProblemUnreadable = "unreadable"
+)
+
+// Statuses of a BlobIntegrityIssue.
+const (
+	// BlobStatusQuarantined: the file is damaged and is not served.
+	BlobStatusQuarantined = "quarantined"
+	// BlobStatusRepaired: the file was restored from an intact copy with the
+	// same hash, or, for a preview, the damaged preview was deleted.
+	BlobStatusRepaired = "repaired"
+	// BlobStatusCleared: a later check found the file intact, or its entity
+	// was deleted.
+	BlobStatusCleared = "cleared"
+)
+
+// Entity kinds the blob scrubber walks, in walk order. They are also the
+// values of BlobIntegrityIssue.EntityType and BlobScrubRun.Phase.
+const (
+	BlobEntityResource = "resource"
+	BlobEntityVersion  = "version"
+	BlobEntityPreview  = "preview"
+)
+
+// BlobIntegrityIssue is a damaged file the blob scrubber found, one row per
+// entity. Rows are kept after a repair so the report shows what happened.
+//
+// While Status is quarantined, the file at StorageLocation/Location is refused
+// by every route that serves file bytes rather than handed out damaged.
+type BlobIntegrityIssue struct {
+	ID         uint      `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+	EntityType string    `gorm:"uniqueIndex:idx_blob_issue_entity;not null" json:"entityType"`
+	EntityID   uint      `gorm:"uniqueIndex:idx_blob_issue_entity;not null" json:"entityId"`
+	ResourceID uint      `gorm:"index" json:"resourceId"`
+	// StorageLocation is the alt filesystem key, empty for the main one.
+	// Location uses forward slashes. Both are empty for a preview.
+	StorageLocation string `gorm:"index:idx_blob_issue_file" json:"storageLocation"`
+	Location        string `gorm:"index:idx_blob_issue_file" json:"location"`
+	Problem         string `json:"problem"`
+	Detail          string `json:"detail"`
+	ExpectedHash    string `json:"expectedHash"`
+	ActualHash      string `json:"actualHash"`
+	ExpectedSize    int64  `json:"expectedSize"`
+	ActualSize      int64  `json:"actualSize"`
+	Status          string `gorm:"index;not null" json:"status"`
+	// RepairedFrom names the copy a repaired file was restored from.
+	RepairedFrom string    `json:"repairedFrom,omitempty"`
+	CheckedAt    time.Time `json:"checkedAt"`
+}
+
+// BlobScrubRun is one walk of the blob scrubber and its checkpoint. A run is
+// unfinished until FinishedAt is set; starting a scrub resumes the newest
+// unfinished run after LastID of Phase, so a library too large to check in
+// one go is covered across restarts and cancellations.
+type BlobScrubRun struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	StartedAt time.Time `json:"startedAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	// FinishedAt is set when the walk completes, or when a restart abandons it.
+	FinishedAt *time.Time `json:"finishedAt"`
+	// Repair restores damaged files from intact copies as they are found.
+	Repair bool `json:"repair"`
+	// Phase is the entity kind being walked; LastID the highest ID of it checked.
+	Phase  string `json:"phase"`
+	LastID uint   `json:"lastId"`
+	// Counts over the whole run, resumed sessions included.
+	Checked      int64  `json:"checked"`
+	CheckedBytes int64  `json:"checkedBytes"`
+	Quarantined  int64  `json:"quarantined"`
+	Repaired     int64  `json:"repaired"`
+	JobID        string `json:"jobId"`
+}
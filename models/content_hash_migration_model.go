@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// ContentHashMigrationRun is one pass of the content hash migration, which
+// re-hashes resources and versions still on SHA1 with SHA-256, keeping the
+// SHA1 in LegacyHash. Files are not moved: each row records its own location.
+//
+// Like BlobScrubRun it is a checkpoint: starting a migration resumes the newest
+// unfinished run after LastID of Phase.
+type ContentHashMigrationRun struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	StartedAt time.Time `json:"startedAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	// FinishedAt is set when the pass completes, or when a restart abandons it.
+	FinishedAt *time.Time `json:"finishedAt"`
+	// Phase is BlobEntityResource or BlobEntityVersion; LastID the highest ID
+	// of it handled.
+	Phase  string `json:"phase"`
+	LastID uint   `json:"lastId"`
+	// Counts over the whole run, resumed sessions included. Skipped rows are
+	// left on SHA1: their file is missing, unreadable, or no longer matches
+	// the recorded hash, which the blob scrubber reports. ReadBytes leaves out
+	// rows that reused the hash of an earlier row with the same content.
+	Migrated  int64  `json:"migrated"`
+	ReadBytes int64  `json:"readBytes"`
+	Skipped   int64  `json:"skipped"`
+	JobID     string `json:"jobId"`
+}
@@ -6,6 +6,26 @@ import (
 	"mahresources/models/types"
 )
 
+// ContentHashMatch matches resources or versions whose content is any of the
+// given hashes, under either algorithm: hash holds the SHA-256, or the SHA1 of
+// a row the content hash migration has not reached yet, and legacy_hash the
+// SHA1 of a row hashed with SHA-256. prefix qualifies the columns ("resources."
+// or ""). Empty hashes are ignored; with none left nothing matches.
+func ContentHashMatch(prefix string, hashes ...string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		wanted := make([]string, 0, len(hashes))
+		for _, h := range hashes {
+			if h != "" {
+				wanted = append(wanted, h)
+			}
+		}
+		if len(wanted) == 0 {
+			return db.Where("1 = 0")
+		}
+		return db.Where("("+prefix+"hash IN ? OR "+prefix+"legacy_hash IN ?)", wanted, wanted)
+	}
+}
+
 func ResourceQuery(query *query_models.ResourceSearchQuery, ignoreSort bool, originalDb *gorm.DB) func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
 		likeOperator := GetLikeOperator(db)
@@ -147,7 +167,7 @@ func ResourceQuery(query *query_models.ResourceSearchQuery, ignoreSort bool, ori
 		}
 
 		if query.Hash != "" {
-			dbQuery = dbQuery.Where("resources.hash = ?", query.Hash)
+			dbQuery = dbQuery.Scopes(ContentHashMatch("resources.", query.Hash))
 		}
 
 		dbQuery = ApplyDateRange(dbQuery, "resources.", query.CreatedBefore, query.CreatedAfter)
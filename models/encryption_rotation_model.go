@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// EncryptionRotationRun is one pass of the master key rotation, which brings
+// every stored file onto the current master key: a file wrapped with a
+// previous key gets its file key re-wrapped, and a file stored before
+// encryption was enabled is encrypted.
+type EncryptionRotationRun struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	StartedAt time.Time `json:"startedAt"`
+	// FinishedAt stays nil while the run is in progress, and for a run the
+	// server stopped during.
+	FinishedAt *time.Time `json:"finishedAt"`
+	// KeyID is the ID of the master key the run wrapped files with.
+	KeyID string `json:"keyId"`
+	// Counts across every filesystem. Files already on KeyID are counted as
+	// scanned only; failed ones keep whatever key they had.
+	Scanned   int64  `json:"scanned"`
+	Rewrapped int64  `json:"rewrapped"`
+	Encrypted int64  `json:"encrypted"`
+	Failed    int64  `json:"failed"`
+	Error     string `json:"error,omitempty"`
+	JobID     string `json:"jobId"`
+}
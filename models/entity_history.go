@@ -0,0 +1,260 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// HistoryTable is one table whose rows EnsureEntityHistory records.
+type HistoryTable struct {
+	Name string   // the live table
+	Key  []string // the columns that identify one row
+	// DatedBy is the entity table whose created_at dates a junction row when
+	// history is first backfilled; Key[0] references it. Empty for entities,
+	// which are dated by their own created_at.
+	DatedBy string
+}
+
+// HistoryTables are the tables MRQL's AS OF clause reconstructs: the three
+// entity tables and their tag, group and note memberships. mrql keeps its own
+// copy (mrql.HistoryTables); a test in application_context keeps the two in
+// sync.
+var HistoryTables = []HistoryTable{
+	{Name: "resources", Key: []string{"id"}},
+	{Name: "notes", Key: []string{"id"}},
+	{Name: "groups", Key: []string{"id"}},
+	{Name: "resource_tags", Key: []string{"resource_id", "tag_id"}, DatedBy: "resources"},
+	{Name: "note_tags", Key: []string{"note_id", "tag_id"}, DatedBy: "notes"},
+	{Name: "group_tags", Key: []string{"group_id", "tag_id"}, DatedBy: "groups"},
+	{Name: "groups_related_resources", Key: []string{"resource_id", "group_id"}, DatedBy: "resources"},
+	{Name: "groups_related_notes", Key: []string{"note_id", "group_id"}, DatedBy: "notes"},
+	{Name: "resource_notes", Key: []string{"resource_id", "note_id"}, DatedBy: "resources"},
+}
+
+// HistoryTableName names the append-only history of a live table.
+func HistoryTableName(table string) string {
+	return table + "_history"
+}
+
+// historyNowSQLite is the SQLite history timestamp: UTC with milliseconds,
+// so that history_at compares as text.
+const historyNowSQLite = "strftime('%Y-%m-%d %H:%M:%f', 'now')"
+
+type historyColumn struct {
+	Name string
+	Type string
+}
+
+// EnsureEntityHistory installs the append-only change history behind MRQL's
+// AS OF clause. Every table in HistoryTables gets a <table>_history copy with
+// the same columns plus history_id, history_at and history_removed, and
+// triggers that append the row's new state on insert and update and a removal
+// marker on delete. Triggers rather than model hooks because memberships and
+// fields are also rewritten with raw statements and cascading deletes.
+//
+// The first run backfills each existing row, dated by its created_at (a
+// membership by its entity's), so changes made before history was recorded
+// are folded into the entity's creation. Later runs add columns that
+// migrations added to the live tables. Idempotent; called from main.go after
+// AutoMigrate.
+func EnsureEntityHistory(db *gorm.DB) error {
+	for _, table := range HistoryTables {
+		if err := ensureHistoryTable(db, table); err != nil {
+			return fmt.Errorf("%s history: %w", table.Name, err)
+		}
+	}
+	return nil
+}
+
+func ensureHistoryTable(db *gorm.DB, table HistoryTable) error {
+	postgres := db.Dialector.Name() == "postgres"
+	history := HistoryTableName(table.Name)
+
+	columns, err := historyColumns(db, table.Name)
+	if err != nil {
+		return err
+	}
+	if len(columns) == 0 {
+		return fmt.Errorf("table %s does not exist", table.Name)
+	}
+	existing, err := historyColumns(db, history)
+	if err != nil {
+		return err
+	}
+
+	created := len(existing) == 0
+	if created {
+		defs := make([]string, 0, len(columns)+3)
+		if postgres {
+			defs = append(defs, "history_id BIGSERIAL PRIMARY KEY", "history_at TIMESTAMPTZ NOT NULL", "history_removed BOOLEAN NOT NULL")
+		} else {
+			defs = append(defs, "history_id INTEGER PRIMARY KEY AUTOINCREMENT", "history_at DATETIME NOT NULL", "history_removed BOOLEAN NOT NULL")
+		}
+		for _, c := range columns {
+			defs = append(defs, strings.TrimSpace(quoteHistoryIdent(c.Name)+" "+c.Type))
+		}
+		if err := db.Exec("CREATE TABLE " + history + " (" + strings.Join(defs, ", ") + ")").Error; err != nil {
+			return err
+		}
+	} else {
+		have := make(map[string]bool, len(existing))
+		for _, c := range existing {
+			have[c.Name] = true
+		}
+		for _, c := range columns {
+			if !have[c.Name] {
+				if err := db.Exec(strings.TrimSpace("ALTER TABLE " + history + " ADD COLUMN " + quoteHistoryIdent(c.Name) + " " + c.Type)).Error; err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for _, query := range []string{
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx__%s__key ON %s (%s, history_id)", history, history, strings.Join(table.Key, ", ")),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx__%s__history_at ON %s (history_at)", history, history),
+	} {
+		if err := db.Exec(query).Error; err != nil {
+			return err
+		}
+	}
+
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = quoteHistoryIdent(c.Name)
+	}
+	if created {
+		if err := backfillHistory(db, table, names, postgres); err != nil {
+			return err
+		}
+	}
+	if postgres {
+		return installHistoryTriggerPostgres(db, table, names)
+	}
+	return installHistoryTriggersSQLite(db, table, names)
+}
+
+// historyColumns lists a table's columns and declared types in order; none
+// when the table does not exist. Generated columns are left out: they are
+// derived from the others and cannot be written.
+func historyColumns(db *gorm.DB, table string) ([]historyColumn, error) {
+	var columns []historyColumn
+	query := "SELECT name, type FROM pragma_table_info(?) ORDER BY cid"
+	if db.Dialector.Name() == "postgres" {
+		query = `SELECT a.attname AS name, format_type(a.atttypid, a.atttypmod) AS type FROM pg_attribute a
+			WHERE a.attrelid = to_regclass(?) AND a.attnum > 0 AND NOT a.attisdropped AND a.attgenerated = ''
+			ORDER BY a.attnum`
+	}
+	err := db.Raw(query, table).Scan(&columns).Error
+	return columns, err
+}
+
+func quoteHistoryIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// backfillHistory records the rows a new history table starts from.
+func backfillHistory(db *gorm.DB, table HistoryTable, names []string, postgres bool) error {
+	history := HistoryTableName(table.Name)
+	src := make([]string, len(names))
+	for i, name := range names {
+		src[i] = "t." + name
+	}
+	dated, join := "t.created_at", ""
+	if table.DatedBy != "" {
+		dated = "d.created_at"
+		join = fmt.Sprintf(" JOIN %s d ON d.id = t.%s", table.DatedBy, table.Key[0])
+	}
+	removed := "false"
+	if !postgres {
+		// A row whose created_at does not parse is dated now rather than lost.
+		dated = fmt.Sprintf("COALESCE(strftime('%%Y-%%m-%%d %%H:%%M:%%f', %s), %s)", dated, historyNowSQLite)
+		removed = "0"
+	}
+	return db.Exec(fmt.Sprintf("INSERT INTO %s (history_at, history_removed, %s) SELECT %s, %s, %s FROM %s t%s",
+		history, strings.Join(names, ", "), dated, removed, strings.Join(src, ", "), table.Name, join)).Error
+}
+
+// rowValues prefixes each column with a trigger row alias (new or old).
+func rowValues(alias string, names []string) string {
+	values := make([]string, len(names))
+	for i, name := range names {
+		values[i] = alias + "." + name
+	}
+	return strings.Join(values, ", ")
+}
+
+// installHistoryTriggersSQLite (re)creates the three row triggers, since
+// their column lists follow the live table's. An UPDATE that changes nothing
+// records nothing; one that changes the key also records the old key's
+// removal.
+func installHistoryTriggersSQLite(db *gorm.DB, table HistoryTable, names []string) error {
+	history := HistoryTableName(table.Name)
+	insert := func(removed int, alias string) string {
+		return fmt.Sprintf("INSERT INTO %s (history_at, history_removed, %s) VALUES (%s, %d, %s);",
+			history, strings.Join(names, ", "), historyNowSQLite, removed, rowValues(alias, names))
+	}
+	changed := make([]string, len(names))
+	for i, name := range names {
+		changed[i] = "old." + name + " IS NOT new." + name
+	}
+	keyChanged := make([]string, len(table.Key))
+	for i, key := range table.Key {
+		keyChanged[i] = "old." + key + " IS NOT new." + key
+	}
+	rekey := fmt.Sprintf("INSERT INTO %s (history_at, history_removed, %s) SELECT %s, 1, %s WHERE %s;",
+		history, strings.Join(names, ", "), historyNowSQLite, rowValues("old", names), strings.Join(keyChanged, " OR "))
+
+	for _, query := range []string{
+		"DROP TRIGGER IF EXISTS " + history + "_ai",
+		"DROP TRIGGER IF EXISTS " + history + "_au",
+		"DROP TRIGGER IF EXISTS " + history + "_ad",
+		fmt.Sprintf("CREATE TRIGGER %s_ai AFTER INSERT ON %s BEGIN %s END", history, table.Name, insert(0, "new")),
+		fmt.Sprintf("CREATE TRIGGER %s_au AFTER UPDATE ON %s WHEN %s BEGIN %s %s END", history, table.Name, strings.Join(changed, " OR "), rekey, insert(0, "new")),
+		fmt.Sprintf("CREATE TRIGGER %s_ad AFTER DELETE ON %s BEGIN %s END", history, table.Name, insert(1, "old")),
+	} {
+		if err := db.Exec(query).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// installHistoryTriggerPostgres replaces the trigger function, whose column
+// list follows the live table's, and creates the trigger once. Rows are
+// compared as jsonb because json columns have no equality operator.
+func installHistoryTriggerPostgres(db *gorm.DB, table HistoryTable, names []string) error {
+	history := HistoryTableName(table.Name)
+	oldKey, newKey := make([]string, len(table.Key)), make([]string, len(table.Key))
+	for i, key := range table.Key {
+		oldKey[i], newKey[i] = "OLD."+key, "NEW."+key
+	}
+	columns := strings.Join(names, ", ")
+	function := fmt.Sprintf(`CREATE OR REPLACE FUNCTION %[1]s_record() RETURNS trigger LANGUAGE plpgsql AS $$
+BEGIN
+	IF TG_OP = 'UPDATE' AND to_jsonb(OLD) IS NOT DISTINCT FROM to_jsonb(NEW) THEN
+		RETURN NULL;
+	END IF;
+	IF TG_OP = 'DELETE' OR (TG_OP = 'UPDATE' AND ROW(%[2]s) IS DISTINCT FROM ROW(%[3]s)) THEN
+		INSERT INTO %[1]s (history_at, history_removed, %[4]s) VALUES (now(), true, %[5]s);
+	END IF;
+	IF TG_OP <> 'DELETE' THEN
+		INSERT INTO %[1]s (history_at, history_removed, %[4]s) VALUES (now(), false, %[6]s);
+	END IF;
+	RETURN NULL;
+END $$`, history, strings.Join(oldKey, ", "), strings.Join(newKey, ", "), columns, rowValues("OLD", names), rowValues("NEW", names))
+	if err := db.Exec(function).Error; err != nil {
+		return err
+	}
+
+	var existing int64
+	if err := db.Raw("SELECT COUNT(*) FROM pg_trigger WHERE tgname = ?", history).Scan(&existing).Error; err != nil {
+		return err
+	}
+	if existing > 0 {
+		return nil
+	}
+	return db.Exec(fmt.Sprintf("CREATE TRIGGER %[1]s AFTER INSERT OR UPDATE OR DELETE ON %[2]s FOR EACH ROW EXECUTE FUNCTION %[1]s_record()", history, table.Name)).Error
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestEnsureEntityHistoryRecordsChanges(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:entity_history?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&Tag{}, &Group{}, &Note{}, &Resource{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	// A row written before the triggers exist is backfilled.
+	early := Group{Name: "early"}
+	if err := db.Create(&early).Error; err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	if err := EnsureEntityHistory(db); err != nil {
+		t.Fatalf("ensure entity history: %v", err)
+	}
+	if err := EnsureEntityHistory(db); err != nil {
+		t.Fatalf("ensure entity history (idempotency): %v", err)
+	}
+
+	tag := Tag{Name: "t"}
+	if err := db.Create(&tag).Error; err != nil {
+		t.Fatalf("create tag: %v", err)
+	}
+	// Raw writes bypass the model entirely and must still be recorded.
+	for _, stmt := range []string{
+		"UPDATE groups SET name = 'renamed' WHERE id = ?",
+		"UPDATE groups SET name = name WHERE id = ?",
+		"INSERT INTO group_tags (group_id, tag_id) VALUES (?, 1)",
+		"DELETE FROM group_tags WHERE group_id = ?",
+		"DELETE FROM groups WHERE id = ?",
+	} {
+		if err := db.Exec(stmt, early.ID).Error; err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+
+	type entry struct {
+		Name           string
+		HistoryRemoved bool
+	}
+	var groups []entry
+	if err := db.Raw("SELECT name, history_removed FROM groups_history ORDER BY history_id").Scan(&groups).Error; err != nil {
+		t.Fatalf("load group history: %v", err)
+	}
+	want := []entry{{"early", false}, {"renamed", false}, {"renamed", true}}
+	if len(groups) != len(want) {
+		t.Fatalf("group history: got %v, want %v", groups, want)
+	}
+	for i := range want {
+		if groups[i] != want[i] {
+			t.Errorf("group history %d: got %v, want %v", i, groups[i], want[i])
+		}
+	}
+
+	var memberships []bool
+	if err := db.Raw("SELECT history_removed FROM group_tags_history ORDER BY history_id").Scan(&memberships).Error; err != nil {
+		t.Fatalf("load membership history: %v", err)
+	}
+	if len(memberships) != 2 || memberships[0] || !memberships[1] {
+		t.Errorf("membership history: got %v, want [false true]", memberships)
+	}
+
+	// Columns a later migration adds are added to the history table.
+	if err := db.Exec("ALTER TABLE groups ADD COLUMN extra TEXT").Error; err != nil {
+		t.Fatalf("add column: %v", err)
+	}
+	if err := EnsureEntityHistory(db); err != nil {
+		t.Fatalf("ensure entity history after migration: %v", err)
+	}
+	if err := db.Exec("INSERT INTO groups (name, extra) VALUES ('late', 'x')").Error; err != nil {
+		t.Fatalf("insert group: %v", err)
+	}
+	var extra string
+	if err := db.Raw("SELECT extra FROM groups_history WHERE name = 'late'").Scan(&extra).Error; err != nil || extra != "x" {
+		t.Errorf("new column: got %q, %v", extra, err)
+	}
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"mahresources/models/types"
+)
+
+// MRQLMaterialization is the stored result of a materialized SavedMRQLQuery,
+// one row per query.
+//
+// A flat result is stored as the (entity type, ID) pairs it returned, in order,
+// and the entities are loaded by ID when it is served: what was expensive is
+// finding them, not reading them back. An aggregated GROUP BY result has no
+// entities behind it, so it is stored whole.
+type MRQLMaterialization struct {
+	ID           uint `gorm:"primarykey" json:"id"`
+	SavedQueryID uint `gorm:"uniqueIndex;not null" json:"savedQueryId"`
+	// Query is the saved query text the result was computed from. A saved query
+	// edited since no longer matches it, and the result is recomputed.
+	Query string `json:"query"`
+	// Result is the JSON-encoded stored result; its shape is owned by
+	// application_context.
+	Result      types.JSON `gorm:"type:json" json:"-"`
+	RefreshedAt time.Time  `json:"refreshedAt"`
+	DurationMs  int64      `json:"durationMs"`
+}
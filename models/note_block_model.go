@@ -17,6 +17,13 @@ type NoteBlock struct {
 	Position        string     `gorm:"index:idx_note_type_position,priority:3;index:idx_note_position,priority:2;size:64;not null" json:"position"`
 	Content         types.JSON `gorm:"not null;default:'{}'" json:"content"`
 	State           types.JSON `gorm:"not null;default:'{}'" json:"state"`
+
+	// Derived from Content and State by database triggers (see
+	// EnsureNoteBlockSearch) so MRQL can query block content with an index.
+	// Never written by the application.
+	SearchText    string `gorm:"<-:false;not null;default:''" json:"-"`
+	TodoCount     int    `gorm:"<-:false;not null;default:0" json:"-"`
+	OpenTodoCount int    `gorm:"<-:false;not null;default:0" json:"-"`
 }
 
 func (NoteBlock) TableName() string {
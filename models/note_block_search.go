@@ -0,0 +1,114 @@
+package models
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// noteBlockSearchTextSQLite renders the searchable text of the block row
+// `new`: the text of text and heading blocks, todo labels, and table column
+// labels and cell values, one entry per line. Invalid JSON yields "".
+const noteBlockSearchTextSQLite = `CASE WHEN json_valid(new.content) THEN COALESCE(CASE new.type
+	WHEN 'text' THEN json_extract(new.content, '$.text')
+	WHEN 'heading' THEN json_extract(new.content, '$.text')
+	WHEN 'todos' THEN (SELECT group_concat(json_extract(i.value, '$.label'), char(10))
+		FROM json_each(new.content, '$.items') i WHERE i.type = 'object')
+	WHEN 'table' THEN (SELECT group_concat(t.value, char(10)) FROM json_tree(new.content) t
+		WHERE t.type IN ('text', 'integer', 'real')
+		AND (t.path = '$.columns' OR (t.key = 'label' AND t.path LIKE '$.columns[%') OR t.fullkey LIKE '$.rows[%'))
+END, '') ELSE '' END`
+
+// noteBlockTodoCountSQLite counts the items of a todos block; open items are
+// the ones whose id is not in state.checked.
+const noteBlockTodoCountSQLite = `CASE WHEN new.type = 'todos' AND json_valid(new.content) THEN (
+	SELECT COUNT(*) FROM json_each(new.content, '$.items') i WHERE i.type = 'object'%s
+) ELSE 0 END`
+
+const noteBlockOpenTodoFilterSQLite = ` AND NOT EXISTS (
+		SELECT 1 FROM json_each(CASE WHEN json_valid(new.state) THEN new.state ELSE '{}' END, '$.checked') c
+		WHERE c.value = json_extract(i.value, '$.id'))`
+
+// noteBlockDerivePostgres is the BEFORE trigger function computing the same
+// columns on Postgres.
+const noteBlockDerivePostgres = `CREATE OR REPLACE FUNCTION note_blocks_derive() RETURNS trigger LANGUAGE plpgsql AS $$
+DECLARE
+	items jsonb := '[]';
+	checked jsonb := '[]';
+BEGIN
+	NEW.search_text := '';
+	NEW.todo_count := 0;
+	NEW.open_todo_count := 0;
+	IF NEW.type IN ('text', 'heading') THEN
+		NEW.search_text := COALESCE(NEW.content->>'text', '');
+	ELSIF NEW.type = 'todos' THEN
+		IF jsonb_typeof(NEW.content->'items') = 'array' THEN items := NEW.content->'items'; END IF;
+		IF jsonb_typeof(NEW.state->'checked') = 'array' THEN checked := NEW.state->'checked'; END IF;
+		SELECT COALESCE(string_agg(i->>'label', E'\n'), ''), COUNT(*),
+			COUNT(*) FILTER (WHERE NOT checked @> jsonb_build_array(i->'id'))
+		INTO NEW.search_text, NEW.todo_count, NEW.open_todo_count
+		FROM jsonb_array_elements(items) i WHERE jsonb_typeof(i) = 'object';
+	ELSIF NEW.type = 'table' THEN
+		SELECT COALESCE(string_agg(v #>> '{}', E'\n'), '') INTO NEW.search_text FROM (
+			SELECT jsonb_path_query(NEW.content, 'lax $.columns[*] ? (@.type() == "string")') AS v
+			UNION ALL SELECT jsonb_path_query(NEW.content, 'lax $.columns[*].label ? (@.type() == "string")')
+			UNION ALL SELECT jsonb_path_query(NEW.content, 'strict $.rows.** ? (@.type() == "string" || @.type() == "number")', '{}', true)
+		) t;
+	END IF;
+	RETURN NEW;
+END $$`
+
+// EnsureNoteBlockSearch installs the triggers that keep NoteBlock.SearchText,
+// TodoCount and OpenTodoCount in step with each block's content and state,
+// plus the indexes MRQL's blocks.type and todos.count predicates use.
+// Triggers rather than model hooks because block content is also rewritten
+// with raw UPDATEs (reference cleanup, bulk edits). Backfills existing rows
+// the first time it runs. Idempotent; called from main.go after AutoMigrate.
+func EnsureNoteBlockSearch(db *gorm.DB) error {
+	var existing int64
+	if db.Dialector.Name() == "postgres" {
+		if err := db.Raw("SELECT COUNT(*) FROM pg_trigger WHERE tgname = 'note_blocks_derive'").Scan(&existing).Error; err != nil {
+			return err
+		}
+		if err := db.Exec(noteBlockDerivePostgres).Error; err != nil {
+			return err
+		}
+		if existing == 0 {
+			if err := db.Exec("CREATE TRIGGER note_blocks_derive BEFORE INSERT OR UPDATE OF content, state, type ON note_blocks FOR EACH ROW EXECUTE FUNCTION note_blocks_derive()").Error; err != nil {
+				return err
+			}
+		}
+	} else {
+		if err := db.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name = 'note_blocks_derive_au'").Scan(&existing).Error; err != nil {
+			return err
+		}
+		update := "UPDATE note_blocks SET search_text = " + noteBlockSearchTextSQLite +
+			", todo_count = " + fmt.Sprintf(noteBlockTodoCountSQLite, "") +
+			", open_todo_count = " + fmt.Sprintf(noteBlockTodoCountSQLite, noteBlockOpenTodoFilterSQLite) +
+			" WHERE id = new.id;"
+		for _, trigger := range []string{
+			"CREATE TRIGGER IF NOT EXISTS note_blocks_derive_ai AFTER INSERT ON note_blocks BEGIN " + update + " END",
+			"CREATE TRIGGER IF NOT EXISTS note_blocks_derive_au AFTER UPDATE OF content, state, type ON note_blocks BEGIN " + update + " END",
+		} {
+			if err := db.Exec(trigger).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, query := range []string{
+		"CREATE INDEX IF NOT EXISTS idx_note_blocks_lower_type ON note_blocks (LOWER(type), note_id)",
+		"CREATE INDEX IF NOT EXISTS idx_note_blocks_todo_count ON note_blocks (note_id, todo_count) WHERE todo_count > 0",
+		"CREATE INDEX IF NOT EXISTS idx_note_blocks_open_todo_count ON note_blocks (note_id, open_todo_count) WHERE open_todo_count > 0",
+	} {
+		if err := db.Exec(query).Error; err != nil {
+			return err
+		}
+	}
+
+	if existing == 0 {
+		// Rewriting type with itself fires the triggers for every row.
+		return db.Exec("UPDATE note_blocks SET type = type").Error
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestEnsureNoteBlockSearchDerivesColumns(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:note_block_search?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&NoteBlock{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	// A row written before the triggers exist is backfilled.
+	early := NoteBlock{NoteID: 1, Type: "text", Position: "a", Content: []byte(`{"text":"early invoice"}`), State: []byte(`{}`)}
+	if err := db.Create(&early).Error; err != nil {
+		t.Fatalf("create block: %v", err)
+	}
+	if err := EnsureNoteBlockSearch(db); err != nil {
+		t.Fatalf("ensure note block search: %v", err)
+	}
+	if err := EnsureNoteBlockSearch(db); err != nil {
+		t.Fatalf("ensure note block search (idempotency): %v", err)
+	}
+
+	todos := NoteBlock{NoteID: 1, Type: "todos", Position: "b",
+		Content: []byte(`{"items":[{"id":"x","label":"Pay rent"},{"id":"y","label":"Call bank"},{"id":"z","label":"File taxes"}]}`),
+		State:   []byte(`{"checked":["y"]}`)}
+	table := NoteBlock{NoteID: 1, Type: "table", Position: "c",
+		Content: []byte(`{"columns":["Item",{"id":"c2","label":"Amount"}],"rows":[["Lamp",42],{"c2":"Desk"}]}`),
+		State:   []byte(`{}`)}
+	for _, block := range []*NoteBlock{&todos, &table} {
+		if err := db.Create(block).Error; err != nil {
+			t.Fatalf("create block: %v", err)
+		}
+	}
+	// Raw writes bypass the model entirely and must still be tracked.
+	if err := db.Exec(`UPDATE note_blocks SET state = '{"checked":["x","y"]}' WHERE id = ?`, todos.ID).Error; err != nil {
+		t.Fatalf("update state: %v", err)
+	}
+
+	var got []NoteBlock
+	if err := db.Order("id").Find(&got).Error; err != nil {
+		t.Fatalf("load blocks: %v", err)
+	}
+	want := []struct {
+		text        string
+		todos, open int
+	}{
+		{"early invoice", 0, 0},
+		{"Pay rent\nCall bank\nFile taxes", 3, 1},
+		{"Item\nAmount\nLamp\n42\nDesk", 0, 0},
+	}
+	for i, w := range want {
+		if got[i].SearchText != w.text || got[i].TodoCount != w.todos || got[i].OpenTodoCount != w.open {
+			t.Errorf("block %d: got (%q, %d, %d), want (%q, %d, %d)", i, got[i].SearchText, got[i].TodoCount, got[i].OpenTodoCount, w.text, w.todos, w.open)
+		}
+	}
+}
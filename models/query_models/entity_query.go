@@ -23,6 +23,11 @@ type BulkEditMetaQuery struct {
 	Meta string
 }
 
+type BulkSetOwnerQuery struct {
+	BulkQuery
+	OwnerId uint
+}
+
 type MergeQuery struct {
 	Winner        uint
 	Losers        []uint
@@ -0,0 +1,10 @@
+package query_models
+
+// StorageQuotaEditor sets the quota of a user or of a group's subtree. A zero
+// limit is no limit.
+type StorageQuotaEditor struct {
+	SubjectType  string `json:"subjectType"`
+	SubjectId    uint   `json:"subjectId"`
+	MaxBytes     int64  `json:"maxBytes"`
+	MaxResources int64  `json:"maxResources"`
+}
@@ -0,0 +1,27 @@
+package query_models
+
+// WatchFolderEditor creates a watch folder, or updates the one with ID.
+type WatchFolderEditor struct {
+	ID           uint              `json:"id"`
+	Name         string            `json:"name"`
+	FileSystem   string            `json:"fileSystem"`
+	Path         string            `json:"path"`
+	OwnerGroupId uint              `json:"ownerGroupId"`
+	Subfolders   bool              `json:"subfolders"`
+	Rules        []WatchFolderRule `json:"rules"`
+	OnDelete     string            `json:"onDelete"`
+	Paused       bool              `json:"paused"`
+}
+
+// WatchFolderRule maps the files of a watch folder that match Pattern. Every
+// matching rule adds its Tags; the first matching rule with a GroupID picks the
+// group the file's resource goes to.
+//
+// Pattern is matched with path.Match against the file's path in the folder,
+// or against its name when the pattern has no slash. A pattern ending in
+// "/**" matches every file under the folders the rest of it matches.
+type WatchFolderRule struct {
+	Pattern string `json:"pattern"`
+	GroupID uint   `json:"groupId,omitempty"`
+	Tags    []uint `json:"tags,omitempty"`
+}
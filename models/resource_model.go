@@ -9,6 +9,15 @@ import (
 	"gorm.io/gorm"
 )
 
+// Content hash algorithms, the values of HashType. Files uploaded before the
+// move to SHA-256 keep SHA1 until the content hash migration re-hashes them; a
+// resource or version hashed with SHA-256 also keeps its SHA1 in LegacyHash,
+// so a lookup by either finds it.
+const (
+	HashTypeSHA1   = "SHA1"
+	HashTypeSHA256 = "SHA256"
+)
+
 type Resource struct {
 	ID                 uint      `gorm:"primarykey"`
 	CreatedAt          time.Time `gorm:"index"`
@@ -20,12 +29,14 @@ type Resource struct {
 	OriginalLocation   string    `gorm:"index"`
 	Hash               string    `gorm:"index"`
 	HashType           string    `gorm:"index"`
+	LegacyHash         string    `gorm:"index"`
 	Location           string    `gorm:"index"`
 	StorageLocation    *string
 	Description        string
 	Meta               types.JSON
 	Width              uint              `gorm:"index"`
 	Height             uint              `gorm:"index"`
+	PageCount          uint              `json:"pageCount"`
 	FileSize           int64             `gorm:"index"`
 	Category           string            `gorm:"index"`
 	ContentType        string            `gorm:"index"`
@@ -92,6 +103,12 @@ func (r *Resource) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// HasContentHash reports whether hash is the resource's content hash under
+// either algorithm.
+func (r Resource) HasContentHash(hash string) bool {
+	return hash != "" && (r.Hash == hash || r.LegacyHash == hash)
+}
+
 func (r Resource) GetCleanLocation() string {
 	return filepath.FromSlash(strings.ReplaceAll(r.Location, "\\", "/"))
 }
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// ResourceText is the text extracted from a resource's file, such as a PDF's
+// text layer. It is kept out of the resources table so that listing resources
+// never loads it.
+type ResourceText struct {
+	ResourceID uint      `gorm:"primarykey;autoIncrement:false" json:"resourceId"`
+	Resource   *Resource `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	Text       string    `json:"text"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
@@ -12,6 +12,7 @@ type ResourceVersion struct {
 	VersionNumber   int       `gorm:"not null" json:"versionNumber"`
 	Hash            string    `gorm:"index;not null" json:"hash"`
 	HashType        string    `gorm:"not null;default:'SHA1'" json:"hashType"`
+	LegacyHash      string    `gorm:"index" json:"legacyHash,omitempty"`
 	FileSize        int64     `gorm:"not null" json:"fileSize"`
 	ContentType     string    `json:"contentType"`
 	Width           uint      `json:"width"`
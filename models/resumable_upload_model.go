@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"mahresources/models/types"
+)
+
+const (
+	ResumableUploadResource = "resource"
+	ResumableUploadVersion  = "version"
+)
+
+// ResumableUpload is a tus upload: a file sent in as many requests as the
+// client needs, staged until all Length bytes have arrived and then created as
+// a resource, or as a new version of one.
+type ResumableUpload struct {
+	// ID is the random token in the upload's URL.
+	ID        string    `gorm:"primarykey;size:64" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	// ExpiresAt moves forward with every chunk; an upload left alone past it is
+	// deleted with its staged chunks.
+	ExpiresAt time.Time `gorm:"index" json:"expiresAt"`
+	// OwnerUserID is the user who started the upload, nil with auth disabled.
+	// Only they, or an admin, may continue it.
+	OwnerUserID *uint  `gorm:"index" json:"ownerUserId,omitempty"`
+	Kind        string `json:"kind"`
+	Length      int64  `json:"length"`
+	Offset      int64  `json:"offset"`
+	// Metadata is the decoded Upload-Metadata: the file name and the fields of
+	// the resource or version to create.
+	Metadata types.JSON `gorm:"type:json" json:"metadata"`
+	// FinishedAt, ResourceID and VersionID are set once the upload is created;
+	// the row is kept until it expires so that a client that lost the final
+	// response can still learn what it created.
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	ResourceID *uint      `json:"resourceId,omitempty"`
+	VersionID  *uint      `json:"versionId,omitempty"`
+	// ExpansionID is set instead of ResourceID for an upload sent with
+	// "expand": the archive expansion it started.
+	ExpansionID *uint `json:"expansionId,omitempty"`
+}
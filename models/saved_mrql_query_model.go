@@ -2,6 +2,16 @@ package models
 
 import "time"
 
+// Refresh policies for a materialized SavedMRQLQuery.
+const (
+	// MRQLRefreshInterval recomputes the stored result once it is older than
+	// RefreshIntervalSeconds.
+	MRQLRefreshInterval = "interval"
+	// MRQLRefreshOnWrite recomputes the stored result after a write to any
+	// entity type the query reads.
+	MRQLRefreshOnWrite = "on_write"
+)
+
 // SavedMRQLQuery stores a named MRQL query for quick retrieval and reuse.
 type SavedMRQLQuery struct {
 	ID              uint      `gorm:"primarykey" json:"id"`
@@ -11,6 +21,12 @@ type SavedMRQLQuery struct {
 	Name            string    `gorm:"uniqueIndex:unique_mrql_query_name" json:"name"`
 	Query           string    `json:"query"`
 	Description     string    `json:"description"`
+	// Materialized serves the query from a stored result (MRQLMaterialization)
+	// instead of running it on every read. RefreshPolicy is one of the
+	// MRQLRefresh* values; RefreshIntervalSeconds applies to "interval" only.
+	Materialized           bool   `gorm:"not null;default:false" json:"materialized"`
+	RefreshPolicy          string `gorm:"size:20" json:"refreshPolicy,omitempty"`
+	RefreshIntervalSeconds int    `json:"refreshIntervalSeconds,omitempty"`
 }
 
 func (q SavedMRQLQuery) GetId() uint            { return q.ID }
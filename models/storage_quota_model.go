@@ -0,0 +1,71 @@
+package models
+
+import "time"
+
+// Quota subjects, the values of SubjectType.
+const (
+	QuotaSubjectUser  = "user"
+	QuotaSubjectGroup = "group"
+)
+
+// StorageQuota limits what a user, or a group's whole subtree, may store. A
+// zero limit is no limit.
+type StorageQuota struct {
+	ID           uint      `gorm:"primarykey" json:"id"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+	SubjectType  string    `gorm:"size:8;uniqueIndex:idx_storage_quota_subject" json:"subjectType"`
+	SubjectID    uint      `gorm:"uniqueIndex:idx_storage_quota_subject" json:"subjectId"`
+	MaxBytes     int64     `json:"maxBytes"`
+	MaxResources int64     `json:"maxResources"`
+}
+
+// TableName keeps the plural the usage queries use; GORM's inflector leaves
+// "quota" as it is.
+func (StorageQuota) TableName() string {
+	return "storage_quotas"
+}
+
+// StorageUsage is the running total for one user or one group. A group's row
+// covers only the resources it owns directly; its subtree's usage is summed
+// over the groups in it.
+type StorageUsage struct {
+	SubjectType string `gorm:"primarykey;size:8" json:"subjectType"`
+	SubjectID   uint   `gorm:"primarykey;autoIncrement:false" json:"subjectId"`
+	// Bytes counts every file once, however many of the subject's resources
+	// and versions share it.
+	Bytes     int64 `json:"bytes"`
+	Resources int64 `json:"resources"`
+}
+
+// StorageUsageBlob is one file a user or group is charged for, and how many of
+// its resources hold it. The file's size leaves the subject's usage only when
+// the last of them lets go.
+type StorageUsageBlob struct {
+	SubjectType string `gorm:"primarykey;size:8"`
+	SubjectID   uint   `gorm:"primarykey;autoIncrement:false"`
+	BlobKey     string `gorm:"primarykey;size:64"`
+	FileSize    int64
+	Refs        int64
+}
+
+// StorageCharge records one file a resource is charged for and to whom, so a
+// change to the resource can take back exactly what was charged. It outlives a
+// deleted resource until the charge is taken back, so it has no foreign key.
+type StorageCharge struct {
+	ResourceID uint   `gorm:"primarykey;autoIncrement:false"`
+	BlobKey    string `gorm:"primarykey;size:64"`
+	FileSize   int64
+	UserID     *uint `gorm:"index"`
+	GroupID    *uint `gorm:"index"`
+}
+
+// QuotaBlobKey names a file for quota accounting by its SHA1, which every row
+// has whether or not the content hash migration has re-hashed it, so a file
+// counts once across rows hashed either way.
+func QuotaBlobKey(hash, hashType, legacyHash string) string {
+	if hashType == HashTypeSHA256 && legacyHash != "" {
+		return legacyHash
+	}
+	return hash
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"mahresources/models/types"
+)
+
+// ResourceView records when a resource's file was last opened; MRQL reads it
+// as lastViewed. It is kept out of resources so that viewing a file rewrites
+// neither the resource row nor its change history.
+type ResourceView struct {
+	ResourceID uint      `gorm:"primarykey;autoIncrement:false" json:"resourceId"`
+	ViewedAt   time.Time `gorm:"index" json:"viewedAt"`
+	Resource   *Resource `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
+
+// StorageTierPin keeps a resource on the filesystem it is on: tiering rules
+// skip it until it is unpinned.
+type StorageTierPin struct {
+	ResourceID uint      `gorm:"primarykey;autoIncrement:false" json:"resourceId"`
+	CreatedAt  time.Time `json:"createdAt"`
+	Resource   *Resource `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
+
+// StorageTierRun is one pass that moves resources between filesystems: either
+// applying the configured tiering rules or moving resources it was given. Each
+// file is copied, verified against its hash, and only then switched over.
+type StorageTierRun struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	StartedAt time.Time `json:"startedAt"`
+	// FinishedAt stays nil while the run is in progress, and for a run the
+	// server stopped during.
+	FinishedAt *time.Time `json:"finishedAt"`
+	// DryRun counts what the rules would move without moving it.
+	DryRun bool `json:"dryRun"`
+	// Target is the filesystem resources given to the run move to, for a run
+	// that does not apply the rules; "" is the main filesystem.
+	Target     string `json:"target,omitempty"`
+	ApplyRules bool   `json:"applyRules"`
+	Matched    int64  `json:"matched"`
+	Moved      int64  `json:"moved"`
+	MovedBytes int64  `json:"movedBytes"`
+	Failed     int64  `json:"failed"`
+	Error      string `json:"error,omitempty"`
+	JobID      string `json:"jobId"`
+	// Report is the JSON-encoded per-rule report; its shape is owned by
+	// application_context.
+	Report types.JSON `gorm:"type:json" json:"report"`
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"mahresources/models/types"
+)
+
+// WatchFolder is a folder on an alt filesystem that is polled for new, changed
+// and removed files, which it turns into resources under OwnerGroupID.
+type WatchFolder struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Name      string    `gorm:"uniqueIndex" json:"name"`
+	// FileSystem is the key of the alt filesystem the folder is on, and Path
+	// the folder on it.
+	FileSystem   string `json:"fileSystem"`
+	Path         string `json:"path"`
+	OwnerGroupID uint   `json:"ownerGroupId"`
+	OwnerGroup   *Group `gorm:"foreignKey:OwnerGroupID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	// Subfolders mirrors the folder's subfolders as groups under the owner
+	// group, found or created by name.
+	Subfolders bool `json:"subfolders"`
+	// Rules is the JSON-encoded list of query_models.WatchFolderRule.
+	Rules types.JSON `gorm:"type:json" json:"rules"`
+	// OnDelete is what a file removed from the folder does to its resource:
+	// "keep" or "delete".
+	OnDelete string `json:"onDelete"`
+	// Paused folders are not polled; they are still scanned on request.
+	Paused     bool       `json:"paused"`
+	LastScanAt *time.Time `json:"lastScanAt"`
+	LastError  string     `json:"lastError,omitempty"`
+	// LastReport is the JSON-encoded report of the last scan; its shape is
+	// owned by application_context.
+	LastReport types.JSON `gorm:"type:json" json:"lastReport"`
+}
+
+// WatchedFile is a file a watch folder has ingested: where it is, what it
+// looked like when it was last read, and the resource it became.
+type WatchedFile struct {
+	ID            uint         `gorm:"primarykey" json:"id"`
+	WatchFolderID uint         `gorm:"uniqueIndex:idx_watched_file_path" json:"watchFolderId"`
+	WatchFolder   *WatchFolder `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	// Path is the file's slash-separated path inside the folder.
+	Path       string    `gorm:"uniqueIndex:idx_watched_file_path" json:"path"`
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"modTime"`
+	Hash       string    `json:"hash"`
+	ResourceID uint      `gorm:"index" json:"resourceId"`
+}
@@ -0,0 +1,18 @@
+//go:build postgres
+
+package mrql
+
+import "testing"
+
+// TestPG_AggregateExecution runs the SQLite aggregate expectations against
+// Postgres: native percentile_cont must agree with the SQLite emulation, and
+// the window-based running totals must agree across dialects.
+func TestPG_AggregateExecution(t *testing.T) {
+	db := setupPostgresTestDB(t)
+	seedAggregateResources(t, db)
+	for _, tc := range aggregateCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assertAggregateValues(t, tc.want, runAggregateCase(t, db, tc.query, tc.key))
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package mrql
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Median, percentile, distinct-count and running-total aggregates.
+//
+// Seed (on top of setupTestDB), all named ledger-*:
+//
+//	2024-01: a/x 100 (rating 4), a/x 200 (rating "n/a"), b/x 400 (rating 2)
+//	2024-02: a/x 1000 (rating 7)
+//	2024-03: b/x 50, b/x 50
+func seedAggregateResources(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	day := func(month time.Month, d int) time.Time { return time.Date(2024, month, d, 12, 0, 0, 0, time.UTC) }
+	rows := []testResource{
+		{ID: 10, Name: "ledger-1", ContentType: "a/x", FileSize: 100, CreatedAt: day(1, 5), Meta: `{"rating":4}`},
+		{ID: 11, Name: "ledger-2", ContentType: "a/x", FileSize: 200, CreatedAt: day(1, 15), Meta: `{"rating":"n/a"}`},
+		{ID: 12, Name: "ledger-3", ContentType: "b/x", FileSize: 400, CreatedAt: day(1, 25), Meta: `{"rating":2}`},
+		{ID: 13, Name: "ledger-4", ContentType: "a/x", FileSize: 1000, CreatedAt: day(2, 10), Meta: `{"rating":7}`},
+		{ID: 14, Name: "ledger-5", ContentType: "b/x", FileSize: 50, CreatedAt: day(3, 1), Meta: `{}`},
+		{ID: 15, Name: "ledger-6", ContentType: "b/x", FileSize: 50, CreatedAt: day(3, 2), Meta: `{}`},
+	}
+	for i := range rows {
+		rows[i].UpdatedAt = rows[i].CreatedAt
+		if err := db.Create(&rows[i]).Error; err != nil {
+			t.Fatalf("seed resource: %v", err)
+		}
+	}
+}
+
+// aggregateCases are the expectations over seedAggregateResources, shared with
+// the Postgres run so both dialects are held to the same results.
+var aggregateCases = []struct {
+	name  string
+	query string
+	key   string
+	want  []float64 // one value per row, in the query's ORDER BY; NaN = NULL
+}{
+	{"median", `GROUP BY created.month MEDIAN(fileSize) ORDER BY created.month`, "median_fileSize", []float64{200, 1000, 50}},
+	{"percentile interpolates", `GROUP BY created.month PERCENTILE(fileSize, 0.9) ORDER BY created.month`, "percentile90_fileSize", []float64{360, 1000, 50}},
+	{"percentile bounds", `GROUP BY created.year PERCENTILE(fileSize, 0) ORDER BY created.year`, "percentile0_fileSize", []float64{50}},
+	{"percentile key keeps decimals", `GROUP BY created.year PERCENTILE(fileSize, 0.995) ORDER BY created.year`, "percentile99_5_fileSize", []float64{985}},
+	{"median skips non-numeric meta", `GROUP BY created.year MEDIAN(meta.rating) ORDER BY created.year`, "median_meta.rating", []float64{4}},
+	{"median of no values is null", `GROUP BY created.month MEDIAN(meta.rating) ORDER BY created.month`, "median_meta.rating", []float64{3, 7, math.NaN()}},
+	{"count distinct", `GROUP BY created.month COUNT(DISTINCT contentType) ORDER BY created.month`, "count_distinct_contentType", []float64{2, 1, 1}},
+	{"running sum", `GROUP BY created.month RUNNING_SUM(fileSize) ORDER BY created.month`, "running_sum_fileSize", []float64{700, 1700, 1800}},
+	{"running sum ignores output order", `GROUP BY created.month RUNNING_SUM(fileSize) ORDER BY created.month DESC`, "running_sum_fileSize", []float64{1800, 1700, 700}},
+	{"running count", `GROUP BY created.month RUNNING_COUNT() ORDER BY created.month`, "running_count", []float64{3, 4, 6}},
+	{"running sum partitions by other fields", `GROUP BY contentType, created.month RUNNING_SUM(fileSize) ORDER BY contentType, created.month`, "running_sum_fileSize", []float64{300, 1300, 400, 500}},
+	{"having filters groups before running totals", `GROUP BY created.month COUNT() RUNNING_COUNT() HAVING COUNT() > 1 ORDER BY created.month`, "running_count", []float64{3, 5}},
+	{"having on median", `GROUP BY created.month MEDIAN(fileSize) HAVING MEDIAN(fileSize) > 100 ORDER BY created.month`, "median_fileSize", []float64{200, 1000}},
+}
+
+// runAggregateCase runs one of aggregateCases and returns the key column.
+func runAggregateCase(t *testing.T, db *gorm.DB, query, key string) []float64 {
+	t.Helper()
+	q, err := Parse(`type = resource AND name ~ "ledger-*" ` + query)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	if err := Validate(q); err != nil {
+		t.Fatalf("validation error: %v", err)
+	}
+	result, err := TranslateGroupBy(q, db, TranslateOptions{})
+	if err != nil {
+		t.Fatalf("translate error: %v", err)
+	}
+	got := make([]float64, 0, len(result.Rows))
+	for _, row := range result.Rows {
+		got = append(got, toFloat(t, row[key]))
+	}
+	return got
+}
+
+func assertAggregateValues(t *testing.T, want, got []float64) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if math.IsNaN(want[i]) != math.IsNaN(got[i]) || math.Abs(want[i]-got[i]) > 1e-9 {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+}
+
+// toFloat normalizes numeric scan types; NULL becomes NaN.
+func toFloat(t *testing.T, v any) float64 {
+	t.Helper()
+	switch n := deref(v).(type) {
+	case nil:
+		return math.NaN()
+	case float64:
+		return n
+	case int64:
+		return float64(n)
+	case []byte:
+		return toFloat(t, string(n))
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		if err != nil {
+			t.Fatalf("unexpected numeric value %q: %v", n, err)
+		}
+		return f
+	default:
+		return float64(toInt(t, n))
+	}
+}
+
+func TestAggregateExecution(t *testing.T) {
+	db := setupTestDB(t)
+	seedAggregateResources(t, db)
+	for _, tc := range aggregateCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assertAggregateValues(t, tc.want, runAggregateCase(t, db, tc.query, tc.key))
+		})
+	}
+}
+
+func TestAggregateKeys(t *testing.T) {
+	cases := []struct {
+		input string
+		key   string
+		str   string
+	}{
+		{`COUNT()`, "count", "COUNT()"},
+		{`count(distinct name)`, "count_distinct_name", "COUNT(DISTINCT name)"},
+		{`MEDIAN(fileSize)`, "median_fileSize", "MEDIAN(fileSize)"},
+		{`PERCENTILE(fileSize, 0.95)`, "percentile95_fileSize", "PERCENTILE(fileSize, 0.95)"},
+		{`PERCENTILE(meta.size, 0.07)`, "percentile7_meta.size", "PERCENTILE(meta.size, 0.07)"},
+		{`RUNNING_SUM(fileSize)`, "running_sum_fileSize", "RUNNING_SUM(fileSize)"},
+		{`RUNNING_COUNT()`, "running_count", "RUNNING_COUNT()"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.input, func(t *testing.T) {
+			q, err := Parse(`type = resource GROUP BY created.month ` + tc.input)
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+			agg := q.GroupBy.Aggregates[0]
+			if agg.Key() != tc.key || agg.String() != tc.str {
+				t.Errorf("expected key %q and %q, got %q and %q", tc.key, tc.str, agg.Key(), agg.String())
+			}
+		})
+	}
+}
+
+func TestAggregateErrors(t *testing.T) {
+	cases := []struct {
+		input      string
+		wantSubstr string
+	}{
+		{`GROUP BY contentType PERCENTILE(fileSize)`, "expected ','"},
+		{`GROUP BY contentType PERCENTILE(fileSize, 95)`, "between 0 and 1"},
+		{`GROUP BY contentType PERCENTILE(fileSize, 1mb)`, "between 0 and 1"},
+		{`GROUP BY contentType COUNT(name)`, "COUNT() takes no arguments (or DISTINCT field)"},
+		{`GROUP BY contentType COUNT(DISTINCT)`, "requires a field argument"},
+		{`GROUP BY contentType RUNNING_COUNT(name)`, "RUNNING_COUNT() takes no arguments"},
+		{`GROUP BY contentType MEDIAN(name)`, `MEDIAN requires a numeric field, but "name" is a string field`},
+		{`GROUP BY contentType COUNT(DISTINCT tags)`, "COUNT(DISTINCT) requires a scalar or meta field"},
+		{`GROUP BY contentType RUNNING_SUM(fileSize)`, "RUNNING_SUM requires a date bucket in GROUP BY"},
+		{`GROUP BY created.month COUNT() HAVING RUNNING_COUNT() > 1`, "RUNNING_COUNT cannot be used in HAVING"},
+		{`GROUP BY created.month MEDIAN(fileSize) ORDER BY median_name`, `ORDER BY "median_name" is not valid`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.input, func(t *testing.T) {
+			q, err := Parse(`type = resource ` + tc.input)
+			if err == nil {
+				err = Validate(q)
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantSubstr) {
+				t.Errorf("expected error containing %q, got %v", tc.wantSubstr, err)
+			}
+		})
+	}
+}
+
+func TestSQLiteVersionAtLeast(t *testing.T) {
+	cases := []struct {
+		version string
+		want    bool
+	}{
+		{"3.44.0", true},
+		{"3.53.2", true},
+		{"3.43.2", false},
+		{"3.9.0", false},
+		{"4.0", true},
+		{"3.44", true},
+	}
+	for _, tc := range cases {
+		if got := sqliteVersionAtLeast(tc.version, minPercentileSQLiteVersion); got != tc.want {
+			t.Errorf("sqliteVersionAtLeast(%q) = %v, want %v", tc.version, got, tc.want)
+		}
+	}
+}
+
+func TestAggregateExprsPostgres(t *testing.T) {
+	db, err := gorm.Open(mockPostgresDialector{}, &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open mock postgres db: %v", err)
+	}
+	tc := &translateContext{db: db, entityType: EntityResource, tableName: "resources"}
+
+	q, err := Parse(`type = resource GROUP BY contentType, created.month PERCENTILE(fileSize, 0.95) COUNT(DISTINCT name) RUNNING_SUM(fileSize)`)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	aggs := q.GroupBy.Aggregates
+
+	if got, _ := tc.aggregateExpr(aggs[0]); got != "percentile_cont(0.95) WITHIN GROUP (ORDER BY resources.file_size)" {
+		t.Errorf("unexpected percentile expression: %s", got)
+	}
+	if got, _ := tc.aggregateExpr(aggs[1]); got != "COUNT(DISTINCT resources.name)" {
+		t.Errorf("unexpected distinct count expression: %s", got)
+	}
+	perGroup, _ := tc.aggregateExpr(aggs[2])
+	want := "SUM(SUM(resources.file_size)) OVER (PARTITION BY resources.content_type ORDER BY to_char(resources.created_at, 'YYYY-MM') NULLS LAST)"
+	if got := runningTotalExpr(perGroup, []string{"resources.content_type", "to_char(resources.created_at, 'YYYY-MM')"}, 1); got != want {
+		t.Errorf("unexpected running total expression:\n%s", got)
+	}
+}
@@ -0,0 +1,155 @@
+package mrql
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// HistoryTable is one table the AS OF clause reconstructs.
+type HistoryTable struct {
+	Name string   // the live table, shadowed under AS OF
+	Key  []string // the columns that identify one row
+}
+
+// HistoryTables mirrors models.HistoryTables (mrql must not import models): the
+// entity tables and their tag, group and note memberships. Each has an
+// append-only <name>_history copy holding every state a row has had, with
+// history_id, history_at and history_removed. A test in application_context
+// keeps the two lists in sync.
+//
+// Everything else — tag, category and note type names, blocks, versions,
+// series, group relations and similarity — is read as it is now.
+var HistoryTables = []HistoryTable{
+	{Name: "resources", Key: []string{"id"}},
+	{Name: "notes", Key: []string{"id"}},
+	{Name: "groups", Key: []string{"id"}},
+	{Name: "resource_tags", Key: []string{"resource_id", "tag_id"}},
+	{Name: "note_tags", Key: []string{"note_id", "tag_id"}},
+	{Name: "group_tags", Key: []string{"group_id", "tag_id"}},
+	{Name: "groups_related_resources", Key: []string{"resource_id", "group_id"}},
+	{Name: "groups_related_notes", Key: []string{"note_id", "group_id"}},
+	{Name: "resource_notes", Key: []string{"resource_id", "note_id"}},
+}
+
+// asOfDateLayouts are the date strings AS OF accepts, read in local time
+// unless they carry an offset. A bare date means its midnight.
+var asOfDateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+func parseAsOfDate(s string) (time.Time, bool) {
+	for _, layout := range asOfDateLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// validateAsOf checks the AS OF moment and the clauses it cannot be combined
+// with: a mutation writes the present, and TEXT reads a full-text index that
+// only holds current content.
+func validateAsOf(q *Query) error {
+	c := q.AsOf
+	if s, ok := c.Value.(*StringLiteral); ok {
+		if _, ok := parseAsOfDate(s.Value); !ok {
+			return &ValidationError{
+				Message: fmt.Sprintf("AS OF expects a date such as \"2025-06-01\" or \"2025-06-01 14:30\", got %q", s.Value),
+				Pos:     s.Token.Pos,
+				Length:  s.Token.Length,
+			}
+		}
+	}
+	if q.Mutation != nil {
+		return &ValidationError{
+			Message: "AS OF cannot be combined with a mutation: history is read-only",
+			Pos:     c.Token.Pos,
+			Length:  len("AS"),
+		}
+	}
+	if text := findTextSearchTarget(q.Where); text != nil {
+		return &ValidationError{
+			Message: "TEXT cannot be combined with AS OF: the full-text index only holds current content",
+			Pos:     text.TextToken.Pos,
+			Length:  text.TextToken.Length,
+		}
+	}
+	return nil
+}
+
+// resolveAsOf converts the AS OF value to the moment it names.
+func resolveAsOf(c *AsOfClause) (time.Time, error) {
+	switch v := c.Value.(type) {
+	case *StringLiteral:
+		if t, ok := parseAsOfDate(v.Value); ok {
+			return t, nil
+		}
+		return time.Time{}, &TranslateError{Message: fmt.Sprintf("invalid AS OF date %q", v.Value), Pos: v.Token.Pos}
+	case *RelDateLiteral:
+		return resolveRelativeDate(v), nil
+	case *FuncCall:
+		return resolveFunction(v)
+	default:
+		return time.Time{}, &TranslateError{Message: fmt.Sprintf("unsupported AS OF value %T", c.Value), Pos: c.Token.Pos}
+	}
+}
+
+// asOfWith builds the CTEs that shadow each history table with its rows as of
+// at: per row key, the latest state recorded by then, unless that state is a
+// removal. SQLite history_at is UTC text with milliseconds (see
+// models.EnsureEntityHistory), so the bound is formatted to match.
+func asOfWith(at time.Time, postgres bool) clause.Expr {
+	var bound any = at
+	if !postgres {
+		bound = at.UTC().Format("2006-01-02 15:04:05.000")
+	}
+	ctes := make([]string, len(HistoryTables))
+	vars := make([]any, len(HistoryTables))
+	for i, t := range HistoryTables {
+		history := t.Name + "_history"
+		ctes[i] = fmt.Sprintf(`"%s" AS (SELECT h.* FROM %s h WHERE h.history_id IN (SELECT MAX(history_id) FROM %s WHERE history_at <= ? GROUP BY %s) AND NOT h.history_removed)`,
+			t.Name, history, history, strings.Join(t.Key, ", "))
+		vars[i] = bound
+	}
+	return clause.Expr{SQL: "WITH " + strings.Join(ctes, ", "), Vars: vars}
+}
+
+// asOfClause puts the AS OF CTEs in front of a statement's SELECT. It merges
+// into the SELECT clause instead of replacing it, and GORM's own SELECT merge
+// keeps it, so later Select, Count and Find calls carry it along. Subqueries
+// written into the statement see the shadowed tables too.
+type asOfClause struct {
+	with clause.Expr
+}
+
+func (asOfClause) Name() string { return "SELECT" }
+
+func (asOfClause) Build(clause.Builder) {}
+
+func (a asOfClause) MergeClause(c *clause.Clause) {
+	c.BeforeExpression = a.with
+}
+
+// ApplyAsOf makes db's statement read q's AS OF state; without an AS OF
+// clause it returns db unchanged. Translate and the Build functions apply it
+// to what they return; callers use it for follow-up reads of the same
+// query, such as loading a cross-entity result's models.
+func ApplyAsOf(q *Query, db *gorm.DB) (*gorm.DB, error) {
+	if q.AsOf == nil {
+		return db, nil
+	}
+	at, err := resolveAsOf(q.AsOf)
+	if err != nil {
+		return nil, err
+	}
+	return db.Clauses(asOfClause{with: asOfWith(at, db.Dialector.Name() == "postgres")}), nil
+}
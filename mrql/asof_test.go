@@ -0,0 +1,166 @@
+package mrql
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// seedAsOfHistory gives every table in HistoryTables a history holding its
+// current rows as of 2020, then records that resource 1 lost its tags and
+// resource 3 was deleted in 2022. The live tables are left as they are.
+func seedAsOfHistory(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	for _, table := range HistoryTables {
+		// Declared types are copied so datetimes still scan as times.
+		var columns []struct{ Name, Type string }
+		if err := db.Raw("SELECT name, type FROM pragma_table_info(?) ORDER BY cid", table.Name).Scan(&columns).Error; err != nil {
+			t.Fatal(err)
+		}
+		defs := []string{"history_id INTEGER PRIMARY KEY", "history_at DATETIME", "history_removed BOOLEAN"}
+		for _, c := range columns {
+			defs = append(defs, c.Name+" "+c.Type)
+		}
+		for _, stmt := range []string{
+			fmt.Sprintf("CREATE TABLE %s_history (%s)", table.Name, strings.Join(defs, ", ")),
+			fmt.Sprintf("INSERT INTO %[1]s_history SELECT rowid, '2020-01-01 00:00:00.000', 0, * FROM %[1]s", table.Name),
+		} {
+			if err := db.Exec(stmt).Error; err != nil {
+				t.Fatalf("%s: %v", stmt, err)
+			}
+		}
+	}
+	for _, stmt := range []string{
+		`INSERT INTO resource_tags_history SELECT 1000 + rowid, '2022-01-01 00:00:00.000', 1, * FROM resource_tags WHERE resource_id = 1`,
+		`INSERT INTO resources_history SELECT 1000, '2022-01-01 00:00:00.000', 1, * FROM resources WHERE id = 3`,
+	} {
+		if err := db.Exec(stmt).Error; err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+}
+
+func TestAsOfExecution(t *testing.T) {
+	db := setupTestDB(t)
+	seedAsOfHistory(t, db)
+
+	for _, tc := range []struct {
+		query string
+		want  []uint
+	}{
+		{`type = resource AS OF "2019-12-31"`, []uint{}},
+		{`type = resource AS OF "2021-01-01"`, []uint{1, 2, 3, 4}},
+		{`type = resource AS OF "2022-01-01 00:00:00"`, []uint{1, 2, 4}},
+		{`type = resource AND tags IS EMPTY AS OF "2023-06-01T12:00"`, append([]uint{1}, runResourceIDs(t, db, `type = resource AND tags IS EMPTY AND id != 3`)...)},
+		{`type = resource AND tags IS NOT EMPTY AS OF "2021-01-01"`, runResourceIDs(t, db, `type = resource AND tags IS NOT EMPTY`)},
+	} {
+		t.Run(tc.query, func(t *testing.T) {
+			got := runResourceIDs(t, db, tc.query)
+			if !eqIDs(got, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+
+	// Counting keeps the CTEs in front of the rewritten SELECT.
+	q := mustParse(t, `type = resource AS OF "2023-01-01"`)
+	built, err := Translate(q, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int64
+	if err := built.Count(&n).Error; err != nil || n != 3 {
+		t.Errorf("count: got %d, %v", n, err)
+	}
+
+	// A cross-entity union carries one WITH, in front of the whole statement.
+	q = mustParse(t, `id = 3 AS OF "2023-01-01"`)
+	union, _, err := TranslateUnion(q, db, TranslateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []map[string]any
+	if err := union.Find(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if row["entity_type"] == "resource" {
+			t.Errorf("deleted resource 3 is in the union: %v", rows)
+		}
+	}
+	sql := union.ToSQL(func(tx *gorm.DB) *gorm.DB { return tx.Find(&[]map[string]any{}) })
+	if !strings.HasPrefix(sql, `WITH "resources" AS (`) || strings.Count(sql, "WITH ") != 1 {
+		t.Errorf("expected a single leading WITH, got %s", sql)
+	}
+}
+
+func TestAsOfParse(t *testing.T) {
+	q := mustParse(t, `type = resource SCOPE 2 AS OF -30d SELECT name`)
+	if q.AsOf == nil || q.Scope == nil || q.Select == nil {
+		t.Fatalf("unexpected query: %+v", q)
+	}
+	if rd, ok := q.AsOf.Value.(*RelDateLiteral); !ok || rd.Amount != 30 || rd.Unit != "d" {
+		t.Errorf("AS OF value: got %#v", q.AsOf.Value)
+	}
+	if fc, ok := mustParse(t, `name = "x" as of now()`).AsOf.Value.(*FuncCall); !ok || !strings.EqualFold(fc.Name, "NOW()") {
+		t.Error("AS OF takes a date function, case-insensitively")
+	}
+
+	// A field named as is still a field.
+	if q := mustParse(t, `as = 1 AND meta.as = 2`); q.AsOf != nil {
+		t.Errorf("as as a field: %+v", q)
+	}
+
+	for _, input := range []string{
+		`type = resource AS`,
+		`type = resource AS OF`,
+		`type = resource AS 2025`,
+		`type = resource AS OF 5`,
+		`type = resource AS OF name`,
+		`type = resource AS OF "2025-01-01" AS OF "2025-02-01"`,
+		`type = resource SELECT name AS OF "2025-01-01"`,
+	} {
+		if _, err := Parse(input); err == nil {
+			t.Errorf("Parse(%q) should fail", input)
+		}
+	}
+
+	if _, err := ParseFilter(EntityResource, `name = "x" AS OF -1d`); err == nil || !strings.Contains(err.Error(), "AS OF is not allowed") {
+		t.Errorf("ParseFilter: expected an AS OF error, got %v", err)
+	}
+}
+
+func TestAsOfValidation(t *testing.T) {
+	for _, query := range []string{
+		`type = resource AS OF "2025-06-01"`,
+		`type = resource AS OF "2025-06-01 14:30"`,
+		`type = resource AS OF "2025-06-01T14:30:05+02:00"`,
+		`type = note AND tags = "x" AS OF START_OF_YEAR() GROUP BY name`,
+	} {
+		if err := Validate(mustParse(t, query)); err != nil {
+			t.Errorf("%s: expected valid, got %v", query, err)
+		}
+	}
+
+	invalid := []struct {
+		query       string
+		errContains string
+	}{
+		{`type = resource AS OF "yesterday"`, `AS OF expects a date`},
+		{`type = resource AS OF "2025-13-01"`, `AS OF expects a date`},
+		{`type = resource AND TEXT ~ "x" AS OF -1d`, "TEXT cannot be combined with AS OF"},
+	}
+	for _, tc := range invalid {
+		err := Validate(mustParse(t, tc.query))
+		if err == nil || !strings.Contains(err.Error(), tc.errContains) {
+			t.Errorf("%s: expected error containing %q, got %v", tc.query, tc.errContains, err)
+		}
+	}
+
+	mutation := mustParseMutation(t, `type = resource AS OF -1d ADD TAGS "x"`)
+	if err := Validate(mutation); err == nil || !strings.Contains(err.Error(), "read-only") {
+		t.Errorf("mutation: expected a read-only error, got %v", err)
+	}
+}
@@ -1,5 +1,11 @@
 package mrql
 
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
 // Node is the interface implemented by all AST nodes.
 type Node interface {
 	nodeType() string
@@ -46,6 +52,20 @@ type InExpr struct {
 func (i *InExpr) nodeType() string { return "InExpr" }
 func (i *InExpr) Pos() int         { return i.Field.Pos() }
 
+// SubqueryInExpr represents: field IN (type = X AND ...) or field NOT IN (...).
+// Where is the inner expression, including its own `type =` comparison;
+// EntityType is the inner entity, resolved by Validate.
+type SubqueryInExpr struct {
+	Field      *FieldExpr
+	Negated    bool
+	InToken    Token
+	Where      Node
+	EntityType EntityType
+}
+
+func (s *SubqueryInExpr) nodeType() string { return "SubqueryInExpr" }
+func (s *SubqueryInExpr) Pos() int         { return s.Field.Pos() }
+
 // IsExpr represents: field IS [NOT] EMPTY/NULL
 type IsExpr struct {
 	Field   *FieldExpr
@@ -79,19 +99,26 @@ type SimilarToExpr struct {
 func (s *SimilarToExpr) nodeType() string { return "SimilarToExpr" }
 func (s *SimilarToExpr) Pos() int         { return s.Token.Pos }
 
-// FieldExpr represents a field reference: name, meta.key, parent.name
+// FieldExpr represents a field reference: name, meta.key, parent.name,
+// relations("depicts").name
 type FieldExpr struct {
 	Parts []Token // e.g., ["parent", "name"] or ["meta", "rating"] or ["name"]
+	// RelationType is the argument of a typed relation root
+	// (relations("depicts")); nil when the root carries none.
+	RelationType *StringLiteral
 }
 
 func (f *FieldExpr) nodeType() string { return "FieldExpr" }
 func (f *FieldExpr) Pos() int         { return f.Parts[0].Pos }
 
 func (f *FieldExpr) Name() string {
+	result := f.Parts[0].Value
+	if f.RelationType != nil {
+		result += "(" + strconv.Quote(f.RelationType.Value) + ")"
+	}
 	if len(f.Parts) == 1 {
-		return f.Parts[0].Value
+		return result
 	}
-	result := f.Parts[0].Value
 	for _, p := range f.Parts[1:] {
 		result += "." + p.Value
 	}
@@ -147,6 +174,38 @@ type FuncCall struct {
 func (f *FuncCall) nodeType() string { return "FuncCall" }
 func (f *FuncCall) Pos() int         { return f.Token.Pos }
 
+// ScalarCall is a scalar function applied to a field of the queried entity:
+// LOWER(name), YEAR(created), JSON_LENGTH(meta.authors), DATE_ADD(created, 3d).
+type ScalarCall struct {
+	Token  Token  // the function name token
+	Name   string // upper-case function name
+	Field  *FieldExpr
+	Offset *DateOffset // DATE_ADD's offset; nil for every other function
+}
+
+func (s *ScalarCall) nodeType() string { return "ScalarCall" }
+func (s *ScalarCall) Pos() int         { return s.Token.Pos }
+
+// DateOffset is a signed calendar offset: 3d, -2w, 1m, -1y.
+type DateOffset struct {
+	Token  Token
+	Amount int
+	Unit   string // "d", "w", "m", "y"
+}
+
+// ScalarComparisonExpr is a comparison with a scalar function call on either
+// side: LOWER(name) = "x", updated > DATE_ADD(created, 3d). Left is a
+// *ScalarCall, or a *FieldExpr when Right is a *ScalarCall; Right is a value
+// or a *ScalarCall.
+type ScalarComparisonExpr struct {
+	Left     Node
+	Operator Token
+	Right    Node
+}
+
+func (s *ScalarComparisonExpr) nodeType() string { return "ScalarComparisonExpr" }
+func (s *ScalarComparisonExpr) Pos() int         { return s.Left.Pos() }
+
 // ParamRef is a parameter placeholder ($name) appearing in a value position.
 // It carries no typed value of its own; BindParams replaces each ParamRef with
 // a concrete literal node before validation and translation.
@@ -160,9 +219,48 @@ func (p *ParamRef) Pos() int         { return p.Token.Pos }
 
 // AggregateFunc represents an aggregate function call: COUNT(), SUM(field), etc.
 type AggregateFunc struct {
-	Token Token      // the aggregate keyword token (COUNT, SUM, etc.)
-	Name  string     // uppercase: "COUNT", "SUM", "AVG", "MIN", "MAX"
-	Field *FieldExpr // nil for COUNT(), required for SUM/AVG/MIN/MAX
+	Token    Token      // the aggregate keyword token (COUNT, SUM, etc.)
+	Name     string     // uppercase: "COUNT", "SUM", "AVG", "MIN", "MAX", "MEDIAN", "PERCENTILE", "RUNNING_SUM", "RUNNING_COUNT"
+	Field    *FieldExpr // nil for COUNT() and RUNNING_COUNT(), required otherwise
+	Distinct bool       // COUNT(DISTINCT field)
+	Fraction float64    // PERCENTILE(field, fraction): 0 <= fraction <= 1
+}
+
+// IsRunning reports whether the aggregate is a running total over the GROUP
+// BY date bucket rather than a per-group value.
+func (a AggregateFunc) IsRunning() bool {
+	return a.Name == "RUNNING_SUM" || a.Name == "RUNNING_COUNT"
+}
+
+// Key returns the result column name of the aggregate, which is also its
+// ORDER BY key: count, count_distinct_name, sum_fileSize, percentile95_fileSize,
+// running_count, running_sum_fileSize.
+func (a AggregateFunc) Key() string {
+	name := strings.ToLower(a.Name)
+	switch {
+	case a.Field == nil:
+		return name
+	case a.Distinct:
+		return name + "_distinct_" + a.Field.Name()
+	case a.Name == "PERCENTILE":
+		pct := strconv.FormatFloat(math.Round(a.Fraction*1e6)/1e4, 'f', -1, 64)
+		return name + strings.ReplaceAll(pct, ".", "_") + "_" + a.Field.Name()
+	}
+	return name + "_" + a.Field.Name()
+}
+
+// String renders the aggregate call as written in MRQL, e.g.
+// COUNT(DISTINCT name) or PERCENTILE(fileSize, 0.95).
+func (a AggregateFunc) String() string {
+	switch {
+	case a.Field == nil:
+		return a.Name + "()"
+	case a.Distinct:
+		return a.Name + "(DISTINCT " + a.Field.Name() + ")"
+	case a.Name == "PERCENTILE":
+		return a.Name + "(" + a.Field.Name() + ", " + strconv.FormatFloat(a.Fraction, 'f', -1, 64) + ")"
+	}
+	return a.Name + "(" + a.Field.Name() + ")"
 }
 
 // HavingComparison is a HAVING leaf condition: aggregate op value.
@@ -185,6 +283,54 @@ type GroupByClause struct {
 	AllFieldNames map[string]bool // all original field names including dropped aliases (set by validator)
 }
 
+// SelectClause is a projection: the columns a query returns in place of
+// whole entities, one row per matching entity.
+//
+//	type = resource SELECT name, meta.rating, fileSize / 1mb AS mb, owner.name
+type SelectClause struct {
+	Token   Token // the SELECT keyword token
+	Columns []SelectColumn
+}
+
+// SelectColumn is one projected column. Expr is a FieldExpr, a NumberLiteral,
+// a ScalarCall, or an ArithExpr over those; Alias is the AS name, "" when
+// absent.
+type SelectColumn struct {
+	Expr  Node
+	Alias string
+}
+
+// Name returns the column's result name: its alias, or else the expression as
+// Print writes it (fileSize / 1mb, owner.name).
+func (c SelectColumn) Name() string {
+	if c.Alias != "" {
+		return c.Alias
+	}
+	return printSelectExpr(c.Expr)
+}
+
+// HasColumn reports whether name is the result name of one of the columns.
+func (s *SelectClause) HasColumn(name string) bool {
+	for _, col := range s.Columns {
+		if col.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ArithExpr is a computed SELECT column: left op right, where op is +, -, *
+// or /. Operands are numeric fields, number literals, numeric scalar calls,
+// or further ArithExprs.
+type ArithExpr struct {
+	Left     Node
+	Operator Token // TokenPlus, TokenMinus, TokenStar, TokenSlash
+	Right    Node
+}
+
+func (a *ArithExpr) nodeType() string { return "ArithExpr" }
+func (a *ArithExpr) Pos() int         { return a.Left.Pos() }
+
 // OrderByClause is a single ORDER BY column+direction.
 // When Random is true the clause is `RANDOM()` (Field is nil, direction ignored).
 type OrderByClause struct {
@@ -200,6 +346,36 @@ type ScopeClause struct {
 	Value Node  // NumberLiteral or StringLiteral
 }
 
+// AsOfClause evaluates the query against the entities, tags, groups and note
+// links as they were at a past moment, reconstructed from the change history
+// (see asof.go). Value is a StringLiteral date, a RelDateLiteral or a
+// FuncCall.
+type AsOfClause struct {
+	Token Token // the AS keyword token
+	Value Node
+}
+
+// Mutation is the write half of a mutation statement (see ParseMutation):
+//
+//	type = resource AND tags = "inbox" ADD TAGS "triaged" REMOVE TAGS "inbox" SET meta.reviewed = true
+//
+// Tag and group references are a StringLiteral (name) or a NumberLiteral (ID),
+// resolved when the mutation is planned.
+type Mutation struct {
+	Token      Token  // the first mutation keyword (for position)
+	AddTags    []Node // ADD TAGS references
+	RemoveTags []Node // REMOVE TAGS references
+	SetMeta    []MetaAssignment
+	MoveTo     Node // MOVE TO group reference; nil when absent
+}
+
+// MetaAssignment is one SET meta.<key> = value. Value is a StringLiteral,
+// NumberLiteral, or BooleanLiteral, or nil for NULL (which removes the key).
+type MetaAssignment struct {
+	Field *FieldExpr
+	Value Node
+}
+
 // EntityType identifies which entity a query targets.
 type EntityType int
 
@@ -230,10 +406,33 @@ type Query struct {
 	Source      string
 	Where       Node            // the filter expression (may be nil)
 	Scope       *ScopeClause    // SCOPE clause (nil when absent)
+	AsOf        *AsOfClause     // AS OF clause (nil when absent)
+	Select      *SelectClause   // SELECT projection (nil when absent)
 	GroupBy     *GroupByClause  // GROUP BY clause (nil when absent)
 	OrderBy     []OrderByClause // ORDER BY clauses (may be empty)
 	Limit       int             // -1 if not specified; per-bucket item cap in grouped mode
 	Offset      int             // -1 if not specified; bucket page offset in grouped mode
 	BucketLimit int             // -1 if not specified; max buckets per page (set by API, not syntax)
 	EntityType  EntityType      // populated by validator or caller
+	Mutation    *Mutation       // write clauses; nil unless parsed by ParseMutation
+
+	// Keyset and After drive cursor pagination (set by API, not syntax).
+	// Keyset appends the primary key to ORDER BY so every row has one total
+	// position; After, when non-nil, resumes strictly after that position and
+	// replaces OFFSET. See cursor.go.
+	Keyset bool
+	After  *Cursor
+}
+
+// IsGrouped reports whether q runs on the grouped execution path, which
+// returns an MRQLGroupedResult rather than entities: a GROUP BY, or a SELECT
+// projection.
+func (q *Query) IsGrouped() bool {
+	return q.GroupBy != nil || q.Select != nil
+}
+
+// IsTabular reports whether q returns flat rows of named columns (see
+// AggregatedColumns): an aggregated GROUP BY, or a SELECT projection.
+func (q *Query) IsTabular() bool {
+	return q.Select != nil || (q.GroupBy != nil && len(q.GroupBy.Aggregates) > 0)
 }
@@ -0,0 +1,141 @@
+package mrql
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Note block content is queried through columns the database derives from
+// each block's JSON (see models.EnsureNoteBlockSearch): search_text backs
+// blocks.text, and the per-block todo counters back todos.count and
+// todos.open.count.
+
+// blockTextColumn is the leaf column behind blocks.text.
+const blockTextColumn = "nb.search_text"
+
+// blockLeafFields are the leaf fields of blocks.X.
+var blockLeafFields = []FieldDef{
+	{Name: "type", Type: FieldString, Column: "type"},
+	{Name: "text", Type: FieldString, Column: blockTextColumn},
+}
+
+// blockCountFields maps the todo count pseudo-fields on notes to the
+// note_blocks counter they total.
+var blockCountFields = map[string]string{
+	"todos.count":      "todo_count",
+	"todos.open.count": "open_todo_count",
+}
+
+// isBlockCountField reports whether f names a todo count pseudo-field,
+// regardless of entity type.
+func isBlockCountField(f *FieldExpr) bool {
+	_, ok := blockCountFields[f.Name()]
+	return ok && f.RelationType == nil
+}
+
+// validateBlockCountField checks that a todo count is used on notes.
+func validateBlockCountField(f *FieldExpr, entityType EntityType) error {
+	if entityType == EntityUnspecified {
+		return &ValidationError{
+			Message: fmt.Sprintf("%s requires an explicit entity type (e.g. type = \"note\")", f.Name()),
+			Pos:     f.Pos(),
+			Length:  len(f.Name()),
+		}
+	}
+	if entityType != EntityNote {
+		return &ValidationError{
+			Message: fmt.Sprintf("field %q is only valid for notes, not %s", f.Name(), entityType),
+			Pos:     f.Pos(),
+			Length:  len(f.Name()),
+		}
+	}
+	return nil
+}
+
+// blockCountOrderExpr returns the correlated total of a todo counter for
+// ORDER BY.
+func (tc *translateContext) blockCountOrderExpr(f *FieldExpr) string {
+	return fmt.Sprintf("(SELECT COALESCE(SUM(nb.%s), 0) FROM note_blocks nb WHERE nb.note_id = %s.id)",
+		blockCountFields[f.Name()], tc.tableName)
+}
+
+// invertedCountOperators maps each count comparison to its negation.
+var invertedCountOperators = map[TokenType]string{
+	TokenEq: "!=", TokenNeq: "=", TokenGt: "<=", TokenGte: "<", TokenLt: ">=", TokenLte: ">",
+}
+
+// translateBlockCount handles todos.count / todos.open.count comparisons. The
+// totals are taken over the blocks with a non-zero counter only — the set a
+// partial index covers — so a comparison that a total of zero satisfies is
+// written as the complement: notes whose non-zero total fails it are excluded.
+func (tc *translateContext) translateBlockCount(db *gorm.DB, expr *ComparisonExpr) (*gorm.DB, error) {
+	if tc.entityType != EntityNote {
+		// Cross-entity field mismatch: FALSE, as for other note-only fields.
+		return db.Where("1 = 0"), nil
+	}
+	nl, ok := expr.Value.(*NumberLiteral)
+	if !ok {
+		return nil, &TranslateError{Message: fmt.Sprintf("%s must be compared to a non-negative integer", expr.Field.Name()), Pos: expr.Value.Pos()}
+	}
+	column := "nb." + blockCountFields[expr.Field.Name()]
+
+	op, inOp := tc.sqlOperator(expr.Operator), "IN"
+	if countSatisfiedByZero(expr.Operator.Type, nl.Value) {
+		op, inOp = invertedCountOperators[expr.Operator.Type], "NOT IN"
+	}
+	return db.Where(fmt.Sprintf("%s.id %s (SELECT nb.note_id FROM note_blocks nb WHERE %s > 0 GROUP BY nb.note_id HAVING SUM(%s) %s ?)",
+		tc.tableName, inOp, column, column, op), int64(nl.Value)), nil
+}
+
+// countSatisfiedByZero reports whether `0 <op> n` holds.
+func countSatisfiedByZero(op TokenType, n float64) bool {
+	switch op {
+	case TokenEq:
+		return n == 0
+	case TokenNeq:
+		return n != 0
+	case TokenGt:
+		return 0 > n
+	case TokenGte:
+		return 0 >= n
+	case TokenLt:
+		return 0 < n
+	case TokenLte:
+		return 0 <= n
+	}
+	return false
+}
+
+// hasBlockTextIndex reports whether the SQLite trigram table over
+// note_blocks.search_text exists. Postgres needs no rewrite: its trigram
+// index serves ILIKE on the column directly.
+func (tc *translateContext) hasBlockTextIndex() bool {
+	if tc.blockTextKnown {
+		return tc.blockTextIndex
+	}
+	tc.blockTextKnown = true
+	if tc.isPostgres() || (tc.ftsKnown && !tc.ftsAvailable) {
+		return false
+	}
+	var count int
+	err := tc.db.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='note_blocks_fts'").Scan(&count).Error
+	tc.blockTextIndex = err == nil && count > 0
+	return tc.blockTextIndex
+}
+
+// blockTextLikeClause matches blocks.text ~ pattern through the trigram table
+// when it exists. The trigram tokenizer only answers LIKE from the index when
+// there is no ESCAPE clause, so the clause is dropped whenever the pattern
+// carries no escaped wildcard.
+func (tc *translateContext) blockTextLikeClause(pattern string) (string, bool) {
+	if !tc.hasBlockTextIndex() {
+		return "", false
+	}
+	escape := ""
+	if strings.Contains(pattern, `\`) {
+		escape = ` ESCAPE '\'`
+	}
+	return "nb.id IN (SELECT rowid FROM note_blocks_fts WHERE search_text LIKE ?" + escape + ")", true
+}
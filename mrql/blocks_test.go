@@ -0,0 +1,125 @@
+package mrql
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// Note blocks and todo counts.
+//
+// Seed (on top of setupTestDB, plus note 3 with no blocks). The derived
+// columns are written directly; the triggers that maintain them live in
+// models.EnsureNoteBlockSearch.
+//
+//	Note 1: text "Invoice from ACME"; todos with 3 items, 1 open.
+//	Note 2: heading "Groceries"; todos with 2 items, none open; todos with 1 item, open.
+func setupBlocksTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := setupTestDB(t)
+	for _, stmt := range []string{
+		`INSERT INTO notes (id, created_at, updated_at, name) VALUES (3, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 'Empty')`,
+		`CREATE TABLE note_blocks (id INTEGER PRIMARY KEY, note_id INTEGER NOT NULL, type TEXT NOT NULL, search_text TEXT NOT NULL DEFAULT '', todo_count INTEGER NOT NULL DEFAULT 0, open_todo_count INTEGER NOT NULL DEFAULT 0)`,
+		`INSERT INTO note_blocks (id, note_id, type, search_text, todo_count, open_todo_count) VALUES
+			(1, 1, 'text', 'Invoice from ACME', 0, 0),
+			(2, 1, 'todos', 'Pay invoice' || char(10) || 'File it' || char(10) || 'Archive', 3, 1),
+			(3, 2, 'heading', 'Groceries', 0, 0),
+			(4, 2, 'todos', 'Milk' || char(10) || 'Eggs', 2, 0),
+			(5, 2, 'todos', 'Bread', 1, 1)`,
+	} {
+		if err := db.Exec(stmt).Error; err != nil {
+			t.Fatalf("seed %q: %v", stmt, err)
+		}
+	}
+	return db
+}
+
+func runNoteIDs(t *testing.T, db *gorm.DB, input string) []uint {
+	t.Helper()
+	result := parseAndTranslate(t, input, EntityNote, db)
+	var rows []testNote
+	if err := result.Find(&rows).Error; err != nil {
+		t.Fatalf("query error for %q: %v", input, err)
+	}
+	ids := make([]uint, 0, len(rows))
+	for _, n := range rows {
+		ids = append(ids, n.ID)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func TestNoteBlockPredicates(t *testing.T) {
+	db := setupBlocksTestDB(t)
+	cases := []struct {
+		query string
+		want  []uint
+	}{
+		{`blocks.type = "todos"`, []uint{1, 2}},
+		{`blocks.type = "HEADING"`, []uint{2}},
+		{`blocks = "text"`, []uint{1}},
+		{`blocks.type != "text"`, []uint{2, 3}},
+		{`blocks.text ~ "invoice"`, []uint{1}},
+		{`blocks.text ~ "gro*"`, []uint{2}},
+		{`blocks.text !~ "invoice"`, []uint{2, 3}},
+		{`blocks IS EMPTY`, []uint{3}},
+		{`blocks.count = 3`, []uint{2}},
+		{`todos.count > 0`, []uint{1, 2}},
+		{`todos.count = 3`, []uint{1, 2}},
+		{`todos.open.count > 0`, []uint{1, 2}},
+		{`todos.open.count = 0`, []uint{3}},
+		{`todos.open.count >= 2`, []uint{}},
+		{`todos.open.count < 2`, []uint{1, 2, 3}},
+		{`todos.open.count != 1`, []uint{3}},
+		{`NOT todos.open.count > 0`, []uint{3}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.query, func(t *testing.T) {
+			got := runNoteIDs(t, db, `type = note AND `+tc.query)
+			if !eqIDs(got, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestNoteBlockTodoCountOrders(t *testing.T) {
+	db := setupBlocksTestDB(t)
+	result := parseAndTranslate(t, `type = note ORDER BY todos.count DESC, id`, EntityNote, db)
+	var rows []testNote
+	if err := result.Find(&rows).Error; err != nil {
+		t.Fatalf("query error: %v", err)
+	}
+	if len(rows) != 3 || rows[0].ID != 1 || rows[1].ID != 2 || rows[2].ID != 3 {
+		t.Fatalf("expected notes ordered 1, 2, 3, got %+v", rows)
+	}
+}
+
+func TestNoteBlockFieldValidation(t *testing.T) {
+	cases := []struct {
+		input      string
+		wantSubstr string
+	}{
+		{`todos.open.count > 0`, "requires an explicit entity type"},
+		{`type = resource AND todos.count > 0`, "only valid for notes"},
+		{`type = note AND todos.count > 1.5`, "must be compared to a non-negative integer"},
+		{`type = note AND todos.open.count ~ "1"`, "only supports comparison operators"},
+		{`type = note AND todos.count IS EMPTY`, "only supports comparison operators"},
+		{`type = note AND todos.done.count > 0`, "not a traversal field"},
+		{`type = note AND blocks.body ~ "x"`, `unknown field "body" for blocks`},
+		{`type = group AND blocks.type = "text"`, "blocks traversal is not valid for entity type group"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.input, func(t *testing.T) {
+			q, err := Parse(tc.input)
+			if err == nil {
+				err = Validate(q)
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantSubstr) {
+				t.Errorf("expected error containing %q, got %v", tc.wantSubstr, err)
+			}
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package mrql
 
-import "strings"
+import (
+	"strconv"
+	"strings"
+)
 
 // Suggestion is a single autocompletion candidate returned by Complete.
 type Suggestion struct {
@@ -32,11 +35,25 @@ var postValueKeywords = []Suggestion{
 	{Value: "AND", Type: "keyword"},
 	{Value: "OR", Type: "keyword"},
 	{Value: "SCOPE", Type: "keyword"},
+	{Value: "AS OF", Type: "keyword", Label: "query a past state"},
+	{Value: "SELECT", Type: "keyword", Label: "project columns"},
 	{Value: "GROUP BY", Type: "keyword"},
 	{Value: "ORDER BY", Type: "keyword"},
 	{Value: "LIMIT", Type: "keyword"},
 }
 
+// postSelectColumnSuggestions are suggested after a complete SELECT column.
+var postSelectColumnSuggestions = []Suggestion{
+	{Value: ",", Type: "operator", Label: "add another column"},
+	{Value: "AS", Type: "keyword", Label: "name the column"},
+	{Value: "+", Type: "operator"},
+	{Value: "-", Type: "operator"},
+	{Value: "*", Type: "operator"},
+	{Value: "/", Type: "operator"},
+	{Value: "ORDER BY", Type: "keyword"},
+	{Value: "LIMIT", Type: "keyword"},
+}
+
 // aggregateSuggestions are suggested after GROUP BY field(s).
 // SUM/AVG/MIN/MAX show with "(field)" to indicate they require an argument.
 var aggregateSuggestions = []Suggestion{
@@ -45,8 +62,17 @@ var aggregateSuggestions = []Suggestion{
 	{Value: "AVG(field)", Type: "function", Label: "average of numeric field"},
 	{Value: "MIN(field)", Type: "function", Label: "minimum value"},
 	{Value: "MAX(field)", Type: "function", Label: "maximum value"},
+	{Value: "COUNT(DISTINCT field)", Type: "function", Label: "count distinct values"},
+	{Value: "MEDIAN(field)", Type: "function", Label: "median of numeric field"},
+	{Value: "PERCENTILE(field, 0.95)", Type: "function", Label: "percentile of numeric field"},
+	{Value: "RUNNING_COUNT()", Type: "function", Label: "running row count over the date bucket"},
+	{Value: "RUNNING_SUM(field)", Type: "function", Label: "running sum over the date bucket"},
 }
 
+// havingAggregateSuggestions are suggested after HAVING: the aggregates
+// minus the running totals, which HAVING cannot filter on.
+var havingAggregateSuggestions = aggregateSuggestions[:len(aggregateSuggestions)-2]
+
 // postAggregateKeywords are suggested after aggregate functions in GROUP BY context.
 var postAggregateKeywords = []Suggestion{
 	{Value: "COUNT()", Type: "function", Label: "count rows"},
@@ -54,6 +80,11 @@ var postAggregateKeywords = []Suggestion{
 	{Value: "AVG(field)", Type: "function", Label: "average of numeric field"},
 	{Value: "MIN(field)", Type: "function", Label: "minimum value"},
 	{Value: "MAX(field)", Type: "function", Label: "maximum value"},
+	{Value: "COUNT(DISTINCT field)", Type: "function", Label: "count distinct values"},
+	{Value: "MEDIAN(field)", Type: "function", Label: "median of numeric field"},
+	{Value: "PERCENTILE(field, 0.95)", Type: "function", Label: "percentile of numeric field"},
+	{Value: "RUNNING_COUNT()", Type: "function", Label: "running row count over the date bucket"},
+	{Value: "RUNNING_SUM(field)", Type: "function", Label: "running sum over the date bucket"},
 	{Value: "HAVING", Type: "keyword", Label: "filter aggregated buckets"},
 	{Value: "ORDER BY", Type: "keyword"},
 	{Value: "LIMIT", Type: "keyword"},
@@ -87,6 +118,10 @@ func countFieldSuggestions(entityType EntityType) []Suggestion {
 		appendCountable(resourceFields)
 	case EntityNote:
 		appendCountable(noteFields)
+		suggs = append(suggs,
+			Suggestion{Value: "todos.count", Type: "field", Label: "todo items"},
+			Suggestion{Value: "todos.open.count", Type: "field", Label: "unchecked todo items"},
+		)
 	case EntityGroup:
 		appendCountable(groupFields)
 	}
@@ -100,6 +135,14 @@ var entityTypeSuggestions = []Suggestion{
 	{Value: "group", Type: "entity_type"},
 }
 
+// dateOffsetSuggestions are example DATE_ADD offsets.
+var dateOffsetSuggestions = []Suggestion{
+	{Value: "7d", Type: "rel_date", Label: "7 days later"},
+	{Value: "-7d", Type: "rel_date", Label: "7 days earlier"},
+	{Value: "1m", Type: "rel_date", Label: "1 month later"},
+	{Value: "1y", Type: "rel_date", Label: "1 year later"},
+}
+
 // relDateSuggestions are example relative dates suggested after a date field.
 var relDateSuggestions = []Suggestion{
 	{Value: "-7d", Type: "rel_date", Label: "7 days ago"},
@@ -117,6 +160,67 @@ var funcSuggestions = []Suggestion{
 	{Value: "START_OF_YEAR()", Type: "function", Label: "start of this year"},
 }
 
+// asOfValueSuggestions are suggested after AS OF: a date, a relative date, or
+// a date function.
+var asOfValueSuggestions = append(append([]Suggestion{
+	{Value: `"2025-06-01"`, Type: "value", Label: "date, optionally with a time"},
+}, relDateSuggestions...), funcSuggestions...)
+
+// postAsOfSuggestions are suggested after the AS OF value.
+var postAsOfSuggestions = []Suggestion{
+	{Value: "SELECT", Type: "keyword", Label: "project columns"},
+	{Value: "GROUP BY", Type: "keyword"},
+	{Value: "ORDER BY", Type: "keyword"},
+	{Value: "LIMIT", Type: "keyword"},
+}
+
+// scalarFunctionSuggestions are the argument-taking functions, suggested
+// where a comparison or a SELECT column can start.
+var scalarFunctionSuggestions = []Suggestion{
+	{Value: "LOWER(", Type: "function", Label: "lower-cased text"},
+	{Value: "UPPER(", Type: "function", Label: "upper-cased text"},
+	{Value: "LENGTH(", Type: "function", Label: "text length"},
+	{Value: "EXT(", Type: "function", Label: "file extension"},
+	{Value: "YEAR(", Type: "function", Label: "year of a date"},
+	{Value: "MONTH(", Type: "function", Label: "month of a date"},
+	{Value: "DAY(", Type: "function", Label: "day of a date"},
+	{Value: "DATE_ADD(", Type: "function", Label: "date plus an offset"},
+	{Value: "JSON_LENGTH(", Type: "function", Label: "meta array or object size"},
+}
+
+// scalarArgSuggestions returns the fields function fn accepts as its
+// argument on entityType.
+func scalarArgSuggestions(fn string, entityType EntityType) []Suggestion {
+	arg := scalarFunctions[strings.ToUpper(fn)].arg
+	if arg == FieldMeta {
+		return metaSubFieldSuggestions
+	}
+	var suggs []Suggestion
+	for _, fd := range fieldSuggestions(entityType) {
+		if def, ok := LookupField(entityType, fd.Value); ok && def.Type == arg && def.Name != "shared" {
+			suggs = append(suggs, fd)
+		}
+	}
+	return suggs
+}
+
+// scalarCallBefore returns the name of the scalar function whose call ends
+// just before tokens[idx] with a ")", and the index of its name token.
+func scalarCallBefore(tokens []Token, idx int) (string, int) {
+	if idx < 1 || tokens[idx-1].Type != TokenRParen {
+		return "", -1
+	}
+	for i := idx - 2; i >= 1; i-- {
+		if tokens[i].Type == TokenLParen {
+			if tokens[i-1].Type == TokenScalarFunc {
+				return strings.ToUpper(tokens[i-1].Value), i - 1
+			}
+			return "", -1
+		}
+	}
+	return "", -1
+}
+
 // metaSubFieldSuggestions are generic sub-field hints after "meta.".
 var metaSubFieldSuggestions = []Suggestion{
 	{Value: "meta.<key>", Type: "field", Label: "any meta key"},
@@ -166,6 +270,40 @@ func recursiveSubFieldSuggestions() []Suggestion {
 	return suggestions
 }
 
+// relatedSubFieldSuggestions returns leaf-field suggestions after a related
+// root (series. / versions. / currentVersion. / relations. / backRelations.).
+func relatedSubFieldSuggestions(root relatedRoot) []Suggestion {
+	var suggestions []Suggestion
+	for _, fd := range root.fields {
+		if fd.Column == relationTypeColumn {
+			suggestions = append(suggestions, Suggestion{Value: fd.Name, Type: "field", Label: "relation type"})
+			continue
+		}
+		suggestions = append(suggestions, Suggestion{Value: fd.Name, Type: "field"})
+	}
+	if root.groupLeaf {
+		suggestions = append(suggestions, Suggestion{Value: "tags", Type: "field", Label: "group tag"})
+	}
+	if root.meta {
+		suggestions = append(suggestions, Suggestion{Value: "meta.", Type: "field", Label: "meta field"})
+	}
+	if !root.singleReference() {
+		suggestions = append(suggestions, Suggestion{Value: "count", Type: "field", Label: "relation count"})
+	}
+	return suggestions
+}
+
+// typedRootBeforeDot returns the typed relation root whose argument list
+// closes just before the trailing dot: relations("depicts").
+func typedRootBeforeDot(tokens []Token) (relatedRoot, bool) {
+	n := len(tokens)
+	if n < 5 || tokens[n-2].Type != TokenRParen || tokens[n-4].Type != TokenLParen {
+		return relatedRoot{}, false
+	}
+	root, ok := relatedRoots[tokens[n-5].Value]
+	return root, ok && root.typed
+}
+
 // dateFieldNames is the set of field names that hold date/time values.
 var dateFieldNames = map[string]bool{
 	"created": true,
@@ -292,11 +430,19 @@ func fieldSuggestions(entityType EntityType) []Suggestion {
 		suggs = append(suggs, Suggestion{Value: "descendants.name", Type: "field", Label: "any descendant group"})
 	}
 
+	// Typed group relations take the relation type as an argument.
+	if entityType == EntityGroup {
+		suggs = append(suggs, Suggestion{Value: `relations("`, Type: "field", Label: "relations of one type"})
+		suggs = append(suggs, Suggestion{Value: `backRelations("`, Type: "field", Label: "back relations of one type"})
+	}
+
 	// Perceptual similarity predicate — resources only.
 	if entityType == EntityResource {
 		suggs = append(suggs, Suggestion{Value: "SIMILAR TO resource(", Type: "keyword", Label: "perceptual similarity"})
 	}
 
+	suggs = append(suggs, scalarFunctionSuggestions...)
+
 	// Always add TEXT keyword as a special entry.
 	suggs = append(suggs, Suggestion{Value: "TEXT", Type: "keyword", Label: "full-text search"})
 
@@ -328,6 +474,10 @@ func groupByFieldSuggestions(entityType EntityType) []Suggestion {
 		seen[s.Value] = true
 	}
 	for _, fd := range extra {
+		// Set-valued related roots (versions, relations) are not groupable.
+		if root, ok := relatedRoots[fd.Name]; ok && !root.groupable {
+			continue
+		}
 		if !seen[fd.Name] {
 			suggs = append(suggs, Suggestion{Value: fd.Name, Type: "field"})
 			seen[fd.Name] = true
@@ -481,7 +631,7 @@ func extractAggregatedOrderKeys(tokens []Token) []Suggestion {
 	// Check if there are any aggregate tokens after GROUP BY
 	hasAggregates := false
 	for _, t := range tokens[gbIdx:] {
-		if t.Type == TokenCount || t.Type == TokenSum || t.Type == TokenAvg || t.Type == TokenMin || t.Type == TokenMax {
+		if isAggregateToken(t.Type) {
 			hasAggregates = true
 			break
 		}
@@ -496,7 +646,7 @@ func extractAggregatedOrderKeys(tokens []Token) []Suggestion {
 	i := gbIdx + 1
 	for i < len(tokens) {
 		t := tokens[i]
-		if t.Type == TokenCount || t.Type == TokenSum || t.Type == TokenAvg || t.Type == TokenMin || t.Type == TokenMax ||
+		if isAggregateToken(t.Type) ||
 			t.Type == TokenHaving || t.Type == TokenOrderBy || t.Type == TokenLimit || t.Type == TokenOffset {
 			break
 		}
@@ -521,32 +671,10 @@ func extractAggregatedOrderKeys(tokens []Token) []Suggestion {
 		if t.Type == TokenHaving || t.Type == TokenOrderBy || t.Type == TokenLimit || t.Type == TokenOffset {
 			break
 		}
-		switch t.Type {
-		case TokenCount:
-			suggs = append(suggs, Suggestion{Value: "count", Type: "field", Label: "COUNT() result"})
-		case TokenSum, TokenAvg, TokenMin, TokenMax:
-			// Look for the field argument: AGG ( field )
-			aggName := strings.ToLower(t.Value)
-			if i+3 < len(tokens) && tokens[i+1].Type == TokenLParen {
-				// Build dotted field name inside parens
-				j := i + 2
-				fieldName := ""
-				for j < len(tokens) && tokens[j].Type != TokenRParen {
-					if tokens[j].Type == TokenIdentifier || tokens[j].Type == TokenKwType {
-						if fieldName != "" {
-							fieldName += "."
-						}
-						fieldName += tokens[j].Value
-					}
-					j++
-				}
-				if fieldName != "" {
-					suggs = append(suggs, Suggestion{
-						Value: aggName + "_" + fieldName,
-						Type:  "field",
-						Label: strings.ToUpper(aggName) + "(" + fieldName + ") result",
-					})
-				}
+		if isAggregateToken(t.Type) {
+			agg := aggregateFromTokens(tokens[i:])
+			if agg.Field != nil || (!agg.Distinct && (agg.Name == "COUNT" || agg.Name == "RUNNING_COUNT")) {
+				suggs = append(suggs, Suggestion{Value: agg.Key(), Type: "field", Label: agg.String() + " result"})
 			}
 		}
 		i++
@@ -555,6 +683,87 @@ func extractAggregatedOrderKeys(tokens []Token) []Suggestion {
 	return suggs
 }
 
+// aggregateFromTokens reads the aggregate call starting at tokens[0] — the
+// aggregate keyword — as far as it has been typed. Field is nil when no field
+// argument has been typed yet.
+func aggregateFromTokens(tokens []Token) AggregateFunc {
+	agg := AggregateFunc{Token: tokens[0], Name: strings.ToUpper(tokens[0].Value)}
+	if len(tokens) < 2 || tokens[1].Type != TokenLParen {
+		return agg
+	}
+	fieldName := ""
+	for j := 2; j < len(tokens) && tokens[j].Type != TokenRParen; j++ {
+		switch tok := tokens[j]; {
+		case tok.Type == TokenIdentifier && j == 2 && strings.EqualFold(tok.Value, "DISTINCT"):
+			agg.Distinct = true
+		case tok.Type == TokenIdentifier || tok.Type == TokenKwType:
+			if fieldName != "" {
+				fieldName += "."
+			}
+			fieldName += tok.Value
+		case tok.Type == TokenNumber:
+			agg.Fraction, _ = strconv.ParseFloat(tok.Value, 64)
+		}
+	}
+	if fieldName != "" {
+		agg.Field = &FieldExpr{Parts: []Token{{Type: TokenIdentifier, Value: fieldName}}}
+	}
+	return agg
+}
+
+// isInSelectClause returns true if the cursor is within a SELECT clause
+// (between SELECT and ORDER BY/LIMIT/OFFSET/EOF). SELECT is a contextual
+// word, so it only counts after a complete value, as the parser reads it.
+func isInSelectClause(tokens []Token) bool {
+	found := false
+	for i, t := range tokens {
+		if i > 0 && isSelectStart(t) && endsValue(tokens[i-1]) {
+			found = true
+		}
+		if found && (t.Type == TokenOrderBy || t.Type == TokenLimit || t.Type == TokenOffset) {
+			return false
+		}
+	}
+	return found
+}
+
+// asOfTokenIndex returns the index of the AS that starts an AS OF clause, or
+// -1. Like SELECT, AS only starts the clause after a complete value.
+func asOfTokenIndex(tokens []Token) int {
+	for i, t := range tokens {
+		if i == 0 || !endsValue(tokens[i-1]) {
+			continue
+		}
+		if isAsOfStart(t) {
+			return i
+		}
+		if isSelectStart(t) {
+			return -1
+		}
+	}
+	return -1
+}
+
+// selectFieldSuggestions returns field suggestions valid as SELECT columns:
+// the sortable fields, relation counts, and single-reference names.
+func selectFieldSuggestions(entityType EntityType) []Suggestion {
+	suggs := orderByFieldSuggestions(entityType)
+	suggs = append(suggs, countFieldSuggestions(entityType)...)
+	switch entityType {
+	case EntityResource:
+		suggs = append(suggs,
+			Suggestion{Value: "owner.name", Type: "field", Label: "owner group name"},
+			Suggestion{Value: "series.name", Type: "field", Label: "series name"},
+			Suggestion{Value: "currentVersion.number", Type: "field", Label: "current version number"},
+		)
+	case EntityNote:
+		suggs = append(suggs, Suggestion{Value: "owner.name", Type: "field", Label: "owner group name"})
+	case EntityGroup:
+		suggs = append(suggs, Suggestion{Value: "parent.name", Type: "field", Label: "parent group name"})
+	}
+	return append(suggs, scalarFunctionSuggestions...)
+}
+
 // isInGroupByClause returns true if the cursor is within the GROUP BY clause
 // (between GROUP BY and ORDER BY/LIMIT/OFFSET/EOF). Returns false if we've
 // moved past into ORDER BY or LIMIT territory.
@@ -592,6 +801,20 @@ func suggestionsForContext(tokens []Token, entityType EntityType, cursor int) []
 		return groupByFieldSuggestions(entityType)
 	}
 
+	// After relations( / backRelations( — the relation type argument.
+	if last.Type == TokenLParen && len(tokens) >= 2 && relatedRoots[tokens[len(tokens)-2].Value].typed {
+		return []Suggestion{{Value: `"relation type"`, Type: "value", Label: "relation type name"}}
+	}
+
+	// After LOWER( / YEAR( / ... — the fields the function takes.
+	if last.Type == TokenLParen && len(tokens) >= 2 && tokens[len(tokens)-2].Type == TokenScalarFunc {
+		return scalarArgSuggestions(tokens[len(tokens)-2].Value, entityType)
+	}
+	// After DATE_ADD(field, — an offset.
+	if last.Type == TokenComma && len(tokens) >= 4 && tokens[len(tokens)-4].Type == TokenScalarFunc {
+		return dateOffsetSuggestions
+	}
+
 	// After AND / OR / NOT / "(" — suggest fields.
 	switch last.Type {
 	case TokenAnd, TokenOr, TokenNot, TokenLParen:
@@ -607,6 +830,20 @@ func suggestionsForContext(tokens []Token, entityType EntityType, cursor int) []
 			return dateBucketSuffixSuggestions
 		}
 
+		if root, ok := typedRootBeforeDot(tokens); ok {
+			return relatedSubFieldSuggestions(root)
+		}
+		if root, ok := relatedRoots[prev.Value]; ok && root.entityType == entityType {
+			return relatedSubFieldSuggestions(root)
+		}
+
+		if entityType == EntityNote && prev.Value == "todos" {
+			return []Suggestion{
+				{Value: "count", Type: "field", Label: "todo items"},
+				{Value: "open.count", Type: "field", Label: "unchecked todo items"},
+			}
+		}
+
 		switch prev.Value {
 		case "parent", "children", "owner":
 			suggs := traversalSubFieldSuggestions(entityType)
@@ -647,7 +884,7 @@ func suggestionsForContext(tokens []Token, entityType EntityType, cursor int) []
 		}
 		// After HAVING — suggest aggregate functions again.
 		if last.Type == TokenHaving {
-			return aggregateSuggestions
+			return havingAggregateSuggestions
 		}
 		// After closing paren in GROUP BY clause — suggest more aggregates or ORDER BY/LIMIT.
 		if last.Type == TokenRParen {
@@ -655,6 +892,44 @@ func suggestionsForContext(tokens []Token, entityType EntityType, cursor int) []
 		}
 	}
 
+	// AS OF context: OF, then the moment, then the clauses that may follow.
+	if n := asOfTokenIndex(tokens); n >= 0 {
+		switch len(tokens) - n {
+		case 1:
+			if !cursorAtTokenEnd {
+				return []Suggestion{{Value: "OF", Type: "keyword"}}
+			}
+		case 2:
+			if !cursorAtTokenEnd {
+				return asOfValueSuggestions
+			}
+		case 3:
+			if !cursorAtTokenEnd {
+				return postAsOfSuggestions
+			}
+		}
+	}
+
+	// SELECT context: columns, then AS, arithmetic, or the next clause.
+	if isInSelectClause(tokens) {
+		switch last.Type {
+		case TokenComma, TokenPlus, TokenMinus, TokenStar, TokenSlash:
+			return selectFieldSuggestions(entityType)
+		case TokenNumber, TokenRParen:
+			return postSelectColumnSuggestions
+		case TokenIdentifier, TokenKwType:
+			switch {
+			case strings.EqualFold(last.Value, "AS"):
+				return nil // the column name is free text
+			case isSelectStart(last) || cursorAtTokenEnd:
+				return selectFieldSuggestions(entityType)
+			case len(tokens) >= 2 && strings.EqualFold(tokens[len(tokens)-2].Value, "AS"):
+				return []Suggestion{{Value: ",", Type: "operator", Label: "add another column"}, {Value: "ORDER BY", Type: "keyword"}, {Value: "LIMIT", Type: "keyword"}}
+			}
+			return postSelectColumnSuggestions
+		}
+	}
+
 	// ORDER BY context: suggest sortable fields, directions, and next-clause keywords.
 	if isInOrderByClause(tokens) {
 		// In aggregated GROUP BY mode, ORDER BY can only reference group fields
@@ -717,6 +992,10 @@ func suggestionsForContext(tokens []Token, entityType EntityType, cursor int) []
 	// — suggest logical connectives / ORDER BY / LIMIT.
 	switch last.Type {
 	case TokenString, TokenNumber, TokenRelDate, TokenFunc, TokenRParen:
+		// A call that starts a comparison, LOWER(name), takes an operator.
+		if _, start := scalarCallBefore(tokens, len(tokens)); start >= 0 && startsComparison(tokens, start) {
+			return operators
+		}
 		// After the ")" of SIMILAR TO resource(N), WITHIN is also available.
 		if last.Type == TokenRParen && endsWithSimilarToClose(tokens) {
 			return append([]Suggestion{{Value: "WITHIN", Type: "keyword", Label: "max perceptual distance"}}, postValueKeywords...)
@@ -736,6 +1015,19 @@ func suggestionsForContext(tokens []Token, entityType EntityType, cursor int) []
 	return nil
 }
 
+// startsComparison reports whether tokens[idx] begins a comparison rather
+// than being its value.
+func startsComparison(tokens []Token, idx int) bool {
+	if idx == 0 {
+		return true
+	}
+	switch tokens[idx-1].Type {
+	case TokenAnd, TokenOr, TokenNot, TokenLParen:
+		return true
+	}
+	return false
+}
+
 // isOperatorToken returns true when tok is a comparison/equality operator.
 func isOperatorToken(tok Token) bool {
 	switch tok.Type {
@@ -756,11 +1048,12 @@ func valuesuggestions(tokens []Token, entityType EntityType) []Suggestion {
 		return entityTypeSuggestions
 	}
 
-	// Date fields → suggest relative dates + functions.
-	if dateFieldNames[strings.ToLower(fieldName)] {
+	// Date fields and DATE_ADD(...) → suggest relative dates + functions.
+	if dateFieldNames[strings.ToLower(fieldName)] || comparesDateCall(tokens) {
 		var suggs []Suggestion
 		suggs = append(suggs, relDateSuggestions...)
 		suggs = append(suggs, funcSuggestions...)
+		suggs = append(suggs, Suggestion{Value: "DATE_ADD(", Type: "function", Label: "date plus an offset"})
 		return suggs
 	}
 
@@ -770,6 +1063,18 @@ func valuesuggestions(tokens []Token, entityType EntityType) []Suggestion {
 	}
 }
 
+// comparesDateCall reports whether the most recent operator follows a
+// date-valued scalar call.
+func comparesDateCall(tokens []Token) bool {
+	for i := len(tokens) - 1; i >= 0; i-- {
+		if isOperatorToken(tokens[i]) {
+			fn, _ := scalarCallBefore(tokens, i)
+			return fn != "" && scalarFunctions[fn].result == FieldDateTime
+		}
+	}
+	return false
+}
+
 // extractFieldBeforeOperator scans backwards through tokens to find the field
 // name (simple or qualified) that appears before the most recent operator.
 // Returns the field name string, or "" if not found.
@@ -803,3 +1108,113 @@ func extractFieldBeforeOperator(tokens []Token) string {
 	}
 	return ""
 }
+
+// CompletionTarget describes what the text before a cursor is completing, for
+// a caller that can offer live values — tag names, meta keys — that Complete
+// has no way to know.
+type CompletionTarget struct {
+	// EntityType is the entity the query selects, as far as the prefix shows.
+	EntityType EntityType
+	// Field is the field whose value is being typed ("tags", "owner.name"),
+	// or "" when the cursor is not in a value position.
+	Field string
+	// MetaKey is set when the cursor is on the key after "meta.".
+	MetaKey bool
+	// Prefix is the partial word under the cursor, without an opening quote,
+	// and Start is the byte offset the word (quote included) begins at.
+	Prefix string
+	Start  int
+}
+
+// CompletionTargetAt reports what the text before cursor is completing.
+func CompletionTargetAt(query string, cursor int) CompletionTarget {
+	if cursor < 0 {
+		cursor = 0
+	}
+	if cursor > len(query) {
+		cursor = len(query)
+	}
+	target := CompletionTarget{Start: cursor}
+	if len(query) > MaxQueryBytes {
+		return target
+	}
+	tokens, limitErr := tokeniseAll(query[:cursor])
+	if limitErr != nil {
+		return target
+	}
+	target.EntityType = detectEntityType(tokens)
+
+	// A token that ends at the cursor is still being typed: it is the prefix,
+	// and the context is what came before it. An unterminated string lexes as
+	// an illegal token, which is exactly the half-typed value case.
+	if n := len(tokens); n > 0 && tokens[n-1].Pos+tokens[n-1].Length == cursor {
+		last := tokens[n-1]
+		switch last.Type {
+		case TokenIdentifier, TokenString, TokenIllegal, TokenNumber, TokenKwType, TokenHaving:
+			target.Start = last.Pos
+			target.Prefix = strings.TrimLeft(query[last.Pos:cursor], `"'`)
+			tokens = tokens[:n-1]
+		}
+	}
+	if len(tokens) == 0 {
+		return target
+	}
+
+	last := tokens[len(tokens)-1]
+	if last.Type == TokenDot && len(tokens) >= 2 && strings.EqualFold(tokens[len(tokens)-2].Value, "meta") {
+		target.MetaKey = true
+		return target
+	}
+
+	// A value position: straight after an operator, or anywhere in an IN list.
+	opIdx := -1
+	switch {
+	case isOperatorToken(last) || last.Type == TokenRegex || last.Type == TokenNotRegex:
+		opIdx = len(tokens) - 1
+	case last.Type == TokenLParen || last.Type == TokenComma:
+		opIdx = openInListIndex(tokens)
+	}
+	if opIdx > 0 {
+		target.Field = fieldBefore(tokens, opIdx)
+	}
+	return target
+}
+
+// openInListIndex returns the index of the IN whose parenthesised list the
+// token sequence ends inside, or -1.
+func openInListIndex(tokens []Token) int {
+	depth := 0
+	for i := len(tokens) - 1; i >= 0; i-- {
+		switch tokens[i].Type {
+		case TokenRParen:
+			depth++
+		case TokenLParen:
+			if depth > 0 {
+				depth--
+				continue
+			}
+			if i > 0 && tokens[i-1].Type == TokenIn {
+				return i - 1
+			}
+			return -1
+		}
+	}
+	return -1
+}
+
+// fieldBefore returns the dotted field name that ends just before tokens[idx].
+func fieldBefore(tokens []Token, idx int) string {
+	var parts []string
+	for i := idx - 1; i >= 0; i-- {
+		tok := tokens[i]
+		if !isFieldNameToken(tok) {
+			break
+		}
+		parts = append([]string{tok.Value}, parts...)
+		if i == 0 || tokens[i-1].Type != TokenDot {
+			break
+		}
+		i--
+	}
+	return strings.Join(parts, ".")
+}
@@ -653,3 +653,116 @@ func TestComplete_SuggestionStructure(t *testing.T) {
 		}
 	}
 }
+
+func TestCompletionTargetAt(t *testing.T) {
+	tests := []struct {
+		query string
+		want  CompletionTarget
+	}{
+		{`type = resource AND tags = "ph`, CompletionTarget{EntityType: EntityResource, Field: "tags", Prefix: "ph", Start: 27}},
+		{`type = resource AND tags = `, CompletionTarget{EntityType: EntityResource, Field: "tags", Start: 27}},
+		{`type = note AND owner.name ~ "Pro`, CompletionTarget{EntityType: EntityNote, Field: "owner.name", Prefix: "Pro", Start: 29}},
+		{`type = group AND tags IN ("a", "b`, CompletionTarget{EntityType: EntityGroup, Field: "tags", Prefix: "b", Start: 31}},
+		{`type = note AND meta.pri`, CompletionTarget{EntityType: EntityNote, MetaKey: true, Prefix: "pri", Start: 21}},
+		{`type = note AND meta.`, CompletionTarget{EntityType: EntityNote, MetaKey: true, Start: 21}},
+		{`type = note AND na`, CompletionTarget{EntityType: EntityNote, Prefix: "na", Start: 16}},
+		{`type = note AND tags IN (type = group) AND `, CompletionTarget{EntityType: EntityNote, Start: 43}},
+	}
+	for _, tt := range tests {
+		if got := CompletionTargetAt(tt.query, len(tt.query)); got != tt.want {
+			t.Errorf("CompletionTargetAt(%q) = %+v, want %+v", tt.query, got, tt.want)
+		}
+	}
+}
+
+// TestComplete_Select verifies SELECT is offered after a value and that the
+// SELECT clause suggests columns, then operators and the next clauses.
+func TestComplete_Select(t *testing.T) {
+	after := func(query string) []Suggestion { return Complete(query, len(query)) }
+
+	if !hasSuggestion(after(`type = "resource" `), "SELECT") {
+		t.Error("expected SELECT after a complete filter")
+	}
+	sugg := after(`type = resource SELECT `)
+	for _, want := range []string{"name", "fileSize", "tags.count", "owner.name"} {
+		if !hasSuggestion(sugg, want) {
+			t.Errorf("expected column %q after SELECT, got: %v", want, sugg)
+		}
+	}
+	if hasSuggestion(sugg, "type") || hasSuggestion(sugg, "tags") {
+		t.Error("type and tags are not SELECT columns")
+	}
+	sugg = after(`type = resource SELECT fileSize `)
+	for _, want := range []string{",", "AS", "/", "ORDER BY"} {
+		if !hasSuggestion(sugg, want) {
+			t.Errorf("expected %q after a SELECT column, got: %v", want, sugg)
+		}
+	}
+	if !hasSuggestion(after(`type = resource SELECT fileSize / `), "width") {
+		t.Error("expected columns after an arithmetic operator")
+	}
+	if !hasSuggestion(after(`type = resource SELECT name, `), "created") {
+		t.Error("expected columns after a comma")
+	}
+	if got := after(`type = resource SELECT name AS `); len(got) != 0 {
+		t.Errorf("an alias is free text, got: %v", got)
+	}
+	if !hasSuggestion(after(`type = resource SELECT name ORDER BY `), "name") {
+		t.Error("ORDER BY after SELECT suggests sort keys")
+	}
+}
+
+func TestComplete_ScalarFunctions(t *testing.T) {
+	after := func(query string) []Suggestion { return Complete(query, len(query)) }
+
+	if !hasSuggestion(after(`type = resource AND `), "EXT(") {
+		t.Error("expected scalar functions where a comparison starts")
+	}
+	sugg := after(`type = resource AND YEAR(`)
+	if !hasSuggestion(sugg, "created") || hasSuggestion(sugg, "name") {
+		t.Errorf("YEAR( should suggest date fields only, got: %v", sugg)
+	}
+	if !hasSuggestion(after(`type = resource AND JSON_LENGTH(`), "meta.<key>") {
+		t.Error("JSON_LENGTH( should suggest meta keys")
+	}
+	if !hasSuggestion(after(`type = resource AND DATE_ADD(created, `), "7d") {
+		t.Error("expected an offset after DATE_ADD(field,")
+	}
+	if !hasSuggestion(after(`type = resource AND LOWER(name) `), "=") {
+		t.Error("expected operators after a call that starts a comparison")
+	}
+	if !hasSuggestion(after(`type = resource AND DATE_ADD(created, 3d) > `), "NOW()") {
+		t.Error("expected date values after a DATE_ADD comparison")
+	}
+	if !hasSuggestion(after(`type = resource AND updated > `), "DATE_ADD(") {
+		t.Error("expected DATE_ADD among date values")
+	}
+	if !hasSuggestion(after(`type = resource AND updated > DATE_ADD(created, 3d) `), "AND") {
+		t.Error("expected connectives after a call used as a value")
+	}
+	if !hasSuggestion(after(`type = resource SELECT `), "LENGTH(") {
+		t.Error("expected scalar functions as SELECT columns")
+	}
+}
+
+func TestComplete_AsOf(t *testing.T) {
+	after := func(query string) []Suggestion { return Complete(query, len(query)) }
+
+	if !hasSuggestion(after(`type = resource SCOPE 3 `), "AS OF") {
+		t.Error("expected AS OF after SCOPE")
+	}
+	if !hasSuggestion(after(`type = resource AS `), "OF") {
+		t.Error("expected OF after AS")
+	}
+	sugg := after(`type = resource AS OF `)
+	if !hasSuggestion(sugg, `"2025-06-01"`) || !hasSuggestion(sugg, "-30d") || !hasSuggestion(sugg, "START_OF_MONTH()") {
+		t.Errorf("expected dates after AS OF, got: %v", sugg)
+	}
+	sugg = after(`type = resource AS OF -30d `)
+	if !hasSuggestion(sugg, "SELECT") || hasSuggestion(sugg, "SCOPE") || hasSuggestion(sugg, "AND") {
+		t.Errorf("expected the clauses after AS OF, got: %v", sugg)
+	}
+	if got := after(`type = resource SELECT name AS `); len(got) != 0 {
+		t.Errorf("an alias is still free text, got: %v", got)
+	}
+}
@@ -0,0 +1,241 @@
+package mrql
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// cursorVersion is bumped whenever the token layout changes, so a token minted
+// by an older server is rejected instead of being misread.
+const cursorVersion = 1
+
+// Cursor is a keyset pagination position: the ORDER BY key values and primary
+// key of the last row of a page. The next page is every row that sorts
+// strictly after it, so inserts and deletes ahead of the position never shift
+// or repeat rows the way an OFFSET does.
+//
+// Clients see a Cursor only as the opaque token Encode returns; its layout is
+// not part of the API.
+type Cursor struct {
+	Version int `json:"v"`
+	// Order is the keyset signature (KeysetSignature) of the query the cursor
+	// was issued for. A cursor only resumes a query with the same ORDER BY.
+	Order string `json:"o"`
+	// Keys holds one value per ORDER BY key, in key order. Times are encoded
+	// as RFC 3339 strings.
+	Keys []any `json:"k,omitempty"`
+	// EntityType is the row's entity for cross-entity queries, whose tiebreak
+	// is entity type then ID.
+	EntityType string `json:"t,omitempty"`
+	ID         uint   `json:"i"`
+}
+
+// CursorError reports a cursor that cannot be decoded or does not belong to
+// the query it was sent with, or a query whose order cannot be resumed from a
+// cursor at all.
+type CursorError struct {
+	Message string
+}
+
+func (e *CursorError) Error() string {
+	return "cursor error: " + e.Message
+}
+
+// NewCursor builds the cursor for a row of q. keys are the row's values for
+// the columns KeysetFields returned, in the same order.
+func NewCursor(q *Query, keys []any, entityType string, id uint) (*Cursor, error) {
+	signature, err := KeysetSignature(q)
+	if err != nil {
+		return nil, err
+	}
+	c := &Cursor{Version: cursorVersion, Order: signature, ID: id}
+	if keysetEntity(q) == EntityUnspecified {
+		c.EntityType = entityType
+	}
+	for _, k := range keys {
+		if t, ok := k.(time.Time); ok {
+			k = t.Format(time.RFC3339Nano)
+		}
+		c.Keys = append(c.Keys, k)
+	}
+	return c, nil
+}
+
+// Encode returns the cursor as an opaque URL-safe token.
+func (c *Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses a token produced by Cursor.Encode.
+func DecodeCursor(token string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimSpace(token))
+	if err != nil {
+		return nil, &CursorError{Message: "malformed cursor"}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var c Cursor
+	if err := decoder.Decode(&c); err != nil {
+		return nil, &CursorError{Message: "malformed cursor"}
+	}
+	if c.Version != cursorVersion || c.Order == "" || c.ID == 0 {
+		return nil, &CursorError{Message: "unsupported cursor; restart from the first page"}
+	}
+	return &c, nil
+}
+
+// KeysetFields returns the field behind each of q's ORDER BY keys, or a
+// CursorError when the order cannot be resumed from a cursor. Keyset
+// pagination compares the last row's stored values, so every key must be a
+// plain, non-null column: RANDOM(), RANK, distance, relation counts, meta
+// keys and nullable fields are rejected. Cross-entity queries are limited to
+// the fields every entity shares.
+func KeysetFields(q *Query) ([]FieldDef, error) {
+	if q.IsGrouped() {
+		return nil, &CursorError{Message: "cursor pagination is not available for GROUP BY or SELECT queries"}
+	}
+	entityType := keysetEntity(q)
+	fields := make([]FieldDef, 0, len(q.OrderBy))
+	for _, ob := range q.OrderBy {
+		if ob.Random {
+			return nil, &CursorError{Message: "cursor pagination needs a stable order; ORDER BY RANDOM() has none"}
+		}
+		name := ob.Field.Name()
+		fd, ok := LookupField(entityType, name)
+		if !ok || fd.Type == FieldRelation || fd.Type == FieldMeta || fd.Nullable {
+			return nil, &CursorError{Message: fmt.Sprintf("cursor pagination cannot resume an ORDER BY on %q; order by plain non-null fields such as name, created or id", name)}
+		}
+		fields = append(fields, fd)
+	}
+	return fields, nil
+}
+
+// KeysetSignature identifies q's keyset order: the entity type plus each
+// ORDER BY key and direction. A cursor carries the signature of the query that
+// issued it so it cannot be replayed against a differently ordered one.
+func KeysetSignature(q *Query) (string, error) {
+	fields, err := KeysetFields(q)
+	if err != nil {
+		return "", err
+	}
+	entity := "all"
+	if et := keysetEntity(q); et != EntityUnspecified {
+		entity = et.String()
+	}
+	var b strings.Builder
+	b.WriteString(entity)
+	for i, fd := range fields {
+		direction := "+"
+		if !q.OrderBy[i].Ascending {
+			direction = "-"
+		}
+		b.WriteString("," + fd.Name + direction)
+	}
+	return b.String(), nil
+}
+
+// keysetEntity is q's entity type, or EntityUnspecified for a cross-entity
+// query.
+func keysetEntity(q *Query) EntityType {
+	if q.EntityType != EntityUnspecified {
+		return q.EntityType
+	}
+	return ExtractEntityType(q)
+}
+
+// keysetTerm is one column of a keyset comparison.
+type keysetTerm struct {
+	expr      string
+	ascending bool
+	value     any
+}
+
+// keysetTerms pairs q.After's key values with the given per-key expressions,
+// converting each value back to its field's Go type. The caller appends its
+// own tiebreak terms.
+func keysetTerms(q *Query, exprs []string) ([]keysetTerm, error) {
+	signature, err := KeysetSignature(q)
+	if err != nil {
+		return nil, err
+	}
+	if q.After.Order != signature || len(q.After.Keys) != len(q.OrderBy) {
+		return nil, &CursorError{Message: "cursor belongs to a query with a different ORDER BY; restart from the first page"}
+	}
+	fields, _ := KeysetFields(q)
+	terms := make([]keysetTerm, len(fields))
+	for i, fd := range fields {
+		value, err := cursorKeyValue(fd, q.After.Keys[i])
+		if err != nil {
+			return nil, err
+		}
+		terms[i] = keysetTerm{expr: exprs[i], ascending: q.OrderBy[i].Ascending, value: value}
+	}
+	return terms, nil
+}
+
+// cursorKeyValue converts a decoded cursor key back to the type its column is
+// compared with.
+func cursorKeyValue(fd FieldDef, raw any) (any, error) {
+	invalid := &CursorError{Message: fmt.Sprintf("malformed cursor value for %q", fd.Name)}
+	switch fd.Type {
+	case FieldDateTime:
+		s, ok := raw.(string)
+		if !ok {
+			return nil, invalid
+		}
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return nil, invalid
+		}
+		return t, nil
+	case FieldNumber:
+		n, ok := raw.(json.Number)
+		if !ok {
+			return nil, invalid
+		}
+		if i, err := n.Int64(); err == nil {
+			return i, nil
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return nil, invalid
+		}
+		return f, nil
+	default:
+		s, ok := raw.(string)
+		if !ok {
+			return nil, invalid
+		}
+		return s, nil
+	}
+}
+
+// keysetCondition builds the "sorts strictly after" predicate over terms:
+// (a > ?) OR (a = ? AND b < ?) OR (a = ? AND b = ? AND id > ?), with each
+// comparison following its term's direction.
+func keysetCondition(terms []keysetTerm) (string, []any) {
+	var (
+		disjuncts []string
+		args      []any
+	)
+	for i, term := range terms {
+		var conjuncts []string
+		for _, prior := range terms[:i] {
+			conjuncts = append(conjuncts, prior.expr+" = ?")
+			args = append(args, prior.value)
+		}
+		op := " > ?"
+		if !term.ascending {
+			op = " < ?"
+		}
+		conjuncts = append(conjuncts, term.expr+op)
+		args = append(args, term.value)
+		disjuncts = append(disjuncts, "("+strings.Join(conjuncts, " AND ")+")")
+	}
+	return "(" + strings.Join(disjuncts, " OR ") + ")", args
+}
@@ -0,0 +1,271 @@
+package mrql
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestCursorEncodeDecodeRoundTrip(t *testing.T) {
+	q := mustParse(t, `type = resource ORDER BY created DESC, fileSize, name`)
+	created := time.Date(2024, 5, 6, 7, 8, 9, 123456789, time.UTC)
+	c, err := NewCursor(q, []any{created, int64(2048), "a.jpg"}, "resource", 42)
+	if err != nil {
+		t.Fatalf("NewCursor: %v", err)
+	}
+	if c.EntityType != "" {
+		t.Fatalf("single-entity cursor should not record an entity type, got %q", c.EntityType)
+	}
+
+	decoded, err := DecodeCursor(c.Encode())
+	if err != nil {
+		t.Fatalf("DecodeCursor: %v", err)
+	}
+	q.After = decoded
+	terms, err := keysetTerms(q, []string{"a", "b", "c"})
+	if err != nil {
+		t.Fatalf("keysetTerms: %v", err)
+	}
+	got := []any{terms[0].value, terms[1].value, terms[2].value}
+	want := []any{created, int64(2048), "a.jpg"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected keys %v, got %v", want, got)
+	}
+	if decoded.ID != 42 {
+		t.Fatalf("expected id 42, got %d", decoded.ID)
+	}
+}
+
+func TestDecodeCursorRejectsGarbage(t *testing.T) {
+	for _, token := range []string{"", "not base64!", "e30", "eyJ2Ijo5OSwibyI6InJlc291cmNlIiwiaSI6MX0"} {
+		_, err := DecodeCursor(token)
+		var ce *CursorError
+		if !errors.As(err, &ce) {
+			t.Errorf("DecodeCursor(%q): expected CursorError, got %v", token, err)
+		}
+	}
+}
+
+func TestKeysetFieldsRejectsUnresumableOrders(t *testing.T) {
+	tests := []struct {
+		input string
+		ok    bool
+	}{
+		{`type = resource ORDER BY name, created DESC`, true},
+		{`type = resource`, true},
+		{`name ~ "a" ORDER BY updated DESC`, true},
+		{`type = resource ORDER BY RANDOM()`, false},
+		{`type = resource ORDER BY meta.rating`, false},
+		{`type = resource ORDER BY tags.count`, false},
+		{`type = resource ORDER BY guid`, false},
+		{`type = note ORDER BY startDate`, false},
+		{`type = group ORDER BY url`, false},
+		{`type = note AND TEXT ~ "x" ORDER BY RANK`, false},
+		{`type = resource GROUP BY contentType COUNT()`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := KeysetFields(mustParse(t, tt.input))
+			if tt.ok && err != nil {
+				t.Fatalf("expected resumable order, got %v", err)
+			}
+			var ce *CursorError
+			if !tt.ok && !errors.As(err, &ce) {
+				t.Fatalf("expected CursorError, got %v", err)
+			}
+		})
+	}
+}
+
+func TestKeysetConditionFollowsDirections(t *testing.T) {
+	cond, args := keysetCondition([]keysetTerm{
+		{expr: "a", ascending: false, value: 1},
+		{expr: "b", ascending: true, value: "x"},
+		{expr: "id", ascending: true, value: uint(7)},
+	})
+	want := "((a < ?) OR (a = ? AND b > ?) OR (a = ? AND b = ? AND id > ?))"
+	if cond != want {
+		t.Fatalf("expected %s, got %s", want, cond)
+	}
+	if wantArgs := []any{1, 1, "x", 1, "x", uint(7)}; !reflect.DeepEqual(args, wantArgs) {
+		t.Fatalf("expected args %v, got %v", wantArgs, args)
+	}
+}
+
+// keysetPages pages through a single-entity resource query with LIMIT 1,
+// resuming each page from a cursor built off the previous row, and calls
+// between after every page.
+func keysetPages(t *testing.T, db *gorm.DB, input string, between func(page int)) []uint {
+	t.Helper()
+	var (
+		ids   []uint
+		after *Cursor
+	)
+	for page := 0; page < 20; page++ {
+		q := mustParse(t, input)
+		if err := Validate(q); err != nil {
+			t.Fatalf("Validate: %v", err)
+		}
+		q.EntityType = EntityResource
+		q.Keyset = true
+		q.After = after
+		q.Limit = 1
+		built, err := Translate(q, db)
+		if err != nil {
+			t.Fatalf("Translate: %v", err)
+		}
+		var rows []testResource
+		if err := built.Find(&rows).Error; err != nil {
+			t.Fatalf("page %d: %v", page, err)
+		}
+		if len(rows) == 0 {
+			return ids
+		}
+		r := rows[0]
+		ids = append(ids, r.ID)
+		c, err := NewCursor(q, []any{r.CreatedAt}, "", r.ID)
+		if err != nil {
+			t.Fatalf("NewCursor: %v", err)
+		}
+		if after, err = DecodeCursor(c.Encode()); err != nil {
+			t.Fatalf("DecodeCursor: %v", err)
+		}
+		if between != nil {
+			between(page)
+		}
+	}
+	t.Fatalf("paging did not terminate: %v", ids)
+	return nil
+}
+
+func TestKeysetPaginationBreaksTiesByID(t *testing.T) {
+	// Resources 1-3 share one created timestamp; 4 is older.
+	got := keysetPages(t, setupTestDB(t), `type = resource ORDER BY created DESC`, nil)
+	want := []uint{1, 2, 3, 4}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+// A row inserted ahead of the cursor does not shift later pages the way it
+// would shift an OFFSET; one inserted behind it is still reached.
+func TestKeysetPaginationIsStableUnderInserts(t *testing.T) {
+	db := setupTestDB(t)
+	got := keysetPages(t, db, `type = resource ORDER BY created DESC`, func(page int) {
+		if page != 0 {
+			return
+		}
+		for _, r := range []testResource{
+			{ID: 10, Name: "ahead.jpg", CreatedAt: time.Now().Add(time.Hour)},
+			{ID: 11, Name: "behind.jpg", CreatedAt: time.Now().Add(-24 * 365 * time.Hour)},
+		} {
+			if err := db.Create(&r).Error; err != nil {
+				t.Fatalf("insert: %v", err)
+			}
+		}
+	})
+	want := []uint{1, 2, 3, 4, 11}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestKeysetCursorRejectsDifferentOrder(t *testing.T) {
+	q := mustParse(t, `type = resource ORDER BY name`)
+	c, err := NewCursor(q, []any{"a"}, "", 1)
+	if err != nil {
+		t.Fatalf("NewCursor: %v", err)
+	}
+	other := mustParse(t, `type = resource ORDER BY name DESC`)
+	other.EntityType = EntityResource
+	other.Keyset = true
+	other.After = c
+	_, err = Translate(other, setupTestDB(t))
+	var ce *CursorError
+	if !errors.As(err, &ce) || !strings.Contains(err.Error(), "different ORDER BY") {
+		t.Fatalf("expected ORDER BY mismatch, got %v", err)
+	}
+}
+
+func TestUnionKeysetResumesAcrossEntities(t *testing.T) {
+	db := setupTestDB(t)
+	input := `name ~ "o" ORDER BY name`
+	full := unionRows(t, db, input, TranslateOptions{})
+
+	q := mustParse(t, input+" LIMIT 3")
+	if err := Validate(q); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	first := unionRows(t, db, input+" LIMIT 3", TranslateOptions{})
+	var last struct {
+		ID   uint
+		Name string
+	}
+	lastType, lastID := splitUnionRow(t, first[len(first)-1])
+	table := map[string]string{"resource": "resources", "note": "notes", "group": "groups"}[lastType]
+	if err := db.Table(table).Select("id, name").Where("id = ?", lastID).Scan(&last).Error; err != nil {
+		t.Fatalf("load last row: %v", err)
+	}
+	c, err := NewCursor(q, []any{last.Name}, lastType, lastID)
+	if err != nil {
+		t.Fatalf("NewCursor: %v", err)
+	}
+	q.After, _ = DecodeCursor(c.Encode())
+	built, _, err := TranslateUnion(q, db, TranslateOptions{})
+	if err != nil {
+		t.Fatalf("TranslateUnion: %v", err)
+	}
+	var rows []UnionRow
+	if err := built.Find(&rows).Error; err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	var second []string
+	for _, r := range rows {
+		second = append(second, fmt.Sprintf("%s:%d", r.EntityType, r.ID))
+	}
+	if want := full[3:6]; !reflect.DeepEqual(second, want) {
+		t.Fatalf("expected %v, got %v", want, second)
+	}
+}
+
+func splitUnionRow(t *testing.T, row string) (string, uint) {
+	t.Helper()
+	var id uint
+	entity, rest, _ := strings.Cut(row, ":")
+	if _, err := fmt.Sscan(rest, &id); err != nil {
+		t.Fatalf("bad row %q", row)
+	}
+	return entity, id
+}
+
+// UnionRowsFromMaps types each sort value for NewCursor, whether the driver
+// returned a datetime as time.Time or as the stored SQLite text.
+func TestUnionRowsFromMapsKeys(t *testing.T) {
+	q := mustParse(t, `name ~ "x" ORDER BY created DESC, name`)
+	q.Keyset = true
+	entityType := any("note")
+	raw := []map[string]any{{
+		"entity_type": &entityType,
+		"id":          int64(7),
+		"sort_0":      "2024-05-01 10:30:00.5+00:00",
+		"sort_1":      []byte("alpha"),
+	}}
+	rows, err := UnionRowsFromMaps(q, raw)
+	if err != nil {
+		t.Fatalf("UnionRowsFromMaps: %v", err)
+	}
+	want := UnionRow{
+		EntityType: "note",
+		ID:         7,
+		Keys:       []any{time.Date(2024, 5, 1, 10, 30, 0, 500000000, time.UTC), "alpha"},
+	}
+	if len(rows) != 1 || rows[0].EntityType != want.EntityType || rows[0].ID != want.ID ||
+		!rows[0].Keys[0].(time.Time).Equal(want.Keys[0].(time.Time)) || rows[0].Keys[1] != want.Keys[1] {
+		t.Fatalf("expected %+v, got %+v", want, rows)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 
 	"gorm.io/gorm"
 )
@@ -15,11 +16,25 @@ var ErrNativeExplainUnsupportedDialect = errors.New("native explain unsupported
 // is parameterized (bind placeholders); Interpolated inlines vars for display
 // only, using the same interpolation the GORM logger uses.
 type ExplainStatement struct {
-	Label        string      `json:"label"`
-	SQL          string      `json:"sql"`
-	Vars         []any       `json:"vars"`
-	Interpolated string      `json:"interpolated"`
-	NativePlan   *NativePlan `json:"nativePlan,omitempty"`
+	Label        string             `json:"label"`
+	SQL          string             `json:"sql"`
+	Vars         []any              `json:"vars"`
+	Interpolated string             `json:"interpolated"`
+	NativePlan   *NativePlan        `json:"nativePlan,omitempty"`
+	Aggregates   []ExplainAggregate `json:"aggregates,omitempty"`
+}
+
+// ExplainAggregate describes how one result column of an aggregated GROUP BY
+// is computed on the active dialect. Method is "native" (a built-in SQL
+// aggregate), "emulated" (built from other SQL functions to match another
+// dialect's built-in) or "window" (a window over the grouped rows); Note says
+// what the SQL does in words.
+type ExplainAggregate struct {
+	Key      string `json:"key"`
+	Function string `json:"function"`
+	Method   string `json:"method"`
+	SQL      string `json:"sql"`
+	Note     string `json:"note"`
 }
 
 // NativePlan preserves the database's native optimizer representation under a
@@ -55,6 +70,64 @@ func ExplainDB(db *gorm.DB, label string, dest any) ExplainStatement {
 	}
 }
 
+// aggregateNotes names what the plain SQL aggregates compute.
+var aggregateNotes = map[string]string{"SUM": "sum", "AVG": "average", "MIN": "smallest", "MAX": "largest"}
+
+// ExplainAggregates describes each aggregate of an aggregated GROUP BY query
+// as BuildAggregatedGroupBy would compute it on db's dialect. Returns nil when
+// q is not an aggregated GROUP BY.
+func ExplainAggregates(q *Query, db *gorm.DB) []ExplainAggregate {
+	if q.GroupBy == nil || len(q.GroupBy.Aggregates) == 0 {
+		return nil
+	}
+	entityType := q.EntityType
+	if entityType == EntityUnspecified {
+		entityType = ExtractEntityType(q)
+	}
+	tc := newTranslateContext(db, entityType, q, TranslateOptions{})
+	_, _, groupCols := tc.groupByColumns(db.Session(&gorm.Session{NewDB: true}), q.GroupBy.Fields)
+
+	explained := make([]ExplainAggregate, 0, len(q.GroupBy.Aggregates))
+	for _, agg := range q.GroupBy.Aggregates {
+		e := ExplainAggregate{
+			Key:      agg.Key(),
+			Function: agg.String(),
+			Method:   "native",
+			SQL:      tc.aggregateSelectExpr(agg, q.GroupBy, groupCols),
+		}
+		switch {
+		case agg.IsRunning():
+			e.Method = "window"
+			bucket := runningTotalBucket(q.GroupBy, entityType)
+			e.Note = fmt.Sprintf("per-group %s accumulated in %s order", strings.TrimPrefix(agg.Name, "RUNNING_"), q.GroupBy.Fields[bucket].Name())
+			if len(q.GroupBy.Fields) > 1 {
+				var others []string
+				for i, f := range q.GroupBy.Fields {
+					if i != bucket {
+						others = append(others, f.Name())
+					}
+				}
+				e.Note += ", restarting for each " + strings.Join(others, ", ")
+			}
+		case agg.Name == "MEDIAN" || agg.Name == "PERCENTILE":
+			if tc.isPostgres() {
+				e.Note = "percentile_cont: linear interpolation between the two nearest ranks"
+			} else {
+				e.Method = "emulated"
+				e.Note = "SQLite has no percentile_cont: values are collected into a sorted JSON array and the two nearest ranks interpolated linearly, as percentile_cont does"
+			}
+		case agg.Distinct:
+			e.Note = "number of distinct non-NULL values"
+		case agg.Field == nil:
+			e.Note = "number of rows in the group"
+		default:
+			e.Note = aggregateNotes[agg.Name] + " of the non-NULL values in the group"
+		}
+		explained = append(explained, e)
+	}
+	return explained
+}
+
 // NativeExplain asks the active database optimizer to plan a generated
 // statement without executing the underlying SELECT. It always executes the
 // parameterized SQL with its original bind vars; Interpolated is display-only.
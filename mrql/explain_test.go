@@ -148,3 +148,36 @@ func TestNativeExplainHonorsCancelledContext(t *testing.T) {
 		t.Fatalf("expected context cancellation, got %v", err)
 	}
 }
+
+func TestExplainAggregates(t *testing.T) {
+	db := setupTestDB(t)
+	q, err := Parse(`type = "resource" GROUP BY contentType, created.month COUNT() MEDIAN(fileSize) RUNNING_SUM(fileSize)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Validate(q); err != nil {
+		t.Fatal(err)
+	}
+	aggs := ExplainAggregates(q, db)
+	if len(aggs) != 3 {
+		t.Fatalf("expected 3 aggregates, got %+v", aggs)
+	}
+	if aggs[0].Key != "count" || aggs[0].Method != "native" || aggs[0].SQL != "COUNT(*)" {
+		t.Errorf("unexpected COUNT description: %+v", aggs[0])
+	}
+	if aggs[1].Function != "MEDIAN(fileSize)" || aggs[1].Method != "emulated" || !strings.Contains(aggs[1].SQL, "json_group_array") {
+		t.Errorf("expected emulated median on SQLite: %+v", aggs[1])
+	}
+	if aggs[2].Method != "window" || !strings.Contains(aggs[2].SQL, "OVER (PARTITION BY resources.content_type ORDER BY") ||
+		aggs[2].Note != "per-group SUM accumulated in created.month order, restarting for each contentType" {
+		t.Errorf("unexpected running sum description: %+v", aggs[2])
+	}
+
+	flat, err := Parse(`type = "resource" GROUP BY contentType`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ExplainAggregates(flat, db); got != nil {
+		t.Errorf("expected no aggregates for bucketed GROUP BY, got %+v", got)
+	}
+}
@@ -13,9 +13,10 @@ const (
 
 // FieldDef describes one queryable field on an entity.
 type FieldDef struct {
-	Name   string    // MRQL field name (camelCase)
-	Type   FieldType // how the value is typed
-	Column string    // underlying DB column / relation name
+	Name     string    // MRQL field name (camelCase)
+	Type     FieldType // how the value is typed
+	Column   string    // underlying DB column / relation name
+	Nullable bool      // column may be NULL (keyset pagination cannot resume on it)
 }
 
 // commonFields are available on every entity type.
@@ -26,7 +27,7 @@ var commonFields = []FieldDef{
 	{Name: "created", Type: FieldDateTime, Column: "created_at"},
 	{Name: "updated", Type: FieldDateTime, Column: "updated_at"},
 	{Name: "tags", Type: FieldRelation, Column: "tags"},
-	{Name: "guid", Type: FieldString, Column: "guid"},
+	{Name: "guid", Type: FieldString, Column: "guid", Nullable: true},
 	// "meta" prefix is handled separately via FieldMeta lookup
 }
 
@@ -40,13 +41,26 @@ var resourceFields = []FieldDef{
 	{Name: "fileSize", Type: FieldNumber, Column: "file_size"},
 	{Name: "width", Type: FieldNumber, Column: "width"},
 	{Name: "height", Type: FieldNumber, Column: "height"},
+	// pageCount is the number of pages of a PDF, 0 until it has been read.
+	{Name: "pageCount", Type: FieldNumber, Column: "page_count"},
 	{Name: "originalName", Type: FieldString, Column: "original_name"},
 	{Name: "originalLocation", Type: FieldString, Column: "original_location"},
 	{Name: "hash", Type: FieldString, Column: "hash"},
+	// storageLocation is the alt filesystem key holding the file, NULL for
+	// the main filesystem.
+	{Name: "storageLocation", Type: FieldString, Column: "storage_location", Nullable: true},
+	// lastViewed is read from resource_views (see derivedColumns); NULL for a
+	// resource whose file was never opened.
+	{Name: "lastViewed", Type: FieldDateTime, Column: lastViewedColumn, Nullable: true},
 	{Name: "notes", Type: FieldRelation, Column: "notes"},
 	// similarImages is a derived relation over resources sharing an exact DHash.
 	// It is primarily queried as `similarImages IS [NOT] EMPTY`.
 	{Name: "similarImages", Type: FieldRelation, Column: "similar_images"},
+	// series, versions and currentVersion are related roots (see related.go):
+	// series.name, versions.comment, currentVersion.created, versions.count.
+	{Name: "series", Type: FieldRelation, Column: "series_id"},
+	{Name: "versions", Type: FieldRelation, Column: "versions"},
+	{Name: "currentVersion", Type: FieldRelation, Column: "current_version_id"},
 }
 
 // noteFields are fields only available on the Note entity.
@@ -54,21 +68,28 @@ var noteFields = []FieldDef{
 	{Name: "groups", Type: FieldRelation, Column: "groups"},
 	{Name: "group", Type: FieldRelation, Column: "groups"}, // alias
 	{Name: "owner", Type: FieldRelation, Column: "owner_id"},
-	{Name: "noteType", Type: FieldNumber, Column: "note_type_id"},
-	{Name: "startDate", Type: FieldDateTime, Column: "start_date"},
-	{Name: "endDate", Type: FieldDateTime, Column: "end_date"},
-	{Name: "shared", Type: FieldString, Column: "share_token"},
+	{Name: "noteType", Type: FieldNumber, Column: "note_type_id", Nullable: true},
+	{Name: "startDate", Type: FieldDateTime, Column: "start_date", Nullable: true},
+	{Name: "endDate", Type: FieldDateTime, Column: "end_date", Nullable: true},
+	{Name: "shared", Type: FieldString, Column: "share_token", Nullable: true},
 	{Name: "resources", Type: FieldRelation, Column: "resources"},
+	// blocks is a related root over the note's content blocks (see
+	// related.go): blocks.type, blocks.text, blocks.count.
+	{Name: "blocks", Type: FieldRelation, Column: "blocks"},
 }
 
 // groupFields are fields only available on the Group entity.
 var groupFields = []FieldDef{
-	{Name: "category", Type: FieldNumber, Column: "category_id"},
-	{Name: "url", Type: FieldString, Column: "url"},
+	{Name: "category", Type: FieldNumber, Column: "category_id", Nullable: true},
+	{Name: "url", Type: FieldString, Column: "url", Nullable: true},
 	{Name: "parent", Type: FieldRelation, Column: "parent_id"}, // logical name; actual DB column is owner_id (intercepted by translator)
 	{Name: "children", Type: FieldRelation, Column: "children"},
 	{Name: "resources", Type: FieldRelation, Column: "resources"},
 	{Name: "notes", Type: FieldRelation, Column: "notes"},
+	// Typed group relations, outgoing and incoming (see related.go):
+	// relations("depicts").name, backRelations.type.
+	{Name: "relations", Type: FieldRelation, Column: "relations"},
+	{Name: "backRelations", Type: FieldRelation, Column: "back_relations"},
 }
 
 // ValidEntityTypes maps valid entity type string values to their EntityType constant.
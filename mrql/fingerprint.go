@@ -56,6 +56,8 @@ func QueryShapeFingerprintWithPolicy(q *Query, scope ScopeShape, policy QuerySha
 	shapeWrite(h, "offset", strconv.Itoa(q.Offset))
 	shapeWrite(h, "bucket-limit", strconv.Itoa(q.BucketLimit))
 	shapeNode(h, q.Where, "")
+	shapeAsOf(h, q.AsOf)
+	shapeSelect(h, q.Select)
 	shapeGroupBy(h, q.GroupBy)
 	shapeWrite(h, "orders", strconv.Itoa(len(q.OrderBy)))
 	for _, order := range q.OrderBy {
@@ -73,6 +75,16 @@ func shapeWrite(h hash.Hash, key, value string) {
 	_, _ = fmt.Fprintf(h, "%d:%s=%d:%s;", len(key), key, len(value), value)
 }
 
+// shapeAsOf records whether the query reads history, and the kind of
+// moment; the moment itself is a literal.
+func shapeAsOf(h hash.Hash, asOf *AsOfClause) {
+	if asOf == nil {
+		shapeWrite(h, "as-of", "nil")
+		return
+	}
+	shapeWrite(h, "as-of", asOf.Value.nodeType())
+}
+
 func shapeField(h hash.Hash, field *FieldExpr) {
 	if field == nil {
 		shapeWrite(h, "field", "nil")
@@ -82,6 +94,9 @@ func shapeField(h hash.Hash, field *FieldExpr) {
 	for _, part := range field.Parts {
 		shapeWrite(h, "field-part", part.Value)
 	}
+	if field.RelationType != nil {
+		shapeWrite(h, "field-arg", "string")
+	}
 }
 
 func shapeNode(h hash.Hash, node Node, comparisonField string) {
@@ -105,6 +120,18 @@ func shapeNode(h hash.Hash, node Node, comparisonField string) {
 			fieldName = strings.ToLower(n.Field.Name())
 		}
 		shapeNode(h, n.Value, fieldName)
+	case *ScalarComparisonExpr:
+		shapeNode(h, n.Left, "")
+		shapeWrite(h, "operator", strconv.Itoa(int(n.Operator.Type)))
+		shapeNode(h, n.Right, "")
+	case *ScalarCall:
+		// DATE_ADD's offset is inlined into the SQL, like a percentile's
+		// fraction, so it is part of the shape.
+		shapeWrite(h, "scalar-function", n.Name)
+		shapeField(h, n.Field)
+		if n.Offset != nil {
+			shapeWrite(h, "date-offset", strconv.Itoa(n.Offset.Amount)+n.Offset.Unit)
+		}
 	case *InExpr:
 		shapeField(h, n.Field)
 		shapeWrite(h, "negated", strconv.FormatBool(n.Negated))
@@ -112,6 +139,10 @@ func shapeNode(h hash.Hash, node Node, comparisonField string) {
 		for _, value := range n.Values {
 			shapeNode(h, value, "")
 		}
+	case *SubqueryInExpr:
+		shapeField(h, n.Field)
+		shapeWrite(h, "negated", strconv.FormatBool(n.Negated))
+		shapeNode(h, n.Where, "")
 	case *IsExpr:
 		shapeField(h, n.Field)
 		shapeWrite(h, "negated", strconv.FormatBool(n.Negated))
@@ -141,6 +172,10 @@ func shapeNode(h hash.Hash, node Node, comparisonField string) {
 		shapeWrite(h, "function", strings.ToUpper(n.Name))
 	case *ParamRef:
 		shapeWrite(h, "literal", "parameter")
+	case *ArithExpr:
+		shapeWrite(h, "operator", strconv.Itoa(int(n.Operator.Type)))
+		shapeNode(h, n.Left, "")
+		shapeNode(h, n.Right, "")
 	case *HavingComparison:
 		shapeAggregate(h, n.Agg)
 		shapeWrite(h, "operator", strconv.Itoa(int(n.Operator.Type)))
@@ -152,6 +187,8 @@ func shapeNode(h hash.Hash, node Node, comparisonField string) {
 
 func shapeAggregate(h hash.Hash, aggregate AggregateFunc) {
 	shapeWrite(h, "aggregate", strings.ToUpper(aggregate.Name))
+	shapeWrite(h, "aggregate-distinct", strconv.FormatBool(aggregate.Distinct))
+	shapeWrite(h, "aggregate-fraction", strconv.FormatFloat(aggregate.Fraction, 'g', -1, 64))
 	shapeField(h, aggregate.Field)
 }
 
@@ -170,3 +207,17 @@ func shapeGroupBy(h hash.Hash, group *GroupByClause) {
 	}
 	shapeNode(h, group.Having, "")
 }
+
+// shapeSelect writes the projection's columns. Aliases are kept: they name
+// the result columns, as field names do.
+func shapeSelect(h hash.Hash, sel *SelectClause) {
+	if sel == nil {
+		shapeWrite(h, "select", "nil")
+		return
+	}
+	shapeWrite(h, "select-columns", strconv.Itoa(len(sel.Columns)))
+	for _, col := range sel.Columns {
+		shapeNode(h, col.Expr, "")
+		shapeWrite(h, "select-alias", col.Alias)
+	}
+}
@@ -40,6 +40,7 @@ func TestQueryShapeFingerprintPreservesEffectiveStructure(t *testing.T) {
 		"limit":    fingerprintQuery(t, `type = "resource" AND name ~ "x" LIMIT 11 OFFSET 20`, ScopeShapeNone),
 		"offset":   fingerprintQuery(t, `type = "resource" AND name ~ "x" LIMIT 10 OFFSET 21`, ScopeShapeNone),
 		"scope":    fingerprintQuery(t, `type = "resource" AND name ~ "x" LIMIT 10 OFFSET 20`, ScopeShapeForced),
+		"as of":    fingerprintQuery(t, `type = "resource" AND name ~ "x" AS OF -1d LIMIT 10 OFFSET 20`, ScopeShapeNone),
 	}
 	for name, got := range cases {
 		if got == base {
@@ -48,6 +49,14 @@ func TestQueryShapeFingerprintPreservesEffectiveStructure(t *testing.T) {
 	}
 }
 
+func TestQueryShapeFingerprintDistinguishesPercentileFractions(t *testing.T) {
+	median := fingerprintQuery(t, `type = "resource" GROUP BY contentType PERCENTILE(fileSize, 0.5)`, ScopeShapeNone)
+	p95 := fingerprintQuery(t, `type = "resource" GROUP BY contentType PERCENTILE(fileSize, 0.95)`, ScopeShapeNone)
+	if median == p95 {
+		t.Fatalf("percentile fraction did not change fingerprint: %s", median)
+	}
+}
+
 func TestQueryShapeFingerprintIncludesSQLShapingPolicy(t *testing.T) {
 	q, err := Parse(`type = "resource" AND SIMILAR TO resource(1)`)
 	if err != nil {
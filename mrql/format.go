@@ -0,0 +1,30 @@
+package mrql
+
+import "fmt"
+
+// Format parses query — a read query or a mutation statement — and returns it
+// as Print writes it. A query that does not parse is returned as the
+// *ParseError rather than guessed at; Format does not validate.
+//
+// The result is checked before it is returned: it must parse to a query with
+// the same shape fingerprint and print back to itself, so formatting never
+// changes what a query means.
+func Format(query string) (string, error) {
+	q, err := parse(query, true)
+	if err != nil {
+		return "", err
+	}
+	out := Print(q)
+
+	again, err := parse(out, true)
+	if err != nil {
+		return "", fmt.Errorf("formatting produced a query that does not parse: %w", err)
+	}
+	if QueryShapeFingerprint(again, ScopeShapeNone) != QueryShapeFingerprint(q, ScopeShapeNone) {
+		return "", fmt.Errorf("formatting changed the shape of the query")
+	}
+	if Print(again) != out {
+		return "", fmt.Errorf("formatting is not stable for this query")
+	}
+	return out, nil
+}
@@ -0,0 +1,77 @@
+package mrql
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"keywords upper-cased", `type = resource and tags = "photo" order by created desc limit 10`,
+			"type = resource AND tags = \"photo\"\nORDER BY created DESC\nLIMIT 10"},
+		{"whitespace collapsed", "name   ~\n\t\"x*\"   OR  name IS empty",
+			`name ~ "x*" OR name IS EMPTY`},
+		{"redundant parentheses dropped", `( owner . name = "a" )AND tags IN ( "b","c" )`,
+			`owner.name = "a" AND tags IN ("b", "c")`},
+		{"needed parentheses kept", `(a = 1 OR b = 2) AND NOT (c = 3 AND d = 4)`,
+			`(a = 1 OR b = 2) AND NOT (c = 3 AND d = 4)`},
+		{"right-nested operand keeps its parentheses", `a = 1 AND (b = 2 AND c = 3)`,
+			`a = 1 AND (b = 2 AND c = 3)`},
+		{"aggregates", `type = resource group   by contentType count() sum(fileSize) count(distinct name)`,
+			"type = resource\nGROUP BY contentType COUNT() SUM(fileSize) COUNT(DISTINCT name)"},
+		{"having after group by", `type = resource GROUP BY contentType COUNT() having count() > 2 or not sum(fileSize) < 1mb`,
+			"type = resource\nGROUP BY contentType COUNT()\nHAVING COUNT() > 2 OR NOT SUM(fileSize) < 1mb"},
+		{"bare values quoted", `name = having AND meta.flag = TRUE`, `name = "having" AND meta.flag = true`},
+		{"entity written bare", `type = "Note" AND tags IN (type = "TAG")`, `type = note AND tags IN (type = "TAG")`},
+		{"between kept", `fileSize between 1MB and 2.50mb and created not between -7D and now()`,
+			`fileSize BETWEEN 1mb AND 2.5mb AND created NOT BETWEEN -7d AND NOW()`},
+		{"numbers normalized", `id = 007 AND meta.x = 1.0`, `id = 7 AND meta.x = 1`},
+		{"scope and sub-query", `type = note AND tags not in (type = resource AND name ~ "x") scope "Projects"`,
+			"type = note AND tags NOT IN (type = resource AND name ~ \"x\")\nSCOPE \"Projects\""},
+		{"typed relation argument", `type = group AND relations("Depends on").name = "x"`,
+			`type = group AND relations("Depends on").name = "x"`},
+		{"similarity and text", `similar to resource(12) within 4 AND text ~ "cat"`,
+			`SIMILAR TO resource(12) WITHIN 4 AND TEXT ~ "cat"`},
+		{"order keys", `type = resource order by random(), name asc, meta.rating desc offset 5`,
+			"type = resource\nORDER BY RANDOM(), name, meta.rating DESC\nOFFSET 5"},
+		{"parameters", `name = $name AND created > $since`, `name = $name AND created > $since`},
+		{"string escapes", `name = "A  \"quoted\"   \d"`, `name = "A  \"quoted\"   \\d"`},
+		{"mutation", `type = resource and tags = "inbox" add tags "a", 3 remove tags "inbox" set meta.x = null, meta.y = "z" move to 7`,
+			"type = resource AND tags = \"inbox\"\nADD TAGS \"a\", 3\nREMOVE TAGS \"inbox\"\nSET meta.x = NULL, meta.y = \"z\"\nMOVE TO 7"},
+		{"clauses without a filter", `order by name limit 3`, "ORDER BY name\nLIMIT 3"},
+		{"scalar functions", `lower( name ) = "x" and ext(originalName) not in ("cr2","NEF") and year(created) between 2020 and 2023 and updated > date_add(created ,3D)`,
+			`LOWER(name) = "x" AND EXT(originalName) NOT IN ("cr2", "NEF") AND YEAR(created) BETWEEN 2020 AND 2023 AND updated > DATE_ADD(created, 3d)`},
+		{"select", `type = resource scope 4 select name,(fileSize/1MB) as mb , ((width+1))*height order by mb desc`,
+			"type = resource\nSCOPE 4\nSELECT name, fileSize / 1mb AS mb, (width + 1) * height\nORDER BY mb DESC"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Format(tt.input)
+			if err != nil {
+				t.Fatalf("Format(%q) error: %v", tt.input, err)
+			}
+			if got != tt.want {
+				t.Errorf("Format(%q)\n got: %q\nwant: %q", tt.input, got, tt.want)
+			}
+			again, err := Format(got)
+			if err != nil || again != got {
+				t.Errorf("Format is not idempotent: %q -> %q (%v)", got, again, err)
+			}
+		})
+	}
+}
+
+func TestFormatRejectsInvalidQuery(t *testing.T) {
+	for _, input := range []string{`name = "unterminated`, `name = @`, `name =`, `(a = 1`} {
+		if _, err := Format(input); err == nil {
+			t.Errorf("Format(%q) should fail", input)
+		}
+	}
+	if _, err := Format(strings.Repeat("a", MaxQueryBytes+1)); err == nil {
+		t.Error("Format should refuse a query over the byte limit")
+	}
+}
@@ -0,0 +1,320 @@
+package mrql
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// scalarFunction describes a scalar function: the type of field it takes and
+// the type of the value it returns. Every function reads one field of the
+// queried entity, so a call never needs a join or a subquery.
+type scalarFunction struct {
+	arg    FieldType
+	result FieldType
+}
+
+// scalarFunctions are the functions that take arguments, keyed by upper-case
+// name. The argument-less date functions (NOW(), START_OF_DAY(), ...) are
+// values instead; see resolveFunction.
+var scalarFunctions = map[string]scalarFunction{
+	"LOWER":       {arg: FieldString, result: FieldString},
+	"UPPER":       {arg: FieldString, result: FieldString},
+	"LENGTH":      {arg: FieldString, result: FieldNumber},
+	"EXT":         {arg: FieldString, result: FieldString},
+	"YEAR":        {arg: FieldDateTime, result: FieldNumber},
+	"MONTH":       {arg: FieldDateTime, result: FieldNumber},
+	"DAY":         {arg: FieldDateTime, result: FieldNumber},
+	"DATE_ADD":    {arg: FieldDateTime, result: FieldDateTime},
+	"JSON_LENGTH": {arg: FieldMeta, result: FieldNumber},
+}
+
+// scalarTypeName names a scalar function's argument or result type in errors.
+func scalarTypeName(ft FieldType) string {
+	switch ft {
+	case FieldString:
+		return "text"
+	case FieldNumber:
+		return "a number"
+	case FieldDateTime:
+		return "a date"
+	case FieldMeta:
+		return "a meta field"
+	}
+	return fieldTypeName(ft)
+}
+
+// validateScalarCall checks a call's argument and returns its result type.
+// Arguments are fields of the queried entity itself: JSON_LENGTH takes a
+// meta path, every other function a string or date column.
+func validateScalarCall(c *ScalarCall, entityType EntityType) (FieldType, error) {
+	fn := scalarFunctions[c.Name]
+	f := c.Field
+	argErr := func(format string, args ...any) (FieldType, error) {
+		return 0, &ValidationError{Message: fmt.Sprintf(format, args...), Pos: f.Pos(), Length: len(f.Name())}
+	}
+
+	if fn.arg == FieldMeta {
+		if len(f.Parts) < 2 || f.Parts[0].Value != "meta" {
+			return argErr("%s takes a meta field (e.g. %s(meta.authors)), got %s", c.Name, c.Name, f.Name())
+		}
+		return fn.result, nil
+	}
+	fd, err := scalarField(f, entityType, c.Name+" takes")
+	if err != nil {
+		return 0, err
+	}
+	if fd.Type != fn.arg {
+		return argErr("%s takes %s field; %s is %s", c.Name, map[FieldType]string{FieldString: "a text", FieldDateTime: "a date"}[fn.arg], f.Name(), scalarTypeName(fd.Type))
+	}
+	if c.Offset != nil && c.Offset.Amount == 0 {
+		return 0, &ValidationError{Message: "DATE_ADD offset must not be zero", Pos: c.Offset.Token.Pos, Length: c.Offset.Token.Length}
+	}
+	return fn.result, nil
+}
+
+// scalarField resolves a function argument, or the field compared with a
+// function, to a string, number or date column of the queried entity. what
+// starts the error message ("LOWER takes").
+func scalarField(f *FieldExpr, entityType EntityType, what string) (FieldDef, error) {
+	name := f.Name()
+	fieldErr := func(format string, args ...any) (FieldDef, error) {
+		return FieldDef{}, &ValidationError{Message: fmt.Sprintf(format, args...), Pos: f.Pos(), Length: len(name)}
+	}
+	if len(f.Parts) != 1 || isTypeField(f) {
+		return fieldErr("%s a field of the queried entity, not %s", what, name)
+	}
+	if err := validateFieldExpr(f, entityType); err != nil {
+		return FieldDef{}, err
+	}
+	fd, _ := LookupField(entityType, name)
+	if fd.Type == FieldRelation || fd.Type == FieldMeta || fd.Name == "shared" {
+		return fieldErr("%s a text, number or date field, not %s", what, name)
+	}
+	return fd, nil
+}
+
+// scalarOperandName is a comparison side as the query spells it, for errors.
+func scalarOperandName(n Node) string {
+	if c, ok := n.(*ScalarCall); ok {
+		return printScalarCall(c)
+	}
+	return printValue(n)
+}
+
+// validateScalarComparison validates a comparison with a scalar call on
+// either side. Both sides of call-to-call and field-to-call comparisons must
+// have the same type; a value must suit the call's result type.
+func validateScalarComparison(n *ScalarComparisonExpr, entityType EntityType) error {
+	var leftType FieldType
+	switch left := n.Left.(type) {
+	case *ScalarCall:
+		t, err := validateScalarCall(left, entityType)
+		if err != nil {
+			return err
+		}
+		leftType = t
+	case *FieldExpr:
+		fd, err := scalarField(left, entityType, "a function result is compared with")
+		if err != nil {
+			return err
+		}
+		leftType = fd.Type
+	}
+	leftName := scalarOperandName(n.Left)
+	opErr := func(format string, args ...any) error {
+		return &ValidationError{Message: fmt.Sprintf(format, args...), Pos: n.Operator.Pos, Length: n.Operator.Length}
+	}
+
+	switch n.Operator.Type {
+	case TokenEq, TokenNeq, TokenGt, TokenGte, TokenLt, TokenLte:
+		// supported for every type
+	default:
+		if leftType != FieldString {
+			return opErr("%s is %s; %s only applies to text", leftName, scalarTypeName(leftType), operatorText(n.Operator.Type))
+		}
+		if _, isCall := n.Right.(*ScalarCall); isCall {
+			return opErr("%s needs a quoted pattern, not a function call", operatorText(n.Operator.Type))
+		}
+	}
+
+	if call, ok := n.Right.(*ScalarCall); ok {
+		rightType, err := validateScalarCall(call, entityType)
+		if err != nil {
+			return err
+		}
+		if rightType != leftType {
+			return opErr("cannot compare %s (%s) with %s (%s)", leftName, scalarTypeName(leftType), printScalarCall(call), scalarTypeName(rightType))
+		}
+		return nil
+	}
+
+	valueErr := func(format string, args ...any) error {
+		return &ValidationError{Message: fmt.Sprintf(format, args...), Pos: n.Right.Pos()}
+	}
+	switch v := n.Right.(type) {
+	case *ParamRef:
+		// Re-checked after BindParams substitutes a literal.
+		return nil
+	case *StringLiteral:
+		if leftType == FieldString || leftType == FieldDateTime {
+			return nil
+		}
+	case *NumberLiteral:
+		if leftType == FieldNumber {
+			if v.Unit != "" {
+				return valueErr("%s returns a plain number; size units do not apply", leftName)
+			}
+			return nil
+		}
+	case *RelDateLiteral, *FuncCall:
+		if leftType == FieldDateTime {
+			return nil
+		}
+	}
+	switch leftType {
+	case FieldString:
+		return valueErr("%s returns text; compare it with a quoted string", leftName)
+	case FieldNumber:
+		return valueErr("%s returns a number; compare it with a number", leftName)
+	}
+	return valueErr("%s returns a date; use a date string, relative date (-7d), or function (NOW())", leftName)
+}
+
+// translateScalarComparison translates a comparison with a scalar call.
+// Text equality is case-insensitive and ~ is a contains/wildcard match, as
+// for text fields. SQLite compares dates through datetime() on both sides,
+// since DATE_ADD's result and a stored timestamp are spelled differently.
+func (tc *translateContext) translateScalarComparison(db *gorm.DB, n *ScalarComparisonExpr) (*gorm.DB, error) {
+	if isRegexOperator(n.Operator) && !tc.isPostgres() {
+		return nil, &TranslateError{Message: "regex match (~*) requires PostgreSQL", Pos: n.Operator.Pos}
+	}
+	left, leftType, ok, err := tc.scalarOperandExpr(n.Left)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		// A field of another entity type in a type-guarded OR branch.
+		return db.Where("1 = 0"), nil
+	}
+	op := tc.sqlOperator(n.Operator)
+	dates := leftType == FieldDateTime && !tc.isPostgres()
+
+	if call, isCall := n.Right.(*ScalarCall); isCall {
+		right, _, ok, err := tc.scalarOperandExpr(call)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return db.Where("1 = 0"), nil
+		}
+		switch {
+		case dates:
+			left, right = "datetime("+left+")", "datetime("+right+")"
+		case leftType == FieldString:
+			left, right = "LOWER("+left+")", "LOWER("+right+")"
+		}
+		return db.Where(left + " " + op + " " + right), nil
+	}
+
+	val, err := tc.resolveValue(n.Right, FieldDef{Type: leftType})
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case n.Operator.Type == TokenLike || n.Operator.Type == TokenNotLike:
+		return tc.translateLikeComparison(db, left, n.Operator, val)
+	case leftType == FieldString && (n.Operator.Type == TokenEq || n.Operator.Type == TokenNeq):
+		return db.Where("LOWER("+left+") "+op+" LOWER(?)", val), nil
+	case dates:
+		if t, ok := val.(time.Time); ok {
+			val = t.UTC().Format("2006-01-02 15:04:05")
+		}
+		return db.Where("datetime("+left+") "+op+" datetime(?)", val), nil
+	}
+	return db.Where(left+" "+op+" ?", val), nil
+}
+
+// scalarOperandExpr renders one side of a scalar comparison. ok is false
+// when the field does not exist on the entity being translated.
+func (tc *translateContext) scalarOperandExpr(n Node) (string, FieldType, bool, error) {
+	switch n := n.(type) {
+	case *ScalarCall:
+		expr, ok, err := tc.scalarCallExpr(n)
+		return expr, scalarFunctions[n.Name].result, ok, err
+	case *FieldExpr:
+		fd, ok := LookupField(tc.entityType, n.Name())
+		if !ok {
+			return "", 0, false, nil
+		}
+		return tc.qualifiedColumn(fd.Column), fd.Type, true, nil
+	}
+	return "", 0, false, &TranslateError{Message: fmt.Sprintf("unsupported comparison operand %T", n), Pos: n.Pos()}
+}
+
+// scalarCallExpr renders a scalar call as a SQL expression over the queried
+// table. ok is false when the argument does not exist on the entity being
+// translated. Every function is NULL for a NULL argument, except EXT, which
+// is "" for a name without an extension.
+func (tc *translateContext) scalarCallExpr(c *ScalarCall) (string, bool, error) {
+	fn := scalarFunctions[c.Name]
+	pg := tc.isPostgres()
+
+	if fn.arg == FieldMeta {
+		segments := metaSubpathSegments(c.Field.Name())
+		if err := validateMetaSegments(segments); err != nil {
+			return "", false, &TranslateError{Message: err.Error(), Pos: c.Field.Pos()}
+		}
+		return tc.jsonLengthExpr(segments), true, nil
+	}
+
+	fd, ok := LookupField(tc.entityType, c.Field.Name())
+	if !ok || fd.Type != fn.arg {
+		return "", false, nil
+	}
+	col := tc.qualifiedColumn(fd.Column)
+
+	switch c.Name {
+	case "LOWER", "UPPER", "LENGTH":
+		return c.Name + "(" + col + ")", true, nil
+	case "EXT":
+		// The text after the last dot, lower-cased. SQLite has no
+		// last-index function: rtrim(col, <every non-dot character of col>)
+		// leaves the name up to and including its last dot.
+		if pg {
+			return "COALESCE(LOWER(SUBSTRING(" + col + " FROM '\\.([^.]*)$')), '')", true, nil
+		}
+		return fmt.Sprintf("CASE WHEN instr(%[1]s, '.') > 0 THEN LOWER(substr(%[1]s, length(rtrim(%[1]s, replace(%[1]s, '.', ''))) + 1)) ELSE '' END", col), true, nil
+	case "YEAR", "MONTH", "DAY":
+		if pg {
+			return "CAST(EXTRACT(" + c.Name + " FROM " + col + ") AS INTEGER)", true, nil
+		}
+		format := map[string]string{"YEAR": "%Y", "MONTH": "%m", "DAY": "%d"}[c.Name]
+		return "CAST(strftime('" + format + "', " + col + ") AS INTEGER)", true, nil
+	case "DATE_ADD":
+		amount, unit := c.Offset.Amount, map[string]string{"d": "days", "w": "days", "m": "months", "y": "years"}[c.Offset.Unit]
+		if c.Offset.Unit == "w" {
+			amount *= 7
+		}
+		if pg {
+			return fmt.Sprintf("(%s + INTERVAL '%d %s')", col, amount, unit), true, nil
+		}
+		return fmt.Sprintf("datetime(%s, '%+d %s')", col, amount, unit), true, nil
+	}
+	return "", false, &TranslateError{Message: fmt.Sprintf("unknown function %s", c.Name), Pos: c.Pos()}
+}
+
+// jsonLengthExpr counts the elements of a meta array or the keys of a meta
+// object; any other JSON value, or a missing key, is NULL.
+func (tc *translateContext) jsonLengthExpr(segments []string) string {
+	if tc.isPostgres() {
+		// The cast lets the same SQL read a json or a jsonb meta column.
+		path := "(" + pgJsonPath(tc.tableName, segments) + ")::jsonb"
+		return fmt.Sprintf("CASE jsonb_typeof(%[1]s) WHEN 'array' THEN jsonb_array_length(%[1]s) WHEN 'object' THEN (SELECT COUNT(*) FROM jsonb_object_keys(%[1]s)) END", path)
+	}
+	meta := tc.tableName + ".meta"
+	path := "'$." + strings.Join(segments, ".") + "'"
+	return fmt.Sprintf("CASE WHEN json_type(%[1]s, %[2]s) IN ('array', 'object') THEN (SELECT COUNT(*) FROM json_each(%[1]s, %[2]s)) END", meta, path)
+}
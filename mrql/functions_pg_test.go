@@ -0,0 +1,21 @@
+//go:build postgres
+
+package mrql
+
+import "testing"
+
+// TestPG_ScalarFunctionExecution runs the SQLite scalar function expectations
+// against Postgres: EXT's regex, EXTRACT, interval arithmetic and the jsonb
+// length functions must agree with their SQLite spellings.
+func TestPG_ScalarFunctionExecution(t *testing.T) {
+	db := setupPostgresTestDB(t)
+	seedFunctionData(t, db)
+	for _, tc := range functionCases {
+		t.Run(tc.query, func(t *testing.T) {
+			got := runResourceIDs(t, db, `type = resource AND `+tc.query)
+			if !eqIDs(got, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
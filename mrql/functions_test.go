@@ -0,0 +1,256 @@
+package mrql
+
+import (
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// functionSeedStatements give photo_album.png a meta array; they run
+// unchanged on SQLite and Postgres.
+var functionSeedStatements = []string{
+	`UPDATE resources SET meta = '{"rating":3,"authors":["ann","bo","cy"]}' WHERE id = 2`,
+}
+
+// functionCases are the scalar function expectations over setupTestDB plus
+// functionSeedStatements, shared with the Postgres run. Resources 1-3 were
+// created now and resource 4 (untagged_file.txt, originalName untagged.txt)
+// 45 days ago.
+var functionCases = []struct {
+	query string
+	want  []uint
+}{
+	{`LOWER(name) = "SUNSET.JPG"`, []uint{1}},
+	{`UPPER(name) ~ "*ALBUM*"`, []uint{2}},
+	{`LOWER(name) = LOWER(originalName)`, []uint{1, 2, 3}},
+	{`LENGTH(name) > 12`, []uint{2, 4}},
+	{`LENGTH(description) = 0`, []uint{1, 2, 3, 4}},
+	{`EXT(originalName) = "jpg"`, []uint{1}},
+	{`EXT(originalName) = "JPG"`, []uint{1}},
+	{`EXT(name) IN ("png", "pdf")`, []uint{2, 3}},
+	{`EXT(name) NOT IN ("jpg", "txt")`, []uint{2, 3}},
+	{`EXT(hash) = ""`, []uint{1, 2, 3, 4}},
+	{`YEAR(created) >= 2020 AND MONTH(created) BETWEEN 1 AND 12 AND DAY(created) <= 31`, []uint{1, 2, 3, 4}},
+	{`DATE_ADD(created, 30d) < NOW()`, []uint{4}},
+	{`created < DATE_ADD(updated, -30d)`, []uint{4}},
+	{`updated < DATE_ADD(created, 1m)`, []uint{1, 2, 3}},
+	{`DATE_ADD(created, 1w) > -7d`, []uint{1, 2, 3}},
+	{`DATE_ADD(created, 10y) BETWEEN NOW() AND DATE_ADD(updated, 11y)`, []uint{1, 2, 3, 4}},
+	{`JSON_LENGTH(meta.authors) = 3`, []uint{2}},
+	{`JSON_LENGTH(meta.location) = 3`, []uint{1}},
+	{`JSON_LENGTH(meta.rating) > 0`, []uint{}},
+	{`NOT JSON_LENGTH(meta.authors) > 2`, []uint{}},
+}
+
+func seedFunctionData(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	for _, stmt := range functionSeedStatements {
+		if err := db.Exec(stmt).Error; err != nil {
+			t.Fatalf("seed %q: %v", stmt, err)
+		}
+	}
+}
+
+func TestScalarFunctionExecution(t *testing.T) {
+	db := setupTestDB(t)
+	seedFunctionData(t, db)
+	for _, tc := range functionCases {
+		t.Run(tc.query, func(t *testing.T) {
+			got := runResourceIDs(t, db, `type = resource AND `+tc.query)
+			if !eqIDs(got, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+// In a cross-entity query, a function over one entity type's field matches
+// nothing on the others.
+func TestScalarFunctionCrossEntity(t *testing.T) {
+	db := setupTestDB(t)
+	q, err := Parse(`(type = resource AND EXT(originalName) = "pdf") OR (type = note AND LOWER(name) = "todo list") OR YEAR(created) < 2000`)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	if err := Validate(q); err != nil {
+		t.Fatalf("validation error: %v", err)
+	}
+	for _, tc := range []struct {
+		entity EntityType
+		want   int64
+	}{
+		{EntityResource, 1},
+		{EntityNote, 1},
+		{EntityGroup, 0},
+	} {
+		q.EntityType = tc.entity
+		result, err := Translate(q, db)
+		if err != nil {
+			t.Fatalf("translate error: %v", err)
+		}
+		var n int64
+		if err := result.Count(&n).Error; err != nil {
+			t.Fatalf("query error: %v", err)
+		}
+		if n != tc.want {
+			t.Errorf("entity %v: expected %d rows, got %d", tc.entity, tc.want, n)
+		}
+	}
+}
+
+func TestScalarFunctionSelect(t *testing.T) {
+	db := setupTestDB(t)
+	seedFunctionData(t, db)
+	cols, got := runSelectCase(t, db, `type = resource AND id <= 2 SELECT UPPER(name), EXT(originalName) AS ext, LENGTH(name) * 2, JSON_LENGTH(meta.authors) ORDER BY id`)
+	wantCols := []string{"UPPER(name)", "ext", "LENGTH(name) * 2", "JSON_LENGTH(meta.authors)"}
+	if strings.Join(cols, "|") != strings.Join(wantCols, "|") {
+		t.Errorf("columns: got %q, want %q", cols, wantCols)
+	}
+	want := [][]string{{"SUNSET.JPG", "jpg", "20", "NULL"}, {"PHOTO_ALBUM.PNG", "png", "30", "3"}}
+	if len(got) != 2 || strings.Join(got[0], "|") != strings.Join(want[0], "|") || strings.Join(got[1], "|") != strings.Join(want[1], "|") {
+		t.Errorf("rows\n got: %v\nwant: %v", got, want)
+	}
+}
+
+func TestScalarFunctionParse(t *testing.T) {
+	q, err := Parse(`type = resource AND updated > DATE_ADD(created, -2w)`)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	cmp, ok := q.Where.(*BinaryExpr).Right.(*ScalarComparisonExpr)
+	if !ok {
+		t.Fatalf("expected a ScalarComparisonExpr, got %#v", q.Where.(*BinaryExpr).Right)
+	}
+	call, ok := cmp.Right.(*ScalarCall)
+	if !ok || call.Name != "DATE_ADD" || call.Field.Name() != "created" || call.Offset.Amount != -2 || call.Offset.Unit != "w" {
+		t.Errorf("unexpected call: %#v", cmp.Right)
+	}
+
+	// A function name not followed by '(' is a field.
+	if q, err := Parse(`lower = 1`); err != nil {
+		t.Errorf("lower as a field: %v", err)
+	} else if _, ok := q.Where.(*ComparisonExpr); !ok {
+		t.Errorf("lower as a field: got %#v", q.Where)
+	}
+
+	for _, input := range []string{
+		`LOWER(name)`,
+		`LOWER(name`,
+		`LOWER() = "x"`,
+		`LOWER(name, 3d) = "x"`,
+		`DATE_ADD(created) > NOW()`,
+		`DATE_ADD(created, 3) > NOW()`,
+		`DATE_ADD(created, 3 d) > NOW()`,
+		`LOWER(name) NOT = "x"`,
+		`LOWER(name) IN (type = note)`,
+		`LOWER(name) IS NULL`,
+	} {
+		if _, err := Parse(input); err == nil {
+			t.Errorf("Parse(%q) should fail", input)
+		}
+	}
+}
+
+func TestScalarFunctionValidation(t *testing.T) {
+	valid := []string{
+		`type = resource AND LOWER(name) = "x"`,
+		`type = resource AND EXT(originalName) IN ("cr2", "nef")`,
+		`type = note AND YEAR(startDate) = 2025`,
+		`type = resource AND DATE_ADD(created, 3d) > updated`,
+		`type = resource AND JSON_LENGTH(meta.a.b) >= 1`,
+		`type = resource AND LENGTH(description) > $n`,
+		`YEAR(created) = 2025`,
+		`type = group SELECT name, YEAR(created) AS y ORDER BY y`,
+	}
+	for _, query := range valid {
+		t.Run(query, func(t *testing.T) {
+			q, err := Parse(query)
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+			if err := Validate(q); err != nil {
+				t.Errorf("expected valid, got: %v", err)
+			}
+		})
+	}
+
+	invalid := []struct {
+		query       string
+		errContains string
+	}{
+		{`type = resource AND LOWER(created) = "x"`, "LOWER takes a text field; created is a date"},
+		{`type = resource AND YEAR(name) = 2025`, "YEAR takes a date field; name is text"},
+		{`type = resource AND LOWER(tags) = "x"`, "not tags"},
+		{`type = resource AND LOWER(type) = "x"`, "not type"},
+		{`type = resource AND LOWER(owner.name) = "x"`, "field of the queried entity"},
+		{`type = resource AND LOWER(nope) = "x"`, "nope"},
+		{`type = resource AND JSON_LENGTH(name) = 1`, "JSON_LENGTH takes a meta field"},
+		{`type = resource AND LENGTH(name) = "x"`, "returns a number"},
+		{`type = resource AND LENGTH(name) = 2kb`, "size units"},
+		{`type = resource AND LOWER(name) = 3`, "returns text"},
+		{`type = resource AND YEAR(created) = created`, "returns a number"},
+		{`type = resource AND DATE_ADD(created, 3d) > 5`, "returns a date"},
+		{`type = resource AND LENGTH(name) ~ "x"`, "only applies to text"},
+		{`type = resource AND LOWER(name) ~ LOWER(originalName)`, "quoted pattern"},
+		{`type = resource AND LENGTH(name) = YEAR(created) AND LOWER(name) = YEAR(created)`, "cannot compare LOWER(name) (text) with YEAR(created) (a number)"},
+		{`type = resource AND name = YEAR(created)`, "cannot compare name (text) with YEAR(created) (a number)"},
+		{`type = resource AND DATE_ADD(created, 0d) > NOW()`, "must not be zero"},
+		{`type = resource SELECT LOWER(name) * 2`, "LOWER(name) is not numeric"},
+	}
+	for _, tc := range invalid {
+		t.Run(tc.query, func(t *testing.T) {
+			q, err := Parse(tc.query)
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+			err = Validate(q)
+			if err == nil {
+				t.Fatal("expected a validation error")
+			}
+			if !strings.Contains(err.Error(), tc.errContains) {
+				t.Errorf("expected error containing %q, got: %v", tc.errContains, err)
+			}
+		})
+	}
+}
+
+func TestScalarFunctionRegexRequiresPostgres(t *testing.T) {
+	db := setupTestDB(t)
+	q, err := Parse(`type = resource AND LOWER(name) ~* "^sun"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Validate(q); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Translate(q, db); err == nil || !strings.Contains(err.Error(), "PostgreSQL") {
+		t.Errorf("expected a PostgreSQL error, got %v", err)
+	}
+}
+
+func TestScalarFunctionPostgresSQL(t *testing.T) {
+	tc := newMockPostgresTC("resources")
+	tc.entityType = EntityResource
+	for _, c := range []struct {
+		query string
+		want  string
+	}{
+		{`EXT(name) = "jpg"`, `COALESCE(LOWER(SUBSTRING(resources.name FROM '\.([^.]*)$')), '')`},
+		{`YEAR(created) = 2025`, `CAST(EXTRACT(YEAR FROM resources.created_at) AS INTEGER)`},
+		{`DATE_ADD(created, 2w) > NOW()`, `(resources.created_at + INTERVAL '14 days')`},
+		{`DATE_ADD(created, -1m) > NOW()`, `(resources.created_at + INTERVAL '-1 months')`},
+		{`JSON_LENGTH(meta.a) > 1`, `CASE jsonb_typeof((resources.meta->'a')::jsonb) WHEN 'array' THEN jsonb_array_length((resources.meta->'a')::jsonb)`},
+	} {
+		t.Run(c.query, func(t *testing.T) {
+			q := mustParse(t, c.query)
+			sql, ok, err := tc.scalarCallExpr(q.Where.(*ScalarComparisonExpr).Left.(*ScalarCall))
+			if err != nil || !ok {
+				t.Fatalf("scalarCallExpr: %v, %v", ok, err)
+			}
+			if !strings.HasPrefix(sql, c.want) {
+				t.Errorf("expected SQL starting %q, got %s", c.want, sql)
+			}
+		})
+	}
+}
@@ -70,6 +70,8 @@ func walkGeneratedNode(n Node, visit func(Node)) {
 		walkGeneratedNode(x.Right, visit)
 	case *NotExpr:
 		walkGeneratedNode(x.Expr, visit)
+	case *SubqueryInExpr:
+		walkGeneratedNode(x.Where, visit)
 	}
 }
 
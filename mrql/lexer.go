@@ -162,6 +162,20 @@ func (l *Lexer) scan() Token {
 	case '.':
 		l.pos++
 		return Token{Type: TokenDot, Value: ".", Pos: start, Length: 1}
+	case '+':
+		l.pos++
+		return Token{Type: TokenPlus, Value: "+", Pos: start, Length: 1}
+	case '-':
+		// A '-' before a digit was read as a relative date above, so
+		// subtracting a literal needs a space: fileSize - 1024.
+		l.pos++
+		return Token{Type: TokenMinus, Value: "-", Pos: start, Length: 1}
+	case '*':
+		l.pos++
+		return Token{Type: TokenStar, Value: "*", Pos: start, Length: 1}
+	case '/':
+		l.pos++
+		return Token{Type: TokenSlash, Value: "/", Pos: start, Length: 1}
 	}
 
 	// Anything else is illegal
@@ -346,6 +360,15 @@ func (l *Lexer) readWord(start int) Token {
 		l.pos = savedPos
 	}
 
+	// Mutation clause keywords (ADD TAGS, REMOVE TAGS, MOVE TO) are two-word
+	// keywords as well. Either word alone stays a plain identifier.
+	if second, tt, ok := mutationKeywordPair(upper); ok {
+		if end, found := l.followingWord(second); found {
+			l.pos = end
+			return Token{Type: tt, Value: upper + " " + second, Pos: start, Length: l.pos - start}
+		}
+	}
+
 	// Aggregate function keyword: word followed by "(" — emit keyword, don't consume "("
 	if l.pos < len(l.input) && l.input[l.pos] == '(' {
 		if aggType, ok := aggregateKeywords[upper]; ok {
@@ -353,6 +376,13 @@ func (l *Lexer) readWord(start int) Token {
 		}
 	}
 
+	// Scalar function name: word followed by "(" — emit it, don't consume "("
+	if l.pos < len(l.input) && l.input[l.pos] == '(' {
+		if _, ok := scalarFunctions[upper]; ok {
+			return Token{Type: TokenScalarFunc, Value: word, Pos: start, Length: l.pos - start}
+		}
+	}
+
 	// Check if it's a function call: word followed by "()"
 	if l.pos+1 < len(l.input) && l.input[l.pos] == '(' && l.input[l.pos+1] == ')' {
 		funcName := upper
@@ -372,6 +402,38 @@ func (l *Lexer) readWord(start int) Token {
 	return Token{Type: TokenIdentifier, Value: word, Pos: start, Length: l.pos - start}
 }
 
+// mutationKeywordPair returns the second word and token type of the two-word
+// mutation keyword that starts with first.
+func mutationKeywordPair(first string) (string, TokenType, bool) {
+	switch first {
+	case "ADD":
+		return "TAGS", TokenAddTags, true
+	case "REMOVE":
+		return "TAGS", TokenRemoveTags, true
+	case "MOVE":
+		return "TO", TokenMoveTo, true
+	}
+	return "", 0, false
+}
+
+// followingWord reports whether the next word after l.pos (past whitespace) is
+// word, case-insensitively, and returns the offset just past it. l.pos is not
+// moved.
+func (l *Lexer) followingWord(word string) (int, bool) {
+	tmp := l.pos
+	for tmp < len(l.input) && unicode.IsSpace(rune(l.input[tmp])) {
+		tmp++
+	}
+	end := tmp + len(word)
+	if tmp == l.pos || end > len(l.input) || !strings.EqualFold(l.input[tmp:end], word) {
+		return 0, false
+	}
+	if end < len(l.input) && isWordChar(l.input[end]) {
+		return 0, false
+	}
+	return end, true
+}
+
 // keywordMap maps uppercase keyword strings to token types.
 var keywordMap = map[string]TokenType{
 	"AND":    TokenAnd,
@@ -393,11 +455,15 @@ var keywordMap = map[string]TokenType{
 
 // aggregateKeywords maps uppercase aggregate function names to token types.
 var aggregateKeywords = map[string]TokenType{
-	"COUNT": TokenCount,
-	"SUM":   TokenSum,
-	"AVG":   TokenAvg,
-	"MIN":   TokenMin,
-	"MAX":   TokenMax,
+	"COUNT":         TokenCount,
+	"SUM":           TokenSum,
+	"AVG":           TokenAvg,
+	"MIN":           TokenMin,
+	"MAX":           TokenMax,
+	"MEDIAN":        TokenMedian,
+	"PERCENTILE":    TokenPercentile,
+	"RUNNING_SUM":   TokenRunningSum,
+	"RUNNING_COUNT": TokenRunningCount,
 }
 
 // knownFunctions is the set of recognized built-in function names (uppercase).
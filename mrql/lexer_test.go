@@ -49,6 +49,10 @@ func TestLexerOperators(t *testing.T) {
 		{"<=", TokenLte, "<="},
 		{"~", TokenLike, "~"},
 		{"!~", TokenNotLike, "!~"},
+		{"+", TokenPlus, "+"},
+		{"- ", TokenMinus, "-"},
+		{"*", TokenStar, "*"},
+		{"/", TokenSlash, "/"},
 	}
 	for _, tc := range tests {
 		t.Run(tc.input, func(t *testing.T) {
@@ -393,7 +397,7 @@ func TestLexerInList(t *testing.T) {
 
 // TestLexerIllegalToken tests that unrecognized characters become TokenIllegal.
 func TestLexerIllegalToken(t *testing.T) {
-	tests := []string{"@", "#", "$", "^", "&", "*", "|"}
+	tests := []string{"@", "#", "$", "^", "&", "|"}
 	for _, input := range tests {
 		t.Run(input, func(t *testing.T) {
 			l := NewLexer(input)
@@ -531,6 +535,12 @@ func TestLexerNegativeNumberVsRelDate(t *testing.T) {
 	if tok.Type != TokenRelDate {
 		t.Errorf("-1y: got %v, want TokenRelDate", tok.Type)
 	}
+
+	// A spaced minus is subtraction.
+	tokens := tokenize(t, "width - 7")
+	if tokens[1].Type != TokenMinus || tokens[2].Type != TokenNumber {
+		t.Errorf("width - 7: got %v %v, want TokenMinus TokenNumber", tokens[1].Type, tokens[2].Type)
+	}
 }
 
 // TestLexerStringPositionLength tests string token position includes quotes.
@@ -0,0 +1,114 @@
+package mrql
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// validateMutation checks the write clauses of a mutation statement. A
+// mutation targets exactly one entity type and applies to every entity the
+// query matches, so GROUP BY, ORDER BY, LIMIT, and OFFSET are rejected rather
+// than silently narrowing (or being ignored by) the affected set.
+func validateMutation(q *Query, entityType EntityType) error {
+	m := q.Mutation
+	if entityType == EntityUnspecified {
+		return &ValidationError{
+			Message: "a mutation requires an explicit entity type (type = resource, note, or group)",
+			Pos:     m.Token.Pos,
+			Length:  m.Token.Length,
+		}
+	}
+	switch {
+	case q.GroupBy != nil:
+		return &ValidationError{Message: "GROUP BY is not allowed in a mutation", Pos: m.Token.Pos, Length: m.Token.Length}
+	case len(q.OrderBy) > 0, q.Limit >= 0, q.Offset >= 0:
+		return &ValidationError{
+			Message: "ORDER BY, LIMIT, and OFFSET are not allowed in a mutation; it applies to every matching entity",
+			Pos:     m.Token.Pos,
+			Length:  m.Token.Length,
+		}
+	}
+
+	for _, refs := range [][]Node{m.AddTags, m.RemoveTags} {
+		for _, ref := range refs {
+			if err := validateMutationRef(ref, "tag"); err != nil {
+				return err
+			}
+		}
+	}
+	if m.MoveTo != nil {
+		if err := validateMutationRef(m.MoveTo, "group"); err != nil {
+			return err
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, a := range m.SetMeta {
+		if len(a.Field.Parts) != 2 || a.Field.Parts[0].Value != "meta" || a.Field.RelationType != nil {
+			return &ValidationError{
+				Message: fmt.Sprintf("SET only assigns top-level meta keys (meta.<key>), got %s", a.Field.Name()),
+				Pos:     a.Field.Pos(),
+				Length:  len(a.Field.Name()),
+			}
+		}
+		key := a.Field.Parts[1].Value
+		if seen[key] {
+			return &ValidationError{
+				Message: fmt.Sprintf("meta.%s is assigned more than once", key),
+				Pos:     a.Field.Pos(),
+				Length:  len(a.Field.Name()),
+			}
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// validateMutationRef checks a tag or group reference: a non-empty name or a
+// positive integer ID.
+func validateMutationRef(ref Node, kind string) error {
+	switch r := ref.(type) {
+	case *StringLiteral:
+		if r.Value == "" {
+			return &ValidationError{Message: fmt.Sprintf("%s name must not be empty", kind), Pos: r.Pos(), Length: r.Token.Length}
+		}
+	case *NumberLiteral:
+		if r.Unit != "" || r.Value < 1 || r.Value != math.Trunc(r.Value) {
+			return &ValidationError{
+				Message: fmt.Sprintf("%s ID must be a positive integer, got %s", kind, r.Token.Value),
+				Pos:     r.Pos(),
+				Length:  r.Token.Length,
+			}
+		}
+	}
+	return nil
+}
+
+// MetaPatch renders the SET assignments as a JSON merge patch
+// ({"key": value, ...}), the shape the bulk meta editors apply. NULL becomes
+// JSON null, which removes the key. Returns "" when there are no assignments.
+func (m *Mutation) MetaPatch() string {
+	if len(m.SetMeta) == 0 {
+		return ""
+	}
+	patch := make(map[string]any, len(m.SetMeta))
+	for _, a := range m.SetMeta {
+		var v any
+		switch val := a.Value.(type) {
+		case *StringLiteral:
+			v = val.Value
+		case *NumberLiteral:
+			if val.Unit != "" {
+				v = val.Raw
+			} else {
+				v = val.Value
+			}
+		case *BooleanLiteral:
+			v = val.Value
+		}
+		patch[a.Field.Parts[1].Value] = v
+	}
+	out, _ := json.Marshal(patch)
+	return string(out)
+}
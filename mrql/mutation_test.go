@@ -0,0 +1,135 @@
+package mrql
+
+import (
+	"strings"
+	"testing"
+)
+
+func mustParseMutation(t *testing.T, input string) *Query {
+	t.Helper()
+	q, err := ParseMutation(input)
+	if err != nil {
+		t.Fatalf("ParseMutation(%q): %v", input, err)
+	}
+	return q
+}
+
+func TestParseMutationClauses(t *testing.T) {
+	q := mustParseMutation(t, `type = resource AND tags = "inbox" ADD TAGS "triaged", 7 REMOVE TAGS "inbox" SET meta.reviewed = true, meta.score = 4 MOVE TO "Archive"`)
+	m := q.Mutation
+	if m == nil {
+		t.Fatal("expected a mutation")
+	}
+	if len(m.AddTags) != 2 || m.AddTags[0].(*StringLiteral).Value != "triaged" || m.AddTags[1].(*NumberLiteral).Value != 7 {
+		t.Errorf("unexpected ADD TAGS %+v", m.AddTags)
+	}
+	if len(m.RemoveTags) != 1 || m.RemoveTags[0].(*StringLiteral).Value != "inbox" {
+		t.Errorf("unexpected REMOVE TAGS %+v", m.RemoveTags)
+	}
+	if len(m.SetMeta) != 2 {
+		t.Fatalf("expected two SET assignments, got %d", len(m.SetMeta))
+	}
+	if got := m.MoveTo.(*StringLiteral).Value; got != "Archive" {
+		t.Errorf("expected MOVE TO Archive, got %s", got)
+	}
+	if got := m.MetaPatch(); got != `{"reviewed":true,"score":4}` {
+		t.Errorf("unexpected meta patch %s", got)
+	}
+	if err := Validate(q); err != nil {
+		t.Fatalf("validation error: %v", err)
+	}
+}
+
+func TestParseMutationKeywordsAreCaseInsensitive(t *testing.T) {
+	q := mustParseMutation(t, `type = note add tags "a" set meta.x = NULL move   to 3`)
+	if len(q.Mutation.AddTags) != 1 || q.Mutation.MoveTo == nil {
+		t.Fatalf("unexpected mutation %+v", q.Mutation)
+	}
+	if got := q.Mutation.MetaPatch(); got != `{"x":null}` {
+		t.Errorf("expected NULL to render as a JSON null, got %s", got)
+	}
+}
+
+// SET is only a keyword in clause position: fields and values named "set"
+// still parse in the WHERE expression.
+func TestParseMutationSetStaysUsableAsName(t *testing.T) {
+	q := mustParseMutation(t, `type = group AND meta.set = set SET meta.set = "x"`)
+	if len(q.Mutation.SetMeta) != 1 || q.Mutation.SetMeta[0].Field.Name() != "meta.set" {
+		t.Fatalf("unexpected SET %+v", q.Mutation.SetMeta)
+	}
+	if _, err := Parse(`type = group AND meta.set = 1`); err != nil {
+		t.Fatalf("meta.set should remain a valid field: %v", err)
+	}
+}
+
+func TestParseRejectsMutationClauses(t *testing.T) {
+	for _, input := range []string{
+		`type = resource ADD TAGS "a"`,
+		`type = resource REMOVE TAGS "a"`,
+		`type = resource SET meta.a = 1`,
+		`type = resource MOVE TO 1`,
+	} {
+		_, err := Parse(input)
+		if err == nil || !strings.Contains(err.Error(), "only allowed in a mutation statement") {
+			t.Errorf("Parse(%q): expected a mutation-only error, got %v", input, err)
+		}
+	}
+}
+
+func TestParseMutationErrors(t *testing.T) {
+	cases := []struct {
+		input      string
+		wantSubstr string
+	}{
+		{`type = resource`, "expected at least one mutation clause"},
+		{`type = resource ADD TAGS`, "expected a quoted name or numeric ID after ADD TAGS"},
+		{`type = resource ADD TAGS inbox`, "expected a quoted name or numeric ID"},
+		{`type = resource SET meta.a 1`, "expected '=' after meta.a in SET"},
+		{`type = resource SET meta.a = -7d`, "expected a string, number, true, false, or NULL in SET"},
+		{`type = resource MOVE TO 1 MOVE TO 2`, "MOVE TO may appear only once"},
+		{`type = resource ADD TAGS "a" LIMIT 5`, `unexpected token "LIMIT"`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.input, func(t *testing.T) {
+			_, err := ParseMutation(tc.input)
+			if err == nil {
+				t.Fatalf("expected parse error for %q", tc.input)
+			}
+			if !strings.Contains(err.Error(), tc.wantSubstr) {
+				t.Errorf("error mismatch:\nwant substring: %s\ngot: %v", tc.wantSubstr, err)
+			}
+		})
+	}
+}
+
+func TestValidateMutation(t *testing.T) {
+	cases := []struct {
+		input      string
+		wantSubstr string
+	}{
+		{`name = "x" ADD TAGS "a"`, "requires an explicit entity type"},
+		{`ADD TAGS "a"`, "requires an explicit entity type"},
+		{`type = resource ORDER BY name LIMIT 10 ADD TAGS "a"`, "ORDER BY, LIMIT, and OFFSET are not allowed in a mutation"},
+		{`type = resource LIMIT 10 ADD TAGS "a"`, "not allowed in a mutation"},
+		{`type = resource GROUP BY contentType ADD TAGS "a"`, "GROUP BY is not allowed in a mutation"},
+		{`type = resource SET name = "x"`, "SET only assigns top-level meta keys"},
+		{`type = resource SET meta.a.b = 1`, "SET only assigns top-level meta keys"},
+		{`type = resource SET meta.a = 1, meta.a = 2`, "meta.a is assigned more than once"},
+		{`type = resource ADD TAGS ""`, "tag name must not be empty"},
+		{`type = resource ADD TAGS 1.5`, "tag ID must be a positive integer"},
+		{`type = resource MOVE TO 2mb`, "group ID must be a positive integer"},
+		{`type = resource AND bogus = 1 ADD TAGS "a"`, "unknown or invalid field"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.input, func(t *testing.T) {
+			q := mustParseMutation(t, tc.input)
+			err := Validate(q)
+			if err == nil {
+				t.Fatalf("expected validation error for %q", tc.input)
+			}
+			if !strings.Contains(err.Error(), tc.wantSubstr) {
+				t.Errorf("error mismatch:\nwant substring: %s\ngot: %v", tc.wantSubstr, err)
+			}
+		})
+	}
+}
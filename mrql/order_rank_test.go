@@ -80,11 +80,10 @@ func TestRankValidationGroupBy(t *testing.T) {
 }
 
 func TestRankValidationCrossEntity(t *testing.T) {
-	// No type filter, TEXT present → entity unspecified → rejected.
+	// No type filter: each UNION ALL branch ranks against its own index.
 	q := mustParse(t, `TEXT ~ "a" ORDER BY RANK`)
-	err := Validate(q)
-	if err == nil || !strings.Contains(err.Error(), "requires a single entity type") {
-		t.Fatalf("expected cross-entity rejection, got %v", err)
+	if err := Validate(q); err != nil {
+		t.Fatalf("expected cross-entity RANK to validate, got %v", err)
 	}
 }
 
@@ -198,3 +197,39 @@ func TestRankEmptyTermNoOp(t *testing.T) {
 		t.Fatalf("empty-term should drop predicate+ordering, expected all 3 rows, got %d", len(resources))
 	}
 }
+
+// Cross-entity RANK: each UNION ALL branch ranks against its own FTS table and
+// one ORDER BY sorts the scores together. A branch without an index (groups
+// here) cannot rank and is left out, as a failing branch always has been.
+func TestRankCrossEntityUnionSQLite(t *testing.T) {
+	db := setupRankTestDB(t)
+	if err := db.AutoMigrate(&testGroup{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	now := time.Now()
+	db.Create(&testNote{ID: 1, Name: "standup", Description: "kubernetes upgrade plan", CreatedAt: now, UpdatedAt: now, Meta: `{}`})
+	db.Create(&testGroup{ID: 1, Name: "kubernetes", Meta: `{}`})
+	for _, ddl := range []string{
+		`CREATE VIRTUAL TABLE notes_fts USING fts5(name, description, content='notes', content_rowid='id')`,
+		`INSERT INTO notes_fts(notes_fts) VALUES('rebuild')`,
+	} {
+		if err := db.Exec(ddl).Error; err != nil {
+			t.Fatalf("fts setup: %v", err)
+		}
+	}
+
+	got := unionRows(t, db, `TEXT ~ "kubernetes" ORDER BY RANK`, TranslateOptions{})
+	if len(got) != 3 {
+		t.Fatalf("expected two resources and one note, got %v", got)
+	}
+	position := map[string]int{}
+	for i, row := range got {
+		position[row] = i
+	}
+	if _, ok := position["note:1"]; !ok {
+		t.Fatalf("expected the matching note in the union, got %v", got)
+	}
+	if position["resource:1"] > position["resource:2"] {
+		t.Fatalf("expected doc_a ahead of doc_b by relevance, got %v", got)
+	}
+}
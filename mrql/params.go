@@ -9,25 +9,29 @@ import (
 	"strings"
 )
 
-// AggregatedColumns returns the ordered result-map column names for an
-// aggregated GROUP BY query: the (deduplicated) group-by field names followed
-// by the aggregate aliases, matching the SELECT aliases used by
-// BuildAggregatedGroupBy. Returns nil when the query is not an aggregated
-// GROUP BY. Call after Validate (which deduplicates GroupBy.Fields).
+// AggregatedColumns returns the ordered result-map column names for a tabular
+// query (see Query.IsTabular): for an aggregated GROUP BY, the (deduplicated)
+// group-by field names followed by the aggregate aliases, matching the SELECT
+// aliases used by BuildAggregatedGroupBy; for a SELECT projection, the column
+// names BuildProjection uses. Returns nil for any other query. Call after
+// Validate (which deduplicates GroupBy.Fields).
 func AggregatedColumns(q *Query) []string {
-	if q == nil || q.GroupBy == nil || len(q.GroupBy.Aggregates) == 0 {
+	if q == nil || !q.IsTabular() {
 		return nil
 	}
+	if q.Select != nil {
+		cols := make([]string, len(q.Select.Columns))
+		for i, c := range q.Select.Columns {
+			cols[i] = c.Name()
+		}
+		return cols
+	}
 	cols := make([]string, 0, len(q.GroupBy.Fields)+len(q.GroupBy.Aggregates))
 	for _, f := range q.GroupBy.Fields {
 		cols = append(cols, f.Name())
 	}
 	for _, agg := range q.GroupBy.Aggregates {
-		if agg.Field == nil {
-			cols = append(cols, "count")
-		} else {
-			cols = append(cols, strings.ToLower(agg.Name)+"_"+agg.Field.Name())
-		}
+		cols = append(cols, agg.Key())
 	}
 	return cols
 }
@@ -260,10 +264,16 @@ func walkExprValues(node Node, visit func(*Node)) {
 		walkExprValues(n.Expr, visit)
 	case *ComparisonExpr:
 		visit(&n.Value)
+	case *ScalarComparisonExpr:
+		if _, isCall := n.Right.(*ScalarCall); !isCall {
+			visit(&n.Right)
+		}
 	case *InExpr:
 		for i := range n.Values {
 			visit(&n.Values[i])
 		}
+	case *SubqueryInExpr:
+		walkExprValues(n.Where, visit)
 	}
 	// IsExpr, TextSearchExpr, SimilarToExpr carry no value-position placeholders.
 }
@@ -24,15 +24,38 @@ func (e *ParseError) Error() string {
 type parser struct {
 	lexer *Lexer
 	depth int
+	// mutation allows the trailing mutation clauses (ParseMutation only).
+	mutation bool
 }
 
 // Parse parses the given input string as an MRQL query and returns the AST.
 // Returns *ParseError for parse errors.
 func Parse(input string) (*Query, error) {
+	return parse(input, false)
+}
+
+// ParseMutation parses a mutation statement: a query followed by one or more
+// of ADD TAGS, REMOVE TAGS, SET meta.<key> = value, and MOVE TO <group>. Parse
+// rejects those clauses, so a mutation can never reach a read path.
+func ParseMutation(input string) (*Query, error) {
+	q, err := parse(input, true)
+	if err != nil {
+		return nil, err
+	}
+	if q.Mutation == nil {
+		return nil, &ParseError{
+			Message: "expected at least one mutation clause (ADD TAGS, REMOVE TAGS, SET, or MOVE TO)",
+			Pos:     len(input),
+		}
+	}
+	return q, nil
+}
+
+func parse(input string, mutation bool) (*Query, error) {
 	if len(input) > MaxQueryBytes {
 		return nil, querySizeError()
 	}
-	p := &parser{lexer: newBoundedLexer(input)}
+	p := &parser{lexer: newBoundedLexer(input), mutation: mutation}
 	q, err := p.parseQuery()
 	if p.lexer.limitErr != nil {
 		return nil, p.lexer.limitErr
@@ -43,7 +66,7 @@ func Parse(input string) (*Query, error) {
 	return q, err
 }
 
-// parseQuery = [expression] [orderBy] [limit] [offset]
+// parseQuery = [expression] [scope] [asOf] [select] [groupBy] [orderBy] [limit] [offset] [mutation]
 func (p *parser) parseQuery() (*Query, error) {
 	q := &Query{
 		Limit:       -1,
@@ -54,7 +77,7 @@ func (p *parser) parseQuery() (*Query, error) {
 	// Parse optional WHERE expression — but only if the next token looks like
 	// the start of an expression. ORDER BY, LIMIT, OFFSET signal no WHERE clause.
 	tok := p.lexer.Peek()
-	if tok.Type != TokenEOF && tok.Type != TokenOrderBy && tok.Type != TokenLimit && tok.Type != TokenOffset && tok.Type != TokenGroupBy && tok.Type != TokenScope {
+	if tok.Type != TokenEOF && tok.Type != TokenOrderBy && tok.Type != TokenLimit && tok.Type != TokenOffset && tok.Type != TokenGroupBy && tok.Type != TokenScope && !isMutationKeyword(tok.Type) {
 		var err error
 		q.Where, err = p.parseExpression()
 		if err != nil {
@@ -71,6 +94,24 @@ func (p *parser) parseQuery() (*Query, error) {
 		q.Scope = scope
 	}
 
+	// Optional AS OF
+	if isAsOfStart(p.lexer.Peek()) {
+		asOf, err := p.parseAsOf()
+		if err != nil {
+			return nil, err
+		}
+		q.AsOf = asOf
+	}
+
+	// Optional SELECT
+	if isSelectStart(p.lexer.Peek()) {
+		sel, err := p.parseSelect()
+		if err != nil {
+			return nil, err
+		}
+		q.Select = sel
+	}
+
 	// Optional GROUP BY
 	if p.lexer.Peek().Type == TokenGroupBy {
 		groupBy, err := p.parseGroupBy()
@@ -125,6 +166,23 @@ func (p *parser) parseQuery() (*Query, error) {
 		q.Offset = n
 	}
 
+	// Optional mutation clauses
+	if isMutationStart(p.lexer.Peek()) {
+		if !p.mutation {
+			tok := p.lexer.Peek()
+			return nil, &ParseError{
+				Message: fmt.Sprintf("%s is only allowed in a mutation statement (POST /v1/mrql/mutate)", strings.ToUpper(tok.Value)),
+				Pos:     tok.Pos,
+				Length:  tok.Length,
+			}
+		}
+		mutation, err := p.parseMutation()
+		if err != nil {
+			return nil, err
+		}
+		q.Mutation = mutation
+	}
+
 	// Should be at EOF now
 	final := p.lexer.Peek()
 	if final.Type != TokenEOF {
@@ -158,8 +216,10 @@ func (p *parser) parseQuery() (*Query, error) {
 // type is implied by the page, and queries must be self-contained.
 //
 // Compared to Parse it rejects, each with a position that matches the input 1:1:
-//   - clause keywords (ORDER BY, LIMIT, OFFSET, GROUP BY, HAVING, SCOPE);
-//   - the `type` pseudo-field (implied by the page);
+//   - clause keywords (ORDER BY, LIMIT, OFFSET, GROUP BY, HAVING, SCOPE,
+//     AS OF, SELECT);
+//   - the `type` pseudo-field (implied by the page), except as the entity
+//     selector inside an IN sub-query;
 //   - `$name` parameter placeholders (there are no param inputs on list pages).
 //
 // Everything else in the expression grammar is allowed, including
@@ -186,7 +246,8 @@ func ParseFilter(entity EntityType, input string) (*Query, error) {
 	}
 
 	// Anything left after a complete expression is a clause keyword (ORDER BY,
-	// LIMIT, OFFSET, GROUP BY, HAVING, SCOPE) or stray input — none allowed here.
+	// LIMIT, OFFSET, GROUP BY, HAVING, SCOPE, AS OF, SELECT) or stray input — none
+	// allowed here.
 	if tok := p.lexer.Peek(); tok.Type != TokenEOF {
 		return nil, filterTrailingTokenError(tok)
 	}
@@ -210,13 +271,25 @@ func ParseFilter(entity EntityType, input string) (*Query, error) {
 // positioned ParseError. Clause keywords get a targeted message; anything else
 // falls back to the generic "unexpected token" phrasing.
 func filterTrailingTokenError(tok Token) *ParseError {
-	switch tok.Type {
-	case TokenOrderBy, TokenLimit, TokenOffset, TokenGroupBy, TokenHaving, TokenScope:
+	switch {
+	case tok.Type == TokenOrderBy, tok.Type == TokenLimit, tok.Type == TokenOffset, tok.Type == TokenGroupBy, tok.Type == TokenHaving, tok.Type == TokenScope:
 		return &ParseError{
 			Message: fmt.Sprintf("%s is not allowed in a filter expression; the list page controls sort and pagination", strings.ToUpper(tok.Value)),
 			Pos:     tok.Pos,
 			Length:  tok.Length,
 		}
+	case isSelectStart(tok):
+		return &ParseError{
+			Message: "SELECT is not allowed in a filter expression; the list page shows whole entities",
+			Pos:     tok.Pos,
+			Length:  tok.Length,
+		}
+	case isAsOfStart(tok):
+		return &ParseError{
+			Message: "AS OF is not allowed in a filter expression; the list page shows current entities",
+			Pos:     tok.Pos,
+			Length:  tok.Length,
+		}
 	default:
 		return &ParseError{
 			Message: fmt.Sprintf("unexpected token %q after filter expression", tok.Value),
@@ -294,7 +367,7 @@ func (p *parser) parseNotExpr() (Node, error) {
 	return p.parsePrimary()
 }
 
-// primary = "(" expression ")" | textSearch | fieldExpr
+// primary = "(" expression ")" | textSearch | scalarCallExpr | fieldExpr
 func (p *parser) parsePrimary() (Node, error) {
 	tok := p.lexer.Peek()
 
@@ -325,6 +398,9 @@ func (p *parser) parsePrimary() (Node, error) {
 	case TokenSimilarTo:
 		return p.parseSimilarTo()
 
+	case TokenScalarFunc:
+		return p.parseScalarCallExpr()
+
 	case TokenIdentifier, TokenKwType, TokenHaving:
 		// TokenHaving: the word "having" stays usable as a field name here —
 		// the HAVING clause is only recognized inside GROUP BY.
@@ -490,6 +566,174 @@ func (p *parser) parseFieldExpr() (Node, error) {
 	}
 }
 
+// scalarCallExpr = scalarCall (op operand | ["NOT"] "IN" "(" value ("," value)* ")" | ["NOT"] "BETWEEN" operand "AND" operand)
+//
+// IN desugars into `call = v1 OR call = v2 ...` (wrapped in NotExpr for NOT
+// IN) and BETWEEN as it does for a field, so every consumer sees only
+// ScalarComparisonExpr nodes.
+func (p *parser) parseScalarCallExpr() (Node, error) {
+	call, err := p.parseScalarCall()
+	if err != nil {
+		return nil, err
+	}
+
+	next := p.lexer.Peek()
+	var notTok *Token
+	if next.Type == TokenNot {
+		tok := p.lexer.Next() // consume NOT
+		notTok = &tok
+		next = p.lexer.Peek()
+	}
+	isBetween := next.Type == TokenIdentifier && strings.EqualFold(next.Value, "BETWEEN")
+
+	switch {
+	case isBetween:
+		return p.parseBetween(call, notTok)
+	case next.Type == TokenIn:
+		return p.parseScalarIn(call, notTok)
+	case notTok != nil:
+		return nil, &ParseError{
+			Message: fmt.Sprintf("expected IN or BETWEEN after %s(...) NOT, got %q", call.Name, next.Value),
+			Pos:     notTok.Pos,
+			Length:  notTok.Length,
+		}
+	}
+
+	switch next.Type {
+	case TokenEq, TokenNeq, TokenGt, TokenGte, TokenLt, TokenLte, TokenLike, TokenNotLike, TokenRegex, TokenNotRegex:
+		return p.parseComparison(call)
+	}
+	return nil, &ParseError{
+		Message: fmt.Sprintf("expected comparison operator, IN, or BETWEEN after %s(...), got %q", call.Name, next.Value),
+		Pos:     next.Pos,
+		Length:  next.Length,
+	}
+}
+
+// parseScalarIn desugars `call [NOT] IN (v1, v2, ...)` into equality
+// comparisons joined by OR. The synthesized tokens carry the IN token's
+// position.
+func (p *parser) parseScalarIn(call *ScalarCall, notTok *Token) (Node, error) {
+	inTok := p.lexer.Next() // consume IN
+
+	lp := p.lexer.Next()
+	if lp.Type != TokenLParen {
+		return nil, &ParseError{
+			Message: fmt.Sprintf("expected '(' after IN, got %q", lp.Value),
+			Pos:     lp.Pos,
+			Length:  lp.Length,
+		}
+	}
+	if p.lexer.Peek().Type == TokenKwType {
+		tok := p.lexer.Peek()
+		return nil, &ParseError{
+			Message: fmt.Sprintf("%s(...) IN takes a list of values, not a sub-query", call.Name),
+			Pos:     tok.Pos,
+			Length:  tok.Length,
+		}
+	}
+	values, err := p.parseInValues()
+	if err != nil {
+		return nil, err
+	}
+
+	eqTok := Token{Type: TokenEq, Value: "=", Pos: inTok.Pos, Length: inTok.Length}
+	orTok := Token{Type: TokenOr, Value: "OR", Pos: inTok.Pos, Length: inTok.Length}
+	var expr Node = &ScalarComparisonExpr{Left: call, Operator: eqTok, Right: values[0]}
+	for _, v := range values[1:] {
+		next := &ScalarComparisonExpr{Left: copyOperand(call), Operator: eqTok, Right: v}
+		expr = &BinaryExpr{Left: expr, Operator: orTok, Right: next}
+	}
+	if notTok != nil {
+		return &NotExpr{Token: *notTok, Expr: expr}, nil
+	}
+	return expr, nil
+}
+
+// scalarCall = SCALAR_FUNC "(" field ["," dateOffset] ")"
+//
+// Only DATE_ADD takes the second argument.
+func (p *parser) parseScalarCall() (*ScalarCall, error) {
+	nameTok := p.lexer.Next()
+	p.lexer.Next() // consume '(' — the lexer emits TokenScalarFunc only before one
+
+	field, err := p.parseField()
+	if err != nil {
+		return nil, err
+	}
+	call := &ScalarCall{Token: nameTok, Name: strings.ToUpper(nameTok.Value), Field: field}
+
+	if call.Name == "DATE_ADD" {
+		comma := p.lexer.Next()
+		if comma.Type != TokenComma {
+			return nil, &ParseError{
+				Message: fmt.Sprintf("DATE_ADD takes a date field and an offset, e.g. DATE_ADD(created, 3d); got %q", comma.Value),
+				Pos:     comma.Pos,
+				Length:  comma.Length,
+			}
+		}
+		if call.Offset, err = p.parseDateOffset(); err != nil {
+			return nil, err
+		}
+	}
+
+	rp := p.lexer.Next()
+	if rp.Type == TokenComma {
+		return nil, &ParseError{
+			Message: fmt.Sprintf("%s takes a single field argument", call.Name),
+			Pos:     rp.Pos,
+			Length:  rp.Length,
+		}
+	}
+	if rp.Type != TokenRParen {
+		return nil, &ParseError{
+			Message: fmt.Sprintf("expected ')' to close %s(, got %q", call.Name, rp.Value),
+			Pos:     rp.Pos,
+			Length:  rp.Length,
+		}
+	}
+	return call, nil
+}
+
+// dateOffset = REL_DATE | NUMBER unit
+//
+// A positive offset is a plain integer with the unit (d, w, m, y) written
+// directly after it: 3d, 1y. The lexer reads that as a number followed by an
+// identifier, so the two tokens are joined here.
+func (p *parser) parseDateOffset() (*DateOffset, error) {
+	tok := p.lexer.Next()
+	switch tok.Type {
+	case TokenRelDate:
+		rd, err := parseRelDateLiteral(tok)
+		if err != nil {
+			return nil, err
+		}
+		return &DateOffset{Token: tok, Amount: -rd.Amount, Unit: rd.Unit}, nil
+	case TokenNumber:
+		unit := p.lexer.Peek()
+		amount, err := strconv.Atoi(tok.Value)
+		if err == nil && unit.Type == TokenIdentifier && unit.Pos == tok.Pos+tok.Length && isDateOffsetUnit(unit.Value) {
+			p.lexer.Next() // consume the unit
+			joined := Token{Type: TokenRelDate, Value: tok.Value + unit.Value, Pos: tok.Pos, Length: tok.Length + unit.Length}
+			return &DateOffset{Token: joined, Amount: amount, Unit: strings.ToLower(unit.Value)}, nil
+		}
+	}
+	return nil, &ParseError{
+		Message: fmt.Sprintf("expected a date offset such as 3d, -2w, 1m or -1y, got %q", tok.Value),
+		Pos:     tok.Pos,
+		Length:  tok.Length,
+	}
+}
+
+// isDateOffsetUnit reports whether s is a relative-date unit letter.
+func isDateOffsetUnit(s string) bool {
+	switch strings.ToLower(s) {
+	case "d", "w", "m", "y":
+		return true
+	}
+	return false
+}
+
 // maxFieldParts is the maximum number of parts in a dotted field expression.
 const maxFieldParts = 8
 
@@ -501,7 +745,9 @@ func isFieldNameToken(tok Token) bool {
 	return tok.Type == TokenIdentifier || tok.Type == TokenKwType || tok.Type == TokenHaving
 }
 
-// parseField reads a field name: IDENT (. IDENT)* with up to maxFieldParts parts.
+// parseField reads a field name: IDENT ["(" STRING ")"] (. IDENT)* with up to
+// maxFieldParts parts. The parenthesized argument is only accepted on the typed
+// relation roots (relations, backRelations).
 func (p *parser) parseField() (*FieldExpr, error) {
 	tok := p.lexer.Next()
 	if !isFieldNameToken(tok) {
@@ -513,6 +759,30 @@ func (p *parser) parseField() (*FieldExpr, error) {
 	}
 
 	parts := []Token{tok}
+	field := &FieldExpr{Parts: parts}
+
+	// Typed relation roots take the relation type as an argument:
+	// relations("depicts").name, backRelations("parent of") IS NOT EMPTY.
+	if relatedRoots[tok.Value].typed && p.lexer.Peek().Type == TokenLParen {
+		p.lexer.Next() // consume '('
+		argTok := p.lexer.Next()
+		if argTok.Type != TokenString {
+			return nil, &ParseError{
+				Message: fmt.Sprintf("expected a quoted relation type in %s(...), got %q", tok.Value, argTok.Value),
+				Pos:     argTok.Pos,
+				Length:  argTok.Length,
+			}
+		}
+		closeTok := p.lexer.Next()
+		if closeTok.Type != TokenRParen {
+			return nil, &ParseError{
+				Message: fmt.Sprintf("expected ')' after relation type, got %q", closeTok.Value),
+				Pos:     closeTok.Pos,
+				Length:  closeTok.Length,
+			}
+		}
+		field.RelationType = &StringLiteral{Token: argTok, Value: argTok.Value}
+	}
 
 	for p.lexer.Peek().Type == TokenDot {
 		if len(parts) >= maxFieldParts {
@@ -526,7 +796,9 @@ func (p *parser) parseField() (*FieldExpr, error) {
 		p.lexer.Next() // consume '.'
 
 		nextTok := p.lexer.Next()
-		if !isFieldNameToken(nextTok) {
+		// TEXT only starts a full-text predicate at the head of an
+		// expression; after a dot it is a field name (blocks.text).
+		if !isFieldNameToken(nextTok) && nextTok.Type != TokenText {
 			return nil, &ParseError{
 				Message: fmt.Sprintf("expected identifier after '.', got %q", nextTok.Value),
 				Pos:     nextTok.Pos,
@@ -536,23 +808,39 @@ func (p *parser) parseField() (*FieldExpr, error) {
 		parts = append(parts, nextTok)
 	}
 
-	return &FieldExpr{Parts: parts}, nil
+	field.Parts = parts
+	return field, nil
 }
 
-// parseComparison = op value
-func (p *parser) parseComparison(field *FieldExpr) (Node, error) {
+// parseComparison = op operand
+func (p *parser) parseComparison(left Node) (Node, error) {
 	opTok := p.lexer.Next() // consume operator
 
-	val, err := p.parseValue()
+	val, err := p.parseOperand()
 	if err != nil {
 		return nil, err
 	}
 
-	return &ComparisonExpr{
-		Field:    field,
-		Operator: opTok,
-		Value:    val,
-	}, nil
+	return newComparison(left, opTok, val), nil
+}
+
+// parseOperand = scalarCall | value
+func (p *parser) parseOperand() (Node, error) {
+	if p.lexer.Peek().Type == TokenScalarFunc {
+		return p.parseScalarCall()
+	}
+	return p.parseValue()
+}
+
+// newComparison builds `left op value`: a ComparisonExpr for a field compared
+// with a value, and a ScalarComparisonExpr when either side is a scalar call.
+func newComparison(left Node, op Token, value Node) Node {
+	if f, ok := left.(*FieldExpr); ok {
+		if _, isCall := value.(*ScalarCall); !isCall {
+			return &ComparisonExpr{Field: f, Operator: op, Value: value}
+		}
+	}
+	return &ScalarComparisonExpr{Left: left, Operator: op, Right: value}
 }
 
 // parseBetween parses `BETWEEN lo AND hi` and desugars it into existing nodes:
@@ -561,11 +849,12 @@ func (p *parser) parseComparison(field *FieldExpr) (Node, error) {
 // operate on the desugared tree unchanged. The synthesized operator/AND tokens
 // carry the BETWEEN token's position so downstream errors still point at the
 // query text. The two comparisons get separate FieldExpr nodes (sharing the
-// read-only Parts slice) to avoid shared-node aliasing.
-func (p *parser) parseBetween(field *FieldExpr, notTok *Token) (Node, error) {
+// read-only Parts slice) to avoid shared-node aliasing. A scalar call
+// (YEAR(created) BETWEEN 2020 AND 2023) desugars the same way.
+func (p *parser) parseBetween(left Node, notTok *Token) (Node, error) {
 	betweenTok := p.lexer.Next() // consume BETWEEN identifier
 
-	lo, err := p.parseValue()
+	lo, err := p.parseOperand()
 	if err != nil {
 		return nil, err
 	}
@@ -579,7 +868,7 @@ func (p *parser) parseBetween(field *FieldExpr, notTok *Token) (Node, error) {
 		}
 	}
 
-	hi, err := p.parseValue()
+	hi, err := p.parseOperand()
 	if err != nil {
 		return nil, err
 	}
@@ -588,9 +877,8 @@ func (p *parser) parseBetween(field *FieldExpr, notTok *Token) (Node, error) {
 	lteTok := Token{Type: TokenLte, Value: "<=", Pos: betweenTok.Pos, Length: betweenTok.Length}
 	andSynth := Token{Type: TokenAnd, Value: "AND", Pos: betweenTok.Pos, Length: betweenTok.Length}
 
-	fieldHi := &FieldExpr{Parts: field.Parts}
-	lower := &ComparisonExpr{Field: field, Operator: gteTok, Value: lo}
-	upper := &ComparisonExpr{Field: fieldHi, Operator: lteTok, Value: hi}
+	lower := newComparison(left, gteTok, lo)
+	upper := newComparison(copyOperand(left), lteTok, hi)
 	andExpr := &BinaryExpr{Left: lower, Operator: andSynth, Right: upper}
 
 	if notTok != nil {
@@ -599,7 +887,20 @@ func (p *parser) parseBetween(field *FieldExpr, notTok *Token) (Node, error) {
 	return andExpr, nil
 }
 
-// parseInExpr = ["NOT"] "IN" "(" value ("," value)* ")"
+// copyOperand returns a shallow copy of a comparison's left side, so the
+// comparisons a BETWEEN or IN desugars into do not share a node.
+func copyOperand(n Node) Node {
+	switch n := n.(type) {
+	case *FieldExpr:
+		return &FieldExpr{Parts: n.Parts, RelationType: n.RelationType}
+	case *ScalarCall:
+		c := *n
+		return &c
+	}
+	return n
+}
+
+// parseInExpr = ["NOT"] "IN" "(" (value ("," value)* | subquery) ")"
 func (p *parser) parseInExpr(field *FieldExpr, negated bool) (Node, error) {
 	inTok := p.lexer.Next() // consume IN
 
@@ -612,6 +913,27 @@ func (p *parser) parseInExpr(field *FieldExpr, negated bool) (Node, error) {
 		}
 	}
 
+	// `type` can never be a list value (parseValue rejects the keyword), so a
+	// leading `type` unambiguously opens a sub-select without extra lookahead.
+	if p.lexer.Peek().Type == TokenKwType {
+		return p.parseSubqueryIn(field, negated, inTok, lp)
+	}
+
+	values, err := p.parseInValues()
+	if err != nil {
+		return nil, err
+	}
+
+	return &InExpr{
+		Field:   field,
+		Negated: negated,
+		Values:  values,
+		InToken: inTok,
+	}, nil
+}
+
+// parseInValues = value ("," value)* ")"
+func (p *parser) parseInValues() ([]Node, error) {
 	values := make([]Node, 0, 8)
 
 	// Must have at least one value.
@@ -641,12 +963,40 @@ func (p *parser) parseInExpr(field *FieldExpr, negated bool) (Node, error) {
 			Length:  rp.Length,
 		}
 	}
+	return values, nil
+}
 
-	return &InExpr{
+// subquery = "type" "=" entity ("AND" notExpr)*
+//
+// Grammatically any expression that starts with `type`; the validator requires
+// the inner entity to be pinned by a top-level `type =` comparison. The
+// sub-select counts against the same expression depth as a parenthesized
+// group, so nested sub-selects stay bounded by MaxExpressionDepth and share the
+// query's token budget.
+func (p *parser) parseSubqueryIn(field *FieldExpr, negated bool, inTok, lp Token) (Node, error) {
+	if err := p.enterExpression(lp); err != nil {
+		return nil, err
+	}
+	where, err := p.parseExpression()
+	p.depth--
+	if err != nil {
+		return nil, err
+	}
+
+	rp := p.lexer.Next()
+	if rp.Type != TokenRParen {
+		return nil, &ParseError{
+			Message: fmt.Sprintf("expected ')' to close IN sub-query, got %q", rp.Value),
+			Pos:     rp.Pos,
+			Length:  rp.Length,
+		}
+	}
+
+	return &SubqueryInExpr{
 		Field:   field,
 		Negated: negated,
-		Values:  values,
 		InToken: inTok,
+		Where:   where,
 	}, nil
 }
 
@@ -778,6 +1128,169 @@ func (p *parser) parseScope() (*ScopeClause, error) {
 	}
 }
 
+// isAsOfStart reports whether tok begins an AS OF clause. AS is a contextual
+// word: after a complete expression or SCOPE clause nothing else starts with
+// it.
+func isAsOfStart(tok Token) bool {
+	return tok.Type == TokenIdentifier && strings.EqualFold(tok.Value, "AS")
+}
+
+// parseAsOf = "AS" "OF" (STRING | REL_DATE | FUNC)
+func (p *parser) parseAsOf() (*AsOfClause, error) {
+	asTok := p.lexer.Next() // consume AS
+	if ofTok := p.lexer.Next(); ofTok.Type != TokenIdentifier || !strings.EqualFold(ofTok.Value, "OF") {
+		return nil, &ParseError{
+			Message: fmt.Sprintf("expected OF after AS, got %q", ofTok.Value),
+			Pos:     ofTok.Pos,
+			Length:  ofTok.Length,
+		}
+	}
+	valTok := p.lexer.Peek()
+	switch valTok.Type {
+	case TokenString, TokenRelDate, TokenFunc:
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		return &AsOfClause{Token: asTok, Value: value}, nil
+	default:
+		return nil, &ParseError{
+			Message: fmt.Sprintf("expected a date, relative date or date function after AS OF, got %q", valTok.Value),
+			Pos:     valTok.Pos,
+			Length:  valTok.Length,
+		}
+	}
+}
+
+// isMutationKeyword reports whether tt is one of the two-word mutation keywords.
+func isMutationKeyword(tt TokenType) bool {
+	return tt == TokenAddTags || tt == TokenRemoveTags || tt == TokenMoveTo
+}
+
+// isMutationStart reports whether tok begins a mutation clause. SET is not a
+// lexer keyword, so fields and meta keys named "set" keep working; it is only
+// recognized here, where a complete query has already been read.
+func isMutationStart(tok Token) bool {
+	return isMutationKeyword(tok.Type) || (tok.Type == TokenIdentifier && strings.EqualFold(tok.Value, "SET"))
+}
+
+// parseMutation = clause+
+// clause = ("ADD TAGS" | "REMOVE TAGS") ref ("," ref)*
+//
+//	| "SET" field "=" metaValue ("," field "=" metaValue)*
+//	| "MOVE TO" ref
+func (p *parser) parseMutation() (*Mutation, error) {
+	m := &Mutation{Token: p.lexer.Peek()}
+	for {
+		tok := p.lexer.Peek()
+		switch {
+		case tok.Type == TokenAddTags || tok.Type == TokenRemoveTags:
+			p.lexer.Next()
+			refs, err := p.parseMutationRefs(tok)
+			if err != nil {
+				return nil, err
+			}
+			if tok.Type == TokenAddTags {
+				m.AddTags = append(m.AddTags, refs...)
+			} else {
+				m.RemoveTags = append(m.RemoveTags, refs...)
+			}
+		case tok.Type == TokenMoveTo:
+			if m.MoveTo != nil {
+				return nil, &ParseError{Message: "MOVE TO may appear only once", Pos: tok.Pos, Length: tok.Length}
+			}
+			p.lexer.Next()
+			ref, err := p.parseMutationRef(tok)
+			if err != nil {
+				return nil, err
+			}
+			m.MoveTo = ref
+		case isMutationStart(tok):
+			p.lexer.Next() // consume SET
+			for {
+				field, err := p.parseField()
+				if err != nil {
+					return nil, err
+				}
+				eq := p.lexer.Next()
+				if eq.Type != TokenEq {
+					return nil, &ParseError{
+						Message: fmt.Sprintf("expected '=' after %s in SET, got %q", field.Name(), eq.Value),
+						Pos:     eq.Pos,
+						Length:  eq.Length,
+					}
+				}
+				val, err := p.parseMetaValue()
+				if err != nil {
+					return nil, err
+				}
+				m.SetMeta = append(m.SetMeta, MetaAssignment{Field: field, Value: val})
+				if p.lexer.Peek().Type != TokenComma {
+					break
+				}
+				p.lexer.Next() // consume ','
+			}
+		default:
+			return m, nil
+		}
+	}
+}
+
+// parseMutationRefs reads a comma-separated list of tag references.
+func (p *parser) parseMutationRefs(kw Token) ([]Node, error) {
+	var refs []Node
+	for {
+		ref, err := p.parseMutationRef(kw)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+		if p.lexer.Peek().Type != TokenComma {
+			return refs, nil
+		}
+		p.lexer.Next() // consume ','
+	}
+}
+
+// parseMutationRef = STRING | NUMBER — an entity name or ID.
+func (p *parser) parseMutationRef(kw Token) (Node, error) {
+	tok := p.lexer.Next()
+	switch tok.Type {
+	case TokenString:
+		return &StringLiteral{Token: tok, Value: tok.Value}, nil
+	case TokenNumber:
+		return parseNumberLiteral(tok)
+	default:
+		return nil, &ParseError{
+			Message: fmt.Sprintf("expected a quoted name or numeric ID after %s, got %q", strings.ToUpper(kw.Value), tok.Value),
+			Pos:     tok.Pos,
+			Length:  tok.Length,
+		}
+	}
+}
+
+// parseMetaValue = STRING | NUMBER | true | false | NULL. NULL yields a nil
+// node.
+func (p *parser) parseMetaValue() (Node, error) {
+	tok := p.lexer.Next()
+	switch {
+	case tok.Type == TokenString:
+		return &StringLiteral{Token: tok, Value: tok.Value}, nil
+	case tok.Type == TokenNumber:
+		return parseNumberLiteral(tok)
+	case tok.Type == TokenNull:
+		return nil, nil
+	case tok.Type == TokenIdentifier && (strings.EqualFold(tok.Value, "true") || strings.EqualFold(tok.Value, "false")):
+		return &BooleanLiteral{Token: tok, Value: strings.EqualFold(tok.Value, "true")}, nil
+	default:
+		return nil, &ParseError{
+			Message: fmt.Sprintf("expected a string, number, true, false, or NULL in SET, got %q", tok.Value),
+			Pos:     tok.Pos,
+			Length:  tok.Length,
+		}
+	}
+}
+
 // parseOrderBy = "ORDER BY" field ("ASC"|"DESC")? ("," field ("ASC"|"DESC")?)*
 func (p *parser) parseOrderBy() ([]OrderByClause, error) {
 	p.lexer.Next() // consume ORDER BY
@@ -839,10 +1352,130 @@ func (p *parser) parseOrderBy() ([]OrderByClause, error) {
 	return clauses, nil
 }
 
+// isSelectStart reports whether tok begins a SELECT clause. Like SET, SELECT
+// is not a lexer keyword: it is only recognized after the filter expression
+// and SCOPE, so fields and meta keys named "select" keep working.
+func isSelectStart(tok Token) bool {
+	return tok.Type == TokenIdentifier && strings.EqualFold(tok.Value, "SELECT")
+}
+
+// endsValue reports whether tok can end a filter expression, so that a SELECT
+// identifier after it starts the clause rather than naming a field.
+func endsValue(tok Token) bool {
+	switch tok.Type {
+	case TokenString, TokenNumber, TokenIdentifier, TokenEmpty, TokenNull, TokenRelDate, TokenFunc, TokenRParen, TokenParam:
+		return true
+	}
+	return false
+}
+
+// parseSelect = "SELECT" column ("," column)*
+// column      = arith ["AS" IDENT]
+func (p *parser) parseSelect() (*SelectClause, error) {
+	clause := &SelectClause{Token: p.lexer.Next()} // consume SELECT
+	for {
+		expr, err := p.parseArith()
+		if err != nil {
+			return nil, err
+		}
+		col := SelectColumn{Expr: expr}
+		if as := p.lexer.Peek(); as.Type == TokenIdentifier && strings.EqualFold(as.Value, "AS") {
+			p.lexer.Next() // consume AS
+			alias := p.lexer.Next()
+			if !isFieldNameToken(alias) {
+				return nil, &ParseError{
+					Message: fmt.Sprintf("expected a column name after AS, got %q", alias.Value),
+					Pos:     alias.Pos,
+					Length:  alias.Length,
+				}
+			}
+			col.Alias = alias.Value
+		}
+		clause.Columns = append(clause.Columns, col)
+
+		if p.lexer.Peek().Type != TokenComma {
+			return clause, nil
+		}
+		p.lexer.Next() // consume ','
+	}
+}
+
+// arith = term (("+" | "-") term)*
+func (p *parser) parseArith() (Node, error) {
+	left, err := p.parseArithTerm()
+	if err != nil {
+		return nil, err
+	}
+	for tt := p.lexer.Peek().Type; tt == TokenPlus || tt == TokenMinus; tt = p.lexer.Peek().Type {
+		opTok := p.lexer.Next()
+		right, err := p.parseArithTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = &ArithExpr{Left: left, Operator: opTok, Right: right}
+	}
+	return left, nil
+}
+
+// term = factor (("*" | "/") factor)*
+func (p *parser) parseArithTerm() (Node, error) {
+	left, err := p.parseArithFactor()
+	if err != nil {
+		return nil, err
+	}
+	for tt := p.lexer.Peek().Type; tt == TokenStar || tt == TokenSlash; tt = p.lexer.Peek().Type {
+		opTok := p.lexer.Next()
+		right, err := p.parseArithFactor()
+		if err != nil {
+			return nil, err
+		}
+		left = &ArithExpr{Left: left, Operator: opTok, Right: right}
+	}
+	return left, nil
+}
+
+// factor = NUMBER | scalarCall | field | "(" arith ")"
+func (p *parser) parseArithFactor() (Node, error) {
+	tok := p.lexer.Peek()
+	switch {
+	case tok.Type == TokenNumber:
+		p.lexer.Next()
+		return parseNumberLiteral(tok)
+	case tok.Type == TokenLParen:
+		lp := p.lexer.Next() // consume '('
+		if err := p.enterExpression(lp); err != nil {
+			return nil, err
+		}
+		expr, err := p.parseArith()
+		p.depth--
+		if err != nil {
+			return nil, err
+		}
+		if rp := p.lexer.Next(); rp.Type != TokenRParen {
+			return nil, &ParseError{
+				Message: fmt.Sprintf("expected ')' in SELECT column, got %q", rp.Value),
+				Pos:     rp.Pos,
+				Length:  rp.Length,
+			}
+		}
+		return expr, nil
+	case tok.Type == TokenScalarFunc:
+		return p.parseScalarCall()
+	case isFieldNameToken(tok):
+		return p.parseField()
+	}
+	return nil, &ParseError{
+		Message: fmt.Sprintf("expected a field, number, function or '(' in SELECT column, got %q", tok.Value),
+		Pos:     tok.Pos,
+		Length:  tok.Length,
+	}
+}
+
 // isAggregateToken returns true if the token is an aggregate function keyword.
 func isAggregateToken(tt TokenType) bool {
 	switch tt {
-	case TokenCount, TokenSum, TokenAvg, TokenMin, TokenMax:
+	case TokenCount, TokenSum, TokenAvg, TokenMin, TokenMax,
+		TokenMedian, TokenPercentile, TokenRunningSum, TokenRunningCount:
 		return true
 	}
 	return false
@@ -1002,7 +1635,10 @@ func (p *parser) parseHavingPrimary() (Node, error) {
 	return &HavingComparison{Agg: agg, Operator: opTok, Value: val}, nil
 }
 
-// parseAggregateFunc = ("COUNT" "(" ")" | ("SUM"|"AVG"|"MIN"|"MAX") "(" field ")")
+// parseAggregateFunc = ("COUNT" "(" ["DISTINCT" field] ")" | "RUNNING_COUNT" "(" ")"
+//
+//	| "PERCENTILE" "(" field "," number ")"
+//	| ("SUM"|"AVG"|"MIN"|"MAX"|"MEDIAN"|"RUNNING_SUM") "(" field ")")
 func (p *parser) parseAggregateFunc() (AggregateFunc, error) {
 	tok := p.lexer.Next() // consume aggregate keyword
 	name := strings.ToUpper(tok.Value)
@@ -1018,42 +1654,86 @@ func (p *parser) parseAggregateFunc() (AggregateFunc, error) {
 
 	agg := AggregateFunc{Token: tok, Name: name}
 
-	if name == "COUNT" {
+	// COUNT(DISTINCT field): DISTINCT is only a keyword in this position.
+	next := p.lexer.Peek()
+	if name == "COUNT" && next.Type == TokenIdentifier && strings.EqualFold(next.Value, "DISTINCT") {
+		p.lexer.Next() // consume DISTINCT
+		agg.Distinct = true
+	}
+
+	if (name == "COUNT" && !agg.Distinct) || name == "RUNNING_COUNT" {
 		rp := p.lexer.Next()
 		if rp.Type != TokenRParen {
+			message := fmt.Sprintf("%s() takes no arguments; expected ')', got %q", name, rp.Value)
+			if name == "COUNT" {
+				message = fmt.Sprintf("COUNT() takes no arguments (or DISTINCT field); expected ')', got %q", rp.Value)
+			}
 			return AggregateFunc{}, &ParseError{
-				Message: fmt.Sprintf("COUNT() takes no arguments; expected ')', got %q", rp.Value),
+				Message: message,
 				Pos:     rp.Pos,
 				Length:  rp.Length,
 			}
 		}
-	} else {
-		if p.lexer.Peek().Type == TokenRParen {
-			return AggregateFunc{}, &ParseError{
-				Message: fmt.Sprintf("%s() requires a field argument", name),
-				Pos:     p.lexer.Peek().Pos,
-				Length:  1,
-			}
+		return agg, nil
+	}
+
+	if p.lexer.Peek().Type == TokenRParen {
+		return AggregateFunc{}, &ParseError{
+			Message: fmt.Sprintf("%s() requires a field argument", name),
+			Pos:     p.lexer.Peek().Pos,
+			Length:  1,
 		}
-		field, err := p.parseField()
+	}
+	field, err := p.parseField()
+	if err != nil {
+		return AggregateFunc{}, err
+	}
+	agg.Field = field
+
+	if name == "PERCENTILE" {
+		fraction, err := p.parsePercentileFraction()
 		if err != nil {
 			return AggregateFunc{}, err
 		}
-		agg.Field = field
+		agg.Fraction = fraction
+	}
 
-		rp := p.lexer.Next()
-		if rp.Type != TokenRParen {
-			return AggregateFunc{}, &ParseError{
-				Message: fmt.Sprintf("expected ')' after %s field argument, got %q", name, rp.Value),
-				Pos:     rp.Pos,
-				Length:  rp.Length,
-			}
+	rp := p.lexer.Next()
+	if rp.Type != TokenRParen {
+		return AggregateFunc{}, &ParseError{
+			Message: fmt.Sprintf("expected ')' after %s field argument, got %q", name, rp.Value),
+			Pos:     rp.Pos,
+			Length:  rp.Length,
 		}
 	}
 
 	return agg, nil
 }
 
+// parsePercentileFraction parses the `, number` second argument of
+// PERCENTILE: a plain number between 0 and 1.
+func (p *parser) parsePercentileFraction() (float64, error) {
+	comma := p.lexer.Next()
+	if comma.Type != TokenComma {
+		return 0, &ParseError{
+			Message: fmt.Sprintf("PERCENTILE takes a field and a fraction, e.g. PERCENTILE(fileSize, 0.95); expected ',', got %q", comma.Value),
+			Pos:     comma.Pos,
+			Length:  comma.Length,
+		}
+	}
+	tok := p.lexer.Next()
+	if tok.Type == TokenNumber {
+		if nl, err := parseNumberLiteral(tok); err == nil && nl.Unit == "" && nl.Value >= 0 && nl.Value <= 1 {
+			return nl.Value, nil
+		}
+	}
+	return 0, &ParseError{
+		Message: fmt.Sprintf("PERCENTILE fraction must be a number between 0 and 1 (e.g. 0.95), got %q", tok.Value),
+		Pos:     tok.Pos,
+		Length:  tok.Length,
+	}
+}
+
 // parseNumberLiteral parses a TokenNumber into a NumberLiteral node.
 // It extracts the numeric value, optional unit, and computes the raw byte value.
 func parseNumberLiteral(tok Token) (*NumberLiteral, error) {
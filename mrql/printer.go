@@ -0,0 +1,507 @@
+package mrql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Print returns the canonical MRQL text of q. The WHERE expression comes
+// first, on one line, and each clause that follows it — SCOPE, AS OF, SELECT,
+// GROUP BY, HAVING, ORDER BY, LIMIT, OFFSET and the mutation clauses — starts
+// a new line. Parsing the result yields a query with the same shape fingerprint.
+//
+// Keywords are upper-cased, operators and commas are spaced, strings are
+// double-quoted with only `"` and `\` escaped, bare-word values are quoted,
+// `type = <entity>` is written bare and lower-cased, ASC is omitted, and
+// parentheses appear only where precedence needs them. Field names and meta
+// keys are written as they were parsed.
+//
+// Print only reads the AST, so it also prints nodes built or rewritten in
+// code; it does not validate them.
+func Print(q *Query) string {
+	var lines []string
+	if q.Where != nil {
+		lines = append(lines, PrintExpr(q.Where))
+	}
+	if q.Scope != nil {
+		lines = append(lines, "SCOPE "+printValue(q.Scope.Value))
+	}
+	if q.AsOf != nil {
+		lines = append(lines, "AS OF "+printValue(q.AsOf.Value))
+	}
+	if q.Select != nil {
+		cols := make([]string, len(q.Select.Columns))
+		for i, c := range q.Select.Columns {
+			cols[i] = printSelectExpr(c.Expr)
+			if c.Alias != "" {
+				cols[i] += " AS " + c.Alias
+			}
+		}
+		lines = append(lines, "SELECT "+strings.Join(cols, ", "))
+	}
+	if g := q.GroupBy; g != nil {
+		fields := make([]string, len(g.Fields))
+		for i, f := range g.Fields {
+			fields[i] = printField(f)
+		}
+		line := "GROUP BY " + strings.Join(fields, ", ")
+		for _, agg := range g.Aggregates {
+			line += " " + printAggregate(agg)
+		}
+		lines = append(lines, line)
+		if g.Having != nil {
+			lines = append(lines, "HAVING "+PrintExpr(g.Having))
+		}
+	}
+	if len(q.OrderBy) > 0 {
+		keys := make([]string, len(q.OrderBy))
+		for i, o := range q.OrderBy {
+			switch {
+			case o.Random:
+				keys[i] = "RANDOM()"
+			case o.Ascending:
+				keys[i] = printField(o.Field)
+			default:
+				keys[i] = printField(o.Field) + " DESC"
+			}
+		}
+		lines = append(lines, "ORDER BY "+strings.Join(keys, ", "))
+	}
+	if q.Limit >= 0 {
+		lines = append(lines, "LIMIT "+strconv.Itoa(q.Limit))
+	}
+	if q.Offset >= 0 {
+		lines = append(lines, "OFFSET "+strconv.Itoa(q.Offset))
+	}
+	if m := q.Mutation; m != nil {
+		if len(m.AddTags) > 0 {
+			lines = append(lines, "ADD TAGS "+printValues(m.AddTags))
+		}
+		if len(m.RemoveTags) > 0 {
+			lines = append(lines, "REMOVE TAGS "+printValues(m.RemoveTags))
+		}
+		if len(m.SetMeta) > 0 {
+			sets := make([]string, len(m.SetMeta))
+			for i, a := range m.SetMeta {
+				value := "NULL"
+				if a.Value != nil {
+					value = printValue(a.Value)
+				}
+				sets[i] = printField(a.Field) + " = " + value
+			}
+			lines = append(lines, "SET "+strings.Join(sets, ", "))
+		}
+		if m.MoveTo != nil {
+			lines = append(lines, "MOVE TO "+printValue(m.MoveTo))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// PrintExpr returns the canonical text of a filter or HAVING expression, as
+// Print writes it in a WHERE or HAVING clause.
+func PrintExpr(n Node) string {
+	var b strings.Builder
+	printExpr(&b, n, precOr)
+	return b.String()
+}
+
+// Expression precedence, loosest first. The parser folds AND and OR to the
+// left, so a right operand of equal precedence needs parentheses to keep its
+// shape, while a left one does not.
+const (
+	precOr = iota
+	precAnd
+	precNot
+)
+
+func exprPrec(n Node) int {
+	if b, ok := n.(*BinaryExpr); ok && !isBetween(b) && !isScalarIn(b) {
+		if b.Operator.Type == TokenOr {
+			return precOr
+		}
+		return precAnd
+	}
+	// NOT, BETWEEN and every predicate bind at least as tightly as an operand
+	// of NOT.
+	return precNot
+}
+
+// printExpr writes n, parenthesized when it binds more loosely than min.
+func printExpr(b *strings.Builder, n Node, min int) {
+	if exprPrec(n) < min {
+		b.WriteByte('(')
+		printExpr(b, n, precOr)
+		b.WriteByte(')')
+		return
+	}
+	switch n := n.(type) {
+	case *BinaryExpr:
+		if isBetween(n) {
+			printBetween(b, n, false)
+			return
+		}
+		if isScalarIn(n) {
+			printScalarIn(b, n, false)
+			return
+		}
+		prec := exprPrec(n)
+		op := " AND "
+		if prec == precOr {
+			op = " OR "
+		}
+		printExpr(b, n.Left, prec)
+		b.WriteString(op)
+		printExpr(b, n.Right, prec+1)
+	case *NotExpr:
+		if inner, ok := n.Expr.(*BinaryExpr); ok && isBetween(inner) {
+			printBetween(b, inner, true)
+			return
+		}
+		if inner, ok := n.Expr.(*BinaryExpr); ok && isScalarIn(inner) {
+			printScalarIn(b, inner, true)
+			return
+		}
+		b.WriteString("NOT ")
+		printExpr(b, n.Expr, precNot)
+	case *ComparisonExpr:
+		b.WriteString(printField(n.Field))
+		b.WriteString(" " + operatorText(n.Operator.Type) + " ")
+		if entity, ok := entityLiteral(n); ok {
+			b.WriteString(entity)
+		} else {
+			b.WriteString(printValue(n.Value))
+		}
+	case *ScalarComparisonExpr:
+		b.WriteString(printValue(n.Left))
+		b.WriteString(" " + operatorText(n.Operator.Type) + " ")
+		b.WriteString(printValue(n.Right))
+	case *InExpr:
+		b.WriteString(printField(n.Field))
+		if n.Negated {
+			b.WriteString(" NOT")
+		}
+		b.WriteString(" IN (" + printValues(n.Values) + ")")
+	case *SubqueryInExpr:
+		b.WriteString(printField(n.Field))
+		if n.Negated {
+			b.WriteString(" NOT")
+		}
+		b.WriteString(" IN (")
+		printExpr(b, n.Where, precOr)
+		b.WriteByte(')')
+	case *IsExpr:
+		b.WriteString(printField(n.Field) + " IS ")
+		if n.Negated {
+			b.WriteString("NOT ")
+		}
+		if n.IsNull {
+			b.WriteString("NULL")
+		} else {
+			b.WriteString("EMPTY")
+		}
+	case *TextSearchExpr:
+		value := ""
+		if n.Value != nil {
+			value = n.Value.Value
+		}
+		b.WriteString("TEXT ~ " + quoteString(value))
+	case *SimilarToExpr:
+		fmt.Fprintf(b, "SIMILAR TO resource(%d)", n.TargetID)
+		if n.Within >= 0 {
+			fmt.Fprintf(b, " WITHIN %d", n.Within)
+		}
+	case *HavingComparison:
+		b.WriteString(printAggregate(n.Agg))
+		b.WriteString(" " + operatorText(n.Operator.Type) + " ")
+		b.WriteString(printValue(n.Value))
+	default:
+		b.WriteString(printValue(n))
+	}
+}
+
+// printSelectExpr returns the text of a SELECT column expression. Operators
+// are spaced, since a '-' directly before a digit reads as a relative date,
+// and parentheses appear only where precedence needs them: + and - bind more
+// loosely than * and /, and both fold to the left.
+func printSelectExpr(n Node) string {
+	var b strings.Builder
+	printArith(&b, n, 0)
+	return b.String()
+}
+
+func arithPrec(n Node) int {
+	if a, ok := n.(*ArithExpr); ok {
+		if a.Operator.Type == TokenPlus || a.Operator.Type == TokenMinus {
+			return 0
+		}
+		return 1
+	}
+	return 2
+}
+
+func printArith(b *strings.Builder, n Node, min int) {
+	a, ok := n.(*ArithExpr)
+	if !ok {
+		b.WriteString(printValue(n))
+		return
+	}
+	prec := arithPrec(a)
+	if prec < min {
+		b.WriteByte('(')
+		defer b.WriteByte(')')
+	}
+	printArith(b, a.Left, prec)
+	b.WriteString(" " + arithOperatorText(a.Operator.Type) + " ")
+	printArith(b, a.Right, prec+1)
+}
+
+func arithOperatorText(tt TokenType) string {
+	switch tt {
+	case TokenPlus:
+		return "+"
+	case TokenMinus:
+		return "-"
+	case TokenStar:
+		return "*"
+	case TokenSlash:
+		return "/"
+	}
+	return "?"
+}
+
+// comparisonParts splits a field or scalar comparison into its printed left
+// side, operator and right side.
+func comparisonParts(n Node) (string, Token, Node, bool) {
+	switch c := n.(type) {
+	case *ComparisonExpr:
+		return printField(c.Field), c.Operator, c.Value, true
+	case *ScalarComparisonExpr:
+		return printValue(c.Left), c.Operator, c.Right, true
+	}
+	return "", Token{}, nil, false
+}
+
+// isBetween reports whether b is the desugared form of `field BETWEEN lo AND
+// hi`: parseBetween gives the AND and both comparison operators the BETWEEN
+// token's position, which a hand-written pair of comparisons cannot share.
+func isBetween(b *BinaryExpr) bool {
+	lowerLeft, lowerOp, _, ok := comparisonParts(b.Left)
+	if !ok || b.Operator.Type != TokenAnd || lowerOp.Type != TokenGte {
+		return false
+	}
+	upperLeft, upperOp, _, ok := comparisonParts(b.Right)
+	if !ok || upperOp.Type != TokenLte {
+		return false
+	}
+	return b.Operator.Pos == lowerOp.Pos && b.Operator.Pos == upperOp.Pos && lowerLeft == upperLeft
+}
+
+func printBetween(b *strings.Builder, n *BinaryExpr, negated bool) {
+	left, _, lo, _ := comparisonParts(n.Left)
+	_, _, hi, _ := comparisonParts(n.Right)
+	b.WriteString(left)
+	if negated {
+		b.WriteString(" NOT")
+	}
+	b.WriteString(" BETWEEN " + printValue(lo) + " AND " + printValue(hi))
+}
+
+// scalarInValues returns the values of the desugared form of `call IN (v1,
+// v2, ...)`: an OR chain of `call = v` comparisons whose operators all carry
+// the IN token's position, as only parseScalarIn produces them.
+func scalarInValues(n Node, pos int, left string) ([]Node, bool) {
+	switch n := n.(type) {
+	case *BinaryExpr:
+		if n.Operator.Type != TokenOr || n.Operator.Pos != pos {
+			return nil, false
+		}
+		values, ok := scalarInValues(n.Left, pos, left)
+		if !ok {
+			return nil, false
+		}
+		last, ok := scalarInValues(n.Right, pos, left)
+		return append(values, last...), ok
+	case *ScalarComparisonExpr:
+		if _, isCall := n.Left.(*ScalarCall); !isCall || n.Operator.Type != TokenEq || n.Operator.Pos != pos || printValue(n.Left) != left {
+			return nil, false
+		}
+		return []Node{n.Right}, true
+	}
+	return nil, false
+}
+
+// scalarInHead returns the first comparison of an OR chain.
+func scalarInHead(b *BinaryExpr) (*ScalarComparisonExpr, bool) {
+	var first Node = b
+	for inner, ok := first.(*BinaryExpr); ok; inner, ok = first.(*BinaryExpr) {
+		first = inner.Left
+	}
+	c, ok := first.(*ScalarComparisonExpr)
+	return c, ok
+}
+
+// isScalarIn reports whether b is a desugared `call IN (...)` list.
+func isScalarIn(b *BinaryExpr) bool {
+	c, ok := scalarInHead(b)
+	if !ok {
+		return false
+	}
+	_, ok = scalarInValues(b, c.Operator.Pos, printValue(c.Left))
+	return ok
+}
+
+func printScalarIn(b *strings.Builder, n *BinaryExpr, negated bool) {
+	c, _ := scalarInHead(n)
+	values, _ := scalarInValues(n, c.Operator.Pos, printValue(c.Left))
+	b.WriteString(printValue(c.Left))
+	if negated {
+		b.WriteString(" NOT")
+	}
+	b.WriteString(" IN (" + printValues(values) + ")")
+}
+
+// entityLiteral returns the bare, lower-cased entity name of a `type = x`
+// comparison.
+func entityLiteral(c *ComparisonExpr) (string, bool) {
+	if len(c.Field.Parts) != 1 || !strings.EqualFold(c.Field.Parts[0].Value, "type") {
+		return "", false
+	}
+	s, ok := c.Value.(*StringLiteral)
+	if !ok {
+		return "", false
+	}
+	name := strings.ToLower(s.Value)
+	if _, ok := ValidEntityTypes[name]; !ok {
+		return "", false
+	}
+	return name, true
+}
+
+// operatorText is the canonical spelling of each comparison operator.
+func operatorText(tt TokenType) string {
+	switch tt {
+	case TokenEq:
+		return "="
+	case TokenNeq:
+		return "!="
+	case TokenGt:
+		return ">"
+	case TokenGte:
+		return ">="
+	case TokenLt:
+		return "<"
+	case TokenLte:
+		return "<="
+	case TokenLike:
+		return "~"
+	case TokenNotLike:
+		return "!~"
+	case TokenRegex:
+		return "~*"
+	case TokenNotRegex:
+		return "!~*"
+	}
+	return "?"
+}
+
+func printField(f *FieldExpr) string {
+	if f == nil {
+		return ""
+	}
+	var b strings.Builder
+	for i, part := range f.Parts {
+		if i > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(part.Value)
+		if i == 0 && f.RelationType != nil {
+			b.WriteString("(" + quoteString(f.RelationType.Value) + ")")
+		}
+	}
+	return b.String()
+}
+
+func printAggregate(a AggregateFunc) string {
+	name := strings.ToUpper(a.Name)
+	switch {
+	case a.Field == nil:
+		return name + "()"
+	case a.Distinct:
+		return name + "(DISTINCT " + printField(a.Field) + ")"
+	case name == "PERCENTILE":
+		return name + "(" + printField(a.Field) + ", " + strconv.FormatFloat(a.Fraction, 'f', -1, 64) + ")"
+	}
+	return name + "(" + printField(a.Field) + ")"
+}
+
+func printValues(values []Node) string {
+	out := make([]string, len(values))
+	for i, v := range values {
+		out[i] = printValue(v)
+	}
+	return strings.Join(out, ", ")
+}
+
+func printValue(n Node) string {
+	switch v := n.(type) {
+	case *StringLiteral:
+		return quoteString(v.Value)
+	case *NumberLiteral:
+		return printNumber(v)
+	case *BooleanLiteral:
+		return strconv.FormatBool(v.Value)
+	case *RelDateLiteral:
+		return "-" + strconv.Itoa(v.Amount) + strings.ToLower(v.Unit)
+	case *FuncCall:
+		name := strings.ToUpper(v.Name)
+		if !strings.HasSuffix(name, "()") {
+			name += "()"
+		}
+		return name
+	case *ParamRef:
+		return "$" + v.Name
+	case *FieldExpr:
+		return printField(v)
+	case *ScalarCall:
+		return printScalarCall(v)
+	}
+	return ""
+}
+
+// printScalarCall writes a scalar call with an upper-case name: LOWER(name),
+// DATE_ADD(created, 3d).
+func printScalarCall(c *ScalarCall) string {
+	args := printField(c.Field)
+	if c.Offset != nil {
+		args += ", " + strconv.Itoa(c.Offset.Amount) + c.Offset.Unit
+	}
+	return c.Name + "(" + args + ")"
+}
+
+// printNumber writes a number without leading zeros, trailing fractional
+// zeros or an upper-case unit. The digits come from the source token when
+// there is one, so IDs too large for a float64 survive unchanged.
+func printNumber(n *NumberLiteral) string {
+	digits := n.Token.Value
+	if digits == "" {
+		return strconv.FormatFloat(n.Value, 'f', -1, 64) + n.Unit
+	}
+	digits = digits[:len(digits)-len(n.Unit)]
+	whole, frac, _ := strings.Cut(digits, ".")
+	whole = strings.TrimLeft(whole, "0")
+	if whole == "" {
+		whole = "0"
+	}
+	if frac = strings.TrimRight(frac, "0"); frac != "" {
+		whole += "." + frac
+	}
+	return whole + strings.ToLower(n.Unit)
+}
+
+// quoteString writes s as an MRQL string literal. The lexer only unescapes \"
+// and \\, so escaping exactly those two round-trips every value.
+func quoteString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
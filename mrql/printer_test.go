@@ -0,0 +1,90 @@
+package mrql
+
+import "testing"
+
+// Printing a validated query and validating the result again must give the
+// same fingerprint: Print changes layout, never shape.
+func TestPrintRoundTripFingerprint(t *testing.T) {
+	queries := []string{
+		`type = resource AND (tags = "a" OR tags = "b") AND NOT name ~ "tmp*"`,
+		`type = resource AND fileSize BETWEEN 1mb AND 10mb ORDER BY fileSize DESC LIMIT 5`,
+		`type = note AND created NOT BETWEEN -30d AND START_OF_MONTH()`,
+		`type = group AND parent.name = "Projects" AND children.count > 2`,
+		`type = resource AND owner.parent.name ~ "Arch*" AND meta.rating >= 4`,
+		`type = resource AND owner IN (type = group AND name ~ "x")`,
+		`type = note AND owner NOT IN (type = group AND category = 3)`,
+		`type = resource AND contentType IN ("image/png", "image/jpeg") AND description IS NOT EMPTY`,
+		`type = resource AND meta.source IS NULL AND TEXT ~ "sunset"`,
+		`type = resource AND SIMILAR TO resource(42) WITHIN 6`,
+		`type = group AND relations("depicts").name = "x" AND backRelations("parent of") IS NOT EMPTY`,
+		`type = resource GROUP BY contentType, created.month COUNT() AVG(fileSize) PERCENTILE(fileSize, 0.95) HAVING COUNT() > 3 AND NOT MAX(fileSize) < 1gb ORDER BY count DESC LIMIT 10 OFFSET 20`,
+		`type = resource SCOPE 12 ORDER BY RANDOM() LIMIT 3`,
+		`type = resource SCOPE 12 SELECT name, owner.parent, fileSize / 1mb AS mb, (width + 1) * (height - 1), width - (height - 1) - 2 ORDER BY mb DESC LIMIT 3`,
+		`type = resource AND name = $name AND created > $since`,
+		`type = resource AND (LOWER(name) IN ("a", "b") OR NOT EXT(name) IN ("c")) AND JSON_LENGTH(meta.x.y) > 2`,
+		`type = note AND DATE_ADD(created, -2w) NOT BETWEEN -30d AND DATE_ADD(updated, 1y) AND LENGTH(name) = $n`,
+		`type = resource SELECT YEAR(created) AS y, LENGTH(name) * 2 + JSON_LENGTH(meta.tags) ORDER BY y`,
+		`type = resource AND tags = "a" SCOPE 3 AS OF "2025-06-01" SELECT name ORDER BY name`,
+		`name = "Box" AS OF -30d`,
+		`type = note AS OF START_OF_MONTH() GROUP BY name COUNT()`,
+		`type = resource AND id = 1 OR name = "b" AND (id = 3 OR name = "d") OR id = 5`,
+		`type = note AND (id = 1 AND (name = "b" AND (id = 3 OR name = "d")))`,
+	}
+	for _, query := range queries {
+		t.Run(query, func(t *testing.T) {
+			q, err := Parse(query)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if err := Validate(q); err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			printed := Print(q)
+			again, err := Parse(printed)
+			if err != nil {
+				t.Fatalf("printed query %q does not parse: %v", printed, err)
+			}
+			if err := Validate(again); err != nil {
+				t.Fatalf("printed query %q does not validate: %v", printed, err)
+			}
+			if got, want := QueryShapeFingerprint(again, ScopeShapeNone), QueryShapeFingerprint(q, ScopeShapeNone); got != want {
+				t.Errorf("fingerprint changed:\n  in: %s\n out: %s", query, printed)
+			}
+			if Print(again) != printed {
+				t.Errorf("Print is not stable: %q then %q", printed, Print(again))
+			}
+		})
+	}
+}
+
+// Nodes built in code carry no source tokens; Print must still render them.
+func TestPrintBuiltQuery(t *testing.T) {
+	field := func(parts ...string) *FieldExpr {
+		f := &FieldExpr{}
+		for _, p := range parts {
+			f.Parts = append(f.Parts, Token{Type: TokenIdentifier, Value: p})
+		}
+		return f
+	}
+	q := &Query{
+		Where: &BinaryExpr{
+			Left:     &ComparisonExpr{Field: field("type"), Operator: Token{Type: TokenEq}, Value: &StringLiteral{Value: "resource"}},
+			Operator: Token{Type: TokenAnd},
+			Right: &BinaryExpr{
+				Left:     &ComparisonExpr{Field: field("meta", "rating"), Operator: Token{Type: TokenGt}, Value: &NumberLiteral{Value: 3.5}},
+				Operator: Token{Type: TokenOr},
+				Right:    &InExpr{Field: field("tags"), Values: []Node{&StringLiteral{Value: `say "hi"`}}},
+			},
+		},
+		OrderBy: []OrderByClause{{Field: field("created"), Ascending: false}},
+		Limit:   20,
+		Offset:  -1,
+	}
+	want := "type = resource AND (meta.rating > 3.5 OR tags IN (\"say \\\"hi\\\"\"))\nORDER BY created DESC\nLIMIT 20"
+	if got := Print(q); got != want {
+		t.Errorf("Print\n got: %q\nwant: %q", got, want)
+	}
+	if got := PrintExpr(&NotExpr{Expr: &FuncCall{Name: "now"}}); got != "NOT NOW()" {
+		t.Errorf("PrintExpr: got %q", got)
+	}
+}
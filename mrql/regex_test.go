@@ -26,15 +26,16 @@ func TestLexerRegexOperators(t *testing.T) {
 		}
 	}
 
-	// `~ *` — the space breaks the two-char operator: ~ stays TokenLike, * is illegal.
+	// `~ *` — the space breaks the two-char operator: ~ stays TokenLike, * is
+	// the SELECT multiplication operator.
 	l := NewLexer("~ *")
 	first := l.Next()
 	if first.Type != TokenLike {
 		t.Fatalf("`~ *`: expected first token TokenLike, got %v", first.Type)
 	}
 	second := l.Next()
-	if second.Type != TokenIllegal {
-		t.Fatalf("`~ *`: expected second token TokenIllegal, got %v", second.Type)
+	if second.Type != TokenStar {
+		t.Fatalf("`~ *`: expected second token TokenStar, got %v", second.Type)
 	}
 }
 
@@ -0,0 +1,377 @@
+package mrql
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// relatedRoot describes a traversal root that reaches rows outside the group
+// hierarchy: a resource's series and versions, a note's blocks, and a group's
+// typed relations.
+// A predicate on a related root is existential over the related rows:
+//
+//	<entity>.<outerCol> IN (SELECT <selectCol> FROM <from> WHERE <leaf match>)
+//
+// Negated predicates use the positive match under NOT IN, so an entity with
+// no related row at all satisfies them (the same semantics as children.X).
+type relatedRoot struct {
+	entityType EntityType // the only entity type the root is valid on
+	from       string     // FROM clause (with joins) the leaf columns resolve against
+	alias      string     // alias qualifying leaf columns
+	selectCol  string     // related column matched against outerCol
+	outerCol   string     // column on the queried entity's table
+	fields     []FieldDef // scalar leaf fields
+	groupLeaf  bool       // leaf rows are groups: tags is a valid leaf
+	meta       bool       // leaf rows carry a meta column: meta.<key> leaves apply
+	nameLeaf   string     // leaf a direct `root = "..."` compares; "" rejects direct comparison
+	typed      bool       // takes a relation type argument: relations("depicts")
+	groupable  bool       // valid as a bare GROUP BY key
+}
+
+// singleReference reports whether the root follows one nullable FK column
+// (series, currentVersion) rather than a set of rows.
+func (r relatedRoot) singleReference() bool {
+	return r.outerCol != "id"
+}
+
+// relationTypeColumn is the leaf column behind `type` on typed relation roots.
+const relationTypeColumn = "grt.name"
+
+// seriesLeafFields are the leaf fields of series.X.
+var seriesLeafFields = []FieldDef{
+	{Name: "id", Type: FieldNumber, Column: "id"},
+	{Name: "name", Type: FieldString, Column: "name"},
+	{Name: "slug", Type: FieldString, Column: "slug"},
+	{Name: "created", Type: FieldDateTime, Column: "created_at"},
+	{Name: "updated", Type: FieldDateTime, Column: "updated_at"},
+}
+
+// versionLeafFields are the leaf fields of versions.X and currentVersion.X.
+var versionLeafFields = []FieldDef{
+	{Name: "id", Type: FieldNumber, Column: "id"},
+	{Name: "number", Type: FieldNumber, Column: "version_number"},
+	{Name: "created", Type: FieldDateTime, Column: "created_at"},
+	{Name: "comment", Type: FieldString, Column: "comment"},
+	{Name: "contentType", Type: FieldString, Column: "content_type"},
+	{Name: "fileSize", Type: FieldNumber, Column: "file_size"},
+	{Name: "width", Type: FieldNumber, Column: "width"},
+	{Name: "height", Type: FieldNumber, Column: "height"},
+	{Name: "hash", Type: FieldString, Column: "hash"},
+}
+
+// relationLeafFields are the leaf fields of relations.X and backRelations.X:
+// the related group's scalar fields plus the relation type's name.
+var relationLeafFields = []FieldDef{
+	{Name: "id", Type: FieldNumber, Column: "id"},
+	{Name: "name", Type: FieldString, Column: "name"},
+	{Name: "description", Type: FieldString, Column: "description"},
+	{Name: "created", Type: FieldDateTime, Column: "created_at"},
+	{Name: "updated", Type: FieldDateTime, Column: "updated_at"},
+	{Name: "category", Type: FieldNumber, Column: "category_id"},
+	{Name: "url", Type: FieldString, Column: "url"},
+	{Name: "type", Type: FieldString, Column: relationTypeColumn},
+}
+
+// relationFrom builds the FROM clause for a relation root; joinCol is the
+// group_relations column naming the related group.
+func relationFrom(joinCol string) string {
+	return "group_relations gr JOIN groups rg ON rg.id = gr." + joinCol +
+		" LEFT JOIN group_relation_types grt ON grt.id = gr.relation_type_id"
+}
+
+// relatedRoots maps related traversal root names to their descriptors.
+var relatedRoots = map[string]relatedRoot{
+	"series": {
+		entityType: EntityResource, from: "series s", alias: "s",
+		selectCol: "s.id", outerCol: "series_id",
+		fields: seriesLeafFields, meta: true, nameLeaf: "name", groupable: true,
+	},
+	"versions": {
+		entityType: EntityResource, from: "resource_versions rv", alias: "rv",
+		selectCol: "rv.resource_id", outerCol: "id",
+		fields: versionLeafFields,
+	},
+	"currentVersion": {
+		entityType: EntityResource, from: "resource_versions rv", alias: "rv",
+		selectCol: "rv.id", outerCol: "current_version_id",
+		fields: versionLeafFields,
+	},
+	"relations": {
+		entityType: EntityGroup, from: relationFrom("to_group_id"), alias: "rg",
+		selectCol: "gr.from_group_id", outerCol: "id",
+		fields: relationLeafFields, groupLeaf: true, meta: true, nameLeaf: "name", typed: true,
+	},
+	"blocks": {
+		entityType: EntityNote, from: "note_blocks nb", alias: "nb",
+		selectCol: "nb.note_id", outerCol: "id",
+		fields: blockLeafFields, nameLeaf: "type",
+	},
+	"backRelations": {
+		entityType: EntityGroup, from: relationFrom("from_group_id"), alias: "rg",
+		selectCol: "gr.to_group_id", outerCol: "id",
+		fields: relationLeafFields, groupLeaf: true, meta: true, nameLeaf: "name", typed: true,
+	},
+}
+
+// leaf returns the FieldDef for a leaf field name on the root.
+func (r relatedRoot) leaf(name string) (FieldDef, bool) {
+	for _, fd := range r.fields {
+		if fd.Name == name {
+			return fd, true
+		}
+	}
+	if r.groupLeaf && name == "tags" {
+		return FieldDef{Name: "tags", Type: FieldRelation, Column: "tags"}, true
+	}
+	return FieldDef{}, false
+}
+
+// leafNames lists the valid leaf fields for error messages.
+func (r relatedRoot) leafNames() string {
+	names := make([]string, 0, len(r.fields)+2)
+	for _, fd := range r.fields {
+		names = append(names, fd.Name)
+	}
+	if r.groupLeaf {
+		names = append(names, "tags")
+	}
+	if r.meta {
+		names = append(names, "meta.<key>")
+	}
+	return strings.Join(names, ", ")
+}
+
+// isRelatedField reports whether f starts at a related root (on any entity).
+func isRelatedField(f *FieldExpr) bool {
+	_, ok := relatedRoots[f.Parts[0].Value]
+	return ok
+}
+
+// isRelatedLeafPath reports whether f walks from a related root to a leaf
+// (series.name, relations("depicts").type), as opposed to the bare root or
+// the root's .count pseudo-field.
+func isRelatedLeafPath(f *FieldExpr) bool {
+	if len(f.Parts) < 2 || !isRelatedField(f) {
+		return false
+	}
+	return !(len(f.Parts) == 2 && f.Parts[1].Value == "count")
+}
+
+// validateRelatedChain validates a multi-part field expression rooted at a
+// related root: root[("type")].leaf or root.meta.key[.key...].
+func validateRelatedChain(f *FieldExpr, entityType EntityType) error {
+	rootName := f.Parts[0].Value
+	root := relatedRoots[rootName]
+
+	if entityType == EntityUnspecified {
+		return &ValidationError{
+			Message: fmt.Sprintf("%s requires an explicit entity type (e.g. type = %q)", f.Name(), root.entityType.String()),
+			Pos:     f.Pos(),
+			Length:  len(f.Name()),
+		}
+	}
+	if entityType != root.entityType {
+		return &ValidationError{
+			Message: fmt.Sprintf("field %q: %s traversal is not valid for entity type %s", f.Name(), rootName, entityType),
+			Pos:     f.Pos(),
+			Length:  len(f.Name()),
+		}
+	}
+
+	if f.Parts[1].Value == "meta" && root.meta {
+		if len(f.Parts) < 3 {
+			return &ValidationError{
+				Message: fmt.Sprintf("%s.meta requires a key (e.g. %s.meta.mykey)", rootName, rootName),
+				Pos:     f.Pos(),
+				Length:  len(f.Name()),
+			}
+		}
+		return nil // meta segments validated by the translator
+	}
+
+	if len(f.Parts) != 2 {
+		return &ValidationError{
+			Message: fmt.Sprintf("%s does not support multi-level chains; use %s.<field>", f.Name(), rootName),
+			Pos:     f.Pos(),
+			Length:  len(f.Name()),
+		}
+	}
+
+	leaf := f.Parts[1].Value
+	if _, ok := root.leaf(leaf); !ok {
+		return &ValidationError{
+			Message: fmt.Sprintf("unknown field %q for %s; valid fields: %s", leaf, rootName, root.leafNames()),
+			Pos:     f.Parts[1].Pos,
+			Length:  len(leaf),
+		}
+	}
+	return nil
+}
+
+// relatedRootFor returns the related root f starts at when it is valid on the
+// translator's entity type.
+func (tc *translateContext) relatedRootFor(f *FieldExpr) (relatedRoot, bool) {
+	root, ok := relatedRoots[f.Parts[0].Value]
+	if !ok || root.entityType != tc.entityType {
+		return relatedRoot{}, false
+	}
+	return root, true
+}
+
+// relatedTypeFilter returns the relation type condition for a typed root, or
+// "" when relType is nil.
+func relatedTypeFilter(relType *StringLiteral) (string, []interface{}) {
+	if relType == nil {
+		return "", nil
+	}
+	return "LOWER(" + relationTypeColumn + ") = LOWER(?)", []interface{}{relType.Value}
+}
+
+// relatedCountExpr returns the correlated COUNT(*) subquery over a set-valued
+// related root, narrowed to relType when it is non-nil.
+func (tc *translateContext) relatedCountExpr(root relatedRoot, relType *StringLiteral) (string, []interface{}) {
+	where := fmt.Sprintf("%s = %s.id", root.selectCol, tc.tableName)
+	typeFilter, vals := relatedTypeFilter(relType)
+	if typeFilter != "" {
+		where += " AND " + typeFilter
+	}
+	return fmt.Sprintf("(SELECT COUNT(*) FROM %s WHERE %s)", root.from, where), vals
+}
+
+// relatedCountOrderExpr is relatedCountExpr for ORDER BY, whose expressions
+// carry no bind parameters: the relation type is inlined as a quoted literal.
+func (tc *translateContext) relatedCountOrderExpr(root relatedRoot, relType *StringLiteral) string {
+	lit := "'" + strings.ReplaceAll(relType.Value, "'", "''") + "'"
+	return fmt.Sprintf("(SELECT COUNT(*) FROM %s WHERE %s = %s.id AND LOWER(%s) = LOWER(%s))",
+		root.from, root.selectCol, tc.tableName, relationTypeColumn, lit)
+}
+
+// translateRelatedComparison handles comparisons on related roots: leaf paths
+// (series.name, versions.comment, relations("depicts").name,
+// backRelations.type) and direct comparisons (series = "Holiday",
+// relations("depicts") = "Alice"), which match the root's name leaf, or its id
+// for a numeric value.
+func (tc *translateContext) translateRelatedComparison(db *gorm.DB, root relatedRoot, expr *ComparisonExpr) (*gorm.DB, error) {
+	parts := expr.Field.Parts
+	isNegated := expr.Operator.Type == TokenNeq || expr.Operator.Type == TokenNotLike || expr.Operator.Type == TokenNotRegex
+	posOp := tc.flipOperator(expr.Operator)
+
+	var match string
+	var matchVals []interface{}
+	if len(parts) >= 3 && parts[1].Value == "meta" {
+		segments := make([]string, 0, len(parts)-2)
+		for i := 2; i < len(parts); i++ {
+			segments = append(segments, parts[i].Value)
+		}
+		if err := validateMetaSegments(segments); err != nil {
+			return nil, &TranslateError{Message: err.Error(), Pos: parts[2].Pos}
+		}
+		metaFd := FieldDef{Name: "meta." + strings.Join(segments, "."), Type: FieldMeta, Column: "meta." + strings.Join(segments, ".")}
+		val, err := tc.resolveValue(expr.Value, metaFd)
+		if err != nil {
+			return nil, err
+		}
+		isNumericVal := isNumericValue(val)
+		var jsonExpr, numericFilter string
+		if isNumericVal {
+			jsonExpr = tc.metaNumericExprOn(root.alias, segments)
+			numericFilter = tc.metaTypeFilterOn(root.alias, segments)
+		} else {
+			jsonExpr = tc.metaJsonExprOn(root.alias, segments)
+		}
+		clause, clauseVal := tc.buildMetaClause(jsonExpr, tc.metaJsonTextExprOn(root.alias, segments), posOp, val, isNumericVal)
+		if numericFilter != "" {
+			clause = numericFilter + " AND " + clause
+		}
+		match, matchVals = clause, []interface{}{clauseVal}
+	} else {
+		leafName := root.nameLeaf
+		if len(parts) == 2 {
+			leafName = parts[1].Value
+		} else if _, ok := expr.Value.(*NumberLiteral); ok {
+			leafName = "id"
+		}
+		leafFd, ok := root.leaf(leafName)
+		if !ok {
+			return nil, &TranslateError{Message: fmt.Sprintf("unknown field %q for %s", leafName, parts[0].Value), Pos: expr.Pos()}
+		}
+		val, err := tc.resolveValue(expr.Value, leafFd)
+		if err != nil {
+			return nil, err
+		}
+		if leafFd.Type == FieldRelation {
+			// tags leaf: the related group carries the (positively) matching tag.
+			var tagClause string
+			var tagVal interface{}
+			if posOp.Type == TokenLike {
+				tagClause = "LOWER(t.name) " + tc.likeOperator() + " LOWER(?) ESCAPE '\\'"
+				tagVal = convertMRQLWildcards(fmt.Sprint(val))
+			} else {
+				tagClause = "LOWER(t.name) = LOWER(?)"
+				tagVal = val
+			}
+			match = root.alias + ".id IN (SELECT gt.group_id FROM group_tags gt JOIN tags t ON t.id = gt.tag_id WHERE " + tagClause + ")"
+			matchVals = []interface{}{tagVal}
+		} else {
+			column := leafFd.Column
+			if !strings.Contains(column, ".") {
+				column = root.alias + "." + column
+			}
+			clause, clauseVal := tc.buildScalarClause(column, posOp, val, leafFd)
+			if column == blockTextColumn && posOp.Type == TokenLike {
+				if indexed, ok := tc.blockTextLikeClause(clauseVal.(string)); ok {
+					clause = indexed
+				}
+			}
+			match, matchVals = clause, []interface{}{clauseVal}
+		}
+	}
+
+	where := match
+	var vals []interface{}
+	if typeFilter, typeVals := relatedTypeFilter(expr.Field.RelationType); typeFilter != "" {
+		where = typeFilter + " AND " + where
+		vals = append(vals, typeVals...)
+	}
+	vals = append(vals, matchVals...)
+
+	outer := tc.tableName + "." + root.outerCol
+	inOp := "IN"
+	if isNegated {
+		// NULLs in the sub-select would make NOT IN match nothing.
+		where = root.selectCol + " IS NOT NULL AND " + where
+		inOp = "NOT IN"
+	}
+	sql := fmt.Sprintf("%s %s (SELECT %s FROM %s WHERE %s)", outer, inOp, root.selectCol, root.from, where)
+	if isNegated && root.singleReference() {
+		// Rows without the reference have no related record to match.
+		sql = "(" + sql + " OR " + outer + " IS NULL)"
+	}
+	return db.Where(sql, vals...), nil
+}
+
+// translateRelatedIsEmpty handles root IS [NOT] EMPTY / IS [NOT] NULL on a
+// related root: a NULL FK for series/currentVersion, no related rows (of the
+// given relation type, if any) for versions and relations.
+func (tc *translateContext) translateRelatedIsEmpty(db *gorm.DB, root relatedRoot, expr *IsExpr) (*gorm.DB, error) {
+	if root.singleReference() {
+		op := " IS NULL"
+		if expr.Negated {
+			op = " IS NOT NULL"
+		}
+		return db.Where(tc.tableName + "." + root.outerCol + op), nil
+	}
+
+	existsOp := "NOT EXISTS"
+	if expr.Negated {
+		existsOp = "EXISTS"
+	}
+	where := fmt.Sprintf("%s = %s.id", root.selectCol, tc.tableName)
+	typeFilter, vals := relatedTypeFilter(expr.Field.RelationType)
+	if typeFilter != "" {
+		where += " AND " + typeFilter
+	}
+	return db.Where(fmt.Sprintf("%s (SELECT 1 FROM %s WHERE %s)", existsOp, root.from, where), vals...), nil
+}
@@ -0,0 +1,107 @@
+//go:build postgres
+
+package mrql
+
+import (
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// Series, versions, and group relations against real Postgres: the same seed
+// and expectations as related_test.go, on Postgres column types.
+func setupRelatedPostgresTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := setupPostgresTestDB(t)
+	schema := []string{
+		`ALTER TABLE resources ADD COLUMN series_id BIGINT`,
+		`ALTER TABLE resources ADD COLUMN current_version_id BIGINT`,
+		`CREATE TABLE series (id BIGINT PRIMARY KEY, created_at TIMESTAMPTZ, updated_at TIMESTAMPTZ, name TEXT, slug TEXT, meta JSONB)`,
+		`CREATE TABLE resource_versions (id BIGINT PRIMARY KEY, created_at TIMESTAMPTZ, resource_id BIGINT NOT NULL, version_number INTEGER NOT NULL, hash TEXT, file_size BIGINT, content_type TEXT, width BIGINT, height BIGINT, comment TEXT)`,
+		`CREATE TABLE group_relation_types (id BIGINT PRIMARY KEY, name TEXT)`,
+		`CREATE TABLE group_relations (id BIGINT PRIMARY KEY, from_group_id BIGINT, to_group_id BIGINT, relation_type_id BIGINT, name TEXT, description TEXT)`,
+	}
+	for _, stmt := range append(schema, relatedSeedStatements...) {
+		if err := db.Exec(stmt).Error; err != nil {
+			t.Fatalf("seed %q: %v", stmt, err)
+		}
+	}
+	return db
+}
+
+func TestPG_RelatedResourceRoots(t *testing.T) {
+	db := setupRelatedPostgresTestDB(t)
+	cases := []struct {
+		query string
+		want  []uint
+	}{
+		{`series.name = "holiday"`, []uint{1, 2}},
+		{`series.meta.year = 2024`, []uint{1, 2}},
+		{`series = "Misc"`, []uint{3}},
+		{`series != "Holiday"`, []uint{3, 4}},
+		{`series IS NULL`, []uint{4}},
+		{`versions.count > 1`, []uint{1}},
+		{`versions.comment != "retouched"`, []uint{2, 3, 4}},
+		{`versions.fileSize > 2kb`, []uint{2}},
+		{`versions.created > -1d`, []uint{1, 2}},
+		{`currentVersion.comment = "original"`, []uint{2}},
+		{`currentVersion.contentType ~ "image/*"`, []uint{1, 2}},
+		{`currentVersion IS NULL`, []uint{3, 4}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.query, func(t *testing.T) {
+			got := pgResourceIDs(t, db, `type = resource AND `+tc.query)
+			if !eqIDs(got, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestPG_RelatedGroupRelations(t *testing.T) {
+	db := setupRelatedPostgresTestDB(t)
+	cases := []struct {
+		query string
+		want  []uint
+	}{
+		{`relations("DEPICTS").name = "Photos"`, []uint{3}},
+		{`relations.type = "parent of"`, []uint{1}},
+		{`relations("depicts") = 5`, []uint{3}},
+		{`relations.tags = "document"`, []uint{1}},
+		{`relations.name != "Photos"`, []uint{2, 4, 5}},
+		{`backRelations.meta.region = "europe"`, []uint{2, 5}},
+		{`relations("parent of") IS NOT EMPTY`, []uint{1}},
+		{`relations.count = 2`, []uint{1}},
+		{`backRelations("depicts").count >= 1`, []uint{2, 5}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.query, func(t *testing.T) {
+			got := pgGroupIDs(t, db, `type = group AND `+tc.query)
+			if !eqIDs(got, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestPG_RelatedCountOrders(t *testing.T) {
+	db := setupRelatedPostgresTestDB(t)
+
+	result := parseAndTranslate(t, `type = resource ORDER BY versions.count DESC, id LIMIT 2`, EntityResource, db)
+	var resources []testResource
+	if err := result.Find(&resources).Error; err != nil {
+		t.Fatalf("query error: %v", err)
+	}
+	if len(resources) != 2 || resources[0].ID != 1 || resources[1].ID != 2 {
+		t.Fatalf("expected resources [1 2] by version count, got %v", resources)
+	}
+
+	result = parseAndTranslate(t, `type = group ORDER BY relations("parent of").count DESC, id LIMIT 2`, EntityGroup, db)
+	var groups []testGroup
+	if err := result.Find(&groups).Error; err != nil {
+		t.Fatalf("query error: %v", err)
+	}
+	if len(groups) != 2 || groups[0].ID != 1 || groups[1].ID != 2 {
+		t.Fatalf("expected groups [1 2] by parent-of relation count, got %v", groups)
+	}
+}
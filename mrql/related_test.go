@@ -0,0 +1,296 @@
+package mrql
+
+import (
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// Series, versions, and group relations.
+//
+// Seed (on top of setupTestDB):
+//
+//	Series: Holiday(1) {"year":2024}, Misc(2)
+//	Resources: r1, r2 in Holiday; r3 in Misc; r4 in no series.
+//	Versions: r1 v1 "original", v2 "retouched" (current); r2 v1 "original"
+//	          (current); r3, r4 none.
+//	Relation types: depicts(1), parent of(2)
+//	Relations: Vacation(1) -depicts-> Work(2), Vacation(1) -parent of->
+//	           Photos(5), Archive(3) -depicts-> Photos(5)
+func setupRelatedTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := setupTestDB(t)
+	schema := []string{
+		`ALTER TABLE resources ADD COLUMN series_id INTEGER`,
+		`ALTER TABLE resources ADD COLUMN current_version_id INTEGER`,
+		`CREATE TABLE series (id INTEGER PRIMARY KEY, created_at DATETIME, updated_at DATETIME, name TEXT, slug TEXT, meta JSON)`,
+		`CREATE TABLE resource_versions (id INTEGER PRIMARY KEY, created_at DATETIME, resource_id INTEGER NOT NULL, version_number INTEGER NOT NULL, hash TEXT, file_size INTEGER, content_type TEXT, width INTEGER, height INTEGER, comment TEXT)`,
+		`CREATE TABLE group_relation_types (id INTEGER PRIMARY KEY, name TEXT)`,
+		`CREATE TABLE group_relations (id INTEGER PRIMARY KEY, from_group_id INTEGER, to_group_id INTEGER, relation_type_id INTEGER, name TEXT, description TEXT)`,
+	}
+	for _, stmt := range append(schema, relatedSeedStatements...) {
+		if err := db.Exec(stmt).Error; err != nil {
+			t.Fatalf("seed %q: %v", stmt, err)
+		}
+	}
+	return db
+}
+
+// relatedSeedStatements fill the series, version and relation tables; they
+// run unchanged on SQLite and Postgres.
+var relatedSeedStatements = []string{
+	`INSERT INTO series (id, created_at, updated_at, name, slug, meta) VALUES (1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 'Holiday', 'holiday', '{"year":2024}'), (2, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 'Misc', 'misc', '{}')`,
+	`UPDATE resources SET series_id = 1 WHERE id IN (1, 2)`,
+	`UPDATE resources SET series_id = 2 WHERE id = 3`,
+	`INSERT INTO resource_versions (id, created_at, resource_id, version_number, hash, file_size, content_type, width, height, comment) VALUES
+		(1, CURRENT_TIMESTAMP, 1, 1, 'h1', 1000, 'image/jpeg', 1920, 1080, 'original'),
+		(2, CURRENT_TIMESTAMP, 1, 2, 'h2', 2000, 'image/jpeg', 1920, 1080, 'retouched'),
+		(3, CURRENT_TIMESTAMP, 2, 1, 'h3', 3000, 'image/png', 800, 600, 'original')`,
+	`UPDATE resources SET current_version_id = 2 WHERE id = 1`,
+	`UPDATE resources SET current_version_id = 3 WHERE id = 2`,
+	`INSERT INTO group_relation_types (id, name) VALUES (1, 'depicts'), (2, 'parent of')`,
+	`INSERT INTO group_relations (id, from_group_id, to_group_id, relation_type_id) VALUES (1, 1, 2, 1), (2, 1, 5, 2), (3, 3, 5, 1)`,
+}
+
+func TestRelatedResourceRoots(t *testing.T) {
+	db := setupRelatedTestDB(t)
+	cases := []struct {
+		query string
+		want  []uint
+	}{
+		{`series.name = "holiday"`, []uint{1, 2}},
+		{`series.slug ~ "mi*"`, []uint{3}},
+		{`series.meta.year = 2024`, []uint{1, 2}},
+		{`series = "Misc"`, []uint{3}},
+		{`series = 2`, []uint{3}},
+		{`series != "Holiday"`, []uint{3, 4}},
+		{`series.name != "Holiday"`, []uint{3, 4}},
+		{`series IS NULL`, []uint{4}},
+		{`series IS NOT EMPTY`, []uint{1, 2, 3}},
+		{`versions.count = 0`, []uint{3, 4}},
+		{`versions.count > 1`, []uint{1}},
+		{`versions.comment = "original"`, []uint{1, 2}},
+		{`versions.comment != "retouched"`, []uint{2, 3, 4}},
+		{`versions.number >= 2`, []uint{1}},
+		{`versions.fileSize > 2kb`, []uint{2}},
+		{`versions.created > -1d`, []uint{1, 2}},
+		{`versions IS EMPTY`, []uint{3, 4}},
+		{`currentVersion.comment = "original"`, []uint{2}},
+		{`currentVersion.comment != "original"`, []uint{1, 3, 4}},
+		{`currentVersion.contentType ~ "image/*"`, []uint{1, 2}},
+		{`currentVersion IS NULL`, []uint{3, 4}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.query, func(t *testing.T) {
+			got := runResourceIDs(t, db, `type = resource AND `+tc.query)
+			if !eqIDs(got, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestRelatedGroupRelations(t *testing.T) {
+	db := setupRelatedTestDB(t)
+	cases := []struct {
+		query string
+		want  []uint
+	}{
+		{`relations("depicts").name = "Work"`, []uint{1}},
+		{`relations("DEPICTS").name = "Photos"`, []uint{3}},
+		{`relations("parent of").name = "Work"`, []uint{}},
+		{`relations.name = "Photos"`, []uint{1, 3}},
+		{`relations.type = "parent of"`, []uint{1}},
+		{`relations = "Work"`, []uint{1}},
+		{`relations("depicts") = 5`, []uint{3}},
+		{`relations.tags = "document"`, []uint{1}},
+		{`relations.name != "Photos"`, []uint{2, 4, 5}},
+		{`backRelations.type = "parent of"`, []uint{5}},
+		{`backRelations("depicts").name = "Archive"`, []uint{5}},
+		{`backRelations.meta.region = "europe"`, []uint{2, 5}},
+		{`relations IS EMPTY`, []uint{2, 4, 5}},
+		{`relations("parent of") IS NOT EMPTY`, []uint{1}},
+		{`backRelations("depicts") IS EMPTY`, []uint{1, 3, 4}},
+		{`relations.count = 2`, []uint{1}},
+		{`backRelations("depicts").count >= 1`, []uint{2, 5}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.query, func(t *testing.T) {
+			got := runGroupIDs(t, db, `type = group AND `+tc.query)
+			if !eqIDs(got, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestRelatedCountOrdersAndSeriesGroups(t *testing.T) {
+	db := setupRelatedTestDB(t)
+
+	result := parseAndTranslate(t, `type = resource ORDER BY versions.count DESC, id LIMIT 2`, EntityResource, db)
+	var rows []testResource
+	if err := result.Find(&rows).Error; err != nil {
+		t.Fatalf("query error: %v", err)
+	}
+	if len(rows) != 2 || rows[0].ID != 1 || rows[1].ID != 2 {
+		t.Fatalf("expected resources [1 2] by version count, got %v", rows)
+	}
+
+	// A typed count orders by that relation type only; untyped, Archive (3)
+	// would come second.
+	result = parseAndTranslate(t, `type = group ORDER BY relations("parent of").count DESC, id LIMIT 2`, EntityGroup, db)
+	var groups []testGroup
+	if err := result.Find(&groups).Error; err != nil {
+		t.Fatalf("query error: %v", err)
+	}
+	if len(groups) != 2 || groups[0].ID != 1 || groups[1].ID != 2 {
+		t.Fatalf("expected groups [1 2] by parent-of relation count, got %v", groups)
+	}
+
+	q := mustParse(t, `type = resource GROUP BY series COUNT() ORDER BY count DESC`)
+	q.EntityType = EntityResource
+	if err := Validate(q); err != nil {
+		t.Fatalf("validation error: %v", err)
+	}
+	grouped, err := TranslateGroupBy(q, db, TranslateOptions{})
+	if err != nil {
+		t.Fatalf("translate error: %v", err)
+	}
+	if len(grouped.Rows) != 3 {
+		t.Fatalf("expected Holiday, Misc, and no-series buckets, got %v", grouped.Rows)
+	}
+	if deref(grouped.Rows[0]["series"]) != "Holiday" || toInt(t, grouped.Rows[0]["count"]) != 2 {
+		t.Errorf("expected Holiday with 2 resources first, got %v", grouped.Rows[0])
+	}
+}
+
+// A related root valid on another entity type matches nothing in that
+// entity's branch of a cross-entity query instead of failing it.
+func TestRelatedRootsInCrossEntityBranches(t *testing.T) {
+	db := setupRelatedTestDB(t)
+	q := mustParse(t, `(type = resource AND series.name = "Misc") OR (type = group AND relations.type = "depicts")`)
+	if err := Validate(q); err != nil {
+		t.Fatalf("validation error: %v", err)
+	}
+	got := unionRows(t, db, `(type = resource AND series.name = "Misc") OR (type = group AND relations.type = "depicts")`, TranslateOptions{})
+	want := map[string]bool{"resource:3": true, "group:1": true, "group:3": true}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for _, row := range got {
+		if !want[row] {
+			t.Errorf("unexpected row %s in %v", row, got)
+		}
+	}
+}
+
+func TestRelatedValidation(t *testing.T) {
+	valid := []struct {
+		query      string
+		entityType EntityType
+	}{
+		{`type = resource AND series.created > -30d`, EntityResource},
+		{`type = resource AND versions.count >= 1 ORDER BY versions.count DESC`, EntityResource},
+		{`type = resource AND currentVersion.width BETWEEN 100 AND 2000`, EntityResource},
+		{`type = group AND relations("depicts").tags = "person"`, EntityGroup},
+		{`type = group AND backRelations("depicts").count > 2`, EntityGroup},
+		{`type = group ORDER BY relations("depicts").count DESC`, EntityGroup},
+		{`type = resource GROUP BY series`, EntityResource},
+	}
+	for _, tc := range valid {
+		t.Run("valid/"+tc.query, func(t *testing.T) {
+			if err := parseAndValidate(t, tc.query, tc.entityType); err != nil {
+				t.Fatalf("expected valid, got: %v", err)
+			}
+		})
+	}
+
+	invalid := []struct {
+		query      string
+		entityType EntityType
+		wantSubstr string
+	}{
+		{`series.name = "x"`, EntityUnspecified, `requires an explicit entity type (e.g. type = "resource")`},
+		{`type = note AND series.name = "x"`, EntityNote, "series traversal is not valid for entity type note"},
+		{`type = resource AND relations.name = "x"`, EntityResource, "relations traversal is not valid for entity type resource"},
+		{`type = resource AND versions.name = "x"`, EntityResource, `unknown field "name" for versions`},
+		{`type = resource AND series.meta = "x"`, EntityResource, "series.meta requires a key"},
+		{`type = resource AND series.name.x = "x"`, EntityResource, "does not support multi-level chains"},
+		{`type = resource AND versions = "x"`, EntityResource, "versions cannot be compared directly"},
+		{`type = resource AND series.count > 1`, EntityResource, "single reference and cannot be counted"},
+		{`type = resource AND versions.comment IN ("a")`, EntityResource, "does not support IN"},
+		{`type = resource AND series IN ("a")`, EntityResource, "does not support IN"},
+		{`type = resource AND versions.comment IS NULL`, EntityResource, "use versions IS EMPTY"},
+		{`type = resource AND versions IS NULL`, EntityResource, `use "versions IS EMPTY"`},
+		{`type = resource ORDER BY series.name`, EntityResource, "not sortable"},
+		{`type = resource GROUP BY versions`, EntityResource, "cannot GROUP BY versions"},
+		{`type = group GROUP BY relations.type COUNT()`, EntityGroup, "cannot GROUP BY relations.type"},
+		{`type = resource AND versions.fileSize ~* "1"`, EntityResource, "does not support regex match"},
+	}
+	for _, tc := range invalid {
+		t.Run("invalid/"+tc.query, func(t *testing.T) {
+			err := parseAndValidate(t, tc.query, tc.entityType)
+			if err == nil {
+				t.Fatalf("expected validation error for %q, got nil", tc.query)
+			}
+			if !strings.Contains(err.Error(), tc.wantSubstr) {
+				t.Errorf("error mismatch:\nwant substring: %s\ngot: %v", tc.wantSubstr, err)
+			}
+		})
+	}
+}
+
+func TestParseTypedRelationRoot(t *testing.T) {
+	q := mustParse(t, `type = group AND relations("depicts").name = "Alice"`)
+	cmp := q.Where.(*BinaryExpr).Right.(*ComparisonExpr)
+	if cmp.Field.RelationType == nil || cmp.Field.RelationType.Value != "depicts" {
+		t.Fatalf("expected relation type depicts, got %+v", cmp.Field.RelationType)
+	}
+	if got := cmp.Field.Name(); got != `relations("depicts").name` {
+		t.Errorf("expected field name relations(\"depicts\").name, got %s", got)
+	}
+
+	for _, input := range []string{`relations(42).name = "x"`, `relations("a".name = "x"`} {
+		if _, err := Parse(input); err == nil {
+			t.Errorf("expected parse error for %q", input)
+		}
+	}
+	// Other fields take no argument.
+	if _, err := Parse(`tags("a") = "x"`); err == nil {
+		t.Errorf("expected parse error for an argument on a non-relation field")
+	}
+}
+
+func TestCompleteRelatedRoots(t *testing.T) {
+	cases := []struct {
+		query string
+		want  []string
+		not   []string
+	}{
+		{`type = resource AND series.`, []string{"name", "slug", "meta."}, []string{"count", "tags"}},
+		{`type = resource AND versions.`, []string{"comment", "number", "count"}, []string{"tags"}},
+		{`type = resource AND currentVersion.`, []string{"created", "comment"}, []string{"count"}},
+		{`type = group AND relations("depicts").`, []string{"type", "name", "tags", "count"}, nil},
+		{`type = group AND backRelations.`, []string{"type", "name"}, nil},
+		{`type = group AND relations(`, []string{`"relation type"`}, []string{"name"}},
+		{`type = group AND `, []string{"relations", `relations("`, "relations.count", "backRelations.count"}, nil},
+		{`type = resource AND `, []string{"series", "versions", "currentVersion", "versions.count"}, []string{"series.count"}},
+		{`type = resource GROUP BY `, []string{"series"}, []string{"versions", "currentVersion"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.query, func(t *testing.T) {
+			sugg := Complete(tc.query, len(tc.query))
+			for _, want := range tc.want {
+				if !hasSuggestion(sugg, want) {
+					t.Errorf("expected suggestion %q, got %v", want, sugg)
+				}
+			}
+			for _, not := range tc.not {
+				if hasSuggestion(sugg, not) {
+					t.Errorf("did not expect suggestion %q", not)
+				}
+			}
+		})
+	}
+}
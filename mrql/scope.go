@@ -166,3 +166,13 @@ func ApplyScopeCTE(db *gorm.DB, entityType EntityType, scopeGroupID uint) *gorm.
 	}
 	return db.Where(fmt.Sprintf("owner_id IN (%s)", scopeCTE), scopeGroupID)
 }
+
+// applyScopeCTEOn is ApplyScopeCTE with the column qualified by table, for a
+// query that joins other tables carrying the same columns (SELECT projections
+// join groups, which has its own id and owner_id).
+func applyScopeCTEOn(db *gorm.DB, entityType EntityType, table string, scopeGroupID uint) *gorm.DB {
+	if entityType == EntityGroup {
+		return db.Where(fmt.Sprintf("%s.id IN (%s)", table, scopeCTE), scopeGroupID)
+	}
+	return db.Where(fmt.Sprintf("%s.owner_id IN (%s)", table, scopeCTE), scopeGroupID)
+}
@@ -7,9 +7,9 @@ import (
 
 // InsertScopeClause returns query with a `SCOPE <groupID>` clause spliced in at
 // the grammatically correct position: after any WHERE expression and before the
-// first of GROUP BY / ORDER BY / LIMIT / OFFSET / HAVING (the clause order the
-// parser enforces). It is used to build a "view all" link that reproduces a
-// shortcode's scoped result set.
+// first of AS OF / SELECT / GROUP BY / ORDER BY / LIMIT / OFFSET / HAVING (the
+// clause order the parser enforces). It is used to build a "view all" link that
+// reproduces a shortcode's scoped result set.
 //
 // A naive append (query + " SCOPE <id>") is invalid for any query carrying one
 // of those trailing clauses, since SCOPE may not follow them. This lexes the
@@ -20,8 +20,14 @@ import (
 func InsertScopeClause(query string, groupID uint) string {
 	clause := "SCOPE " + strconv.FormatUint(uint64(groupID), 10)
 	lex := NewLexer(query)
+	var prev Token
 	for {
 		tok := lex.Next()
+		if (isAsOfStart(tok) || isSelectStart(tok)) && endsValue(prev) {
+			head := strings.TrimRight(query[:tok.Pos], " \t\r\n")
+			return head + " " + clause + " " + query[tok.Pos:]
+		}
+		prev = tok
 		switch tok.Type {
 		case TokenScope:
 			// Already scoped — do not add a second SCOPE clause.
@@ -15,6 +15,9 @@ func TestInsertScopeClause(t *testing.T) {
 		{"before ORDER BY", `type = "resource" ORDER BY name`, `type = "resource" SCOPE 5 ORDER BY name`},
 		{"before LIMIT and OFFSET", `type = "resource" LIMIT 10 OFFSET 5`, `type = "resource" SCOPE 5 LIMIT 10 OFFSET 5`},
 		{"before GROUP BY", `type = "resource" GROUP BY contentType COUNT()`, `type = "resource" SCOPE 5 GROUP BY contentType COUNT()`},
+		{"before SELECT", `type = resource SELECT name, fileSize / 1024 AS kb LIMIT 5`, `type = resource SCOPE 5 SELECT name, fileSize / 1024 AS kb LIMIT 5`},
+		{"before AS OF", `type = resource AS OF -30d SELECT name`, `type = resource SCOPE 5 AS OF -30d SELECT name`},
+		{"field named select is not a clause", `meta.select = 1`, `meta.select = 1 SCOPE 5`},
 		{"where then order/limit", `name ~ "x" ORDER BY name DESC LIMIT 20`, `name ~ "x" SCOPE 5 ORDER BY name DESC LIMIT 20`},
 		{"trailing whitespace", `type = "resource"   `, `type = "resource" SCOPE 5`},
 		{"keyword-like string literal not confused", `name = "my LIMIT test"`, `name = "my LIMIT test" SCOPE 5`},
@@ -0,0 +1,23 @@
+//go:build postgres
+
+package mrql
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestPG_SelectExecution runs the SQLite SELECT expectations against
+// Postgres: floating-point division, numeric meta and the reference joins
+// must agree across dialects.
+func TestPG_SelectExecution(t *testing.T) {
+	db := setupRelatedPostgresTestDB(t)
+	for _, tc := range selectCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, got := runSelectCase(t, db, tc.query)
+			if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Errorf("rows\n got: %v\nwant: %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,257 @@
+package mrql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// selectCases are the SELECT expectations over setupRelatedTestDB, shared with
+// the Postgres run. Each row is its cells in SELECT order, with numbers
+// normalized (see selectCell) and NULL written as "NULL".
+var selectCases = []struct {
+	name  string
+	query string
+	want  [][]string
+}{
+	{"arithmetic with a size unit, ordered by alias",
+		`type = resource SELECT name, fileSize / 1mb AS mb ORDER BY mb DESC LIMIT 2`,
+		[][]string{{"photo_album.png", "1.953125"}, {"sunset.jpg", "0.9765625"}}},
+	{"product and relation count",
+		`type = resource SELECT name, width * height AS pixels, tags.count`,
+		[][]string{{"sunset.jpg", "2073600", "1"}, {"photo_album.png", "480000", "2"}, {"report.pdf", "0", "0"}, {"untagged_file.txt", "0", "0"}}},
+	{"precedence and parentheses",
+		`type = resource AND id <= 2 SELECT id, id + 2 * 3 AS a, (id + 2) * 3 AS b, 10 - id - 1 AS c`,
+		[][]string{{"1", "7", "9", "8"}, {"2", "8", "12", "7"}}},
+	{"meta arithmetic and division by zero",
+		`type = resource SELECT meta.rating, meta.rating + 1 AS next, width / 0 AS none`,
+		[][]string{{"5", "6", "NULL"}, {"3", "4", "NULL"}, {"NULL", "NULL", "NULL"}, {"NULL", "NULL", "NULL"}}},
+	{"non-numeric meta is null in arithmetic",
+		`type = note SELECT name, meta.priority, meta.priority * 2 AS p, meta.count * 2 AS c`,
+		[][]string{{"Meeting notes", "high", "NULL", "NULL"}, {"Todo list", "low", "NULL", "14"}}},
+	{"single references keep entities without one",
+		`type = resource SELECT series, series.name, currentVersion.number, currentVersion.fileSize * 2 AS double`,
+		[][]string{{"Holiday", "Holiday", "2", "4000"}, {"Holiday", "Holiday", "1", "6000"}, {"Misc", "Misc", "NULL", "NULL"}, {"NULL", "NULL", "NULL", "NULL"}}},
+	{"owner chain",
+		`type = resource SELECT name, owner, owner.parent`,
+		[][]string{{"sunset.jpg", "Vacation", "NULL"}, {"photo_album.png", "NULL", "NULL"}, {"report.pdf", "Work", "Vacation"}, {"untagged_file.txt", "NULL", "NULL"}}},
+	{"group parent chain",
+		`type = group SELECT name, parent, parent.parent.name, children.count ORDER BY name`,
+		[][]string{{"Archive", "NULL", "NULL", "0"}, {"Photos", "Vacation", "NULL", "0"}, {"Sub-Work", "Work", "Vacation", "0"}, {"Vacation", "NULL", "NULL", "2"}, {"Work", "Vacation", "NULL", "1"}}},
+	{"parent meta",
+		`type = group AND parent IS NOT NULL SELECT name, parent.meta.priority * 10 AS p ORDER BY name`,
+		[][]string{{"Photos", "30"}, {"Sub-Work", "NULL"}, {"Work", "30"}}},
+	{"offset pages with the id tiebreaker",
+		`type = resource SELECT tags.count AS n ORDER BY n DESC LIMIT 2 OFFSET 1`,
+		[][]string{{"1"}, {"0"}}},
+}
+
+// runSelectCase runs query through BuildProjection and returns its column
+// names and cells in SELECT order.
+func runSelectCase(t *testing.T, db *gorm.DB, query string) ([]string, [][]string) {
+	t.Helper()
+	q, err := Parse(query)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	if err := Validate(q); err != nil {
+		t.Fatalf("validation error: %v", err)
+	}
+	built, err := BuildProjection(q, db, TranslateOptions{})
+	if err != nil {
+		t.Fatalf("translate error: %v", err)
+	}
+	var rows []map[string]any
+	if err := built.Find(&rows).Error; err != nil {
+		t.Fatalf("query error: %v", err)
+	}
+	cols := AggregatedColumns(q)
+	got := make([][]string, len(rows))
+	for i, row := range rows {
+		for _, col := range cols {
+			v, ok := row[col]
+			if !ok {
+				t.Fatalf("row %d has no column %q: %v", i, col, row)
+			}
+			got[i] = append(got[i], selectCell(v))
+		}
+	}
+	return cols, got
+}
+
+// selectCell normalizes a scanned value across SQLite and Postgres scan types.
+func selectCell(v any) string {
+	switch n := deref(v).(type) {
+	case nil:
+		return "NULL"
+	case []byte:
+		return selectCell(string(n))
+	case int64:
+		return strconv.FormatInt(n, 10)
+	case float64:
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	case string:
+		if f, err := strconv.ParseFloat(n, 64); err == nil {
+			return strconv.FormatFloat(f, 'f', -1, 64)
+		}
+		return n
+	default:
+		return fmt.Sprint(n)
+	}
+}
+
+func TestSelectExecution(t *testing.T) {
+	db := setupRelatedTestDB(t)
+	for _, tc := range selectCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, got := runSelectCase(t, db, tc.query)
+			if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Errorf("rows\n got: %v\nwant: %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSelectColumnNames(t *testing.T) {
+	db := setupRelatedTestDB(t)
+	cols, _ := runSelectCase(t, db, `type = resource SELECT name, fileSize / 1mb, width*height AS px, owner.name, tags.count`)
+	want := []string{"name", "fileSize / 1mb", "px", "owner.name", "tags.count"}
+	if strings.Join(cols, "|") != strings.Join(want, "|") {
+		t.Errorf("columns: got %q, want %q", cols, want)
+	}
+}
+
+// SCOPE filters on the queried table's owner_id, which the joined groups
+// table also has.
+func TestSelectScope(t *testing.T) {
+	db := setupTestDB(t)
+	q, err := Parse(`type = resource SELECT name, owner, owner.parent.name`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Validate(q); err != nil {
+		t.Fatal(err)
+	}
+	// Group 2 (Work) owns report.pdf; its subtree owns nothing else.
+	built, err := BuildProjection(q, db, TranslateOptions{ScopeGroupID: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []map[string]any
+	if err := built.Find(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || selectCell(rows[0]["name"]) != "report.pdf" || selectCell(rows[0]["owner"]) != "Work" || selectCell(rows[0]["owner.parent.name"]) != "Vacation" {
+		t.Errorf("scoped projection: got %v", rows)
+	}
+}
+
+func TestSelectQuotesColumnNames(t *testing.T) {
+	if got := quoteIdentifier(`a"b`); got != `"a""b"` {
+		t.Errorf("quoteIdentifier: got %s", got)
+	}
+}
+
+func TestSelectValidation(t *testing.T) {
+	valid := []string{
+		`type = resource SELECT name`,
+		`type = resource SELECT owner, owner.parent, series.meta.year, currentVersion.fileSize / 1kb`,
+		`type = note SELECT name, created.month, todos.count, owner.meta.client`,
+		`type = group SELECT parent.parent, meta.priority * 2 AS p ORDER BY p DESC, name`,
+		`type = resource SELECT fileSize AS size ORDER BY size LIMIT 5 OFFSET 10`,
+		`type = resource AND meta.select = 1 SELECT name AS as`,
+	}
+	for _, query := range valid {
+		t.Run(query, func(t *testing.T) {
+			q, err := Parse(query)
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+			if err := Validate(q); err != nil {
+				t.Errorf("expected valid, got: %v", err)
+			}
+		})
+	}
+
+	invalid := []struct {
+		query       string
+		errContains string
+	}{
+		{`name ~ "x" SELECT name`, "explicit entity type"},
+		{`type = resource SELECT name GROUP BY contentType COUNT()`, "cannot be combined with GROUP BY"},
+		{`type = resource SELECT name, name`, `duplicate SELECT column "name"`},
+		{`type = resource SELECT fileSize, fileSize / 1 AS fileSize`, `duplicate SELECT column "fileSize"`},
+		{`type = resource SELECT type`, "filter pseudo-field"},
+		{`type = resource SELECT tags`, "use tags.count"},
+		{`type = group SELECT children.name`, "use children.count"},
+		{`type = resource SELECT versions.number`, "use versions.count"},
+		{`type = resource SELECT currentVersion`, "use currentVersion.<field>"},
+		{`type = resource SELECT owner.ancestors.name`, "not a traversal field"},
+		{`type = resource SELECT ancestors.name`, "filter-only"},
+		{`type = resource SELECT name + 1`, "name is not numeric"},
+		{`type = resource SELECT created.month * 2`, "created.month is not numeric"},
+		{`type = resource SELECT nope`, "nope"},
+		{`type = resource SELECT name ORDER BY mb`, "mb"},
+	}
+	for _, tc := range invalid {
+		t.Run(tc.query, func(t *testing.T) {
+			q, err := Parse(tc.query)
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+			err = Validate(q)
+			if err == nil {
+				t.Fatal("expected a validation error")
+			}
+			if !strings.Contains(err.Error(), tc.errContains) {
+				t.Errorf("expected error containing %q, got: %v", tc.errContains, err)
+			}
+		})
+	}
+}
+
+func TestSelectParse(t *testing.T) {
+	q, err := Parse(`type = resource SCOPE 3 SELECT name, (width + 1) * height AS area, fileSize / 1mb ORDER BY area DESC LIMIT 5`)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	if q.Select == nil || len(q.Select.Columns) != 3 || q.Scope == nil || len(q.OrderBy) != 1 || q.Limit != 5 {
+		t.Fatalf("unexpected query: %+v", q)
+	}
+	area, ok := q.Select.Columns[1].Expr.(*ArithExpr)
+	if !ok || area.Operator.Type != TokenStar {
+		t.Fatalf("area: expected a product, got %#v", q.Select.Columns[1].Expr)
+	}
+	if sum, ok := area.Left.(*ArithExpr); !ok || sum.Operator.Type != TokenPlus {
+		t.Errorf("area: expected (width + 1) on the left, got %#v", area.Left)
+	}
+	if got := q.Select.Columns[2].Name(); got != "fileSize / 1mb" {
+		t.Errorf("unnamed column: got %q", got)
+	}
+	if !q.IsGrouped() || !q.IsTabular() {
+		t.Error("a SELECT query is grouped and tabular")
+	}
+
+	// A field named select is still a field.
+	q, err = Parse(`select = 1 AND meta.select = 2`)
+	if err != nil || q.Select != nil {
+		t.Errorf("select as a field: %v, %+v", err, q)
+	}
+
+	for _, input := range []string{
+		`type = resource SELECT`,
+		`type = resource SELECT name,`,
+		`type = resource SELECT name AS`,
+		`type = resource SELECT name AS "x"`,
+		`type = resource SELECT (name`,
+		`type = resource SELECT name *`,
+		`type = resource GROUP BY name SELECT name`,
+	} {
+		if _, err := Parse(input); err == nil {
+			t.Errorf("Parse(%q) should fail", input)
+		}
+	}
+}
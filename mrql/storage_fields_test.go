@@ -0,0 +1,51 @@
+package mrql
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func resourceIDsFor(t *testing.T, input string) []uint {
+	t.Helper()
+	db := setupTestDB(t)
+	if err := db.Exec(`CREATE TABLE IF NOT EXISTS resource_views (resource_id INTEGER PRIMARY KEY, viewed_at DATETIME)`).Error; err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	db.Exec("INSERT INTO resource_views (resource_id, viewed_at) VALUES (?, ?), (?, ?)", 1, now.Add(-time.Hour), 2, now.AddDate(0, 0, -200))
+	db.Model(&testResource{}).Where("id IN ?", []uint{2, 3}).Update("storage_location", "archive")
+
+	var resources []testResource
+	if err := parseAndTranslate(t, input, EntityResource, db).Find(&resources).Error; err != nil {
+		t.Fatalf("query error: %v", err)
+	}
+	ids := []uint{}
+	for _, r := range resources {
+		ids = append(ids, r.ID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func TestStorageFields(t *testing.T) {
+	cases := []struct {
+		query string
+		want  []uint
+	}{
+		{`type = resource AND lastViewed > -7d`, []uint{1}},
+		{`type = resource AND lastViewed < -180d`, []uint{2}},
+		{`type = resource AND (lastViewed < -180d OR lastViewed IS NULL)`, []uint{2, 3, 4}},
+		{`type = resource AND lastViewed IS NOT EMPTY ORDER BY lastViewed`, []uint{1, 2}},
+		{`type = resource AND storageLocation = "archive"`, []uint{2, 3}},
+		{`type = resource AND storageLocation IS NULL AND lastViewed IS NULL`, []uint{4}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.query, func(t *testing.T) {
+			if got := resourceIDsFor(t, tc.query); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
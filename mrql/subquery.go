@@ -0,0 +1,183 @@
+package mrql
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// subqueryTargets maps the relation fields that accept an IN sub-query to the
+// entity their IDs point at. The target depends only on the field name: owner,
+// parent, children and groups always reference groups, notes and resources
+// their own tables, on every entity where the field exists. `tags` has no
+// entity of its own, so its sub-query may select any entity type and matches
+// the tags those entities carry.
+var subqueryTargets = map[string]EntityType{
+	"owner":     EntityGroup,
+	"parent":    EntityGroup,
+	"children":  EntityGroup,
+	"groups":    EntityGroup,
+	"group":     EntityGroup,
+	"notes":     EntityNote,
+	"resources": EntityResource,
+	"tags":      EntityUnspecified,
+}
+
+// validateSubqueryIn validates `field [NOT] IN (type = X AND ...)`: the field
+// must be a single-part relation with a sub-query target, the inner expression
+// must pin its entity with a top-level `type =`, and that entity must be the
+// one the field references (any entity for tags). The inner expression is then
+// validated against its own entity type, and the resolved type is recorded on
+// the node for the translator.
+func validateSubqueryIn(n *SubqueryInExpr, entityType EntityType) error {
+	fieldName := n.Field.Name()
+	if len(n.Field.Parts) != 1 {
+		return &ValidationError{
+			Message: fmt.Sprintf("%s does not support IN sub-queries; use a relation field such as owner, groups, notes, or resources", fieldName),
+			Pos:     n.Field.Pos(),
+			Length:  len(fieldName),
+		}
+	}
+	target, ok := subqueryTargets[fieldName]
+	if !ok {
+		return &ValidationError{
+			Message: fmt.Sprintf("%s does not support IN sub-queries; use a relation field such as owner, groups, notes, or resources", fieldName),
+			Pos:     n.Field.Pos(),
+			Length:  len(fieldName),
+		}
+	}
+	if err := validateFieldExpr(n.Field, entityType); err != nil {
+		return err
+	}
+
+	innerType := extractEntityTypeFromNode(n.Where)
+	if innerType == EntityUnspecified {
+		hint := target.String()
+		if target == EntityUnspecified {
+			hint = "resource, note, or group"
+		}
+		return &ValidationError{
+			Message: fmt.Sprintf("IN sub-query must select one entity type; start it with type = %s", hint),
+			Pos:     n.Where.Pos(),
+			Length:  0,
+		}
+	}
+	if target != EntityUnspecified && innerType != target {
+		return &ValidationError{
+			Message: fmt.Sprintf("%s IN sub-query must select %ss (type = %s), got type = %s", fieldName, target, target, innerType),
+			Pos:     n.Where.Pos(),
+			Length:  0,
+		}
+	}
+	if err := validateNode(n.Where, innerType); err != nil {
+		return err
+	}
+	n.EntityType = innerType
+	return nil
+}
+
+// translateSubqueryIn translates `field [NOT] IN (type = X AND ...)` into an
+// uncorrelated `IN (SELECT ...)` over the inner entity's table. The inner WHERE
+// is translated by its own translateContext (so its fields, FTS and SIMILAR TO
+// state resolve against the inner entity) and carries the same scope CTE as the
+// outer query: a scoped principal cannot reach rows outside their subtree
+// through a sub-select any more than through the main query.
+//
+// Inner table references shadow outer ones under standard SQL scoping, so
+// `parent IN (type = group AND ...)` on groups needs no aliasing.
+func (tc *translateContext) translateSubqueryIn(db *gorm.DB, expr *SubqueryInExpr) (*gorm.DB, error) {
+	fieldName := expr.Field.Name()
+	fd, ok := LookupField(tc.entityType, fieldName)
+	if !ok || fd.Type != FieldRelation {
+		if isFieldOnAnyEntity(fieldName) {
+			db = db.Where("1 = 0")
+			return db, nil
+		}
+		return nil, &TranslateError{
+			Message: fmt.Sprintf("unknown field %q for entity type %s", fieldName, tc.entityType),
+			Pos:     expr.Pos(),
+		}
+	}
+
+	innerType := expr.EntityType
+	if innerType == EntityUnspecified {
+		innerType = extractEntityTypeFromNode(expr.Where)
+	}
+	target := subqueryTargets[fieldName]
+	if innerType == EntityUnspecified || (target != EntityUnspecified && innerType != target) {
+		return nil, &TranslateError{
+			Message: fmt.Sprintf("%s IN sub-query has no resolvable entity type", fieldName),
+			Pos:     expr.Pos(),
+		}
+	}
+
+	innerTable := entityTableName(innerType)
+	selectCol := innerTable + ".id"
+	if fd.Column == "children" {
+		selectCol = innerTable + ".owner_id"
+	}
+
+	inner := tc.db.Session(&gorm.Session{NewDB: true}).Table(innerTable)
+	innerTC := newTranslateContext(tc.db, innerType, &Query{Where: expr.Where}, tc.opts)
+	inner, err := innerTC.translateNode(inner, expr.Where)
+	if err != nil {
+		return nil, err
+	}
+	if tc.opts.ScopeGroupID > 0 {
+		inner = ApplyScopeCTE(inner, innerType, tc.opts.ScopeGroupID)
+	}
+	if fd.Column == "children" {
+		// A child's owner_id is the parent's id; NULL owners would make
+		// NOT IN match nothing.
+		inner = inner.Where(innerTable + ".owner_id IS NOT NULL")
+	}
+	inner = inner.Select(selectCol)
+
+	inOrNotIn := "IN"
+	if expr.Negated {
+		inOrNotIn = "NOT IN"
+	}
+
+	switch fd.Column {
+	case "owner_id", "parent_id":
+		column := tc.tableName + ".owner_id"
+		if expr.Negated {
+			// Mirrors owner != ...: an entity without an owner is not owned by
+			// any group the sub-query selects.
+			return db.Where("("+column+" NOT IN (?) OR "+column+" IS NULL)", inner), nil
+		}
+		return db.Where(column+" IN (?)", inner), nil
+	case "children":
+		return db.Where(tc.tableName+".id "+inOrNotIn+" (?)", inner), nil
+	}
+
+	rel, ok := lookupJunction(tc.entityType, fd.Column)
+	if ok && fd.Column == "tags" {
+		// The sub-query selects tagged entities; the row matches when it
+		// shares any of their tags.
+		innerRel, ok := lookupJunction(innerType, "tags")
+		if !ok {
+			return nil, &TranslateError{
+				Message: fmt.Sprintf("%ss have no tags to match", innerType),
+				Pos:     expr.Pos(),
+			}
+		}
+		subquery := fmt.Sprintf(
+			"%s.id %s (SELECT jt.%s FROM %s jt WHERE jt.%s IN (SELECT it.%s FROM %s it WHERE it.%s IN (?)))",
+			tc.tableName, inOrNotIn, rel.entityCol, rel.junctionTable, rel.relatedCol,
+			innerRel.relatedCol, innerRel.junctionTable, innerRel.entityCol,
+		)
+		return db.Where(subquery, inner), nil
+	}
+	if !ok || rel.relatedTable != innerTable {
+		return nil, &TranslateError{
+			Message: fmt.Sprintf("IN sub-query not supported for relation field %q", fd.Name),
+			Pos:     expr.Pos(),
+		}
+	}
+	subquery := fmt.Sprintf(
+		"%s.id %s (SELECT jt.%s FROM %s jt WHERE jt.%s IN (?))",
+		tc.tableName, inOrNotIn, rel.entityCol, rel.junctionTable, rel.relatedCol,
+	)
+	return db.Where(subquery, inner), nil
+}
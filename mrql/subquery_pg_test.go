@@ -0,0 +1,69 @@
+//go:build postgres
+
+package mrql
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func subqueryIDsPG(t *testing.T, input string, entityType EntityType, opts TranslateOptions) []uint {
+	t.Helper()
+	db := setupPostgresTestDB(t)
+	q := mustParse(t, input)
+	q.EntityType = entityType
+	if err := Validate(q); err != nil {
+		t.Fatalf("Validate(%q): %v", input, err)
+	}
+	result, err := TranslateWithOptions(q, db, opts)
+	if err != nil {
+		t.Fatalf("TranslateWithOptions(%q): %v", input, err)
+	}
+	var ids []uint
+	if err := result.Pluck(entityTableName(entityType)+".id", &ids).Error; err != nil {
+		t.Fatalf("query %q: %v", input, err)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func TestSubqueryOwnerInPG(t *testing.T) {
+	got := subqueryIDsPG(t, `type = resource AND owner IN (type = group AND tags = "document")`, EntityResource, TranslateOptions{})
+	if !reflect.DeepEqual(got, []uint{3}) {
+		t.Fatalf("expected [3], got %v", got)
+	}
+	got = subqueryIDsPG(t, `type = resource AND owner NOT IN (type = group AND name = "Vacation")`, EntityResource, TranslateOptions{})
+	if !reflect.DeepEqual(got, []uint{2, 3, 4}) {
+		t.Fatalf("expected [2 3 4], got %v", got)
+	}
+}
+
+func TestSubqueryJunctionAndHierarchyPG(t *testing.T) {
+	got := subqueryIDsPG(t, `type = resource AND groups IN (type = group AND parent.name = "Vacation")`, EntityResource, TranslateOptions{})
+	if !reflect.DeepEqual(got, []uint{3}) {
+		t.Fatalf("groups IN: expected [3], got %v", got)
+	}
+	got = subqueryIDsPG(t, `type = group AND children IN (type = group AND name = "Sub-Work")`, EntityGroup, TranslateOptions{})
+	if !reflect.DeepEqual(got, []uint{2}) {
+		t.Fatalf("children IN: expected [2], got %v", got)
+	}
+}
+
+func TestSubqueryTagsPG(t *testing.T) {
+	got := subqueryIDsPG(t, `type = resource AND tags IN (type = note AND name = "Meeting notes")`, EntityResource, TranslateOptions{})
+	if !reflect.DeepEqual(got, []uint{1, 2}) {
+		t.Fatalf("tags IN: expected [1 2], got %v", got)
+	}
+	got = subqueryIDsPG(t, `type = resource AND tags NOT IN (type = group AND name = "Vacation")`, EntityResource, TranslateOptions{})
+	if !reflect.DeepEqual(got, []uint{3, 4}) {
+		t.Fatalf("tags NOT IN: expected [3 4], got %v", got)
+	}
+}
+
+func TestSubqueryRespectsScopePG(t *testing.T) {
+	got := subqueryIDsPG(t, `type = group AND parent IN (type = group AND name = "Vacation")`, EntityGroup, TranslateOptions{ScopeGroupID: 2})
+	if len(got) != 0 {
+		t.Fatalf("expected out-of-scope parent to match nothing, got %v", got)
+	}
+}
@@ -0,0 +1,270 @@
+package mrql
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// subqueryIDs translates query for entityType with opts and returns the
+// matched IDs in ascending order.
+func subqueryIDs(t *testing.T, input string, entityType EntityType, opts TranslateOptions) []uint {
+	t.Helper()
+	db := setupTestDB(t)
+	q := mustParse(t, input)
+	q.EntityType = entityType
+	if err := Validate(q); err != nil {
+		t.Fatalf("Validate(%q): %v", input, err)
+	}
+	result, err := TranslateWithOptions(q, db, opts)
+	if err != nil {
+		t.Fatalf("TranslateWithOptions(%q): %v", input, err)
+	}
+	var ids []uint
+	if err := result.Pluck(entityTableName(entityType)+".id", &ids).Error; err != nil {
+		t.Fatalf("query %q: %v", input, err)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func expectSubqueryValidationError(t *testing.T, input, want string) {
+	t.Helper()
+	q := mustParse(t, input)
+	err := Validate(q)
+	if err == nil {
+		t.Fatalf("Validate(%q): expected error containing %q", input, want)
+	}
+	if _, ok := err.(*ValidationError); !ok {
+		t.Fatalf("Validate(%q): expected *ValidationError, got %T: %v", input, err, err)
+	}
+	if !strings.Contains(err.Error(), want) {
+		t.Fatalf("Validate(%q): error %q does not contain %q", input, err.Error(), want)
+	}
+}
+
+func TestSubqueryParseShape(t *testing.T) {
+	q := mustParse(t, `type = resource AND owner NOT IN (type = group AND name = "Work")`)
+	bin := q.Where.(*BinaryExpr)
+	sub, ok := bin.Right.(*SubqueryInExpr)
+	if !ok {
+		t.Fatalf("expected *SubqueryInExpr, got %T", bin.Right)
+	}
+	if sub.Field.Name() != "owner" || !sub.Negated {
+		t.Fatalf("unexpected field/negation: %q negated=%v", sub.Field.Name(), sub.Negated)
+	}
+	if _, ok := sub.Where.(*BinaryExpr); !ok {
+		t.Fatalf("expected inner *BinaryExpr, got %T", sub.Where)
+	}
+}
+
+// A value list is still a value list: only a leading `type` opens a sub-select.
+func TestSubqueryValueListUnaffected(t *testing.T) {
+	q := mustParse(t, `tags IN (photo, "video")`)
+	if _, ok := q.Where.(*InExpr); !ok {
+		t.Fatalf("expected *InExpr, got %T", q.Where)
+	}
+}
+
+func TestSubqueryParseErrors(t *testing.T) {
+	pe := mustFail(t, `owner IN (type = group AND name = "x"`)
+	if !strings.Contains(pe.Message, "IN sub-query") {
+		t.Fatalf("unexpected message: %q", pe.Message)
+	}
+	// Sub-selects are expressions only: no clauses inside the parentheses.
+	mustFail(t, `owner IN (type = group ORDER BY name)`)
+}
+
+// Nested sub-selects share the parenthesis depth budget.
+func TestSubqueryDepthLimit(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("type = group AND ")
+	for i := 0; i < MaxExpressionDepth+1; i++ {
+		b.WriteString("parent IN (type = group AND ")
+	}
+	b.WriteString(`name = "x"`)
+	b.WriteString(strings.Repeat(")", MaxExpressionDepth+1))
+	pe := mustFail(t, b.String())
+	if !strings.Contains(pe.Message, "maximum depth") {
+		t.Fatalf("expected depth limit error, got %q", pe.Message)
+	}
+}
+
+func TestSubqueryValidation(t *testing.T) {
+	expectSubqueryValidationError(t, `type = resource AND tags IN (type = group OR name = "x")`, "type = resource, note, or group")
+	expectSubqueryValidationError(t, `type = resource AND owner IN (type = note AND name = "x")`, "must select groups")
+	expectSubqueryValidationError(t, `type = resource AND owner IN (type = group OR name = "x")`, "must select one entity type")
+	expectSubqueryValidationError(t, `type = resource AND name IN (type = group AND name = "x")`, "does not support IN sub-queries")
+	expectSubqueryValidationError(t, `type = resource AND owner.parent IN (type = group AND name = "x")`, "does not support IN sub-queries")
+	// The inner expression is validated against the inner entity.
+	expectSubqueryValidationError(t, `type = resource AND owner IN (type = group AND contentType = "image/png")`, "contentType")
+	// parent is a group field; resources reference groups through owner.
+	expectSubqueryValidationError(t, `type = resource AND parent IN (type = group AND name = "x")`, "parent")
+}
+
+func TestSubqueryOwnerIn(t *testing.T) {
+	// Work (2) is tagged "document" and owns report.pdf (3).
+	got := subqueryIDs(t, `type = resource AND owner IN (type = group AND tags = "document")`, EntityResource, TranslateOptions{})
+	if !reflect.DeepEqual(got, []uint{3}) {
+		t.Fatalf("expected [3], got %v", got)
+	}
+}
+
+// NOT IN keeps owner-less rows, matching owner != ... semantics.
+func TestSubqueryOwnerNotIn(t *testing.T) {
+	got := subqueryIDs(t, `type = resource AND owner NOT IN (type = group AND name = "Vacation")`, EntityResource, TranslateOptions{})
+	if !reflect.DeepEqual(got, []uint{2, 3, 4}) {
+		t.Fatalf("expected [2 3 4], got %v", got)
+	}
+}
+
+// The motivating shape: resources owned by a group matching a count predicate.
+func TestSubqueryOwnerWithRelationCount(t *testing.T) {
+	got := subqueryIDs(t, `type = resource AND owner IN (type = group AND notes.count > 0 AND name != "Work")`, EntityResource, TranslateOptions{})
+	if !reflect.DeepEqual(got, []uint{1}) {
+		t.Fatalf("expected [1], got %v", got)
+	}
+}
+
+func TestSubqueryJunctionRelations(t *testing.T) {
+	cases := []struct {
+		name   string
+		query  string
+		entity EntityType
+		want   []uint
+	}{
+		// Work (2) and Photos (5) sit under Vacation; report.pdf is in Work.
+		{"resource groups", `type = resource AND groups IN (type = group AND parent.name = "Vacation")`, EntityResource, []uint{3}},
+		{"resource notes", `type = resource AND notes IN (type = note AND name ~ "Meeting*")`, EntityResource, []uint{1}},
+		{"note resources", `type = note AND resources IN (type = resource AND contentType = "application/pdf")`, EntityNote, []uint{2}},
+		{"group notes", `type = group AND notes IN (type = note AND name = "Todo list")`, EntityGroup, []uint{2}},
+		{"resource groups negated", `type = resource AND groups NOT IN (type = group AND name = "Vacation")`, EntityResource, []uint{2, 3, 4}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := subqueryIDs(t, tc.query, tc.entity, TranslateOptions{})
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+// tags IN (...) matches the tags carried by whatever entities the sub-query
+// selects.
+func TestSubqueryTags(t *testing.T) {
+	cases := []struct {
+		name   string
+		query  string
+		entity EntityType
+		want   []uint
+	}{
+		// Note 1 is tagged "document" and "photo".
+		{"resource tags of notes", `type = resource AND tags IN (type = note AND name = "Meeting notes")`, EntityResource, []uint{1, 2}},
+		// Work (2) is tagged "document", like note 1.
+		{"note tags of groups", `type = note AND tags IN (type = group AND name = "Work")`, EntityNote, []uint{1}},
+		// Resource 2 carries "video", which nothing else has.
+		{"same entity", `type = resource AND tags IN (type = resource AND tags = "video")`, EntityResource, []uint{1, 2}},
+		{"negated", `type = resource AND tags NOT IN (type = group AND name = "Vacation")`, EntityResource, []uint{3, 4}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := subqueryIDs(t, tc.query, tc.entity, TranslateOptions{})
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestSubqueryGroupHierarchy(t *testing.T) {
+	got := subqueryIDs(t, `type = group AND parent IN (type = group AND name = "Vacation")`, EntityGroup, TranslateOptions{})
+	if !reflect.DeepEqual(got, []uint{2, 5}) {
+		t.Fatalf("parent IN: expected [2 5], got %v", got)
+	}
+	got = subqueryIDs(t, `type = group AND children IN (type = group AND name = "Sub-Work")`, EntityGroup, TranslateOptions{})
+	if !reflect.DeepEqual(got, []uint{2}) {
+		t.Fatalf("children IN: expected [2], got %v", got)
+	}
+	got = subqueryIDs(t, `type = group AND children NOT IN (type = group AND name = "Sub-Work")`, EntityGroup, TranslateOptions{})
+	if !reflect.DeepEqual(got, []uint{1, 3, 4, 5}) {
+		t.Fatalf("children NOT IN: expected [1 3 4 5], got %v", got)
+	}
+}
+
+func TestSubqueryNested(t *testing.T) {
+	// Groups linked to report.pdf → Work; resources owned by Work → report.pdf.
+	got := subqueryIDs(t, `type = resource AND owner IN (type = group AND resources IN (type = resource AND name = "report.pdf"))`, EntityResource, TranslateOptions{})
+	if !reflect.DeepEqual(got, []uint{3}) {
+		t.Fatalf("expected [3], got %v", got)
+	}
+}
+
+// The sub-select carries the principal's scope: a group outside the scope
+// cannot be matched through a sub-query even when the outer rows are in scope.
+func TestSubqueryRespectsScope(t *testing.T) {
+	query := `type = group AND parent IN (type = group AND name = "Vacation")`
+	// Scope 2 = {Work, Sub-Work}. Work's parent is Vacation, outside the scope.
+	got := subqueryIDs(t, query, EntityGroup, TranslateOptions{ScopeGroupID: 2})
+	if len(got) != 0 {
+		t.Fatalf("expected out-of-scope parent to match nothing, got %v", got)
+	}
+	// Scope 1 covers Vacation itself.
+	got = subqueryIDs(t, query, EntityGroup, TranslateOptions{ScopeGroupID: 1})
+	if !reflect.DeepEqual(got, []uint{2, 5}) {
+		t.Fatalf("expected [2 5] in scope 1, got %v", got)
+	}
+}
+
+func TestSubqueryParams(t *testing.T) {
+	q := mustParse(t, `type = resource AND owner IN (type = group AND name = $owner)`)
+	if got := ListParams(q); !reflect.DeepEqual(got, []string{"owner"}) {
+		t.Fatalf("expected [owner], got %v", got)
+	}
+	if err := BindParams(q, map[string]any{"owner": "Work"}); err != nil {
+		t.Fatalf("BindParams: %v", err)
+	}
+	if err := Validate(q); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if len(ListParams(q)) != 0 {
+		t.Fatal("expected no remaining params after bind")
+	}
+}
+
+func TestSubqueryFilterBar(t *testing.T) {
+	if _, err := ParseFilter(EntityResource, `owner IN (type = group AND name = "Work")`); err != nil {
+		t.Fatalf("expected sub-select type to be allowed in a filter, got %v", err)
+	}
+	if _, err := ParseFilter(EntityResource, `owner IN (type = group AND name = $g)`); err == nil {
+		t.Fatal("expected placeholder inside a sub-select to be rejected")
+	}
+	if _, err := ParseFilter(EntityResource, `owner IN (type = group) AND type = resource`); err == nil {
+		t.Fatal("expected top-level type to stay rejected")
+	}
+}
+
+// SQLite has no regex: the up-front gate must see regex inside sub-selects.
+func TestSubqueryContainsRegex(t *testing.T) {
+	q := mustParse(t, `type = resource AND owner IN (type = group AND name ~* "^w")`)
+	if !ContainsRegexOperator(q) {
+		t.Fatal("expected ContainsRegexOperator to see the sub-select's regex")
+	}
+}
+
+func TestSubqueryFingerprint(t *testing.T) {
+	a := fingerprintQuery(t, `type = resource AND owner IN (type = group AND name = "a")`, ScopeShapeNone)
+	b := fingerprintQuery(t, `type = resource AND owner IN (type = group AND name = "b")`, ScopeShapeNone)
+	if a != b {
+		t.Fatalf("inner literals must not change the fingerprint:\n%s\n%s", a, b)
+	}
+	c := fingerprintQuery(t, `type = resource AND owner IN (type = group AND description = "a")`, ScopeShapeNone)
+	if a == c {
+		t.Fatal("inner fields must change the fingerprint")
+	}
+	d := fingerprintQuery(t, `type = resource AND owner NOT IN (type = group AND name = "a")`, ScopeShapeNone)
+	if a == d {
+		t.Fatal("negation must change the fingerprint")
+	}
+}
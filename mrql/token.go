@@ -31,10 +31,17 @@ const (
 	TokenAvg     // AVG (followed by '(')
 	TokenMin     // MIN (followed by '(')
 	TokenMax     // MAX (followed by '(')
+	TokenMedian       // MEDIAN (followed by '(')
+	TokenPercentile   // PERCENTILE (followed by '(')
+	TokenRunningSum   // RUNNING_SUM (followed by '(')
+	TokenRunningCount // RUNNING_COUNT (followed by '(')
 	TokenText      // TEXT (for TEXT ~)
 	TokenKwType    // TYPE (also usable as field name via context)
 	TokenScope     // SCOPE
 	TokenSimilarTo // SIMILAR TO (two words, merged by lexer)
+	TokenAddTags    // ADD TAGS (two words, merged by lexer; mutations only)
+	TokenRemoveTags // REMOVE TAGS (two words, merged by lexer; mutations only)
+	TokenMoveTo     // MOVE TO (two words, merged by lexer; mutations only)
 
 	// Operators
 	TokenEq      // =
@@ -47,6 +54,10 @@ const (
 	TokenNotLike  // !~
 	TokenRegex    // ~*  (PostgreSQL case-insensitive POSIX regex match)
 	TokenNotRegex // !~* (negated)
+	TokenPlus     // +  (SELECT arithmetic)
+	TokenMinus    // -  (SELECT arithmetic; "-" before a digit is a relative date)
+	TokenStar     // *  (SELECT arithmetic)
+	TokenSlash    // /  (SELECT arithmetic)
 
 	// Delimiters
 	TokenLParen // (
@@ -58,6 +69,7 @@ const (
 	TokenRelDate // -7d, -30d, -3m, -1y
 	TokenFunc    // NOW(), START_OF_DAY(), etc.
 	TokenParam   // $name — a parameter placeholder (value position only)
+	TokenScalarFunc // LOWER, YEAR, DATE_ADD, ... (followed by '(')
 
 	TokenEOF
 	TokenIllegal
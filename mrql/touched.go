@@ -0,0 +1,149 @@
+package mrql
+
+import "sort"
+
+// Entity kinds reported by TouchedEntities. Tags are not a query entity type,
+// but renaming or deleting one changes every result that filters on tags.
+const (
+	TouchedResource = "resource"
+	TouchedNote     = "note"
+	TouchedGroup    = "group"
+	TouchedTag      = "tag"
+)
+
+// touchedByField maps a field-path segment that leaves the queried entity to
+// the kind it reads. A segment not listed here is a column of whatever entity
+// the path is on at that point, so it adds nothing.
+var touchedByField = map[string]string{
+	"tags":           TouchedTag,
+	"owner":          TouchedGroup,
+	"parent":         TouchedGroup,
+	"children":       TouchedGroup,
+	"ancestors":      TouchedGroup,
+	"descendants":    TouchedGroup,
+	"groups":         TouchedGroup,
+	"group":          TouchedGroup,
+	"relations":      TouchedGroup,
+	"backRelations":  TouchedGroup,
+	"notes":          TouchedNote,
+	"blocks":         TouchedNote,
+	"resources":      TouchedResource,
+	"series":         TouchedResource,
+	"versions":       TouchedResource,
+	"currentVersion": TouchedResource,
+	"similarImages":  TouchedResource,
+}
+
+// TouchedEntities returns the entity kinds (Touched* values, sorted) whose
+// writes can change q's result: the queried entity types — all three for a
+// cross-entity query — plus every kind a field path, sub-query or SCOPE reads.
+//
+// It errs on the side of listing too much: a write to a listed kind counts
+// whether or not the written row could match, which costs a needless refresh,
+// while a kind left out would serve a stale result as current.
+func TouchedEntities(q *Query) []string {
+	kinds := map[string]bool{}
+	addEntity := func(et EntityType) {
+		switch et {
+		case EntityResource:
+			kinds[TouchedResource] = true
+		case EntityNote:
+			kinds[TouchedNote] = true
+		case EntityGroup:
+			kinds[TouchedGroup] = true
+		default:
+			kinds[TouchedResource] = true
+			kinds[TouchedNote] = true
+			kinds[TouchedGroup] = true
+		}
+	}
+	addField := func(f *FieldExpr) {
+		if f == nil {
+			return
+		}
+		for _, part := range f.Parts {
+			// meta.<key> ends the path: the key is data, not a relation.
+			if part.Value == "meta" {
+				return
+			}
+			if kind, ok := touchedByField[part.Value]; ok {
+				kinds[kind] = true
+			}
+		}
+	}
+
+	addEntity(ExtractEntityType(q))
+	touchedFields(q.Where, addField, addEntity)
+	if q.Scope != nil {
+		kinds[TouchedGroup] = true
+	}
+	if q.Select != nil {
+		for _, col := range q.Select.Columns {
+			walkSelectFields(col.Expr, addField)
+		}
+	}
+	if q.GroupBy != nil {
+		for _, f := range q.GroupBy.Fields {
+			addField(f)
+		}
+		for _, agg := range q.GroupBy.Aggregates {
+			addField(agg.Field)
+		}
+	}
+	for _, ob := range q.OrderBy {
+		addField(ob.Field)
+	}
+
+	out := make([]string, 0, len(kinds))
+	for kind := range kinds {
+		out = append(out, kind)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func touchedFields(node Node, addField func(*FieldExpr), addEntity func(EntityType)) {
+	switch n := node.(type) {
+	case *BinaryExpr:
+		touchedFields(n.Left, addField, addEntity)
+		touchedFields(n.Right, addField, addEntity)
+	case *NotExpr:
+		touchedFields(n.Expr, addField, addEntity)
+	case *ComparisonExpr:
+		addField(n.Field)
+	case *ScalarComparisonExpr:
+		for _, side := range []Node{n.Left, n.Right} {
+			switch side := side.(type) {
+			case *FieldExpr:
+				addField(side)
+			case *ScalarCall:
+				addField(side.Field)
+			}
+		}
+	case *InExpr:
+		addField(n.Field)
+	case *IsExpr:
+		addField(n.Field)
+	case *SubqueryInExpr:
+		addField(n.Field)
+		inner := n.EntityType
+		if inner == EntityUnspecified {
+			inner = extractEntityTypeFromNode(n.Where)
+		}
+		addEntity(inner)
+		touchedFields(n.Where, addField, addEntity)
+	}
+}
+
+// walkSelectFields visits every field a SELECT column expression reads.
+func walkSelectFields(n Node, visit func(*FieldExpr)) {
+	switch n := n.(type) {
+	case *FieldExpr:
+		visit(n)
+	case *ScalarCall:
+		visit(n.Field)
+	case *ArithExpr:
+		walkSelectFields(n.Left, visit)
+		walkSelectFields(n.Right, visit)
+	}
+}
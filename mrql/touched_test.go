@@ -0,0 +1,37 @@
+package mrql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTouchedEntities(t *testing.T) {
+	cases := []struct {
+		query string
+		want  []string
+	}{
+		{`type = resource AND name ~ "a*"`, []string{"resource"}},
+		{`type = resource AND tags = "photo"`, []string{"resource", "tag"}},
+		{`type = resource AND owner.tags = "x"`, []string{"group", "resource", "tag"}},
+		{`type = note AND meta.tags = "x"`, []string{"note"}},
+		{`type = note AND tags IN (type = resource AND name = "x")`, []string{"note", "resource", "tag"}},
+		{`type = group AND relations.count > 1 ORDER BY notes.count`, []string{"group", "note"}},
+		{`type = note SCOPE 1`, []string{"group", "note"}},
+		{`type = note GROUP BY owner COUNT()`, []string{"group", "note"}},
+		{`name = "x"`, []string{"group", "note", "resource"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.query, func(t *testing.T) {
+			q, err := Parse(tc.query)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if err := Validate(q); err != nil {
+				t.Fatalf("validate: %v", err)
+			}
+			if got := TouchedEntities(q); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
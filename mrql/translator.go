@@ -3,6 +3,7 @@ package mrql
 import (
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -96,11 +97,13 @@ func TranslateWithOptions(q *Query, db *gorm.DB, opts TranslateOptions) (*gorm.D
 	tc := newTranslateContext(db, entityType, q, opts)
 
 	// Start with the correct table
-	result := tc.db.Table(tc.tableName)
+	result, err := ApplyAsOf(q, tc.db.Table(tc.tableName))
+	if err != nil {
+		return nil, err
+	}
 
 	// Translate WHERE clause
 	if q.Where != nil {
-		var err error
 		result, err = tc.translateNode(result, q.Where)
 		if err != nil {
 			return nil, err
@@ -134,19 +137,56 @@ func TranslateWithOptions(q *Query, db *gorm.DB, opts TranslateOptions) (*gorm.D
 		result = result.Order(col + " " + direction)
 	}
 
+	// Keyset pagination: the primary key breaks ties, and a cursor resumes
+	// after its row instead of skipping OFFSET rows.
+	if q.Keyset {
+		idCol := tc.qualifiedColumn("id")
+		result = result.Order(idCol + " ASC")
+		if q.After != nil {
+			cond, args, err := tc.keysetAfter(q, idCol)
+			if err != nil {
+				return nil, err
+			}
+			result = result.Where(cond, args...)
+		}
+	}
+
 	// Apply LIMIT
 	if q.Limit >= 0 {
 		result = result.Limit(q.Limit)
 	}
 
 	// Apply OFFSET
-	if q.Offset >= 0 {
+	if q.Offset >= 0 && q.After == nil {
 		result = result.Offset(q.Offset)
 	}
 
 	return result, nil
 }
 
+// keysetAfter builds the WHERE predicate that resumes q after q.After: rows
+// whose ORDER BY keys, then ID, sort strictly after the cursor's.
+func (tc *translateContext) keysetAfter(q *Query, idCol string) (string, []any, error) {
+	exprs := make([]string, len(q.OrderBy))
+	for i, ob := range q.OrderBy {
+		if ob.Random {
+			continue // rejected by keysetTerms
+		}
+		col, err := tc.resolveOrderByColumn(ob.Field)
+		if err != nil {
+			return "", nil, err
+		}
+		exprs[i] = col
+	}
+	terms, err := keysetTerms(q, exprs)
+	if err != nil {
+		return "", nil, err
+	}
+	terms = append(terms, keysetTerm{expr: idCol, ascending: true, value: q.After.ID})
+	cond, args := keysetCondition(terms)
+	return cond, args, nil
+}
+
 // translateContext holds shared state during AST translation.
 type translateContext struct {
 	db         *gorm.DB
@@ -167,6 +207,18 @@ type translateContext struct {
 
 	ftsKnown     bool
 	ftsAvailable bool
+
+	// blockTextKnown/blockTextIndex cache hasBlockTextIndex.
+	blockTextKnown bool
+	blockTextIndex bool
+
+	// sqliteVersionKnown/sqliteVersion cache checkPercentileSupport's probe.
+	sqliteVersionKnown bool
+	sqliteVersion      string
+
+	// opts is kept so IN sub-queries translate with the same thresholds and
+	// scope as the query that contains them.
+	opts TranslateOptions
 }
 
 // newTranslateContext builds a translateContext for a resolved entity type,
@@ -181,6 +233,7 @@ func newTranslateContext(db *gorm.DB, entityType EntityType, q *Query, opts Tran
 		aHashThreshold:      opts.AHashThreshold,
 		similarTarget:       findSimilarTarget(q.Where),
 		textSearchTarget:    findTextSearchTarget(q.Where),
+		opts:                opts,
 	}
 	if opts.FTSAvailable != nil {
 		tc.ftsKnown, tc.ftsAvailable = true, *opts.FTSAvailable
@@ -236,6 +289,10 @@ func nodeContainsRegex(node Node) bool {
 		return nodeContainsRegex(n.Expr)
 	case *ComparisonExpr:
 		return isRegexOperator(n.Operator)
+	case *ScalarComparisonExpr:
+		return isRegexOperator(n.Operator)
+	case *SubqueryInExpr:
+		return nodeContainsRegex(n.Where)
 	}
 	return false
 }
@@ -812,8 +869,12 @@ func (tc *translateContext) translateNode(db *gorm.DB, node Node) (*gorm.DB, err
 		return tc.translateNotExpr(db, n)
 	case *ComparisonExpr:
 		return tc.translateComparisonExpr(db, n)
+	case *ScalarComparisonExpr:
+		return tc.translateScalarComparison(db, n)
 	case *InExpr:
 		return tc.translateInExpr(db, n)
+	case *SubqueryInExpr:
+		return tc.translateSubqueryIn(db, n)
 	case *IsExpr:
 		return tc.translateIsExpr(db, n)
 	case *TextSearchExpr:
@@ -968,9 +1029,24 @@ func (tc *translateContext) translateComparisonExpr(db *gorm.DB, expr *Compariso
 		return db, nil
 	}
 
+	// Todo counts total counters on the note's blocks (see blocks.go).
+	if isBlockCountField(expr.Field) {
+		return tc.translateBlockCount(db, expr)
+	}
+
 	// Handle <relation>.count pseudo-fields before traversal routing —
 	// children.count would otherwise be misrouted as a traversal chain.
 	if len(expr.Field.Parts) == 2 && expr.Field.Parts[1].Value == "count" {
+		// relations("depicts").count narrows the count to one relation type,
+		// which needs a bind value the plain count expressions don't carry.
+		if root, ok := tc.relatedRootFor(expr.Field); ok && expr.Field.RelationType != nil {
+			val, err := tc.resolveValue(expr.Value, FieldDef{Name: fieldName, Type: FieldNumber})
+			if err != nil {
+				return nil, err
+			}
+			countExpr, args := tc.relatedCountExpr(root, expr.Field.RelationType)
+			return db.Where(countExpr+" "+tc.sqlOperator(expr.Operator)+" ?", append(args, val)...), nil
+		}
 		if countExpr, ok := tc.relationCountExpr(expr.Field.Parts[0].Value); ok {
 			val, err := tc.resolveValue(expr.Value, FieldDef{Name: fieldName, Type: FieldNumber})
 			if err != nil {
@@ -990,6 +1066,17 @@ func (tc *translateContext) translateComparisonExpr(db *gorm.DB, expr *Compariso
 		}
 	}
 
+	// Handle related roots: series.X, versions.X, currentVersion.X,
+	// relations("type").X, backRelations.X, and direct comparisons on the
+	// root itself (series = "Holiday"). A root valid on another entity type is
+	// a cross-entity field mismatch: inject FALSE, as for scalar fields below.
+	if isRelatedField(expr.Field) {
+		if root, ok := tc.relatedRootFor(expr.Field); ok {
+			return tc.translateRelatedComparison(db, root, expr)
+		}
+		return db.Where("1 = 0"), nil
+	}
+
 	// Handle recursive hierarchy traversal: ancestors.X / descendants.X.
 	// Checked before the FK-chain routing since these are distinct roots.
 	if len(expr.Field.Parts) >= 2 {
@@ -1053,6 +1140,17 @@ func (tc *translateContext) translateComparisonExpr(db *gorm.DB, expr *Compariso
 		return db, nil
 	}
 
+	// A resource's hash matches under either algorithm while the content hash
+	// migration runs: a SHA1 finds a resource re-hashed to SHA-256 through its
+	// legacy_hash, which is NULL on rows written before the column existed.
+	if fd.Column == "hash" && tc.entityType == EntityResource && (expr.Operator.Type == TokenEq || expr.Operator.Type == TokenNeq) {
+		cond := "(LOWER(" + column + ") = LOWER(?) OR LOWER(COALESCE(" + tc.qualifiedColumn("legacy_hash") + ", '')) = LOWER(?))"
+		if expr.Operator.Type == TokenNeq {
+			cond = "NOT " + cond
+		}
+		return db.Where(cond, val, val), nil
+	}
+
 	// For string equality, use case-insensitive comparison
 	if fd.Type == FieldString && (expr.Operator.Type == TokenEq || expr.Operator.Type == TokenNeq) {
 		db = db.Where("LOWER("+column+") "+op+" LOWER(?)", val)
@@ -1542,6 +1640,14 @@ func (tc *translateContext) translateRelationIn(db *gorm.DB, fd FieldDef, negate
 func (tc *translateContext) translateIsExpr(db *gorm.DB, expr *IsExpr) (*gorm.DB, error) {
 	fieldName := expr.Field.Name()
 
+	// Related roots: series/currentVersion IS NULL, versions/relations IS EMPTY.
+	if isRelatedField(expr.Field) {
+		if root, ok := tc.relatedRootFor(expr.Field); ok {
+			return tc.translateRelatedIsEmpty(db, root, expr)
+		}
+		return db.Where("1 = 0"), nil
+	}
+
 	// Handle traversal IS NULL / IS NOT NULL via traversal subquery
 	if len(expr.Field.Parts) == 2 && expr.IsNull {
 		root := expr.Field.Parts[0].Value
@@ -1821,11 +1927,26 @@ func (tc *translateContext) likeOperator() string {
 	return "LIKE"
 }
 
-// qualifiedColumn returns the fully qualified column name (table.column).
+// qualifiedColumn returns the fully qualified column name (table.column), or
+// the subquery reading a derived one.
 func (tc *translateContext) qualifiedColumn(column string) string {
+	if expr, ok := derivedColumns[column]; ok {
+		return fmt.Sprintf(expr, tc.tableName)
+	}
 	return tc.tableName + "." + column
 }
 
+// lastViewedColumn is the Column of a resource's lastViewed field.
+const lastViewedColumn = "last_viewed"
+
+// derivedColumns are fields kept outside the entity's own table, read through
+// a correlated subquery on the entity's id; %s is the entity table. Viewing a
+// file records into resource_views so that it rewrites neither the resource
+// row nor its change history, which also means AS OF reads the current value.
+var derivedColumns = map[string]string{
+	lastViewedColumn: "(SELECT _lv.viewed_at FROM resource_views _lv WHERE _lv.resource_id = %s.id)",
+}
+
 // relationCountExpr returns the correlated COUNT(*) subquery for a countable
 // relation field (junction-backed relations, or children on group).
 func (tc *translateContext) relationCountExpr(fieldName string) (string, bool) {
@@ -1839,6 +1960,10 @@ func (tc *translateContext) relationCountExpr(fieldName string) (string, bool) {
 	if fd.Column == "children" {
 		return fmt.Sprintf("(SELECT COUNT(*) FROM groups c WHERE c.owner_id = %s.id)", tc.tableName), true
 	}
+	if root, ok := relatedRoots[fieldName]; ok && !root.singleReference() {
+		expr, _ := tc.relatedCountExpr(root, nil)
+		return expr, true
+	}
 	return "", false
 }
 
@@ -1850,8 +1975,9 @@ func (tc *translateContext) resolveOrderByColumn(f *FieldExpr) (string, error) {
 	fieldName := f.Name()
 
 	// "rank" → full-text relevance of the single TEXT ~ predicate (validated:
-	// determined entity, no GROUP BY, exactly one TextSearchExpr). Checked before
-	// field lookup so a stray field named rank never shadows it.
+	// no GROUP BY, exactly one TextSearchExpr; cross-entity queries resolve it
+	// per union branch). Checked before field lookup so a stray field named
+	// rank never shadows it.
 	if len(f.Parts) == 1 && strings.EqualFold(f.Parts[0].Value, "rank") && tc.textSearchTarget != nil {
 		return tc.rankOrderExpr()
 	}
@@ -1868,9 +1994,16 @@ func (tc *translateContext) resolveOrderByColumn(f *FieldExpr) (string, error) {
 			tc.similarTarget.TargetID, tc.tableName, tc.similarTarget.TargetID, tc.tableName), nil
 	}
 
+	if isBlockCountField(f) && tc.entityType == EntityNote {
+		return tc.blockCountOrderExpr(f), nil
+	}
+
 	// <relation>.count → correlated COUNT(*) subquery (valid in ORDER BY on
 	// both SQLite and PostgreSQL).
 	if len(f.Parts) == 2 && f.Parts[1].Value == "count" {
+		if root, ok := tc.relatedRootFor(f); ok && f.RelationType != nil {
+			return tc.relatedCountOrderExpr(root, f.RelationType), nil
+		}
 		if expr, ok := tc.relationCountExpr(f.Parts[0].Value); ok {
 			return expr, nil
 		}
@@ -2036,11 +2169,13 @@ func TranslateGroupBy(q *Query, db *gorm.DB, opts TranslateOptions) (*GroupByRes
 
 	tc := newTranslateContext(db, entityType, q, opts)
 
-	result := db.Table(tc.tableName)
+	result, err := ApplyAsOf(q, db.Table(tc.tableName))
+	if err != nil {
+		return nil, err
+	}
 
 	// Apply WHERE clause
 	if q.Where != nil {
-		var err error
 		result, err = tc.translateNode(result, q.Where)
 		if err != nil {
 			return nil, err
@@ -2076,10 +2211,12 @@ func BuildAggregatedGroupBy(q *Query, db *gorm.DB, opts TranslateOptions) (*gorm
 	}
 
 	tc := newTranslateContext(db, entityType, q, opts)
-	result := db.Table(tc.tableName)
+	result, err := ApplyAsOf(q, db.Table(tc.tableName))
+	if err != nil {
+		return nil, err
+	}
 
 	if q.Where != nil {
-		var err error
 		result, err = tc.translateNode(result, q.Where)
 		if err != nil {
 			return nil, err
@@ -2112,37 +2249,14 @@ func (tc *translateContext) translateAggregatedGroupBy(db *gorm.DB, q *Query) (*
 // buildAggregatedGroupByDB composes the aggregated SELECT/GROUP BY/HAVING/ORDER
 // BY/LIMIT onto db and returns it without executing.
 func (tc *translateContext) buildAggregatedGroupByDB(db *gorm.DB, q *Query) (*gorm.DB, error) {
-	// Add JOINs for relation fields (tags, owner, groups) if used in GROUP BY
-	var relationExprs map[string]groupByRelExpr
-	db, relationExprs = tc.groupByRelationJoins(db, q.GroupBy.Fields)
-
-	var selectCols []string
-	var groupCols []string
-
-	// Build SELECT and GROUP BY column lists
-	for _, f := range q.GroupBy.Fields {
-		fieldName := f.Name()
-		// Check if this field has a relation-based expression
-		if rel, ok := relationExprs[fieldName]; ok {
-			if rel.selectExpr != rel.groupExpr {
-				// PostgreSQL requires non-grouped columns to be aggregated.
-				// Since we group by a unique ID/FK, MAX(name) returns the one name.
-				selectCols = append(selectCols, "MAX("+rel.selectExpr+`) AS "`+fieldName+`"`)
-			} else {
-				selectCols = append(selectCols, rel.selectExpr+` AS "`+fieldName+`"`)
-			}
-			groupCols = append(groupCols, rel.groupExpr)
-		} else {
-			selectExpr, groupExpr := tc.groupByFieldExprs(fieldName)
-			selectCols = append(selectCols, selectExpr+` AS "`+fieldName+`"`)
-			groupCols = append(groupCols, groupExpr)
-		}
-	}
+	db, selectCols, groupCols := tc.groupByColumns(db, q.GroupBy.Fields)
 
 	// Build aggregate SELECT expressions
 	for _, agg := range q.GroupBy.Aggregates {
-		selectExpr, alias := tc.aggregateExpr(agg)
-		selectCols = append(selectCols, selectExpr+` AS "`+alias+`"`)
+		if err := tc.checkPercentileSupport(agg); err != nil {
+			return nil, err
+		}
+		selectCols = append(selectCols, tc.aggregateSelectExpr(agg, q.GroupBy, groupCols)+` AS "`+agg.Key()+`"`)
 	}
 
 	db = db.Select(strings.Join(selectCols, ", "))
@@ -2191,6 +2305,49 @@ func (tc *translateContext) buildAggregatedGroupByDB(db *gorm.DB, q *Query) (*go
 	return db, nil
 }
 
+// groupByColumns adds the JOINs the GROUP BY fields need and returns their
+// SELECT expressions (aliased to the field names) and GROUP BY expressions,
+// one per field in order.
+func (tc *translateContext) groupByColumns(db *gorm.DB, fields []*FieldExpr) (*gorm.DB, []string, []string) {
+	// Add JOINs for relation fields (tags, owner, groups) if used in GROUP BY
+	var relationExprs map[string]groupByRelExpr
+	db, relationExprs = tc.groupByRelationJoins(db, fields)
+
+	var selectCols []string
+	var groupCols []string
+
+	// Build SELECT and GROUP BY column lists
+	for _, f := range fields {
+		fieldName := f.Name()
+		// Check if this field has a relation-based expression
+		if rel, ok := relationExprs[fieldName]; ok {
+			if rel.selectExpr != rel.groupExpr {
+				// PostgreSQL requires non-grouped columns to be aggregated.
+				// Since we group by a unique ID/FK, MAX(name) returns the one name.
+				selectCols = append(selectCols, "MAX("+rel.selectExpr+`) AS "`+fieldName+`"`)
+			} else {
+				selectCols = append(selectCols, rel.selectExpr+` AS "`+fieldName+`"`)
+			}
+			groupCols = append(groupCols, rel.groupExpr)
+		} else {
+			selectExpr, groupExpr := tc.groupByFieldExprs(fieldName)
+			selectCols = append(selectCols, selectExpr+` AS "`+fieldName+`"`)
+			groupCols = append(groupCols, groupExpr)
+		}
+	}
+	return db, selectCols, groupCols
+}
+
+// aggregateSelectExpr returns the SELECT expression of one aggregate; running
+// totals are wrapped in their window over the GROUP BY date bucket.
+func (tc *translateContext) aggregateSelectExpr(agg AggregateFunc, gb *GroupByClause, groupCols []string) string {
+	expr, _ := tc.aggregateExpr(agg)
+	if agg.IsRunning() {
+		expr = runningTotalExpr(expr, groupCols, runningTotalBucket(gb, tc.entityType))
+	}
+	return expr
+}
+
 // buildGroupByAliasMap creates a mapping from all original GROUP BY field names
 // (including dropped aliases) to the surviving SELECT alias name. This ensures
 // ORDER BY on a dropped alias (e.g., "group" when "groups" survived) resolves
@@ -2225,12 +2382,7 @@ func (tc *translateContext) buildGroupByAliasMap(q *Query) map[string]string {
 	}
 	// Also map aggregate output keys to themselves
 	for _, agg := range q.GroupBy.Aggregates {
-		if agg.Field == nil {
-			aliasMap["count"] = "count"
-		} else {
-			key := strings.ToLower(agg.Name) + "_" + agg.Field.Name()
-			aliasMap[key] = key
-		}
+		aliasMap[agg.Key()] = agg.Key()
 	}
 	return aliasMap
 }
@@ -2371,6 +2523,11 @@ func (tc *translateContext) groupByRelationJoins(db *gorm.DB, fields []*FieldExp
 			// Names are not unique — group by the junction FK (identity) and display name.
 			exprMap[fieldName] = groupByRelExpr{selectExpr: relAlias + ".name", groupExpr: jtAlias + "." + rel.relatedCol}
 
+		case "series_id":
+			db = db.Joins(fmt.Sprintf("LEFT JOIN series _gb_series ON _gb_series.id = %s.series_id", tc.tableName))
+			// Series names are indexed but not unique — group by the FK.
+			exprMap[fieldName] = groupByRelExpr{selectExpr: "_gb_series.name", groupExpr: tc.tableName + ".series_id"}
+
 		case "parent_id":
 			// parent on groups — logical Column is "parent_id", actual DB column is owner_id
 			db = db.Joins(fmt.Sprintf("LEFT JOIN groups _gb_parent ON _gb_parent.id = %s.owner_id", tc.tableName))
@@ -2502,10 +2659,11 @@ func (tc *translateContext) buildHavingClause(node Node) (string, []interface{},
 
 // resolveHavingValue resolves a HAVING comparison value using the aggregate
 // field's definition, so size units convert to bytes for fileSize and date
-// values resolve through the relative-date/function resolvers.
+// values resolve through the relative-date/function resolvers. COUNT(DISTINCT)
+// is a plain number whatever the field's type.
 func (tc *translateContext) resolveHavingValue(hc *HavingComparison) (interface{}, error) {
 	fd := FieldDef{Type: FieldNumber}
-	if hc.Agg.Field != nil {
+	if hc.Agg.Field != nil && !hc.Agg.Distinct {
 		if f, ok := LookupField(tc.entityType, hc.Agg.Field.Name()); ok {
 			fd = f
 		}
@@ -2514,10 +2672,18 @@ func (tc *translateContext) resolveHavingValue(hc *HavingComparison) (interface{
 }
 
 // aggregateExpr returns the SQL aggregate expression and the output alias.
+// Running totals return their per-group value; buildAggregatedGroupByDB wraps
+// it in the window that accumulates it (see runningTotalExpr).
 func (tc *translateContext) aggregateExpr(agg AggregateFunc) (string, string) {
-	switch agg.Name {
-	case "COUNT":
-		return "COUNT(*)", "count"
+	switch {
+	case agg.Field == nil:
+		return "COUNT(*)", agg.Key()
+	case agg.Distinct:
+		return fmt.Sprintf("COUNT(DISTINCT %s)", tc.resolveAggregateColumn(agg.Field.Name(), false)), agg.Key()
+	case agg.Name == "MEDIAN":
+		return tc.percentileExpr(agg.Field.Name(), 0.5), agg.Key()
+	case agg.Name == "PERCENTILE":
+		return tc.percentileExpr(agg.Field.Name(), agg.Fraction), agg.Key()
 	default:
 		fieldName := agg.Field.Name()
 		// SUM/AVG on meta require numeric cast (non-numeric → NULL).
@@ -2525,11 +2691,99 @@ func (tc *translateContext) aggregateExpr(agg AggregateFunc) (string, string) {
 		// and numbers) but gives lexicographic order on PG for multi-digit numbers.
 		// This is the correct trade-off: casting would silently drop all string
 		// metadata from MIN/MAX, which is worse than imperfect numeric ordering.
-		needsNumericCast := (agg.Name == "SUM" || agg.Name == "AVG") && strings.HasPrefix(fieldName, "meta.")
+		name := strings.TrimPrefix(agg.Name, "RUNNING_")
+		needsNumericCast := (name == "SUM" || name == "AVG") && strings.HasPrefix(fieldName, "meta.")
 		col := tc.resolveAggregateColumn(fieldName, needsNumericCast)
-		alias := strings.ToLower(agg.Name) + "_" + fieldName
-		return fmt.Sprintf("%s(%s)", agg.Name, col), alias
+		return fmt.Sprintf("%s(%s)", name, col), agg.Key()
+	}
+}
+
+// minPercentileSQLiteVersion is the first SQLite release that accepts ORDER BY
+// inside an aggregate call, which the SQLite percentile emulation relies on.
+var minPercentileSQLiteVersion = [3]int{3, 44, 0}
+
+// checkPercentileSupport rejects MEDIAN and PERCENTILE on a SQLite older than
+// minPercentileSQLiteVersion, which would otherwise fail with a bare syntax
+// error. The bundled driver is newer; this guards builds that link the system
+// library instead.
+func (tc *translateContext) checkPercentileSupport(agg AggregateFunc) error {
+	if (agg.Name != "MEDIAN" && agg.Name != "PERCENTILE") || tc.isPostgres() {
+		return nil
+	}
+	if !tc.sqliteVersionKnown {
+		tc.sqliteVersionKnown = true
+		_ = tc.db.Raw("SELECT sqlite_version()").Scan(&tc.sqliteVersion).Error
+	}
+	if tc.sqliteVersion == "" || sqliteVersionAtLeast(tc.sqliteVersion, minPercentileSQLiteVersion) {
+		return nil
+	}
+	return &TranslateError{
+		Message: fmt.Sprintf("%s requires SQLite %d.%d or newer, but the database is SQLite %s",
+			agg.Name, minPercentileSQLiteVersion[0], minPercentileSQLiteVersion[1], tc.sqliteVersion),
+		Pos: agg.Token.Pos,
+	}
+}
+
+// sqliteVersionAtLeast compares a "major.minor.patch" version string against
+// min. Missing or malformed components count as 0.
+func sqliteVersionAtLeast(version string, min [3]int) bool {
+	parts := strings.SplitN(version, ".", 3)
+	for i := range min {
+		n := 0
+		if i < len(parts) {
+			n, _ = strconv.Atoi(parts[i])
+		}
+		if n != min[i] {
+			return n > min[i]
+		}
+	}
+	return true
+}
+
+// percentileExpr computes the continuous percentile of a numeric field: the
+// value at position fraction*(n-1) of the group's sorted non-NULL values,
+// interpolated linearly between its neighbours. Postgres has it natively as
+// percentile_cont. SQLite has no percentile aggregate, so the group's values
+// are collected into a sorted JSON array and the two neighbours read from it,
+// which yields the same result. The sorted array needs ORDER BY inside the
+// aggregate call, hence SQLite 3.44 or newer (see checkPercentileSupport).
+func (tc *translateContext) percentileExpr(fieldName string, fraction float64) string {
+	col := tc.resolveAggregateColumn(fieldName, true)
+	frac := strconv.FormatFloat(fraction, 'f', -1, 64)
+	if tc.isPostgres() {
+		return fmt.Sprintf("percentile_cont(%s) WITHIN GROUP (ORDER BY %s)", frac, col)
+	}
+	if strings.HasPrefix(fieldName, "meta.") {
+		// Match the Postgres numeric cast: non-numeric values are skipped.
+		segments := metaSubpathSegments(fieldName)
+		col = fmt.Sprintf("CASE WHEN %s THEN %s END", tc.metaTypeFilterOn(tc.tableName, segments), col)
+	}
+	sorted := fmt.Sprintf("json_group_array(%s ORDER BY %s) FILTER (WHERE %s IS NOT NULL)", col, col, col)
+	pos := fmt.Sprintf("((COUNT(%s) - 1) * %s)", col, frac)
+	lower := fmt.Sprintf("CAST(%s AS INTEGER)", pos)
+	upper := fmt.Sprintf("%s + (%s > %s)", lower, pos, lower)
+	at := func(index string) string {
+		return fmt.Sprintf("json_extract(%s, '$[' || (%s) || ']')", sorted, index)
+	}
+	return fmt.Sprintf("(%s + (%s - %s) * (%s - %s))", at(lower), pos, lower, at(upper), at(lower))
+}
+
+// runningTotalExpr accumulates a per-group aggregate along the GROUP BY date
+// bucket: a window over the grouped rows ordered by the bucket, restarting for
+// each combination of the other GROUP BY fields. NULL buckets sort last on
+// both dialects.
+func runningTotalExpr(perGroup string, groupCols []string, bucket int) string {
+	var partition []string
+	for i, col := range groupCols {
+		if i != bucket {
+			partition = append(partition, col)
+		}
+	}
+	over := "ORDER BY " + groupCols[bucket] + " NULLS LAST"
+	if len(partition) > 0 {
+		over = "PARTITION BY " + strings.Join(partition, ", ") + " " + over
 	}
+	return fmt.Sprintf("SUM(%s) OVER (%s)", perGroup, over)
 }
 
 // resolveAggregateColumn converts a field name to its SQL column expression.
@@ -48,11 +48,13 @@ func BuildGroupByKeys(q *Query, db *gorm.DB, opts TranslateOptions) (*gorm.DB, e
 
 	tc := newTranslateContext(db, entityType, q, opts)
 
-	result := db.Table(tc.tableName)
+	result, err := ApplyAsOf(q, db.Table(tc.tableName))
+	if err != nil {
+		return nil, err
+	}
 
 	// Apply WHERE clause
 	if q.Where != nil {
-		var err error
 		result, err = tc.translateNode(result, q.Where)
 		if err != nil {
 			return nil, err
@@ -125,11 +127,13 @@ func TranslateGroupByBucket(q *Query, db *gorm.DB, key map[string]any, opts Tran
 
 	tc := newTranslateContext(db, entityType, q, opts)
 
-	result := db.Table(tc.tableName)
+	result, err := ApplyAsOf(q, db.Table(tc.tableName))
+	if err != nil {
+		return nil, err
+	}
 
 	// Apply WHERE clause from the original query
 	if q.Where != nil {
-		var err error
 		result, err = tc.translateNode(result, q.Where)
 		if err != nil {
 			return nil, err
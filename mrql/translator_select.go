@@ -0,0 +1,271 @@
+package mrql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// BuildProjection composes a SELECT projection (one row per matching entity,
+// one column per SELECT column, then ORDER BY, LIMIT and OFFSET) as a
+// *gorm.DB without executing it. Rows are keyed by SelectColumn.Name.
+//
+// Single references (owner, parent, series, currentVersion and owner/parent
+// chains) are LEFT JOINed once per path, so an entity without one projects
+// NULL instead of dropping out. Counts are correlated subqueries, as in ORDER
+// BY. Division is done in floating point and yields NULL for a zero divisor.
+func BuildProjection(q *Query, db *gorm.DB, opts TranslateOptions) (*gorm.DB, error) {
+	if q.Select == nil {
+		return nil, &TranslateError{Message: "BuildProjection requires a SELECT clause", Pos: 0}
+	}
+	entityType := q.EntityType
+	if entityType == EntityUnspecified {
+		entityType = ExtractEntityType(q)
+	}
+	if entityType == EntityUnspecified {
+		return nil, &TranslateError{Message: "entity type is required for SELECT", Pos: 0}
+	}
+
+	tc := newTranslateContext(db, entityType, q, opts)
+	result, err := ApplyAsOf(q, db.Table(tc.tableName))
+	if err != nil {
+		return nil, err
+	}
+
+	if q.Where != nil {
+		result, err = tc.translateNode(result, q.Where)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if opts.ScopeGroupID > 0 {
+		result = applyScopeCTEOn(result, entityType, tc.tableName, opts.ScopeGroupID)
+	}
+
+	p := &projection{tc: tc, db: result, aliases: make(map[string]string)}
+	cols := make([]string, len(q.Select.Columns))
+	for i, col := range q.Select.Columns {
+		expr, err := p.expr(col.Expr, false)
+		if err != nil {
+			return nil, err
+		}
+		cols[i] = expr + " AS " + quoteIdentifier(col.Name())
+	}
+	result = p.db.Select(strings.Join(cols, ", "))
+
+	for _, ob := range q.OrderBy {
+		if ob.Random {
+			result = result.Order("RANDOM()")
+			continue
+		}
+		col := quoteIdentifier(ob.Field.Name())
+		if !q.Select.HasColumn(ob.Field.Name()) {
+			var err error
+			if col, err = tc.resolveOrderByColumn(ob.Field); err != nil {
+				return nil, err
+			}
+			if col == "" {
+				continue
+			}
+		}
+		direction := "ASC"
+		if !ob.Ascending {
+			direction = "DESC"
+		}
+		result = result.Order(col + " " + direction)
+	}
+	// The primary key breaks ties so LIMIT/OFFSET pages are stable.
+	result = result.Order(tc.qualifiedColumn("id") + " ASC")
+
+	if q.Limit >= 0 {
+		result = result.Limit(q.Limit)
+	}
+	if q.Offset >= 0 {
+		result = result.Offset(q.Offset)
+	}
+	return result, nil
+}
+
+// projection accumulates the JOINs a SELECT list needs. aliases maps a
+// reference path (owner, owner.parent, series) to its joined table's alias,
+// so columns sharing a path share one JOIN.
+type projection struct {
+	tc      *translateContext
+	db      *gorm.DB
+	aliases map[string]string
+}
+
+// expr renders one SELECT column expression. numeric is true for arithmetic
+// operands, where meta values are read as numbers.
+func (p *projection) expr(n Node, numeric bool) (string, error) {
+	switch n := n.(type) {
+	case *NumberLiteral:
+		if n.Unit != "" {
+			return strconv.FormatInt(n.Raw, 10), nil
+		}
+		return strconv.FormatFloat(n.Value, 'f', -1, 64), nil
+	case *ArithExpr:
+		left, err := p.expr(n.Left, true)
+		if err != nil {
+			return "", err
+		}
+		right, err := p.expr(n.Right, true)
+		if err != nil {
+			return "", err
+		}
+		if n.Operator.Type == TokenSlash {
+			floatType := "REAL"
+			if p.tc.isPostgres() {
+				floatType = "DOUBLE PRECISION"
+			}
+			return fmt.Sprintf("(CAST(%s AS %s) / NULLIF(%s, 0))", left, floatType, right), nil
+		}
+		return "(" + left + " " + arithOperatorText(n.Operator.Type) + " " + right + ")", nil
+	case *FieldExpr:
+		return p.field(n, numeric)
+	case *ScalarCall:
+		expr, ok, err := p.tc.scalarCallExpr(n)
+		if err == nil && !ok {
+			err = &TranslateError{Message: fmt.Sprintf("unknown field %q", n.Field.Name()), Pos: n.Field.Pos()}
+		}
+		return expr, err
+	}
+	return "", &TranslateError{Message: "invalid SELECT column", Pos: n.Pos()}
+}
+
+// field renders a projected field.
+func (p *projection) field(f *FieldExpr, numeric bool) (string, error) {
+	tc := p.tc
+	root := f.Parts[0].Value
+
+	if root == "meta" {
+		return p.meta(tc.tableName, f.Parts[1:], numeric)
+	}
+	if isCountField(f, tc.entityType) || isDateBucketField(f, tc.entityType) {
+		return tc.resolveOrderByColumn(f)
+	}
+
+	if len(f.Parts) == 1 {
+		fd, ok := LookupField(tc.entityType, root)
+		if !ok {
+			return "", &TranslateError{Message: fmt.Sprintf("unknown field %q", root), Pos: f.Pos()}
+		}
+		if fd.Type != FieldRelation {
+			return tc.qualifiedColumn(fd.Column), nil
+		}
+		// A bare single reference shows the referenced row's name.
+		alias, err := p.reference(root)
+		if err != nil {
+			return "", err
+		}
+		return alias + ".name", nil
+	}
+
+	if rel, ok := tc.relatedRootFor(f); ok {
+		alias, err := p.reference(root)
+		if err != nil {
+			return "", err
+		}
+		if f.Parts[1].Value == "meta" {
+			return p.meta(alias, f.Parts[2:], numeric)
+		}
+		fd, _ := rel.leaf(f.Parts[1].Value)
+		return alias + "." + fd.Column, nil
+	}
+
+	// Group chain: owner.name, parent.parent.meta.x.
+	for i := 1; i < len(f.Parts); i++ {
+		if f.Parts[i].Value == "meta" {
+			alias, err := p.chain(f.Parts[:i])
+			if err != nil {
+				return "", err
+			}
+			return p.meta(alias, f.Parts[i+1:], numeric)
+		}
+	}
+	fd, _ := LookupField(EntityGroup, f.Parts[len(f.Parts)-1].Value)
+	if fd.Type == FieldRelation {
+		// A chain ending in a reference (owner.parent) shows its name.
+		alias, err := p.chain(f.Parts)
+		if err != nil {
+			return "", err
+		}
+		return alias + ".name", nil
+	}
+	alias, err := p.chain(f.Parts[:len(f.Parts)-1])
+	if err != nil {
+		return "", err
+	}
+	return alias + "." + fd.Column, nil
+}
+
+// meta renders a meta subpath on alias. As an arithmetic operand it is the
+// JSON number, or NULL for any other JSON type.
+func (p *projection) meta(alias string, parts []Token, numeric bool) (string, error) {
+	segments := make([]string, len(parts))
+	for i, part := range parts {
+		segments[i] = part.Value
+	}
+	if err := validateMetaSegments(segments); err != nil {
+		return "", err
+	}
+	tc := p.tc
+	if !numeric {
+		return tc.metaJsonExprOn(alias, segments), nil
+	}
+	if tc.isPostgres() {
+		return tc.metaNumericExprOn(alias, segments), nil
+	}
+	return fmt.Sprintf("CASE WHEN %s THEN %s END", tc.metaTypeFilterOn(alias, segments), tc.metaNumericExprOn(alias, segments)), nil
+}
+
+// reference joins the single reference name (owner, parent, series,
+// currentVersion) of the queried entity and returns the joined alias.
+func (p *projection) reference(name string) (string, error) {
+	switch name {
+	case "owner", "parent":
+		return p.chain([]Token{{Value: name}})
+	case "series":
+		return p.join(name, "series", p.tc.qualifiedColumn("series_id")), nil
+	case "currentVersion":
+		return p.join(name, "resource_versions", p.tc.qualifiedColumn("current_version_id")), nil
+	}
+	return "", &TranslateError{Message: fmt.Sprintf("%s is not a single reference", name), Pos: 0}
+}
+
+// chain joins each group along an owner/parent path and returns the last
+// group's alias. Every step follows owner_id: a resource's or note's owner,
+// and a group's parent.
+func (p *projection) chain(steps []Token) (string, error) {
+	prev := p.tc.tableName
+	for i, step := range steps {
+		if step.Value != "owner" && step.Value != "parent" {
+			return "", &TranslateError{Message: fmt.Sprintf("%s cannot appear in a SELECT column path", step.Value), Pos: step.Pos}
+		}
+		path := make([]string, i+1)
+		for j := range path {
+			path[j] = steps[j].Value
+		}
+		prev = p.join(strings.Join(path, "."), "groups", prev+".owner_id")
+	}
+	return prev, nil
+}
+
+// join LEFT JOINs table on table.id = fk once per path and returns its alias.
+func (p *projection) join(path, table, fk string) string {
+	if alias, ok := p.aliases[path]; ok {
+		return alias
+	}
+	alias := fmt.Sprintf("_sel_%d", len(p.aliases))
+	p.db = p.db.Joins(fmt.Sprintf("LEFT JOIN %s %s ON %s.id = %s", table, alias, alias, fk))
+	p.aliases[path] = alias
+	return alias
+}
+
+// quoteIdentifier double-quotes a column alias for both SQLite and
+// PostgreSQL, doubling any embedded quote.
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
@@ -1,6 +1,7 @@
 package mrql
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
@@ -60,9 +61,12 @@ type testResource struct {
 	Width        uint
 	Height       uint
 	Hash         string
+	LegacyHash   *string
 	OriginalName string
 	Meta         string `gorm:"type:JSON"`
 	OwnerID      *uint  `gorm:"index"`
+	// StorageLocation names the alt filesystem holding the file.
+	StorageLocation *string
 }
 
 func (testResource) TableName() string { return "resources" }
@@ -507,6 +511,35 @@ func TestTranslateIsNull(t *testing.T) {
 	// Let's accept whatever count we get — this test validates no SQL errors.
 }
 
+func TestTranslateHashMatchesEitherAlgorithm(t *testing.T) {
+	db := setupTestDB(t)
+	db.Exec("UPDATE resources SET hash = 'sha256-one', legacy_hash = 'sha1-one' WHERE id = 1")
+	db.Exec("UPDATE resources SET hash = 'sha1-two' WHERE id = 2")
+
+	tests := []struct {
+		query string
+		want  []uint
+	}{
+		{`hash = "sha256-one"`, []uint{1}},
+		{`hash = "SHA1-ONE"`, []uint{1}},
+		{`hash = "sha1-two"`, []uint{2}},
+		// legacy_hash is NULL on the rows the migration never touched; != must
+		// still return them.
+		{`hash != "sha1-one"`, []uint{2, 3, 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			var ids []uint
+			if err := parseAndTranslate(t, tt.query, EntityResource, db).Order("id").Pluck("id", &ids).Error; err != nil {
+				t.Fatalf("query error: %v", err)
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(tt.want) {
+				t.Errorf("got %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
 func TestTranslateNumberComparison(t *testing.T) {
 	db := setupTestDB(t)
 
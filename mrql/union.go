@@ -0,0 +1,273 @@
+package mrql
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UnionEntityTypes lists the branches of a cross-entity query, in the order
+// they appear in the UNION ALL.
+var UnionEntityTypes = []EntityType{EntityResource, EntityNote, EntityGroup}
+
+// unionAlias names the derived table that wraps the UNION ALL.
+const unionAlias = "mrql_union"
+
+// UnionRow is one row of a cross-entity result: the entity type it came from
+// ("resource", "note" or "group") and its primary key. The union carries no
+// other entity columns — their shapes differ per table — so callers hydrate the
+// typed models by ID and keep the union's order.
+type UnionRow struct {
+	EntityType string
+	ID         uint
+	// Keys holds the row's ORDER BY values for a keyset query, as
+	// UnionRowsFromMaps read them from the union's sort columns.
+	Keys []any `gorm:"-"`
+}
+
+// TranslateUnion translates a query without a `type =` filter into a single
+// statement: one SELECT per entity table, combined with UNION ALL, sorted by
+// one shared ORDER BY and paginated by one LIMIT/OFFSET. The result rows are
+// UnionRow values; scan them into maps and convert with UnionRowsFromMaps to
+// keep the projected sort columns as well.
+//
+// Each branch translates the WHERE clause for its own entity, so a field that
+// exists on only some entities matches nothing on the others. A branch that
+// fails with a TranslateError is left out of the union and reported in the
+// returned warnings, so a partial result never looks complete; the error is
+// returned only when no branch remains.
+//
+// Every ORDER BY key is projected per branch as its own column using the
+// branch's sort expression (RANK included, which is each table's own FTS
+// relevance), and the outer ORDER BY sorts on those columns. Rows tied on every
+// key fall back to entity type and ID so pages never overlap. q.After resumes
+// from a cursor on the same columns; q.Keyset needs nothing extra here because
+// that tiebreak is always present.
+func TranslateUnion(q *Query, db *gorm.DB, opts TranslateOptions) (*gorm.DB, []string, error) {
+	var (
+		branches []any
+		warnings []string
+		firstErr error
+	)
+	for _, et := range UnionEntityTypes {
+		branch, err := translateUnionBranch(q, db, et, opts)
+		if err != nil {
+			var translateErr *TranslateError
+			if !errors.As(err, &translateErr) {
+				return nil, nil, err
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+			warnings = append(warnings, fmt.Sprintf("%ss are not included: %s", et, translateErr.Message))
+			continue
+		}
+		branches = append(branches, branch)
+	}
+	if len(branches) == 0 {
+		return nil, nil, firstErr
+	}
+
+	union := strings.TrimSuffix(strings.Repeat("? UNION ALL ", len(branches)), " UNION ALL ")
+	columns := []string{unionAlias + ".entity_type", unionAlias + ".id"}
+	for i, ob := range q.OrderBy {
+		if !ob.Random {
+			columns = append(columns, unionAlias+"."+unionSortColumn(i))
+		}
+	}
+	result, err := ApplyAsOf(q, db.Table("("+union+") AS "+unionAlias, branches...).
+		Select(strings.Join(columns, ", ")))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i, ob := range q.OrderBy {
+		if ob.Random {
+			result = result.Order("RANDOM()")
+			continue
+		}
+		direction := "ASC"
+		if !ob.Ascending {
+			direction = "DESC"
+		}
+		result = result.Order(unionAlias + "." + unionSortColumn(i) + " " + direction)
+	}
+	result = result.Order(unionAlias + ".entity_type ASC").Order(unionAlias + ".id ASC")
+
+	if q.After != nil {
+		cond, args, err := unionKeysetAfter(q)
+		if err != nil {
+			return nil, nil, err
+		}
+		result = result.Where(cond, args...)
+	}
+
+	if q.Limit >= 0 {
+		result = result.Limit(q.Limit)
+	}
+	if q.Offset >= 0 && q.After == nil {
+		result = result.Offset(q.Offset)
+	}
+	return result, warnings, nil
+}
+
+// translateUnionBranch builds one entity's SELECT for TranslateUnion: the
+// query's WHERE and scope for that entity, no ORDER BY or pagination, and a
+// projection of entity_type, id, and one column per ORDER BY key.
+func translateUnionBranch(q *Query, db *gorm.DB, entityType EntityType, opts TranslateOptions) (*gorm.DB, error) {
+	branch := *q
+	branch.EntityType = entityType
+	branch.OrderBy = nil
+	branch.Limit = -1
+	branch.Offset = -1
+	branch.Keyset = false
+	branch.After = nil
+	// A compound SELECT member cannot carry its own WITH; TranslateUnion puts
+	// the AS OF CTEs in front of the whole union instead.
+	branch.AsOf = nil
+
+	built, err := TranslateWithOptions(&branch, db, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	tc := newTranslateContext(db, entityType, q, opts)
+	columns := []string{
+		fmt.Sprintf("'%s' AS entity_type", entityType),
+		tc.qualifiedColumn("id") + " AS id",
+	}
+	for i, ob := range q.OrderBy {
+		if ob.Random {
+			continue
+		}
+		expr, err := tc.resolveOrderByColumn(ob.Field)
+		if err != nil {
+			return nil, err
+		}
+		if expr == "" {
+			// A rank key whose term drops orders nothing, as in a single-entity
+			// query; a constant keeps the column list identical across branches.
+			expr = "0"
+		}
+		columns = append(columns, expr+" AS "+unionSortColumn(i))
+	}
+	return built.Select(strings.Join(columns, ", ")), nil
+}
+
+// unionKeysetAfter builds the WHERE predicate that resumes a cross-entity
+// query after q.After, over the projected sort columns and the union's own
+// entity type and ID tiebreak.
+func unionKeysetAfter(q *Query) (string, []any, error) {
+	if q.After.EntityType == "" {
+		return "", nil, &CursorError{Message: "cursor belongs to a single-entity query; restart from the first page"}
+	}
+	exprs := make([]string, len(q.OrderBy))
+	for i := range q.OrderBy {
+		exprs[i] = unionAlias + "." + unionSortColumn(i)
+	}
+	terms, err := keysetTerms(q, exprs)
+	if err != nil {
+		return "", nil, err
+	}
+	terms = append(terms,
+		keysetTerm{expr: unionAlias + ".entity_type", ascending: true, value: q.After.EntityType},
+		keysetTerm{expr: unionAlias + ".id", ascending: true, value: q.After.ID},
+	)
+	cond, args := keysetCondition(terms)
+	return cond, args, nil
+}
+
+// UnionRowsFromMaps converts the rows of a TranslateUnion statement scanned
+// into maps. For a keyset query each row also carries its sort column values
+// in Keys, typed the way NewCursor expects, so the next page's cursor comes
+// from the union's own last row rather than from a reloaded model.
+func UnionRowsFromMaps(q *Query, raw []map[string]any) ([]UnionRow, error) {
+	var fields []FieldDef
+	if q.Keyset {
+		var err error
+		if fields, err = KeysetFields(q); err != nil {
+			return nil, err
+		}
+	}
+	rows := make([]UnionRow, len(raw))
+	for i, m := range raw {
+		id, err := unionRowID(unionValue(m["id"]))
+		if err != nil {
+			return nil, err
+		}
+		rows[i] = UnionRow{EntityType: fmt.Sprint(unionValue(m["entity_type"])), ID: id}
+		for k, fd := range fields {
+			key, err := unionSortKey(fd, unionValue(m[unionSortColumn(k)]))
+			if err != nil {
+				return nil, err
+			}
+			rows[i].Keys = append(rows[i].Keys, key)
+		}
+	}
+	return rows, nil
+}
+
+// unionTimeLayouts are the text forms a datetime sort column can come back
+// in: SQLite loses the column's declared type through the UNION and returns
+// the stored text, which GORM writes in the first layout without the T.
+var unionTimeLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+}
+
+func unionRowID(v any) (uint, error) {
+	switch n := v.(type) {
+	case int64:
+		return uint(n), nil
+	case int32:
+		return uint(n), nil
+	case int:
+		return uint(n), nil
+	case uint:
+		return n, nil
+	case uint64:
+		return uint(n), nil
+	}
+	return 0, fmt.Errorf("cross-entity union: unexpected id %v (%T)", v, v)
+}
+
+// unionValue unwraps a scanned map value. GORM scans a column without a
+// declared type, such as the union's literal entity_type, as *any, and
+// drivers may return text as []byte.
+func unionValue(v any) any {
+	if p, ok := v.(*any); ok && p != nil {
+		v = *p
+	}
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return v
+}
+
+// unionSortKey normalises one sort column value for NewCursor.
+func unionSortKey(fd FieldDef, v any) (any, error) {
+	if fd.Type != FieldDateTime {
+		return v, nil
+	}
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case string:
+		for _, layout := range unionTimeLayouts {
+			if parsed, err := time.Parse(layout, t); err == nil {
+				return parsed, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("cross-entity union: unexpected %s value %v (%T)", fd.Name, v, v)
+}
+
+// unionSortColumn names the projected column for the i-th ORDER BY key.
+func unionSortColumn(i int) string {
+	return fmt.Sprintf("sort_%d", i)
+}
@@ -0,0 +1,42 @@
+//go:build postgres
+
+package mrql
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUnionOrderByCreatedInterleavesPG(t *testing.T) {
+	db := setupPostgresTestDB(t)
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, stamp := range []struct {
+		table string
+		id    uint
+		hours int
+	}{
+		{"resources", 1, 5},
+		{"notes", 1, 4},
+		{"groups", 3, 3},
+		{"resources", 3, 2},
+	} {
+		if err := db.Exec("UPDATE "+stamp.table+" SET created_at = ? WHERE id = ?", base.Add(time.Duration(stamp.hours)*time.Hour), stamp.id).Error; err != nil {
+			t.Fatalf("stamp: %v", err)
+		}
+	}
+	got := unionRows(t, db, `created < "2025-01-01" ORDER BY created DESC LIMIT 3 OFFSET 1`, TranslateOptions{})
+	want := []string{"note:1", "group:3", "resource:3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestUnionDefaultOrderIsStablePG(t *testing.T) {
+	db := setupPostgresTestDB(t)
+	got := unionRows(t, db, `tags = "document"`, TranslateOptions{})
+	want := []string{"group:2", "note:1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
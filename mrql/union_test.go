@@ -0,0 +1,153 @@
+package mrql
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// unionRows validates input as a cross-entity query, translates it with
+// TranslateUnion and returns the rows as "type:id" strings in result order.
+func unionRows(t *testing.T, db *gorm.DB, input string, opts TranslateOptions) []string {
+	t.Helper()
+	q := mustParse(t, input)
+	if err := Validate(q); err != nil {
+		t.Fatalf("Validate(%q): %v", input, err)
+	}
+	built, _, err := TranslateUnion(q, db, opts)
+	if err != nil {
+		t.Fatalf("TranslateUnion(%q): %v", input, err)
+	}
+	var rows []UnionRow
+	if err := built.Find(&rows).Error; err != nil {
+		t.Fatalf("query %q: %v", input, err)
+	}
+	out := make([]string, len(rows))
+	for i, r := range rows {
+		out[i] = fmt.Sprintf("%s:%d", r.EntityType, r.ID)
+	}
+	return out
+}
+
+func TestUnionOrderByNameAcrossEntities(t *testing.T) {
+	db := setupTestDB(t)
+	// Matching names in global order: Meeting notes, Photos, Sub-Work,
+	// Todo list, Vacation, Work, photo_album.png, report.pdf.
+	got := unionRows(t, db, `name ~ "o" ORDER BY name LIMIT 3 OFFSET 2`, TranslateOptions{})
+	want := []string{"group:4", "note:2", "group:1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+// One ORDER BY spans all three tables: the newest rows interleave regardless
+// of which entity they belong to.
+func TestUnionOrderByCreatedInterleaves(t *testing.T) {
+	db := setupTestDB(t)
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, stamp := range []struct {
+		table string
+		id    uint
+		hours int
+	}{
+		{"resources", 1, 5},
+		{"notes", 1, 4},
+		{"groups", 3, 3},
+		{"resources", 3, 2},
+		{"notes", 2, 1},
+	} {
+		if err := db.Exec("UPDATE "+stamp.table+" SET created_at = ? WHERE id = ?", base.Add(time.Duration(stamp.hours)*time.Hour), stamp.id).Error; err != nil {
+			t.Fatalf("stamp: %v", err)
+		}
+	}
+	got := unionRows(t, db, `created < "2025-01-01" ORDER BY created DESC LIMIT 4`, TranslateOptions{})
+	want := []string{"resource:1", "note:1", "group:3", "resource:3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+// Without ORDER BY the union is still deterministic: entity type, then ID.
+func TestUnionDefaultOrderIsStable(t *testing.T) {
+	db := setupTestDB(t)
+	got := unionRows(t, db, `name ~ "work"`, TranslateOptions{})
+	want := []string{"group:2", "group:4"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	got = unionRows(t, db, `name ~ "o" LIMIT 2 OFFSET 1`, TranslateOptions{})
+	want = []string{"group:2", "group:4"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+// A field that exists on only some entities matches nothing on the others.
+func TestUnionEntitySpecificFieldBranch(t *testing.T) {
+	db := setupTestDB(t)
+	got := unionRows(t, db, `tags = "document"`, TranslateOptions{})
+	want := []string{"group:2", "note:1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestUnionRespectsScope(t *testing.T) {
+	db := setupTestDB(t)
+	if err := db.Exec("UPDATE notes SET owner_id = 2 WHERE id = 2").Error; err != nil {
+		t.Fatalf("seed owner: %v", err)
+	}
+	// Scope 2 = {Work, Sub-Work}: the groups themselves plus what they own.
+	got := unionRows(t, db, `name ~ "*" ORDER BY name`, TranslateOptions{ScopeGroupID: 2})
+	want := []string{"group:4", "note:2", "group:2", "resource:3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestUnionOrderByRandomIsSingleStatement(t *testing.T) {
+	db := setupTestDB(t)
+	q := mustParse(t, `name ~ "o" ORDER BY RANDOM() LIMIT 3`)
+	if err := Validate(q); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	built, _, err := TranslateUnion(q, db, TranslateOptions{})
+	if err != nil {
+		t.Fatalf("TranslateUnion: %v", err)
+	}
+	sql := strings.ToUpper(ExplainDB(built, "union", &[]UnionRow{}).SQL)
+	if strings.Count(sql, "UNION ALL") != 2 {
+		t.Fatalf("expected three branches, got SQL %s", sql)
+	}
+	if !strings.Contains(sql, "ORDER BY RANDOM()") || strings.Count(sql, "LIMIT") != 1 {
+		t.Fatalf("expected one shared RANDOM() order and LIMIT, got SQL %s", sql)
+	}
+	var rows []UnionRow
+	if err := built.Find(&rows).Error; err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 rows, got %d", len(rows))
+	}
+}
+
+// A branch that cannot translate is left out of the union and named in the
+// warnings instead of silently shrinking the result.
+func TestUnionReportsDroppedBranches(t *testing.T) {
+	db := setupTestDB(t)
+	q := mustParse(t, `parent IN ("Work")`)
+	built, warnings, err := TranslateUnion(q, db, TranslateOptions{})
+	if err != nil {
+		t.Fatalf("TranslateUnion: %v", err)
+	}
+	if built == nil {
+		t.Fatal("expected the remaining branches to translate")
+	}
+	if len(warnings) != 1 || !strings.HasPrefix(warnings[0], "groups are not included: ") {
+		t.Fatalf("expected one warning for the group branch, got %q", warnings)
+	}
+}
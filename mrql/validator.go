@@ -35,7 +35,8 @@ var traversalIntermediates = map[string]bool{
 
 // countableRelation returns the FieldDef for fieldName if it is a relation on
 // entityType that supports the .count pseudo-field: junction-backed relations
-// (tags, groups/group, notes, resources) plus children on group.
+// (tags, groups/group, notes, resources), children on group, and the
+// set-valued related roots (versions, blocks, relations, backRelations).
 func countableRelation(entityType EntityType, fieldName string) (FieldDef, bool) {
 	fd, ok := LookupField(entityType, fieldName)
 	if !ok || fd.Type != FieldRelation {
@@ -47,12 +48,28 @@ func countableRelation(entityType EntityType, fieldName string) (FieldDef, bool)
 	if fd.Column == "children" {
 		return fd, true
 	}
+	if root, isRelated := relatedRoots[fieldName]; isRelated && !root.singleReference() {
+		return fd, true
+	}
 	return FieldDef{}, false
 }
 
+// isSingleReference reports whether fd is a relation backed by one nullable FK
+// column (owner, parent, series, currentVersion) rather than a set of rows.
+func isSingleReference(fd FieldDef) bool {
+	switch fd.Column {
+	case "owner_id", "parent_id", "series_id", "current_version_id":
+		return true
+	}
+	return false
+}
+
 // isCountField returns true if f is a valid <relation>.count pseudo-field for
-// the given entity type.
+// the given entity type, or a note's todos.count / todos.open.count.
 func isCountField(f *FieldExpr, entityType EntityType) bool {
+	if isBlockCountField(f) {
+		return entityType == EntityNote
+	}
 	if len(f.Parts) != 2 || f.Parts[1].Value != "count" {
 		return false
 	}
@@ -114,6 +131,7 @@ func isTraversalRoot(fieldName string, entityType EntityType) bool {
 // constructs ParseFilter forbids beyond the clause keywords the parser already
 // catches: the `type` pseudo-field (implied by the page) and `$name` parameter
 // placeholders (bar queries must be self-contained). Positions match the input.
+// An IN sub-query keeps its `type =` selector but not its placeholders.
 func rejectFilterConstructs(node Node) error {
 	switch n := node.(type) {
 	case *BinaryExpr:
@@ -141,6 +159,20 @@ func rejectFilterConstructs(node Node) error {
 		if isTypeField(n.Field) {
 			return filterTypeFieldError(n.Field)
 		}
+	case *ScalarComparisonExpr:
+		if _, isCall := n.Right.(*ScalarCall); !isCall {
+			return rejectParamValue(n.Right)
+		}
+	case *SubqueryInExpr:
+		// The sub-select's own `type =` names the inner entity, not the page's,
+		// so only placeholders are rejected inside it.
+		var err error
+		walkExprValues(n.Where, func(v *Node) {
+			if err == nil {
+				err = rejectParamValue(*v)
+			}
+		})
+		return err
 	}
 	return nil
 }
@@ -207,13 +239,18 @@ func Validate(q *Query) error {
 			}
 			continue
 		}
+		// A SELECT column name (an alias such as mb, or a projected field such
+		// as owner.name) orders by the column's value.
+		if q.Select != nil && q.Select.HasColumn(ob.Field.Name()) {
+			continue
+		}
 		// "rank" is the full-text relevance sort key (context-sensitive, like
 		// distance). No entity has a real rank column, so it always means the
 		// relevance key here; validateRankOrderKey enforces the TEXT ~ predicate
 		// and rejects GROUP BY with a specific message (checked before the
 		// aggregated-mode ORDER BY path so the message is stable in both modes).
 		if len(ob.Field.Parts) == 1 && strings.EqualFold(ob.Field.Parts[0].Value, "rank") {
-			if err := validateRankOrderKey(q, entityType, ob.Field); err != nil {
+			if err := validateRankOrderKey(q, ob.Field); err != nil {
 				return err
 			}
 			continue
@@ -241,6 +278,12 @@ func Validate(q *Query) error {
 		}
 	}
 
+	if q.Select != nil {
+		if err := validateSelect(q, entityType); err != nil {
+			return err
+		}
+	}
+
 	// Validate GROUP BY clause
 	if q.GroupBy != nil {
 		if err := validateGroupBy(q.GroupBy, entityType, q.OrderBy); err != nil {
@@ -248,6 +291,18 @@ func Validate(q *Query) error {
 		}
 	}
 
+	if q.Mutation != nil {
+		if err := validateMutation(q, entityType); err != nil {
+			return err
+		}
+	}
+
+	if q.AsOf != nil {
+		if err := validateAsOf(q); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -287,19 +342,13 @@ func validateDistanceOrderKey(q *Query, entityType EntityType, f *FieldExpr) err
 	}
 }
 
-// validateRankOrderKey validates ORDER BY RANK: a determined single entity type,
-// no GROUP BY, and exactly one TEXT ~ predicate in the WHERE clause (its term
-// defines the relevance). Mirrors validateDistanceOrderKey. Cross-entity is
-// rejected because bm25/ts_rank scores are not comparable across corpora.
-func validateRankOrderKey(q *Query, entityType EntityType, f *FieldExpr) error {
+// validateRankOrderKey validates ORDER BY RANK: no GROUP BY and exactly one
+// TEXT ~ predicate in the WHERE clause (its term defines the relevance).
+// Mirrors validateDistanceOrderKey. Cross-entity queries are accepted: the
+// UNION ALL translation ranks each branch against its own table's index and
+// sorts the branches' scores together.
+func validateRankOrderKey(q *Query, f *FieldExpr) error {
 	rankLen := len(f.Name())
-	if entityType == EntityUnspecified {
-		return &ValidationError{
-			Message: "ORDER BY RANK requires a single entity type (add a type = ... filter)",
-			Pos:     f.Pos(),
-			Length:  rankLen,
-		}
-	}
 	if q.GroupBy != nil {
 		return &ValidationError{
 			Message: "ORDER BY RANK is not supported with GROUP BY",
@@ -344,13 +393,19 @@ func validateRegexTraversalLeaf(n *ComparisonExpr) error {
 		}
 	}
 	root := parts[0].Value
-	if !recursiveRoots[root] {
-		if _, ok := traversalRoots[root]; !ok {
-			return nil
+	leaf := parts[len(parts)-1].Value
+	var fd FieldDef
+	var ok bool
+	if related, isRelated := relatedRoots[root]; isRelated {
+		fd, ok = related.leaf(leaf)
+	} else {
+		if !recursiveRoots[root] {
+			if _, ok := traversalRoots[root]; !ok {
+				return nil
+			}
 		}
+		fd, ok = LookupField(EntityGroup, leaf)
 	}
-	leaf := parts[len(parts)-1].Value
-	fd, ok := LookupField(EntityGroup, leaf)
 	if !ok {
 		return nil // unknown leaves are caught by the chain validators
 	}
@@ -533,6 +588,14 @@ func validateNode(node Node, entityType EntityType) error {
 						Length:  n.Operator.Length,
 					}
 				}
+				// Versions have no name to compare the root against.
+				if root, isRelated := relatedRoots[fieldName]; isRelated && root.nameLeaf == "" {
+					return &ValidationError{
+						Message: fmt.Sprintf("%s cannot be compared directly; compare one of its fields (e.g. %s.comment = \"...\") or use %s.count", fieldName, fieldName, fieldName),
+						Pos:     n.Field.Pos(),
+						Length:  len(fieldName),
+					}
+				}
 			}
 		}
 		// Regex match (~*/!~*): PostgreSQL-only (dialect enforced at translation),
@@ -593,7 +656,7 @@ func validateNode(node Node, entityType EntityType) error {
 		// Reject traversal IN (multi-part chains like parent.name, owner.tags, etc.)
 		if len(n.Field.Parts) >= 2 {
 			prefix := n.Field.Parts[0].Value
-			if recursiveRoots[prefix] {
+			if recursiveRoots[prefix] || isRelatedField(n.Field) {
 				return &ValidationError{
 					Message: fmt.Sprintf("%s does not support IN operator; use = or != instead", n.Field.Name()),
 					Pos:     n.Field.Pos(),
@@ -618,7 +681,7 @@ func validateNode(node Node, entityType EntityType) error {
 		// Reject bare parent/children/owner IN — translator only supports tags/groups IN
 		if len(n.Field.Parts) == 1 {
 			fieldName := n.Field.Parts[0].Value
-			if fieldName == "parent" || fieldName == "children" || fieldName == "owner" {
+			if fieldName == "parent" || fieldName == "children" || fieldName == "owner" || isRelatedField(n.Field) {
 				return &ValidationError{
 					Message: fmt.Sprintf("%s does not support IN operator; use %s = \"...\" or %s IS EMPTY instead", fieldName, fieldName, fieldName),
 					Pos:     n.Field.Pos(),
@@ -628,6 +691,12 @@ func validateNode(node Node, entityType EntityType) error {
 		}
 		return validateFieldExpr(n.Field, entityType)
 
+	case *ScalarComparisonExpr:
+		return validateScalarComparison(n, entityType)
+
+	case *SubqueryInExpr:
+		return validateSubqueryIn(n, entityType)
+
 	case *IsExpr:
 		// Count pseudo-fields do not support IS EMPTY / IS NULL.
 		if isCountField(n.Field, entityType) {
@@ -642,6 +711,16 @@ func validateNode(node Node, entityType EntityType) error {
 				Length:  len(n.Field.Name()),
 			}
 		}
+		// Related root leaves (series.name, versions.comment) are existential
+		// comparisons too; emptiness is checked on the root itself.
+		if isRelatedLeafPath(n.Field) {
+			root := n.Field.Parts[0].Value
+			return &ValidationError{
+				Message: fmt.Sprintf("%s does not support IS EMPTY/IS NULL; use %s IS EMPTY or compare the field instead", n.Field.Name(), root),
+				Pos:     n.Field.Pos(),
+				Length:  len(n.Field.Name()),
+			}
+		}
 		// Reject traversal IS EMPTY (not translatable as a subfield check),
 		// but allow traversal IS NULL / IS NOT NULL (translatable via subquery).
 		if len(n.Field.Parts) >= 2 {
@@ -680,11 +759,12 @@ func validateNode(node Node, entityType EntityType) error {
 			}
 		}
 		// Reject IS NULL on relation fields (tags, groups) — use IS EMPTY instead.
-		// parent/children/owner IS NULL are handled by the IS EMPTY path.
+		// children and the single references (parent, owner, series,
+		// currentVersion) IS NULL are handled by the IS EMPTY path.
 		if n.IsNull && len(n.Field.Parts) == 1 {
 			fieldName := n.Field.Parts[0].Value
 			fd, ok := LookupField(entityType, fieldName)
-			if ok && fd.Type == FieldRelation && fieldName != "parent" && fieldName != "children" && fieldName != "owner" {
+			if ok && fd.Type == FieldRelation && fieldName != "children" && !isSingleReference(fd) {
 				return &ValidationError{
 					Message: fmt.Sprintf("use \"%s IS EMPTY\" instead of \"%s IS NULL\" for relation fields", fieldName, fieldName),
 					Pos:     n.Field.Pos(),
@@ -750,12 +830,13 @@ func validateSortable(f *FieldExpr, entityType EntityType) error {
 			// meta.X is sortable
 			return nil
 		}
-		// <relation>.count is sortable (correlated scalar subquery)
+		// <relation>.count is sortable (correlated scalar subquery), typed
+		// relation counts included.
 		if isCountField(f, entityType) {
 			return nil
 		}
 		// Any traversal field (parent.X, children.X, owner.X, ancestors.X, etc.) is not sortable
-		if recursiveRoots[prefix] {
+		if recursiveRoots[prefix] || isRelatedField(f) {
 			return &ValidationError{
 				Message: fmt.Sprintf("cannot ORDER BY %s: traversal fields are not sortable", f.Name()),
 				Pos:     f.Pos(),
@@ -821,7 +902,7 @@ func validateValueType(field *FieldExpr, value Node, entityType EntityType) erro
 	// Traversal subfields — validated by the translator
 	if len(field.Parts) >= 2 {
 		prefix := field.Parts[0].Value
-		if recursiveRoots[prefix] {
+		if recursiveRoots[prefix] || isRelatedField(field) {
 			return nil
 		}
 		if _, isRoot := traversalRoots[prefix]; isRoot {
@@ -903,14 +984,20 @@ func validateFieldExpr(f *FieldExpr, entityType EntityType) error {
 			return dateBucketWhereError(f)
 		}
 
+		// todos.count / todos.open.count total the note's todo items.
+		if isBlockCountField(f) {
+			return validateBlockCountField(f, entityType)
+		}
+
 		// <relation>.count pseudo-field
 		if len(f.Parts) == 2 && f.Parts[1].Value == "count" {
 			if _, ok := countableRelation(entityType, prefix); ok {
 				return nil
 			}
 			if fd, ok := LookupField(entityType, prefix); ok && fd.Type == FieldRelation {
-				// Single-reference relations (owner, parent) get a targeted error.
-				if fd.Column == "owner_id" || fd.Column == "parent_id" {
+				// Single-reference relations (owner, parent, series,
+				// currentVersion) get a targeted error.
+				if isSingleReference(fd) {
 					return &ValidationError{
 						Message: fmt.Sprintf("%s is a single reference and cannot be counted; use %s IS NULL / IS NOT NULL", prefix, prefix),
 						Pos:     f.Pos(),
@@ -934,6 +1021,11 @@ func validateFieldExpr(f *FieldExpr, entityType EntityType) error {
 			return validateRecursiveChain(f, entityType)
 		}
 
+		// Related roots: series.X, versions.X, relations("type").X, ...
+		if isRelatedField(f) {
+			return validateRelatedChain(f, entityType)
+		}
+
 		// Traversal chain: root.intermediate...leaf
 		return validateTraversalChain(f, entityType)
 	}
@@ -1167,6 +1259,16 @@ func validateGroupBy(gb *GroupByClause, entityType EntityType, orderBy []OrderBy
 			}
 		}
 
+		// Related roots group only as a bare single reference (series) or a
+		// count; their leaves and the set-valued roots would fan rows out.
+		if isRelatedLeafPath(f) || f.RelationType != nil || (len(f.Parts) == 1 && isRelatedField(f) && !relatedRoots[f.Parts[0].Value].groupable) {
+			return &ValidationError{
+				Message: fmt.Sprintf("cannot GROUP BY %s: series is the only groupable related field", f.Name()),
+				Pos:     f.Pos(),
+				Length:  len(f.Name()),
+			}
+		}
+
 		// Date bucket pseudo-fields (created.month etc.) are valid GROUP BY keys;
 		// validateFieldExpr would reject them as WHERE-only.
 		if !isDateBucketField(f, entityType) {
@@ -1199,6 +1301,14 @@ func validateGroupBy(gb *GroupByClause, entityType EntityType, orderBy []OrderBy
 		if err := validateAggregateFunc(agg, entityType); err != nil {
 			return err
 		}
+		// Running totals accumulate along a date bucket.
+		if agg.IsRunning() && runningTotalBucket(gb, entityType) < 0 {
+			return &ValidationError{
+				Message: fmt.Sprintf("%s requires a date bucket in GROUP BY (e.g. GROUP BY created.month %s)", agg.Name, agg),
+				Pos:     agg.Token.Pos,
+				Length:  len(agg.Token.Value),
+			}
+		}
 	}
 
 	// Validate HAVING expression
@@ -1233,6 +1343,176 @@ func validateGroupBy(gb *GroupByClause, entityType EntityType, orderBy []OrderBy
 	return nil
 }
 
+// validateSelect validates a SELECT projection: entity type required, no
+// GROUP BY or mutation alongside it, unique column names, and columns that
+// hold one value per entity. Arithmetic operands must be numeric.
+func validateSelect(q *Query, entityType EntityType) error {
+	sel := q.Select
+	selectErr := func(msg string) *ValidationError {
+		return &ValidationError{Message: msg, Pos: sel.Token.Pos, Length: len(sel.Token.Value)}
+	}
+	if entityType == EntityUnspecified {
+		return selectErr("SELECT requires an explicit entity type (e.g. type = \"resource\")")
+	}
+	if q.GroupBy != nil {
+		return selectErr("SELECT cannot be combined with GROUP BY; use GROUP BY with aggregates for per-group columns")
+	}
+	if q.Mutation != nil {
+		return selectErr("SELECT cannot be combined with mutation clauses")
+	}
+
+	seen := make(map[string]bool, len(sel.Columns))
+	for _, col := range sel.Columns {
+		if err := validateSelectExpr(col.Expr, entityType, false); err != nil {
+			return err
+		}
+		name := col.Name()
+		if seen[name] {
+			return &ValidationError{
+				Message: fmt.Sprintf("duplicate SELECT column %q; name one of them with AS", name),
+				Pos:     col.Expr.Pos(),
+				Length:  len(name),
+			}
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// isReferenceChain reports whether f is an owner/parent path that ends on a
+// group rather than a field of one: owner.parent, parent.parent.
+func isReferenceChain(f *FieldExpr, entityType EntityType) bool {
+	fd, ok := LookupField(entityType, f.Parts[0].Value)
+	if !ok || (fd.Column != "owner_id" && fd.Column != "parent_id") {
+		return false
+	}
+	for _, part := range f.Parts[1:] {
+		if part.Value != "parent" {
+			return false
+		}
+	}
+	return true
+}
+
+// validateSelectExpr validates one SELECT column expression. operand is true
+// inside arithmetic, where every field must be numeric.
+func validateSelectExpr(n Node, entityType EntityType, operand bool) error {
+	switch n := n.(type) {
+	case *NumberLiteral:
+		return nil
+	case *ArithExpr:
+		if err := validateSelectExpr(n.Left, entityType, true); err != nil {
+			return err
+		}
+		return validateSelectExpr(n.Right, entityType, true)
+	case *FieldExpr:
+		numeric, err := validateSelectField(n, entityType)
+		if err != nil {
+			return err
+		}
+		if operand && !numeric {
+			return &ValidationError{
+				Message: fmt.Sprintf("%s is not numeric and cannot be used in arithmetic", n.Name()),
+				Pos:     n.Pos(),
+				Length:  len(n.Name()),
+			}
+		}
+		return nil
+	case *ScalarCall:
+		result, err := validateScalarCall(n, entityType)
+		if err != nil {
+			return err
+		}
+		if operand && result != FieldNumber {
+			return &ValidationError{
+				Message: fmt.Sprintf("%s is not numeric and cannot be used in arithmetic", printScalarCall(n)),
+				Pos:     n.Pos(),
+				Length:  n.Token.Length,
+			}
+		}
+		return nil
+	}
+	return &ValidationError{Message: "invalid SELECT column", Pos: n.Pos()}
+}
+
+// validateSelectField validates a projected field and reports whether its
+// value is numeric. Meta values count as numeric: arithmetic treats a
+// non-numeric meta value as NULL.
+func validateSelectField(f *FieldExpr, entityType EntityType) (bool, error) {
+	name := f.Name()
+	fieldErr := func(format string, args ...any) (bool, error) {
+		return false, &ValidationError{Message: fmt.Sprintf(format, args...), Pos: f.Pos(), Length: len(name)}
+	}
+	root := f.Parts[0].Value
+
+	switch {
+	case len(f.Parts) == 1 && root == "type":
+		return fieldErr("cannot SELECT type: it is a filter pseudo-field, not a data column")
+	case len(f.Parts) >= 2 && recursiveRoots[root]:
+		return fieldErr("cannot SELECT %s: ancestors/descendants are filter-only", name)
+	case len(f.Parts) >= 2 && root == "meta":
+		return true, nil
+	case isCountField(f, entityType):
+		return true, nil
+	case isDateBucketField(f, entityType):
+		return false, nil
+	case len(f.Parts) >= 2 && isReferenceChain(f, entityType):
+		return false, nil // owner.parent: the last group's name
+	}
+
+	if err := validateFieldExpr(f, entityType); err != nil {
+		return false, err
+	}
+
+	if len(f.Parts) == 1 {
+		fd, _ := LookupField(entityType, root)
+		if fd.Type != FieldRelation {
+			return fd.Type == FieldNumber, nil
+		}
+		switch {
+		case fd.Column == "current_version_id":
+			return fieldErr("cannot SELECT currentVersion directly; use currentVersion.<field> (e.g. currentVersion.number)")
+		case isSingleReference(fd):
+			return false, nil // the referenced row's name
+		}
+		if _, ok := countableRelation(entityType, root); ok {
+			return fieldErr("cannot SELECT %s: it has many values per %s; use %s.count", name, entityType, root)
+		}
+		return fieldErr("cannot SELECT %s: it has many values per %s", name, entityType)
+	}
+
+	// Related roots project through single references only: series.name,
+	// currentVersion.fileSize.
+	if isRelatedField(f) {
+		rel := relatedRoots[root]
+		if !rel.singleReference() {
+			return fieldErr("cannot SELECT %s: %s has many rows per %s; use %s.count", name, root, entityType, root)
+		}
+		if f.Parts[1].Value == "meta" {
+			return true, nil
+		}
+		fd, _ := rel.leaf(f.Parts[1].Value)
+		return fd.Type == FieldNumber, nil
+	}
+
+	// Group traversal chains (owner.name, parent.parent.meta.x) must follow a
+	// single owner at each step.
+	for i, part := range f.Parts {
+		if part.Value == "meta" && i > 0 {
+			return true, nil
+		}
+		if part.Value == "children" {
+			return fieldErr("cannot SELECT %s: children has many rows per group; use children.count", name)
+		}
+	}
+	leaf := f.Parts[len(f.Parts)-1].Value
+	fd, _ := LookupField(EntityGroup, leaf)
+	if fd.Type == FieldRelation {
+		return fieldErr("cannot SELECT %s: %s has many values per group", name, leaf)
+	}
+	return fd.Type == FieldNumber, nil
+}
+
 // validateAggregateFunc checks one aggregate function's field against the
 // entity type. Shared between the GROUP BY aggregate list and HAVING leaves.
 func validateAggregateFunc(agg AggregateFunc, entityType EntityType) error {
@@ -1259,8 +1539,18 @@ func validateAggregateFunc(agg AggregateFunc, entityType EntityType) error {
 		return nil
 	}
 
-	// SUM/AVG require numeric fields
-	if agg.Name == "SUM" || agg.Name == "AVG" {
+	// COUNT(DISTINCT) counts column values; relation fields have no column.
+	if agg.Distinct && fd.Type == FieldRelation {
+		return &ValidationError{
+			Message: fmt.Sprintf("COUNT(DISTINCT) requires a scalar or meta field, but %q is %s", fieldName, fieldTypeName(fd.Type)),
+			Pos:     agg.Field.Pos(),
+			Length:  len(fieldName),
+		}
+	}
+
+	// SUM/AVG, the percentiles and running sums require numeric fields
+	switch agg.Name {
+	case "SUM", "AVG", "MEDIAN", "PERCENTILE", "RUNNING_SUM":
 		if fd.Type != FieldNumber && fd.Type != FieldMeta {
 			return &ValidationError{
 				Message: fmt.Sprintf("%s requires a numeric field, but %q is %s", agg.Name, fieldName, fieldTypeName(fd.Type)),
@@ -1293,6 +1583,13 @@ func validateHavingNode(node Node, entityType EntityType) error {
 	case *NotExpr:
 		return validateHavingNode(n.Expr, entityType)
 	case *HavingComparison:
+		if n.Agg.IsRunning() {
+			return &ValidationError{
+				Message: fmt.Sprintf("%s cannot be used in HAVING: running totals are computed after groups are filtered", n.Agg.Name),
+				Pos:     n.Agg.Token.Pos,
+				Length:  len(n.Agg.Token.Value),
+			}
+		}
 		if err := validateAggregateFunc(n.Agg, entityType); err != nil {
 			return err
 		}
@@ -1307,7 +1604,7 @@ func validateHavingNode(node Node, entityType EntityType) error {
 }
 
 // validateHavingValue checks that the comparison value matches the aggregate:
-// numeric for COUNT/SUM/AVG and MIN/MAX on numeric fields; date values
+// numeric for COUNT/SUM/AVG/MEDIAN/PERCENTILE and MIN/MAX on numeric fields; date values
 // (string, relative date, function) additionally allowed for MIN/MAX on
 // datetime fields, and any value for MIN/MAX on dynamically-typed meta fields.
 func validateHavingValue(hc *HavingComparison, entityType EntityType) error {
@@ -1336,12 +1633,8 @@ func validateHavingValue(hc *HavingComparison, entityType EntityType) error {
 		}
 	}
 
-	aggLabel := hc.Agg.Name + "()"
-	if hc.Agg.Field != nil {
-		aggLabel = hc.Agg.Name + "(" + hc.Agg.Field.Name() + ")"
-	}
 	return &ValidationError{
-		Message: fmt.Sprintf("HAVING %s requires a numeric value", aggLabel),
+		Message: fmt.Sprintf("HAVING %s requires a numeric value", hc.Agg),
 		Pos:     hc.Value.Pos(),
 		Length:  0,
 	}
@@ -1360,15 +1653,23 @@ func buildAggregateOrderKeys(gb *GroupByClause) map[string]bool {
 		keys[f.Name()] = true
 	}
 	for _, agg := range gb.Aggregates {
-		if agg.Field == nil {
-			keys["count"] = true
-		} else {
-			keys[strings.ToLower(agg.Name)+"_"+agg.Field.Name()] = true
-		}
+		keys[agg.Key()] = true
 	}
 	return keys
 }
 
+// runningTotalBucket returns the index of the GROUP BY field that running
+// totals accumulate along — the first date bucket — or -1 when there is none.
+// The remaining GROUP BY fields partition the running totals.
+func runningTotalBucket(gb *GroupByClause, entityType EntityType) int {
+	for i, f := range gb.Fields {
+		if isDateBucketField(f, entityType) {
+			return i
+		}
+	}
+	return -1
+}
+
 // groupByHasField returns true if the GROUP BY clause contains the field name.
 func groupByHasField(gb *GroupByClause, name string) bool {
 	for _, f := range gb.Fields {
@@ -378,8 +378,9 @@ type MRQLExecOptions struct {
 // MRQLResult holds query results in a plugin_system-safe form (no model imports).
 type MRQLResult struct {
 	EntityType string
-	Mode       string // "flat", "aggregated", "bucketed"
+	Mode       string // "flat", "aggregated", "projected", "bucketed"
 	Items      []map[string]any
+	Columns    []string // Rows' column names in query order
 	Rows       []map[string]any
 	Groups     []MRQLResultGroup
 }
@@ -1465,7 +1466,12 @@ func mrqlResultToLua(L *lua.LState, result *MRQLResult) *lua.LTable {
 			items.RawSetInt(i+1, goToLuaTable(L, item))
 		}
 		tbl.RawSetString("items", items)
-	case "aggregated":
+	case "aggregated", "projected":
+		columns := L.NewTable()
+		for i, col := range result.Columns {
+			columns.RawSetInt(i+1, lua.LString(col))
+		}
+		tbl.RawSetString("columns", columns)
 		rows := L.NewTable()
 		for i, row := range result.Rows {
 			rows.RawSetInt(i+1, goToLuaTable(L, row))
@@ -507,13 +507,19 @@ local function resolve_data_source(ctx)
     end
 end
 
+-- has_mrql_rows(result) reports whether an MRQL result is a table of rows:
+-- an aggregated GROUP BY or a SELECT projection.
+local function has_mrql_rows(result)
+    return (result.mode == "aggregated" or result.mode == "projected") and result.rows ~= nil
+end
+
 -- resolve_scalar_from_mrql(result, aggregate_attr) extracts a single value
 -- from an MRQL result for scalar shortcodes.
 local function resolve_scalar_from_mrql(result, aggregate_attr)
     if result == nil then return nil end
-    if result.mode == "aggregated" and result.rows then
+    if has_mrql_rows(result) then
         if not aggregate_attr or aggregate_attr == "" then
-            return nil, 'mrql aggregated results require aggregate="column_name" attribute'
+            return nil, 'mrql aggregated and projected results require aggregate="column_name" attribute'
         end
         local first_row = result.rows[1]
         if not first_row then return nil end
@@ -688,10 +694,10 @@ local function render_sparkline(ctx)
     local data
     if type(val) == "table" and val.mode then
         data = {}
-        if val.mode == "aggregated" and val.rows then
+        if has_mrql_rows(val) then
             local value_key = attrs["value-key"] or attrs.aggregate
             if not value_key or value_key == "" then
-                return render_mrql_error('mrql aggregated results require value-key or aggregate attribute')
+                return render_mrql_error('mrql aggregated and projected results require value-key or aggregate attribute')
             end
             for _, row in ipairs(val.rows) do
                 local n = tonumber(row[value_key])
@@ -823,7 +829,7 @@ local function render_table(ctx)
             entity_type_path = result.entity_type
             if result.mode == "flat" and result.items then
                 rows = result.items
-            elseif result.mode == "aggregated" and result.rows then
+            elseif has_mrql_rows(result) then
                 rows = result.rows
             elseif result.mode == "bucketed" and result.groups then
                 -- Flatten: show group key fields as rows
@@ -842,16 +848,21 @@ local function render_table(ctx)
             return '<div class="py-1.5"><span class="text-sm text-stone-400 italic">No data</span></div>'
         end
 
-        -- Auto-detect cols from first row if default
+        -- Auto-detect cols if default: the query's column order when the
+        -- result has one, else the first row's keys
         if attrs["cols"] == nil or attrs["cols"] == "" then
             cols = {}
             labels = {}
-            for k, _ in pairs(rows[1]) do
-                if k ~= "_count" then
-                    cols[#cols + 1] = k
+            if result.columns and #result.columns > 0 then
+                for _, k in ipairs(result.columns) do cols[#cols + 1] = k end
+            else
+                for k, _ in pairs(rows[1]) do
+                    if k ~= "_count" then
+                        cols[#cols + 1] = k
+                    end
                 end
+                table.sort(cols)
             end
-            table.sort(cols)
             for i = 1, #cols do labels[i] = cols[i] end
         end
 
@@ -1001,12 +1012,21 @@ local function render_list(ctx)
             for _, item in ipairs(val.items) do
                 data[#data + 1] = item
             end
-        elseif val.mode == "aggregated" and val.rows then
+        elseif has_mrql_rows(val) then
             for _, row in ipairs(val.rows) do
-                -- Build "key: value" strings from each row
+                -- Build "key: value" strings from each row, in column order
+                -- when the result has one
                 local parts = {}
-                for k, v in pairs(row) do
-                    parts[#parts + 1] = tostring(k) .. ": " .. tostring(v)
+                if val.columns and #val.columns > 0 then
+                    for _, k in ipairs(val.columns) do
+                        local v = row[k]
+                        if v == nil then v = "" end
+                        parts[#parts + 1] = tostring(k) .. ": " .. tostring(v)
+                    end
+                else
+                    for k, v in pairs(row) do
+                        parts[#parts + 1] = tostring(k) .. ": " .. tostring(v)
+                    end
                 end
                 data[#data + 1] = table.concat(parts, ", ")
             end
@@ -1103,7 +1123,7 @@ local function render_count_badge(ctx)
         if type(result) == "table" and result.mode then
             if result.mode == "flat" and result.items then
                 count = #result.items
-            elseif result.mode == "aggregated" and result.rows then
+            elseif has_mrql_rows(result) then
                 -- Use aggregate attr to extract a specific count value
                 local agg = attrs.aggregate
                 if agg and result.rows[1] then
@@ -1452,7 +1472,7 @@ local function render_bar_chart(ctx)
 
     if type(val) == "table" and val.mode then
         -- MRQL result
-        if val.mode == "aggregated" and val.rows then
+        if has_mrql_rows(val) then
             -- Use label-key and value-key to extract from rows
             local lk = label_key
             local vk = value_key
@@ -1568,7 +1588,7 @@ local function render_pie_chart(ctx)
 
     if type(val) == "table" and val.mode then
         -- MRQL result
-        if val.mode == "aggregated" and val.rows then
+        if has_mrql_rows(val) then
             local lk = label_key
             local vk = value_key
             -- Auto-detect keys if not specified
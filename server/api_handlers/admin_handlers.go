@@ -2,9 +2,17 @@ package api_handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
+	"gorm.io/gorm"
+
+	"mahresources/application_context"
 	"mahresources/constants"
+	"mahresources/models/query_models"
 	"mahresources/server/http_utils"
 )
 
@@ -71,3 +79,442 @@ func GetRetryFailedHashesHandler(ctx AdminStatsContext) http.HandlerFunc {
 		_ = json.NewEncoder(writer).Encode(map[string]any{"reset": reset})
 	}
 }
+
+// formBool reads a boolean query or form parameter; anything unparsable is false.
+func formBool(request *http.Request, name string) bool {
+	v, _ := strconv.ParseBool(request.FormValue(name))
+	return v
+}
+
+// GetStartBlobScrubHandler submits the blob integrity scrub, resuming the
+// newest unfinished run unless restart is set. 409 while a scrub is running.
+func GetStartBlobScrubHandler(ctx BlobScrubContext) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		start, err := ctx.StartBlobScrub(application_context.BlobScrubOptions{
+			Repair:  formBool(request, "repair"),
+			Restart: formBool(request, "restart"),
+		})
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, application_context.ErrBlobScrubInProgress) {
+				status = http.StatusConflict
+			}
+			http_utils.HandleError(err, writer, request, status)
+			return
+		}
+		writer.Header().Set("Content-Type", constants.JSON)
+		_ = json.NewEncoder(writer).Encode(start)
+	}
+}
+
+// GetBlobScrubStatusHandler returns the newest scrub run and the issue counts.
+func GetBlobScrubStatusHandler(ctx BlobScrubContext) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		status, err := ctx.GetBlobScrubStatus()
+		if err != nil {
+			http_utils.HandleError(err, writer, request, http.StatusInternalServerError)
+			return
+		}
+		writer.Header().Set("Content-Type", constants.JSON)
+		_ = json.NewEncoder(writer).Encode(status)
+	}
+}
+
+// GetBlobIntegrityIssuesHandler returns a page of the scrub report.
+func GetBlobIntegrityIssuesHandler(ctx BlobScrubContext) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		page := http_utils.GetPageParameter(request)
+		offset := (page - 1) * constants.MaxResultsPerPage
+		issues, err := ctx.ListBlobIntegrityIssues(
+			request.URL.Query().Get("status"),
+			request.URL.Query().Get("problem"),
+			int(offset), constants.MaxResultsPerPage,
+		)
+		if err != nil {
+			http_utils.HandleError(err, writer, request, http.StatusInternalServerError)
+			return
+		}
+		writer.Header().Set("Content-Type", constants.JSON)
+		_ = json.NewEncoder(writer).Encode(issues)
+	}
+}
+
+// GetRecheckBlobIntegrityIssueHandler checks an issue's file again, clearing
+// the issue when the file is intact.
+func GetRecheckBlobIntegrityIssueHandler(ctx BlobScrubContext) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		id := http_utils.GetUIntFormParameter(request, "id", 0)
+		if id == 0 {
+			http_utils.HandleError(errors.New("id is required"), writer, request, http.StatusBadRequest)
+			return
+		}
+		issue, err := ctx.RecheckBlobIntegrityIssue(id, formBool(request, "repair"))
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				status = http.StatusNotFound
+			}
+			http_utils.HandleError(err, writer, request, status)
+			return
+		}
+		writer.Header().Set("Content-Type", constants.JSON)
+		_ = json.NewEncoder(writer).Encode(issue)
+	}
+}
+
+// GetStartBlobGCHandler submits the blob garbage collection. grace is a Go
+// duration (default 24h); dryRun only lists what would be deleted. 409 while
+// a collection is running.
+func GetStartBlobGCHandler(ctx BlobGCContext) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		opts := application_context.BlobGCOptions{
+			DryRun:      formBool(request, "dryRun"),
+			GracePeriod: application_context.DefaultBlobGCGracePeriod,
+		}
+		if grace := request.FormValue("grace"); grace != "" {
+			d, err := time.ParseDuration(grace)
+			if err == nil && d < 0 {
+				err = errors.New("must not be negative")
+			}
+			if err != nil {
+				http_utils.HandleError(fmt.Errorf("invalid grace: %w", err), writer, request, http.StatusBadRequest)
+				return
+			}
+			opts.GracePeriod = d
+		}
+		start, err := ctx.StartBlobGC(opts)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, application_context.ErrBlobGCInProgress) {
+				status = http.StatusConflict
+			}
+			http_utils.HandleError(err, writer, request, status)
+			return
+		}
+		writer.Header().Set("Content-Type", constants.JSON)
+		_ = json.NewEncoder(writer).Encode(start)
+	}
+}
+
+// GetBlobGCStatusHandler returns a garbage collection run and its report: the
+// one named by id, or the newest.
+func GetBlobGCStatusHandler(ctx BlobGCContext) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		status, err := ctx.GetBlobGCStatus(http_utils.GetUIntQueryParameter(request, "id", 0))
+		if err != nil {
+			http_utils.HandleError(err, writer, request, http.StatusNotFound)
+			return
+		}
+		writer.Header().Set("Content-Type", constants.JSON)
+		_ = json.NewEncoder(writer).Encode(status)
+	}
+}
+
+// GetStartContentHashMigrationHandler submits the SHA1 to SHA-256 content
+// hash migration, resuming the newest unfinished run unless restart is set.
+// 409 while a migration is running.
+func GetStartContentHashMigrationHandler(ctx ContentHashMigrationContext) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		start, err := ctx.StartContentHashMigration(application_context.ContentHashMigrationOptions{
+			Restart: formBool(request, "restart"),
+		})
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, application_context.ErrContentHashMigrationInProgress) {
+				status = http.StatusConflict
+			}
+			http_utils.HandleError(err, writer, request, status)
+			return
+		}
+		writer.Header().Set("Content-Type", constants.JSON)
+		_ = json.NewEncoder(writer).Encode(start)
+	}
+}
+
+// GetContentHashMigrationStatusHandler returns the newest migration run and
+// the rows still on SHA1.
+func GetContentHashMigrationStatusHandler(ctx ContentHashMigrationContext) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		status, err := ctx.GetContentHashMigrationStatus()
+		if err != nil {
+			http_utils.HandleError(err, writer, request, http.StatusInternalServerError)
+			return
+		}
+		writer.Header().Set("Content-Type", constants.JSON)
+		_ = json.NewEncoder(writer).Encode(status)
+	}
+}
+
+// GetStartKeyRotationHandler submits the rotation that brings every stored
+// file onto the current master key. 400 when encryption is off, 409 while a
+// rotation is running.
+func GetStartKeyRotationHandler(ctx KeyRotationContext) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		start, err := ctx.StartKeyRotation()
+		if err != nil {
+			status := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, application_context.ErrEncryptionDisabled):
+				status = http.StatusBadRequest
+			case errors.Is(err, application_context.ErrKeyRotationInProgress):
+				status = http.StatusConflict
+			}
+			http_utils.HandleError(err, writer, request, status)
+			return
+		}
+		writer.Header().Set("Content-Type", constants.JSON)
+		_ = json.NewEncoder(writer).Encode(start)
+	}
+}
+
+// GetKeyRotationStatusHandler returns the configured master keys and the
+// newest rotation run.
+func GetKeyRotationStatusHandler(ctx KeyRotationContext) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		status, err := ctx.GetKeyRotationStatus()
+		if err != nil {
+			http_utils.HandleError(err, writer, request, http.StatusInternalServerError)
+			return
+		}
+		writer.Header().Set("Content-Type", constants.JSON)
+		_ = json.NewEncoder(writer).Encode(status)
+	}
+}
+
+// GetStartStorageTieringHandler submits a run of the storage tiering rules;
+// dryRun only counts what they would move. 400 when no rules are configured,
+// 409 while resources are being moved.
+func GetStartStorageTieringHandler(ctx StorageTierContext) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		start, err := ctx.StartStorageTiering(application_context.StorageTierOptions{
+			DryRun: formBool(request, "dryRun"),
+		})
+		if err != nil {
+			status := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, application_context.ErrNoStorageTierRules):
+				status = http.StatusBadRequest
+			case errors.Is(err, application_context.ErrStorageTieringInProgress):
+				status = http.StatusConflict
+			}
+			http_utils.HandleError(err, writer, request, status)
+			return
+		}
+		writer.Header().Set("Content-Type", constants.JSON)
+		_ = json.NewEncoder(writer).Encode(start)
+	}
+}
+
+// GetStorageTierStatusHandler returns the tiering rules and a run with its
+// report: the one named by id, or the newest.
+func GetStorageTierStatusHandler(ctx StorageTierContext) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		status, err := ctx.GetStorageTierStatus(http_utils.GetUIntQueryParameter(request, "id", 0))
+		if err != nil {
+			http_utils.HandleError(err, writer, request, http.StatusNotFound)
+			return
+		}
+		writer.Header().Set("Content-Type", constants.JSON)
+		_ = json.NewEncoder(writer).Encode(status)
+	}
+}
+
+// GetStorageTierMoveHandler submits a job moving the resources in id to the
+// alt filesystem target, or to the main filesystem when target is empty. pin
+// keeps the rules from moving them back. 409 while resources are being moved.
+func GetStorageTierMoveHandler(ctx StorageTierContext) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		var query query_models.BulkQuery
+		if err := tryFillStructValuesFromRequest(&query, request); err != nil {
+			http_utils.HandleError(err, writer, request, http.StatusBadRequest)
+			return
+		}
+		start, err := ctx.StartStorageTierMove(query.ID, request.FormValue("target"), formBool(request, "pin"))
+		if err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, application_context.ErrStorageTieringInProgress) {
+				status = http.StatusConflict
+			}
+			http_utils.HandleError(err, writer, request, status)
+			return
+		}
+		writer.Header().Set("Content-Type", constants.JSON)
+		_ = json.NewEncoder(writer).Encode(start)
+	}
+}
+
+// GetStorageTierPinHandler pins the resources in id, or unpins them when pin
+// is false, so that the tiering rules leave them where they are.
+func GetStorageTierPinHandler(ctx StorageTierContext, pin bool) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		var query query_models.BulkQuery
+		if err := tryFillStructValuesFromRequest(&query, request); err != nil {
+			http_utils.HandleError(err, writer, request, http.StatusBadRequest)
+			return
+		}
+		if len(query.ID) == 0 {
+			http_utils.HandleError(errors.New("at least one resource ID is required"), writer, request, http.StatusBadRequest)
+			return
+		}
+		var err error
+		if pin {
+			err = ctx.PinResources(query.ID)
+		} else {
+			err = ctx.UnpinResources(query.ID)
+		}
+		if err != nil {
+			http_utils.HandleError(err, writer, request, http.StatusBadRequest)
+			return
+		}
+		writeJSONOk(writer)
+	}
+}
+
+// GetListStorageQuotasHandler returns every storage quota with its usage.
+func GetListStorageQuotasHandler(ctx StorageQuotaContext) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		quotas, err := ctx.ListStorageQuotas()
+		if err != nil {
+			http_utils.HandleError(err, writer, request, http.StatusInternalServerError)
+			return
+		}
+		writer.Header().Set("Content-Type", constants.JSON)
+		_ = json.NewEncoder(writer).Encode(quotas)
+	}
+}
+
+// GetSetStorageQuotaHandler sets the quota of a user or of a group's subtree,
+// replacing any it had. 400 for an unknown subject or a negative limit.
+func GetSetStorageQuotaHandler(ctx StorageQuotaContext) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		var query query_models.StorageQuotaEditor
+		if err := tryFillStructValuesFromRequest(&query, request); err != nil {
+			http_utils.HandleError(err, writer, request, http.StatusBadRequest)
+			return
+		}
+		status, err := ctx.SetStorageQuota(query.SubjectType, query.SubjectId, query.MaxBytes, query.MaxResources)
+		if err != nil {
+			http_utils.HandleError(err, writer, request, http.StatusBadRequest)
+			return
+		}
+		writer.Header().Set("Content-Type", constants.JSON)
+		_ = json.NewEncoder(writer).Encode(status)
+	}
+}
+
+// GetDeleteStorageQuotaHandler removes the quota of a user or a group. 404
+// when it has none.
+func GetDeleteStorageQuotaHandler(ctx StorageQuotaContext) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		var query query_models.StorageQuotaEditor
+		if err := tryFillStructValuesFromRequest(&query, request); err != nil {
+			http_utils.HandleError(err, writer, request, http.StatusBadRequest)
+			return
+		}
+		if err := ctx.DeleteStorageQuota(query.SubjectType, query.SubjectId); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, application_context.ErrStorageQuotaNotFound) {
+				status = http.StatusNotFound
+			}
+			http_utils.HandleError(err, writer, request, status)
+			return
+		}
+		writeJSONOk(writer)
+	}
+}
+
+// GetRecountStorageUsageHandler rebuilds every user's and group's storage
+// usage from the resources.
+func GetRecountStorageUsageHandler(ctx StorageQuotaContext) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		count, err := ctx.RecountStorageUsage()
+		if err != nil {
+			http_utils.HandleError(err, writer, request, http.StatusInternalServerError)
+			return
+		}
+		writer.Header().Set("Content-Type", constants.JSON)
+		_ = json.NewEncoder(writer).Encode(map[string]int64{"resources": count})
+	}
+}
+
+// GetListWatchFoldersHandler returns every watch folder.
+func GetListWatchFoldersHandler(ctx WatchFolderContext) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		folders, err := ctx.ListWatchFolders()
+		if err != nil {
+			http_utils.HandleError(err, writer, request, http.StatusInternalServerError)
+			return
+		}
+		writer.Header().Set("Content-Type", constants.JSON)
+		_ = json.NewEncoder(writer).Encode(folders)
+	}
+}
+
+// GetSetWatchFolderHandler creates a watch folder, or updates the one named
+// by id.
+func GetSetWatchFolderHandler(ctx WatchFolderContext) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		var editor query_models.WatchFolderEditor
+		if err := tryFillStructValuesFromRequest(&editor, request); err != nil {
+			http_utils.HandleError(err, writer, request, http.StatusBadRequest)
+			return
+		}
+		folder, err := ctx.SetWatchFolder(&editor)
+		if err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, application_context.ErrWatchFolderNotFound) {
+				status = http.StatusNotFound
+			}
+			http_utils.HandleError(err, writer, request, status)
+			return
+		}
+		writer.Header().Set("Content-Type", constants.JSON)
+		_ = json.NewEncoder(writer).Encode(folder)
+	}
+}
+
+// GetDeleteWatchFolderHandler stops watching a folder; the resources it
+// ingested stay. 404 for an unknown id.
+func GetDeleteWatchFolderHandler(ctx WatchFolderContext) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		var query query_models.EntityIdQuery
+		if err := tryFillStructValuesFromRequest(&query, request); err != nil {
+			http_utils.HandleError(err, writer, request, http.StatusBadRequest)
+			return
+		}
+		if err := ctx.DeleteWatchFolder(query.ID); err != nil {
+			http_utils.HandleError(err, writer, request, watchFolderErrorStatus(err))
+			return
+		}
+		writeJSONOk(writer)
+	}
+}
+
+// GetStartWatchScanHandler submits a scan of a watch folder. 404 for an
+// unknown id, 409 while the folder is being scanned.
+func GetStartWatchScanHandler(ctx WatchFolderContext) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		var query query_models.EntityIdQuery
+		if err := tryFillStructValuesFromRequest(&query, request); err != nil {
+			http_utils.HandleError(err, writer, request, http.StatusBadRequest)
+			return
+		}
+		start, err := ctx.StartWatchScan(query.ID)
+		if err != nil {
+			http_utils.HandleError(err, writer, request, watchFolderErrorStatus(err))
+			return
+		}
+		writer.Header().Set("Content-Type", constants.JSON)
+		_ = json.NewEncoder(writer).Encode(start)
+	}
+}
+
+func watchFolderErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, application_context.ErrWatchFolderNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, application_context.ErrWatchScanInProgress):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,87 @@
+package api_handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+
+	"mahresources/application_context"
+	"mahresources/auth"
+	"mahresources/constants"
+	"mahresources/contracts"
+	"mahresources/models"
+	"mahresources/models/query_models"
+	"mahresources/server/http_utils"
+)
+
+// expandArchiveUploads starts an archive expansion for each uploaded file
+// instead of storing it, answering 202 with the expansions. A file that
+// cannot be expanded stops the rest; expansions already started go on.
+func expandArchiveUploads(writer http.ResponseWriter, request *http.Request, ctx any, files []*multipart.FileHeader, creator query_models.ResourceCreator) {
+	expander, ok := ctx.(contracts.ArchiveExpander)
+	if !ok {
+		http_utils.HandleFormError(writer, request, "/resource/new", errors.New("archive expansion is not available"), request.PostForm)
+		return
+	}
+
+	expansions := make([]*models.ArchiveExpansion, 0, len(files))
+	for _, header := range files {
+		expansion, err := startArchiveExpansion(expander, header, creator)
+		if err != nil {
+			status := statusCodeForError(err, http.StatusInternalServerError)
+			if errors.Is(err, application_context.ErrNotAnArchive) {
+				status = http.StatusBadRequest
+			}
+			http_utils.HandleFormErrorWithStatus(writer, request, "/resource/new", fmt.Errorf("%s: %w", header.Filename, err), request.PostForm, status)
+			return
+		}
+		expansions = append(expansions, expansion)
+	}
+
+	redirectURL := "/resources"
+	if creator.OwnerId != 0 {
+		redirectURL = fmt.Sprintf("/group?id=%v", creator.OwnerId)
+	}
+	if http_utils.RedirectIfHTMLAccepted(writer, request, redirectURL) {
+		return
+	}
+	writer.Header().Set("Content-Type", constants.JSON)
+	writer.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(writer).Encode(map[string]any{"queued": true, "expansions": expansions})
+}
+
+func startArchiveExpansion(expander contracts.ArchiveExpander, header *multipart.FileHeader, creator query_models.ResourceCreator) (*models.ArchiveExpansion, error) {
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return expander.StartArchiveExpansion(file, header.Filename, &creator)
+}
+
+// GetArchiveExpansionHandler returns an archive expansion with what it has
+// created so far. Non-admins see only their own.
+func GetArchiveExpansionHandler(ctx contracts.ArchiveExpander) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		id, err := strconv.ParseUint(request.URL.Query().Get("id"), 10, 64)
+		if err != nil {
+			http_utils.HandleError(errors.New("id must be a number"), writer, request, http.StatusBadRequest)
+			return
+		}
+		ownerID, restricted := historyScope(auth.PrincipalFromContext(request.Context()))
+		expansion, err := ctx.GetArchiveExpansion(uint(id), ownerID, restricted)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, application_context.ErrArchiveExpansionNotFound) {
+				status = http.StatusNotFound
+			}
+			http_utils.HandleError(err, writer, request, status)
+			return
+		}
+		writer.Header().Set("Content-Type", constants.JSON)
+		_ = json.NewEncoder(writer).Encode(expansion)
+	}
+}
@@ -39,9 +39,15 @@ func statusCodeForError(err error, fallback int) int {
 	// phrased around "cannot be" and "not found" forever to keep their status,
 	// which is not a property a message should have to have.
 	if errors.Is(err, application_context.ErrRoleCapability) ||
-		errors.Is(err, application_context.ErrGlobalCascadeScoped) {
+		errors.Is(err, application_context.ErrGlobalCascadeScoped) ||
+		errors.Is(err, application_context.ErrMRQLMaterializeScoped) {
 		return http.StatusForbidden
 	}
+	// Refreshing a saved query that is not materialized: the query exists and
+	// the request is well formed, it is the query's state that refuses.
+	if errors.Is(err, application_context.ErrMRQLNotMaterialized) {
+		return http.StatusConflict
+	}
 
 	// A manual schedule run that was refused. Typed for the same reason the two
 	// above are: "no such plugin schedule" contains no "not found", and "already
@@ -60,6 +66,14 @@ func statusCodeForError(err error, fallback int) int {
 		return http.StatusConflict
 	}
 
+	// A storage quota refusal. 507 is the status for "the server cannot store
+	// this", and a client that sees it knows retrying will not help until
+	// something is deleted or the quota raised.
+	var quota *application_context.QuotaExceededError
+	if errors.As(err, &quota) {
+		return http.StatusInsufficientStorage
+	}
+
 	// A plugin veto from a before-hook. The status used to come from the scan
 	// below, over the message "plugin aborted: <the plugin author's own
 	// words>" — so a reason phrased "this cannot be deleted" produced 400 and
@@ -8,6 +8,7 @@ import (
 	"mahresources/application_context"
 	"mahresources/auth"
 	"mahresources/contracts"
+	"mahresources/download_queue"
 	"mahresources/models"
 	"mahresources/models/query_models"
 	"mahresources/mrql"
@@ -28,6 +29,7 @@ import (
 var (
 	_ MRQLAPIContext            = (*application_context.MahresourcesContext)(nil)
 	_ MRQLExportContext         = (*application_context.MahresourcesContext)(nil)
+	_ MRQLMutationContext       = (*application_context.MahresourcesContext)(nil)
 	_ PluginAPIContext          = (*application_context.MahresourcesContext)(nil)
 	_ TimelineContext           = (*application_context.MahresourcesContext)(nil)
 	_ UserAdminContext          = (*application_context.MahresourcesContext)(nil)
@@ -75,6 +77,7 @@ type MRQLAPIContext interface {
 	ValidateMRQLFilter(entity mrql.EntityType, queryStr string) (bool, []map[string]any)
 	CompleteMRQL(queryStr string, cursor int) []mrql.Suggestion
 	CompleteMRQLFilter(entity mrql.EntityType, queryStr string, cursor int) []mrql.Suggestion
+	FormatMRQL(queryStr string) (string, []map[string]any)
 	LoadMRQLRenderData(reqCtx context.Context, resourceCategoryIDs, noteTypeIDs, categoryIDs, scopeGroupIDs []uint) (*application_context.MRQLRenderData, error)
 	MRQLGenerator() application_context.MRQLGenerator
 	MRQLGenerationRateLimiter() *application_context.MRQLGenerationRateLimiter
@@ -87,6 +90,8 @@ type MRQLAPIContext interface {
 	UpdateSavedMRQLQuery(id uint, name, query, description string) (*models.SavedMRQLQuery, error)
 	CreateSavedMRQLQuery(name, query, description string) (*models.SavedMRQLQuery, error)
 	DeleteSavedMRQLQuery(id uint) error
+	SetSavedMRQLQueryMaterialization(id uint, m application_context.MRQLMaterializationSettings) (*models.SavedMRQLQuery, error)
+	RefreshSavedMRQLQuery(reqCtx context.Context, id uint) (*application_context.MRQLMaterializedInfo, error)
 }
 
 // savedMRQLLookup resolves a saved query by id or name. Shared by the MRQL API
@@ -126,6 +131,15 @@ type MRQLExportContext interface {
 	ValidateMRQLGroupedExportBounds(q *mrql.Query) error
 }
 
+// MRQLMutationContext serves /v1/mrql/mutate: planning a mutation under the
+// caller's scope and running the plan as a background job.
+type MRQLMutationContext interface {
+	Principal() *auth.Principal
+	DownloadManager() *download_queue.DownloadManager
+	PlanMRQLMutation(reqCtx context.Context, parsed *mrql.Query) (*application_context.MRQLMutationPlan, error)
+	ApplyMRQLMutation(jobCtx context.Context, plan *application_context.MRQLMutationPlan, progress func(done, total int)) error
+}
+
 // PluginAPIContext serves the plugin admin and host-function endpoints.
 type PluginAPIContext interface {
 	PluginManagerProvider
@@ -179,6 +193,59 @@ type AdminStatsContext interface {
 	RetryFailedHashes() (int64, error)
 }
 
+// BlobScrubContext serves the blob integrity scrubber and its report.
+type BlobScrubContext interface {
+	StartBlobScrub(opts application_context.BlobScrubOptions) (*application_context.BlobScrubStart, error)
+	GetBlobScrubStatus() (*application_context.BlobScrubStatus, error)
+	ListBlobIntegrityIssues(status, problem string, offset, limit int) ([]models.BlobIntegrityIssue, error)
+	RecheckBlobIntegrityIssue(id uint, repair bool) (*models.BlobIntegrityIssue, error)
+}
+
+// BlobGCContext serves the orphaned blob garbage collection.
+type BlobGCContext interface {
+	StartBlobGC(opts application_context.BlobGCOptions) (*application_context.BlobGCStart, error)
+	GetBlobGCStatus(id uint) (*application_context.BlobGCStatus, error)
+}
+
+// ContentHashMigrationContext serves the SHA1 to SHA-256 content hash migration.
+type ContentHashMigrationContext interface {
+	StartContentHashMigration(opts application_context.ContentHashMigrationOptions) (*application_context.ContentHashMigrationStart, error)
+	GetContentHashMigrationStatus() (*application_context.ContentHashMigrationStatus, error)
+}
+
+// KeyRotationContext serves the master key rotation of encrypted storage.
+type KeyRotationContext interface {
+	StartKeyRotation() (*application_context.KeyRotationStart, error)
+	GetKeyRotationStatus() (*application_context.KeyRotationStatus, error)
+}
+
+// StorageTierContext serves storage tiering: the rules that move cold
+// resources between filesystems, moves asked for directly, and pins.
+type StorageTierContext interface {
+	StartStorageTiering(opts application_context.StorageTierOptions) (*application_context.StorageTierStart, error)
+	StartStorageTierMove(ids []uint, target string, pin bool) (*application_context.StorageTierStart, error)
+	GetStorageTierStatus(id uint) (*application_context.StorageTierStatus, error)
+	PinResources(ids []uint) error
+	UnpinResources(ids []uint) error
+}
+
+// StorageQuotaContext serves per-user and per-group storage quotas.
+type StorageQuotaContext interface {
+	ListStorageQuotas() ([]application_context.StorageQuotaStatus, error)
+	SetStorageQuota(subjectType string, subjectID uint, maxBytes, maxResources int64) (*application_context.StorageQuotaStatus, error)
+	DeleteStorageQuota(subjectType string, subjectID uint) error
+	RecountStorageUsage() (int64, error)
+}
+
+// WatchFolderContext serves the watch folders that are polled for files to
+// ingest.
+type WatchFolderContext interface {
+	ListWatchFolders() ([]application_context.WatchFolderStatus, error)
+	SetWatchFolder(editor *query_models.WatchFolderEditor) (*application_context.WatchFolderStatus, error)
+	DeleteWatchFolder(id uint) error
+	StartWatchScan(id uint) (*application_context.WatchScanStart, error)
+}
+
 // SettingsContext serves the runtime-settings admin API.
 type SettingsContext interface {
 	Settings() *application_context.RuntimeSettings
@@ -31,6 +31,7 @@ type mrqlExecuteRequest struct {
 	Buckets int            `json:"buckets" schema:"buckets"` // buckets per page (grouped mode only)
 	Page    int            `json:"page" schema:"page"`       // page number (paginates buckets in grouped mode)
 	Offset  int            `json:"offset" schema:"offset"`   // direct offset for cursor-based bucket paging
+	Cursor  string         `json:"cursor" schema:"cursor"`   // keyset cursor from a previous page's nextCursor (non-grouped)
 	Params  map[string]any `json:"params" schema:"-"`        // $name placeholder bindings (JSON body only)
 }
 
@@ -62,7 +63,8 @@ type mrqlExplainRequest struct {
 	NativePlan bool           `json:"nativePlan" schema:"nativePlan"`
 }
 
-// applyGroupedPagination applies request pagination to a parsed GROUP BY query.
+// applyGroupedPagination applies request pagination to a parsed GROUP BY or
+// SELECT query.
 // Aggregated mode: limit/page are standard row pagination. Bucketed mode:
 // limit = items per bucket, buckets = groups per page, page/offset paginate groups.
 func groupedPageOffset(page, pageSize int) int {
@@ -81,8 +83,8 @@ func applyGroupedPagination(parsed *mrql.Query, limit, buckets, page, directOffs
 		parsed.Limit = limit
 	}
 
-	if len(parsed.GroupBy.Aggregates) > 0 {
-		// Aggregated: standard LIMIT/OFFSET row pagination.
+	if parsed.IsTabular() {
+		// Aggregated or projected: standard LIMIT/OFFSET row pagination.
 		if page >= 1 {
 			effectiveLimit := parsed.Limit
 			if effectiveLimit < 0 {
@@ -116,6 +118,38 @@ func applyGroupedPagination(parsed *mrql.Query, limit, buckets, page, directOffs
 	}
 }
 
+// applyMRQLCursor puts a non-grouped query into keyset pagination mode. With no
+// cursor the query runs from its first row and, when its ORDER BY can be
+// resumed, the response carries a nextCursor; an order that cannot (RANDOM(),
+// meta keys, ...) keeps plain OFFSET paging. A cursor resumes after the row it
+// was minted from and replaces the page number, so the two are exclusive.
+func applyMRQLCursor(parsed *mrql.Query, cursor string, page int) error {
+	if cursor == "" {
+		if !parsed.IsGrouped() {
+			if _, err := mrql.KeysetFields(parsed); err == nil {
+				parsed.Keyset = true
+			}
+		}
+		return nil
+	}
+	if parsed.IsGrouped() {
+		return &mrql.CursorError{Message: "cursor pagination is not available for GROUP BY or SELECT queries; use offset"}
+	}
+	if page > 1 {
+		return errors.New("cursor and page cannot be combined")
+	}
+	after, err := mrql.DecodeCursor(cursor)
+	if err != nil {
+		return err
+	}
+	if _, err := mrql.KeysetFields(parsed); err != nil {
+		return err
+	}
+	parsed.Keyset = true
+	parsed.After = after
+	return nil
+}
+
 // collectMRQLParams merges JSON-body param bindings with url `param.<name>=`
 // query parameters (CLI/curl-friendly, always strings). Query parameters win on
 // key collisions. Returns nil when no params were supplied.
@@ -150,6 +184,10 @@ type mrqlCompleteRequest struct {
 	Filter     bool   `json:"filter" schema:"filter"`
 }
 
+type mrqlFormatRequest struct {
+	Query string `json:"query" schema:"query"`
+}
+
 type mrqlGenerateRequest struct {
 	Prompt string `json:"prompt" schema:"prompt"`
 }
@@ -160,6 +198,14 @@ type mrqlValidateResponse struct {
 	Params []string         `json:"params,omitempty"`
 }
 
+// mrqlFormatResponse carries the formatted query, or the parse error that
+// stopped formatting. Changed is false when the query was already canonical.
+type mrqlFormatResponse struct {
+	Formatted string           `json:"formatted,omitempty"`
+	Changed   bool             `json:"changed"`
+	Errors    []map[string]any `json:"errors,omitempty"`
+}
+
 type mrqlCompleteResponse struct {
 	Suggestions any `json:"suggestions"`
 }
@@ -168,6 +214,24 @@ type mrqlSavedQueryRequest struct {
 	Name        string `json:"name" schema:"name"`
 	Query       string `json:"query" schema:"query"`
 	Description string `json:"description" schema:"description"`
+	// Materialized is a pointer so an update that leaves it out keeps the
+	// query's current materialization; the policy fields apply only with it.
+	Materialized           *bool  `json:"materialized" schema:"materialized"`
+	RefreshPolicy          string `json:"refreshPolicy" schema:"refreshPolicy"`
+	RefreshIntervalSeconds int    `json:"refreshIntervalSeconds" schema:"refreshIntervalSeconds"`
+}
+
+// materialization returns the request's materialization settings, and whether
+// it carried any.
+func (r *mrqlSavedQueryRequest) materialization() (application_context.MRQLMaterializationSettings, bool) {
+	if r.Materialized == nil {
+		return application_context.MRQLMaterializationSettings{}, false
+	}
+	return application_context.MRQLMaterializationSettings{
+		Materialized:           *r.Materialized,
+		RefreshPolicy:          r.RefreshPolicy,
+		RefreshIntervalSeconds: r.RefreshIntervalSeconds,
+	}, true
 }
 
 // buildPluginRenderer creates a PluginRenderer from the app context's plugin manager.
@@ -383,10 +447,11 @@ func renderMRQLCustomTemplates(appCtx MRQLAPIContext, result *application_contex
 }
 
 // renderMRQLGroupedCustomTemplates processes CustomMRQLResult templates for bucketed
-// GROUP BY results. Aggregated results have no entities so they're skipped.
+// GROUP BY results. Aggregated and projected results have no entities so
+// they're skipped.
 func renderMRQLGroupedCustomTemplates(appCtx MRQLAPIContext, result *application_context.MRQLGroupedResult, parent context.Context) error {
 	if result.Mode != "bucketed" {
-		return nil // aggregated results are summary rows, not entities
+		return nil // aggregated and projected results are rows, not entities
 	}
 	reqCtx, cancel := buildMRQLAPIRenderContext(parent, appCtx, false)
 	defer cancel()
@@ -498,11 +563,16 @@ func GetExecuteMRQLHandler(ctx MRQLAPIContext) func(http.ResponseWriter, *http.R
 			return
 		}
 
-		// GROUP BY queries use a separate execution path
-		if parsed.GroupBy != nil {
+		if err := applyMRQLCursor(parsed, req.Cursor, req.Page); err != nil {
+			http_utils.HandleError(err, writer, request, http.StatusBadRequest)
+			return
+		}
+
+		// GROUP BY and SELECT queries use a separate execution path
+		if parsed.IsGrouped() {
 			entityType := mrql.ExtractEntityType(parsed)
 			if entityType == mrql.EntityUnspecified {
-				http_utils.HandleError(errors.New("GROUP BY requires an explicit entity type"), writer, request, http.StatusBadRequest)
+				http_utils.HandleError(errors.New("GROUP BY and SELECT require an explicit entity type"), writer, request, http.StatusBadRequest)
 				return
 			}
 			parsed.EntityType = entityType
@@ -576,6 +646,28 @@ func GetValidateMRQLHandler(ctx MRQLAPIContext) func(http.ResponseWriter, *http.
 	}
 }
 
+// GetFormatMRQLHandler handles POST /v1/mrql/format — rewrite a query in
+// canonical layout. A query that does not parse is reported like validate does,
+// with 200 and an errors array.
+func GetFormatMRQLHandler(ctx MRQLAPIContext) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		var req mrqlFormatRequest
+		if err := tryFillStructValuesFromRequest(&req, request); err != nil {
+			http_utils.HandleError(err, writer, request, http.StatusBadRequest)
+			return
+		}
+
+		formatted, errs := ctx.FormatMRQL(req.Query)
+
+		writer.Header().Set("Content-Type", constants.JSON)
+		_ = json.NewEncoder(writer).Encode(mrqlFormatResponse{
+			Formatted: formatted,
+			Changed:   errs == nil && formatted != req.Query,
+			Errors:    errs,
+		})
+	}
+}
+
 // lookupSavedMRQLQuery resolves a saved query by id (preferred) or name,
 // mirroring the saved/run fallback (numeric-only names still resolve).
 func lookupSavedMRQLQuery(ctx savedMRQLLookup, id uint, name string) (*models.SavedMRQLQuery, error) {
@@ -791,11 +883,27 @@ func GetCreateSavedMRQLQueryHandler(ctx MRQLAPIContext) func(http.ResponseWriter
 			return
 		}
 
+		// Materialization is checked before the query is created, so a request
+		// that cannot be honoured in full creates nothing.
+		m, hasM := req.materialization()
+		if hasM {
+			if err := application_context.ValidateMRQLMaterialization(req.Query, &m); err != nil {
+				http_utils.HandleError(err, writer, request, http.StatusBadRequest)
+				return
+			}
+		}
+
 		saved, err := effectiveCtx.CreateSavedMRQLQuery(req.Name, req.Query, req.Description)
 		if err != nil {
 			http_utils.HandleError(err, writer, request, statusCodeForError(err, http.StatusBadRequest))
 			return
 		}
+		if hasM && m.Materialized {
+			if saved, err = effectiveCtx.SetSavedMRQLQueryMaterialization(saved.ID, m); err != nil {
+				http_utils.HandleError(err, writer, request, statusCodeForError(err, http.StatusBadRequest))
+				return
+			}
+		}
 
 		writer.Header().Set("Content-Type", constants.JSON)
 		writer.WriteHeader(http.StatusCreated)
@@ -818,11 +926,33 @@ func GetUpdateSavedMRQLQueryHandler(ctx MRQLAPIContext) func(http.ResponseWriter
 			return
 		}
 
+		// Turning materialization off goes first, so the new query text is not
+		// held to a materialization being dropped; turning it on is checked
+		// against the new text before anything is written.
+		m, hasM := req.materialization()
+		if hasM && !m.Materialized {
+			if _, err := ctx.SetSavedMRQLQueryMaterialization(id, m); err != nil {
+				http_utils.HandleError(err, writer, request, statusCodeForError(err, http.StatusBadRequest))
+				return
+			}
+		} else if hasM {
+			if err := application_context.ValidateMRQLMaterialization(req.Query, &m); err != nil {
+				http_utils.HandleError(err, writer, request, http.StatusBadRequest)
+				return
+			}
+		}
+
 		saved, err := ctx.UpdateSavedMRQLQuery(id, req.Name, req.Query, req.Description)
 		if err != nil {
 			http_utils.HandleError(err, writer, request, statusCodeForError(err, http.StatusBadRequest))
 			return
 		}
+		if hasM && m.Materialized {
+			if saved, err = ctx.SetSavedMRQLQueryMaterialization(id, m); err != nil {
+				http_utils.HandleError(err, writer, request, statusCodeForError(err, http.StatusBadRequest))
+				return
+			}
+		}
 
 		writer.Header().Set("Content-Type", constants.JSON)
 		_ = json.NewEncoder(writer).Encode(saved)
@@ -889,8 +1019,24 @@ func GetRunSavedMRQLQueryHandler(ctx MRQLAPIContext) func(http.ResponseWriter, *
 		page := int(http_utils.GetUIntQueryParameter(request, "page", 0))
 		buckets := int(http_utils.GetUIntQueryParameter(request, "buckets", 0))
 		directOffset := int(http_utils.GetUIntQueryParameter(request, "offset", 0))
+		cursor := request.URL.Query().Get("cursor")
 		params := collectMRQLParams(request, savedRunJSONParams(request))
 
+		// A materialized query is served from its stored result, which only
+		// answers the query as saved: any paging or parameter override runs it
+		// live instead.
+		if limit == 0 && page == 0 && buckets == 0 && directOffset == 0 && cursor == "" && len(params) == 0 {
+			flat, grouped, ok, err := ctx.MaterializedMRQLResult(request.Context(), saved, 0)
+			if err != nil {
+				http_utils.HandleError(err, writer, request, statusCodeForError(err, http.StatusBadRequest))
+				return
+			}
+			if ok {
+				writeSavedMRQLRunResult(ctx, writer, request, flat, grouped)
+				return
+			}
+		}
+
 		// Revalidate saved query — schema changes may have invalidated it since save time.
 		parsed, parseErr := mrql.Parse(saved.Query)
 		if parseErr != nil {
@@ -907,11 +1053,15 @@ func GetRunSavedMRQLQueryHandler(ctx MRQLAPIContext) func(http.ResponseWriter, *
 			http_utils.HandleError(fmt.Errorf("saved query is no longer valid: %w", valErr), writer, request, http.StatusBadRequest)
 			return
 		}
+		if err := applyMRQLCursor(parsed, cursor, page); err != nil {
+			http_utils.HandleError(err, writer, request, http.StatusBadRequest)
+			return
+		}
 
-		if parsed.GroupBy != nil {
+		if parsed.IsGrouped() {
 			entityType := mrql.ExtractEntityType(parsed)
 			if entityType == mrql.EntityUnspecified {
-				http_utils.HandleError(errors.New("GROUP BY requires an explicit entity type"), writer, request, http.StatusBadRequest)
+				http_utils.HandleError(errors.New("GROUP BY and SELECT require an explicit entity type"), writer, request, http.StatusBadRequest)
 				return
 			}
 			parsed.EntityType = entityType
@@ -923,17 +1073,7 @@ func GetRunSavedMRQLQueryHandler(ctx MRQLAPIContext) func(http.ResponseWriter, *
 				http_utils.HandleError(err, writer, request, statusCodeForError(err, http.StatusBadRequest))
 				return
 			}
-
-			render := request.URL.Query().Get("render") == "1"
-			if render {
-				if err := renderMRQLGroupedCustomTemplates(ctx, grouped, request.Context()); err != nil {
-					http_utils.HandleError(err, writer, request, http.StatusInternalServerError)
-					return
-				}
-			}
-
-			writer.Header().Set("Content-Type", constants.JSON)
-			_ = json.NewEncoder(writer).Encode(grouped)
+			writeSavedMRQLRunResult(ctx, writer, request, nil, grouped)
 			return
 		}
 
@@ -942,17 +1082,70 @@ func GetRunSavedMRQLQueryHandler(ctx MRQLAPIContext) func(http.ResponseWriter, *
 			http_utils.HandleError(err, writer, request, statusCodeForError(err, http.StatusBadRequest))
 			return
 		}
+		writeSavedMRQLRunResult(ctx, writer, request, result, nil)
+	}
+}
 
-		render := request.URL.Query().Get("render") == "1"
+// writeSavedMRQLRunResult renders custom templates when ?render=1 asks for them
+// and writes whichever of flat or grouped is set.
+func writeSavedMRQLRunResult(ctx MRQLAPIContext, writer http.ResponseWriter, request *http.Request, flat *application_context.MRQLResult, grouped *application_context.MRQLGroupedResult) {
+	render := request.URL.Query().Get("render") == "1"
+	if grouped != nil {
 		if render {
-			if err := renderMRQLCustomTemplates(ctx, result, request.Context()); err != nil {
+			if err := renderMRQLGroupedCustomTemplates(ctx, grouped, request.Context()); err != nil {
 				http_utils.HandleError(err, writer, request, http.StatusInternalServerError)
 				return
 			}
 		}
+		writer.Header().Set("Content-Type", constants.JSON)
+		_ = json.NewEncoder(writer).Encode(grouped)
+		return
+	}
+
+	if render {
+		if err := renderMRQLCustomTemplates(ctx, flat, request.Context()); err != nil {
+			http_utils.HandleError(err, writer, request, http.StatusInternalServerError)
+			return
+		}
+	}
+	writer.Header().Set("Content-Type", constants.JSON)
+	_ = json.NewEncoder(writer).Encode(flat)
+}
+
+// GetRefreshSavedMRQLQueryHandler handles POST /v1/mrql/saved/refresh?id=N or
+// ?name=X — recompute a materialized saved query's stored result now.
+func GetRefreshSavedMRQLQueryHandler(ctx MRQLAPIContext) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		id := http_utils.GetUIntQueryParameter(request, "id", 0)
+		name := http_utils.GetQueryParameter(request, "name", "")
+
+		var saved *models.SavedMRQLQuery
+		var err error
+		// Same id-then-name lookup as the run handler, for the same reason.
+		if id != 0 {
+			saved, err = ctx.GetSavedMRQLQuery(id)
+			if err != nil && name != "" {
+				saved, err = ctx.GetSavedMRQLQueryByName(name)
+			}
+		} else if name != "" {
+			saved, err = ctx.GetSavedMRQLQueryByName(name)
+		} else {
+			http_utils.HandleError(errors.New("saved MRQL query id or name is required"), writer, request, http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http_utils.HandleError(err, writer, request, statusCodeForError(err, http.StatusNotFound))
+			return
+		}
+
+		info, err := ctx.RefreshSavedMRQLQuery(request.Context(), saved.ID)
+		if err != nil {
+			http_utils.HandleError(err, writer, request, statusCodeForError(err, http.StatusBadRequest))
+			return
+		}
 
 		writer.Header().Set("Content-Type", constants.JSON)
-		_ = json.NewEncoder(writer).Encode(result)
+		_ = json.NewEncoder(writer).Encode(info)
 	}
 }
 
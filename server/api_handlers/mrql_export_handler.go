@@ -26,6 +26,7 @@ type mrqlExportRequest struct {
 	Page    int            `json:"page" schema:"page"`
 	Buckets int            `json:"buckets" schema:"buckets"`
 	Offset  int            `json:"offset" schema:"offset"`
+	Cursor  string         `json:"cursor" schema:"cursor"`
 	Params  map[string]any `json:"params" schema:"-"`
 }
 
@@ -82,15 +83,20 @@ func GetExportMRQLHandler(ctx MRQLExportContext) func(http.ResponseWriter, *http
 			return
 		}
 
+		if err := applyMRQLCursor(parsed, req.Cursor, req.Page); err != nil {
+			http_utils.HandleError(err, writer, request, http.StatusBadRequest)
+			return
+		}
+
 		entityType := mrql.ExtractEntityType(parsed)
 		if request.URL.Query().Get("preflight") == "1" {
-			if format == "csv" && parsed.GroupBy == nil && entityType == mrql.EntityUnspecified {
+			if format == "csv" && !parsed.IsGrouped() && entityType == mrql.EntityUnspecified {
 				http_utils.HandleError(errors.New("CSV export requires a single entity type (add type = \"resource|note|group\"); use format=json for cross-entity results"), writer, request, http.StatusBadRequest)
 				return
 			}
-			if parsed.GroupBy != nil {
+			if parsed.IsGrouped() {
 				if entityType == mrql.EntityUnspecified {
-					http_utils.HandleError(errors.New("GROUP BY requires an explicit entity type"), writer, request, http.StatusBadRequest)
+					http_utils.HandleError(errors.New("GROUP BY and SELECT require an explicit entity type"), writer, request, http.StatusBadRequest)
 					return
 				}
 				clone := *parsed
@@ -108,7 +114,7 @@ func GetExportMRQLHandler(ctx MRQLExportContext) func(http.ResponseWriter, *http
 		}
 		filename := fmt.Sprintf("%s-%s.%s", filenameBase, time.Now().Format("2006-01-02"), format)
 
-		if parsed.GroupBy != nil {
+		if parsed.IsGrouped() {
 			exportGrouped(ctx, writer, request, parsed, entityType, format, filename, req)
 			return
 		}
@@ -133,12 +139,14 @@ func exportFlat(ctx MRQLExportContext, writer http.ResponseWriter, request *http
 	if format == "json" {
 		writeDownloadHeaders(writer, filename, "application/json")
 		setDefaultLimitHeader(writer, result.DefaultLimitApplied, result.AppliedLimit)
+		setNextCursorHeader(writer, result.NextCursor)
 		_ = json.NewEncoder(writer).Encode(result)
 		return
 	}
 
 	writeDownloadHeaders(writer, filename, "text/csv")
 	setDefaultLimitHeader(writer, result.DefaultLimitApplied, result.AppliedLimit)
+	setNextCursorHeader(writer, result.NextCursor)
 	cw := csv.NewWriter(writer)
 	defer cw.Flush()
 	_ = cw.Write(flatCSVHeader(entityType))
@@ -158,10 +166,10 @@ func exportFlat(ctx MRQLExportContext, writer http.ResponseWriter, request *http
 	}
 }
 
-// exportGrouped runs a GROUP BY query and streams it as CSV or JSON.
+// exportGrouped runs a GROUP BY or SELECT query and streams it as CSV or JSON.
 func exportGrouped(ctx MRQLExportContext, writer http.ResponseWriter, request *http.Request, parsed *mrql.Query, entityType mrql.EntityType, format, filename string, req mrqlExportRequest) {
 	if entityType == mrql.EntityUnspecified {
-		http_utils.HandleError(errors.New("GROUP BY requires an explicit entity type"), writer, request, http.StatusBadRequest)
+		http_utils.HandleError(errors.New("GROUP BY and SELECT require an explicit entity type"), writer, request, http.StatusBadRequest)
 		return
 	}
 	parsed.EntityType = entityType
@@ -185,7 +193,7 @@ func exportGrouped(ctx MRQLExportContext, writer http.ResponseWriter, request *h
 	cw := csv.NewWriter(writer)
 	defer cw.Flush()
 
-	if grouped.Mode == "aggregated" {
+	if grouped.Mode == "aggregated" || grouped.Mode == "projected" {
 		cols := mrql.AggregatedColumns(parsed)
 		_ = cw.Write(cols)
 		for _, row := range grouped.Rows {
@@ -370,6 +378,14 @@ func setDefaultLimitHeader(writer http.ResponseWriter, applied bool, limit int)
 	}
 }
 
+// setNextCursorHeader exposes the keyset cursor for the next page. A CSV body
+// has nowhere else to carry it; JSON gets it in the body as well.
+func setNextCursorHeader(writer http.ResponseWriter, cursor string) {
+	if cursor != "" {
+		writer.Header().Set("X-MRQL-Next-Cursor", cursor)
+	}
+}
+
 func sanitizeExportFilename(name string) string {
 	name = strings.TrimSpace(name)
 	name = exportFilenameUnsafe.ReplaceAllString(name, "-")
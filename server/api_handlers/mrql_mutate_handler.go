@@ -0,0 +1,99 @@
+package api_handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"mahresources/constants"
+	"mahresources/download_queue"
+	"mahresources/mrql"
+	"mahresources/server/http_utils"
+)
+
+type mrqlMutateRequest struct {
+	Query  string         `json:"query" schema:"query"`
+	DryRun bool           `json:"dryRun" schema:"dryRun"`
+	Params map[string]any `json:"params" schema:"-"`
+}
+
+// GetMutateMRQLHandler handles POST /v1/mrql/mutate — resolve an MRQL
+// mutation (a filter followed by ADD TAGS / REMOVE TAGS / SET / MOVE TO) under
+// the caller's scope. With dryRun it returns the plan (affected count, a
+// sample, and the resolved tag and group IDs) and writes nothing; otherwise it
+// queues the plan as a background job and returns {"jobId", "affected"}
+// (HTTP 202).
+func GetMutateMRQLHandler(ctx MRQLMutationContext) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		var req mrqlMutateRequest
+		if err := tryFillStructValuesFromRequest(&req, request); err != nil {
+			http_utils.HandleError(err, writer, request, http.StatusBadRequest)
+			return
+		}
+		if req.Query == "" {
+			http_utils.HandleError(errors.New("query is required"), writer, request, http.StatusBadRequest)
+			return
+		}
+
+		parsed, err := mrql.ParseMutation(req.Query)
+		if err != nil {
+			http_utils.HandleError(err, writer, request, statusCodeForError(err, http.StatusBadRequest))
+			return
+		}
+		if err := mrql.BindParams(parsed, collectMRQLParams(request, req.Params)); err != nil {
+			http_utils.HandleError(err, writer, request, http.StatusBadRequest)
+			return
+		}
+		if err := mrql.Validate(parsed); err != nil {
+			http_utils.HandleError(err, writer, request, statusCodeForError(err, http.StatusBadRequest))
+			return
+		}
+
+		plan, err := ctx.PlanMRQLMutation(request.Context(), parsed)
+		if err != nil {
+			http_utils.HandleError(err, writer, request, statusCodeForError(err, http.StatusBadRequest))
+			return
+		}
+
+		if req.DryRun {
+			writer.Header().Set("Content-Type", constants.JSON)
+			_ = json.NewEncoder(writer).Encode(plan)
+			return
+		}
+
+		// Recorded at construction for the same reason the group export
+		// records it: the cockpit's SSE stream hides ownerless jobs from
+		// non-admins.
+		var owner *uint
+		if p := ctx.Principal(); p != nil && !p.SuperUser && p.UserID != 0 {
+			id := p.UserID
+			owner = &id
+		}
+
+		job, err := ctx.DownloadManager().SubmitJobWithOptions(download_queue.JobOptions{
+			Source:       download_queue.JobSourceMRQLMutation,
+			InitialPhase: "queued",
+			OwnerUserID:  owner,
+		}, func(jobCtx context.Context, j *download_queue.DownloadJob, sink download_queue.ProgressSink) error {
+			sink.SetPhase("applying")
+			sink.SetPhaseProgress(0, int64(plan.Affected))
+			err := ctx.ApplyMRQLMutation(jobCtx, plan, func(done, total int) {
+				sink.SetPhaseProgress(int64(done), int64(total))
+			})
+			if err != nil {
+				return err
+			}
+			sink.SetPhase("completed")
+			return nil
+		})
+		if err != nil {
+			http_utils.HandleError(err, writer, request, http.StatusServiceUnavailable)
+			return
+		}
+
+		writer.Header().Set("Content-Type", constants.JSON)
+		writer.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(writer).Encode(map[string]any{"jobId": job.ID, "affected": plan.Affected})
+	}
+}
@@ -85,6 +85,29 @@ func GetResourceHandler(ctx contracts.ResourceReader) func(writer http.ResponseW
 	}
 }
 
+// GetResourceTextHandler returns the text extracted from a resource's file.
+// 404 when none has been extracted.
+func GetResourceTextHandler(ctx contracts.ResourceTextReader) func(writer http.ResponseWriter, request *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		var query query_models.EntityIdQuery
+
+		if err := tryFillStructValuesFromRequest(&query, request); err != nil {
+			http_utils.HandleError(err, writer, request, http.StatusBadRequest)
+			return
+		}
+
+		text, err := ctx.GetResourceText(query.ID)
+
+		if err != nil {
+			http_utils.HandleError(err, writer, request, http.StatusNotFound)
+			return
+		}
+
+		writer.Header().Set("Content-Type", constants.JSON)
+		_ = json.NewEncoder(writer).Encode(text)
+	}
+}
+
 // SuggestedTagsResponse is the envelope returned by GetSuggestedTagsHandler.
 // Exported so the OpenAPI registry can derive its schema.
 type SuggestedTagsResponse struct {
@@ -121,7 +144,7 @@ func GetSuggestedTagsHandler(ctx contracts.ResourceSuggestionReader) func(writer
 	}
 }
 
-func GetResourceContentHandler(ctx contracts.ResourceReader) func(writer http.ResponseWriter, request *http.Request) {
+func GetResourceContentHandler(ctx contracts.ResourceContentReader) func(writer http.ResponseWriter, request *http.Request) {
 	return func(writer http.ResponseWriter, request *http.Request) {
 		var query query_models.EntityIdQuery
 		var detailsQuery query_models.ResourceSearchQuery
@@ -161,6 +184,7 @@ func GetResourceContentHandler(ctx contracts.ResourceReader) func(writer http.Re
 			storage = *resource.StorageLocation
 		}
 
+		ctx.RecordResourceView(resource.ID)
 		http.Redirect(writer, request, path.Join("/", storage, resource.GetCleanLocation()), http.StatusFound)
 	}
 }
@@ -220,6 +244,11 @@ func GetResourceUploadHandler(ctx contracts.ResourceCreator, maxUploadSize func(
 			return
 		}
 
+		if formBool(request, "expand") {
+			expandArchiveUploads(writer, request, effectiveCtx, files, creator)
+			return
+		}
+
 		var resources = make([]*models.Resource, len(files))
 		var uploadErrors []error
 
@@ -255,19 +284,27 @@ func GetResourceUploadHandler(ctx contracts.ResourceCreator, maxUploadSize func(
 			allConflict := true
 
 			allBadRequest := true
+			allOverQuota := true
 			for _, err := range uploadErrors {
 				detail := uploadErrorDetail{Error: err.Error()}
 				var resErr *application_context.ResourceExistsError
 				var imgErr *application_context.InvalidImageError
+				var quotaErr *application_context.QuotaExceededError
 				if errors.As(err, &resErr) {
 					detail.ResourceID = resErr.ResourceID
 					allBadRequest = false
+					allOverQuota = false
 				} else if errors.As(err, &imgErr) {
 					allConflict = false
+					allOverQuota = false
 					// allBadRequest stays true
+				} else if errors.As(err, &quotaErr) {
+					allConflict = false
+					allBadRequest = false
 				} else {
 					allConflict = false
 					allBadRequest = false
+					allOverQuota = false
 				}
 				details = append(details, detail)
 				messages = append(messages, err.Error())
@@ -287,6 +324,8 @@ func GetResourceUploadHandler(ctx contracts.ResourceCreator, maxUploadSize func(
 				statusCode = http.StatusConflict
 			} else if allBadRequest {
 				statusCode = http.StatusBadRequest
+			} else if allOverQuota {
+				statusCode = http.StatusInsufficientStorage
 			}
 
 			// Structured JSON response for API / fetch callers
@@ -344,7 +383,7 @@ func GetResourceAddLocalHandler(ctx contracts.ResourceCreator) func(writer http.
 		res, err := effectiveCtx.AddLocalResource(creator.Name, &creator)
 
 		if err != nil {
-			http_utils.HandleError(err, writer, request, http.StatusBadRequest)
+			http_utils.HandleError(err, writer, request, statusCodeForError(err, http.StatusBadRequest))
 			return
 		}
 
@@ -0,0 +1,334 @@
+package api_handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"mahresources/application_context"
+	"mahresources/auth"
+	"mahresources/constants"
+	"mahresources/contracts"
+	"mahresources/models"
+	"mahresources/models/query_models"
+	"mahresources/server/http_utils"
+)
+
+// The tus protocol version these handlers speak, and the extensions they
+// implement. See https://tus.io/protocols/resumable-upload.
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,creation-with-upload,termination,expiration"
+	tusChunkType  = "application/offset+octet-stream"
+)
+
+// resumableUploadListKeys are the metadata keys whose values are
+// comma-separated id lists, as a form would send them repeated.
+var resumableUploadListKeys = map[string]bool{"tags": true, "groups": true, "notes": true}
+
+// parseUploadMetadata decodes an Upload-Metadata header: comma-separated pairs
+// of a key and, optionally, its base64-encoded value.
+func parseUploadMetadata(header string) (map[string]string, error) {
+	meta := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("Upload-Metadata %q is not base64: %w", key, err)
+		}
+		meta[key] = string(value)
+	}
+	return meta, nil
+}
+
+// resourceCreatorFromMetadata reads the fields of the resource to create from
+// upload metadata, with the same names the multipart upload's form fields use.
+func resourceCreatorFromMetadata(meta map[string]string) (*query_models.ResourceCreator, error) {
+	values := url.Values{}
+	for key, value := range meta {
+		if resumableUploadListKeys[strings.ToLower(key)] {
+			for _, id := range strings.Split(value, ",") {
+				if id = strings.TrimSpace(id); id != "" {
+					values.Add(key, id)
+				}
+			}
+			continue
+		}
+		values.Set(key, value)
+	}
+	var creator query_models.ResourceCreator
+	if err := decoder.Decode(&creator, values); err != nil {
+		return nil, err
+	}
+	return &creator, nil
+}
+
+func writeTusError(w http.ResponseWriter, r *http.Request, err error, status int) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	http_utils.HandleError(err, w, r, status)
+}
+
+// checkTusResumable refuses a request that speaks another tus version.
+func checkTusResumable(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("Tus-Resumable") == tusVersion {
+		return true
+	}
+	w.Header().Set("Tus-Version", tusVersion)
+	writeTusError(w, r, fmt.Errorf("Tus-Resumable must be %s", tusVersion), http.StatusPreconditionFailed)
+	return false
+}
+
+func resumableUploadStatus(err error) int {
+	var resErr *application_context.ResourceExistsError
+	var imgErr *application_context.InvalidImageError
+	var quota *application_context.QuotaExceededError
+	switch {
+	case errors.Is(err, application_context.ErrResumableUploadNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, application_context.ErrResumableUploadOffset):
+		return http.StatusConflict
+	case errors.Is(err, application_context.ErrResumableUploadBusy):
+		return http.StatusLocked
+	case errors.Is(err, application_context.ErrResumableUploadTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.As(err, &resErr):
+		return http.StatusConflict
+	case errors.As(err, &imgErr):
+		return http.StatusBadRequest
+	case errors.As(err, &quota):
+		return http.StatusInsufficientStorage
+	case errors.Is(err, application_context.ErrNotAnArchive):
+		return http.StatusBadRequest
+	default:
+		return versionErrorStatus(err)
+	}
+}
+
+// setResumableUploadHeaders describes where an upload stands.
+func setResumableUploadHeaders(w http.ResponseWriter, upload *models.ResumableUpload) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	if upload.ResourceID != nil {
+		w.Header().Set("X-Resource-Id", strconv.FormatUint(uint64(*upload.ResourceID), 10))
+	}
+	if upload.VersionID != nil {
+		w.Header().Set("X-Version-Id", strconv.FormatUint(uint64(*upload.VersionID), 10))
+	}
+	if upload.ExpansionID != nil {
+		w.Header().Set("X-Expansion-Id", strconv.FormatUint(uint64(*upload.ExpansionID), 10))
+	}
+}
+
+// GetResumableUploadOptionsHandler tells a tus client what the server supports.
+func GetResumableUploadOptionsHandler(maxUploadSize func() int64) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Tus-Resumable", tusVersion)
+		w.Header().Set("Tus-Version", tusVersion)
+		w.Header().Set("Tus-Extension", tusExtensions)
+		if maxUploadSize != nil {
+			if limit := maxUploadSize(); limit > 0 {
+				w.Header().Set("Tus-Max-Size", strconv.FormatInt(limit, 10))
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// GetCreateResumableUploadHandler starts an upload. Upload-Metadata names the
+// file ("filename") and carries the resource's fields; a "resourceId" makes the
+// upload a new version of that resource instead, with an optional "comment",
+// and "expand" unpacks an archive into a new group rather than storing it.
+// A body sent with the request is the upload's first chunk.
+func GetCreateResumableUploadHandler(ctx contracts.ResumableUploader, maxUploadSize func() int64) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkTusResumable(w, r) {
+			return
+		}
+		effectiveCtx := withRequestContext(ctx, r).(contracts.ResumableUploader)
+
+		if r.Header.Get("Upload-Defer-Length") != "" {
+			writeTusError(w, r, errors.New("Upload-Defer-Length is not supported"), http.StatusBadRequest)
+			return
+		}
+		length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+		if err != nil || length < 0 {
+			writeTusError(w, r, errors.New("Upload-Length must be a non-negative number"), http.StatusBadRequest)
+			return
+		}
+		if maxUploadSize != nil {
+			if limit := maxUploadSize(); limit > 0 && length > limit {
+				writeTusError(w, r, fmt.Errorf("the upload is larger than the %d byte limit", limit), http.StatusRequestEntityTooLarge)
+				return
+			}
+		}
+
+		meta, err := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+		if err != nil {
+			writeTusError(w, r, err, http.StatusBadRequest)
+			return
+		}
+		kind := models.ResumableUploadResource
+		var quotaResourceID, quotaOwnerID uint
+		if raw, ok := meta["resourceId"]; ok {
+			if expand, _ := strconv.ParseBool(meta["expand"]); expand {
+				writeTusError(w, r, errors.New("a new version cannot be expanded as an archive"), http.StatusBadRequest)
+				return
+			}
+			kind = models.ResumableUploadVersion
+			resourceID, err := strconv.ParseUint(raw, 10, 64)
+			if err != nil {
+				writeTusError(w, r, fmt.Errorf("invalid resourceId"), http.StatusBadRequest)
+				return
+			}
+			if _, err := effectiveCtx.GetResource(uint(resourceID)); err != nil {
+				writeTusError(w, r, fmt.Errorf("resource %d not found", resourceID), http.StatusNotFound)
+				return
+			}
+			quotaResourceID = uint(resourceID)
+		} else if creator, err := resourceCreatorFromMetadata(meta); err != nil {
+			writeTusError(w, r, err, http.StatusBadRequest)
+			return
+		} else {
+			quotaOwnerID = creator.OwnerId
+		}
+
+		// Refuse up front an upload the quota could never take, rather than
+		// after every byte has been sent.
+		if err := effectiveCtx.CheckUploadQuota(quotaResourceID, quotaOwnerID, length); err != nil {
+			writeTusError(w, r, err, resumableUploadStatus(err))
+			return
+		}
+
+		upload, err := effectiveCtx.CreateResumableUpload(kind, length, meta, principalOwnerID(auth.PrincipalFromContext(r.Context())))
+		if err != nil {
+			writeTusError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Location", "/v1/uploads/"+upload.ID)
+
+		// An upload of nothing is complete as soon as it exists.
+		if r.Header.Get("Content-Type") == tusChunkType || length == 0 {
+			writeResumableChunk(effectiveCtx, w, r, upload.ID, 0, http.StatusCreated)
+			return
+		}
+		setResumableUploadHeaders(w, upload)
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+// GetResumableUploadHeadHandler reports how many bytes of an upload have
+// arrived, and, once it is complete, what it created.
+func GetResumableUploadHeadHandler(ctx contracts.ResumableUploader) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ownerID, restricted := historyScope(auth.PrincipalFromContext(r.Context()))
+		upload, err := ctx.GetResumableUpload(mux.Vars(r)["id"], ownerID, restricted)
+		if err != nil {
+			w.Header().Set("Tus-Resumable", tusVersion)
+			w.WriteHeader(resumableUploadStatus(err))
+			return
+		}
+		setResumableUploadHeaders(w, upload)
+		w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// GetResumableUploadPatchHandler appends a chunk to an upload. The chunk that
+// completes it creates the resource or version before the response is sent.
+func GetResumableUploadPatchHandler(ctx contracts.ResumableUploader) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkTusResumable(w, r) {
+			return
+		}
+		if r.Header.Get("Content-Type") != tusChunkType {
+			writeTusError(w, r, fmt.Errorf("Content-Type must be %s", tusChunkType), http.StatusUnsupportedMediaType)
+			return
+		}
+		offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+		if err != nil || offset < 0 {
+			writeTusError(w, r, errors.New("Upload-Offset must be a non-negative number"), http.StatusBadRequest)
+			return
+		}
+		effectiveCtx := withRequestContext(ctx, r).(contracts.ResumableUploader)
+		writeResumableChunk(effectiveCtx, w, r, mux.Vars(r)["id"], offset, http.StatusNoContent)
+	}
+}
+
+// writeResumableChunk stores the request body at offset and, when that was the
+// last of the upload, completes it.
+func writeResumableChunk(ctx contracts.ResumableUploader, w http.ResponseWriter, r *http.Request, id string, offset int64, status int) {
+	ownerID, restricted := historyScope(auth.PrincipalFromContext(r.Context()))
+	upload, err := ctx.WriteResumableUpload(id, ownerID, restricted, offset, r.Body)
+	if err != nil {
+		if upload != nil {
+			setResumableUploadHeaders(w, upload)
+		}
+		writeTusError(w, r, err, resumableUploadStatus(err))
+		return
+	}
+
+	if upload.Offset == upload.Length && upload.FinishedAt == nil {
+		var creator *query_models.ResourceCreator
+		if upload.Kind == models.ResumableUploadResource {
+			if creator, err = resourceCreatorFromMetadata(application_context.ResumableUploadMetadata(upload)); err != nil {
+				writeTusError(w, r, err, http.StatusBadRequest)
+				return
+			}
+		}
+		completed, err := ctx.CompleteResumableUpload(id, creator)
+		if err != nil {
+			setResumableUploadHeaders(w, upload)
+			writeResumableCompletionError(w, r, err)
+			return
+		}
+		upload = completed
+	}
+	setResumableUploadHeaders(w, upload)
+	w.WriteHeader(status)
+}
+
+// writeResumableCompletionError reports a failed completion. A duplicate
+// carries the existing resource's id in the multipart upload's error shape.
+func writeResumableCompletionError(w http.ResponseWriter, r *http.Request, err error) {
+	var resErr *application_context.ResourceExistsError
+	if !errors.As(err, &resErr) {
+		writeTusError(w, r, err, resumableUploadStatus(err))
+		return
+	}
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Content-Type", constants.JSON)
+	w.WriteHeader(http.StatusConflict)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"error":   err.Error(),
+		"details": []uploadErrorDetail{{Error: err.Error(), ResourceID: resErr.ResourceID}},
+	})
+}
+
+// GetResumableUploadDeleteHandler abandons an upload.
+func GetResumableUploadDeleteHandler(ctx contracts.ResumableUploader) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkTusResumable(w, r) {
+			return
+		}
+		ownerID, restricted := historyScope(auth.PrincipalFromContext(r.Context()))
+		if err := ctx.DeleteResumableUpload(mux.Vars(r)["id"], ownerID, restricted); err != nil {
+			writeTusError(w, r, err, resumableUploadStatus(err))
+			return
+		}
+		w.Header().Set("Tus-Resumable", tusVersion)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
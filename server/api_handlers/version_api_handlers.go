@@ -2,6 +2,7 @@ package api_handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"mime"
 	"net/http"
@@ -9,6 +10,7 @@ import (
 	"strconv"
 	"strings"
 
+	"mahresources/application_context"
 	"mahresources/constants"
 	"mahresources/contracts"
 	"mahresources/models"
@@ -23,6 +25,10 @@ func versionErrorStatus(err error) int {
 	if err == nil {
 		return http.StatusOK
 	}
+	var quota *application_context.QuotaExceededError
+	if errors.As(err, &quota) {
+		return http.StatusInsufficientStorage
+	}
 	msg := strings.ToLower(err.Error())
 	switch {
 	case strings.Contains(msg, "not found"):
@@ -206,6 +212,11 @@ func GetVersionFileHandler(ctx contracts.VersionFileServer) func(http.ResponseWr
 			return
 		}
 
+		if issue := ctx.QuarantinedBlob(version.StorageLocation, version.Location); issue != nil {
+			http_utils.HandleError(errors.New(application_context.QuarantineMessage(issue)), w, r, http.StatusConflict)
+			return
+		}
+
 		file, err := fs.Open(version.Location)
 		if err != nil {
 			http_utils.HandleError(err, w, r, http.StatusNotFound)
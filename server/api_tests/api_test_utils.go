@@ -48,6 +48,12 @@ func SetupTestEnv(t *testing.T) *TestContext {
 // mutate callback adjusts the MahresourcesConfig before the context is built,
 // letting tests enable auth or tweak other settings without duplicating setup.
 func setupTestEnvWithConfig(t *testing.T, mutate func(*application_context.MahresourcesConfig)) *TestContext {
+	return setupTestEnvWithFs(t, afero.NewMemMapFs(), mutate)
+}
+
+// setupTestEnvWithFs is setupTestEnvWithConfig over a given main filesystem.
+// Alt filesystems set by mutate are served too, as main.go serves them.
+func setupTestEnvWithFs(t *testing.T, fs afero.Fs, mutate func(*application_context.MahresourcesConfig)) *TestContext {
 	// One in-memory SQLite database per test, keyed on the test name so tests never
 	// see each other's rows.
 	//
@@ -108,6 +114,7 @@ func setupTestEnvWithConfig(t *testing.T, mutate func(*application_context.Mahre
 		&models.PluginState{},
 		&models.PluginKV{},
 		&models.SavedMRQLQuery{},
+		&models.MRQLMaterialization{},
 		&models.TemplatePartial{},
 		&models.RuntimeSetting{},
 		&models.User{},
@@ -116,6 +123,23 @@ func setupTestEnvWithConfig(t *testing.T, mutate func(*application_context.Mahre
 		&models.ApiToken{},
 		&models.DownloadHistoryEntry{},
 		&models.PluginSchedule{},
+		&models.BlobIntegrityIssue{},
+		&models.BlobScrubRun{},
+		&models.BlobGCRun{},
+		&models.ContentHashMigrationRun{},
+		&models.EncryptionRotationRun{},
+		&models.ResourceView{},
+		&models.StorageTierPin{},
+		&models.StorageTierRun{},
+		&models.ResumableUpload{},
+		&models.StorageQuota{},
+		&models.StorageUsage{},
+		&models.StorageUsageBlob{},
+		&models.StorageCharge{},
+		&models.ArchiveExpansion{},
+		&models.WatchFolder{},
+		&models.WatchedFile{},
+		&models.ResourceText{},
 	)
 	if err != nil {
 		t.Fatalf("Failed to migrate database: %v", err)
@@ -123,6 +147,12 @@ func setupTestEnvWithConfig(t *testing.T, mutate func(*application_context.Mahre
 	if err := models.EnsureSupplementalIndexes(db); err != nil {
 		t.Fatalf("Failed to create supplemental indexes: %v", err)
 	}
+	if err := models.EnsureNoteBlockSearch(db); err != nil {
+		t.Fatalf("Failed to create note block search triggers: %v", err)
+	}
+	if err := models.EnsureEntityHistory(db); err != nil {
+		t.Fatalf("Failed to create entity history triggers: %v", err)
+	}
 
 	seed.AddInitialData(db)
 
@@ -146,13 +176,6 @@ func setupTestEnvWithConfig(t *testing.T, mutate func(*application_context.Mahre
 		AllowPrivateFetch: []string{"127.0.0.1", "::1"},
 	}
 
-	// Mock filesystem
-	fs := afero.NewMemMapFs()
-	// CreateServer expects map[string]string for paths, but we want to control them.
-	// However, NewMahresourcesContext creates proper FS objects from them.
-	// For testing, we can just pass empty or temp paths if we don't strictly test AltFileSystems logic here.
-	altFsPaths := make(map[string]string)
-
 	// We need the sqlx DB for readOnlyDB param
 	// For sqlite in memory, we can just pass the underlying sql.DB if compatible or nil if not strictly used in write ops tested here
 	// context.go NewMahresourcesContext takes *sqlx.DB.
@@ -184,7 +207,7 @@ func setupTestEnvWithConfig(t *testing.T, mutate func(*application_context.Mahre
 
 	// Create request handler using the actual server setup
 	// CreateServer takes altFs as map[string]string
-	serverInstance := server.CreateServer(appCtx, fs, altFsPaths)
+	serverInstance := server.CreateServer(appCtx, fs, config.AltFileSystems)
 
 	return &TestContext{
 		AppCtx: appCtx,
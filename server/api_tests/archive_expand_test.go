@@ -0,0 +1,118 @@
+package api_tests
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"mahresources/models"
+)
+
+func createTestZip(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range files {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(body))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func waitForExpansion(t *testing.T, tc *TestContext, id uint) models.ArchiveExpansion {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		resp := tc.MakeRequest(http.MethodGet, "/v1/resource/expansion?id="+strconv.Itoa(int(id)), nil)
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		var expansion models.ArchiveExpansion
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &expansion))
+		if expansion.FinishedAt != nil {
+			return expansion
+		}
+		require.True(t, time.Now().Before(deadline), "expansion %d did not finish", id)
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestArchiveExpansion_UploadWithExpandUnpacksTheZipIntoAGroup(t *testing.T) {
+	tc := SetupTestEnv(t)
+	owner := tc.CreateDummyGroup("Imports")
+	archive := createTestZip(t, map[string]string{"scans/one.txt": "one", "two.txt": "two"})
+
+	body, ct := makeMultipartUpload(t, "resource", "letters.zip", archive, map[string]string{"OwnerId": strconv.Itoa(int(owner.ID)), "expand": "true"})
+	resp := tc.makeMultipartRequest(t, http.MethodPost, "/v1/resource", body, ct)
+	require.Equal(t, http.StatusAccepted, resp.Code, resp.Body.String())
+	var started struct {
+		Expansions []models.ArchiveExpansion `json:"expansions"`
+	}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &started))
+	require.Len(t, started.Expansions, 1)
+	assert.NotEmpty(t, started.Expansions[0].JobID)
+
+	expansion := waitForExpansion(t, tc, started.Expansions[0].ID)
+	require.Empty(t, expansion.Error)
+	assert.EqualValues(t, 2, expansion.Created)
+	require.NotNil(t, expansion.GroupID)
+
+	var group models.Group
+	require.NoError(t, tc.DB.First(&group, *expansion.GroupID).Error)
+	assert.Equal(t, "letters", group.Name)
+	require.NotNil(t, group.OwnerId)
+	assert.Equal(t, owner.ID, *group.OwnerId)
+
+	var scanned models.Resource
+	require.NoError(t, tc.DB.Where("original_location = ?", "scans/one.txt").First(&scanned).Error)
+	var scans models.Group
+	require.NoError(t, tc.DB.First(&scans, *scanned.OwnerId).Error)
+	assert.Equal(t, "scans", scans.Name)
+	assert.Equal(t, group.ID, *scans.OwnerId)
+
+	var zips int64
+	tc.DB.Model(&models.Resource{}).Where("name = ?", "letters.zip").Count(&zips)
+	assert.Zero(t, zips, "the archive itself was stored as a resource")
+}
+
+func TestArchiveExpansion_RefusesAFileThatIsNotAnArchive(t *testing.T) {
+	tc := SetupTestEnv(t)
+	body, ct := makeMultipartUpload(t, "resource", "photo.png", createTestPNG(t, 10, 10), map[string]string{"expand": "true"})
+	resp := tc.makeMultipartRequest(t, http.MethodPost, "/v1/resource", body, ct)
+	assert.Equal(t, http.StatusBadRequest, resp.Code, resp.Body.String())
+	assert.Contains(t, resp.Body.String(), "not a zip or tar archive")
+
+	resp = tc.MakeRequest(http.MethodGet, "/v1/resource/expansion?id=999", nil)
+	assert.Equal(t, http.StatusNotFound, resp.Code, resp.Body.String())
+}
+
+func TestArchiveExpansion_AResumableUploadWithExpandStartsAnExpansion(t *testing.T) {
+	tc := SetupTestEnv(t)
+	archive := createTestZip(t, map[string]string{"a.txt": "resumable"})
+
+	resp := tusRequest(t, tc, http.MethodPost, "/v1/uploads", archive, map[string]string{
+		"Upload-Length":   strconv.Itoa(len(archive)),
+		"Upload-Metadata": tusMetadata("filename", "sent.zip", "expand", "true"),
+	})
+	require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+	assert.Empty(t, resp.Header().Get("X-Resource-Id"))
+	id, err := strconv.Atoi(resp.Header().Get("X-Expansion-Id"))
+	require.NoError(t, err, "no X-Expansion-Id header")
+
+	expansion := waitForExpansion(t, tc, uint(id))
+	assert.Equal(t, "sent.zip", expansion.FileName)
+	assert.EqualValues(t, 1, expansion.Created)
+
+	resp = tusRequest(t, tc, http.MethodPost, "/v1/uploads", nil, map[string]string{
+		"Upload-Length":   "10",
+		"Upload-Metadata": tusMetadata("filename", "v.zip", "resourceId", "1", "expand", "true"),
+	})
+	assert.Equal(t, http.StatusBadRequest, resp.Code, resp.Body.String())
+}
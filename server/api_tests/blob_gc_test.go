@@ -0,0 +1,66 @@
+package api_tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"mahresources/application_context"
+	"mahresources/download_queue"
+)
+
+func runGCJob(t *testing.T, tc *TestContext, query string) application_context.BlobGCReport {
+	t.Helper()
+	resp := tc.MakeRequest(http.MethodPost, "/v1/admin/gc"+query, nil)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	var start application_context.BlobGCStart
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &start))
+	waitForJobStatus(t, tc, start.JobID, download_queue.JobStatusCompleted)
+
+	statusResp := tc.MakeRequest(http.MethodGet, fmt.Sprintf("/v1/admin/gc?id=%d", start.RunID), nil)
+	require.Equal(t, http.StatusOK, statusResp.Code, statusResp.Body.String())
+	var status application_context.BlobGCStatus
+	require.NoError(t, json.Unmarshal(statusResp.Body.Bytes(), &status))
+	require.NotNil(t, status.Run)
+	require.NotNil(t, status.Run.FinishedAt)
+	var report application_context.BlobGCReport
+	require.NoError(t, json.Unmarshal(status.Run.Report, &report))
+	return report
+}
+
+func TestBlobGC_DryRunThenCollect(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	tc := setupTestEnvWithFs(t, fs, nil)
+	res := uploadScrubResource(t, tc, createTestPNG(t, 16, 16), map[string]string{"Name": "referenced"})
+
+	orphan := "/resources/ff/ff/ff/ffffff.png"
+	require.NoError(t, afero.WriteFile(fs, orphan, []byte("left behind"), 0644))
+	old := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, fs.Chtimes(orphan, old, old))
+
+	report := runGCJob(t, tc, "?dryRun=true&grace=1h")
+	require.Len(t, report.Filesystems, 1)
+	assert.Equal(t, []string{orphan}, report.Filesystems[0].Orphans)
+	exists, _ := afero.Exists(fs, orphan)
+	assert.True(t, exists, "the dry run deleted the orphan")
+
+	report = runGCJob(t, tc, "?grace=1h")
+	assert.Equal(t, int64(1), report.Filesystems[0].DeletedFiles)
+	assert.Equal(t, int64(len("left behind")), report.Filesystems[0].ReclaimedBytes)
+	exists, _ = afero.Exists(fs, orphan)
+	assert.False(t, exists, "the orphan was not collected")
+	assert.Equal(t, http.StatusOK, fetchResourceFile(t, tc, res.ID).Code, "the referenced file was collected")
+}
+
+func TestBlobGC_RejectsABadGracePeriod(t *testing.T) {
+	tc := SetupTestEnv(t)
+	for _, grace := range []string{"soon", "-1h"} {
+		resp := tc.MakeRequest(http.MethodPost, "/v1/admin/gc?grace="+grace, nil)
+		assert.Equal(t, http.StatusBadRequest, resp.Code, "grace=%s: %s", grace, resp.Body.String())
+	}
+}
@@ -0,0 +1,130 @@
+package api_tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"mahresources/application_context"
+	"mahresources/download_queue"
+	"mahresources/models"
+)
+
+func uploadScrubResource(t *testing.T, tc *TestContext, payload []byte, extras map[string]string) models.Resource {
+	t.Helper()
+	body, ct := makeMultipartUpload(t, "resource", "scrub.png", payload, extras)
+	resp := tc.makeMultipartRequest(t, http.MethodPost, "/v1/resource", body, ct)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	var resources []models.Resource
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &resources))
+	require.Len(t, resources, 1)
+	return resources[0]
+}
+
+// fetchResourceFile follows /v1/resource/view to the file server.
+func fetchResourceFile(t *testing.T, tc *TestContext, id uint) *httptest.ResponseRecorder {
+	t.Helper()
+	resp := tc.MakeRequest(http.MethodGet, fmt.Sprintf("/v1/resource/view?id=%d", id), nil)
+	require.Equal(t, http.StatusFound, resp.Code, resp.Body.String())
+	return tc.MakeRequest(http.MethodGet, resp.Header().Get("Location"), nil)
+}
+
+func runScrubJob(t *testing.T, tc *TestContext, query string) application_context.BlobScrubStart {
+	t.Helper()
+	resp := tc.MakeRequest(http.MethodPost, "/v1/admin/scrub"+query, nil)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	var start application_context.BlobScrubStart
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &start))
+	waitForJobStatus(t, tc, start.JobID, download_queue.JobStatusCompleted)
+	return start
+}
+
+func TestBlobScrub_QuarantinesDamagedFilesUntilRechecked(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	tc := setupTestEnvWithFs(t, fs, nil)
+	res := uploadScrubResource(t, tc, createTestPNG(t, 32, 32), map[string]string{"Name": "scrubbed"})
+	v2 := createTestPNG(t, 40, 40)
+	body, ct := makeMultipartUpload(t, "file", "v2.png", v2, map[string]string{"comment": "second"})
+	resp := tc.makeMultipartRequest(t, http.MethodPost, fmt.Sprintf("/v1/resource/versions?resourceId=%d", res.ID), body, ct)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	var version models.ResourceVersion
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &version))
+
+	require.Equal(t, http.StatusOK, fetchResourceFile(t, tc, res.ID).Code)
+
+	// v2 is the resource's current content and shares its file, so truncating
+	// that file is one issue, against the resource, and quarantines both the
+	// resource and the version download.
+	var current models.Resource
+	require.NoError(t, tc.DB.First(&current, res.ID).Error)
+	require.Equal(t, version.Location, current.Location)
+	require.NoError(t, afero.WriteFile(fs, current.Location, v2[:len(v2)/2], 0644))
+
+	start := runScrubJob(t, tc, "")
+	assert.False(t, start.Resumed)
+
+	file := fetchResourceFile(t, tc, res.ID)
+	assert.Equal(t, http.StatusConflict, file.Code, "a quarantined file was served")
+	assert.Contains(t, file.Body.String(), "quarantined")
+
+	versionFile := tc.MakeRequest(http.MethodGet, fmt.Sprintf("/v1/resource/version/file?versionId=%d", version.ID), nil)
+	assert.Equal(t, http.StatusConflict, versionFile.Code, "a quarantined version file was served")
+
+	report := tc.MakeRequest(http.MethodGet, "/v1/admin/scrub/issues?status=quarantined", nil)
+	require.Equal(t, http.StatusOK, report.Code, report.Body.String())
+	var issues []models.BlobIntegrityIssue
+	require.NoError(t, json.Unmarshal(report.Body.Bytes(), &issues))
+	require.Len(t, issues, 1, report.Body.String())
+	assert.Equal(t, models.BlobEntityResource, issues[0].EntityType)
+	assert.Equal(t, models.BlobProblemTruncated, issues[0].Problem)
+
+	statusResp := tc.MakeRequest(http.MethodGet, "/v1/admin/scrub", nil)
+	require.Equal(t, http.StatusOK, statusResp.Code)
+	var status application_context.BlobScrubStatus
+	require.NoError(t, json.Unmarshal(statusResp.Body.Bytes(), &status))
+	require.NotNil(t, status.Run)
+	assert.NotNil(t, status.Run.FinishedAt)
+	assert.Equal(t, int64(1), status.Issues[models.BlobStatusQuarantined])
+
+	// Restoring the file and rechecking lifts the quarantine.
+	require.NoError(t, afero.WriteFile(fs, current.Location, v2, 0644))
+	recheck := tc.MakeRequest(http.MethodPost, fmt.Sprintf("/v1/admin/scrub/recheck?id=%d", issues[0].ID), nil)
+	require.Equal(t, http.StatusOK, recheck.Code, recheck.Body.String())
+	var rechecked models.BlobIntegrityIssue
+	require.NoError(t, json.Unmarshal(recheck.Body.Bytes(), &rechecked))
+	assert.Equal(t, models.BlobStatusCleared, rechecked.Status)
+	assert.Equal(t, http.StatusOK, fetchResourceFile(t, tc, res.ID).Code)
+}
+
+func TestBlobScrub_ResumesAnUnfinishedRun(t *testing.T) {
+	tc := SetupTestEnv(t)
+	uploadScrubResource(t, tc, createTestPNG(t, 8, 8), map[string]string{"Name": "resume"})
+
+	unfinished := models.BlobScrubRun{Phase: models.BlobEntityVersion, Checked: 1}
+	require.NoError(t, tc.DB.Create(&unfinished).Error)
+
+	start := runScrubJob(t, tc, "")
+	assert.True(t, start.Resumed)
+	assert.Equal(t, unfinished.ID, start.RunID)
+	assert.Equal(t, models.BlobEntityVersion, start.Phase)
+
+	var run models.BlobScrubRun
+	require.NoError(t, tc.DB.First(&run, unfinished.ID).Error)
+	assert.NotNil(t, run.FinishedAt)
+	assert.Equal(t, int64(1), run.Checked, "the resumed run re-checked the resource phase it had finished")
+
+	restarted := runScrubJob(t, tc, "?restart=true")
+	assert.False(t, restarted.Resumed)
+	assert.NotEqual(t, unfinished.ID, restarted.RunID)
+}
+
+func TestBlobScrub_UnknownIssueIsNotFound(t *testing.T) {
+	tc := SetupTestEnv(t)
+	resp := tc.MakeRequest(http.MethodPost, "/v1/admin/scrub/recheck?id=999", nil)
+	assert.Equal(t, http.StatusNotFound, resp.Code, resp.Body.String())
+}
@@ -0,0 +1,60 @@
+package api_tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"mahresources/application_context"
+	"mahresources/download_queue"
+	"mahresources/models"
+)
+
+func TestContentHashMigration_RehashesSHA1ResourcesFoundByEitherHash(t *testing.T) {
+	tc := setupTestEnvWithFs(t, afero.NewMemMapFs(), nil)
+	fresh := uploadScrubResource(t, tc, createTestPNG(t, 16, 16), map[string]string{"Name": "fresh"})
+	assert.Equal(t, models.HashTypeSHA256, fresh.HashType)
+	assert.Len(t, fresh.Hash, 64)
+	assert.Len(t, fresh.LegacyHash, 40)
+
+	// Put the second resource back the way it was stored before SHA-256.
+	old := uploadScrubResource(t, tc, createTestPNG(t, 24, 24), map[string]string{"Name": "old"})
+	require.NoError(t, tc.DB.Model(&models.Resource{}).Where("id = ?", old.ID).
+		UpdateColumns(map[string]any{"hash": old.LegacyHash, "hash_type": models.HashTypeSHA1, "legacy_hash": ""}).Error)
+	require.NoError(t, tc.DB.Model(&models.ResourceVersion{}).Where("resource_id = ?", old.ID).
+		UpdateColumns(map[string]any{"hash": old.LegacyHash, "hash_type": models.HashTypeSHA1, "legacy_hash": ""}).Error)
+
+	resp := tc.MakeRequest(http.MethodPost, "/v1/admin/rehash", nil)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	var start application_context.ContentHashMigrationStart
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &start))
+	waitForJobStatus(t, tc, start.JobID, download_queue.JobStatusCompleted)
+
+	resp = tc.MakeRequest(http.MethodGet, "/v1/admin/rehash", nil)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	var status application_context.ContentHashMigrationStatus
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &status))
+	require.NotNil(t, status.Run)
+	assert.NotNil(t, status.Run.FinishedAt)
+	assert.Zero(t, status.Run.Skipped)
+	assert.Equal(t, map[string]int64{models.BlobEntityResource: 0, models.BlobEntityVersion: 0}, status.Remaining)
+
+	var migrated models.Resource
+	require.NoError(t, tc.DB.First(&migrated, old.ID).Error)
+	assert.Equal(t, old.Hash, migrated.Hash)
+	assert.Equal(t, models.HashTypeSHA256, migrated.HashType)
+	assert.Equal(t, old.LegacyHash, migrated.LegacyHash)
+
+	for _, hash := range []string{old.Hash, old.LegacyHash} {
+		resp = tc.MakeRequest(http.MethodGet, "/v1/resources?Hash="+hash, nil)
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		var found []models.Resource
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &found))
+		if assert.Len(t, found, 1, "Hash=%s", hash) {
+			assert.Equal(t, old.ID, found[0].ID)
+		}
+	}
+}
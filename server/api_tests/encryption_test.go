@@ -0,0 +1,113 @@
+package api_tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"mahresources/application_context"
+	"mahresources/download_queue"
+	"mahresources/models"
+	"mahresources/storage"
+)
+
+// setupEncryptedTestEnv encrypts the main filesystem with a master key of
+// repeated key bytes and returns the filesystem underneath.
+func setupEncryptedTestEnv(t *testing.T, key byte) (*TestContext, afero.Fs) {
+	t.Helper()
+	ring, err := storage.NewKeyRing(bytes.Repeat([]byte{key}, storage.MasterKeySize))
+	require.NoError(t, err)
+
+	base := afero.NewMemMapFs()
+	tc := setupTestEnvWithFs(t, storage.Encrypt(base, ring), func(cfg *application_context.MahresourcesConfig) {
+		cfg.EncryptionKeys = ring
+	})
+	return tc, base
+}
+
+func TestEncryptedStorage_UploadViewPreviewAndVersion(t *testing.T) {
+	tc, base := setupEncryptedTestEnv(t, 1)
+	png := createTestPNG(t, 64, 48)
+
+	res := uploadScrubResource(t, tc, png, map[string]string{"Name": "encrypted"})
+	stored, err := afero.ReadFile(base, res.Location)
+	require.NoError(t, err)
+	assert.False(t, bytes.Contains(stored, png[:16]), "the stored file holds the upload in the clear")
+
+	file := fetchResourceFile(t, tc, res.ID)
+	require.Equal(t, http.StatusOK, file.Code)
+	assert.True(t, bytes.Equal(png, file.Body.Bytes()), "download differs from the upload")
+
+	rr := viewRange(t, tc, res.ID, "bytes=8-15")
+	require.Equal(t, http.StatusPartialContent, rr.Code, rr.Body.String())
+	assert.Equal(t, png[8:16], rr.Body.Bytes())
+	assert.Equal(t, fmt.Sprintf("bytes 8-15/%d", len(png)), rr.Header().Get("Content-Range"))
+
+	preview := probePreview(t, tc, fmt.Sprintf("id=%d&width=32&height=24", res.ID))
+	require.Equal(t, http.StatusOK, preview.code)
+	assert.True(t, preview.decoded, "preview is not an image")
+
+	v2 := createTestPNG(t, 80, 60)
+	body, ct := makeMultipartUpload(t, "file", "v2.png", v2, map[string]string{"comment": "second"})
+	resp := tc.makeMultipartRequest(t, http.MethodPost, fmt.Sprintf("/v1/resource/versions?resourceId=%d", res.ID), body, ct)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	var version models.ResourceVersion
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &version))
+
+	download := tc.MakeRequest(http.MethodGet, fmt.Sprintf("/v1/resource/version/file?versionId=%d", version.ID), nil)
+	require.Equal(t, http.StatusOK, download.Code)
+	assert.True(t, bytes.Equal(v2, download.Body.Bytes()), "version download differs from the upload")
+}
+
+func TestEncryptedStorage_RekeyMovesFilesOntoTheCurrentKey(t *testing.T) {
+	oldTc, base := setupEncryptedTestEnv(t, 1)
+	png := createTestPNG(t, 40, 30)
+	res := uploadScrubResource(t, oldTc, png, map[string]string{"Name": "before rotation"})
+	before, err := afero.ReadFile(base, res.Location)
+	require.NoError(t, err)
+	oldKeyID := oldTc.AppCtx.Config.EncryptionKeys.CurrentKeyID().String()
+
+	// Restart on a new key with the old one kept for reading.
+	ring, err := storage.NewKeyRing(bytes.Repeat([]byte{2}, storage.MasterKeySize), bytes.Repeat([]byte{1}, storage.MasterKeySize))
+	require.NoError(t, err)
+	tc := setupTestEnvWithFs(t, storage.Encrypt(base, ring), func(cfg *application_context.MahresourcesConfig) {
+		cfg.EncryptionKeys = ring
+	})
+
+	resp := tc.MakeRequest(http.MethodPost, "/v1/admin/rekey", nil)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	var start application_context.KeyRotationStart
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &start))
+	assert.Equal(t, ring.CurrentKeyID().String(), start.KeyID)
+	waitForJobStatus(t, tc, start.JobID, download_queue.JobStatusCompleted)
+
+	resp = tc.MakeRequest(http.MethodGet, "/v1/admin/rekey", nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+	var status application_context.KeyRotationStatus
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &status))
+	require.NotNil(t, status.Run)
+	assert.False(t, status.Running)
+	assert.Equal(t, []string{oldKeyID}, status.PreviousKeyIDs)
+	assert.EqualValues(t, 1, status.Run.Rewrapped)
+	assert.Zero(t, status.Run.Failed)
+
+	after, err := afero.ReadFile(base, res.Location)
+	require.NoError(t, err)
+	assert.False(t, bytes.Equal(before, after), "the file's header was not rewritten")
+	current, err := storage.NewKeyRing(bytes.Repeat([]byte{2}, storage.MasterKeySize))
+	require.NoError(t, err)
+	got, err := afero.ReadFile(storage.Encrypt(base, current), res.Location)
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(png, got), "the file does not read back with only the new key")
+}
+
+func TestEncryptedStorage_RekeyRefusedWithoutAKey(t *testing.T) {
+	tc := SetupTestEnv(t)
+	resp := tc.MakeRequest(http.MethodPost, "/v1/admin/rekey", nil)
+	assert.Equal(t, http.StatusBadRequest, resp.Code, resp.Body.String())
+}
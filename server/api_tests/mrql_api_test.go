@@ -252,6 +252,46 @@ func TestMRQLValidateInvalidField(t *testing.T) {
 	assert.Greater(t, len(errors), 0)
 }
 
+// ---- Format endpoint (POST /v1/mrql/format) ----
+
+func TestMRQLFormat(t *testing.T) {
+	tc := setupMRQLTest(t)
+
+	resp := tc.MakeRequest(http.MethodPost, "/v1/mrql/format", map[string]any{
+		"query": `type = "resource" and (name ~ "test") order by created desc`,
+	})
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var result map[string]any
+	json.Unmarshal(resp.Body.Bytes(), &result)
+	assert.Equal(t, "type = resource AND name ~ \"test\"\nORDER BY created DESC", result["formatted"])
+	assert.Equal(t, true, result["changed"])
+
+	resp = tc.MakeRequest(http.MethodPost, "/v1/mrql/format", map[string]any{
+		"query": result["formatted"],
+	})
+	result = map[string]any{}
+	json.Unmarshal(resp.Body.Bytes(), &result)
+	assert.Equal(t, false, result["changed"], "a formatted query should be unchanged")
+}
+
+func TestMRQLFormatInvalidSyntax(t *testing.T) {
+	tc := setupMRQLTest(t)
+
+	resp := tc.MakeRequest(http.MethodPost, "/v1/mrql/format", map[string]any{
+		"query": `name = = "bad"`,
+	})
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var result map[string]any
+	json.Unmarshal(resp.Body.Bytes(), &result)
+	assert.Equal(t, false, result["changed"])
+	assert.Nil(t, result["formatted"])
+	errors, ok := result["errors"].([]any)
+	assert.True(t, ok, "errors should be an array")
+	assert.Equal(t, float64(7), errors[0].(map[string]any)["pos"])
+}
+
 // ---- Complete endpoint (POST /v1/mrql/complete) ----
 
 func TestMRQLCompleteEmptyQuery(t *testing.T) {
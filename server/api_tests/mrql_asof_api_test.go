@@ -0,0 +1,104 @@
+package api_tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"mahresources/application_context"
+	"mahresources/models"
+)
+
+// seedAsOfHistory records a state dated 2020 — resource "before" tagged
+// "audited" and in group Box, and note "gone" — then edits all of it now.
+func seedAsOfHistory(t *testing.T, tc *TestContext) {
+	t.Helper()
+	tag := models.Tag{Name: "audited"}
+	group := models.Group{Name: "Box"}
+	resource := models.Resource{Name: "before", ContentType: "text/plain"}
+	note := models.Note{Name: "gone"}
+	for _, row := range []any{&tag, &group, &resource, &note} {
+		require.NoError(t, tc.DB.Create(row).Error)
+	}
+	require.NoError(t, tc.DB.Exec("INSERT INTO resource_tags (resource_id, tag_id) VALUES (?, ?)", resource.ID, tag.ID).Error)
+	require.NoError(t, tc.DB.Exec("INSERT INTO groups_related_resources (group_id, resource_id) VALUES (?, ?)", group.ID, resource.ID).Error)
+	for _, table := range models.HistoryTables {
+		require.NoError(t, tc.DB.Exec("UPDATE "+models.HistoryTableName(table.Name)+" SET history_at = '2020-01-01 00:00:00.000'").Error)
+	}
+
+	require.NoError(t, tc.DB.Model(&resource).Update("name", "after").Error)
+	require.NoError(t, tc.DB.Exec("DELETE FROM resource_tags WHERE resource_id = ?", resource.ID).Error)
+	require.NoError(t, tc.DB.Exec("DELETE FROM groups_related_resources WHERE resource_id = ?", resource.ID).Error)
+	require.NoError(t, tc.DB.Delete(&note).Error)
+}
+
+func runAsOf(t *testing.T, tc *TestContext, query string) application_context.MRQLResult {
+	t.Helper()
+	resp := tc.MakeRequest(http.MethodPost, "/v1/mrql", map[string]any{"query": query})
+	require.Equal(t, http.StatusOK, resp.Code, "query %q: %s", query, resp.Body.String())
+	var result application_context.MRQLResult
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &result))
+	return result
+}
+
+func TestMRQLAsOfReadsReconstructedState(t *testing.T) {
+	tc := setupMRQLTest(t)
+	seedAsOfHistory(t, tc)
+
+	past := runAsOf(t, tc, `type = resource AND tags = "audited" AND groups = "Box" AS OF "2021-01-01"`)
+	require.Len(t, past.Resources, 1)
+	assert.Equal(t, "before", past.Resources[0].Name)
+
+	assert.Empty(t, runAsOf(t, tc, `type = resource AND tags = "audited"`).Resources)
+	assert.Empty(t, runAsOf(t, tc, `type = resource AS OF "2019-12-31"`).Resources, "nothing existed yet")
+	assert.Empty(t, runAsOf(t, tc, `type = resource AND name = "after" AS OF -1d`).Resources, "the rename happened today")
+	assert.Len(t, runAsOf(t, tc, `type = resource AND name = "after" AS OF NOW()`).Resources, 1)
+
+	// A cross-entity query loads the deleted note as it was.
+	deleted := runAsOf(t, tc, `name = "gone" AS OF "2021-01-01"`)
+	require.Len(t, deleted.Notes, 1)
+	assert.Equal(t, "gone", deleted.Notes[0].Name)
+	assert.Len(t, deleted.Items, 1)
+	assert.Empty(t, runAsOf(t, tc, `name = "gone"`).Notes)
+}
+
+func TestMRQLAsOfGroupedAndProjected(t *testing.T) {
+	tc := setupMRQLTest(t)
+	seedAsOfHistory(t, tc)
+
+	resp := tc.MakeRequest(http.MethodPost, "/v1/mrql", map[string]any{
+		"query": `type = resource AND groups = "Box" AS OF "2021-01-01" SELECT name, tags.count`,
+	})
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	var projected struct {
+		Rows []map[string]any `json:"rows"`
+	}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &projected))
+	require.Len(t, projected.Rows, 1)
+	assert.Equal(t, "before", projected.Rows[0]["name"])
+	assert.EqualValues(t, 1, projected.Rows[0]["tags.count"])
+
+	resp = tc.MakeRequest(http.MethodPost, "/v1/mrql", map[string]any{
+		"query": `type = note AS OF "2021-01-01" GROUP BY name COUNT()`,
+	})
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	var grouped struct {
+		Rows []map[string]any `json:"rows"`
+	}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &grouped))
+	require.Len(t, grouped.Rows, 1)
+	assert.Equal(t, "gone", grouped.Rows[0]["name"])
+	assert.EqualValues(t, 1, grouped.Rows[0]["count"])
+}
+
+func TestMRQLAsOfRejectsTextSearch(t *testing.T) {
+	tc := setupMRQLTest(t)
+
+	resp := tc.MakeRequest(http.MethodPost, "/v1/mrql", map[string]any{
+		"query": `type = resource AND TEXT ~ "invoice" AS OF "2021-01-01"`,
+	})
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Contains(t, resp.Body.String(), "AS OF")
+}
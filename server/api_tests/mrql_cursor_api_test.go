@@ -0,0 +1,113 @@
+package api_tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"mahresources/application_context"
+	"mahresources/models"
+)
+
+func seedMRQLCursorNotes(t *testing.T, tc *TestContext, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		assert.NoError(t, tc.DB.Create(&models.Note{Name: fmt.Sprintf("cursor-%02d", i)}).Error)
+	}
+}
+
+func TestMRQLExecuteFollowsNextCursor(t *testing.T) {
+	tc := setupMRQLTest(t)
+	seedMRQLCursorNotes(t, tc, 5)
+
+	var names []string
+	cursor := ""
+	for page := 0; page < 10; page++ {
+		resp := tc.MakeRequest(http.MethodPost, "/v1/mrql", map[string]any{
+			"query":  `type = note AND name ~ "cursor-" ORDER BY name DESC`,
+			"limit":  2,
+			"cursor": cursor,
+		})
+		assert.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		var result application_context.MRQLResult
+		assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &result))
+		for _, n := range result.Notes {
+			names = append(names, n.Name)
+		}
+		if page == 0 {
+			// Inserted ahead of the cursor: later pages must not shift.
+			assert.NoError(t, tc.DB.Create(&models.Note{Name: "cursor-99"}).Error)
+		}
+		if result.NextCursor == "" {
+			break
+		}
+		cursor = result.NextCursor
+	}
+	assert.Equal(t, []string{"cursor-04", "cursor-03", "cursor-02", "cursor-01", "cursor-00"}, names)
+}
+
+func TestMRQLCursorErrors(t *testing.T) {
+	tc := setupMRQLTest(t)
+	seedMRQLCursorNotes(t, tc, 3)
+
+	resp := tc.MakeRequest(http.MethodPost, "/v1/mrql", map[string]any{
+		"query": `type = note ORDER BY name`,
+		"limit": 1,
+	})
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var result application_context.MRQLResult
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &result))
+	assert.NotEmpty(t, result.NextCursor)
+
+	cases := []map[string]any{
+		{"query": `type = note ORDER BY created`, "cursor": result.NextCursor},
+		{"query": `type = note ORDER BY name`, "cursor": result.NextCursor, "page": 2},
+		{"query": `type = note ORDER BY RANDOM()`, "cursor": result.NextCursor},
+		{"query": `type = note GROUP BY name COUNT()`, "cursor": result.NextCursor},
+		{"query": `type = note ORDER BY name`, "cursor": "garbage"},
+	}
+	for _, body := range cases {
+		resp := tc.MakeRequest(http.MethodPost, "/v1/mrql", body)
+		assert.Equal(t, http.StatusBadRequest, resp.Code, "%v: %s", body, resp.Body.String())
+	}
+}
+
+func TestMRQLSavedRunAndExportAcceptCursor(t *testing.T) {
+	tc := setupMRQLTest(t)
+	seedMRQLCursorNotes(t, tc, 3)
+
+	saved, err := tc.AppCtx.CreateSavedMRQLQuery("Cursor Notes", `type = note AND name ~ "cursor-" ORDER BY name`, "")
+	assert.NoError(t, err)
+
+	resp := tc.MakeRequest(http.MethodPost, fmt.Sprintf("/v1/mrql/saved/run?id=%d&limit=2", saved.ID), nil)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var first application_context.MRQLResult
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &first))
+	assert.Len(t, first.Notes, 2)
+	assert.NotEmpty(t, first.NextCursor)
+
+	resp = tc.MakeRequest(http.MethodPost, fmt.Sprintf("/v1/mrql/saved/run?id=%d&limit=2&cursor=%s", saved.ID, url.QueryEscape(first.NextCursor)), nil)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var second application_context.MRQLResult
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &second))
+	if assert.Len(t, second.Notes, 1) {
+		assert.Equal(t, "cursor-02", second.Notes[0].Name)
+	}
+	assert.Empty(t, second.NextCursor)
+
+	resp = tc.MakeRequest(http.MethodGet, fmt.Sprintf("/v1/mrql/export?id=%d&limit=2&format=csv", saved.ID), nil)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	next := resp.Header().Get("X-MRQL-Next-Cursor")
+	assert.NotEmpty(t, next)
+
+	resp = tc.MakeRequest(http.MethodGet, fmt.Sprintf("/v1/mrql/export?id=%d&limit=2&format=csv&cursor=%s", saved.ID, url.QueryEscape(next)), nil)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	rows := parseCSV(t, resp.Body.String())
+	if assert.Len(t, rows, 2) {
+		assert.Equal(t, "cursor-02", rows[1][1])
+	}
+	assert.Empty(t, resp.Header().Get("X-MRQL-Next-Cursor"))
+}
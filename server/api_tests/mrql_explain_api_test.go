@@ -96,10 +96,14 @@ func TestMRQLExplainCrossEntity(t *testing.T) {
 	assert.Equal(t, http.StatusOK, resp.Code)
 
 	out := decodeExplain(t, resp.Body.Bytes())
-	// Cross-entity fans out to three labeled statements.
-	assert.Len(t, out.Statements, 3)
-	labels := []string{out.Statements[0].Label, out.Statements[1].Label, out.Statements[2].Label}
-	assert.ElementsMatch(t, []string{"resources", "notes", "groups"}, labels)
+	// Cross-entity is one UNION ALL statement over the three tables.
+	require.Len(t, out.Statements, 1)
+	assert.Equal(t, "cross-entity union", out.Statements[0].Label)
+	upper := strings.ToUpper(out.Statements[0].SQL)
+	assert.Equal(t, 2, strings.Count(upper, "UNION ALL"))
+	for _, table := range []string{"resources", "notes", "groups"} {
+		assert.Contains(t, out.Statements[0].SQL, table)
+	}
 }
 
 func TestMRQLExplainAggregatedGroupBy(t *testing.T) {
@@ -115,6 +119,29 @@ func TestMRQLExplainAggregatedGroupBy(t *testing.T) {
 	assert.Len(t, out.Statements, 1)
 	assert.Contains(t, strings.ToUpper(out.Statements[0].SQL), "GROUP BY")
 	assert.Contains(t, strings.ToUpper(out.Statements[0].SQL), "COUNT")
+	require.Len(t, out.Statements[0].Aggregates, 1)
+	assert.Equal(t, "count", out.Statements[0].Aggregates[0].Key)
+	assert.Equal(t, "native", out.Statements[0].Aggregates[0].Method)
+}
+
+func TestMRQLExplainDescribesEmulatedAggregates(t *testing.T) {
+	tc := setupMRQLTest(t)
+	seedMRQLData(t, tc)
+
+	resp := tc.MakeRequest(http.MethodPost, "/v1/mrql/explain", map[string]any{
+		"query": `type = "resource" GROUP BY created.month PERCENTILE(fileSize, 0.95) RUNNING_SUM(fileSize)`,
+	})
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+	out := decodeExplain(t, resp.Body.Bytes())
+	require.Len(t, out.Statements, 1)
+	aggs := out.Statements[0].Aggregates
+	require.Len(t, aggs, 2)
+	assert.Equal(t, "percentile95_fileSize", aggs[0].Key)
+	assert.Equal(t, "emulated", aggs[0].Method)
+	assert.Equal(t, "running_sum_fileSize", aggs[1].Key)
+	assert.Equal(t, "window", aggs[1].Method)
+	assert.Contains(t, out.Statements[0].SQL, aggs[1].SQL)
 }
 
 func TestMRQLExplainBucketedGroupBy(t *testing.T) {
@@ -172,16 +199,15 @@ func TestMRQLExplainCrossEntityMatchesExecutionPagination(t *testing.T) {
 	})
 	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
 	out := decodeExplain(t, resp.Body.Bytes())
-	require.Len(t, out.Statements, 3)
-	for _, statement := range out.Statements {
-		upper := strings.ToUpper(statement.Interpolated)
-		assert.Contains(t, upper, "LIMIT 12", statement.Label)
-		assert.NotContains(t, upper, "OFFSET", statement.Label)
-	}
+	require.Len(t, out.Statements, 1)
+	// One shared window: the union is paginated once, not per branch.
+	upper := strings.ToUpper(out.Statements[0].Interpolated)
+	assert.Equal(t, 1, strings.Count(upper, "LIMIT 5"))
+	assert.Equal(t, 1, strings.Count(upper, "OFFSET 7"))
 	assert.Equal(t, "cross_entity", out.ExecutionShape.Strategy)
-	assert.Equal(t, 3, out.ExecutionShape.PlannedStatements)
-	assert.Equal(t, 3, out.ExecutionShape.MinimumStatements)
-	assert.Equal(t, 3, out.ExecutionShape.MaximumStatements)
+	assert.Equal(t, 1, out.ExecutionShape.PlannedStatements)
+	assert.Equal(t, 1, out.ExecutionShape.MinimumStatements)
+	assert.Equal(t, 4, out.ExecutionShape.MaximumStatements)
 }
 
 func TestMRQLExplainReportsBucketFanoutBounds(t *testing.T) {
@@ -0,0 +1,124 @@
+package api_tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"mahresources/application_context"
+	"mahresources/models"
+)
+
+func createMaterializedQuery(t *testing.T, tc *TestContext, body map[string]any) models.SavedMRQLQuery {
+	t.Helper()
+	resp := tc.MakeRequest(http.MethodPost, "/v1/mrql/saved", body)
+	require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+
+	var saved models.SavedMRQLQuery
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &saved))
+	return saved
+}
+
+func TestMRQLMaterializedSavedQueryRun(t *testing.T) {
+	tc := setupMRQLTest(t)
+	seedMRQLData(t, tc)
+
+	saved := createMaterializedQuery(t, tc, map[string]any{
+		"name":         "Materialized Notes",
+		"query":        `type = "note" AND name = "testNote"`,
+		"materialized": true,
+	})
+	assert.True(t, saved.Materialized)
+	assert.Equal(t, models.MRQLRefreshOnWrite, saved.RefreshPolicy)
+
+	resp := tc.MakeRequest(http.MethodPost, fmt.Sprintf("/v1/mrql/saved/run?id=%d", saved.ID), nil)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	var result application_context.MRQLResult
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &result))
+	assert.Equal(t, "note", result.EntityType)
+	require.Len(t, result.Notes, 1)
+	assert.Equal(t, "testNote", result.Notes[0].Name)
+	require.NotNil(t, result.Materialized, "a plain run of a materialized query should be served from the stored result")
+	assert.False(t, result.Materialized.Stale)
+
+	// Any paging override runs the query live.
+	resp = tc.MakeRequest(http.MethodPost, fmt.Sprintf("/v1/mrql/saved/run?id=%d&limit=5", saved.ID), nil)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	var live application_context.MRQLResult
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &live))
+	assert.Nil(t, live.Materialized)
+	assert.Len(t, live.Notes, 1)
+}
+
+func TestMRQLMaterializedSavedQueryRejectsUnsupported(t *testing.T) {
+	tc := setupMRQLTest(t)
+
+	for _, body := range []map[string]any{
+		{"name": "Bucketed", "query": `type = "resource" GROUP BY contentType`, "materialized": true},
+		{"name": "Params", "query": `type = "note" AND name = $name`, "materialized": true},
+		{"name": "Short Interval", "query": `type = "note"`, "materialized": true, "refreshPolicy": "interval", "refreshIntervalSeconds": 10},
+	} {
+		resp := tc.MakeRequest(http.MethodPost, "/v1/mrql/saved", body)
+		assert.Equal(t, http.StatusBadRequest, resp.Code, "%s: %s", body["name"], resp.Body.String())
+
+		var count int64
+		tc.DB.Model(&models.SavedMRQLQuery{}).Where("name = ?", body["name"]).Count(&count)
+		assert.Zero(t, count, "%s: a rejected query must not be saved", body["name"])
+	}
+}
+
+func TestMRQLMaterializedSavedQueryRefresh(t *testing.T) {
+	tc := setupMRQLTest(t)
+	seedMRQLData(t, tc)
+
+	plain := &models.SavedMRQLQuery{Name: "Not Materialized", Query: `type = "note"`}
+	tc.DB.Create(plain)
+	resp := tc.MakeRequest(http.MethodPost, fmt.Sprintf("/v1/mrql/saved/refresh?id=%d", plain.ID), nil)
+	assert.Equal(t, http.StatusConflict, resp.Code, resp.Body.String())
+
+	resp = tc.MakeRequest(http.MethodPost, "/v1/mrql/saved/refresh?name=Missing", nil)
+	assert.Equal(t, http.StatusNotFound, resp.Code, resp.Body.String())
+
+	saved := createMaterializedQuery(t, tc, map[string]any{
+		"name":                   "Tag Counts",
+		"query":                  `type = "resource" GROUP BY contentType COUNT()`,
+		"materialized":           true,
+		"refreshPolicy":          "interval",
+		"refreshIntervalSeconds": 600,
+	})
+	resp = tc.MakeRequest(http.MethodPost, "/v1/mrql/saved/refresh?name=Tag+Counts", nil)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	var info application_context.MRQLMaterializedInfo
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &info))
+	assert.False(t, info.RefreshedAt.IsZero())
+	assert.Equal(t, models.MRQLRefreshInterval, info.RefreshPolicy)
+	assert.Equal(t, 600, info.RefreshIntervalSeconds)
+
+	resp = tc.MakeRequest(http.MethodPost, fmt.Sprintf("/v1/mrql/saved/run?id=%d", saved.ID), nil)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	var served application_context.MRQLGroupedResult
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &served))
+	assert.Equal(t, "aggregated", served.Mode)
+	require.NotNil(t, served.Materialized)
+	assert.True(t, served.Materialized.RefreshedAt.Equal(info.RefreshedAt), "the run should serve the refreshed result")
+
+	// Turning materialization off drops the stored result and runs live again.
+	resp = tc.MakeRequest(http.MethodPut, fmt.Sprintf("/v1/mrql/saved?id=%d", saved.ID), map[string]any{
+		"name":         saved.Name,
+		"query":        saved.Query,
+		"materialized": false,
+	})
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	var stored int64
+	tc.DB.Model(&models.MRQLMaterialization{}).Where("saved_query_id = ?", saved.ID).Count(&stored)
+	assert.Zero(t, stored)
+
+	resp = tc.MakeRequest(http.MethodPost, fmt.Sprintf("/v1/mrql/saved/run?id=%d", saved.ID), nil)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	var grouped application_context.MRQLGroupedResult
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &grouped))
+	assert.Nil(t, grouped.Materialized)
+}
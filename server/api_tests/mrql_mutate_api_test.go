@@ -0,0 +1,66 @@
+package api_tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"mahresources/application_context"
+	"mahresources/download_queue"
+	"mahresources/models"
+)
+
+func TestMRQLMutateDryRunThenApply(t *testing.T) {
+	tc := setupMRQLTest(t)
+	tag := &models.Tag{Name: "mutate-api-done"}
+	assert.NoError(t, tc.DB.Create(tag).Error)
+	for _, name := range []string{"mutate-api-1", "mutate-api-2"} {
+		assert.NoError(t, tc.DB.Create(&models.Note{Name: name}).Error)
+	}
+	query := `type = note AND name ~ "mutate-api-" ADD TAGS "mutate-api-done"`
+
+	resp := tc.MakeRequest(http.MethodPost, "/v1/mrql/mutate", map[string]any{"query": query, "dryRun": true})
+	assert.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	var plan application_context.MRQLMutationPlan
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &plan))
+	assert.Equal(t, 2, plan.Affected)
+	assert.Equal(t, []uint{tag.ID}, plan.AddTagIds)
+
+	var tagged int64
+	tc.DB.Table("note_tags").Where("tag_id = ?", tag.ID).Count(&tagged)
+	assert.Zero(t, tagged, "a dry run must not write")
+
+	resp = tc.MakeRequest(http.MethodPost, "/v1/mrql/mutate", map[string]any{"query": query})
+	assert.Equal(t, http.StatusAccepted, resp.Code, resp.Body.String())
+	var submitted struct {
+		JobID    string `json:"jobId"`
+		Affected int    `json:"affected"`
+	}
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &submitted))
+	assert.Equal(t, 2, submitted.Affected)
+	waitForJobStatus(t, tc, submitted.JobID, download_queue.JobStatusCompleted)
+
+	tc.DB.Table("note_tags").Where("tag_id = ?", tag.ID).Count(&tagged)
+	assert.EqualValues(t, 2, tagged)
+}
+
+func TestMRQLMutateRejectsBadStatements(t *testing.T) {
+	tc := setupMRQLTest(t)
+
+	for _, query := range []string{
+		`type = note`,
+		`name = "x" ADD TAGS "a"`,
+		`type = note LIMIT 5 ADD TAGS "a"`,
+	} {
+		resp := tc.MakeRequest(http.MethodPost, "/v1/mrql/mutate", map[string]any{"query": query, "dryRun": true})
+		assert.Equal(t, http.StatusBadRequest, resp.Code, query)
+	}
+
+	resp := tc.MakeRequest(http.MethodPost, "/v1/mrql/mutate", map[string]any{"query": `type = note ADD TAGS "mutate-api-missing"`, "dryRun": true})
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+
+	resp = tc.MakeRequest(http.MethodPost, "/v1/mrql", map[string]any{"query": `type = note ADD TAGS "a"`})
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Contains(t, resp.Body.String(), "only allowed in a mutation statement")
+}
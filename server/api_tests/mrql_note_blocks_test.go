@@ -0,0 +1,62 @@
+//go:build json1 && fts5
+
+package api_tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"mahresources/application_context"
+	"mahresources/models"
+	"mahresources/models/query_models"
+)
+
+// Block predicates run end to end: the derived columns come from the
+// note_blocks triggers, and blocks.text ~ goes through the trigram FTS table.
+func TestMRQLNoteBlockPredicates(t *testing.T) {
+	tc := setupMRQLTest(t)
+	require.NoError(t, tc.AppCtx.InitFTS(), "FTS5 must be available (build with -tags 'json1 fts5')")
+
+	invoices := &models.Note{Name: "blocks-invoices"}
+	groceries := &models.Note{Name: "blocks-groceries"}
+	require.NoError(t, tc.DB.Create(invoices).Error)
+	require.NoError(t, tc.DB.Create(groceries).Error)
+
+	_, err := tc.AppCtx.CreateBlock(&query_models.NoteBlockEditor{NoteID: invoices.ID, Type: "text", Position: "a",
+		Content: json.RawMessage(`{"text":"Invoice from ACME"}`)})
+	require.NoError(t, err)
+	todos, err := tc.AppCtx.CreateBlock(&query_models.NoteBlockEditor{NoteID: groceries.ID, Type: "todos", Position: "a",
+		Content: json.RawMessage(`{"items":[{"id":"m","label":"Milk"},{"id":"e","label":"Eggs"}]}`)})
+	require.NoError(t, err)
+
+	query := func(q string) []string {
+		t.Helper()
+		resp := tc.MakeRequest(http.MethodPost, "/v1/mrql", map[string]any{"query": `type = note AND name ~ "blocks-" AND ` + q})
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		var result application_context.MRQLResult
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &result))
+		names := []string{}
+		for _, n := range result.Notes {
+			names = append(names, n.Name)
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"blocks-invoices"}, query(`blocks.text ~ "invoice"`))
+	assert.Equal(t, []string{"blocks-groceries"}, query(`blocks.text ~ "egg"`))
+	assert.Equal(t, []string{"blocks-groceries"}, query(`blocks.type = "todos"`))
+	assert.Equal(t, []string{"blocks-groceries"}, query(`todos.open.count = 2`))
+
+	_, err = tc.AppCtx.UpdateBlockState(todos.ID, json.RawMessage(`{"checked":["m","e"]}`))
+	require.NoError(t, err)
+	assert.Empty(t, query(`todos.open.count > 0`))
+	assert.Equal(t, []string{"blocks-groceries"}, query(`todos.count = 2`))
+
+	_, err = tc.AppCtx.UpdateBlockContent(todos.ID, json.RawMessage(`{"items":[{"id":"b","label":"Bread"}]}`))
+	require.NoError(t, err)
+	assert.Empty(t, query(`blocks.text ~ "egg"`))
+	assert.Equal(t, []string{"blocks-groceries"}, query(`todos.open.count = 1`))
+}
@@ -0,0 +1,73 @@
+package api_tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// A SELECT query answers in "projected" mode: one row per entity, keyed by
+// column name, with `columns` in the order the author wrote them.
+func TestMRQLSelectReturnsProjectedRows(t *testing.T) {
+	tc := SetupTestEnv(t)
+	seedResourcesForGrouping(t, tc)
+
+	resp := tc.MakeRequest(http.MethodPost, "/v1/mrql", map[string]any{
+		"query": `type = resource AND name ~ "ws14" SELECT name, width * height AS px, fileSize / 10 ORDER BY px DESC, name`,
+	})
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+	var body struct {
+		Mode    string           `json:"mode"`
+		Columns []string         `json:"columns"`
+		Rows    []map[string]any `json:"rows"`
+	}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+	assert.Equal(t, "projected", body.Mode)
+	assert.Equal(t, []string{"name", "px", "fileSize / 10"}, body.Columns)
+	require.Len(t, body.Rows, 3)
+	assert.Equal(t, "ws14 c", body.Rows[0]["name"])
+	assert.EqualValues(t, 16000, body.Rows[0]["px"])
+	assert.EqualValues(t, 3, body.Rows[0]["fileSize / 10"])
+	assert.Equal(t, "ws14 a", body.Rows[1]["name"])
+}
+
+func TestMRQLSelectCSVExportUsesTheSelectedColumns(t *testing.T) {
+	tc := SetupTestEnv(t)
+	seedResourcesForGrouping(t, tc)
+
+	resp := tc.MakeRequest(http.MethodPost, "/v1/mrql/export?format=csv", map[string]any{
+		"query": `type = resource AND name ~ "ws14" SELECT name, width AS w ORDER BY name`,
+	})
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	assert.Equal(t, "name,w\nws14 a,100\nws14 b,100\nws14 c,200\n", resp.Body.String())
+}
+
+func TestMRQLExplainSelectUsesProjectionStrategy(t *testing.T) {
+	tc := setupMRQLTest(t)
+	seedMRQLData(t, tc)
+
+	resp := tc.MakeRequest(http.MethodPost, "/v1/mrql/explain", map[string]any{
+		"query": `type = resource SELECT name, fileSize / 1kb AS kb`,
+	})
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+	out := decodeExplain(t, resp.Body.Bytes())
+	assert.Equal(t, "projection", out.ExecutionShape.Strategy)
+	require.Len(t, out.Statements, 1)
+	assert.Contains(t, out.Statements[0].SQL, "kb")
+}
+
+func TestMRQLSelectRejectsCursorPagination(t *testing.T) {
+	tc := SetupTestEnv(t)
+
+	resp := tc.MakeRequest(http.MethodPost, "/v1/mrql", map[string]any{
+		"query":  `type = resource SELECT name`,
+		"cursor": "abc",
+	})
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Contains(t, resp.Body.String(), "SELECT")
+}
@@ -51,6 +51,7 @@ func SetupPostgresTestEnv(t *testing.T) *TestContext {
 		&models.PluginState{},
 		&models.PluginKV{},
 		&models.SavedMRQLQuery{},
+		&models.MRQLMaterialization{},
 		&models.TemplatePartial{},
 		&models.Group{},
 		&models.GroupRelationType{},
@@ -68,6 +69,23 @@ func SetupPostgresTestEnv(t *testing.T) *TestContext {
 		&models.ApiToken{},
 		&models.DownloadHistoryEntry{},
 		&models.PluginSchedule{},
+		&models.BlobIntegrityIssue{},
+		&models.BlobScrubRun{},
+		&models.BlobGCRun{},
+		&models.ContentHashMigrationRun{},
+		&models.EncryptionRotationRun{},
+		&models.ResourceView{},
+		&models.StorageTierPin{},
+		&models.StorageTierRun{},
+		&models.ResumableUpload{},
+		&models.StorageQuota{},
+		&models.StorageUsage{},
+		&models.StorageUsageBlob{},
+		&models.StorageCharge{},
+		&models.ArchiveExpansion{},
+		&models.WatchFolder{},
+		&models.WatchedFile{},
+		&models.ResourceText{},
 	)
 	if err != nil {
 		t.Fatalf("Failed to migrate database: %v", err)
@@ -76,6 +94,12 @@ func SetupPostgresTestEnv(t *testing.T) *TestContext {
 	if err := models.EnsureSupplementalIndexes(db); err != nil {
 		t.Fatalf("Failed to create supplemental indexes: %v", err)
 	}
+	if err := models.EnsureNoteBlockSearch(db); err != nil {
+		t.Fatalf("Failed to create note block search triggers: %v", err)
+	}
+	if err := models.EnsureEntityHistory(db); err != nil {
+		t.Fatalf("Failed to create entity history triggers: %v", err)
+	}
 	seed.AddInitialData(db)
 
 	config := &application_context.MahresourcesConfig{
@@ -0,0 +1,30 @@
+package api_tests
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"mahresources/models"
+)
+
+func TestResourceText_ServesExtractedTextAnd404sWithoutIt(t *testing.T) {
+	tc := SetupTestEnv(t)
+	resource := &models.Resource{Name: "report.pdf", ContentType: "application/pdf", PageCount: 2}
+	require.NoError(t, tc.DB.Create(resource).Error)
+
+	url := fmt.Sprintf("/v1/resource/text?id=%d", resource.ID)
+	resp := tc.MakeRequest(http.MethodGet, url, nil)
+	assert.Equal(t, http.StatusNotFound, resp.Code, resp.Body.String())
+
+	require.NoError(t, tc.DB.Create(&models.ResourceText{ResourceID: resource.ID, Text: "Quarterly report"}).Error)
+	resp = tc.MakeRequest(http.MethodGet, url, nil)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	assert.Contains(t, resp.Body.String(), `"text":"Quarterly report"`)
+
+	resp = tc.MakeRequest(http.MethodGet, fmt.Sprintf("/v1/resource?id=%d", resource.ID), nil)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	assert.Contains(t, resp.Body.String(), `"pageCount":2`)
+}
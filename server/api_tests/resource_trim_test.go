@@ -178,7 +178,7 @@ func TestTrimVideo_HappyPath_CreatesVersion(t *testing.T) {
 	require.Len(t, versions, 2, "expected lazy v1 plus trimmed v2")
 	assert.Equal(t, "Original (before trim)", versions[0].Comment)
 	assert.Equal(t, "test trim", versions[1].Comment)
-	assert.Equal(t, "SHA1", versions[1].HashType)
+	assert.Equal(t, models.HashTypeSHA256, versions[1].HashType)
 	assert.True(t, versions[1].FileSize > 0 && versions[1].FileSize < resource.FileSize,
 		"trimmed video should be smaller than original (%d >= %d)", versions[1].FileSize, resource.FileSize)
 
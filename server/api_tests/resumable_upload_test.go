@@ -0,0 +1,149 @@
+package api_tests
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"mahresources/cmd/mr/client"
+	"mahresources/models"
+)
+
+func tusRequest(t *testing.T, tc *TestContext, method, url string, body []byte, headers map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/offset+octet-stream")
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rr := httptest.NewRecorder()
+	tc.Router.ServeHTTP(rr, req)
+	return rr
+}
+
+func tusMetadata(pairs ...string) string {
+	var out []byte
+	for i := 0; i < len(pairs); i += 2 {
+		if i > 0 {
+			out = append(out, ',')
+		}
+		out = append(out, pairs[i]+" "+base64.StdEncoding.EncodeToString([]byte(pairs[i+1]))...)
+	}
+	return string(out)
+}
+
+func TestResumableUpload_CreatesTheResourceOnceEveryChunkHasArrived(t *testing.T) {
+	tc := SetupTestEnv(t)
+	owner := tc.CreateDummyGroup("uploads")
+	payload := createTestPNG(t, 40, 30)
+	half := int64(len(payload) / 2)
+
+	resp := tusRequest(t, tc, http.MethodOptions, "/v1/uploads", nil, nil)
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+	assert.Equal(t, "1.0.0", resp.Header().Get("Tus-Version"))
+
+	create := map[string]string{
+		"Upload-Length":   strconv.Itoa(len(payload)),
+		"Upload-Metadata": tusMetadata("filename", "chunked.png", "Name", "chunked", "OwnerId", strconv.Itoa(int(owner.ID))),
+	}
+	req, _ := http.NewRequest(http.MethodPost, "/v1/uploads", nil)
+	req.Header.Set("Upload-Length", create["Upload-Length"])
+	rr := httptest.NewRecorder()
+	tc.Router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusPreconditionFailed, rr.Code, "an upload without Tus-Resumable was accepted")
+
+	resp = tusRequest(t, tc, http.MethodPost, "/v1/uploads", nil, create)
+	require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+	location := resp.Header().Get("Location")
+	require.NotEmpty(t, location)
+
+	resp = tusRequest(t, tc, http.MethodPatch, location, payload[:half], map[string]string{"Upload-Offset": "0"})
+	require.Equal(t, http.StatusNoContent, resp.Code, resp.Body.String())
+	assert.Equal(t, strconv.FormatInt(half, 10), resp.Header().Get("Upload-Offset"))
+
+	resp = tusRequest(t, tc, http.MethodHead, location, nil, nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, strconv.FormatInt(half, 10), resp.Header().Get("Upload-Offset"))
+	assert.Equal(t, strconv.Itoa(len(payload)), resp.Header().Get("Upload-Length"))
+	assert.Empty(t, resp.Header().Get("X-Resource-Id"))
+
+	resp = tusRequest(t, tc, http.MethodPatch, location, payload[half:], map[string]string{"Upload-Offset": "0"})
+	assert.Equal(t, http.StatusConflict, resp.Code, "a chunk at the wrong offset was accepted")
+	assert.Equal(t, strconv.FormatInt(half, 10), resp.Header().Get("Upload-Offset"))
+
+	resp = tusRequest(t, tc, http.MethodPatch, location, append(payload[half:], 'x'), map[string]string{"Upload-Offset": strconv.FormatInt(half, 10)})
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.Code, "a chunk past Upload-Length was accepted")
+
+	resp = tusRequest(t, tc, http.MethodPatch, location, payload[half:], map[string]string{"Upload-Offset": strconv.FormatInt(half, 10)})
+	require.Equal(t, http.StatusNoContent, resp.Code, resp.Body.String())
+	id, err := strconv.ParseUint(resp.Header().Get("X-Resource-Id"), 10, 64)
+	require.NoError(t, err, "the final chunk did not name the resource it created")
+
+	var resource models.Resource
+	require.NoError(t, tc.DB.First(&resource, id).Error)
+	assert.Equal(t, "chunked", resource.Name)
+	require.NotNil(t, resource.OwnerId)
+	assert.Equal(t, owner.ID, *resource.OwnerId)
+	assert.EqualValues(t, 40, resource.Width)
+	file := fetchResourceFile(t, tc, resource.ID)
+	require.Equal(t, http.StatusOK, file.Code)
+	assert.True(t, bytes.Equal(payload, file.Body.Bytes()), "the stored file differs from the upload")
+
+	resp = tusRequest(t, tc, http.MethodHead, location, nil, nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, strconv.FormatUint(id, 10), resp.Header().Get("X-Resource-Id"), "a finished upload forgot what it created")
+
+	resp = tusRequest(t, tc, http.MethodDelete, location, nil, nil)
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+	resp = tusRequest(t, tc, http.MethodHead, location, nil, nil)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	assert.NoError(t, tc.DB.First(&resource, id).Error, "abandoning a finished upload deleted its resource")
+}
+
+func TestResumableUpload_ClientUploadsANewVersionInChunks(t *testing.T) {
+	tc := SetupTestEnv(t)
+	srv := httptest.NewServer(tc.Router)
+	defer srv.Close()
+	t.Setenv("MR_TOKEN", "")
+	t.Setenv("MR_UPLOAD_STATE_FILE", filepath.Join(t.TempDir(), "uploads.json"))
+
+	res := uploadScrubResource(t, tc, createTestPNG(t, 20, 20), map[string]string{"Name": "versioned"})
+	v2 := createTestPNG(t, 64, 48)
+	path := filepath.Join(t.TempDir(), "v2.png")
+	require.NoError(t, os.WriteFile(path, v2, 0644))
+
+	c := client.New(srv.URL)
+	result, err := c.UploadResumable(path, map[string]string{
+		"filename":   "v2.png",
+		"resourceId": fmt.Sprint(res.ID),
+		"comment":    "sent in chunks",
+	}, 100)
+	require.NoError(t, err)
+	assert.Equal(t, res.ID, result.ResourceID)
+	require.NotZero(t, result.VersionID)
+
+	var version models.ResourceVersion
+	require.NoError(t, tc.DB.First(&version, result.VersionID).Error)
+	assert.Equal(t, res.ID, version.ResourceID)
+	assert.Equal(t, "sent in chunks", version.Comment)
+	assert.EqualValues(t, len(v2), version.FileSize)
+
+	_, err = os.Stat(os.Getenv("MR_UPLOAD_STATE_FILE"))
+	assert.True(t, os.IsNotExist(err), "a finished upload was left in the state file")
+
+	_, err = c.UploadResumable(path, map[string]string{"filename": "v2.png", "resourceId": "999999"}, 100)
+	assert.ErrorContains(t, err, "HTTP 404")
+}
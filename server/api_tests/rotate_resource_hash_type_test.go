@@ -17,11 +17,11 @@ import (
 // TestRotateResourceSyncsHashType verifies that RotateResource updates the
 // parent resource's hash_type field to match the version it creates.
 //
-// Bug: RotateResource creates a new version with HashType "SHA1" and syncs
+// Bug: RotateResource creates a new version with HashType "SHA256" and syncs
 // most resource fields (hash, location, content_type, width, height,
 // file_size) but omits hash_type from the update map. If the resource had a
 // legacy hash_type (e.g. "MD5" from a migration), the resource will have
-// a SHA1 hash but still report its hash_type as "MD5".
+// a SHA-256 hash but still report its hash_type as "MD5".
 //
 // Compare with UploadNewVersion and RestoreVersion, which both correctly
 // include "hash_type" in their resource update maps.
@@ -82,9 +82,9 @@ func TestRotateResourceSyncsHashType(t *testing.T) {
 	assert.NotEqual(t, resource.Hash, updated.Hash,
 		"Hash should change after rotation")
 
-	// Critical assertion: hash_type must be updated to "SHA1" because
-	// the new version was created with SHA1 hashing.
-	assert.Equal(t, "SHA1", updated.HashType,
+	// Critical assertion: hash_type must be updated to "SHA256" because
+	// the new version was created with SHA-256 hashing.
+	assert.Equal(t, models.HashTypeSHA256, updated.HashType,
 		"RotateResource should sync hash_type from the new version to the resource; "+
 			"currently RotateResource omits hash_type from its resource update map, "+
 			"leaving the stale value %q", updated.HashType)
@@ -0,0 +1,125 @@
+package api_tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"mahresources/application_context"
+	"mahresources/internal/s3stub"
+	"mahresources/models"
+	"mahresources/storage"
+)
+
+// setupS3TestEnv stores the main filesystem under media/main and the "cold"
+// alt filesystem under media/cold of an S3 stand-in.
+func setupS3TestEnv(t *testing.T) (*TestContext, *s3stub.Server) {
+	t.Helper()
+	stub := s3stub.New()
+	t.Cleanup(stub.Close)
+	tc := setupTestEnvWithFs(t, storage.CreateStorage(stub.Location("media", "main")), func(cfg *application_context.MahresourcesConfig) {
+		cfg.AltFileSystems = map[string]string{"cold": stub.Location("media", "cold")}
+	})
+	return tc, stub
+}
+
+func uploadS3TestResource(t *testing.T, tc *TestContext, payload []byte, extras map[string]string) models.Resource {
+	t.Helper()
+	body, ct := makeMultipartUpload(t, "resource", "s3.png", payload, extras)
+	resp := tc.makeMultipartRequest(t, http.MethodPost, "/v1/resource", body, ct)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	var resources []models.Resource
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &resources))
+	require.Len(t, resources, 1)
+	return resources[0]
+}
+
+// viewRange follows /v1/resource/view to the file server and asks it for a
+// byte range.
+func viewRange(t *testing.T, tc *TestContext, id uint, byteRange string) *httptest.ResponseRecorder {
+	t.Helper()
+	resp := tc.MakeRequest(http.MethodGet, fmt.Sprintf("/v1/resource/view?id=%d", id), nil)
+	require.Equal(t, http.StatusFound, resp.Code, resp.Body.String())
+
+	req := httptest.NewRequest(http.MethodGet, resp.Header().Get("Location"), nil)
+	req.Header.Set("Range", byteRange)
+	rr := httptest.NewRecorder()
+	tc.Router.ServeHTTP(rr, req)
+	return rr
+}
+
+func rangedGets(stub *s3stub.Server, key string) []string {
+	var ranges []string
+	for _, r := range stub.Requests() {
+		if r.Method == http.MethodGet && r.Key == key && r.Range != "" {
+			ranges = append(ranges, r.Range)
+		}
+	}
+	return ranges
+}
+
+func TestS3MainStorage_UploadViewPreviewAndVersion(t *testing.T) {
+	tc, stub := setupS3TestEnv(t)
+	png := createTestPNG(t, 64, 48)
+
+	res := uploadS3TestResource(t, tc, png, map[string]string{"Name": "s3 main"})
+	key := "main" + res.Location
+	stored, ok := stub.Object("media", key)
+	require.True(t, ok, "no object at %s; keys: %q", key, stub.Keys("media"))
+	assert.True(t, bytes.Equal(png, stored), "stored object differs from the upload")
+
+	rr := viewRange(t, tc, res.ID, "bytes=8-15")
+	require.Equal(t, http.StatusPartialContent, rr.Code, rr.Body.String())
+	assert.Equal(t, png[8:16], rr.Body.Bytes())
+	assert.Equal(t, fmt.Sprintf("bytes 8-15/%d", len(png)), rr.Header().Get("Content-Range"))
+	assert.Contains(t, rangedGets(stub, key), "bytes=8-", "the file server should fetch from the requested offset, not the whole object")
+
+	preview := probePreview(t, tc, fmt.Sprintf("id=%d&width=32&height=24", res.ID))
+	require.Equal(t, http.StatusOK, preview.code)
+	assert.True(t, preview.decoded, "preview is not an image")
+
+	v2 := createTestPNG(t, 80, 60)
+	body, ct := makeMultipartUpload(t, "file", "v2.png", v2, map[string]string{"comment": "second"})
+	resp := tc.makeMultipartRequest(t, http.MethodPost, fmt.Sprintf("/v1/resource/versions?resourceId=%d", res.ID), body, ct)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	var version models.ResourceVersion
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &version))
+	stored, ok = stub.Object("media", "main"+version.Location)
+	require.True(t, ok, "no version object at main%s", version.Location)
+	assert.True(t, bytes.Equal(v2, stored), "stored version differs from the upload")
+
+	file := tc.MakeRequest(http.MethodGet, fmt.Sprintf("/v1/resource/version/file?versionId=%d", version.ID), nil)
+	require.Equal(t, http.StatusOK, file.Code)
+	assert.True(t, bytes.Equal(v2, file.Body.Bytes()), "version download differs from the upload")
+	assert.Zero(t, stub.Uploads(), "multipart uploads left open")
+}
+
+func TestS3AltStorage_UploadAndView(t *testing.T) {
+	tc, stub := setupS3TestEnv(t)
+	png := createTestPNG(t, 40, 30)
+
+	res := uploadS3TestResource(t, tc, png, map[string]string{"Name": "s3 cold", "PathName": "cold"})
+	require.NotNil(t, res.StorageLocation)
+	require.Equal(t, "cold", *res.StorageLocation)
+	key := "cold" + res.Location
+	_, ok := stub.Object("media", key)
+	require.True(t, ok, "no object at %s; keys: %q", key, stub.Keys("media"))
+	for _, k := range stub.Keys("media") {
+		assert.False(t, strings.HasPrefix(k, "main/resources/"), "alt upload also stored %s in the main filesystem", k)
+	}
+
+	rr := viewRange(t, tc, res.ID, "bytes=0-3")
+	require.Equal(t, http.StatusPartialContent, rr.Code, rr.Body.String())
+	assert.Equal(t, png[:4], rr.Body.Bytes())
+	assert.NotEmpty(t, rangedGets(stub, key))
+
+	preview := probePreview(t, tc, fmt.Sprintf("id=%d&width=20&height=15", res.ID))
+	require.Equal(t, http.StatusOK, preview.code)
+	assert.True(t, preview.decoded, "preview is not an image")
+}
@@ -0,0 +1,71 @@
+package api_tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"mahresources/application_context"
+	"mahresources/models"
+)
+
+func TestStorageQuota_RefusesAnUploadPastAGroupQuotaWith507(t *testing.T) {
+	tc := SetupTestEnv(t)
+	parent := tc.CreateDummyGroup("Archive")
+	child := &models.Group{Name: "Scans", OwnerId: &parent.ID}
+	require.NoError(t, tc.DB.Create(child).Error)
+
+	first := createTestPNG(t, 20, 20)
+	uploadScrubResource(t, tc, first, map[string]string{"Name": "first", "OwnerId": strconv.Itoa(int(child.ID))})
+
+	resp := tc.MakeRequest(http.MethodPost, "/v1/admin/quotas", map[string]any{
+		"SubjectType": "group", "SubjectId": parent.ID, "MaxBytes": len(first) + 10,
+	})
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	var status application_context.StorageQuotaStatus
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &status))
+	assert.EqualValues(t, len(first), status.UsedBytes, "the subtree's usage does not include its child group's resource")
+	assert.EqualValues(t, 1, status.UsedResources)
+
+	body, ct := makeMultipartUpload(t, "resource", "second.png", createTestPNG(t, 60, 60), map[string]string{"Name": "second", "OwnerId": strconv.Itoa(int(child.ID))})
+	resp = tc.makeMultipartRequest(t, http.MethodPost, "/v1/resource", body, ct)
+	assert.Equal(t, http.StatusInsufficientStorage, resp.Code, resp.Body.String())
+	assert.Contains(t, resp.Body.String(), "storage quota exceeded")
+	var count int64
+	tc.DB.Model(&models.Resource{}).Count(&count)
+	assert.EqualValues(t, 1, count, "the refused upload left a resource behind")
+
+	resp = tc.MakeRequest(http.MethodGet, "/v1/admin/data-stats", nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+	var stats application_context.DataStats
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &stats))
+	require.Len(t, stats.Quotas, 1)
+	assert.Equal(t, "Archive", stats.Quotas[0].SubjectName)
+
+	resp = tc.MakeRequest(http.MethodPost, "/v1/admin/quotas/recount", nil)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	assert.JSONEq(t, `{"resources": 1}`, resp.Body.String())
+
+	remove := map[string]any{"SubjectType": "group", "SubjectId": parent.ID}
+	resp = tc.MakeRequest(http.MethodPost, "/v1/admin/quotas/delete", remove)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	resp = tc.MakeRequest(http.MethodPost, "/v1/admin/quotas/delete", remove)
+	assert.Equal(t, http.StatusNotFound, resp.Code, resp.Body.String())
+
+	uploadScrubResource(t, tc, createTestPNG(t, 60, 60), map[string]string{"Name": "second", "OwnerId": strconv.Itoa(int(child.ID))})
+}
+
+func TestStorageQuota_RejectsAQuotaForAMissingSubject(t *testing.T) {
+	tc := SetupTestEnv(t)
+	resp := tc.MakeRequest(http.MethodPost, "/v1/admin/quotas", map[string]any{"SubjectType": "group", "SubjectId": 9999, "MaxBytes": 1})
+	assert.Equal(t, http.StatusBadRequest, resp.Code, resp.Body.String())
+	resp = tc.MakeRequest(http.MethodPost, "/v1/admin/quotas", map[string]any{"SubjectType": "team", "SubjectId": 1, "MaxBytes": 1})
+	assert.Equal(t, http.StatusBadRequest, resp.Code, resp.Body.String())
+
+	resp = tc.MakeRequest(http.MethodGet, "/v1/admin/quotas", nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.JSONEq(t, `[]`, resp.Body.String())
+}
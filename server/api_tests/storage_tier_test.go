@@ -0,0 +1,81 @@
+package api_tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"mahresources/application_context"
+	"mahresources/download_queue"
+	"mahresources/models"
+)
+
+func startStorageTierJob(t *testing.T, tc *TestContext, path string, body any) application_context.StorageTierStart {
+	t.Helper()
+	resp := tc.MakeRequest(http.MethodPost, path, body)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	var start application_context.StorageTierStart
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &start))
+	waitForJobStatus(t, tc, start.JobID, download_queue.JobStatusCompleted)
+	return start
+}
+
+func TestStorageTiering_ArchivesUnviewedResourcesAndPromotesThemBack(t *testing.T) {
+	archiveRoot := t.TempDir()
+	tc := setupTestEnvWithConfig(t, func(cfg *application_context.MahresourcesConfig) {
+		cfg.AltFileSystems = map[string]string{"archive": archiveRoot}
+		cfg.StorageTierRules = []application_context.StorageTierRule{{Target: "archive", Query: "lastViewed IS NULL"}}
+	})
+
+	coldPNG := createTestPNG(t, 30, 20)
+	cold := uploadScrubResource(t, tc, coldPNG, map[string]string{"Name": "cold"})
+	warm := uploadScrubResource(t, tc, createTestPNG(t, 20, 30), map[string]string{"Name": "warm"})
+	require.Equal(t, http.StatusOK, fetchResourceFile(t, tc, warm.ID).Code)
+
+	startStorageTierJob(t, tc, "/v1/admin/tiering", nil)
+
+	resp := tc.MakeRequest(http.MethodGet, "/v1/admin/tiering", nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+	var status application_context.StorageTierStatus
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &status))
+	require.NotNil(t, status.Run)
+	assert.EqualValues(t, 1, status.Run.Moved)
+	assert.Zero(t, status.Run.Failed)
+
+	var moved models.Resource
+	require.NoError(t, tc.DB.First(&moved, cold.ID).Error)
+	require.NotNil(t, moved.StorageLocation)
+	assert.Equal(t, "archive", *moved.StorageLocation)
+	_, err := os.Stat(filepath.Join(archiveRoot, filepath.FromSlash(cold.Location)))
+	assert.NoError(t, err, "the file is not on the archive")
+
+	file := fetchResourceFile(t, tc, cold.ID)
+	require.Equal(t, http.StatusOK, file.Code)
+	assert.True(t, bytes.Equal(coldPNG, file.Body.Bytes()), "the archived file differs from the upload")
+
+	startStorageTierJob(t, tc, "/v1/admin/tiering/move?pin=true", map[string]any{"ID": []uint{cold.ID}})
+	require.NoError(t, tc.DB.First(&moved, cold.ID).Error)
+	assert.Nil(t, moved.StorageLocation, "the promoted resource is not on the main filesystem")
+
+	resp = tc.MakeRequest(http.MethodGet, "/v1/admin/tiering", nil)
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &status))
+	assert.EqualValues(t, 1, status.Pinned)
+
+	resp = tc.MakeRequest(http.MethodPost, "/v1/admin/tiering/unpin", map[string]any{"ID": []uint{cold.ID}})
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+}
+
+func TestStorageTiering_RefusedWithoutRules(t *testing.T) {
+	tc := SetupTestEnv(t)
+	resp := tc.MakeRequest(http.MethodPost, "/v1/admin/tiering", nil)
+	assert.Equal(t, http.StatusBadRequest, resp.Code, resp.Body.String())
+
+	resp = tc.MakeRequest(http.MethodPost, "/v1/admin/tiering/move?target=nowhere", map[string]any{"ID": []uint{1}})
+	assert.Equal(t, http.StatusBadRequest, resp.Code, resp.Body.String())
+	assert.Contains(t, resp.Body.String(), "'nowhere' is not attached")
+}
@@ -0,0 +1,69 @@
+package api_tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"mahresources/application_context"
+	"mahresources/models"
+)
+
+func TestWatchFolder_ScansAFolderIntoResourcesAndIsRemovedWith404After(t *testing.T) {
+	tc := SetupTestEnv(t)
+	owner := tc.CreateDummyGroup("Inbox")
+	tc.AppCtx.Config.AltFileSystems = map[string]string{"nas": t.TempDir()}
+	nas := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(nas, "/inbox/scan.txt", []byte("scanned page"), 0644))
+	tc.AppCtx.RegisterAltFs("nas", nas)
+
+	resp := tc.MakeRequest(http.MethodPost, "/v1/admin/watch-folders", map[string]any{
+		"name": "inbox", "fileSystem": "nas", "path": "/inbox", "ownerGroupId": owner.ID,
+	})
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	var folder application_context.WatchFolderStatus
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &folder))
+	assert.Equal(t, application_context.WatchOnDeleteKeep, folder.OnDelete)
+
+	resp = tc.MakeRequest(http.MethodPost, "/v1/admin/watch-folders/scan", map[string]any{"id": folder.ID})
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+	var resource models.Resource
+	require.Eventually(t, func() bool {
+		return tc.DB.Where("original_location = ?", "/inbox/scan.txt").First(&resource).Error == nil
+	}, 10*time.Second, 20*time.Millisecond, "the scan made no resource")
+	require.NotNil(t, resource.OwnerId)
+	assert.Equal(t, owner.ID, *resource.OwnerId)
+
+	resp = tc.MakeRequest(http.MethodGet, "/v1/admin/watch-folders", nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+	var folders []application_context.WatchFolderStatus
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &folders))
+	require.Len(t, folders, 1)
+	assert.EqualValues(t, 1, folders[0].Files)
+
+	resp = tc.MakeRequest(http.MethodPost, "/v1/admin/watch-folders/delete", map[string]any{"id": folder.ID})
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	resp = tc.MakeRequest(http.MethodPost, "/v1/admin/watch-folders/delete", map[string]any{"id": folder.ID})
+	assert.Equal(t, http.StatusNotFound, resp.Code, resp.Body.String())
+	resp = tc.MakeRequest(http.MethodPost, "/v1/admin/watch-folders/scan", map[string]any{"id": folder.ID})
+	assert.Equal(t, http.StatusNotFound, resp.Code, resp.Body.String())
+	assert.NoError(t, tc.DB.First(&models.Resource{}, resource.ID).Error, "removing the watch folder removed its resource")
+}
+
+func TestWatchFolder_RejectsAFolderOnAnUnattachedFilesystem(t *testing.T) {
+	tc := SetupTestEnv(t)
+	owner := tc.CreateDummyGroup("Inbox")
+	resp := tc.MakeRequest(http.MethodPost, "/v1/admin/watch-folders", map[string]any{
+		"name": "inbox", "fileSystem": "usb", "path": "/", "ownerGroupId": owner.ID,
+	})
+	assert.Equal(t, http.StatusBadRequest, resp.Code, resp.Body.String())
+
+	resp = tc.MakeRequest(http.MethodGet, "/v1/admin/watch-folders", nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.JSONEq(t, `[]`, resp.Body.String())
+}
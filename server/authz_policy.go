@@ -154,7 +154,14 @@ func isSystemPath(path string) bool {
 	case strings.HasPrefix(path, "/v1/admin/server-stats"),
 		strings.HasPrefix(path, "/v1/admin/data-stats"),
 		strings.HasPrefix(path, "/v1/admin/settings"),
-		strings.HasPrefix(path, "/v1/admin/similarity"):
+		strings.HasPrefix(path, "/v1/admin/similarity"),
+		strings.HasPrefix(path, "/v1/admin/scrub"),
+		strings.HasPrefix(path, "/v1/admin/gc"),
+		strings.HasPrefix(path, "/v1/admin/rehash"),
+		strings.HasPrefix(path, "/v1/admin/rekey"),
+		strings.HasPrefix(path, "/v1/admin/tiering"),
+		strings.HasPrefix(path, "/v1/admin/quotas"),
+		strings.HasPrefix(path, "/v1/admin/watch-folders"):
 		return true
 	case strings.HasPrefix(path, "/v1/user"): // /v1/user, /v1/users, /v1/user/delete (admin user management)
 		return true
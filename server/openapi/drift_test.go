@@ -82,7 +82,7 @@ func TestOpenAPI_RouteRegistrationCoverage(t *testing.T) {
 	inSpec := map[string]bool{}
 	if spec.Paths != nil {
 		for path, pathItem := range spec.Paths.Map() {
-			for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodPatch} {
+			for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodPatch, http.MethodHead, http.MethodOptions} {
 				if pathItemOp(pathItem, method) != nil {
 					inSpec[method+" "+path] = true
 				}
@@ -135,6 +135,10 @@ func pathItemOp(p *openapi3.PathItem, method string) *openapi3.Operation {
 		return p.Delete
 	case http.MethodPatch:
 		return p.Patch
+	case http.MethodHead:
+		return p.Head
+	case http.MethodOptions:
+		return p.Options
 	}
 	return nil
 }
@@ -142,6 +142,10 @@ func (r *Registry) GenerateSpec() *openapi3.T {
 				pathItem.Delete = op
 			case http.MethodPatch:
 				pathItem.Patch = op
+			case http.MethodHead:
+				pathItem.Head = op
+			case http.MethodOptions:
+				pathItem.Options = op
 			}
 		}
 
@@ -612,6 +612,7 @@ func registerRoutes(router *mux.Router, appContext *application_context.Mahresou
 	router.Methods(http.MethodPost).Path("/v1/resource/delete").HandlerFunc(scopedAPI(appContext, api_handlers.GetRemoveResourceHandler))
 	router.Methods(http.MethodPost).Path("/v1/resource/edit").HandlerFunc(scopedAPI(appContext, api_handlers.GetResourceEditHandler))
 	router.Methods(http.MethodGet).Path("/v1/resource/view").HandlerFunc(scopedAPI(appContext, api_handlers.GetResourceContentHandler))
+	router.Methods(http.MethodGet).Path("/v1/resource/text").HandlerFunc(scopedAPI(appContext, api_handlers.GetResourceTextHandler))
 	router.Methods(http.MethodGet).Path("/v1/resource/preview").HandlerFunc(scopedAPI(appContext, api_handlers.GetResourceThumbnailHandler))
 	router.Methods(http.MethodPost).Path("/v1/resource/preview").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		api_handlers.PostResourceCustomThumbnailHandler(scopedCtx(appContext, r), uploadSize)(w, r)
@@ -659,6 +660,18 @@ func registerRoutes(router *mux.Router, appContext *application_context.Mahresou
 	router.Methods(http.MethodGet).Path("/v1/resource/versions/compare").
 		HandlerFunc(scopedAPI(appContext, api_handlers.GetCompareVersionsHandler))
 
+	router.Methods(http.MethodGet).Path("/v1/resource/expansion").
+		HandlerFunc(scopedAPI(appContext, api_handlers.GetArchiveExpansionHandler))
+
+	// Resumable (tus) uploads of resources and versions
+	router.Methods(http.MethodOptions).Path("/v1/uploads").HandlerFunc(api_handlers.GetResumableUploadOptionsHandler(uploadSize))
+	router.Methods(http.MethodPost).Path("/v1/uploads").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		api_handlers.GetCreateResumableUploadHandler(scopedCtx(appContext, r), uploadSize)(w, r)
+	})
+	router.Methods(http.MethodHead).Path("/v1/uploads/{id}").HandlerFunc(scopedAPI(appContext, api_handlers.GetResumableUploadHeadHandler))
+	router.Methods(http.MethodPatch).Path("/v1/uploads/{id}").HandlerFunc(scopedAPI(appContext, api_handlers.GetResumableUploadPatchHandler))
+	router.Methods(http.MethodDelete).Path("/v1/uploads/{id}").HandlerFunc(scopedAPI(appContext, api_handlers.GetResumableUploadDeleteHandler))
+
 	// Series routes
 	seriesReader, seriesWriter := appContext.SeriesCRUD()
 	seriesFactory := api_handlers.NewCRUDHandlerFactory("series", "series", seriesReader, seriesWriter)
@@ -745,7 +758,13 @@ func registerRoutes(router *mux.Router, appContext *application_context.Mahresou
 	router.Methods(http.MethodPost).Path("/v1/mrql").HandlerFunc(scopedMRQLAPI(appContext, api_handlers.GetExecuteMRQLHandler))
 	router.Methods(http.MethodPost).Path("/v1/mrql/explain").HandlerFunc(scopedMRQLAPI(appContext, api_handlers.GetExplainMRQLHandler))
 	router.Methods(http.MethodGet, http.MethodPost).Path("/v1/mrql/export").HandlerFunc(scopedMRQLAPI(appContext, api_handlers.GetExportMRQLHandler))
+	router.Methods(http.MethodPost).Path("/v1/mrql/mutate").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Not scopedMRQLAPI: the plan's bulk edits run through the ORM scope,
+		// which only the full request scope installs. The job inherits it.
+		api_handlers.GetMutateMRQLHandler(scopedCtx(appContext, r))(w, r)
+	})
 	router.Methods(http.MethodPost).Path("/v1/mrql/validate").HandlerFunc(api_handlers.GetValidateMRQLHandler(appContext))
+	router.Methods(http.MethodPost).Path("/v1/mrql/format").HandlerFunc(api_handlers.GetFormatMRQLHandler(appContext))
 	router.Methods(http.MethodPost).Path("/v1/mrql/complete").HandlerFunc(api_handlers.GetCompleteMRQLHandler(appContext))
 	router.Methods(http.MethodPost).Path("/v1/mrql/generate").HandlerFunc(api_handlers.GetGenerateMRQLHandler(appContext))
 	router.Methods(http.MethodGet).Path("/v1/mrql/saved").HandlerFunc(api_handlers.GetSavedMRQLQueriesHandler(appContext))
@@ -753,6 +772,7 @@ func registerRoutes(router *mux.Router, appContext *application_context.Mahresou
 	router.Methods(http.MethodPut).Path("/v1/mrql/saved").HandlerFunc(api_handlers.GetUpdateSavedMRQLQueryHandler(appContext))
 	router.Methods(http.MethodPost).Path("/v1/mrql/saved/delete").HandlerFunc(api_handlers.GetDeleteSavedMRQLQueryHandler(appContext))
 	router.Methods(http.MethodPost).Path("/v1/mrql/saved/run").HandlerFunc(scopedMRQLAPI(appContext, api_handlers.GetRunSavedMRQLQueryHandler))
+	router.Methods(http.MethodPost).Path("/v1/mrql/saved/refresh").HandlerFunc(scopedMRQLAPI(appContext, api_handlers.GetRefreshSavedMRQLQueryHandler))
 
 	// Shortcode editor tooling (docs registry powers lint + autocomplete)
 	router.Methods(http.MethodGet).Path("/v1/shortcodes/docs").HandlerFunc(api_handlers.GetShortcodeDocsHandler(appContext))
@@ -858,6 +878,41 @@ func registerRoutes(router *mux.Router, appContext *application_context.Mahresou
 	router.Methods(http.MethodPost).Path("/v1/admin/similarity/recompute").HandlerFunc(api_handlers.GetRecomputeSimilaritiesHandler(appContext))
 	router.Methods(http.MethodPost).Path("/v1/admin/similarity/retry-failed").HandlerFunc(api_handlers.GetRetryFailedHashesHandler(appContext))
 
+	// Admin blob integrity scrub
+	router.Methods(http.MethodPost).Path("/v1/admin/scrub").HandlerFunc(api_handlers.GetStartBlobScrubHandler(appContext))
+	router.Methods(http.MethodGet).Path("/v1/admin/scrub").HandlerFunc(api_handlers.GetBlobScrubStatusHandler(appContext))
+	router.Methods(http.MethodGet).Path("/v1/admin/scrub/issues").HandlerFunc(api_handlers.GetBlobIntegrityIssuesHandler(appContext))
+	router.Methods(http.MethodPost).Path("/v1/admin/scrub/recheck").HandlerFunc(api_handlers.GetRecheckBlobIntegrityIssueHandler(appContext))
+
+	// Admin orphaned blob garbage collection
+	router.Methods(http.MethodPost).Path("/v1/admin/gc").HandlerFunc(api_handlers.GetStartBlobGCHandler(appContext))
+	router.Methods(http.MethodGet).Path("/v1/admin/gc").HandlerFunc(api_handlers.GetBlobGCStatusHandler(appContext))
+
+	// Admin SHA1 to SHA-256 content hash migration
+	router.Methods(http.MethodPost).Path("/v1/admin/rehash").HandlerFunc(api_handlers.GetStartContentHashMigrationHandler(appContext))
+	router.Methods(http.MethodGet).Path("/v1/admin/rehash").HandlerFunc(api_handlers.GetContentHashMigrationStatusHandler(appContext))
+
+	// Admin master key rotation for encrypted storage
+	router.Methods(http.MethodPost).Path("/v1/admin/rekey").HandlerFunc(api_handlers.GetStartKeyRotationHandler(appContext))
+	router.Methods(http.MethodGet).Path("/v1/admin/rekey").HandlerFunc(api_handlers.GetKeyRotationStatusHandler(appContext))
+
+	// Admin storage tiering between filesystems
+	router.Methods(http.MethodPost).Path("/v1/admin/tiering").HandlerFunc(api_handlers.GetStartStorageTieringHandler(appContext))
+	router.Methods(http.MethodGet).Path("/v1/admin/tiering").HandlerFunc(api_handlers.GetStorageTierStatusHandler(appContext))
+	router.Methods(http.MethodPost).Path("/v1/admin/tiering/move").HandlerFunc(api_handlers.GetStorageTierMoveHandler(appContext))
+	router.Methods(http.MethodPost).Path("/v1/admin/tiering/pin").HandlerFunc(api_handlers.GetStorageTierPinHandler(appContext, true))
+	router.Methods(http.MethodPost).Path("/v1/admin/tiering/unpin").HandlerFunc(api_handlers.GetStorageTierPinHandler(appContext, false))
+
+	// Admin storage quotas
+	router.Methods(http.MethodGet).Path("/v1/admin/quotas").HandlerFunc(api_handlers.GetListStorageQuotasHandler(appContext))
+	router.Methods(http.MethodPost).Path("/v1/admin/quotas").HandlerFunc(api_handlers.GetSetStorageQuotaHandler(appContext))
+	router.Methods(http.MethodPost).Path("/v1/admin/quotas/delete").HandlerFunc(api_handlers.GetDeleteStorageQuotaHandler(appContext))
+	router.Methods(http.MethodPost).Path("/v1/admin/quotas/recount").HandlerFunc(api_handlers.GetRecountStorageUsageHandler(appContext))
+	router.Methods(http.MethodGet).Path("/v1/admin/watch-folders").HandlerFunc(api_handlers.GetListWatchFoldersHandler(appContext))
+	router.Methods(http.MethodPost).Path("/v1/admin/watch-folders").HandlerFunc(api_handlers.GetSetWatchFolderHandler(appContext))
+	router.Methods(http.MethodPost).Path("/v1/admin/watch-folders/delete").HandlerFunc(api_handlers.GetDeleteWatchFolderHandler(appContext))
+	router.Methods(http.MethodPost).Path("/v1/admin/watch-folders/scan").HandlerFunc(api_handlers.GetStartWatchScanHandler(appContext))
+
 	// Admin runtime settings routes
 	router.Methods(http.MethodGet).Path("/v1/admin/settings").HandlerFunc(api_handlers.GetListSettingsHandler(appContext))
 	router.Methods(http.MethodPut).Path("/v1/admin/settings/{key}").HandlerFunc(api_handlers.GetSetSettingHandler(appContext))
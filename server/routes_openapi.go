@@ -50,6 +50,9 @@ func RegisterAPIRoutesWithOpenAPI(registry *openapi.Registry) {
 	// Resource Versions
 	registerVersionRoutes(registry)
 
+	// Resumable (tus) uploads
+	registerResumableUploadRoutes(registry)
+
 	// Series
 	registerSeriesRoutes(registry)
 
@@ -679,6 +682,60 @@ func registerVersionRoutes(r *openapi.Registry) {
 	})
 }
 
+func registerResumableUploadRoutes(r *openapi.Registry) {
+	uploadID := []openapi.PathParam{
+		{Name: "id", Type: "string", Description: "The upload ID from the Location header of createResumableUpload"},
+	}
+
+	r.Register(openapi.RouteInfo{
+		Method:      http.MethodOptions,
+		Path:        "/v1/uploads",
+		OperationID: "getResumableUploadOptions",
+		Summary:     "Discover the tus protocol support",
+		Description: "Returns 204 with the Tus-Version, Tus-Extension (creation, creation-with-upload, termination, expiration) and, when an upload size limit is set, Tus-Max-Size headers.",
+		Tags:        []string{"uploads"},
+	})
+
+	r.Register(openapi.RouteInfo{
+		Method:      http.MethodPost,
+		Path:        "/v1/uploads",
+		OperationID: "createResumableUpload",
+		Summary:     "Start a resumable upload",
+		Description: "Starts a tus 1.0.0 upload of Upload-Length bytes and returns 201 with its URL in the Location header. Upload-Metadata carries base64 values: filename, and the fields of the resource to create with the same names as the multipart upload (Name, Description, OwnerId, Tags, Groups, Notes as comma-separated IDs, Meta, ...). A resourceId key makes the upload a new version of that resource instead, with an optional comment; an expand key set to true unpacks the archive into a new group instead of storing it. A body sent as application/offset+octet-stream is the first chunk. Requires the Tus-Resumable: 1.0.0 header; 412 without it, 413 above the upload size limit, 404 if resourceId names no resource.",
+		Tags:        []string{"uploads"},
+	})
+
+	r.Register(openapi.RouteInfo{
+		Method:      http.MethodHead,
+		Path:        "/v1/uploads/{id}",
+		OperationID: "getResumableUploadOffset",
+		Summary:     "Get a resumable upload's offset",
+		Description: "Returns Upload-Offset, the bytes received so far, with Upload-Length and Upload-Expires. Once the upload is complete, X-Resource-Id names the resource it created, X-Version-Id the version, and X-Expansion-Id the archive expansion it started. 404 for an unknown or expired upload, or one another user started.",
+		Tags:        []string{"uploads"},
+		PathParams:  uploadID,
+	})
+
+	r.Register(openapi.RouteInfo{
+		Method:      http.MethodPatch,
+		Path:        "/v1/uploads/{id}",
+		OperationID: "writeResumableUpload",
+		Summary:     "Send a chunk of a resumable upload",
+		Description: "Stores the application/offset+octet-stream body at Upload-Offset and returns 204 with the new Upload-Offset. The chunk that completes the upload creates the resource or version, through the same path as a multipart upload, before the response; X-Resource-Id, X-Version-Id or X-Expansion-Id name the result. 409 if Upload-Offset is not the upload's offset, or if the file duplicates an existing resource (the body then carries its ID); 413 if the chunk runs past Upload-Length; 415 for another Content-Type; 423 while another request is writing to the upload.",
+		Tags:        []string{"uploads"},
+		PathParams:  uploadID,
+	})
+
+	r.Register(openapi.RouteInfo{
+		Method:      http.MethodDelete,
+		Path:        "/v1/uploads/{id}",
+		OperationID: "deleteResumableUpload",
+		Summary:     "Abandon a resumable upload",
+		Description: "Deletes the upload and the chunks received so far. A resource or version it already created is kept.",
+		Tags:        []string{"uploads"},
+		PathParams:  uploadID,
+	})
+}
+
 func registerSeriesRoutes(r *openapi.Registry) {
 	seriesType := reflect.TypeOf(models.Series{})
 	seriesQueryType := reflect.TypeOf(query_models.SeriesQuery{})
@@ -1264,6 +1321,7 @@ func registerResourceRoutes(r *openapi.Registry) {
 		Path:                 "/v1/resource",
 		OperationID:          "createResource",
 		Summary:              "Create a resource (upload file or from URL)",
+		Description:          "With the form field expand=true, each uploaded zip, tar or gzipped tar is unpacked into a new group in the background instead of being stored: the response is 202 with the started expansions (see getArchiveExpansion), and 400 for a file that is not an archive.",
 		Tags:                 []string{"resources"},
 		HasFileUpload:        true,
 		FileFieldName:        "resource",
@@ -1273,6 +1331,19 @@ func registerResourceRoutes(r *openapi.Registry) {
 		ResponseContentTypes: []openapi.ContentType{openapi.ContentTypeJSON},
 	})
 
+	r.Register(openapi.RouteInfo{
+		Method:               http.MethodGet,
+		Path:                 "/v1/resource/expansion",
+		OperationID:          "getArchiveExpansion",
+		Summary:              "Get an archive expansion",
+		Description:          "Returns an upload sent with expand: the group it was unpacked into, the files it holds, how many were created, skipped as duplicates or failed, and a report of the skipped and failed entries. finishedAt stays null while the job runs. 404 for an unknown expansion, or one another user started.",
+		Tags:                 []string{"resources"},
+		IDQueryParam:         "id",
+		IDRequired:           true,
+		ResponseType:         reflect.TypeOf(models.ArchiveExpansion{}),
+		ResponseContentTypes: []openapi.ContentType{openapi.ContentTypeJSON},
+	})
+
 	r.Register(openapi.RouteInfo{
 		Method:               http.MethodPost,
 		Path:                 "/v1/resource/local",
@@ -1329,6 +1400,19 @@ func registerResourceRoutes(r *openapi.Registry) {
 		IDRequired:   false,
 	})
 
+	r.Register(openapi.RouteInfo{
+		Method:               http.MethodGet,
+		Path:                 "/v1/resource/text",
+		OperationID:          "getResourceText",
+		Summary:              "Get the text extracted from a resource's file",
+		Description:          "The text layer of a PDF, read when its thumbnail is first generated. 404 until then, and for resources with no text.",
+		Tags:                 []string{"resources"},
+		IDQueryParam:         "id",
+		IDRequired:           true,
+		ResponseType:         reflect.TypeOf(models.ResourceText{}),
+		ResponseContentTypes: []openapi.ContentType{openapi.ContentTypeJSON},
+	})
+
 	r.Register(openapi.RouteInfo{
 		Method:       http.MethodGet,
 		Path:         "/v1/resource/preview",
@@ -1920,6 +2004,8 @@ Request body fields:
   - buckets (integer)          — buckets per page (grouped mode only)
   - page    (integer)          — 1-based page number
   - offset  (integer)          — explicit cursor offset (takes precedence over page)
+  - cursor  (string)           — keyset cursor from a previous response's nextCursor
+                                 (non-grouped queries; replaces page)
 
 Query parameter:
   - render (0 or 1) — when 1, populates each result row's RenderedHTML using
@@ -1938,7 +2024,26 @@ group-by key names in the order the query wrote them, matching the leading
 columns of the CSV export's bucketed header. Each bucket's "key" object is
 unchanged, and may carry entries "keyColumns" does not name — a bucket keyed on
 a relation field also gets "<field>_id", so two same-named groups stay
-distinguishable.`,
+distinguishable.
+
+A SELECT query answers with mode "projected": one row per matching entity,
+keyed by column name, with "columns" in SELECT order. It pages with limit and
+page (or offset) like an aggregated GROUP BY; cursor is rejected.
+
+A cross-entity response (entityType "all", no type = filter) is produced by one
+UNION ALL over resources, notes, and groups, so ORDER BY, LIMIT, and OFFSET
+apply across all three. It carries "items": one {entityType, id, name, created,
+updated} entry per row in that global order. "resources", "notes", and "groups"
+still hold the full entities, each in the same relative order.
+
+Non-grouped queries whose ORDER BY is resumable (plain non-null fields — not
+RANDOM(), rank, distance, relation counts, meta keys, or nullable fields) run in
+keyset mode: the id is appended as a final tiebreak, and a full page carries
+"nextCursor", an opaque token for the page after its last row. Sending it back
+as "cursor" resumes strictly after that row, so rows inserted or deleted ahead
+of it never shift or repeat later pages the way OFFSET does. A cursor only
+resumes the query shape (entity type and ORDER BY) that issued it; anything
+else is a 400.`,
 		Tags:                mrqlTag,
 		RequestContentTypes: []openapi.ContentType{openapi.ContentTypeJSON, openapi.ContentTypeForm},
 		ExtraQueryParams: []openapi.QueryParam{
@@ -1963,6 +2068,25 @@ Response: {"valid": bool, "errors": [...]}`,
 		ResponseContentTypes: []openapi.ContentType{openapi.ContentTypeJSON},
 	})
 
+	r.Register(openapi.RouteInfo{
+		Method:      http.MethodPost,
+		Path:        "/v1/mrql/format",
+		OperationID: "formatMRQL",
+		Summary:     "Format MRQL in canonical layout",
+		Description: `Parses an MRQL query or mutation statement and prints it back in canonical
+layout: keywords upper-cased, one clause per line, bare values quoted, and only
+the parentheses precedence needs. The query is not validated or executed.
+
+Request body fields:
+  - query (string, required)
+
+Response: {"formatted": string, "changed": bool} or, when the query does not
+parse, {"changed": false, "errors": [{"message","pos","length"}]}`,
+		Tags:                 mrqlTag,
+		RequestContentTypes:  []openapi.ContentType{openapi.ContentTypeJSON, openapi.ContentTypeForm},
+		ResponseContentTypes: []openapi.ContentType{openapi.ContentTypeJSON},
+	})
+
 	r.Register(openapi.RouteInfo{
 		Method:      http.MethodPost,
 		Path:        "/v1/mrql/explain",
@@ -1988,6 +2112,9 @@ Each statement retains label/sql/vars/interpolated and optionally includes nativ
 {"dialect","format","plan"}. SQLite uses EXPLAIN QUERY PLAN rows; PostgreSQL
 uses EXPLAIN (FORMAT JSON). EXPLAIN ANALYZE is never used. All native statements
 share one MRQL timeout and the request fails atomically if any plan fails.
+An aggregated GROUP BY statement also lists aggregates: one {"key","function",
+"method","sql","note"} per aggregate column, where method is native, emulated
+(e.g. SQLite percentiles) or window (running totals).
 
 Bucketed grouping reports key discovery plus data-dependent fan-out bounds rather
 than executing discovery. A principal scoped to no groups receives statements: []
@@ -2011,6 +2138,7 @@ and zero-statement bounds. Non-admins retain generated-SQL explain access but re
 			{Name: "id", Type: "integer", Description: "Saved query id"},
 			{Name: "name", Type: "string", Description: "Saved query name"},
 			{Name: "format", Type: "string", Description: "Export format: csv (default) or json"},
+			{Name: "cursor", Type: "string", Description: "Keyset cursor from a previous page's X-MRQL-Next-Cursor"},
 		},
 	})
 
@@ -2022,14 +2150,17 @@ and zero-statement bounds. Non-admins retain generated-SQL explain access but re
 		Description: `Executes a query (inline or saved) and streams the result as a file download.
 
 Accepts the same inputs as /v1/mrql (query or id/name, params / param.<name>, limit,
-page, buckets, offset) plus:
+page, buckets, offset, cursor) plus:
   - format (csv|json) — default csv
 
-CSV shapes: aggregated → GROUP BY keys + aggregate aliases; flat → fixed scalar
+CSV shapes: aggregated → GROUP BY keys + aggregate aliases; projected → the SELECT
+columns in order; flat → fixed scalar
 columns per entity (meta as a JSON string); bucketed → bucket-key columns then the
 flat item columns. CSV requires a single entity type; use format=json for
 cross-entity results. When no explicit LIMIT is present the default is applied and
-reported via the X-MRQL-Default-Limit-Applied response header.`,
+reported via the X-MRQL-Default-Limit-Applied response header. A keyset-paged
+flat export that filled its page reports the next page's cursor in the
+X-MRQL-Next-Cursor response header (and as nextCursor in the JSON body).`,
 		Tags:                 mrqlTag,
 		RequestContentTypes:  []openapi.ContentType{openapi.ContentTypeJSON, openapi.ContentTypeForm},
 		ResponseContentTypes: []openapi.ContentType{openapi.ContentTypeJSON},
@@ -2038,6 +2169,38 @@ reported via the X-MRQL-Default-Limit-Applied response header.`,
 		},
 	})
 
+	r.Register(openapi.RouteInfo{
+		Method:      http.MethodPost,
+		Path:        "/v1/mrql/mutate",
+		OperationID: "mutateMRQL",
+		Summary:     "Bulk-edit the entities an MRQL filter matches",
+		Description: `Parses an MRQL mutation — a filter for one entity type followed by one or more
+write clauses — and applies it to every matching entity the caller can see:
+
+  type = resource AND tags = "inbox" ADD TAGS "triaged" REMOVE TAGS "inbox"
+  type = note AND meta.status = "draft" SET meta.status = "final", meta.reviewer = NULL
+  type = group AND parent.name = "Inbox" MOVE TO "Archive"
+
+Request body fields:
+  - query  (string, required) — the mutation statement
+  - params (object)           — $name placeholder bindings
+  - dryRun (boolean)          — resolve and report without writing
+
+Query parameters:
+  - param.<name>=<value> — alternative to the params object (always strings)
+
+Tag and group references are quoted names or numeric IDs and must resolve before
+anything is written. ORDER BY, LIMIT, OFFSET, and GROUP BY are rejected, and a
+filter matching more than 10000 entities is refused.
+
+dryRun returns {entityType, affected, sample, addTagIds, removeTagIds, meta,
+moveToId}. Otherwise the edit runs as a background job (source "mrql-mutation")
+and the response is HTTP 202 with {jobId, affected}.`,
+		Tags:                 mrqlTag,
+		RequestContentTypes:  []openapi.ContentType{openapi.ContentTypeJSON, openapi.ContentTypeForm},
+		ResponseContentTypes: []openapi.ContentType{openapi.ContentTypeJSON},
+	})
+
 	r.Register(openapi.RouteInfo{
 		Method:      http.MethodPost,
 		Path:        "/v1/mrql/complete",
@@ -2094,9 +2257,12 @@ The endpoint does not execute MRQL. The server sends the prompt and syntax-only
 		OperationID: "createSavedMRQLQuery",
 		Summary:     "Create a saved MRQL query",
 		Description: `Request body fields:
-  - name        (string, required)
-  - query       (string, required) — MRQL source
-  - description (string)`,
+  - name                   (string, required)
+  - query                  (string, required) — MRQL source
+  - description            (string)
+  - materialized           (bool) — serve the query from a stored result
+  - refreshPolicy          (string) — "on_write" (default) or "interval"
+  - refreshIntervalSeconds (integer) — required by "interval", at least 60`,
 		Tags:                 mrqlTag,
 		RequestContentTypes:  []openapi.ContentType{openapi.ContentTypeJSON, openapi.ContentTypeForm},
 		ResponseType:         savedMRQLType,
@@ -2108,6 +2274,7 @@ The endpoint does not execute MRQL. The server sends the prompt and syntax-only
 		Path:                 "/v1/mrql/saved",
 		OperationID:          "updateSavedMRQLQuery",
 		Summary:              "Update a saved MRQL query",
+		Description:          "Same body fields as create. Leaving out `materialized` keeps the query's current materialization.",
 		Tags:                 mrqlTag,
 		IDQueryParam:         "id",
 		IDRequired:           true,
@@ -2133,7 +2300,7 @@ The endpoint does not execute MRQL. The server sends the prompt and syntax-only
 		Path:        "/v1/mrql/saved/run",
 		OperationID: "runSavedMRQLQuery",
 		Summary:     "Execute a saved MRQL query by id or name",
-		Description: "Runs a previously saved MRQL query. Accepts either `id` or `name` to identify the saved query, plus the same pagination params as /v1/mrql.",
+		Description: "Runs a previously saved MRQL query. Accepts either `id` or `name` to identify the saved query, plus the same pagination params as /v1/mrql. A materialized query run without limit, page, buckets, offset, cursor or params is served from its stored result, with staleness metadata under `materialized`.",
 		Tags:        mrqlTag,
 		ExtraQueryParams: []openapi.QueryParam{
 			{Name: "id", Type: "integer", Description: "Saved query ID"},
@@ -2142,12 +2309,28 @@ The endpoint does not execute MRQL. The server sends the prompt and syntax-only
 			{Name: "page", Type: "integer"},
 			{Name: "buckets", Type: "integer"},
 			{Name: "offset", Type: "integer"},
+			{Name: "cursor", Type: "string", Description: "Keyset cursor from a previous response's nextCursor"},
 			{Name: "render", Type: "integer", Description: "Set to 1 to render CustomMRQLResult templates"},
 		},
 		RequestContentTypes:  []openapi.ContentType{openapi.ContentTypeJSON, openapi.ContentTypeForm},
 		ResponseContentTypes: []openapi.ContentType{openapi.ContentTypeJSON},
 	})
 
+	r.Register(openapi.RouteInfo{
+		Method:      http.MethodPost,
+		Path:        "/v1/mrql/saved/refresh",
+		OperationID: "refreshSavedMRQLQuery",
+		Summary:     "Recompute a materialized saved MRQL query",
+		Description: "Recomputes and stores the result of a materialized saved query now, whatever its refresh policy says. Accepts either `id` or `name`. Returns the new staleness metadata. 409 if the query is not materialized; 403 for a group-limited principal.",
+		Tags:        mrqlTag,
+		ExtraQueryParams: []openapi.QueryParam{
+			{Name: "id", Type: "integer", Description: "Saved query ID"},
+			{Name: "name", Type: "string", Description: "Saved query name (fallback if id not found)"},
+		},
+		ResponseType:         reflect.TypeOf(application_context.MRQLMaterializedInfo{}),
+		ResponseContentTypes: []openapi.ContentType{openapi.ContentTypeJSON},
+	})
+
 	// Shortcode editor tooling
 	shortcodesTag := []string{"shortcodes"}
 
@@ -2909,6 +3092,304 @@ func registerAdminRoutes(r *openapi.Registry) {
 		ResponseContentTypes: []openapi.ContentType{openapi.ContentTypeJSON},
 	})
 
+	r.Register(openapi.RouteInfo{
+		Method:      http.MethodPost,
+		Path:        "/v1/admin/scrub",
+		OperationID: "startBlobScrub",
+		Summary:     "Start the blob integrity scrub",
+		Description: "Submits a background job that re-hashes every resource file, version file and preview across the main and alt filesystems, recording missing, truncated and corrupted files and quarantining them. Resumes the newest unfinished run from its checkpoint unless restart is set. 409 if a scrub is already running.",
+		Tags:        []string{"admin"},
+		ExtraQueryParams: []openapi.QueryParam{
+			{Name: "repair", Type: "boolean", Description: "Restore damaged files from intact copies with the same hash"},
+			{Name: "restart", Type: "boolean", Description: "Abandon the unfinished run and start from the beginning"},
+		},
+		ResponseType:         reflect.TypeOf(application_context.BlobScrubStart{}),
+		ResponseContentTypes: []openapi.ContentType{openapi.ContentTypeJSON},
+	})
+
+	r.Register(openapi.RouteInfo{
+		Method:               http.MethodGet,
+		Path:                 "/v1/admin/scrub",
+		OperationID:          "getBlobScrubStatus",
+		Summary:              "Get blob integrity scrub status",
+		Description:          "Returns whether a scrub is running, the newest run with its checkpoint and counts, and the number of issues by status.",
+		Tags:                 []string{"admin"},
+		ResponseType:         reflect.TypeOf(application_context.BlobScrubStatus{}),
+		ResponseContentTypes: []openapi.ContentType{openapi.ContentTypeJSON},
+	})
+
+	r.Register(openapi.RouteInfo{
+		Method:      http.MethodGet,
+		Path:        "/v1/admin/scrub/issues",
+		OperationID: "listBlobIntegrityIssues",
+		Summary:     "List blob integrity issues",
+		Description: "Returns the scrub report, most recently checked first.",
+		Tags:        []string{"admin"},
+		ExtraQueryParams: []openapi.QueryParam{
+			{Name: "status", Type: "string", Description: "quarantined, repaired or cleared"},
+			{Name: "problem", Type: "string", Description: "missing, truncated, corrupted or unreadable"},
+			{Name: "page", Type: "integer", Description: "Page number (default: 1)"},
+		},
+		ResponseType:         reflect.TypeOf([]models.BlobIntegrityIssue{}),
+		ResponseContentTypes: []openapi.ContentType{openapi.ContentTypeJSON},
+	})
+
+	r.Register(openapi.RouteInfo{
+		Method:      http.MethodPost,
+		Path:        "/v1/admin/scrub/recheck",
+		OperationID: "recheckBlobIntegrityIssue",
+		Summary:     "Recheck a blob integrity issue",
+		Description: "Checks the issue's file again. An intact file clears the issue and lifts its quarantine.",
+		Tags:        []string{"admin"},
+		ExtraQueryParams: []openapi.QueryParam{
+			{Name: "id", Type: "integer", Required: true, Description: "Issue ID"},
+			{Name: "repair", Type: "boolean", Description: "Restore the file from an intact copy if it is still damaged"},
+		},
+		ResponseType:         reflect.TypeOf(models.BlobIntegrityIssue{}),
+		ResponseContentTypes: []openapi.ContentType{openapi.ContentTypeJSON},
+	})
+
+	r.Register(openapi.RouteInfo{
+		Method:      http.MethodPost,
+		Path:        "/v1/admin/gc",
+		OperationID: "startBlobGC",
+		Summary:     "Start orphaned blob garbage collection",
+		Description: "Submits a background mark-and-sweep of the content-addressed storage: files under /resources/ on every filesystem that no resource or version references, and older than the grace period, are deleted, and preview rows whose resource is gone are removed. Rows whose file is missing are reported. A dry run only reports. 409 if a collection is already running.",
+		Tags:        []string{"admin"},
+		ExtraQueryParams: []openapi.QueryParam{
+			{Name: "dryRun", Type: "boolean", Description: "List what would be deleted without deleting it"},
+			{Name: "grace", Type: "string", Description: "Skip files modified within this duration, e.g. 1h (default: 24h)"},
+		},
+		ResponseType:         reflect.TypeOf(application_context.BlobGCStart{}),
+		ResponseContentTypes: []openapi.ContentType{openapi.ContentTypeJSON},
+	})
+
+	r.Register(openapi.RouteInfo{
+		Method:      http.MethodGet,
+		Path:        "/v1/admin/gc",
+		OperationID: "getBlobGCStatus",
+		Summary:     "Get a blob garbage collection report",
+		Description: "Returns whether a collection is running and a run with its report: reclaimed bytes and orphaned files per filesystem, dangling rows and orphaned previews.",
+		Tags:        []string{"admin"},
+		ExtraQueryParams: []openapi.QueryParam{
+			{Name: "id", Type: "integer", Description: "Run ID (default: the newest run)"},
+		},
+		ResponseType:         reflect.TypeOf(application_context.BlobGCStatus{}),
+		ResponseContentTypes: []openapi.ContentType{openapi.ContentTypeJSON},
+	})
+
+	r.Register(openapi.RouteInfo{
+		Method:      http.MethodPost,
+		Path:        "/v1/admin/rehash",
+		OperationID: "startContentHashMigration",
+		Summary:     "Start the content hash migration",
+		Description: "Submits a background job that re-hashes every resource and version still on SHA1 with SHA-256, keeping the SHA1 as the legacy hash so lookups by either still match. Files are checked against their SHA1 first; missing or mismatched ones are skipped. Resumes the newest unfinished run from its checkpoint unless restart is set. 409 if a migration is already running.",
+		Tags:        []string{"admin"},
+		ExtraQueryParams: []openapi.QueryParam{
+			{Name: "restart", Type: "boolean", Description: "Abandon the unfinished run and start from the beginning"},
+		},
+		ResponseType:         reflect.TypeOf(application_context.ContentHashMigrationStart{}),
+		ResponseContentTypes: []openapi.ContentType{openapi.ContentTypeJSON},
+	})
+
+	r.Register(openapi.RouteInfo{
+		Method:               http.MethodGet,
+		Path:                 "/v1/admin/rehash",
+		OperationID:          "getContentHashMigrationStatus",
+		Summary:              "Get content hash migration status",
+		Description:          "Returns whether a migration is running, the newest run with its checkpoint and counts, and how many resources and versions are still hashed with SHA1.",
+		Tags:                 []string{"admin"},
+		ResponseType:         reflect.TypeOf(application_context.ContentHashMigrationStatus{}),
+		ResponseContentTypes: []openapi.ContentType{openapi.ContentTypeJSON},
+	})
+
+	r.Register(openapi.RouteInfo{
+		Method:               http.MethodPost,
+		Path:                 "/v1/admin/rekey",
+		OperationID:          "startKeyRotation",
+		Summary:              "Start a master key rotation",
+		Description:          "Submits a background job that brings every file on the main and every alt filesystem onto the current master key: files wrapped with a previous key get their file key re-wrapped without re-encrypting the content, and files stored in the clear are encrypted. 400 if encryption is not enabled; 409 if a rotation is already running.",
+		Tags:                 []string{"admin"},
+		ResponseType:         reflect.TypeOf(application_context.KeyRotationStart{}),
+		ResponseContentTypes: []openapi.ContentType{openapi.ContentTypeJSON},
+	})
+
+	r.Register(openapi.RouteInfo{
+		Method:               http.MethodGet,
+		Path:                 "/v1/admin/rekey",
+		OperationID:          "getKeyRotationStatus",
+		Summary:              "Get master key rotation status",
+		Description:          "Returns whether encryption is enabled, the IDs of the current and previous master keys, whether a rotation is running, and the newest rotation run with its counts.",
+		Tags:                 []string{"admin"},
+		ResponseType:         reflect.TypeOf(application_context.KeyRotationStatus{}),
+		ResponseContentTypes: []openapi.ContentType{openapi.ContentTypeJSON},
+	})
+
+	r.Register(openapi.RouteInfo{
+		Method:      http.MethodPost,
+		Path:        "/v1/admin/tiering",
+		OperationID: "startStorageTiering",
+		Summary:     "Apply the storage tiering rules",
+		Description: "Submits a background job that moves each resource a tiering rule matches, unless it is pinned, to the rule's alt filesystem along with its versions. Rules are tried in order; a resource goes where the first rule it matches says. Each file is copied, verified against its hash and only then switched over; a resource whose file is damaged is left where it is. A dry run only counts. 400 if no rules are configured; 409 if resources are already being moved.",
+		Tags:        []string{"admin"},
+		ExtraQueryParams: []openapi.QueryParam{
+			{Name: "dryRun", Type: "boolean", Description: "Count what the rules would move without moving it"},
+		},
+		ResponseType:         reflect.TypeOf(application_context.StorageTierStart{}),
+		ResponseContentTypes: []openapi.ContentType{openapi.ContentTypeJSON},
+	})
+
+	r.Register(openapi.RouteInfo{
+		Method:      http.MethodGet,
+		Path:        "/v1/admin/tiering",
+		OperationID: "getStorageTierStatus",
+		Summary:     "Get storage tiering status",
+		Description: "Returns the configured tiering rules and interval, how many resources are pinned, whether resources are being moved, and a run with its per-rule report.",
+		Tags:        []string{"admin"},
+		ExtraQueryParams: []openapi.QueryParam{
+			{Name: "id", Type: "integer", Description: "Run ID (default: the newest run)"},
+		},
+		ResponseType:         reflect.TypeOf(application_context.StorageTierStatus{}),
+		ResponseContentTypes: []openapi.ContentType{openapi.ContentTypeJSON},
+	})
+
+	r.Register(openapi.RouteInfo{
+		Method:      http.MethodPost,
+		Path:        "/v1/admin/tiering/move",
+		OperationID: "moveResourcesToStorageTier",
+		Summary:     "Move resources to another filesystem",
+		Description: "Submits a background job that moves the given resources and their versions to an alt filesystem, or back to the main filesystem when target is empty, the same way the tiering rules do. 400 if the target is not attached; 409 if resources are already being moved.",
+		Tags:        []string{"admin"},
+		ExtraQueryParams: []openapi.QueryParam{
+			{Name: "id", Type: "integer", Required: true, Description: "Resource ID (repeatable)"},
+			{Name: "target", Type: "string", Description: "Alt filesystem key (default: the main filesystem)"},
+			{Name: "pin", Type: "boolean", Description: "Pin the resources first, so the rules leave them on the target"},
+		},
+		ResponseType:         reflect.TypeOf(application_context.StorageTierStart{}),
+		ResponseContentTypes: []openapi.ContentType{openapi.ContentTypeJSON},
+	})
+
+	for _, pin := range []struct{ path, operationID, summary, description string }{
+		{"/v1/admin/tiering/pin", "pinStorageTier", "Pin resources to their filesystem", "The tiering rules skip pinned resources. Pinning a resource already pinned is not an error."},
+		{"/v1/admin/tiering/unpin", "unpinStorageTier", "Unpin resources", "Lets the tiering rules move the resources again."},
+	} {
+		r.Register(openapi.RouteInfo{
+			Method:      http.MethodPost,
+			Path:        pin.path,
+			OperationID: pin.operationID,
+			Summary:     pin.summary,
+			Description: pin.description,
+			Tags:        []string{"admin"},
+			ExtraQueryParams: []openapi.QueryParam{
+				{Name: "id", Type: "integer", Required: true, Description: "Resource ID (repeatable)"},
+			},
+			ResponseContentTypes: []openapi.ContentType{openapi.ContentTypeJSON},
+		})
+	}
+
+	r.Register(openapi.RouteInfo{
+		Method:               http.MethodGet,
+		Path:                 "/v1/admin/quotas",
+		OperationID:          "listStorageQuotas",
+		Summary:              "List storage quotas",
+		Description:          "Returns every user and group storage quota with what its subject currently stores. A group's usage covers its whole subtree; a file shared by several resources counts once.",
+		Tags:                 []string{"admin"},
+		ResponseType:         reflect.TypeOf([]application_context.StorageQuotaStatus{}),
+		ResponseContentTypes: []openapi.ContentType{openapi.ContentTypeJSON},
+	})
+
+	r.Register(openapi.RouteInfo{
+		Method:      http.MethodPost,
+		Path:        "/v1/admin/quotas",
+		OperationID: "setStorageQuota",
+		Summary:     "Set a storage quota",
+		Description: "Sets the byte and resource limits of a user, or of a group and its subgroups, replacing any quota it had. A zero limit is no limit. Uploads, remote downloads, version uploads, group imports and plugin-created resources that would exceed a quota are refused with 507. 400 for an unknown subject or a negative limit.",
+		Tags:        []string{"admin"},
+		ExtraQueryParams: []openapi.QueryParam{
+			{Name: "subjectType", Type: "string", Required: true, Description: "user or group"},
+			{Name: "subjectId", Type: "integer", Required: true, Description: "User or group ID"},
+			{Name: "maxBytes", Type: "integer", Description: "Byte limit (0: none)"},
+			{Name: "maxResources", Type: "integer", Description: "Resource count limit (0: none)"},
+		},
+		ResponseType:         reflect.TypeOf(application_context.StorageQuotaStatus{}),
+		ResponseContentTypes: []openapi.ContentType{openapi.ContentTypeJSON},
+	})
+
+	r.Register(openapi.RouteInfo{
+		Method:      http.MethodPost,
+		Path:        "/v1/admin/quotas/delete",
+		OperationID: "deleteStorageQuota",
+		Summary:     "Remove a storage quota",
+		Description: "Removes the quota of a user or a group. Its usage is still counted. 404 if it has no quota.",
+		Tags:        []string{"admin"},
+		ExtraQueryParams: []openapi.QueryParam{
+			{Name: "subjectType", Type: "string", Required: true, Description: "user or group"},
+			{Name: "subjectId", Type: "integer", Required: true, Description: "User or group ID"},
+		},
+		ResponseContentTypes: []openapi.ContentType{openapi.ContentTypeJSON},
+	})
+
+	r.Register(openapi.RouteInfo{
+		Method:               http.MethodPost,
+		Path:                 "/v1/admin/quotas/recount",
+		OperationID:          "recountStorageUsage",
+		Summary:              "Recount storage usage",
+		Description:          "Rebuilds every user's and group's storage usage from the resources, in one transaction. Usage is kept up to date as resources change; a recount is only needed after the database was edited by hand.",
+		Tags:                 []string{"admin"},
+		ResponseContentTypes: []openapi.ContentType{openapi.ContentTypeJSON},
+	})
+
+	r.Register(openapi.RouteInfo{
+		Method:               http.MethodGet,
+		Path:                 "/v1/admin/watch-folders",
+		OperationID:          "listWatchFolders",
+		Summary:              "List watch folders",
+		Description:          "Returns every watch folder with its mapping rules, how many files it has ingested, and the report of its last scan.",
+		Tags:                 []string{"admin"},
+		ResponseType:         reflect.TypeOf([]application_context.WatchFolderStatus{}),
+		ResponseContentTypes: []openapi.ContentType{openapi.ContentTypeJSON},
+	})
+
+	r.Register(openapi.RouteInfo{
+		Method:               http.MethodPost,
+		Path:                 "/v1/admin/watch-folders",
+		OperationID:          "setWatchFolder",
+		Summary:              "Create or update a watch folder",
+		Description:          "Watches a folder on an alt filesystem, or updates the watch folder with the given id. New files in it become resources of the owner group, changed files new versions, and a file moved within it moves its resource. With subfolders, each subfolder is mirrored as a group under the owner group. Each rule matches a glob against a file's path in the folder, or its name when the pattern has no slash; every matching rule adds its tags and the first with a group picks the file's group. onDelete is keep or delete. 400 for an unattached filesystem, a missing folder, group or tag, or a bad pattern; 404 for an unknown id.",
+		Tags:                 []string{"admin"},
+		RequestType:          reflect.TypeOf(query_models.WatchFolderEditor{}),
+		RequestContentTypes:  []openapi.ContentType{openapi.ContentTypeJSON},
+		ResponseType:         reflect.TypeOf(application_context.WatchFolderStatus{}),
+		ResponseContentTypes: []openapi.ContentType{openapi.ContentTypeJSON},
+	})
+
+	r.Register(openapi.RouteInfo{
+		Method:      http.MethodPost,
+		Path:        "/v1/admin/watch-folders/delete",
+		OperationID: "deleteWatchFolder",
+		Summary:     "Remove a watch folder",
+		Description: "Stops watching a folder. The resources it ingested stay. 404 for an unknown id.",
+		Tags:        []string{"admin"},
+		ExtraQueryParams: []openapi.QueryParam{
+			{Name: "id", Type: "integer", Required: true, Description: "Watch folder ID"},
+		},
+		ResponseContentTypes: []openapi.ContentType{openapi.ContentTypeJSON},
+	})
+
+	r.Register(openapi.RouteInfo{
+		Method:      http.MethodPost,
+		Path:        "/v1/admin/watch-folders/scan",
+		OperationID: "scanWatchFolder",
+		Summary:     "Scan a watch folder",
+		Description: "Submits a background job that scans a watch folder now, even a paused one; it appears in the jobs panel. 404 for an unknown id, 409 while the folder is being scanned.",
+		Tags:        []string{"admin"},
+		ExtraQueryParams: []openapi.QueryParam{
+			{Name: "id", Type: "integer", Required: true, Description: "Watch folder ID"},
+		},
+		ResponseType:         reflect.TypeOf(application_context.WatchScanStart{}),
+		ResponseContentTypes: []openapi.ContentType{openapi.ContentTypeJSON},
+	})
+
 	settingViewType := reflect.TypeOf(application_context.SettingView{})
 	settingViewListType := reflect.TypeOf([]application_context.SettingView{})
 
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"path/filepath"
@@ -13,6 +14,7 @@ import (
 	"mahresources/auth"
 	"mahresources/server/http_utils"
 	"mahresources/server/template_handlers"
+	"mahresources/storage"
 
 	"github.com/flosch/pongo2/v4"
 )
@@ -50,7 +52,8 @@ func BuildPrimaryRouter(appContext *application_context.MahresourcesContext, fs
 	// belonging to resources inside its subtree (no-op when auth is disabled).
 	router.PathPrefix(filePathPrefix).Handler(
 		guardedFileServer(appContext, filePathPrefix,
-			http.StripPrefix(filePathPrefix, http.FileServer(afero.NewHttpFs(fs).Dir("/")))))
+			quarantineGuard(appContext, filePathPrefix, nil,
+				http.StripPrefix(filePathPrefix, http.FileServer(afero.NewHttpFs(fs).Dir("/"))))))
 	// /public/ assets are served with a wildcard CORS header: the template
 	// live-preview pane loads the app bundle as a module script from a
 	// sandboxed (opaque-origin) iframe, and module fetches are CORS-gated.
@@ -59,16 +62,30 @@ func BuildPrimaryRouter(appContext *application_context.MahresourcesContext, fs
 	router.PathPrefix("/public/").Handler(corsStaticAssets(http.StripPrefix("/public/", mimeTypeHandler(http.FileServer(http.Dir("./public"))))))
 
 	for key, systemName := range altFs {
-		system := createCachedStorage(systemName)
+		system := createCachedStorage(systemName, appContext.Config.EncryptionKeys)
 		pathKey := fmt.Sprintf("/%v/", key)
 		router.PathPrefix(pathKey).Handler(
 			guardedFileServer(appContext, pathKey,
-				http.StripPrefix(pathKey, http.FileServer(afero.NewHttpFs(system).Dir("/")))))
+				quarantineGuard(appContext, pathKey, &key,
+					http.StripPrefix(pathKey, http.FileServer(afero.NewHttpFs(system).Dir("/"))))))
 	}
 
 	return router
 }
 
+// quarantineGuard refuses a file the blob scrubber quarantined, so a damaged
+// file is reported rather than served. storageLocation is the alt filesystem
+// key, nil for /files/.
+func quarantineGuard(appContext *application_context.MahresourcesContext, prefix string, storageLocation *string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if issue := appContext.QuarantinedBlob(storageLocation, strings.TrimPrefix(r.URL.Path, prefix)); issue != nil {
+			http_utils.HandleError(errors.New(application_context.QuarantineMessage(issue)), w, r, http.StatusConflict)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func CreateServer(appContext *application_context.MahresourcesContext, fs afero.Fs, altFs map[string]string) *http.Server {
 	router := BuildPrimaryRouter(appContext, fs, altFs)
 
@@ -126,10 +143,17 @@ func renderForbiddenPage(appContext *application_context.MahresourcesContext, w
 	template_handlers.RenderForbidden(w, r, message, pluginMenuEnricher(appContext, r))
 }
 
-func createCachedStorage(path string) afero.Fs {
+// createCachedStorage serves an alt filesystem through a short-lived memory
+// cache. S3 locations are served directly: caching would read whole objects
+// into memory where a ranged request only needs part of one. With encryption
+// on, the cache holds the stored ciphertext and files are decrypted as served.
+func createCachedStorage(path string, keys *storage.KeyRing) afero.Fs {
+	if storage.IsS3Location(path) {
+		return storage.Encrypt(storage.CreateStorage(path), keys)
+	}
 	base := afero.NewBasePathFs(afero.NewOsFs(), path)
 	layer := afero.NewMemMapFs()
-	return afero.NewCacheOnReadFs(base, layer, 10*time.Minute)
+	return storage.Encrypt(afero.NewCacheOnReadFs(base, layer, 10*time.Minute), keys)
 }
 
 // corsStaticAssets allows any origin to read the wrapped static responses.
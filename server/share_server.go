@@ -437,7 +437,7 @@ func (s *ShareServer) handleSharedResource(w http.ResponseWriter, r *http.Reques
 	// Check if resource is in note.Resources
 	resourceAllowed := false
 	for _, resource := range note.Resources {
-		if resource.Hash == hash {
+		if resource.HasContentHash(hash) {
 			resourceAllowed = true
 			break
 		}
@@ -470,7 +470,7 @@ func (s *ShareServer) handleSharedResource(w http.ResponseWriter, r *http.Reques
 			}
 			if resources, err := s.appContext.GetResourcesWithIds(&resourceIds); err == nil {
 				for _, resource := range resources {
-					if resource.Hash == hash {
+					if resource.HasContentHash(hash) {
 						resourceAllowed = true
 						break
 					}
@@ -30,13 +30,15 @@ type PartialResolverContext interface {
 }
 
 // QueryExecutorContext runs the inline [mrql] shortcode: scope resolution,
-// execution, the per-page query budget, and the logger the budget warning uses.
+// execution (live or materialized), the per-page query budget, and the logger
+// the budget warning uses.
 type QueryExecutorContext interface {
 	ResolveMRQLScope(q *mrql.Query) (uint, error)
 	ExecuteMRQLScoped(reqCtx context.Context, parsed *mrql.Query, scopeGroupID uint) (*application_context.MRQLResult, error)
 	ExecuteMRQLGroupedWithScope(reqCtx context.Context, parsed *mrql.Query, scopeID uint) (*application_context.MRQLGroupedResult, error)
 	CountMRQLScoped(reqCtx context.Context, parsed *mrql.Query, scopeGroupID uint) (int64, error)
 	GetSavedMRQLQueryByName(name string) (*models.SavedMRQLQuery, error)
+	MaterializedMRQLResult(reqCtx context.Context, saved *models.SavedMRQLQuery, limit int) (*application_context.MRQLResult, *application_context.MRQLGroupedResult, bool, error)
 	LoadMRQLRenderData(reqCtx context.Context, resourceCategoryIDs, noteTypeIDs, categoryIDs, scopeGroupIDs []uint) (*application_context.MRQLRenderData, error)
 	MRQLPageQueryBudget() int
 	Logger() *application_context.Logger
@@ -56,12 +58,14 @@ type budgetLogger interface {
 }
 
 // mrqlShortcodeRunner is the sliver executeMRQLForShortcode needs: scope
-// resolution plus the three execution shapes and saved-query lookup.
+// resolution plus the three execution shapes, saved-query lookup, and the
+// stored result of a materialized saved query.
 type mrqlShortcodeRunner interface {
 	ResolveMRQLScope(q *mrql.Query) (uint, error)
 	ExecuteMRQLScoped(reqCtx context.Context, parsed *mrql.Query, scopeGroupID uint) (*application_context.MRQLResult, error)
 	ExecuteMRQLGroupedWithScope(reqCtx context.Context, parsed *mrql.Query, scopeID uint) (*application_context.MRQLGroupedResult, error)
 	CountMRQLScoped(reqCtx context.Context, parsed *mrql.Query, scopeGroupID uint) (int64, error)
 	GetSavedMRQLQueryByName(name string) (*models.SavedMRQLQuery, error)
+	MaterializedMRQLResult(reqCtx context.Context, saved *models.SavedMRQLQuery, limit int) (*application_context.MRQLResult, *application_context.MRQLGroupedResult, bool, error)
 	LoadMRQLRenderData(reqCtx context.Context, resourceCategoryIDs, noteTypeIDs, categoryIDs, scopeGroupIDs []uint) (*application_context.MRQLRenderData, error)
 }
@@ -20,13 +20,65 @@ import (
 // result cache (free) and charges each cache miss against the budget. Once the
 // budget is spent it refuses further misses with a budget error — rendered as
 // the standard MRQL error box — and logs a single warning per page.
+//
+// A materialized saved query is served from its stored result ahead of the
+// budget: it runs no query, so it has nothing to charge.
 func BuildQueryExecutor(appCtx QueryExecutorContext) shortcodes.QueryExecutor {
 	base := func(reqCtx context.Context, query string, opts shortcodes.QueryOptions) (*shortcodes.QueryResult, error) {
 		return executeMRQLForShortcode(reqCtx, appCtx, query, opts)
 	}
-	return shortcodes.BudgetedExecutor(base, func(limit int) {
+	budgeted := shortcodes.BudgetedExecutor(base, func(limit int) {
 		logPageQueryBudgetExceeded(appCtx, limit)
 	})
+	return func(reqCtx context.Context, query string, opts shortcodes.QueryOptions) (*shortcodes.QueryResult, error) {
+		if qr, ok, err := materializedShortcodeResult(reqCtx, appCtx, query, opts); ok || err != nil {
+			return qr, err
+		}
+		return budgeted(reqCtx, query, opts)
+	}
+}
+
+// materializedShortcodeResult serves a [mrql saved="..."] shortcode from the
+// saved query's stored result. ok is false — execute normally — for anything
+// but a materialized saved query used as saved: params, a scope or a bucket
+// override change the query, and the stored result only answers the original.
+func materializedShortcodeResult(reqCtx context.Context, appCtx mrqlShortcodeRunner, query string, opts shortcodes.QueryOptions) (*shortcodes.QueryResult, bool, error) {
+	if opts.SavedName == "" || query != "" || len(opts.Params) > 0 || opts.ScopeGroupID != 0 || opts.Buckets > 0 {
+		return nil, false, nil
+	}
+	saved, err := appCtx.GetSavedMRQLQueryByName(opts.SavedName)
+	if err != nil || !saved.Materialized {
+		// A lookup failure is left to the normal path, which reports it.
+		return nil, false, nil
+	}
+	flat, grouped, ok, err := appCtx.MaterializedMRQLResult(reqCtx, saved, opts.Limit)
+	if err != nil || !ok {
+		return nil, ok, err
+	}
+
+	if grouped != nil {
+		qr, err := convertGroupedResultItems(reqCtx, grouped, appCtx)
+		if err != nil {
+			return nil, false, err
+		}
+		qr.EffectiveQuery = saved.Query
+		qr.SavedID = saved.ID
+		return qr, true, nil
+	}
+
+	qr := &shortcodes.QueryResult{
+		EntityType:     flat.EntityType,
+		Mode:           "flat",
+		EffectiveQuery: saved.Query,
+		SavedID:        saved.ID,
+	}
+	if qr.Items, err = convertResultItems(reqCtx, flat, appCtx); err != nil {
+		return nil, false, err
+	}
+	if opts.WantTotal && flat.Materialized != nil {
+		qr.Total = flat.Materialized.Total
+	}
+	return qr, true, nil
 }
 
 // pageQueryBudget returns the configured per-page inline-MRQL query budget,
@@ -105,8 +157,8 @@ func executeMRQLForShortcode(reqCtx context.Context, appCtx mrqlShortcodeRunner,
 	// carry: ?saved=<id> opens the query globally, so a scoped saved query must
 	// fall back to an inline ?q= link with the scope baked into the query text.
 	// Inline queries get the scope spliced at the grammatically correct position
-	// (SCOPE must precede GROUP BY / ORDER BY / LIMIT / OFFSET), which a naive
-	// append would break.
+	// (SCOPE must precede SELECT / GROUP BY / ORDER BY / LIMIT / OFFSET), which a
+	// naive append would break.
 	linkQuery := actualQuery
 	linkSavedID := savedID
 	if !explicitScope && scopeGroupID != 0 && scopeGroupID != mrql.UnresolvedScopeSentinel {
@@ -114,11 +166,11 @@ func executeMRQLForShortcode(reqCtx context.Context, appCtx mrqlShortcodeRunner,
 		linkSavedID = 0
 	}
 
-	// GROUP BY queries use the grouped execution path
-	if parsed.GroupBy != nil {
+	// GROUP BY and SELECT queries use the grouped execution path
+	if parsed.IsGrouped() {
 		entityType := mrql.ExtractEntityType(parsed)
 		if entityType == mrql.EntityUnspecified {
-			return nil, fmt.Errorf("GROUP BY requires an explicit entity type")
+			return nil, fmt.Errorf("GROUP BY and SELECT require an explicit entity type")
 		}
 		parsed.EntityType = entityType
 
@@ -310,14 +362,38 @@ func convertResultItemsWithData(reqCtx context.Context, result *application_cont
 		}
 		items = append(items, item)
 	}
-	return items, nil
+	return orderCrossEntityItems(items, result.Items), nil
+}
+
+// orderCrossEntityItems restores a cross-entity result's global order, which
+// the per-type slices above lose by appending resources, notes, then groups.
+// Single-entity results carry no order list and are returned unchanged.
+func orderCrossEntityItems(items []shortcodes.QueryResultItem, order []application_context.MRQLItem) []shortcodes.QueryResultItem {
+	if len(order) == 0 {
+		return items
+	}
+	type itemKey struct {
+		entityType string
+		id         uint
+	}
+	byKey := make(map[itemKey]shortcodes.QueryResultItem, len(items))
+	for _, item := range items {
+		byKey[itemKey{item.EntityType, item.EntityID}] = item
+	}
+	ordered := make([]shortcodes.QueryResultItem, 0, len(items))
+	for _, entry := range order {
+		if item, ok := byKey[itemKey{entry.EntityType, entry.ID}]; ok {
+			ordered = append(ordered, item)
+		}
+	}
+	return ordered
 }
 
 // convertGroupedResultItems converts MRQLGroupedResult into QueryResult.
 func convertGroupedResultItems(reqCtx context.Context, result *application_context.MRQLGroupedResult, appCtx mrqlShortcodeRunner) (*shortcodes.QueryResult, error) {
 	qr := &shortcodes.QueryResult{EntityType: result.EntityType}
-	if result.Mode == "aggregated" {
-		qr.Mode, qr.Rows = "aggregated", result.Rows
+	if result.Mode == "aggregated" || result.Mode == "projected" {
+		qr.Mode, qr.Columns, qr.Rows = result.Mode, result.Columns, result.Rows
 		return qr, nil
 	}
 
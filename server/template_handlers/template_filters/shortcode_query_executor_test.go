@@ -28,7 +28,7 @@ func setupExecutorTestContext(t *testing.T) (*application_context.MahresourcesCo
 		&models.Group{}, &models.Category{}, &models.NoteType{}, &models.Preview{},
 		&models.GroupRelation{}, &models.GroupRelationType{}, &models.ImageHash{},
 		&models.ResourceSimilarity{}, &models.LogEntry{}, &models.NoteBlock{},
-		&models.SavedMRQLQuery{},
+		&models.SavedMRQLQuery{}, &models.MRQLMaterialization{},
 	); err != nil {
 		t.Fatalf("migrate: %v", err)
 	}
@@ -111,3 +111,37 @@ func TestExecutorUnscopedSavedQueryKeepsSavedID(t *testing.T) {
 		t.Fatalf("unscoped saved query should keep SavedID %d, got %d", saved.ID, res.SavedID)
 	}
 }
+
+// A materialized saved query is answered from its stored result and charges
+// nothing against the page budget, even once the budget is spent.
+func TestExecutorMaterializedSavedQueryBypassesBudget(t *testing.T) {
+	ctx, db := setupExecutorTestContext(t)
+	if err := db.Create(&models.Resource{Name: "mat-res"}).Error; err != nil {
+		t.Fatalf("seed resource: %v", err)
+	}
+	saved, err := ctx.CreateSavedMRQLQuery("mat", `type = "resource"`, "")
+	if err != nil {
+		t.Fatalf("create saved: %v", err)
+	}
+	if _, err := ctx.SetSavedMRQLQueryMaterialization(saved.ID, application_context.MRQLMaterializationSettings{Materialized: true}); err != nil {
+		t.Fatalf("materialize: %v", err)
+	}
+	exec := BuildQueryExecutor(ctx)
+	reqCtx := shortcodes.WithQueryBudget(context.Background(), 1)
+
+	if _, err := exec(reqCtx, `type = "note"`, shortcodes.QueryOptions{}); err != nil {
+		t.Fatalf("spend budget: %v", err)
+	}
+	for _, limit := range []int{0, 1} {
+		res, err := exec(reqCtx, "", shortcodes.QueryOptions{SavedName: "mat", Limit: limit})
+		if err != nil {
+			t.Fatalf("materialized exec (limit %d): %v", limit, err)
+		}
+		if len(res.Items) != 1 || res.SavedID != saved.ID {
+			t.Fatalf("limit %d: expected the stored resource under saved ID %d, got %d items, ID %d", limit, saved.ID, len(res.Items), res.SavedID)
+		}
+	}
+	if stats := shortcodes.QueryBudgetFrom(reqCtx).Stats(); stats.Exceeded {
+		t.Fatalf("materialized queries were charged against the budget: %+v", stats)
+	}
+}
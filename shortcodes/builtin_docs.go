@@ -96,7 +96,7 @@ func BuiltinDocs() []BuiltinDoc {
 			Attrs: []DocAttr{
 				{Name: "query", Type: "string", Required: false, Description: "Inline MRQL expression. Required unless saved is set."},
 				{Name: "saved", Type: "string", Required: false, Description: "Name of a saved MRQL query. Required unless query is set."},
-				{Name: "value", Type: "string", Required: false, Description: "Inline scalar mode: renders a single escaped value with no wrapper. Use \"count\" for the result count (returned rows, capped by limit) or a column name from an aggregated result. Conflicts with a block body."},
+				{Name: "value", Type: "string", Required: false, Description: "Inline scalar mode: renders a single escaped value with no wrapper. Use \"count\" for the result count (returned rows, capped by limit) or a column name from an aggregated or SELECT result. Conflicts with a block body."},
 				{Name: "format", Type: "enum", Default: "auto", Description: "Result layout, or (with value=) the scalar's format like [property]: date/datetime/time/filesize. Auto-resolves to custom templates when available.", Enum: []string{"table", "list", "compact", "custom"}},
 				{Name: "layout", Type: "string", Required: false, Description: "Custom Go time layout for a value= time scalar (e.g. Jan 2, 2006). Wins over format."},
 				{Name: "limit", Type: "number", Default: "20", Description: "Maximum number of results."},
@@ -134,7 +134,7 @@ func BuiltinDocs() []BuiltinDoc {
 				{Name: "empty", Type: "boolean", Required: false, Description: `Condition: value is empty or missing. Write empty="true".`, Enum: []string{"true"}},
 				{Name: "not-empty", Type: "boolean", Required: false, Description: `Condition: value is present and non-empty. Write not-empty="true".`, Enum: []string{"true"}},
 				{Name: "combine", Type: "enum", Default: "all", Description: "How to fold multiple operators and numbered-suffix conditions: all (AND) or any (OR).", Enum: []string{"all", "any"}},
-				{Name: "aggregate", Type: "string", Required: false, Description: "Column name to read from an aggregated MRQL result."},
+				{Name: "aggregate", Type: "string", Required: false, Description: "Column name to read from an aggregated or SELECT MRQL result."},
 				{Name: "scope", Type: "enum", Default: "entity", Description: "Group subtree for the mrql condition.", Enum: []string{"entity", "parent", "root", "global"}},
 				{Name: "limit", Type: "number", Default: "20", Description: "Result limit for the mrql condition."},
 				{Name: "buckets", Type: "number", Default: "5", Description: "Bucket count for a grouped mrql condition."},
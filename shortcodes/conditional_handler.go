@@ -58,13 +58,14 @@ func resolveConditionalValue(reqCtx context.Context, attrs map[string]string, su
 		if result == nil {
 			return nil, nil
 		}
-		// Aggregated results need an explicit column to test; other modes fold to
-		// a count. extractScalarFromResult is the shared value-extraction helper
-		// (also used by inline [mrql value=]), so the two can never drift apart.
-		if result.Mode == "aggregated" {
+		// Aggregated and projected results need an explicit column to test;
+		// other modes fold to a count. extractScalarFromResult is the shared
+		// value-extraction helper (also used by inline [mrql value=]), so the two
+		// can never drift apart.
+		if result.Mode == "aggregated" || result.Mode == "projected" {
 			agg := attr("aggregate")
 			if agg == "" {
-				return nil, fmt.Errorf("mrql aggregated results require aggregate=\"column_name\" attribute")
+				return nil, fmt.Errorf("mrql aggregated and projected results require aggregate=\"column_name\" attribute")
 			}
 			return extractScalarFromResult(result, agg), nil
 		}
@@ -51,20 +51,20 @@ func mrqlErrorHTML(err error, inline bool) string {
 // extractScalarFromResult draws a single scalar value from a query result.
 //
 //	key "count" (or "")  → item count (flat), group count (bucketed), row count
-//	                       (aggregated).
-//	key "<column>"       → Rows[0][column] for aggregated results; nil for other
-//	                       modes (a column has no meaning outside aggregation).
+//	                       (aggregated or projected).
+//	key "<column>"       → Rows[0][column] for aggregated or projected results;
+//	                       nil for other modes (they have no columns).
 //
 // It is the shared value-extraction logic behind [conditional]'s mrql source and
 // inline [mrql value=], so their semantics stay identical. Returns nil for a nil
-// result or an empty aggregated set.
+// result or an empty aggregated or projected set.
 func extractScalarFromResult(result *QueryResult, key string) any {
 	if result == nil {
 		return nil
 	}
 	if key == "" || key == "count" {
 		switch result.Mode {
-		case "aggregated":
+		case "aggregated", "projected":
 			return float64(len(result.Rows))
 		case "bucketed":
 			return float64(len(result.Groups))
@@ -72,7 +72,7 @@ func extractScalarFromResult(result *QueryResult, key string) any {
 			return float64(len(result.Items))
 		}
 	}
-	if result.Mode == "aggregated" {
+	if result.Mode == "aggregated" || result.Mode == "projected" {
 		if len(result.Rows) == 0 {
 			return nil
 		}
@@ -154,8 +154,8 @@ func RenderMRQLShortcode(reqCtx context.Context, sc Shortcode, ctx MetaShortcode
 	var inner string
 
 	switch result.Mode {
-	case "aggregated":
-		inner = renderAggregatedTable(result.Rows)
+	case "aggregated", "projected":
+		inner = renderAggregatedTable(result.Columns, result.Rows)
 	case "bucketed":
 		inner = renderBucketed(reqCtx, result.Groups, format, ctx, renderer, executor, depth)
 	default: // "flat" or empty
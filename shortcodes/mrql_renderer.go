@@ -114,16 +114,20 @@ func renderFlatCompact(items []QueryResultItem) string {
 	return strings.Join(parts, ", ")
 }
 
-// renderAggregatedTable renders aggregated GROUP BY rows as an HTML table.
-func renderAggregatedTable(rows []map[string]any) string {
+// renderAggregatedTable renders aggregated GROUP BY or SELECT rows as an HTML
+// table, with columns in the given order when there is one.
+func renderAggregatedTable(columns []string, rows []map[string]any) string {
 	if len(rows) == 0 {
 		return `<p class="text-sm text-stone-500 font-mono py-2 text-center">No results.</p>`
 	}
 
-	// Collect column keys from the first row
-	keys := make([]string, 0, len(rows[0]))
-	for k := range rows[0] {
-		keys = append(keys, k)
+	// Without a column order, collect column keys from the first row
+	keys := columns
+	if len(keys) == 0 {
+		keys = make([]string, 0, len(rows[0]))
+		for k := range rows[0] {
+			keys = append(keys, k)
+		}
 	}
 
 	var b strings.Builder
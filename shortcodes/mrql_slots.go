@@ -95,7 +95,7 @@ func (s mrqlSlots) mentionsTotal() bool {
 // resultIsEmpty reports whether a query result carries no rows, per its mode.
 func resultIsEmpty(result *QueryResult) bool {
 	switch result.Mode {
-	case "aggregated":
+	case "aggregated", "projected":
 		return len(result.Rows) == 0
 	case "bucketed":
 		return len(result.Groups) == 0
@@ -105,11 +105,11 @@ func resultIsEmpty(result *QueryResult) bool {
 }
 
 // resultCount returns the number of rendered rows: items (flat), buckets
-// (bucketed), or aggregate rows (aggregated). This is the {count} placeholder
+// (bucketed), or table rows (aggregated or projected). This is the {count} placeholder
 // value and, when no true total was computed, the {total} fallback.
 func resultCount(result *QueryResult) int {
 	switch result.Mode {
-	case "aggregated":
+	case "aggregated", "projected":
 		return len(result.Rows)
 	case "bucketed":
 		return len(result.Groups)
@@ -42,8 +42,10 @@ type QueryResult struct {
 	EntityType string
 	Mode       string
 	Items      []QueryResultItem
-	Rows       []map[string]any
-	Groups     []QueryResultGroup
+	// Columns orders Rows' keys for an aggregated or projected result.
+	Columns []string
+	Rows    []map[string]any
+	Groups  []QueryResultGroup
 
 	// EffectiveQuery is the MRQL text actually executed (resolved from a saved
 	// query when SavedName was used). Empty for a bare/failed execution.
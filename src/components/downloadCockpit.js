@@ -752,6 +752,17 @@ export function downloadCockpit() {
             if (job.source === 'group-export') {
                 return job.name || 'Group export';
             }
+            if (job.source === 'mrql-mutation') {
+                return 'MRQL mutation';
+            }
+            // Archive expansions carry the archive's name in url.
+            if (job.source === 'archive-expand') {
+                return `Expand ${job.url || 'archive'}`;
+            }
+            // Watch folder scans carry the folder's name in url.
+            if (job.source === 'watch-scan') {
+                return `Scan watch folder ${job.url || ''}`.trim();
+            }
             return this.getFilename(job.url) || job.name || 'Download';
         },
 
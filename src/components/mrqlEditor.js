@@ -90,7 +90,7 @@ export function mrqlEditor() {
 
     get totalCount() {
       if (!this.result) return 0;
-      if (this.result.mode === 'aggregated') return this.result.rows?.length || 0;
+      if (this.result.mode === 'aggregated' || this.result.mode === 'projected') return this.result.rows?.length || 0;
       if (this.result.mode === 'bucketed') {
         return (this.result.groups || []).reduce((sum, g) => sum + (g.items?.length || 0), 0);
       }
@@ -104,7 +104,7 @@ export function mrqlEditor() {
     get resultCountLabel() {
       if (!this.result) return '';
       const n = this.totalCount;
-      if (this.result.mode === 'aggregated') return `(${n} ${n === 1 ? 'row' : 'rows'})`;
+      if (this.result.mode === 'aggregated' || this.result.mode === 'projected') return `(${n} ${n === 1 ? 'row' : 'rows'})`;
       if (this.result.mode === 'bucketed') {
         const g = this.result.groups?.length || 0;
         return `(${g} ${g === 1 ? 'group' : 'groups'}, ${n} ${n === 1 ? 'item' : 'items'})`;
@@ -2,10 +2,31 @@ package storage
 
 import "github.com/spf13/afero"
 
+// CreateStorage opens a storage location: a local directory, or an
+// s3://bucket/prefix location (see ParseS3Location). A location that does not
+// parse gives a filesystem whose every operation fails with the parse error;
+// main.go refuses to start on one, see ValidateLocation.
 func CreateStorage(path string) afero.Fs {
+	if IsS3Location(path) {
+		cfg, err := ParseS3Location(path)
+		if err != nil {
+			return &S3Fs{err: err}
+		}
+		return NewS3Fs(cfg)
+	}
 	return afero.NewBasePathFs(afero.NewOsFs(), path)
 }
 
+// ValidateLocation reports why CreateStorage could not use a location.
+// Local directories are not checked here: they are created on first write.
+func ValidateLocation(path string) error {
+	if IsS3Location(path) {
+		_, err := ParseS3Location(path)
+		return err
+	}
+	return nil
+}
+
 // CreateMemoryStorage creates an in-memory filesystem for ephemeral usage.
 // Data is not persisted and will be lost when the application exits.
 func CreateMemoryStorage() afero.Fs {
@@ -0,0 +1,672 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// An encrypted file is a header followed by the content in chunks of
+// encryptedChunkSize bytes, each sealed with AES-256-GCM under a key of its
+// own. The header holds that file key, wrapped with a master key:
+//
+//	magic (8) | master KeyID (8) | wrap nonce (12) | wrapped file key (32+16)
+//
+// A chunk's nonce is its index, so chunks cannot be reordered, and the last
+// one is sealed as such, so a file cut at a chunk boundary does not pass for
+// a shorter one. Every chunk has the same sealed size but the last, which
+// makes the content size and the position of any byte computable from the
+// stored size: reads can seek, and a Range request decrypts only the chunks
+// it covers.
+const (
+	encryptedChunkSize   = 64 << 10
+	encryptedTagSize     = 16
+	encryptedSealedChunk = encryptedChunkSize + encryptedTagSize
+	encryptedNonceSize   = 12
+	encryptedHeaderSize  = len(encryptedMagic) + len(KeyID{}) + encryptedNonceSize + MasterKeySize + encryptedTagSize
+)
+
+const encryptedMagic = "MRENC01\n"
+
+// ErrEncryptedFileCorrupt is returned when an encrypted file fails to
+// authenticate: it was damaged or altered after it was written.
+var ErrEncryptedFileCorrupt = errors.New("encrypted file is damaged or was altered")
+
+// ErrUnknownMasterKey is returned for a file wrapped with a master key that is
+// not in the key ring.
+var ErrUnknownMasterKey = errors.New("file is encrypted with a master key that is not configured")
+
+// errEncryptedUnsupported is returned for the writes an encrypted file cannot
+// take: like an S3 object, it is only ever written whole.
+var errEncryptedUnsupported = errors.New("not supported on encrypted storage")
+
+// EncryptedFs encrypts the files written through it and decrypts the ones
+// read, so that the underlying storage only ever holds ciphertext. Files
+// stored before encryption was enabled have no header and are read as they
+// are; Rewrap encrypts them.
+//
+// Directories, renames and removals pass through. Directory listings report
+// stored sizes, which for an encrypted file include its header and tags; Stat
+// and an opened file's Stat report the content size.
+type EncryptedFs struct {
+	base afero.Fs
+	keys *KeyRing
+}
+
+// NewEncryptedFs wraps base, writing with the ring's current master key.
+func NewEncryptedFs(base afero.Fs, keys *KeyRing) *EncryptedFs {
+	return &EncryptedFs{base: base, keys: keys}
+}
+
+// Encrypt wraps fs in an EncryptedFs, or returns it as it is when keys is nil
+// and encryption is off.
+func Encrypt(fs afero.Fs, keys *KeyRing) afero.Fs {
+	if keys == nil {
+		return fs
+	}
+	return NewEncryptedFs(fs, keys)
+}
+
+// Keys returns the key ring the filesystem encrypts with.
+func (fs *EncryptedFs) Keys() *KeyRing { return fs.keys }
+
+func (fs *EncryptedFs) Name() string { return "EncryptedFs" }
+
+// newFileKey generates a file key and the header that wraps it with the
+// current master key.
+func (fs *EncryptedFs) newFileKey() (cipher.AEAD, []byte, error) {
+	fileKey := make([]byte, MasterKeySize)
+	if _, err := rand.Read(fileKey); err != nil {
+		return nil, nil, err
+	}
+	header, err := fs.wrapFileKey(fileKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := newFileAEAD(fileKey)
+	return aead, header, err
+}
+
+// wrapFileKey returns the header for fileKey under the current master key.
+func (fs *EncryptedFs) wrapFileKey(fileKey []byte) ([]byte, error) {
+	master := fs.keys.current
+	header := make([]byte, 0, encryptedHeaderSize)
+	header = append(header, encryptedMagic...)
+	header = append(header, master.id[:]...)
+	nonce := make([]byte, encryptedNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	header = append(header, nonce...)
+	return master.aead.Seal(header, nonce, fileKey, []byte(encryptedMagic)), nil
+}
+
+// unwrapFileKey returns the file key a header wraps and the master key's ID.
+func (fs *EncryptedFs) unwrapFileKey(header []byte) ([]byte, KeyID, error) {
+	var id KeyID
+	rest := header[len(encryptedMagic):]
+	copy(id[:], rest)
+	master, ok := fs.keys.keys[id]
+	if !ok {
+		return nil, id, ErrUnknownMasterKey
+	}
+	rest = rest[len(id):]
+	fileKey, err := master.aead.Open(nil, rest[:encryptedNonceSize], rest[encryptedNonceSize:], []byte(encryptedMagic))
+	if err != nil {
+		return nil, id, ErrEncryptedFileCorrupt
+	}
+	return fileKey, id, nil
+}
+
+func newFileAEAD(fileKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(fileKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// readHeader returns the header of an encrypted file, or nil for a file
+// stored in the clear.
+func readHeader(f io.ReaderAt, storedSize int64) ([]byte, error) {
+	if _, ok := plaintextSize(storedSize); !ok {
+		return nil, nil
+	}
+	header := make([]byte, encryptedHeaderSize)
+	if _, err := f.ReadAt(header, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if string(header[:len(encryptedMagic)]) != encryptedMagic {
+		return nil, nil
+	}
+	return header, nil
+}
+
+// plaintextSize returns the content size of an encrypted file stored in
+// storedSize bytes, and false when no encrypted file has that size.
+func plaintextSize(storedSize int64) (int64, bool) {
+	body := storedSize - int64(encryptedHeaderSize)
+	if body < encryptedTagSize {
+		return 0, false
+	}
+	full, rest := body/encryptedSealedChunk, body%encryptedSealedChunk
+	switch {
+	case rest == 0:
+		return full * encryptedChunkSize, true
+	case rest < encryptedTagSize:
+		return 0, false
+	}
+	return full*encryptedChunkSize + rest - encryptedTagSize, true
+}
+
+// chunkNonce is the nonce of chunk i; file keys are never reused, so the
+// index alone is unique.
+func chunkNonce(i int64) []byte {
+	nonce := make([]byte, encryptedNonceSize)
+	binary.BigEndian.PutUint64(nonce[encryptedNonceSize-8:], uint64(i))
+	return nonce
+}
+
+// chunkAAD marks the last chunk of a file.
+func chunkAAD(last bool) []byte {
+	if last {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+func (fs *EncryptedFs) Stat(name string) (os.FileInfo, error) {
+	info, err := fs.base.Stat(name)
+	if err != nil || info.IsDir() {
+		return info, err
+	}
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Stat()
+}
+
+func (fs *EncryptedFs) Open(name string) (afero.File, error) {
+	f, err := fs.base.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		return f, nil
+	}
+	header, err := readHeader(f, info.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if header == nil {
+		return f, nil
+	}
+	fileKey, _, err := fs.unwrapFileKey(header)
+	if err != nil {
+		f.Close()
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	aead, err := newFileAEAD(fileKey)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	size, _ := plaintextSize(info.Size())
+	return &encryptedFile{
+		base:   f,
+		name:   name,
+		aead:   aead,
+		info:   info,
+		size:   size,
+		chunks: (info.Size() - int64(encryptedHeaderSize) + encryptedSealedChunk - 1) / encryptedSealedChunk,
+		bufAt:  -1,
+		baseAt: -1,
+	}, nil
+}
+
+func (fs *EncryptedFs) Create(name string) (afero.File, error) {
+	return fs.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+// OpenFile opens for reading, or for writing a whole new file: a write open
+// that would read or append is refused.
+func (fs *EncryptedFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) == 0 {
+		return fs.Open(name)
+	}
+	if flag&os.O_APPEND != 0 || (flag&os.O_RDWR != 0 && flag&os.O_TRUNC == 0) {
+		return nil, &os.PathError{Op: "open", Path: name, Err: errEncryptedUnsupported}
+	}
+	if flag&os.O_TRUNC == 0 && flag&os.O_EXCL == 0 {
+		// Overwriting in place would leave the old file's chunks after the
+		// new ones; start from empty instead.
+		flag |= os.O_TRUNC
+	}
+	aead, header, err := fs.newFileKey()
+	if err != nil {
+		return nil, err
+	}
+	f, err := fs.base.OpenFile(name, flag&^os.O_RDWR|os.O_WRONLY, perm)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(header); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &encryptedFile{base: f, name: name, aead: aead, writing: true}, nil
+}
+
+func (fs *EncryptedFs) Mkdir(name string, perm os.FileMode) error {
+	return fs.base.Mkdir(name, perm)
+}
+
+func (fs *EncryptedFs) MkdirAll(path string, perm os.FileMode) error {
+	return fs.base.MkdirAll(path, perm)
+}
+
+func (fs *EncryptedFs) Remove(name string) error { return fs.base.Remove(name) }
+
+func (fs *EncryptedFs) RemoveAll(path string) error { return fs.base.RemoveAll(path) }
+
+func (fs *EncryptedFs) Rename(oldname, newname string) error {
+	return fs.base.Rename(oldname, newname)
+}
+
+func (fs *EncryptedFs) Chmod(name string, mode os.FileMode) error {
+	return fs.base.Chmod(name, mode)
+}
+
+func (fs *EncryptedFs) Chown(name string, uid, gid int) error {
+	return fs.base.Chown(name, uid, gid)
+}
+
+func (fs *EncryptedFs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return fs.base.Chtimes(name, atime, mtime)
+}
+
+// RewrapOutcome is what Rewrap did to a file.
+type RewrapOutcome int
+
+const (
+	// RewrapCurrent: the file was already wrapped with the current key.
+	RewrapCurrent RewrapOutcome = iota
+	// RewrapRewrapped: the file key was re-wrapped with the current key.
+	RewrapRewrapped
+	// RewrapEncrypted: the file was stored in the clear and is now encrypted.
+	RewrapEncrypted
+)
+
+// rewrapTemp names the file Rewrap writes before renaming it over name. It
+// is hidden, which no content-addressed file is, so blob garbage collection
+// sweeps up one an interrupted Rewrap left behind and RewrapAll skips it.
+func rewrapTemp(name string) string {
+	return path.Join(path.Dir(name), rewrapTempPrefix+path.Base(name))
+}
+
+const rewrapTempPrefix = ".rewrap-"
+
+// Rewrap brings a file onto the current master key. A file wrapped with a
+// previous key gets a new header and keeps its ciphertext, so only the
+// header is decrypted; a file stored in the clear is encrypted. The new file
+// is written next to the old one and renamed over it.
+func (fs *EncryptedFs) Rewrap(name string) (RewrapOutcome, error) {
+	f, err := fs.base.Open(name)
+	if err != nil {
+		return RewrapCurrent, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return RewrapCurrent, err
+	}
+	header, err := readHeader(f, info.Size())
+	if err != nil {
+		return RewrapCurrent, err
+	}
+
+	outcome := RewrapEncrypted
+	var out afero.File
+	if header != nil {
+		fileKey, id, err := fs.unwrapFileKey(header)
+		if err != nil {
+			return RewrapCurrent, &os.PathError{Op: "rewrap", Path: name, Err: err}
+		}
+		if id == fs.keys.current.id {
+			return RewrapCurrent, nil
+		}
+		if header, err = fs.wrapFileKey(fileKey); err != nil {
+			return RewrapCurrent, err
+		}
+		outcome = RewrapRewrapped
+		if out, err = fs.base.Create(rewrapTemp(name)); err != nil {
+			return RewrapCurrent, err
+		}
+		if _, err = out.Write(header); err == nil {
+			_, err = io.Copy(out, io.NewSectionReader(f, int64(encryptedHeaderSize), info.Size()-int64(encryptedHeaderSize)))
+		}
+		err = errors.Join(err, out.Close())
+		if err != nil {
+			fs.base.Remove(rewrapTemp(name))
+			return RewrapCurrent, err
+		}
+	} else {
+		if out, err = fs.Create(rewrapTemp(name)); err != nil {
+			return RewrapCurrent, err
+		}
+		_, err = io.Copy(out, f)
+		err = errors.Join(err, out.Close())
+		if err != nil {
+			fs.base.Remove(rewrapTemp(name))
+			return RewrapCurrent, err
+		}
+	}
+
+	if err := fs.base.Rename(rewrapTemp(name), name); err != nil {
+		fs.base.Remove(rewrapTemp(name))
+		return RewrapCurrent, err
+	}
+	return outcome, nil
+}
+
+// RewrapAll calls Rewrap on every file under root and passes the outcome to
+// visit; an error visit returns stops the walk. A walk error is passed to
+// visit too. Temporary files an interrupted Rewrap left behind are skipped.
+func (fs *EncryptedFs) RewrapAll(root string, visit func(name string, outcome RewrapOutcome, err error) error) error {
+	return afero.Walk(fs.base, root, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return visit(name, RewrapCurrent, err)
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if strings.HasPrefix(path.Base(name), rewrapTempPrefix) {
+			return nil
+		}
+		outcome, err := fs.Rewrap(name)
+		return visit(name, outcome, err)
+	})
+}
+
+// encryptedFile is an encrypted file opened for reading, or one being
+// written.
+type encryptedFile struct {
+	base   afero.File
+	name   string
+	aead   cipher.AEAD
+	closed bool
+
+	// Reading: info is the stored file's, size the content's. buf holds the
+	// decrypted chunk bufAt; baseAt is where base's offset is, -1 if unknown.
+	info   os.FileInfo
+	size   int64
+	chunks int64
+	offset int64
+	buf    []byte
+	bufAt  int64
+	sealed []byte
+	baseAt int64
+
+	// Writing: pending holds the content not yet sealed. A full chunk stays
+	// pending until more content or Close shows whether it is the last.
+	writing bool
+	pending []byte
+	chunk   int64
+	written int64
+	err     error
+}
+
+func (f *encryptedFile) Name() string { return f.name }
+
+func (f *encryptedFile) Stat() (os.FileInfo, error) {
+	if f.writing {
+		info, err := f.base.Stat()
+		if err != nil {
+			return nil, err
+		}
+		return encryptedFileInfo{info, f.written}, nil
+	}
+	return encryptedFileInfo{f.info, f.size}, nil
+}
+
+// encryptedFileInfo reports an encrypted file's content size.
+type encryptedFileInfo struct {
+	os.FileInfo
+	size int64
+}
+
+func (i encryptedFileInfo) Size() int64 { return i.size }
+
+func (f *encryptedFile) readable(op string) error {
+	switch {
+	case f.closed:
+		return afero.ErrFileClosed
+	case f.writing:
+		return &os.PathError{Op: op, Path: f.name, Err: os.ErrInvalid}
+	}
+	return nil
+}
+
+// sealedSpan returns where chunk i is stored and its sealed length.
+func (f *encryptedFile) sealedSpan(i int64) (int64, int) {
+	at := int64(encryptedHeaderSize) + i*encryptedSealedChunk
+	return at, int(min(encryptedSealedChunk, f.info.Size()-at))
+}
+
+// open decrypts chunk i into dst.
+func (f *encryptedFile) open(dst, sealed []byte, i int64) ([]byte, error) {
+	plain, err := f.aead.Open(dst, chunkNonce(i), sealed, chunkAAD(i == f.chunks-1))
+	if err != nil {
+		return nil, &os.PathError{Op: "read", Path: f.name, Err: ErrEncryptedFileCorrupt}
+	}
+	return plain, nil
+}
+
+// load makes chunk i the buffered one. Consecutive chunks are read from
+// base's stream, so sequential reads of S3 objects are one request.
+func (f *encryptedFile) load(i int64) error {
+	if f.bufAt == i {
+		return nil
+	}
+	at, n := f.sealedSpan(i)
+	if f.baseAt != at {
+		if _, err := f.base.Seek(at, io.SeekStart); err != nil {
+			f.baseAt = -1
+			return err
+		}
+	}
+	if f.sealed == nil {
+		f.sealed = make([]byte, encryptedSealedChunk)
+		f.buf = make([]byte, 0, encryptedChunkSize)
+	}
+	if _, err := io.ReadFull(f.base, f.sealed[:n]); err != nil {
+		f.baseAt, f.bufAt = -1, -1
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return &os.PathError{Op: "read", Path: f.name, Err: err}
+	}
+	f.baseAt = at + int64(n)
+	plain, err := f.open(f.buf[:0], f.sealed[:n], i)
+	if err != nil {
+		f.bufAt = -1
+		return err
+	}
+	f.buf, f.bufAt = plain, i
+	return nil
+}
+
+func (f *encryptedFile) Read(p []byte) (int, error) {
+	if err := f.readable("read"); err != nil {
+		return 0, err
+	}
+	if f.offset >= f.size {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	i := f.offset / encryptedChunkSize
+	if err := f.load(i); err != nil {
+		return 0, err
+	}
+	n := copy(p, f.buf[f.offset-i*encryptedChunkSize:])
+	f.offset += int64(n)
+	return n, nil
+}
+
+// ReadAt decrypts the chunks p covers without touching the file's offset or
+// buffer, as io.ReaderAt allows concurrent calls.
+func (f *encryptedFile) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.readable("readat"); err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, &os.PathError{Op: "readat", Path: f.name, Err: os.ErrInvalid}
+	}
+	var sealed, plain []byte
+	n := 0
+	for n < len(p) && off < f.size {
+		i := off / encryptedChunkSize
+		at, length := f.sealedSpan(i)
+		if sealed == nil {
+			sealed, plain = make([]byte, encryptedSealedChunk), make([]byte, 0, encryptedChunkSize)
+		}
+		if _, err := f.base.ReadAt(sealed[:length], at); err != nil && err != io.EOF {
+			return n, err
+		}
+		chunk, err := f.open(plain[:0], sealed[:length], i)
+		if err != nil {
+			return n, err
+		}
+		copied := copy(p[n:], chunk[off-i*encryptedChunkSize:])
+		n += copied
+		off += int64(copied)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *encryptedFile) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, afero.ErrFileClosed
+	}
+	if f.writing {
+		if offset == 0 && whence == io.SeekCurrent {
+			return f.written, nil
+		}
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: errEncryptedUnsupported}
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.size
+	}
+	if offset < 0 {
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: os.ErrInvalid}
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *encryptedFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, &os.PathError{Op: "readdir", Path: f.name, Err: os.ErrInvalid}
+}
+
+func (f *encryptedFile) Readdirnames(n int) ([]string, error) {
+	return nil, &os.PathError{Op: "readdirnames", Path: f.name, Err: os.ErrInvalid}
+}
+
+// seal writes chunk as the next one.
+func (f *encryptedFile) seal(chunk []byte, last bool) error {
+	sealed := f.aead.Seal(nil, chunkNonce(f.chunk), chunk, chunkAAD(last))
+	if _, err := f.base.Write(sealed); err != nil {
+		return err
+	}
+	f.chunk++
+	return nil
+}
+
+func (f *encryptedFile) Write(p []byte) (int, error) {
+	switch {
+	case f.closed:
+		return 0, afero.ErrFileClosed
+	case !f.writing:
+		return 0, &os.PathError{Op: "write", Path: f.name, Err: os.ErrInvalid}
+	case f.err != nil:
+		return 0, f.err
+	}
+	if f.pending == nil {
+		f.pending = make([]byte, 0, encryptedChunkSize)
+	}
+	for rest := p; len(rest) > 0; {
+		if len(f.pending) == encryptedChunkSize {
+			if err := f.seal(f.pending, false); err != nil {
+				f.err = &os.PathError{Op: "write", Path: f.name, Err: err}
+				return len(p) - len(rest), f.err
+			}
+			f.pending = f.pending[:0]
+		}
+		n := min(encryptedChunkSize-len(f.pending), len(rest))
+		f.pending = append(f.pending, rest[:n]...)
+		rest = rest[n:]
+	}
+	f.written += int64(len(p))
+	return len(p), nil
+}
+
+func (f *encryptedFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *encryptedFile) WriteAt(p []byte, off int64) (int, error) {
+	return 0, &os.PathError{Op: "writeat", Path: f.name, Err: errEncryptedUnsupported}
+}
+
+func (f *encryptedFile) Truncate(size int64) error {
+	return &os.PathError{Op: "truncate", Path: f.name, Err: errEncryptedUnsupported}
+}
+
+// Sync only syncs the sealed chunks: the pending content is written by Close.
+func (f *encryptedFile) Sync() error {
+	return f.base.Sync()
+}
+
+// Close seals the pending content as the last chunk; an empty file is one
+// empty chunk, so its tag still authenticates it.
+func (f *encryptedFile) Close() error {
+	if f.closed {
+		return afero.ErrFileClosed
+	}
+	f.closed = true
+	err := f.err
+	if f.writing && err == nil {
+		if sealErr := f.seal(f.pending, true); sealErr != nil {
+			err = &os.PathError{Op: "close", Path: f.name, Err: sealErr}
+		}
+	}
+	if closeErr := f.base.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+func testMasterKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, MasterKeySize)
+}
+
+func newTestEncryptedFs(t *testing.T, base afero.Fs, current []byte, previous ...[]byte) *EncryptedFs {
+	t.Helper()
+	keys, err := NewKeyRing(current, previous...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewEncryptedFs(base, keys)
+}
+
+// testContent is n bytes that do not repeat within a chunk.
+func testContent(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i * 7 / 3)
+	}
+	return data
+}
+
+func TestEncryptedFsRoundTrips(t *testing.T) {
+	base := afero.NewMemMapFs()
+	fs := newTestEncryptedFs(t, base, testMasterKey(1))
+
+	for _, n := range []int{0, 1, encryptedChunkSize - 1, encryptedChunkSize, encryptedChunkSize + 1, 3*encryptedChunkSize + 5} {
+		data := testContent(n)
+		writeFile(t, fs, "/file", data)
+
+		stored, _ := afero.ReadFile(base, "/file")
+		if n > 16 && bytes.Contains(stored, data[:16]) {
+			t.Errorf("%d bytes: the stored file holds the content in the clear", n)
+		}
+		info, err := fs.Stat("/file")
+		if err != nil || info.Size() != int64(n) {
+			t.Errorf("%d bytes: Stat = %v, %v", n, info, err)
+		}
+		got, err := afero.ReadFile(fs, "/file")
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("%d bytes: read back %d bytes, %v", n, len(got), err)
+		}
+	}
+}
+
+func TestEncryptedFsSeeksAcrossChunks(t *testing.T) {
+	fs := newTestEncryptedFs(t, afero.NewMemMapFs(), testMasterKey(1))
+	data := testContent(2*encryptedChunkSize + 100)
+	writeFile(t, fs, "/video.mp4", data)
+
+	f, err := fs.Open("/video.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	from := int64(encryptedChunkSize - 10)
+	if _, err := f.Seek(from, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, 30)
+	if _, err := io.ReadFull(f, got); err != nil || !bytes.Equal(got, data[from:from+30]) {
+		t.Errorf("read across a chunk boundary after Seek = %v", err)
+	}
+	if pos, _ := f.Seek(-5, io.SeekEnd); pos != int64(len(data)-5) {
+		t.Errorf("Seek from the end = %d", pos)
+	}
+
+	at := make([]byte, encryptedChunkSize+20)
+	if n, err := f.ReadAt(at, 50); n != len(at) || err != nil || !bytes.Equal(at, data[50:50+len(at)]) {
+		t.Errorf("ReadAt across chunks = %d, %v", n, err)
+	}
+	if n, err := f.ReadAt(at, int64(len(data)-10)); n != 10 || err != io.EOF {
+		t.Errorf("ReadAt past the end = %d, %v; want 10, EOF", n, err)
+	}
+
+	// http.FileServer and version downloads serve Range requests this way.
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/video.mp4", nil)
+	req.Header.Set("Range", "bytes=65530-65545")
+	http.ServeContent(rec, req, "video.mp4", time.Time{}, f)
+	if rec.Code != http.StatusPartialContent || !bytes.Equal(rec.Body.Bytes(), data[65530:65546]) {
+		t.Errorf("Range request = %d %d bytes", rec.Code, rec.Body.Len())
+	}
+}
+
+func TestEncryptedFsDetectsTampering(t *testing.T) {
+	base := afero.NewMemMapFs()
+	fs := newTestEncryptedFs(t, base, testMasterKey(1))
+	data := testContent(2*encryptedChunkSize + 100)
+	writeFile(t, fs, "/file", data)
+	stored, _ := afero.ReadFile(base, "/file")
+
+	flipped := bytes.Clone(stored)
+	flipped[encryptedHeaderSize+encryptedSealedChunk+3] ^= 1
+	_ = afero.WriteFile(base, "/file", flipped, 0644)
+	if _, err := afero.ReadFile(fs, "/file"); !errors.Is(err, ErrEncryptedFileCorrupt) {
+		t.Errorf("reading a changed byte = %v, want ErrEncryptedFileCorrupt", err)
+	}
+
+	// Cut after the second chunk, the file would still have a valid size.
+	_ = afero.WriteFile(base, "/file", stored[:encryptedHeaderSize+2*encryptedSealedChunk], 0644)
+	if _, err := afero.ReadFile(fs, "/file"); !errors.Is(err, ErrEncryptedFileCorrupt) {
+		t.Errorf("reading a truncated file = %v, want ErrEncryptedFileCorrupt", err)
+	}
+
+	_ = afero.WriteFile(base, "/file", stored, 0644)
+	other := newTestEncryptedFs(t, base, testMasterKey(2))
+	if _, err := other.Open("/file"); !errors.Is(err, ErrUnknownMasterKey) {
+		t.Errorf("opening with another master key = %v, want ErrUnknownMasterKey", err)
+	}
+}
+
+func TestEncryptedFsReadsFilesStoredInTheClear(t *testing.T) {
+	base := afero.NewMemMapFs()
+	_ = afero.WriteFile(base, "/old.txt", []byte("stored before encryption"), 0644)
+	fs := newTestEncryptedFs(t, base, testMasterKey(1))
+
+	got, err := afero.ReadFile(fs, "/old.txt")
+	if err != nil || string(got) != "stored before encryption" {
+		t.Errorf("read = %q, %v", got, err)
+	}
+	if _, err := fs.OpenFile("/old.txt", os.O_WRONLY|os.O_APPEND, 0644); err == nil {
+		t.Error("an append open was accepted")
+	}
+}
+
+func TestEncryptedFsRewrap(t *testing.T) {
+	base := afero.NewMemMapFs()
+	old := newTestEncryptedFs(t, base, testMasterKey(1))
+	writeFile(t, old, "/wrapped", []byte("wrapped with the old key"))
+	_ = afero.WriteFile(base, "/clear", []byte("stored in the clear"), 0644)
+	before, _ := afero.ReadFile(base, "/wrapped")
+
+	fs := newTestEncryptedFs(t, base, testMasterKey(2), testMasterKey(1))
+	for name, want := range map[string]RewrapOutcome{"/wrapped": RewrapRewrapped, "/clear": RewrapEncrypted} {
+		if got, err := fs.Rewrap(name); got != want || err != nil {
+			t.Errorf("Rewrap(%s) = %v, %v; want %v", name, got, err, want)
+		}
+		if got, err := fs.Rewrap(name); got != RewrapCurrent || err != nil {
+			t.Errorf("second Rewrap(%s) = %v, %v; want RewrapCurrent", name, got, err)
+		}
+	}
+
+	after, _ := afero.ReadFile(base, "/wrapped")
+	if !bytes.Equal(after[encryptedHeaderSize:], before[encryptedHeaderSize:]) {
+		t.Error("re-wrapping re-encrypted the content")
+	}
+	current := newTestEncryptedFs(t, base, testMasterKey(2))
+	for name, want := range map[string]string{"/wrapped": "wrapped with the old key", "/clear": "stored in the clear"} {
+		if got, err := afero.ReadFile(current, name); err != nil || string(got) != want {
+			t.Errorf("%s without the old key = %q, %v", name, got, err)
+		}
+	}
+	if exists, _ := afero.Exists(base, rewrapTemp("/wrapped")); exists {
+		t.Error("the temporary file was left behind")
+	}
+}
+
+func TestEncryptedFsStreamsFromS3(t *testing.T) {
+	s3, stub := newStubFs(t, DefaultS3PartSize)
+	fs := newTestEncryptedFs(t, s3, testMasterKey(1))
+	data := testContent(3*encryptedChunkSize + 1)
+	writeFile(t, fs, "/big.bin", data)
+
+	got, err := afero.ReadFile(fs, "/big.bin")
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("read back %d bytes, %v", len(got), err)
+	}
+	// One ranged GET for the header, one streaming the chunks.
+	gets := 0
+	for _, r := range stub.Requests() {
+		if r.Method == http.MethodGet && r.Key == "library/big.bin" {
+			gets++
+		}
+	}
+	if gets != 2 {
+		t.Errorf("a sequential read made %d GETs, want 2", gets)
+	}
+}
+
+func TestParseMasterKey(t *testing.T) {
+	raw := testMasterKey(7)
+	for _, value := range []string{hex.EncodeToString(raw), base64.StdEncoding.EncodeToString(raw) + "\n"} {
+		if got, err := ParseMasterKey(value); err != nil || !bytes.Equal(got, raw) {
+			t.Errorf("ParseMasterKey(%q) = %x, %v", value, got, err)
+		}
+	}
+	for _, value := range []string{"", "abcd", strings.Repeat("z", 64)} {
+		if _, err := ParseMasterKey(value); err == nil {
+			t.Errorf("ParseMasterKey(%q) succeeded", value)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// MasterKeySize is the length of a master key: AES-256.
+const MasterKeySize = 32
+
+// KeyID identifies a master key without revealing it: the first bytes of its
+// SHA-256. Each encrypted file records the ID of the key that wrapped its own.
+type KeyID [8]byte
+
+func (id KeyID) String() string { return hex.EncodeToString(id[:]) }
+
+type masterKey struct {
+	id   KeyID
+	aead cipher.AEAD
+}
+
+// KeyRing holds the master key new files are wrapped with, and the previous
+// ones still accepted for reading until a rotation re-wraps their files.
+type KeyRing struct {
+	current masterKey
+	keys    map[KeyID]masterKey
+}
+
+// NewKeyRing builds a key ring from raw master keys, each MasterKeySize
+// bytes. Previous keys only decrypt.
+func NewKeyRing(current []byte, previous ...[]byte) (*KeyRing, error) {
+	ring := &KeyRing{keys: map[KeyID]masterKey{}}
+	for i, raw := range append([][]byte{current}, previous...) {
+		if len(raw) != MasterKeySize {
+			return nil, fmt.Errorf("master key is %d bytes, expected %d", len(raw), MasterKeySize)
+		}
+		block, err := aes.NewCipher(raw)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(raw)
+		key := masterKey{aead: aead}
+		copy(key.id[:], sum[:])
+		if i == 0 {
+			ring.current = key
+		}
+		ring.keys[key.id] = key
+	}
+	return ring, nil
+}
+
+// CurrentKeyID is the ID of the key new files are wrapped with.
+func (r *KeyRing) CurrentKeyID() KeyID { return r.current.id }
+
+// KeyIDs lists every key in the ring, the current one first.
+func (r *KeyRing) KeyIDs() []KeyID {
+	ids := []KeyID{r.current.id}
+	for id := range r.keys {
+		if id != r.current.id {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// ParseMasterKey reads a master key written as 64 hex digits or as standard
+// base64 of 32 bytes. Surrounding whitespace is ignored, so a key file may
+// end with a newline.
+func ParseMasterKey(value string) ([]byte, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, errors.New("master key is empty")
+	}
+	if raw, err := hex.DecodeString(value); err == nil && len(raw) == MasterKeySize {
+		return raw, nil
+	}
+	if raw, err := base64.StdEncoding.DecodeString(value); err == nil && len(raw) == MasterKeySize {
+		return raw, nil
+	}
+	return nil, fmt.Errorf("master key must be %d bytes as hex or base64", MasterKeySize)
+}
+
+// ReadMasterKeyFile reads a master key from a file; see ParseMasterKey.
+func ReadMasterKeyFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ParseMasterKey(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
+
+// LoadKeyRing builds the key ring from configuration: the current master key
+// from keyFile or, when that is empty, keyValue, and previous keys from both
+// previousFiles and previousValues. It returns nil, leaving encryption off,
+// when no current key is configured; previous keys without one are an error.
+func LoadKeyRing(keyFile, keyValue string, previousFiles, previousValues []string) (*KeyRing, error) {
+	var previous [][]byte
+	for _, file := range previousFiles {
+		key, err := ReadMasterKeyFile(file)
+		if err != nil {
+			return nil, err
+		}
+		previous = append(previous, key)
+	}
+	for i, value := range previousValues {
+		key, err := ParseMasterKey(value)
+		if err != nil {
+			return nil, fmt.Errorf("previous key %d: %w", i+1, err)
+		}
+		previous = append(previous, key)
+	}
+
+	var current []byte
+	var err error
+	switch {
+	case keyFile != "":
+		current, err = ReadMasterKeyFile(keyFile)
+	case keyValue != "":
+		current, err = ParseMasterKey(keyValue)
+	case len(previous) > 0:
+		return nil, errors.New("previous master keys are set without a current one")
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyRing(current, previous...)
+}
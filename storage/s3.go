@@ -0,0 +1,512 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/spf13/afero"
+)
+
+// DefaultS3PartSize is the multipart upload part size unless the location
+// sets part-size. Files no larger than one part are uploaded with a single PUT.
+const DefaultS3PartSize = 8 << 20
+
+// S3 requires every part but the last to be at least 5 MiB, and allows at
+// most 5 GiB.
+const (
+	minS3PartSize = 5 << 20
+	maxS3PartSize = 5 << 30
+)
+
+// S3Config locates a key prefix in a bucket of an S3-compatible service.
+type S3Config struct {
+	Bucket   string
+	Prefix   string // key prefix without leading or trailing slash; empty for the whole bucket
+	Endpoint string // scheme://host[:port] of the service
+	Region   string
+	// PathStyle addresses the bucket as endpoint/bucket rather than as
+	// bucket.endpoint; most self-hosted services need it.
+	PathStyle       bool
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	PartSize        int64
+}
+
+// IsS3Location reports whether a storage location names an S3 bucket rather
+// than a local directory.
+func IsS3Location(location string) bool {
+	return strings.HasPrefix(location, "s3://")
+}
+
+// ParseS3Location reads an s3://bucket/prefix location. Its query may set
+// endpoint, region, path-style and part-size, e.g.
+// s3://media/library?endpoint=http://localhost:9000&path-style=true.
+//
+// Credentials are only read from the environment (AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN), so that locations can be shown
+// on the admin pages. The region falls back to AWS_REGION, AWS_DEFAULT_REGION
+// and then us-east-1; the endpoint to AWS_ENDPOINT_URL_S3, AWS_ENDPOINT_URL
+// and then AWS's own for the region.
+func ParseS3Location(location string) (S3Config, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return S3Config{}, err
+	}
+	if u.Scheme != "s3" || u.Host == "" {
+		return S3Config{}, fmt.Errorf("expected s3://bucket[/prefix], got %q", location)
+	}
+	if u.User != nil {
+		return S3Config{}, errors.New("S3 credentials are read from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, not from the location")
+	}
+
+	query := u.Query()
+	for name := range query {
+		switch name {
+		case "endpoint", "region", "path-style", "part-size":
+		default:
+			return S3Config{}, fmt.Errorf("unknown S3 location option %q (expected endpoint, region, path-style or part-size)", name)
+		}
+	}
+
+	cfg := S3Config{
+		Bucket:          u.Host,
+		Prefix:          strings.Trim(u.Path, "/"),
+		Region:          firstNonEmpty(query.Get("region"), os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"), "us-east-1"),
+		Endpoint:        firstNonEmpty(query.Get("endpoint"), os.Getenv("AWS_ENDPOINT_URL_S3"), os.Getenv("AWS_ENDPOINT_URL")),
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		PartSize:        DefaultS3PartSize,
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" || strings.Trim(endpoint.Path, "/") != "" {
+		return S3Config{}, fmt.Errorf("S3 endpoint must be http(s)://host[:port], got %q", cfg.Endpoint)
+	}
+	cfg.Endpoint = endpoint.Scheme + "://" + endpoint.Host
+
+	if v := query.Get("path-style"); v != "" {
+		if cfg.PathStyle, err = strconv.ParseBool(v); err != nil {
+			return S3Config{}, fmt.Errorf("invalid S3 path-style %q", v)
+		}
+	}
+	if v := query.Get("part-size"); v != "" {
+		size, err := datasize.ParseString(v)
+		if err != nil || size < minS3PartSize || size > maxS3PartSize {
+			return S3Config{}, fmt.Errorf("S3 part-size must be between 5MB and 5GB, got %q", v)
+		}
+		cfg.PartSize = int64(size)
+	}
+	return cfg, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// S3Fs is an afero.Fs over a key prefix of an S3 bucket. Names map to keys
+// below the prefix; directories are implied by the keys under them, so Mkdir
+// does nothing and an empty directory does not exist.
+//
+// Files are opened either for reading or for writing whole objects. A read
+// fetches the object from the current offset with a Range request, so seeking
+// callers such as http.ServeContent only transfer what they read. A write is
+// buffered and sent as a multipart upload, one part at a time, completed by
+// Close; a file that fits in one part is sent with a single PUT. Appending,
+// WriteAt and Truncate are not supported.
+//
+// Rename is a server-side copy and a delete, limited to S3's 5 GiB single
+// copy. Modes, owners and times are not stored.
+type S3Fs struct {
+	cfg      S3Config
+	endpoint *url.URL
+	client   *http.Client
+	// err is a configuration error every operation returns; see CreateStorage.
+	err error
+}
+
+// NewS3Fs returns an S3Fs for cfg. It does not contact the service.
+func NewS3Fs(cfg S3Config) *S3Fs {
+	if cfg.PartSize <= 0 {
+		cfg.PartSize = DefaultS3PartSize
+	}
+	fs := &S3Fs{cfg: cfg, client: http.DefaultClient}
+	fs.endpoint, fs.err = url.Parse(cfg.Endpoint)
+	return fs
+}
+
+// S3Error is an error response from the S3 service.
+type S3Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *S3Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("s3: %s: %s", e.Code, e.Message)
+}
+
+type s3ErrorBody struct {
+	XMLName xml.Name
+	Code    string
+	Message string
+}
+
+// errS3Unsupported is returned for the file operations objects cannot do.
+var errS3Unsupported = errors.New("not supported by S3 storage")
+
+// pathError wraps err for name, as os does. A missing key becomes
+// os.ErrNotExist so os.IsNotExist and afero.Exists see it.
+func pathError(op, name string, err error) error {
+	var s3Err *S3Error
+	if errors.As(err, &s3Err) && s3Err.StatusCode == http.StatusNotFound && (s3Err.Code == "" || s3Err.Code == "NoSuchKey") {
+		err = os.ErrNotExist
+	}
+	return &os.PathError{Op: op, Path: name, Err: err}
+}
+
+// key maps a file name to its object key.
+func (fs *S3Fs) key(name string) string {
+	clean := strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(name)), "/")
+	switch {
+	case fs.cfg.Prefix == "":
+		return clean
+	case clean == "":
+		return fs.cfg.Prefix
+	}
+	return fs.cfg.Prefix + "/" + clean
+}
+
+// isRoot reports whether key is the top of the prefix, which always exists.
+func (fs *S3Fs) isRoot(key string) bool {
+	return key == fs.cfg.Prefix
+}
+
+// dirPrefix is the key prefix of the objects inside the directory at key.
+func dirPrefix(key string) string {
+	if key == "" {
+		return ""
+	}
+	return key + "/"
+}
+
+// objectURL addresses key (the bucket itself when empty) with query.
+func (fs *S3Fs) objectURL(key string, query url.Values) *url.URL {
+	u := *fs.endpoint
+	if fs.cfg.PathStyle {
+		u.Path = "/" + fs.cfg.Bucket
+		u.RawPath = "/" + s3Escape(fs.cfg.Bucket, false)
+		if key != "" {
+			u.Path += "/" + key
+			u.RawPath += "/" + s3Escape(key, true)
+		}
+	} else {
+		u.Host = fs.cfg.Bucket + "." + u.Host
+		u.Path = "/" + key
+		u.RawPath = "/" + s3Escape(key, true)
+	}
+	u.RawQuery = canonicalQuery(query)
+	return &u
+}
+
+// do sends a signed request and returns the response of a successful one;
+// any other status is returned as an *S3Error.
+func (fs *S3Fs) do(method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u := fs.objectURL(key, query)
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.URL = u
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	bodyHash := emptyPayloadHash
+	if len(body) > 0 {
+		bodyHash = payloadHash(body)
+	}
+	fs.cfg.sign(req, bodyHash, time.Now())
+
+	resp, err := fs.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		s3Err := &S3Error{StatusCode: resp.StatusCode}
+		var parsed s3ErrorBody
+		if data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10)); xml.Unmarshal(data, &parsed) == nil {
+			s3Err.Code, s3Err.Message = parsed.Code, parsed.Message
+		}
+		return nil, s3Err
+	}
+	return resp, nil
+}
+
+// doXML sends a request and decodes its XML response into out. S3 reports
+// some failures of copies and multipart completions in a 200 response whose
+// body is an Error, so that is checked for first.
+func (fs *S3Fs) doXML(method, key string, query url.Values, header http.Header, body []byte, out any) error {
+	resp, err := fs.do(method, key, query, header, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var failure s3ErrorBody
+	if xml.Unmarshal(data, &failure) == nil && failure.XMLName.Local == "Error" {
+		return &S3Error{StatusCode: resp.StatusCode, Code: failure.Code, Message: failure.Message}
+	}
+	if out == nil {
+		return nil
+	}
+	return xml.Unmarshal(data, out)
+}
+
+type s3ListResult struct {
+	IsTruncated           bool
+	NextContinuationToken string
+	Contents              []struct {
+		Key          string
+		Size         int64
+		LastModified time.Time
+	}
+	CommonPrefixes []struct {
+		Prefix string
+	}
+}
+
+// list pages through the keys under prefix. With a delimiter, keys below the
+// next delimiter are rolled up into common prefixes. It stops after limit
+// entries when limit is positive.
+func (fs *S3Fs) list(prefix, delimiter string, limit int, visit func(s3ListResult)) error {
+	token := ""
+	seen := 0
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if delimiter != "" {
+			query.Set("delimiter", delimiter)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		if limit > 0 {
+			query.Set("max-keys", strconv.Itoa(limit-seen))
+		}
+		var page s3ListResult
+		if err := fs.doXML(http.MethodGet, "", query, nil, nil, &page); err != nil {
+			return err
+		}
+		visit(page)
+		seen += len(page.Contents) + len(page.CommonPrefixes)
+		if !page.IsTruncated || page.NextContinuationToken == "" || (limit > 0 && seen >= limit) {
+			return nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// stat looks key up as an object, then as a directory.
+func (fs *S3Fs) stat(name, key string) (*s3FileInfo, error) {
+	if fs.isRoot(key) {
+		return &s3FileInfo{name: path.Base(key), dir: true}, nil
+	}
+	resp, err := fs.do(http.MethodHead, key, nil, nil, nil)
+	if err == nil {
+		resp.Body.Close()
+		modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+		return &s3FileInfo{name: path.Base(key), size: resp.ContentLength, modTime: modTime}, nil
+	}
+	var s3Err *S3Error
+	if !errors.As(err, &s3Err) || s3Err.StatusCode != http.StatusNotFound {
+		return nil, pathError("stat", name, err)
+	}
+
+	found := false
+	if err := fs.list(dirPrefix(key), "/", 1, func(page s3ListResult) {
+		found = found || len(page.Contents) > 0 || len(page.CommonPrefixes) > 0
+	}); err != nil {
+		return nil, pathError("stat", name, err)
+	}
+	if !found {
+		return nil, pathError("stat", name, os.ErrNotExist)
+	}
+	return &s3FileInfo{name: path.Base(key), dir: true}, nil
+}
+
+func (fs *S3Fs) Stat(name string) (os.FileInfo, error) {
+	if fs.err != nil {
+		return nil, pathError("stat", name, fs.err)
+	}
+	info, err := fs.stat(name, fs.key(name))
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (fs *S3Fs) Open(name string) (afero.File, error) {
+	if fs.err != nil {
+		return nil, pathError("open", name, fs.err)
+	}
+	key := fs.key(name)
+	info, err := fs.stat(name, key)
+	if err != nil {
+		return nil, err
+	}
+	return &s3File{fs: fs, name: name, key: key, info: info}, nil
+}
+
+func (fs *S3Fs) Create(name string) (afero.File, error) {
+	if fs.err != nil {
+		return nil, pathError("open", name, fs.err)
+	}
+	return &s3File{fs: fs, name: name, key: fs.key(name), writing: true}, nil
+}
+
+// OpenFile opens for reading, or for writing a whole new object: a write
+// open that would read or append is refused.
+func (fs *S3Fs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) == 0 {
+		return fs.Open(name)
+	}
+	if flag&os.O_APPEND != 0 || (flag&os.O_RDWR != 0 && flag&os.O_TRUNC == 0) {
+		return nil, pathError("open", name, errS3Unsupported)
+	}
+	if flag&os.O_EXCL != 0 || flag&os.O_CREATE == 0 {
+		_, err := fs.Stat(name)
+		switch {
+		case err == nil && flag&os.O_EXCL != 0:
+			return nil, pathError("open", name, os.ErrExist)
+		case err != nil && (flag&os.O_CREATE == 0 || !os.IsNotExist(err)):
+			return nil, err
+		}
+	}
+	return fs.Create(name)
+}
+
+// Mkdir and MkdirAll succeed without a request: directories exist once a
+// key is written under them.
+func (fs *S3Fs) Mkdir(name string, perm os.FileMode) error { return fs.err }
+
+func (fs *S3Fs) MkdirAll(path string, perm os.FileMode) error { return fs.err }
+
+func (fs *S3Fs) Remove(name string) error {
+	info, err := fs.Stat(name)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return pathError("remove", name, syscall.ENOTEMPTY)
+	}
+	resp, err := fs.do(http.MethodDelete, fs.key(name), nil, nil, nil)
+	if err != nil {
+		return pathError("remove", name, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (fs *S3Fs) RemoveAll(name string) error {
+	if fs.err != nil {
+		return pathError("removeall", name, fs.err)
+	}
+	key := fs.key(name)
+	var keys []string
+	if err := fs.list(dirPrefix(key), "", 0, func(page s3ListResult) {
+		for _, object := range page.Contents {
+			keys = append(keys, object.Key)
+		}
+	}); err != nil {
+		return pathError("removeall", name, err)
+	}
+	if !fs.isRoot(key) {
+		keys = append(keys, key)
+	}
+	for _, k := range keys {
+		resp, err := fs.do(http.MethodDelete, k, nil, nil, nil)
+		if err != nil {
+			return pathError("removeall", name, err)
+		}
+		resp.Body.Close()
+	}
+	return nil
+}
+
+// Rename copies the object to its new key and deletes the old one.
+// Directories cannot be renamed.
+func (fs *S3Fs) Rename(oldname, newname string) error {
+	info, err := fs.Stat(oldname)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return pathError("rename", oldname, errS3Unsupported)
+	}
+	oldKey := fs.key(oldname)
+	header := http.Header{"X-Amz-Copy-Source": {"/" + fs.cfg.Bucket + "/" + s3Escape(oldKey, true)}}
+	if err := fs.doXML(http.MethodPut, fs.key(newname), nil, header, nil, nil); err != nil {
+		return pathError("rename", oldname, err)
+	}
+	resp, err := fs.do(http.MethodDelete, oldKey, nil, nil, nil)
+	if err != nil {
+		return pathError("rename", oldname, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (fs *S3Fs) Name() string { return "S3Fs" }
+
+func (fs *S3Fs) Chmod(name string, mode os.FileMode) error { return fs.err }
+
+func (fs *S3Fs) Chown(name string, uid, gid int) error { return fs.err }
+
+func (fs *S3Fs) Chtimes(name string, atime time.Time, mtime time.Time) error { return fs.err }
+
+type s3FileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (i *s3FileInfo) Name() string       { return i.name }
+func (i *s3FileInfo) Size() int64        { return i.size }
+func (i *s3FileInfo) ModTime() time.Time { return i.modTime }
+func (i *s3FileInfo) IsDir() bool        { return i.dir }
+func (i *s3FileInfo) Sys() any           { return nil }
+
+func (i *s3FileInfo) Mode() os.FileMode {
+	if i.dir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
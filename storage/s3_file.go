@@ -0,0 +1,336 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// s3File is an object opened for reading, a directory opened for listing, or
+// an object being written; see S3Fs.
+type s3File struct {
+	fs     *S3Fs
+	name   string
+	key    string
+	info   *s3FileInfo // nil while writing
+	closed bool
+
+	// Reading: body streams the object from bodyAt, and is reopened when a
+	// Seek moves offset elsewhere.
+	offset int64
+	body   io.ReadCloser
+	bodyAt int64
+
+	// Listing.
+	entries []os.FileInfo
+	listed  bool
+
+	// Writing: buf holds what is not yet sent as a part.
+	writing  bool
+	buf      bytes.Buffer
+	written  int64
+	uploadID string
+	parts    []s3CompletedPart
+	err      error // the first failed part; Close reports it
+}
+
+type s3CompletedPart struct {
+	PartNumber int
+	ETag       string
+}
+
+func (f *s3File) Name() string { return f.name }
+
+func (f *s3File) Stat() (os.FileInfo, error) {
+	if f.writing {
+		return &s3FileInfo{name: path.Base(f.key), size: f.written, modTime: time.Now()}, nil
+	}
+	return f.info, nil
+}
+
+func (f *s3File) closeBody() {
+	if f.body != nil {
+		f.body.Close()
+		f.body = nil
+	}
+}
+
+// readable returns the error for reading from f, if any.
+func (f *s3File) readable(op string) error {
+	switch {
+	case f.closed:
+		return afero.ErrFileClosed
+	case f.writing:
+		return pathError(op, f.name, os.ErrInvalid)
+	case f.info.dir:
+		return pathError(op, f.name, syscall.EISDIR)
+	}
+	return nil
+}
+
+// get fetches the object's bytes from start to end inclusive, or to its end
+// when end is negative.
+func (f *s3File) get(start, end int64) (*http.Response, error) {
+	rangeHeader := "bytes=" + strconv.FormatInt(start, 10) + "-"
+	if end >= 0 {
+		rangeHeader += strconv.FormatInt(end, 10)
+	}
+	return f.fs.do(http.MethodGet, f.key, nil, http.Header{"Range": {rangeHeader}}, nil)
+}
+
+func (f *s3File) Read(p []byte) (int, error) {
+	if err := f.readable("read"); err != nil {
+		return 0, err
+	}
+	if f.offset >= f.info.size {
+		return 0, io.EOF
+	}
+	if f.body == nil || f.bodyAt != f.offset {
+		f.closeBody()
+		resp, err := f.get(f.offset, -1)
+		if err != nil {
+			return 0, pathError("read", f.name, err)
+		}
+		f.body, f.bodyAt = resp.Body, f.offset
+	}
+	n, err := f.body.Read(p)
+	f.offset += int64(n)
+	f.bodyAt += int64(n)
+	if err == io.EOF {
+		f.closeBody()
+		if f.offset < f.info.size {
+			err = io.ErrUnexpectedEOF
+		}
+	}
+	return n, err
+}
+
+func (f *s3File) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.readable("readat"); err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, pathError("readat", f.name, os.ErrInvalid)
+	}
+	if off >= f.info.size || len(p) == 0 {
+		return 0, io.EOF
+	}
+	want := min(int64(len(p)), f.info.size-off)
+	resp, err := f.get(off, off+want-1)
+	if err != nil {
+		return 0, pathError("readat", f.name, err)
+	}
+	defer resp.Body.Close()
+	n, err := io.ReadFull(resp.Body, p[:want])
+	if err != nil {
+		return n, err
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Seek only moves the offset; the next Read fetches from there.
+func (f *s3File) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, afero.ErrFileClosed
+	}
+	if f.writing {
+		if offset == 0 && whence == io.SeekCurrent {
+			return f.written, nil
+		}
+		return 0, pathError("seek", f.name, errS3Unsupported)
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.info.size
+	}
+	if offset < 0 {
+		return 0, pathError("seek", f.name, os.ErrInvalid)
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *s3File) Readdir(count int) ([]os.FileInfo, error) {
+	if f.closed {
+		return nil, afero.ErrFileClosed
+	}
+	if f.writing || !f.info.dir {
+		return nil, pathError("readdir", f.name, syscall.ENOTDIR)
+	}
+	if !f.listed {
+		prefix := dirPrefix(f.key)
+		err := f.fs.list(prefix, "/", 0, func(page s3ListResult) {
+			for _, p := range page.CommonPrefixes {
+				f.entries = append(f.entries, &s3FileInfo{name: strings.TrimSuffix(strings.TrimPrefix(p.Prefix, prefix), "/"), dir: true})
+			}
+			for _, object := range page.Contents {
+				if object.Key == prefix {
+					continue // a console-made directory marker
+				}
+				f.entries = append(f.entries, &s3FileInfo{name: strings.TrimPrefix(object.Key, prefix), size: object.Size, modTime: object.LastModified})
+			}
+		})
+		if err != nil {
+			return nil, pathError("readdir", f.name, err)
+		}
+		sort.Slice(f.entries, func(i, j int) bool { return f.entries[i].Name() < f.entries[j].Name() })
+		f.listed = true
+	}
+
+	if count <= 0 {
+		entries := f.entries
+		f.entries = nil
+		return entries, nil
+	}
+	if len(f.entries) == 0 {
+		return nil, io.EOF
+	}
+	n := min(count, len(f.entries))
+	entries := f.entries[:n]
+	f.entries = f.entries[n:]
+	return entries, nil
+}
+
+func (f *s3File) Readdirnames(n int) ([]string, error) {
+	entries, err := f.Readdir(n)
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.Name()
+	}
+	return names, err
+}
+
+func (f *s3File) Write(p []byte) (int, error) {
+	switch {
+	case f.closed:
+		return 0, afero.ErrFileClosed
+	case !f.writing:
+		return 0, pathError("write", f.name, syscall.EBADF)
+	case f.err != nil:
+		return 0, f.err
+	}
+	f.buf.Write(p)
+	f.written += int64(len(p))
+	for int64(f.buf.Len()) >= f.fs.cfg.PartSize {
+		if err := f.uploadPart(f.buf.Next(int(f.fs.cfg.PartSize))); err != nil {
+			f.err = pathError("write", f.name, err)
+			return len(p), f.err
+		}
+	}
+	return len(p), nil
+}
+
+func (f *s3File) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *s3File) WriteAt(p []byte, off int64) (int, error) {
+	return 0, pathError("writeat", f.name, errS3Unsupported)
+}
+
+func (f *s3File) Truncate(size int64) error {
+	return pathError("truncate", f.name, errS3Unsupported)
+}
+
+// Sync does nothing: an object is only stored once Close completes it.
+func (f *s3File) Sync() error {
+	return nil
+}
+
+// uploadPart sends the next part, starting the multipart upload first.
+func (f *s3File) uploadPart(data []byte) error {
+	if f.uploadID == "" {
+		var initiated struct{ UploadId string }
+		if err := f.fs.doXML(http.MethodPost, f.key, url.Values{"uploads": {""}}, nil, nil, &initiated); err != nil {
+			return err
+		}
+		if initiated.UploadId == "" {
+			return errors.New("s3: no upload ID in the multipart upload response")
+		}
+		f.uploadID = initiated.UploadId
+	}
+	number := len(f.parts) + 1
+	resp, err := f.fs.do(http.MethodPut, f.key, url.Values{
+		"partNumber": {strconv.Itoa(number)},
+		"uploadId":   {f.uploadID},
+	}, nil, data)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	f.parts = append(f.parts, s3CompletedPart{PartNumber: number, ETag: resp.Header.Get("ETag")})
+	return nil
+}
+
+// Close stores a written object: the buffered bytes as the last part of a
+// multipart upload, or with one PUT when no part was sent. A failed upload is
+// aborted so the service does not keep its parts.
+func (f *s3File) Close() error {
+	if f.closed {
+		return afero.ErrFileClosed
+	}
+	f.closed = true
+	f.closeBody()
+	if !f.writing {
+		return nil
+	}
+
+	err := f.err
+	if err == nil {
+		err = f.finish()
+	}
+	if err != nil && f.uploadID != "" {
+		if resp, abortErr := f.fs.do(http.MethodDelete, f.key, url.Values{"uploadId": {f.uploadID}}, nil, nil); abortErr == nil {
+			resp.Body.Close()
+		}
+	}
+	if err != nil && !errors.As(err, new(*os.PathError)) {
+		err = pathError("close", f.name, err)
+	}
+	return err
+}
+
+func (f *s3File) finish() error {
+	if f.uploadID == "" {
+		resp, err := f.fs.do(http.MethodPut, f.key, nil, nil, f.buf.Bytes())
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+	if f.buf.Len() > 0 {
+		if err := f.uploadPart(f.buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name          `xml:"CompleteMultipartUpload"`
+		Parts   []s3CompletedPart `xml:"Part"`
+	}{Parts: f.parts})
+	if err != nil {
+		return err
+	}
+	if err := f.fs.doXML(http.MethodPost, f.key, url.Values{"uploadId": {f.uploadID}}, nil, body, nil); err != nil {
+		return fmt.Errorf("completing multipart upload: %w", err)
+	}
+	return nil
+}
@@ -125,6 +125,11 @@
                     <dd class="mt-0.5" :class="dataStats.config.libreOfficeAvailable ? 'text-green-700' : 'text-stone-500'"
                         x-text="dataStats.config.libreOfficeAvailable ? 'Enabled' : 'Disabled'"></dd>
                 </div>
+                <div>
+                    <dt class="text-stone-500 text-xs uppercase tracking-wider">PDF Renderer</dt>
+                    <dd class="mt-0.5" :class="dataStats.config.pdfRendererAvailable ? 'text-green-700' : 'text-stone-500'"
+                        x-text="dataStats.config.pdfRendererAvailable ? 'Enabled' : 'Disabled'"></dd>
+                </div>
                 <div>
                     <dt class="text-stone-500 text-xs uppercase tracking-wider">Full-text Search</dt>
                     <dd class="mt-0.5" :class="dataStats.config.ftsEnabled ? 'text-green-700' : 'text-stone-500'"
@@ -268,6 +273,52 @@
                     </div>
                 </template>
 
+                {# Storage quotas with current usage #}
+                <template x-if="dataStats.quotas && dataStats.quotas.length > 0">
+                    <div class="space-y-3" data-testid="admin-storage-quotas">
+                        <h3 class="text-sm font-semibold font-mono text-stone-700">Storage Quotas</h3>
+                        <div class="overflow-x-auto">
+                            <table class="min-w-full text-sm font-mono">
+                                <thead>
+                                    <tr class="border-b border-stone-200">
+                                        <th class="py-2 pr-4 text-left text-xs text-stone-500 uppercase tracking-wider font-medium" scope="col">Subject</th>
+                                        <th class="py-2 pr-4 text-left text-xs text-stone-500 uppercase tracking-wider font-medium" scope="col">Bytes</th>
+                                        <th class="py-2 text-left text-xs text-stone-500 uppercase tracking-wider font-medium" scope="col">Resources</th>
+                                    </tr>
+                                </thead>
+                                <tbody>
+                                    <template x-for="quota in dataStats.quotas" :key="quota.subjectType + ':' + quota.subjectId">
+                                        <tr class="border-b border-stone-100 align-top" data-testid="storage-quota-row">
+                                            <td class="py-2 pr-4 min-w-48">
+                                                <div class="flex items-center gap-2">
+                                                    <template x-if="quota.subjectType === 'group'">
+                                                        <a class="text-stone-900 font-semibold hover:text-amber-700" :href="'/group?id=' + quota.subjectId" x-text="quota.subjectName"></a>
+                                                    </template>
+                                                    <template x-if="quota.subjectType !== 'group'">
+                                                        <span class="text-stone-900 font-semibold" x-text="quota.subjectName"></span>
+                                                    </template>
+                                                    <span class="rounded bg-stone-100 px-1.5 py-0.5 text-[0.65rem] uppercase tracking-wider text-stone-600" x-text="quota.subjectType"></span>
+                                                    <template x-if="quota.exceeded">
+                                                        <span class="rounded bg-red-100 px-1.5 py-0.5 text-[0.65rem] uppercase tracking-wider text-red-800">Full</span>
+                                                    </template>
+                                                </div>
+                                            </td>
+                                            <td class="py-2 pr-4 whitespace-nowrap">
+                                                <span class="text-stone-900" x-text="quota.usedBytesFmt"></span>
+                                                <span class="text-stone-500" x-text="quota.maxBytes > 0 ? ' of ' + quota.maxBytesFmt : ' (no limit)'"></span>
+                                            </td>
+                                            <td class="py-2 whitespace-nowrap">
+                                                <span class="text-stone-900" x-text="formatNumber(quota.usedResources)"></span>
+                                                <span class="text-stone-500" x-text="quota.maxResources > 0 ? ' of ' + formatNumber(quota.maxResources) : ' (no limit)'"></span>
+                                            </td>
+                                        </tr>
+                                    </template>
+                                </tbody>
+                            </table>
+                        </div>
+                    </div>
+                </template>
+
                 {# Entity count cards #}
                 <div class="grid grid-cols-2 sm:grid-cols-3 lg:grid-cols-4 gap-3" aria-label="Entity counts">
                     <a href="/resources" class="rounded-md bg-stone-50 border border-stone-200 p-3 hover:bg-amber-50 hover:border-amber-300 transition-colors focus:outline-none focus:ring-2 focus:ring-amber-500">
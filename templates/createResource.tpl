@@ -99,6 +99,20 @@
                             >
                         </div>
                         <p id="resource-description" class="mt-1 text-sm text-stone-500">Choose one or more files, or give a URL below instead.</p>
+                        <div x-show="!url.trim()" class="mt-2 flex items-center gap-2">
+                            <input
+                                type="checkbox"
+                                id="expand"
+                                name="expand"
+                                value="true"
+                                aria-describedby="expand-description"
+                                class="h-4 w-4 text-amber-700 focus:ring-amber-600 border-stone-300 rounded"
+                            >
+                            <label for="expand" class="text-sm font-mono text-stone-700">
+                                Expand archives into a group
+                            </label>
+                        </div>
+                        <p id="expand-description" x-show="!url.trim()" class="mt-1 text-sm text-stone-500">Unpack each zip or tar in the background into a new group under the owner: a subgroup per directory, a resource per file.</p>
                     </div>
                     <label for="URL" class="block text-sm font-medium font-mono text-stone-700">
                         URL
@@ -70,6 +70,13 @@
                     >⧉</button></dd>
                 </div>
                 {% endif %}
+                {% if resource.PageCount %}
+                <div class="bg-stone-50 border border-stone-200 hover:border-stone-300 rounded-lg px-4 py-3">
+                    <dt class="text-xs text-stone-500 font-mono">Pages</dt>
+                    <dd class="text-sm mt-0.5">{{ resource.PageCount }}
+                    <a href="/v1/resource/text?id={{ resource.ID }}" class="ml-2 text-xs text-amber-700 hover:underline">Text</a></dd>
+                </div>
+                {% endif %}
                 {% if sc.Timestamps %}
                 <div class="group relative bg-stone-50 border border-stone-200 hover:border-stone-300 rounded-lg px-4 py-3">
                     <dt class="text-xs text-stone-500 font-mono">Created</dt>
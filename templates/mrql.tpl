@@ -132,9 +132,10 @@
             </div>
             <div>
                 <h3 class="font-semibold text-stone-700">Set Membership</h3>
-                <p class="text-xs"><code class="bg-stone-200 px-1 rounded">IN (...)</code> / <code class="bg-stone-200 px-1 rounded">NOT IN (...)</code>. Not supported on traversal chains/subfields (e.g. <code>owner.tags IN (...)</code> is invalid, but <code>tags IN (...)</code>, <code>groups IN (...)</code>, <code>notes IN (...)</code>, and <code>resources IN (...)</code> work). <code>children</code>, <code>owner</code>, and <code>parent</code> do not support <code>IN</code>.</p>
+                <p class="text-xs"><code class="bg-stone-200 px-1 rounded">IN (...)</code> / <code class="bg-stone-200 px-1 rounded">NOT IN (...)</code>. Not supported on traversal chains/subfields (e.g. <code>owner.tags IN (...)</code> is invalid, but <code>tags IN (...)</code>, <code>groups IN (...)</code>, <code>notes IN (...)</code>, and <code>resources IN (...)</code> work). <code>children</code>, <code>owner</code>, and <code>parent</code> take a sub-query instead of a list: <code>IN (type = group AND ...)</code>. <code>tags IN (type = ...)</code> matches the tags of the entities the sub-query selects.</p>
                 <pre class="bg-stone-100 p-2 rounded mt-1 overflow-x-auto">contentType IN ("image/png", "image/jpeg", "image/webp")</pre>
                 <pre class="bg-stone-100 p-2 rounded mt-1 overflow-x-auto">type = resource AND NOT (tags IN ("draft", "archived"))</pre>
+                <pre class="bg-stone-100 p-2 rounded mt-1 overflow-x-auto">type = resource AND owner IN (type = group AND category = 4)</pre>
             </div>
             <div>
                 <h3 class="font-semibold text-stone-700">Ranges (BETWEEN)</h3>
@@ -171,6 +172,22 @@
                 <pre class="bg-stone-100 p-2 rounded mt-1 overflow-x-auto">created >= START_OF_WEEK()</pre>
                 <pre class="bg-stone-100 p-2 rounded mt-1 overflow-x-auto">created >= START_OF_YEAR() AND updated < START_OF_MONTH()</pre>
             </div>
+            <div>
+                <h3 class="font-semibold text-stone-700">Scalar Functions</h3>
+                <p class="text-xs">
+                    <code class="bg-stone-200 px-1 rounded">LOWER</code>,
+                    <code class="bg-stone-200 px-1 rounded">UPPER</code>,
+                    <code class="bg-stone-200 px-1 rounded">LENGTH</code>,
+                    <code class="bg-stone-200 px-1 rounded">EXT</code> on text fields;
+                    <code class="bg-stone-200 px-1 rounded">YEAR</code>,
+                    <code class="bg-stone-200 px-1 rounded">MONTH</code>,
+                    <code class="bg-stone-200 px-1 rounded">DAY</code>,
+                    <code class="bg-stone-200 px-1 rounded">DATE_ADD(f, 3d)</code> on dates;
+                    <code class="bg-stone-200 px-1 rounded">JSON_LENGTH(meta.key)</code>
+                </p>
+                <pre class="bg-stone-100 p-2 rounded mt-1 overflow-x-auto">EXT(originalName) IN ("cr2", "nef")</pre>
+                <pre class="bg-stone-100 p-2 rounded mt-1 overflow-x-auto">updated > DATE_ADD(created, 30d)</pre>
+            </div>
             <div>
                 <h3 class="font-semibold text-stone-700">File Size Units</h3>
                 <p class="text-xs">
@@ -214,7 +231,7 @@
             </div>
             <div>
                 <h3 class="font-semibold text-stone-700">Cross-Entity Queries</h3>
-                <p class="text-xs">Omit <code class="bg-stone-200 px-1 rounded">type</code> to search resources, notes, and groups simultaneously. Only common fields (<code class="bg-stone-200 px-1 rounded">id</code>, <code class="bg-stone-200 px-1 rounded">name</code>, <code class="bg-stone-200 px-1 rounded">description</code>, <code class="bg-stone-200 px-1 rounded">created</code>, <code class="bg-stone-200 px-1 rounded">updated</code>, <code class="bg-stone-200 px-1 rounded">tags</code>) are valid &mdash; entity-specific fields will be rejected. GROUP BY requires an explicit <code class="bg-stone-200 px-1 rounded">type</code>. ORDER BY is limited to <code class="bg-stone-200 px-1 rounded">name</code>, <code class="bg-stone-200 px-1 rounded">created</code>, <code class="bg-stone-200 px-1 rounded">updated</code>.</p>
+                <p class="text-xs">Omit <code class="bg-stone-200 px-1 rounded">type</code> to search resources, notes, and groups simultaneously. Only common fields (<code class="bg-stone-200 px-1 rounded">id</code>, <code class="bg-stone-200 px-1 rounded">name</code>, <code class="bg-stone-200 px-1 rounded">description</code>, <code class="bg-stone-200 px-1 rounded">created</code>, <code class="bg-stone-200 px-1 rounded">updated</code>, <code class="bg-stone-200 px-1 rounded">tags</code>) are valid &mdash; entity-specific fields will be rejected. GROUP BY requires an explicit <code class="bg-stone-200 px-1 rounded">type</code>. ORDER BY, LIMIT, and OFFSET apply to one combined list: sort by the common fields, <code class="bg-stone-200 px-1 rounded">RANDOM()</code>, or <code class="bg-stone-200 px-1 rounded">RANK</code> with a <code class="bg-stone-200 px-1 rounded">TEXT ~</code> predicate.</p>
                 <pre class="bg-stone-100 p-2 rounded mt-1 overflow-x-auto">name ~ "budget*" LIMIT 30</pre>
                 <pre class="bg-stone-100 p-2 rounded mt-1 overflow-x-auto">tags = "urgent" LIMIT 50</pre>
             </div>
@@ -224,6 +241,12 @@
                 <pre class="bg-stone-100 p-2 rounded mt-1 overflow-x-auto">type = resource AND tags = "photo" SCOPE 5</pre>
                 <pre class="bg-stone-100 p-2 rounded mt-1 overflow-x-auto">type = note SCOPE "Field Work" ORDER BY created DESC</pre>
             </div>
+            <div>
+                <h3 class="font-semibold text-stone-700">Past States</h3>
+                <p class="text-xs"><code class="bg-stone-200 px-1 rounded">AS OF &lt;date&gt;</code> runs the query against resources, notes and groups as they were then: their fields, whether they existed, and their tags, groups and notes. Tag, category and note type names, blocks, versions and relations are read as they are now. Takes a date string, a relative date or a date function; comes after <code class="bg-stone-200 px-1 rounded">SCOPE</code> and before <code class="bg-stone-200 px-1 rounded">SELECT</code> / <code class="bg-stone-200 px-1 rounded">GROUP BY</code>. Not combinable with <code class="bg-stone-200 px-1 rounded">TEXT ~</code>.</p>
+                <pre class="bg-stone-100 p-2 rounded mt-1 overflow-x-auto">type = resource AND tags = "approved" AS OF "2025-06-01"</pre>
+                <pre class="bg-stone-100 p-2 rounded mt-1 overflow-x-auto">type = group AS OF -30d GROUP BY category COUNT()</pre>
+            </div>
             <div>
                 <h3 class="font-semibold text-stone-700">ORDER BY / LIMIT / OFFSET</h3>
                 <p class="text-xs">Sort by scalar or <code class="bg-stone-200 px-1 rounded">meta.*</code> fields. Relation and traversal fields are not sortable. Multiple ORDER BY columns supported. In bucketed GROUP BY, ORDER BY applies within each bucket.</p>
@@ -245,9 +268,16 @@
                     <code class="bg-stone-200 px-1 rounded">SUM(field)</code>,
                     <code class="bg-stone-200 px-1 rounded">AVG(field)</code>,
                     <code class="bg-stone-200 px-1 rounded">MIN(field)</code>,
-                    <code class="bg-stone-200 px-1 rounded">MAX(field)</code>
+                    <code class="bg-stone-200 px-1 rounded">MAX(field)</code>,
+                    <code class="bg-stone-200 px-1 rounded">COUNT(DISTINCT field)</code>,
+                    <code class="bg-stone-200 px-1 rounded">MEDIAN(field)</code>,
+                    <code class="bg-stone-200 px-1 rounded">PERCENTILE(field, 0.95)</code>,
+                    <code class="bg-stone-200 px-1 rounded">RUNNING_COUNT()</code>,
+                    <code class="bg-stone-200 px-1 rounded">RUNNING_SUM(field)</code>
+                    (running totals need a date bucket such as <code class="bg-stone-200 px-1 rounded">created.month</code>)
                 </p>
                 <pre class="bg-stone-100 p-2 rounded overflow-x-auto mt-1">type = resource GROUP BY contentType COUNT() SUM(fileSize)</pre>
+                <pre class="bg-stone-100 p-2 rounded overflow-x-auto mt-1">type = resource GROUP BY created.month RUNNING_SUM(fileSize)</pre>
                 <p class="text-xs mt-1"><strong>Bucketed</strong> (no functions) &mdash; returns entities organized into groups. LIMIT applies per bucket.</p>
                 <pre class="bg-stone-100 p-2 rounded overflow-x-auto mt-1">type = resource GROUP BY contentType LIMIT 5</pre>
                 <p class="text-xs mt-1">Group by any scalar field, <code class="bg-stone-200 px-1 rounded">meta.*</code>, <code class="bg-stone-200 px-1 rounded">tags</code>, <code class="bg-stone-200 px-1 rounded">owner</code>, <code class="bg-stone-200 px-1 rounded">parent</code>, or traversal paths like <code class="bg-stone-200 px-1 rounded">owner.name</code>, <code class="bg-stone-200 px-1 rounded">owner.meta.key</code>.</p>
@@ -256,6 +286,8 @@
                 <pre class="bg-stone-100 p-2 rounded overflow-x-auto mt-1">type = resource GROUP BY tags COUNT() HAVING SUM(fileSize) > 1gb AND COUNT() >= 10</pre>
                 <p class="text-xs mt-1"><strong>Date buckets</strong> group datetime fields by period: <code class="bg-stone-200 px-1 rounded">created.day</code>, <code class="bg-stone-200 px-1 rounded">created.week</code> (Monday start), <code class="bg-stone-200 px-1 rounded">created.month</code>, <code class="bg-stone-200 px-1 rounded">created.year</code> (same for <code class="bg-stone-200 px-1 rounded">updated</code>). Only valid in GROUP BY and its ORDER BY &mdash; use date ranges in the filter expression. When grouping by a relation, COUNT() counts join rows; grouping by two relations at once multiplies counts.</p>
                 <pre class="bg-stone-100 p-2 rounded overflow-x-auto mt-1">type = note GROUP BY created.month COUNT() ORDER BY created.month ASC</pre>
+                <p class="text-xs mt-1"><strong>SELECT</strong> returns one row per entity with the listed columns instead of whole entities: scalar fields, <code class="bg-stone-200 px-1 rounded">meta.*</code>, relation counts, single references such as <code class="bg-stone-200 px-1 rounded">owner.name</code>, and arithmetic with <code class="bg-stone-200 px-1 rounded">+ - * /</code>. Name a column with <code class="bg-stone-200 px-1 rounded">AS</code>; ORDER BY may use that name. Not combinable with GROUP BY.</p>
+                <pre class="bg-stone-100 p-2 rounded overflow-x-auto mt-1">type = resource SELECT name, owner.name, fileSize / 1mb AS mb ORDER BY mb DESC LIMIT 20</pre>
             </div>
             <div>
                 <h3 class="font-semibold text-stone-700">Examples</h3>
@@ -486,6 +518,17 @@
                         </div>
                     </div>
                     <pre class="overflow-x-auto bg-white border border-stone-200 rounded-md p-3 text-xs font-mono text-stone-800"><code x-text="st.interpolated"></code></pre>
+                    <template x-if="st.aggregates && st.aggregates.length > 0">
+                        <ul class="space-y-1" aria-label="How each aggregate is computed">
+                            <template x-for="agg in st.aggregates" :key="agg.key">
+                                <li class="text-xs font-mono text-stone-700">
+                                    <span class="font-semibold" x-text="agg.function"></span>
+                                    <span class="text-stone-500" x-text="'→ ' + agg.key + ' (' + agg.method + ')'"></span>
+                                    <span x-text="agg.note"></span>
+                                </li>
+                            </template>
+                        </ul>
+                    </template>
                     <template x-if="raw">
                         <div class="space-y-1">
                             <pre class="overflow-x-auto bg-white border border-stone-200 rounded-md p-3 text-xs font-mono text-stone-800"><code x-text="st.sql"></code></pre>
@@ -578,7 +621,7 @@
                     </div>
                 </template>
 
-                {# Aggregated GROUP BY results — render as table                          #}
+                {# Aggregated GROUP BY and SELECT results — render as table               #}
                 {# The header used to be Object.keys(result.rows[0]), which discards the  #}
                 {# order the query was written in: Go marshals a map's keys sorted, so    #}
                 {# `GROUP BY width, height, contentType COUNT()` rendered                 #}
@@ -586,7 +629,7 @@
                 {# GROUP BY written in reverse. `result.columns` is the authored order,   #}
                 {# the same list the CSV export has always used. The Object.keys fallback #}
                 {# keeps an older cached response rendering rather than blank.            #}
-                <template x-if="result.mode === 'aggregated' && result.rows && result.rows.length > 0">
+                <template x-if="(result.mode === 'aggregated' || result.mode === 'projected') && result.rows && result.rows.length > 0">
                     <div class="overflow-x-auto" x-data="{ get cols() { return (result.columns && result.columns.length) ? result.columns : Object.keys(result.rows[0]); } }">
                         <table class="min-w-full text-sm font-mono border border-stone-200 rounded-md">
                             <thead class="bg-stone-100">
@@ -663,12 +706,34 @@
                 </template>
 
                 {# Aggregated/bucketed empty state #}
-                <template x-if="(result.mode === 'aggregated' && (!result.rows || result.rows.length === 0)) || (result.mode === 'bucketed' && (!result.groups || result.groups.length === 0))">
+                <template x-if="((result.mode === 'aggregated' || result.mode === 'projected') && (!result.rows || result.rows.length === 0)) || (result.mode === 'bucketed' && (!result.groups || result.groups.length === 0))">
                     <p class="text-sm text-stone-500 font-mono py-4 text-center">No results found.</p>
                 </template>
 
+                {# Cross-entity results: one list in the query's global order #}
+                <template x-if="!result.mode && result.items && result.items.length > 0">
+                    <div class="grid grid-cols-1 sm:grid-cols-2 lg:grid-cols-3 gap-3">
+                        <template x-for="item in result.items" :key="item.entityType + ':' + item.id">
+                            <div x-data="{ get entity() { return (result[item.entityType + 's'] || []).find(e => e.ID === item.id); } }">
+                                <template x-if="entity && entity.renderedHTML">
+                                    <div x-html="entity.renderedHTML"></div>
+                                </template>
+                                <template x-if="!(entity && entity.renderedHTML)">
+                                    <a :href="'/' + item.entityType + '?id=' + item.id"
+                                       class="block p-3 bg-white border border-stone-200 rounded-md hover:border-amber-400 hover:shadow-sm transition-colors">
+                                        <div class="min-w-0">
+                                            <p class="text-xs font-mono text-amber-800" x-text="item.entityType"></p>
+                                            <p class="text-sm font-medium text-stone-900 truncate" x-text="item.name"></p>
+                                        </div>
+                                    </a>
+                                </template>
+                            </div>
+                        </template>
+                    </div>
+                </template>
+
                 {# Resource results #}
-                <template x-if="!result.mode && result.resources && result.resources.length > 0">
+                <template x-if="!result.mode && !(result.items && result.items.length) && result.resources && result.resources.length > 0">
                     <div>
                         <h3 class="text-sm font-semibold font-mono text-amber-800 mb-2" x-show="result.entityType !== 'resource' && result.entityType !== 'note' && result.entityType !== 'group'">Resources</h3>
                         <div class="gallery grid grid-cols-1 sm:grid-cols-2 lg:grid-cols-3 gap-3">
@@ -708,7 +773,7 @@
                 </template>
 
                 {# Note results #}
-                <template x-if="!result.mode && result.notes && result.notes.length > 0">
+                <template x-if="!result.mode && !(result.items && result.items.length) && result.notes && result.notes.length > 0">
                     <div>
                         <h3 class="text-sm font-semibold font-mono text-amber-800 mb-2" x-show="result.entityType !== 'resource' && result.entityType !== 'note' && result.entityType !== 'group'">Notes</h3>
                         <div class="grid grid-cols-1 sm:grid-cols-2 lg:grid-cols-3 gap-3">
@@ -733,7 +798,7 @@
                 </template>
 
                 {# Group results #}
-                <template x-if="!result.mode && result.groups && result.groups.length > 0">
+                <template x-if="!result.mode && !(result.items && result.items.length) && result.groups && result.groups.length > 0">
                     <div>
                         <h3 class="text-sm font-semibold font-mono text-amber-800 mb-2" x-show="result.entityType !== 'resource' && result.entityType !== 'note' && result.entityType !== 'group'">Groups</h3>
                         <div class="grid grid-cols-1 sm:grid-cols-2 lg:grid-cols-3 gap-3">
@@ -6,14 +6,15 @@ import "time"
 type Config struct {
 	// WorkerCount is the number of concurrent thumbnail generation workers.
 	WorkerCount int
-	// BatchSize is the number of videos to process per backfill cycle.
+	// BatchSize is the number of videos and PDFs to process per backfill cycle.
 	BatchSize int
 	// PollInterval is the time between backfill processing cycles.
 	PollInterval time.Duration
 	// Disabled prevents the thumbnail worker from starting.
 	Disabled bool
-	// Backfill enables batch catch-up for existing videos without thumbnails.
-	// When false (default), only videos queued during upload are processed.
+	// Backfill enables batch catch-up for existing videos and PDFs without
+	// thumbnails. When false (default), only resources queued during upload are
+	// processed.
 	Backfill bool
 }
 
@@ -11,12 +11,23 @@ import (
 	"mahresources/models"
 )
 
+const pdfContentType = "application/pdf"
+
+// IsThumbnailable reports whether resources of contentType are pre-generated
+// by the worker: videos, for which ffmpeg is slow, and PDFs, whose page count
+// and text are read along with the thumbnail.
+func IsThumbnailable(contentType string) bool {
+	return strings.HasPrefix(contentType, "video/") || contentType == pdfContentType
+}
+
 // ThumbnailGenerator is the interface needed to generate thumbnails.
 type ThumbnailGenerator interface {
 	LoadOrCreateThumbnailForResource(resourceId, width, height uint, ctx context.Context) (*models.Preview, error)
 }
 
-// ThumbnailWorker processes video resources to pre-generate null thumbnails in the background.
+// ThumbnailWorker processes video and PDF resources to pre-generate null
+// thumbnails in the background. For a PDF that also reads its page count and
+// text.
 type ThumbnailWorker struct {
 	db     *gorm.DB
 	gen    ThumbnailGenerator
@@ -130,14 +141,14 @@ func (w *ThumbnailWorker) processResource(resourceID uint) {
 		return
 	}
 
-	// Verify the resource is a video
+	// Verify the resource is a video or a PDF
 	var resource models.Resource
 	if err := w.db.Select("id, content_type").First(&resource, resourceID).Error; err != nil {
 		log.Printf("Thumbnail worker: error loading resource %d: %v", resourceID, err)
 		return
 	}
 
-	if !strings.HasPrefix(resource.ContentType, "video/") {
+	if !IsThumbnailable(resource.ContentType) {
 		return
 	}
 
@@ -173,18 +184,18 @@ func (w *ThumbnailWorker) safeProcessBackfillBatch() {
 }
 
 func (w *ThumbnailWorker) processBackfillBatch() {
-	// Find video resources without null thumbnails, prioritizing recent uploads
+	// Find video and PDF resources without null thumbnails, prioritizing recent uploads
 	var resources []models.Resource
 
 	if err := w.db.
 		Select("resources.id").
 		Joins("LEFT JOIN previews ON previews.resource_id = resources.id AND previews.width = 0 AND previews.height = 0").
 		Where("previews.id IS NULL").
-		Where("resources.content_type LIKE 'video/%'").
+		Where("resources.content_type LIKE 'video/%' OR resources.content_type = ?", pdfContentType).
 		Order("resources.id DESC").
 		Limit(w.config.BatchSize).
 		Find(&resources).Error; err != nil {
-		log.Printf("Thumbnail worker: error finding videos to backfill: %v", err)
+		log.Printf("Thumbnail worker: error finding videos and PDFs to backfill: %v", err)
 		return
 	}
 
@@ -192,7 +203,7 @@ func (w *ThumbnailWorker) processBackfillBatch() {
 		return
 	}
 
-	log.Printf("Thumbnail worker: backfilling %d videos", len(resources))
+	log.Printf("Thumbnail worker: backfilling %d videos and PDFs", len(resources))
 
 	for _, resource := range resources {
 		select {